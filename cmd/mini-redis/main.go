@@ -3,29 +3,83 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
+	"github.com/scotro/mini-redis/internal/config"
 	"github.com/scotro/mini-redis/internal/persistence"
 	"github.com/scotro/mini-redis/internal/pubsub"
 	"github.com/scotro/mini-redis/internal/server"
 	"github.com/scotro/mini-redis/internal/store"
 )
 
-const defaultSnapshotPath = "dump.rdb"
+// paramFlags are the configuration parameters that can also be given as
+// flags. Flags override the config file.
+var paramFlags = []struct{ name, usage string }{
+	{"port", "Port to listen on; 0 disables plaintext connections"},
+	{"bind", "Space separated addresses to listen on; * is every address"},
+	{"unixsocket", "Path of a unix domain socket to accept connections on"},
+	{"unixsocketperm", "Permission mode of the unix socket file, in octal (e.g. 700)"},
+	{"timeout", "Close connections idle for this many seconds; 0 never closes them"},
+	{"tls-port", "Port to accept TLS connections on; 0 disables TLS"},
+	{"tls-cert-file", "Path to the server's TLS certificate"},
+	{"tls-key-file", "Path to the server's TLS private key"},
+	{"tls-ca-cert-file", "Path to the CA certificates used to verify client certificates"},
+	{"tls-auth-clients", "Whether TLS clients must present a certificate: yes, no or optional"},
+	{"metrics-port", "Port to serve Prometheus metrics on over HTTP; 0 disables them"},
+	{"requirepass", "Password clients must send with AUTH before running commands"},
+	{"aclfile", "Path to an ACL file with users to load at startup"},
+	{"dir", "Directory the RDB snapshot file is kept in"},
+	{"dbfilename", "Name of the RDB snapshot file"},
+	{"snapshot-format", "Format of the snapshot file: gob, or rdb to share it with Redis and its tools"},
+	{"save", "Snapshot rules as pairs of seconds and changes, e.g. \"3600 1 300 100\""},
+	{"appendonly", "Whether to log write commands to an append-only file: yes or no"},
+	{"appendfilename", "Name of the append-only file, kept in dir"},
+	{"appendfsync", "When to sync the append-only file: always, everysec or no"},
+	{"aof-load-truncated", "Whether to start if the append-only file ends in an incomplete command: yes or no"},
+	{"maxmemory", "Memory limit, e.g. 100mb; 0 means no limit"},
+	{"proto-max-bulk-len", "Maximum size of a single bulk string sent by a client, e.g. 512mb"},
+}
 
 func main() {
-	port := flag.Int("port", 6379, "Port to listen on")
-	snapshotPath := flag.String("dbfilename", defaultSnapshotPath, "Path to RDB snapshot file")
+	for _, f := range paramFlags {
+		flag.String(f.name, config.Default(f.name), f.usage)
+	}
+	expireBudget := flag.Duration("active-expire-budget", store.DefaultExpiryConfig().CycleBudget, "Maximum time spent per active expiration cycle")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [redis.conf]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	params := config.New()
+	if path := flag.Arg(0); path != "" {
+		var err error
+		if params, err = config.Load(path); err != nil {
+			log.Fatalf("Failed to load config file: %v", err)
+		}
+	}
+	// Flags given on the command line override the config file
+	flag.Visit(func(f *flag.Flag) {
+		if !config.Exists(f.Name) {
+			return
+		}
+		if err := params.Set(f.Name, f.Value.String()); err != nil {
+			log.Fatalf("Invalid -%s: %v", f.Name, err)
+		}
+	})
+
 	// Create stores for all data types
 	stringStore := store.New()
 	listStore := store.NewListStore()
 	hashStore := store.NewHashStore()
 	setStore := store.NewSetStore()
+	zsetStore := store.NewZSetStore()
+	streamStore := store.NewStreamStore()
 
 	// Create persistence manager
 	stores := persistence.Stores{
@@ -33,11 +87,22 @@ func main() {
 		Lists:   store.AsSnapshottable(listStore),
 		Hashes:  store.AsSnapshottable(hashStore),
 		Sets:    store.AsSnapshottable(setStore),
+		ZSets:   store.AsSnapshottable(zsetStore),
+		Streams: store.AsSnapshottable(streamStore),
 	}
-	persistMgr := persistence.NewManager(*snapshotPath, stores)
+	persistMgr := persistence.NewManager(filepath.Join(params.String("dir"), params.String("dbfilename")), stores)
+	persistMgr.SetFormat(persistence.Format(params.String("snapshot-format")))
+
+	cfg := server.ConfigFromParams(params)
+	cfg.Expiry.CycleBudget = *expireBudget
 
-	// Load existing snapshot if present
-	if persistMgr.Exists() {
+	// Load existing snapshot if present. With the append-only file enabled,
+	// the dataset is rebuilt from it instead, as in Redis
+	if cfg.AOF != nil {
+		if persistMgr.Exists() {
+			log.Printf("Append-only file enabled, not loading snapshot %s", persistMgr.Path())
+		}
+	} else if persistMgr.Exists() {
 		log.Println("Loading snapshot...")
 		result, err := persistMgr.Load()
 		if err != nil {
@@ -45,12 +110,14 @@ func main() {
 				log.Printf("Warning: failed to load snapshot: %v", err)
 			}
 		} else {
-			log.Printf("Loaded %d keys (strings=%d, lists=%d, hashes=%d, sets=%d)",
+			log.Printf("Loaded %d keys (strings=%d, lists=%d, hashes=%d, sets=%d, zsets=%d, streams=%d)",
 				result.TotalKeys(),
 				result.StringKeys,
 				result.ListKeys,
 				result.HashKeys,
 				result.SetKeys,
+				result.ZSetKeys,
+				result.StreamKeys,
 			)
 		}
 	}
@@ -59,20 +126,31 @@ func main() {
 	ps := pubsub.New()
 
 	// Create server with all stores and features
-	cfg := server.Config{Port: *port}
-	srv := server.New(stringStore, listStore, hashStore, setStore, persistMgr, ps, cfg)
+	srv := server.New(stringStore, listStore, hashStore, setStore, zsetStore, streamStore, persistMgr, ps, cfg)
 
 	// Start server
 	if err := srv.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 
-	// Wait for interrupt signal
+	// Wait for an interrupt signal or the SHUTDOWN command. As in Redis, a
+	// signal saves a final snapshot if save rules are set, and the server
+	// keeps running if that fails
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-
-	log.Println("Shutting down...")
-	srv.Stop()
+	for {
+		select {
+		case <-sigChan:
+			log.Println("Shutting down...")
+			if err := srv.Shutdown(server.ShutdownDefault); err != nil {
+				log.Printf("Error trying to shut down, still running: %v", err)
+				continue
+			}
+		case <-srv.Done():
+			log.Println("Shutting down...")
+			srv.Stop()
+		}
+		break
+	}
 	log.Println("Server stopped")
 }
@@ -0,0 +1,61 @@
+// Command rdb-diff compares two snapshot files and reports the keys added,
+// removed and modified between them. Either may be in mini-redis's own
+// format or the Redis RDB format, so a dump from Redis can be compared too.
+//
+// It exits with status 0 if the snapshots hold the same data, 1 if they
+// differ and 2 if either can't be read, like diff(1).
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/scotro/mini-redis/internal/persistence"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "Print one JSON object per change instead of a line of text")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] old.rdb new.rdb\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	log.SetFlags(0)
+	log.SetPrefix("rdb-diff: ")
+	var snapshots [2]*persistence.Snapshot
+	for i, path := range flag.Args() {
+		snapshot, err := persistence.ReadSnapshot(path)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			os.Exit(2)
+		}
+		snapshots[i] = snapshot
+	}
+
+	changes := persistence.Diff(snapshots[0], snapshots[1])
+	out := bufio.NewWriter(os.Stdout)
+	for _, change := range changes {
+		if *asJSON {
+			data, _ := json.Marshal(change)
+			out.Write(append(data, '\n'))
+		} else {
+			fmt.Fprintln(out, change)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Printf("%v", err)
+		os.Exit(2)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,214 @@
+// Package acl implements Redis 6 style access control lists: users with
+// passwords, and the commands, keys and channels each of them may use.
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultUser is the user connections start as.
+const DefaultUser = "default"
+
+// ErrDefaultUser is returned when trying to delete the default user.
+var ErrDefaultUser = errors.New("The 'default' user cannot be removed")
+
+// ErrInvalidUsername is returned for usernames with spaces or null characters.
+var ErrInvalidUsername = errors.New("Usernames can't contain spaces or null characters")
+
+// Denial describes why a command was refused.
+type Denial struct {
+	Reason string // "command", "key" or "channel"
+	Object string // The command, key or channel that was refused
+}
+
+// Message returns the NOPERM reply for a denial of the named user.
+func (d *Denial) Message(username string) string {
+	switch d.Reason {
+	case "key":
+		return "NOPERM No permissions to access a key"
+	case "channel":
+		return "NOPERM No permissions to access a channel"
+	default:
+		return fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", username, d.Object)
+	}
+}
+
+// ACL holds the users and the log of refused commands.
+// It is safe for concurrent use.
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*User
+	log   *Log
+}
+
+// New creates an ACL with only the default user, which needs no password
+// and may run every command on every key and channel.
+func New() *ACL {
+	a := &ACL{users: make(map[string]*User), log: NewLog(DefaultLogMaxLen)}
+	a.users[DefaultUser] = defaultUser()
+	return a
+}
+
+// defaultUser returns the default user as Redis creates it.
+func defaultUser() *User {
+	u := newUser(DefaultUser)
+	for _, rule := range []string{"on", "nopass", "~*", "&*", "+@all"} {
+		_ = u.apply(rule)
+	}
+	return u
+}
+
+// Log returns the log of refused commands and failed authentications.
+func (a *ACL) Log() *Log {
+	return a.log
+}
+
+// SetUser creates the user if needed and applies rules to it in order.
+// Either every rule is applied or, if one is invalid, none are.
+func (a *ACL) SetUser(name string, rules ...string) error {
+	if strings.ContainsAny(name, " \x00") {
+		return ErrInvalidUsername
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var u *User
+	if existing, ok := a.users[name]; ok {
+		u = existing.clone()
+	} else {
+		u = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := u.apply(rule); err != nil {
+			return ruleError(rule, err)
+		}
+	}
+	a.users[name] = u
+	return nil
+}
+
+// User returns a copy of the named user.
+func (a *ACL) User(name string) (*User, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[name]
+	if !ok {
+		return nil, false
+	}
+	return u.clone(), true
+}
+
+// DelUser deletes the named users and returns how many existed.
+// The default user can't be deleted; if it is named, nothing is deleted.
+func (a *ACL) DelUser(names ...string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, ErrDefaultUser
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := a.users[name]; ok {
+			delete(a.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// List describes every user in ACL file format, sorted by name.
+func (a *ACL) List() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = a.users[name].Describe()
+	}
+	return lines
+}
+
+// Authenticate reports whether password is valid for the named user, which
+// must exist and be enabled.
+func (a *ACL) Authenticate(username, password string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[username]
+	return ok && u.Enabled && u.checkPassword(password)
+}
+
+// RequiresAuth reports whether new connections must authenticate, which is
+// the case unless the default user is enabled and needs no password.
+func (a *ACL) RequiresAuth() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u := a.users[DefaultUser]
+	return !u.Enabled || !u.NoPass
+}
+
+// Check reports whether the named user may run cmd with args, returning why
+// not if it may not. Commands the ACL doesn't know are only allowed with +@all,
+// so they can be reported as unknown.
+func (a *ACL) Check(username, cmd string, args []string) *Denial {
+	cmd = strings.ToLower(cmd)
+	spec, known := commands[cmd]
+	if known && spec.noAuth {
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[username]
+	if !ok || !known && !u.allCommands {
+		return &Denial{Reason: "command", Object: cmd}
+	}
+	if !known {
+		return nil
+	}
+
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	if !u.CanRun(cmd, sub) {
+		object := cmd
+		if sub != "" && u.hasSubcommandRules(cmd) {
+			object = cmd + "|" + strings.ToLower(sub)
+		}
+		return &Denial{Reason: "command", Object: object}
+	}
+
+	if spec.keys != nil {
+		for _, key := range spec.keys(args) {
+			if !u.CanAccessKey(key) {
+				return &Denial{Reason: "key", Object: key}
+			}
+		}
+	}
+	if spec.channels != nil {
+		for _, channel := range spec.channels(args) {
+			if !u.CanAccessChannel(channel, spec.channelPatterns) {
+				return &Denial{Reason: "channel", Object: channel}
+			}
+		}
+	}
+	return nil
+}
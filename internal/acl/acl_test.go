@@ -0,0 +1,159 @@
+package acl
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewDefaultUser(t *testing.T) {
+	a := New()
+	if a.RequiresAuth() {
+		t.Error("RequiresAuth() = true for the default user without a password")
+	}
+	if !a.Authenticate(DefaultUser, "anything") {
+		t.Error("default user rejects passwords")
+	}
+	if got, want := a.List(), []string{"user default on nopass ~* &* +@all"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %q, want %q", got, want)
+	}
+	if d := a.Check(DefaultUser, "FLUSHALL", nil); d != nil {
+		t.Errorf("Check(default, FLUSHALL) = %+v, want allowed", d)
+	}
+
+	if err := a.SetUser(DefaultUser, "resetpass", ">secret"); err != nil {
+		t.Fatalf("SetUser() error = %v", err)
+	}
+	if !a.RequiresAuth() || a.Authenticate(DefaultUser, "anything") || !a.Authenticate(DefaultUser, "secret") {
+		t.Error("default user password not enforced")
+	}
+}
+
+func TestSetUserIsAtomic(t *testing.T) {
+	a := New()
+	if err := a.SetUser("alice", "on", ">pw", "+get"); err != nil {
+		t.Fatalf("SetUser() error = %v", err)
+	}
+
+	err := a.SetUser("alice", "+set", "+nosuchcommand")
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Fatalf("SetUser() error = %v, want ErrUnknownCommand", err)
+	}
+	if want := "Error in ACL SETUSER modifier '+nosuchcommand': Unknown command or category name in ACL"; err.Error() != want {
+		t.Errorf("SetUser() error = %q, want %q", err, want)
+	}
+	if u, _ := a.User("alice"); u.CanRun("set", "") {
+		t.Error("failed SetUser applied +set")
+	}
+
+	if err := a.SetUser("bad name"); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("SetUser(bad name) error = %v, want ErrInvalidUsername", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := New()
+	_ = a.SetUser("alice", "on", ">pw")
+	_ = a.SetUser("bob", "off", ">pw")
+
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "pw", true},
+		{"alice", "wrong", false},
+		{"bob", "pw", false},
+		{"nobody", "pw", false},
+	}
+	for _, tt := range tests {
+		if got := a.Authenticate(tt.user, tt.password); got != tt.want {
+			t.Errorf("Authenticate(%s, %s) = %v, want %v", tt.user, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	a := New()
+	_ = a.SetUser("alice", "on", "nopass", "~app:*", "&news.*", "+@read", "+@pubsub", "+set")
+
+	tests := []struct {
+		cmd  string
+		args []string
+		want *Denial
+	}{
+		{"GET", []string{"app:1"}, nil},
+		{"set", []string{"app:1", "v"}, nil},
+		{"GET", []string{"other"}, &Denial{Reason: "key", Object: "other"}},
+		{"DEL", []string{"app:1"}, &Denial{Reason: "command", Object: "del"}},
+		{"EXISTS", []string{"app:1", "other"}, &Denial{Reason: "key", Object: "other"}},
+		{"PUBLISH", []string{"news.tech", "hi"}, nil},
+		{"PUBLISH", []string{"sport", "hi"}, &Denial{Reason: "channel", Object: "sport"}},
+		{"SUBSCRIBE", []string{"news.a", "sport"}, &Denial{Reason: "channel", Object: "sport"}},
+		{"PSUBSCRIBE", []string{"news.*"}, nil},
+		{"PSUBSCRIBE", []string{"*"}, &Denial{Reason: "channel", Object: "*"}},
+		{"AUTH", []string{"default", "pw"}, nil},
+		{"NOSUCHCOMMAND", nil, &Denial{Reason: "command", Object: "nosuchcommand"}},
+	}
+	for _, tt := range tests {
+		if got := a.Check("alice", tt.cmd, tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Check(%s %v) = %+v, want %+v", tt.cmd, tt.args, got, tt.want)
+		}
+	}
+
+	// Unknown commands are left for the server to report when the user may run anything
+	if d := a.Check(DefaultUser, "NOSUCHCOMMAND", nil); d != nil {
+		t.Errorf("Check(default, NOSUCHCOMMAND) = %+v, want allowed", d)
+	}
+	if d := a.Check("nobody", "GET", []string{"k"}); d == nil {
+		t.Error("Check() allowed a user that doesn't exist")
+	}
+}
+
+func TestCheckSubcommand(t *testing.T) {
+	a := New()
+	_ = a.SetUser("alice", "on", "nopass", "+acl|whoami")
+
+	if d := a.Check("alice", "ACL", []string{"whoami"}); d != nil {
+		t.Errorf("Check(ACL WHOAMI) = %+v, want allowed", d)
+	}
+	want := &Denial{Reason: "command", Object: "acl|list"}
+	if d := a.Check("alice", "ACL", []string{"LIST"}); !reflect.DeepEqual(d, want) {
+		t.Errorf("Check(ACL LIST) = %+v, want %+v", d, want)
+	}
+}
+
+func TestDenialMessage(t *testing.T) {
+	tests := []struct {
+		denial Denial
+		want   string
+	}{
+		{Denial{Reason: "command", Object: "get"}, "NOPERM User alice has no permissions to run the 'get' command"},
+		{Denial{Reason: "key", Object: "k"}, "NOPERM No permissions to access a key"},
+		{Denial{Reason: "channel", Object: "c"}, "NOPERM No permissions to access a channel"},
+	}
+	for _, tt := range tests {
+		if got := tt.denial.Message("alice"); got != tt.want {
+			t.Errorf("Message() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestDelUser(t *testing.T) {
+	a := New()
+	_ = a.SetUser("alice")
+	_ = a.SetUser("bob")
+
+	if _, err := a.DelUser("alice", DefaultUser); !errors.Is(err, ErrDefaultUser) {
+		t.Errorf("DelUser(default) error = %v, want ErrDefaultUser", err)
+	}
+	if _, ok := a.User("alice"); !ok {
+		t.Error("failed DelUser deleted alice")
+	}
+
+	if n, err := a.DelUser("alice", "bob", "nobody"); err != nil || n != 2 {
+		t.Errorf("DelUser() = %d, %v, want 2", n, err)
+	}
+	if got := len(a.List()); got != 1 {
+		t.Errorf("List() has %d users after DelUser, want 1", got)
+	}
+}
@@ -0,0 +1,253 @@
+// Package acl describes the commands the server knows for permission checks:
+// their ACL categories and where their keys and channels are.
+package acl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Categories lists every ACL category, in the order ACL CAT reports them.
+var Categories = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string",
+	"bitmap", "hyperloglog", "geo", "stream", "pubsub", "admin", "fast", "slow",
+	"blocking", "dangerous", "connection", "transaction", "scripting",
+}
+
+// commandSpec describes a command for permission checks.
+type commandSpec struct {
+	categories []string
+
+	// keys returns the key arguments; nil for commands without keys.
+	keys func(args []string) []string
+
+	// channels returns the channel arguments; nil for commands without channels.
+	channels func(args []string) []string
+
+	// channelPatterns is set when the channel arguments are patterns, which
+	// must equal one of the user's channel patterns rather than match it.
+	channelPatterns bool
+
+	// noAuth commands may be run by any user, so clients can always switch users or leave.
+	noAuth bool
+}
+
+// commands holds every command the server implements, keyed by lowercase name.
+var commands = map[string]commandSpec{
+	// Connection commands
+	"ping":  {categories: cats("fast", "connection")},
+	"echo":  {categories: cats("fast", "connection")},
+	"auth":  {categories: cats("fast", "connection"), noAuth: true},
+	"hello": {categories: cats("fast", "connection"), noAuth: true},
+	"quit":  {categories: cats("fast", "connection"), noAuth: true},
+
+	// String commands
+	"get": {categories: cats("read", "string", "fast"), keys: keyRange(0, 0, 1)},
+	"set": {categories: cats("write", "string", "slow"), keys: keyRange(0, 0, 1)},
+
+	// Key commands
+	"del":         {categories: cats("keyspace", "write", "slow"), keys: keyRange(0, -1, 1)},
+	"exists":      {categories: cats("keyspace", "read", "fast"), keys: keyRange(0, -1, 1)},
+	"type":        {categories: cats("keyspace", "read", "fast"), keys: keyRange(0, 0, 1)},
+	"keys":        {categories: cats("keyspace", "read", "slow", "dangerous")},
+	"dbsize":      {categories: cats("keyspace", "read", "fast")},
+	"flushdb":     {categories: cats("keyspace", "write", "slow", "dangerous")},
+	"flushall":    {categories: cats("keyspace", "write", "slow", "dangerous")},
+	"expire":      {categories: cats("keyspace", "write", "fast"), keys: keyRange(0, 0, 1)},
+	"pexpire":     {categories: cats("keyspace", "write", "fast"), keys: keyRange(0, 0, 1)},
+	"expireat":    {categories: cats("keyspace", "write", "fast"), keys: keyRange(0, 0, 1)},
+	"pexpireat":   {categories: cats("keyspace", "write", "fast"), keys: keyRange(0, 0, 1)},
+	"persist":     {categories: cats("keyspace", "write", "fast"), keys: keyRange(0, 0, 1)},
+	"ttl":         {categories: cats("keyspace", "read", "fast"), keys: keyRange(0, 0, 1)},
+	"pttl":        {categories: cats("keyspace", "read", "fast"), keys: keyRange(0, 0, 1)},
+	"expiretime":  {categories: cats("keyspace", "read", "fast"), keys: keyRange(0, 0, 1)},
+	"pexpiretime": {categories: cats("keyspace", "read", "fast"), keys: keyRange(0, 0, 1)},
+
+	// List commands
+	"lpush":  {categories: cats("write", "list", "fast"), keys: keyRange(0, 0, 1)},
+	"rpush":  {categories: cats("write", "list", "fast"), keys: keyRange(0, 0, 1)},
+	"lpop":   {categories: cats("write", "list", "fast"), keys: keyRange(0, 0, 1)},
+	"rpop":   {categories: cats("write", "list", "fast"), keys: keyRange(0, 0, 1)},
+	"lrange": {categories: cats("read", "list", "slow"), keys: keyRange(0, 0, 1)},
+	"llen":   {categories: cats("read", "list", "fast"), keys: keyRange(0, 0, 1)},
+	"lmove":  {categories: cats("write", "list", "slow"), keys: keyRange(0, 1, 1)},
+	"lmpop":  {categories: cats("write", "list", "slow"), keys: numKeys(0)},
+	"blpop":  {categories: cats("write", "list", "slow", "blocking"), keys: keyRange(0, -2, 1)},
+	"brpop":  {categories: cats("write", "list", "slow", "blocking"), keys: keyRange(0, -2, 1)},
+	"blmove": {categories: cats("write", "list", "slow", "blocking"), keys: keyRange(0, 1, 1)},
+	"blmpop": {categories: cats("write", "list", "slow", "blocking"), keys: numKeys(1)},
+
+	// Hash commands
+	"hset":    {categories: cats("write", "hash", "fast"), keys: keyRange(0, 0, 1)},
+	"hget":    {categories: cats("read", "hash", "fast"), keys: keyRange(0, 0, 1)},
+	"hdel":    {categories: cats("write", "hash", "fast"), keys: keyRange(0, 0, 1)},
+	"hgetall": {categories: cats("read", "hash", "slow"), keys: keyRange(0, 0, 1)},
+	"hkeys":   {categories: cats("read", "hash", "slow"), keys: keyRange(0, 0, 1)},
+	"hlen":    {categories: cats("read", "hash", "fast"), keys: keyRange(0, 0, 1)},
+
+	// Set commands
+	"sadd":      {categories: cats("write", "set", "fast"), keys: keyRange(0, 0, 1)},
+	"srem":      {categories: cats("write", "set", "fast"), keys: keyRange(0, 0, 1)},
+	"smembers":  {categories: cats("read", "set", "slow"), keys: keyRange(0, 0, 1)},
+	"sismember": {categories: cats("read", "set", "fast"), keys: keyRange(0, 0, 1)},
+	"scard":     {categories: cats("read", "set", "fast"), keys: keyRange(0, 0, 1)},
+	"sinter":    {categories: cats("read", "set", "slow"), keys: keyRange(0, -1, 1)},
+
+	// Sorted set commands
+	"zadd":             {categories: cats("write", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zincrby":          {categories: cats("write", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zrem":             {categories: cats("write", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zscore":           {categories: cats("read", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zmscore":          {categories: cats("read", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zcard":            {categories: cats("read", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zcount":           {categories: cats("read", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zrank":            {categories: cats("read", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zrevrank":         {categories: cats("read", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zrange":           {categories: cats("read", "sortedset", "slow"), keys: keyRange(0, 0, 1)},
+	"zrangestore":      {categories: cats("write", "sortedset", "slow"), keys: keyRange(0, 1, 1)},
+	"zpopmin":          {categories: cats("write", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zpopmax":          {categories: cats("write", "sortedset", "fast"), keys: keyRange(0, 0, 1)},
+	"zremrangebyrank":  {categories: cats("write", "sortedset", "slow"), keys: keyRange(0, 0, 1)},
+	"zremrangebyscore": {categories: cats("write", "sortedset", "slow"), keys: keyRange(0, 0, 1)},
+	"zremrangebylex":   {categories: cats("write", "sortedset", "slow"), keys: keyRange(0, 0, 1)},
+
+	// Stream commands
+	"xadd":       {categories: cats("write", "stream", "fast"), keys: keyRange(0, 0, 1)},
+	"xlen":       {categories: cats("read", "stream", "fast"), keys: keyRange(0, 0, 1)},
+	"xrange":     {categories: cats("read", "stream", "slow"), keys: keyRange(0, 0, 1)},
+	"xrevrange":  {categories: cats("read", "stream", "slow"), keys: keyRange(0, 0, 1)},
+	"xdel":       {categories: cats("write", "stream", "fast"), keys: keyRange(0, 0, 1)},
+	"xtrim":      {categories: cats("write", "stream", "slow"), keys: keyRange(0, 0, 1)},
+	"xread":      {categories: cats("read", "stream", "slow", "blocking"), keys: streamKeys},
+	"xreadgroup": {categories: cats("write", "stream", "slow", "blocking"), keys: streamKeys},
+	"xgroup":     {categories: cats("write", "stream", "slow"), keys: keyRange(1, 1, 1)},
+	"xack":       {categories: cats("write", "stream", "fast"), keys: keyRange(0, 0, 1)},
+	"xpending":   {categories: cats("read", "stream", "slow"), keys: keyRange(0, 0, 1)},
+	"xclaim":     {categories: cats("write", "stream", "fast"), keys: keyRange(0, 0, 1)},
+	"xautoclaim": {categories: cats("write", "stream", "fast"), keys: keyRange(0, 0, 1)},
+	"xinfo":      {categories: cats("read", "stream", "slow"), keys: keyRange(1, 1, 1)},
+
+	// Persistence commands
+	"save":     {categories: cats("admin", "slow", "dangerous")},
+	"bgsave":   {categories: cats("admin", "slow", "dangerous")},
+	"lastsave": {categories: cats("fast", "dangerous")},
+	"shutdown": {categories: cats("admin", "slow", "dangerous")},
+	"diff":     {categories: cats("admin", "slow", "dangerous")},
+
+	// Pub/Sub commands
+	"publish":      {categories: cats("pubsub", "fast"), channels: keyRange(0, 0, 1)},
+	"subscribe":    {categories: cats("pubsub", "slow"), channels: keyRange(0, -1, 1)},
+	"psubscribe":   {categories: cats("pubsub", "slow"), channels: keyRange(0, -1, 1), channelPatterns: true},
+	"unsubscribe":  {categories: cats("pubsub", "slow")},
+	"punsubscribe": {categories: cats("pubsub", "slow")},
+
+	// Transaction commands
+	"multi":   {categories: cats("fast", "transaction")},
+	"exec":    {categories: cats("slow", "transaction")},
+	"discard": {categories: cats("fast", "transaction")},
+	"watch":   {categories: cats("fast", "transaction"), keys: keyRange(0, -1, 1)},
+	"unwatch": {categories: cats("fast", "transaction")},
+
+	// Server commands
+	"acl":    {categories: cats("admin", "slow", "dangerous")},
+	"config": {categories: cats("admin", "slow", "dangerous")},
+	"info":   {categories: cats("slow", "dangerous")},
+}
+
+func cats(categories ...string) []string {
+	return categories
+}
+
+// keyRange returns an extractor for the arguments from first to last,
+// stepping by step. Positions count from 0 at the first argument after the
+// command name; a negative last counts back from the end, so -1 is the last
+// argument and -2 the one before it.
+func keyRange(first, last, step int) func(args []string) []string {
+	return func(args []string) []string {
+		end := last
+		if end < 0 {
+			end = len(args) + end
+		}
+		end = min(end, len(args)-1)
+
+		var keys []string
+		for i := first; i <= end; i += step {
+			keys = append(keys, args[i])
+		}
+		return keys
+	}
+}
+
+// numKeys returns an extractor for commands like LMPOP, where the argument at
+// pos gives the number of keys that follow it.
+func numKeys(pos int) func(args []string) []string {
+	return func(args []string) []string {
+		if pos >= len(args) {
+			return nil
+		}
+		n, err := strconv.Atoi(args[pos])
+		if err != nil || n <= 0 {
+			return nil
+		}
+		return keyRange(pos+1, pos+n, 1)(args)
+	}
+}
+
+// streamKeys extracts the keys of XREAD and XREADGROUP: the first half of the
+// arguments after STREAMS.
+func streamKeys(args []string) []string {
+	for i, arg := range args {
+		if strings.EqualFold(arg, "STREAMS") {
+			rest := args[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
+
+// IsCommand reports whether name, in lowercase, is a command the ACL knows.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// IsWriteCommand reports whether name, in lowercase, is a command that may
+// modify the dataset.
+func IsWriteCommand(name string) bool {
+	return commands[name].inCategory("write")
+}
+
+// CommandsInCategory returns the names of the commands in category, sorted.
+// It reports false if the category doesn't exist.
+func CommandsInCategory(category string) ([]string, bool) {
+	if !isCategory(category) {
+		return nil, false
+	}
+	names := []string{}
+	for name, spec := range commands {
+		if spec.inCategory(category) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+func isCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (spec commandSpec) inCategory(category string) bool {
+	for _, c := range spec.categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package acl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandKeys(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args string
+		want []string
+	}{
+		{"get", "k", []string{"k"}},
+		{"get", "", nil},
+		{"del", "a b c", []string{"a", "b", "c"}},
+		{"lmove", "src dst LEFT RIGHT", []string{"src", "dst"}},
+		{"blpop", "a b 0", []string{"a", "b"}},
+		{"lmpop", "2 a b LEFT", []string{"a", "b"}},
+		{"lmpop", "5 a b", []string{"a", "b"}},
+		{"lmpop", "x a b", nil},
+		{"blmpop", "0 1 a LEFT", []string{"a"}},
+		{"xread", "COUNT 1 STREAMS s1 s2 0 0", []string{"s1", "s2"}},
+		{"xreadgroup", "GROUP g c streams s >", []string{"s"}},
+		{"xgroup", "CREATE s g $", []string{"s"}},
+		{"xgroup", "HELP", nil},
+		{"zrangestore", "dst src 0 -1", []string{"dst", "src"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd+" "+tt.args, func(t *testing.T) {
+			got := commands[tt.cmd].keys(strings.Fields(tt.args))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandsInCategory(t *testing.T) {
+	names, ok := CommandsInCategory("pubsub")
+	if !ok {
+		t.Fatal("CommandsInCategory(pubsub) not found")
+	}
+	want := []string{"psubscribe", "publish", "punsubscribe", "subscribe", "unsubscribe"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("CommandsInCategory(pubsub) = %v, want %v", names, want)
+	}
+
+	if names, ok := CommandsInCategory("geo"); !ok || len(names) != 0 {
+		t.Errorf("CommandsInCategory(geo) = %v, %v, want empty list", names, ok)
+	}
+	if _, ok := CommandsInCategory("bogus"); ok {
+		t.Error("CommandsInCategory(bogus) found")
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	for name, want := range map[string]bool{"get": true, "config": true, "GET": false, "bogus": false} {
+		if got := IsCommand(name); got != want {
+			t.Errorf("IsCommand(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestIsWriteCommand(t *testing.T) {
+	for name, want := range map[string]bool{"set": true, "blpop": true, "get": false, "config": false, "bogus": false} {
+		if got := IsWriteCommand(name); got != want {
+			t.Errorf("IsWriteCommand(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCommandCategoriesAreKnown(t *testing.T) {
+	for name, spec := range commands {
+		if len(spec.categories) == 0 {
+			t.Errorf("%s has no categories", name)
+		}
+		for _, c := range spec.categories {
+			if !isCategory(c) {
+				t.Errorf("%s has unknown category %q", name, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package acl implements loading users from an ACL file.
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadFile replaces the users with those defined in an ACL file. Each line
+// defines one user in the format of ACL LIST, e.g.
+//
+//	user alice on >secret ~cache:* &news.* -@all +@read
+//
+// Blank lines and lines starting with # are ignored. If the file doesn't
+// define the default user, the current one is kept. Nothing changes unless
+// the whole file is valid.
+func (a *ACL) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	users := make(map[string]*User)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: should start with user keyword", path, lineNum)
+		}
+		name := fields[1]
+		if strings.ContainsRune(name, '\x00') {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, ErrInvalidUsername)
+		}
+		if _, ok := users[name]; ok {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", path, lineNum, name)
+		}
+
+		u := newUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.apply(rule); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNum, ruleError(rule, err))
+			}
+		}
+		users[name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := users[DefaultUser]; !ok {
+		users[DefaultUser] = a.users[DefaultUser]
+	}
+	a.users = users
+	return nil
+}
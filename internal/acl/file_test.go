@@ -0,0 +1,83 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeACLFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users.acl")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write ACL file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeACLFile(t, `# Application users
+user alice on >secret ~app:* &news.* -@all +@read
+
+user bob off nopass
+`)
+
+	a := New()
+	_ = a.SetUser("stale", "on")
+	if err := a.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	want := []string{
+		"user alice on #" + hashPassword("secret") + " ~app:* &news.* -@all +@read",
+		"user bob off nopass resetchannels -@all",
+		"user default on nopass ~* &* +@all",
+	}
+	if got := a.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %q, want %q", got, want)
+	}
+	if !a.Authenticate("alice", "secret") {
+		t.Error("alice's password not loaded")
+	}
+
+	// ACL LIST output can be loaded back
+	reloaded := New()
+	if err := reloaded.LoadFile(writeACLFile(t, strings.Join(a.List(), "\n"))); err != nil {
+		t.Fatalf("LoadFile() of ACL LIST output error = %v", err)
+	}
+	if got := reloaded.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded List() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing keyword", "alice on\n", ":1: should start with user keyword"},
+		{"bad rule", "user alice on\nuser bob +nosuchcommand\n", ":2: Error in ACL SETUSER modifier '+nosuchcommand'"},
+		{"duplicate", "user alice\nuser alice\n", ":2: duplicate user 'alice' found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New()
+			err := a.LoadFile(writeACLFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadFile() error = %v, want %q", err, tt.want)
+			}
+			// Nothing is loaded from an invalid file
+			if got := len(a.List()); got != 1 {
+				t.Errorf("List() has %d users after failed load, want 1", got)
+			}
+		})
+	}
+
+	if err := New().LoadFile(filepath.Join(t.TempDir(), "missing.acl")); !os.IsNotExist(err) {
+		t.Errorf("LoadFile(missing) error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package acl implements the log of refused commands and failed authentications.
+package acl
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLogMaxLen is how many entries the ACL log keeps by default (acllog-max-len).
+const DefaultLogMaxLen = 128
+
+// logGroupingWindow is how long repeats of a denial are counted in the same entry.
+const logGroupingWindow = 60 * time.Second
+
+// LogEntry is one ACL LOG entry. Denials that repeat within a minute share an
+// entry, which counts them.
+type LogEntry struct {
+	ID       int64
+	Count    int
+	Reason   string // "command", "key", "channel" or "auth"
+	Context  string // "toplevel" or "multi"
+	Object   string
+	Username string
+	// ClientInfo describes the connection, in the format of CLIENT INFO.
+	ClientInfo string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// Log keeps the most recent ACL denials, newest first.
+// It is safe for concurrent use.
+type Log struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	maxLen  int
+	nextID  int64
+	now     func() time.Time
+}
+
+// NewLog creates a log that keeps at most maxLen entries.
+func NewLog(maxLen int) *Log {
+	return &Log{maxLen: maxLen, now: time.Now}
+}
+
+// Add records a denial. A repeat of a recent entry with the same reason,
+// context, object and username updates that entry instead of adding one.
+func (l *Log) Add(reason, context, object, username, clientInfo string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for i, e := range l.entries {
+		if e.Reason == reason && e.Context == context && e.Object == object &&
+			e.Username == username && now.Sub(e.Created) < logGroupingWindow {
+			e.Count++
+			e.Updated = now
+			e.ClientInfo = clientInfo
+			// Move the entry back to the front
+			copy(l.entries[1:i+1], l.entries[:i])
+			l.entries[0] = e
+			return
+		}
+	}
+
+	entry := LogEntry{
+		ID:         l.nextID,
+		Count:      1,
+		Reason:     reason,
+		Context:    context,
+		Object:     object,
+		Username:   username,
+		ClientInfo: clientInfo,
+		Created:    now,
+		Updated:    now,
+	}
+	l.nextID++
+	l.entries = append([]LogEntry{entry}, l.entries...)
+	if len(l.entries) > l.maxLen {
+		l.entries = l.entries[:l.maxLen]
+	}
+}
+
+// SetMaxLen changes how many entries the log keeps, dropping the oldest if
+// it holds more.
+func (l *Log) SetMaxLen(maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxLen = maxLen
+	if len(l.entries) > maxLen {
+		l.entries = l.entries[:maxLen]
+	}
+}
+
+// Entries returns up to count of the most recent entries, newest first.
+// A negative count returns every entry.
+func (l *Log) Entries(count int) []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	return append([]LogEntry(nil), l.entries[:count]...)
+}
+
+// Reset clears the log.
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
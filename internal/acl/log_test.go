@@ -0,0 +1,78 @@
+package acl
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLog returns a log whose clock is controlled by the returned pointer.
+func newTestLog(maxLen int) (*Log, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	l := NewLog(maxLen)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLogGroupsRepeats(t *testing.T) {
+	l, now := newTestLog(10)
+
+	l.Add("command", "toplevel", "get", "alice", "id=1")
+	l.Add("key", "toplevel", "secret", "alice", "id=1")
+	*now = now.Add(time.Second)
+	l.Add("command", "toplevel", "get", "alice", "id=2")
+
+	entries := l.Entries(-1)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	first := entries[0]
+	if first.Object != "get" || first.Count != 2 || first.ClientInfo != "id=2" || first.ID != 0 {
+		t.Errorf("repeated entry = %+v, want count 2 moved to the front", first)
+	}
+	if !first.Updated.After(first.Created) {
+		t.Errorf("repeated entry Updated = %v, want after Created %v", first.Updated, first.Created)
+	}
+
+	// After the grouping window a repeat starts a new entry
+	*now = now.Add(time.Minute)
+	l.Add("command", "toplevel", "get", "alice", "id=3")
+	if entries := l.Entries(-1); len(entries) != 3 || entries[0].Count != 1 || entries[0].ID != 2 {
+		t.Errorf("entries after window = %+v, want a new entry with ID 2", entries)
+	}
+}
+
+func TestLogEntries(t *testing.T) {
+	l, _ := newTestLog(3)
+	for _, object := range []string{"a", "b", "c", "d"} {
+		l.Add("key", "toplevel", object, "alice", "")
+	}
+
+	entries := l.Entries(-1)
+	if len(entries) != 3 || entries[0].Object != "d" || entries[2].Object != "b" {
+		t.Errorf("Entries(-1) = %+v, want d, c, b", entries)
+	}
+	if entries := l.Entries(1); len(entries) != 1 || entries[0].Object != "d" {
+		t.Errorf("Entries(1) = %+v, want d", entries)
+	}
+
+	l.Reset()
+	if entries := l.Entries(-1); len(entries) != 0 {
+		t.Errorf("Entries() after Reset = %+v, want none", entries)
+	}
+}
+
+func TestLogSetMaxLen(t *testing.T) {
+	l, _ := newTestLog(5)
+	for _, object := range []string{"a", "b", "c", "d"} {
+		l.Add("key", "toplevel", object, "alice", "")
+	}
+
+	l.SetMaxLen(2)
+	if entries := l.Entries(-1); len(entries) != 2 || entries[0].Object != "d" || entries[1].Object != "c" {
+		t.Errorf("Entries() after SetMaxLen(2) = %+v, want d, c", entries)
+	}
+	l.Add("key", "toplevel", "e", "alice", "")
+	if entries := l.Entries(-1); len(entries) != 2 || entries[0].Object != "e" {
+		t.Errorf("Entries() after Add = %+v, want e, d", entries)
+	}
+}
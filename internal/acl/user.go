@@ -0,0 +1,413 @@
+// Package acl implements ACL users and the rules that configure them.
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/scotro/mini-redis/internal/glob"
+)
+
+// Errors for invalid ACL rules, matching the Redis messages.
+var (
+	ErrSyntax          = errors.New("Syntax error")
+	ErrUnknownCommand  = errors.New("Unknown command or category name in ACL")
+	ErrInvalidHash     = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	ErrNoSuchPassword  = errors.New("The password you are trying to remove from the user does not exist")
+	ErrKeyAfterAll     = errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	ErrChannelAfterAll = errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+)
+
+// User is an ACL user: its credentials and what it may access.
+type User struct {
+	Name    string
+	Enabled bool
+	NoPass  bool
+
+	// passwords holds the SHA-256 digests of the user's passwords, hex encoded.
+	passwords []string
+
+	// allCommands is set by +@all. Otherwise allowed lists the commands, and
+	// "command|subcommand" pairs, the user may run; a subcommand entry
+	// overrides its command.
+	allCommands bool
+	allowed     map[string]bool
+	// commandRules are the command rules applied since the last +@all or -@all,
+	// which is how the user's commands are described.
+	commandRules []string
+
+	allKeys     bool
+	keys        []string
+	allChannels bool
+	channels    []string
+}
+
+// newUser creates a user with the defaults of ACL SETUSER: disabled, without
+// passwords and unable to run commands or access keys and channels.
+func newUser(name string) *User {
+	return &User{Name: name, allowed: map[string]bool{}, commandRules: []string{"-@all"}}
+}
+
+// clone returns a deep copy of u, so rules can be applied to it and then
+// discarded if one of them fails.
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.allowed = make(map[string]bool, len(u.allowed))
+	for k, v := range u.allowed {
+		c.allowed[k] = v
+	}
+	c.commandRules = append([]string(nil), u.commandRules...)
+	c.keys = append([]string(nil), u.keys...)
+	c.channels = append([]string(nil), u.channels...)
+	return &c
+}
+
+// apply applies a single rule such as "on", ">password", "~key:*" or "+@read".
+func (u *User) apply(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.Enabled = true
+		return nil
+	case "off":
+		u.Enabled = false
+		return nil
+	case "nopass":
+		u.NoPass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.NoPass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.allKeys, u.keys = true, nil
+		return nil
+	case "resetkeys":
+		u.allKeys, u.keys = false, nil
+		return nil
+	case "allchannels":
+		u.allChannels, u.channels = true, nil
+		return nil
+	case "resetchannels":
+		u.allChannels, u.channels = false, nil
+		return nil
+	case "allcommands":
+		return u.apply("+@all")
+	case "nocommands":
+		return u.apply("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			if err := u.apply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if rule == "" {
+		return ErrSyntax
+	}
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(rule[1:]))
+		return nil
+	case '#':
+		if !validHash(rule[1:]) {
+			return ErrInvalidHash
+		}
+		u.addPassword(rule[1:])
+		return nil
+	case '<':
+		return u.removePassword(hashPassword(rule[1:]))
+	case '!':
+		if !validHash(rule[1:]) {
+			return ErrInvalidHash
+		}
+		return u.removePassword(rule[1:])
+	case '~':
+		if u.allKeys {
+			return ErrKeyAfterAll
+		}
+		if rule == "~*" {
+			u.allKeys, u.keys = true, nil
+		} else {
+			u.keys = append(u.keys, rule[1:])
+		}
+		return nil
+	case '&':
+		if u.allChannels {
+			return ErrChannelAfterAll
+		}
+		if rule == "&*" {
+			u.allChannels, u.channels = true, nil
+		} else {
+			u.channels = append(u.channels, rule[1:])
+		}
+		return nil
+	case '+', '-':
+		return u.applyCommandRule(rule[0] == '+', strings.ToLower(rule[1:]))
+	default:
+		return ErrSyntax
+	}
+}
+
+// applyCommandRule allows or denies a command, a "command|subcommand" pair or,
+// with a leading @, a category.
+func (u *User) applyCommandRule(allow bool, name string) error {
+	sign := "-"
+	if allow {
+		sign = "+"
+	}
+
+	if name == "@all" {
+		u.allCommands = allow
+		u.allowed = map[string]bool{}
+		u.commandRules = []string{sign + name}
+		return nil
+	}
+
+	var names []string
+	switch cmd, sub, isSub := strings.Cut(name, "|"); {
+	case strings.HasPrefix(name, "@"):
+		var ok bool
+		if names, ok = CommandsInCategory(name[1:]); !ok {
+			return ErrUnknownCommand
+		}
+	case isSub:
+		if _, ok := commands[cmd]; !ok || sub == "" {
+			return ErrUnknownCommand
+		}
+		if u.allCommands && allow {
+			// Already allowed by +@all
+			u.commandRules = append(u.commandRules, sign+name)
+			return nil
+		}
+		u.materialize()
+		u.allowed[name] = allow
+		u.commandRules = append(u.commandRules, sign+name)
+		return nil
+	default:
+		if _, ok := commands[name]; !ok {
+			return ErrUnknownCommand
+		}
+		names = []string{name}
+	}
+
+	if u.allCommands && allow {
+		u.commandRules = append(u.commandRules, sign+name)
+		return nil
+	}
+	u.materialize()
+	for _, n := range names {
+		u.allow(n, allow)
+	}
+	u.commandRules = append(u.commandRules, sign+name)
+	return nil
+}
+
+// materialize turns +@all into an explicit list of every command, so single
+// commands can be taken away from it.
+func (u *User) materialize() {
+	if !u.allCommands {
+		return
+	}
+	u.allCommands = false
+	for name := range commands {
+		u.allowed[name] = true
+	}
+}
+
+// allow sets whether a whole command may be run, dropping its subcommand rules.
+func (u *User) allow(name string, allowed bool) {
+	for key := range u.allowed {
+		if strings.HasPrefix(key, name+"|") {
+			delete(u.allowed, key)
+		}
+	}
+	if allowed {
+		u.allowed[name] = true
+	} else {
+		delete(u.allowed, name)
+	}
+}
+
+func (u *User) addPassword(hash string) {
+	u.NoPass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *User) removePassword(hash string) error {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNoSuchPassword
+}
+
+// checkPassword reports whether password is one of the user's passwords.
+func (u *User) checkPassword(password string) bool {
+	if u.NoPass {
+		return true
+	}
+	hash := hashPassword(password)
+	match := false
+	for _, p := range u.passwords {
+		// Compare in constant time so passwords can't be guessed from timing
+		if subtle.ConstantTimeCompare([]byte(p), []byte(hash)) == 1 {
+			match = true
+		}
+	}
+	return match
+}
+
+// CanRun reports whether the user may run cmd, given in lowercase, with the
+// subcommand sub if the command has one.
+func (u *User) CanRun(cmd, sub string) bool {
+	if u.allCommands {
+		return true
+	}
+	if sub != "" {
+		if allowed, ok := u.allowed[cmd+"|"+strings.ToLower(sub)]; ok {
+			return allowed
+		}
+	}
+	return u.allowed[cmd]
+}
+
+// hasSubcommandRules reports whether any rule names a subcommand of cmd.
+func (u *User) hasSubcommandRules(cmd string) bool {
+	for key := range u.allowed {
+		if strings.HasPrefix(key, cmd+"|") {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessKey reports whether key matches one of the user's key patterns.
+func (u *User) CanAccessKey(key string) bool {
+	if u.allKeys {
+		return true
+	}
+	for _, pattern := range u.keys {
+		if glob.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessChannel reports whether the user may publish or subscribe to
+// channel. A channel pattern, as given to PSUBSCRIBE, is only allowed if it
+// is one of the user's channel patterns.
+func (u *User) CanAccessChannel(channel string, isPattern bool) bool {
+	if u.allChannels {
+		return true
+	}
+	for _, pattern := range u.channels {
+		if isPattern && pattern == channel || !isPattern && glob.Match(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flags returns the user's flags as ACL GETUSER reports them.
+func (u *User) Flags() []string {
+	flags := []string{"off"}
+	if u.Enabled {
+		flags[0] = "on"
+	}
+	if u.NoPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Passwords returns the hex encoded SHA-256 digests of the user's passwords.
+func (u *User) Passwords() []string {
+	return append([]string(nil), u.passwords...)
+}
+
+// CommandRules describes the commands the user may run, e.g. "-@all +@read -keys".
+func (u *User) CommandRules() string {
+	return strings.Join(u.commandRules, " ")
+}
+
+// KeyRules describes the user's key patterns, e.g. "~cache:* ~session:*".
+func (u *User) KeyRules() string {
+	if u.allKeys {
+		return "~*"
+	}
+	rules := make([]string, len(u.keys))
+	for i, k := range u.keys {
+		rules[i] = "~" + k
+	}
+	return strings.Join(rules, " ")
+}
+
+// ChannelRules describes the user's channel patterns, e.g. "&news.*".
+func (u *User) ChannelRules() string {
+	if u.allChannels {
+		return "&*"
+	}
+	rules := make([]string, len(u.channels))
+	for i, c := range u.channels {
+		rules[i] = "&" + c
+	}
+	return strings.Join(rules, " ")
+}
+
+// Describe returns the user as a line of ACL LIST, which is also the ACL file format.
+func (u *User) Describe() string {
+	parts := append([]string{"user", u.Name}, u.Flags()...)
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	if keys := u.KeyRules(); keys != "" {
+		parts = append(parts, keys)
+	}
+	if channels := u.ChannelRules(); channels != "" {
+		parts = append(parts, channels)
+	} else {
+		parts = append(parts, "resetchannels")
+	}
+	parts = append(parts, u.CommandRules())
+	return strings.Join(parts, " ")
+}
+
+// hashPassword returns the hex encoded SHA-256 digest of a password.
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// validHash reports whether s is a hex encoded SHA-256 digest in lowercase.
+func validHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleError reports the rule that failed in the format of ACL SETUSER.
+func ruleError(rule string, err error) error {
+	return fmt.Errorf("Error in ACL SETUSER modifier '%s': %w", rule, err)
+}
@@ -0,0 +1,177 @@
+package acl
+
+import (
+	"errors"
+	"testing"
+)
+
+// userWith creates a user and applies rules to it, failing the test on errors.
+func userWith(t *testing.T, rules ...string) *User {
+	t.Helper()
+	u := newUser("test")
+	for _, rule := range rules {
+		if err := u.apply(rule); err != nil {
+			t.Fatalf("apply(%q) error = %v", rule, err)
+		}
+	}
+	return u
+}
+
+func TestUserCommandRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		allowed []string
+		denied  []string
+		want    string
+	}{
+		{"new user", nil, nil, []string{"get", "ping"}, "-@all"},
+		{"all commands", []string{"+@all"}, []string{"get", "flushall", "acl"}, nil, "+@all"},
+		{"category", []string{"+@read"}, []string{"get", "hgetall", "xread"}, []string{"set", "ping"}, "-@all +@read"},
+		{"category minus command", []string{"+@read", "-keys"}, []string{"get"}, []string{"keys"}, "-@all +@read -keys"},
+		{"all minus category", []string{"allcommands", "-@dangerous"}, []string{"get", "set"}, []string{"flushall", "keys", "acl"}, "+@all -@dangerous"},
+		{"single command", []string{"+GET"}, []string{"get"}, []string{"set"}, "-@all +get"},
+		{"command removed", []string{"+get", "-get"}, nil, []string{"get"}, "-@all +get -get"},
+		{"nocommands resets", []string{"+@all", "nocommands"}, nil, []string{"get"}, "-@all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := userWith(t, tt.rules...)
+			for _, cmd := range tt.allowed {
+				if !u.CanRun(cmd, "") {
+					t.Errorf("CanRun(%s) = false, want true", cmd)
+				}
+			}
+			for _, cmd := range tt.denied {
+				if u.CanRun(cmd, "") {
+					t.Errorf("CanRun(%s) = true, want false", cmd)
+				}
+			}
+			if got := u.CommandRules(); got != tt.want {
+				t.Errorf("CommandRules() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserSubcommandRules(t *testing.T) {
+	u := userWith(t, "+acl|whoami")
+	if !u.CanRun("acl", "WHOAMI") || u.CanRun("acl", "setuser") || u.CanRun("acl", "") {
+		t.Errorf("+acl|whoami allows whoami=%v setuser=%v", u.CanRun("acl", "WHOAMI"), u.CanRun("acl", "setuser"))
+	}
+
+	u = userWith(t, "+@all", "-acl|setuser")
+	if !u.CanRun("acl", "list") || u.CanRun("acl", "SETUSER") {
+		t.Errorf("-acl|setuser allows list=%v setuser=%v", u.CanRun("acl", "list"), u.CanRun("acl", "SETUSER"))
+	}
+
+	// Rules for the whole command replace those for its subcommands
+	u = userWith(t, "+@all", "-acl|setuser", "+acl")
+	if !u.CanRun("acl", "setuser") {
+		t.Error("+acl after -acl|setuser does not allow setuser")
+	}
+}
+
+func TestUserPatterns(t *testing.T) {
+	u := userWith(t, "~cache:*", "~session:?", "&news.*")
+
+	for key, want := range map[string]bool{"cache:1": true, "session:a": true, "session:ab": false, "other": false} {
+		if got := u.CanAccessKey(key); got != want {
+			t.Errorf("CanAccessKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+	for channel, want := range map[string]bool{"news.sport": true, "weather": false} {
+		if got := u.CanAccessChannel(channel, false); got != want {
+			t.Errorf("CanAccessChannel(%q) = %v, want %v", channel, got, want)
+		}
+	}
+	// Patterns must be granted literally
+	if !u.CanAccessChannel("news.*", true) || u.CanAccessChannel("news.s*", true) {
+		t.Error("PSUBSCRIBE patterns are not compared literally")
+	}
+
+	all := userWith(t, "allkeys", "allchannels")
+	if !all.CanAccessKey("anything") || !all.CanAccessChannel("*", true) {
+		t.Error("allkeys/allchannels do not grant access")
+	}
+	if got, want := all.KeyRules()+" "+all.ChannelRules(), "~* &*"; got != want {
+		t.Errorf("rules = %q, want %q", got, want)
+	}
+}
+
+func TestUserPasswords(t *testing.T) {
+	u := userWith(t, "on", ">first", ">second")
+	if !u.checkPassword("first") || !u.checkPassword("second") || u.checkPassword("third") {
+		t.Error("checkPassword does not match the user's passwords")
+	}
+	if len(u.Passwords()) != 2 || u.Passwords()[0] != hashPassword("first") {
+		t.Errorf("Passwords() = %v, want SHA-256 digests", u.Passwords())
+	}
+
+	if err := u.apply("<first"); err != nil || u.checkPassword("first") {
+		t.Errorf("<first error = %v, still valid = %v", err, u.checkPassword("first"))
+	}
+	if err := u.apply("!" + hashPassword("second")); err != nil || u.checkPassword("second") {
+		t.Errorf("!hash error = %v, still valid = %v", err, u.checkPassword("second"))
+	}
+	if err := u.apply("#" + hashPassword("third")); err != nil || !u.checkPassword("third") {
+		t.Errorf("#hash error = %v, valid = %v", err, u.checkPassword("third"))
+	}
+
+	if err := u.apply("nopass"); err != nil || !u.checkPassword("anything") || len(u.Passwords()) != 0 {
+		t.Error("nopass does not accept any password")
+	}
+	if err := u.apply("resetpass"); err != nil || u.checkPassword("anything") {
+		t.Error("resetpass still accepts passwords")
+	}
+}
+
+func TestUserRuleErrors(t *testing.T) {
+	tests := []struct {
+		rules []string
+		want  error
+	}{
+		{[]string{"bogus"}, ErrSyntax},
+		{[]string{""}, ErrSyntax},
+		{[]string{"+nosuchcommand"}, ErrUnknownCommand},
+		{[]string{"+@nosuchcategory"}, ErrUnknownCommand},
+		{[]string{"+get|"}, ErrUnknownCommand},
+		{[]string{"#abc"}, ErrInvalidHash},
+		{[]string{"<missing"}, ErrNoSuchPassword},
+		{[]string{"allkeys", "~foo"}, ErrKeyAfterAll},
+		{[]string{"&*", "&foo"}, ErrChannelAfterAll},
+	}
+
+	for _, tt := range tests {
+		u := newUser("test")
+		var err error
+		for _, rule := range tt.rules {
+			if err = u.apply(rule); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("apply(%q) error = %v, want %v", tt.rules, err, tt.want)
+		}
+	}
+}
+
+func TestUserDescribe(t *testing.T) {
+	tests := []struct {
+		rules []string
+		want  string
+	}{
+		{nil, "user test off resetchannels -@all"},
+		{[]string{"on", "nopass", "~*", "&*", "+@all"}, "user test on nopass ~* &* +@all"},
+		{[]string{"on", "#" + hashPassword("pw"), "~a:*", "~b:*", "&chan", "+@read", "-keys"},
+			"user test on #" + hashPassword("pw") + " ~a:* ~b:* &chan -@all +@read -keys"},
+		{[]string{"on", "nopass", "~*", "&*", "+@all", "reset"}, "user test off resetchannels -@all"},
+	}
+
+	for _, tt := range tests {
+		if got := userWith(t, tt.rules...).Describe(); got != tt.want {
+			t.Errorf("Describe() after %q = %q, want %q", tt.rules, got, tt.want)
+		}
+	}
+}
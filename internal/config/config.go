@@ -0,0 +1,129 @@
+// Package config holds the server's configuration parameters, as read from
+// a redis.conf-style file and changed by CONFIG SET.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/scotro/mini-redis/internal/glob"
+)
+
+// ErrUnknownParam is returned for parameters the server doesn't have.
+var ErrUnknownParam = errors.New("unknown configuration parameter")
+
+// Config holds the value of every parameter. It is safe for concurrent use.
+type Config struct {
+	mu     sync.RWMutex
+	values map[string]string
+	// path is the file the configuration was loaded from, which REWRITE updates.
+	path string
+}
+
+// New creates a configuration with every parameter at its default.
+func New() *Config {
+	c := &Config{values: make(map[string]string, len(params))}
+	for name, p := range params {
+		c.values[name] = p.def
+	}
+	return c
+}
+
+// Path returns the file the configuration was loaded from, if any.
+func (c *Config) Path() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.path
+}
+
+// Check reports whether value is valid for the named parameter, returning
+// it in canonical form.
+func Check(name, value string) (string, error) {
+	p, ok := params[strings.ToLower(name)]
+	if !ok {
+		return "", ErrUnknownParam
+	}
+	return p.normalize(value)
+}
+
+// Set changes a parameter, whether or not it is mutable at runtime.
+func (c *Config) Set(name, value string) error {
+	value, err := Check(name, value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.ToLower(name)] = value
+	return nil
+}
+
+// Get returns the value of the named parameter.
+func (c *Config) Get(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.values[strings.ToLower(name)]
+	return value, ok
+}
+
+// Match returns the parameters whose names match any of the glob patterns,
+// as alternating names and values sorted by name.
+func (c *Config) Match(patterns ...string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var names []string
+	for name := range c.values {
+		for _, pattern := range patterns {
+			if glob.Match(strings.ToLower(pattern), name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		pairs = append(pairs, name, c.values[name])
+	}
+	return pairs
+}
+
+// String returns the value of a parameter.
+func (c *Config) String(name string) string {
+	value, _ := c.Get(name)
+	return value
+}
+
+// Int returns the value of an integer or memory parameter.
+func (c *Config) Int(name string) int {
+	n, _ := strconv.Atoi(c.String(name))
+	return n
+}
+
+// Bool returns the value of a yes/no parameter.
+func (c *Config) Bool(name string) bool {
+	return c.String(name) == "yes"
+}
+
+// Fields returns the value of a parameter split on spaces, such as the bind addresses.
+func (c *Config) Fields(name string) []string {
+	return strings.Fields(c.String(name))
+}
+
+// SaveRules returns the snapshot rules set by the save parameter.
+func (c *Config) SaveRules() []SaveRule {
+	rules, _ := ParseSaveRules(c.String("save"))
+	return rules
+}
+
+// paramError reports an invalid parameter value.
+func paramError(name string, err error) error {
+	return fmt.Errorf("'%s': %w", name, err)
+}
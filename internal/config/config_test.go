@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewHasDefaults(t *testing.T) {
+	c := New()
+	if got := c.Int("port"); got != 6379 {
+		t.Errorf("port = %d, want 6379", got)
+	}
+	if got := c.String("dbfilename"); got != "dump.rdb" {
+		t.Errorf("dbfilename = %q, want dump.rdb", got)
+	}
+	if got := c.Path(); got != "" {
+		t.Errorf("Path() = %q, want none", got)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	c := New()
+	if err := c.Set("MaxMemory", "1mb"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, ok := c.Get("maxmemory"); !ok || got != "1048576" {
+		t.Errorf("Get(maxmemory) = %q, %v; want 1048576", got, ok)
+	}
+
+	// Invalid values leave the parameter alone
+	if err := c.Set("maxmemory", "lots"); err == nil {
+		t.Error("Set() with an invalid value succeeded")
+	}
+	if got := c.Int("maxmemory"); got != 1048576 {
+		t.Errorf("maxmemory = %d after invalid Set, want 1048576", got)
+	}
+
+	if err := c.Set("nosuchparam", "1"); err != ErrUnknownParam {
+		t.Errorf("Set() of unknown parameter error = %v, want ErrUnknownParam", err)
+	}
+	if _, ok := c.Get("nosuchparam"); ok {
+		t.Error("Get() of unknown parameter reported it exists")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c := New()
+	_ = c.Set("tls-port", "6380")
+
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"port"}, []string{"port", "6379"}},
+		{[]string{"PORT"}, []string{"port", "6379"}},
+		{[]string{"*port"}, []string{"metrics-port", "0", "port", "6379", "tls-port", "6380"}},
+		{[]string{"tls-port", "port", "tls-*port"}, []string{"port", "6379", "tls-port", "6380"}},
+		{[]string{"nosuch*"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := c.Match(tt.patterns...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Match(%q) = %q, want %q", tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	c := New()
+	_ = c.Set("bind", "127.0.0.1 ::1")
+	_ = c.Set("save", "60 5")
+	_ = c.Set("appendonly", "yes")
+
+	if got := c.Fields("bind"); !reflect.DeepEqual(got, []string{"127.0.0.1", "::1"}) {
+		t.Errorf("Fields(bind) = %q", got)
+	}
+	if got := c.SaveRules(); !reflect.DeepEqual(got, []SaveRule{{Seconds: 60, Changes: 5}}) {
+		t.Errorf("SaveRules() = %v", got)
+	}
+	if !c.Bool("appendonly") || c.Bool("unixsocket") {
+		t.Errorf("Bool(appendonly) = %v, Bool(unixsocket) = %v; want true and false", c.Bool("appendonly"), c.Bool("unixsocket"))
+	}
+}
@@ -0,0 +1,230 @@
+// Package config implements reading and rewriting redis.conf-style files.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// ErrNoConfigFile is returned by Rewrite when the configuration wasn't loaded from a file.
+var ErrNoConfigFile = errors.New("The server is running without a config file")
+
+// rewriteSignature precedes the parameters CONFIG REWRITE adds to the file.
+const rewriteSignature = "# Generated by CONFIG REWRITE"
+
+// Load reads a configuration file. Each line holds a directive and its
+// arguments, e.g.
+//
+//	port 6380
+//	requirepass "correct horse battery staple"
+//	save 3600 1 300 100
+//
+// Arguments may be quoted as in inline commands. Blank lines and lines
+// starting with # are ignored. When a directive repeats, the last one wins,
+// except that save lines add to the rules given before them.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New()
+	c.path = path
+	seen := make(map[string]bool)
+	for i, line := range splitLines(data) {
+		args, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(args[0])
+		p, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown directive '%s'", path, i+1, args[0])
+		}
+		if len(args) < 2 || !p.multiArg && len(args) != 2 {
+			return nil, fmt.Errorf("%s:%d: wrong number of arguments for '%s'", path, i+1, name)
+		}
+
+		value := strings.Join(args[1:], " ")
+		if name == "save" && seen[name] && value != "" {
+			value = c.values[name] + " " + value
+		}
+		seen[name] = true
+		if err := c.Set(name, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, paramError(name, err))
+		}
+	}
+	return c, nil
+}
+
+// Rewrite writes the current configuration to the file it was loaded from.
+// Directives already in the file are updated in place, keeping comments and
+// the order of lines; parameters changed from their defaults that the file
+// doesn't mention are added at the end, after a signature comment.
+func (c *Config) Rewrite() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.path == "" {
+		return ErrNoConfigFile
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var lines []string
+	written := make(map[string]bool)
+	signed := false
+	for _, line := range splitLines(data) {
+		if strings.TrimSpace(line) == rewriteSignature {
+			signed = true
+		}
+		args, err := parseLine(line)
+		if err != nil || len(args) == 0 || !Exists(args[0]) {
+			lines = append(lines, line)
+			continue
+		}
+		// Repeated directives collapse into the first one
+		name := strings.ToLower(args[0])
+		if !written[name] {
+			lines = append(lines, formatLine(name, c.values[name]))
+			written[name] = true
+		}
+	}
+
+	var added []string
+	for name, value := range c.values {
+		if !written[name] && value != params[name].def {
+			added = append(added, name)
+		}
+	}
+	if len(added) > 0 {
+		sort.Strings(added)
+		if !signed {
+			lines = append(lines, rewriteSignature)
+		}
+		for _, name := range added {
+			lines = append(lines, formatLine(name, c.values[name]))
+		}
+	}
+
+	return writeFileAtomic(c.path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// splitLines splits a file into lines, without a trailing empty line.
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// parseLine splits a configuration line into its directive and arguments.
+// Comments and blank lines have none.
+func parseLine(line string) ([]string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	args, err := resp.SplitArgs(line)
+	if errors.Is(err, resp.ErrUnbalancedQuotes) {
+		return nil, errors.New("unbalanced quotes in configuration line")
+	}
+	return args, err
+}
+
+// formatLine formats a directive, quoting arguments where needed so that
+// parseLine reads back the same value.
+func formatLine(name, value string) string {
+	if params[name].multiArg && value != "" {
+		fields := strings.Fields(value)
+		for i, f := range fields {
+			fields[i] = quoteArg(f)
+		}
+		return name + " " + strings.Join(fields, " ")
+	}
+	return name + " " + quoteArg(value)
+}
+
+// quoteArg returns s unchanged if it can be written bare, and otherwise in
+// double quotes with special characters escaped.
+func quoteArg(s string) string {
+	bare := s != ""
+	for i := 0; i < len(s) && bare; i++ {
+		bare = s[i] > ' ' && s[i] < 0x7f && !strings.ContainsRune(`"'\`, rune(s[i]))
+	}
+	if bare {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if ch < ' ' || ch >= 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeFileAtomic replaces the file at path with data, keeping its
+// permissions, so a crash never leaves a half-written file behind.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,243 @@
+// Package config describes the configuration parameters the server knows:
+// their defaults, whether they can be changed at runtime and how their
+// values are checked.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// param describes a configuration parameter.
+type param struct {
+	def string
+
+	// mutable parameters may be changed by CONFIG SET while the server runs.
+	mutable bool
+
+	// multiArg parameters take several arguments in the config file, such as
+	// "bind 127.0.0.1 ::1" or "save 3600 1 300 100". Their value is the
+	// arguments joined by spaces.
+	multiArg bool
+
+	// normalize checks a value and returns it in canonical form, which is
+	// what CONFIG GET reports.
+	normalize func(value string) (string, error)
+}
+
+// params holds every configuration parameter, keyed by lowercase name.
+var params = map[string]param{
+	// Network
+	"bind":             {def: "*", multiArg: true, normalize: addresses},
+	"port":             {def: "6379", normalize: intRange(0, 65535)},
+	"unixsocket":       {def: "", normalize: anyString},
+	"unixsocketperm":   {def: "0", normalize: permissions},
+	"timeout":          {def: "0", mutable: true, normalize: intRange(0, maxInt)},
+	"tls-port":         {def: "0", normalize: intRange(0, 65535)},
+	"tls-cert-file":    {def: "", normalize: anyString},
+	"tls-key-file":     {def: "", normalize: anyString},
+	"tls-ca-cert-file": {def: "", normalize: anyString},
+	"tls-auth-clients": {def: "yes", normalize: oneOf("yes", "no", "optional")},
+	"metrics-port":     {def: "0", normalize: intRange(0, 65535)},
+
+	// Security
+	"requirepass":    {def: "", mutable: true, normalize: anyString},
+	"aclfile":        {def: "", normalize: anyString},
+	"acllog-max-len": {def: "128", mutable: true, normalize: intRange(0, maxInt)},
+
+	// Persistence
+	"dir":             {def: ".", mutable: true, normalize: nonEmpty},
+	"dbfilename":      {def: "dump.rdb", mutable: true, normalize: fileName("dbfilename")},
+	"save":            {def: "3600 1 300 100 60 10000", mutable: true, multiArg: true, normalize: saveRules},
+	"snapshot-format": {def: "gob", mutable: true, normalize: oneOf("gob", "rdb")},
+
+	// Append-only file
+	"appendonly":         {def: "no", normalize: yesNo},
+	"appendfilename":     {def: "appendonly.aof", normalize: fileName("appendfilename")},
+	"appendfsync":        {def: "everysec", mutable: true, normalize: oneOf("always", "everysec", "no")},
+	"aof-load-truncated": {def: "yes", mutable: true, normalize: yesNo},
+
+	// Limits
+	"maxmemory":          {def: "0", mutable: true, normalize: memory},
+	"proto-max-bulk-len": {def: "536870912", mutable: true, normalize: memoryRange(1024*1024, maxInt32)},
+}
+
+const (
+	maxInt   = int(^uint(0) >> 1)
+	maxInt32 = 1<<31 - 1
+)
+
+// Exists reports whether name is a configuration parameter.
+func Exists(name string) bool {
+	_, ok := params[strings.ToLower(name)]
+	return ok
+}
+
+// Mutable reports whether the named parameter may be changed at runtime.
+func Mutable(name string) bool {
+	return params[strings.ToLower(name)].mutable
+}
+
+// Default returns the default value of the named parameter.
+func Default(name string) string {
+	return params[strings.ToLower(name)].def
+}
+
+func anyString(value string) (string, error) {
+	return value, nil
+}
+
+func nonEmpty(value string) (string, error) {
+	if value == "" {
+		return "", errors.New("argument must not be empty")
+	}
+	return value, nil
+}
+
+func fileName(name string) func(string) (string, error) {
+	return func(value string) (string, error) {
+		if value == "" || strings.ContainsRune(value, '/') {
+			return "", fmt.Errorf("%s can't be a path, just a filename", name)
+		}
+		return value, nil
+	}
+}
+
+func yesNo(value string) (string, error) {
+	return oneOf("yes", "no")(value)
+}
+
+func intRange(lo, hi int) func(string) (string, error) {
+	return func(value string) (string, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", errors.New("argument couldn't be parsed into an integer")
+		}
+		if n < lo || n > hi {
+			return "", fmt.Errorf("argument must be between %d and %d inclusive", lo, hi)
+		}
+		return strconv.Itoa(n), nil
+	}
+}
+
+func oneOf(values ...string) func(string) (string, error) {
+	return func(value string) (string, error) {
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(values, ", "))
+	}
+}
+
+// permissions accepts an octal file mode such as 700.
+func permissions(value string) (string, error) {
+	n, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || n > 0o777 {
+		return "", errors.New("argument must be an octal permission mode")
+	}
+	return strconv.FormatUint(n, 8), nil
+}
+
+// memory accepts a size in bytes, optionally with a unit: 100mb, 1gb, 512k.
+// Units without a b (k, m, g) are powers of 1000, as in redis.conf.
+func memory(value string) (string, error) {
+	n, err := ParseMemory(value)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+func memoryRange(lo, hi int64) func(string) (string, error) {
+	return func(value string) (string, error) {
+		n, err := ParseMemory(value)
+		if err != nil {
+			return "", err
+		}
+		if n < lo || n > hi {
+			return "", fmt.Errorf("argument must be between %d and %d inclusive", lo, hi)
+		}
+		return strconv.FormatInt(n, 10), nil
+	}
+}
+
+// memoryUnits are the multipliers of the memory units, longest suffix first.
+var memoryUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseMemory parses a memory size such as 100mb into bytes.
+func ParseMemory(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	mult := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, mult = strings.TrimSuffix(lower, unit.suffix), unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/mult {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * mult, nil
+}
+
+// addresses accepts the space separated addresses to listen on; * is every
+// IPv4 address and -::* every IPv6 one, where a leading - means the address
+// is optional.
+func addresses(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", errors.New("argument must not be empty")
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// SaveRule triggers a snapshot when at least Changes writes happened in the
+// last Seconds seconds.
+type SaveRule struct {
+	Seconds int
+	Changes int
+}
+
+// saveRules accepts pairs of seconds and changes, or an empty value to
+// disable snapshots.
+func saveRules(value string) (string, error) {
+	rules, err := ParseSaveRules(value)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(rules)*2)
+	for _, r := range rules {
+		parts = append(parts, strconv.Itoa(r.Seconds), strconv.Itoa(r.Changes))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// ParseSaveRules parses save rules such as "3600 1 300 100".
+func ParseSaveRules(value string) ([]SaveRule, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("Invalid save parameters")
+	}
+	rules := make([]SaveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.Atoi(fields[i])
+		changes, err2 := strconv.Atoi(fields[i+1])
+		if err1 != nil || err2 != nil || seconds < 1 || changes < 0 {
+			return nil, errors.New("Invalid save parameters")
+		}
+		rules = append(rules, SaveRule{Seconds: seconds, Changes: changes})
+	}
+	return rules, nil
+}
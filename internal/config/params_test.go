@@ -0,0 +1,122 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"port", "6380", "6380", false},
+		{"port", "65536", "", true},
+		{"port", "abc", "", true},
+		{"timeout", "-1", "", true},
+		{"tls-auth-clients", "OPTIONAL", "optional", false},
+		{"tls-auth-clients", "maybe", "", true},
+		{"metrics-port", "9121", "9121", false},
+		{"unixsocketperm", "0700", "700", false},
+		{"unixsocketperm", "800", "", true},
+		{"maxmemory", "100mb", "104857600", false},
+		{"maxmemory", "1k", "1000", false},
+		{"maxmemory", "-1", "", true},
+		{"proto-max-bulk-len", "1kb", "", true},
+		{"dbfilename", "data.rdb", "data.rdb", false},
+		{"dbfilename", "dir/data.rdb", "", true},
+		{"dir", "", "", true},
+		{"appendonly", "YES", "yes", false},
+		{"appendonly", "true", "", true},
+		{"appendfilename", "dir/log.aof", "", true},
+		{"appendfsync", "Always", "always", false},
+		{"appendfsync", "sometimes", "", true},
+		{"bind", " 127.0.0.1   ::1 ", "127.0.0.1 ::1", false},
+		{"save", "900  1 300 10", "900 1 300 10", false},
+		{"save", "", "", false},
+		{"save", "900", "", true},
+		{"save", "0 1", "", true},
+		{"nosuchparam", "1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			got, err := Check(tt.name, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check(%q, %q) error = %v, wantErr %v", tt.name, tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Check(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	for name, p := range params {
+		got, err := p.normalize(p.def)
+		if err != nil {
+			t.Errorf("default of %s is invalid: %v", name, err)
+		} else if got != p.def {
+			t.Errorf("default of %s = %q, want canonical form %q", name, p.def, got)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1024", 1024, false},
+		{"10b", 10, false},
+		{"1k", 1000, false},
+		{"1KB", 1024, false},
+		{"2m", 2000000, false},
+		{"2mb", 2 * 1024 * 1024, false},
+		{"1g", 1000000000, false},
+		{"1gb", 1 << 30, false},
+		{"", 0, true},
+		{"mb", 0, true},
+		{"1tb", 0, true},
+		{"99999999999gb", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMemory(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMemory(%q) = %d, %v; want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSaveRules(t *testing.T) {
+	rules, err := ParseSaveRules("3600 1 300 100")
+	if err != nil {
+		t.Fatalf("ParseSaveRules() error = %v", err)
+	}
+	want := []SaveRule{{Seconds: 3600, Changes: 1}, {Seconds: 300, Changes: 100}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("ParseSaveRules() = %v, want %v", rules, want)
+	}
+
+	if rules, err := ParseSaveRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("ParseSaveRules(\"\") = %v, %v; want no rules", rules, err)
+	}
+}
+
+func TestMutable(t *testing.T) {
+	if !Mutable("REQUIREPASS") {
+		t.Error("requirepass should be mutable")
+	}
+	if Mutable("port") {
+		t.Error("port should not be mutable")
+	}
+	if Mutable("nosuchparam") || Exists("nosuchparam") {
+		t.Error("unknown parameters should neither exist nor be mutable")
+	}
+}
@@ -0,0 +1,259 @@
+// Package metrics implements counters and histograms and writes them in the
+// Prometheus text exposition format, using only the standard library.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metric types as written on # TYPE lines.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+)
+
+// LatencyBuckets are histogram bucket upper bounds in seconds, from 10µs to 10s.
+var LatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Label is a label name and value.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one line of a metric family.
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with its help text, type and samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// NewFamily creates a family with no samples.
+func NewFamily(name, typ, help string) *Family {
+	return &Family{Name: name, Help: help, Type: typ}
+}
+
+// Add adds a sample named after the family.
+func (f *Family) Add(value float64, labels ...Label) {
+	f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: labels, Value: value})
+}
+
+// Write writes the families in the Prometheus text exposition format.
+func Write(w io.Writer, families []*Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		bw.WriteString("# HELP " + f.Name + " " + helpEscaper.Replace(f.Help) + "\n")
+		bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		for _, s := range f.Samples {
+			bw.WriteString(s.Name)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(l.Name + `="` + labelEscaper.Replace(l.Value) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatFloat(s.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CounterVec counts events per value of a single label.
+// It is safe for concurrent use.
+type CounterVec struct {
+	label  string
+	mu     sync.RWMutex
+	counts map[string]*atomic.Uint64
+}
+
+// NewCounterVec creates a counter partitioned by the named label.
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{label: label, counts: make(map[string]*atomic.Uint64)}
+}
+
+// Inc adds one to the count for the label value.
+func (c *CounterVec) Inc(value string) {
+	c.mu.RLock()
+	n, ok := c.counts[value]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if n, ok = c.counts[value]; !ok {
+			n = new(atomic.Uint64)
+			c.counts[value] = n
+		}
+		c.mu.Unlock()
+	}
+	n.Add(1)
+}
+
+// Get returns the count for the label value.
+func (c *CounterVec) Get(value string) uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if n, ok := c.counts[value]; ok {
+		return n.Load()
+	}
+	return 0
+}
+
+// Collect adds a sample per label value to f, sorted by value.
+func (c *CounterVec) Collect(f *Family) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, value := range sortedKeys(c.counts) {
+		f.Add(float64(c.counts[value].Load()), Label{c.label, value})
+	}
+}
+
+// Histogram counts observations in buckets and tracks their sum.
+// It is safe for concurrent use.
+type Histogram struct {
+	buckets []float64
+	// counts holds the observations in each bucket, not cumulative; the last
+	// one counts those above every bound.
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sumBits atomic.Uint64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds,
+// which must be sorted.
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.buckets, v)].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of the observations.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sumBits.Load())
+}
+
+// collect adds the cumulative _bucket samples and the _sum and _count
+// samples to f, each with labels.
+func (h *Histogram) collect(f *Family, labels ...Label) {
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		le := math.Inf(1)
+		if i < len(h.buckets) {
+			le = h.buckets[i]
+		}
+		bucketLabels := append(append([]Label(nil), labels...), Label{"le", formatFloat(le)})
+		f.Samples = append(f.Samples, Sample{Name: f.Name + "_bucket", Labels: bucketLabels, Value: float64(cumulative)})
+	}
+	f.Samples = append(f.Samples,
+		Sample{Name: f.Name + "_sum", Labels: labels, Value: h.Sum()},
+		Sample{Name: f.Name + "_count", Labels: labels, Value: float64(h.Count())},
+	)
+}
+
+// Collect adds the histogram's samples to f.
+func (h *Histogram) Collect(f *Family) {
+	h.collect(f)
+}
+
+// HistogramVec is a histogram per value of a single label.
+// It is safe for concurrent use.
+type HistogramVec struct {
+	label      string
+	buckets    []float64
+	mu         sync.RWMutex
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec creates histograms with the given buckets, partitioned by
+// the named label.
+func NewHistogramVec(label string, buckets []float64) *HistogramVec {
+	return &HistogramVec{label: label, buckets: buckets, histograms: make(map[string]*Histogram)}
+}
+
+// With returns the histogram for the label value, creating it if needed.
+func (h *HistogramVec) With(value string) *Histogram {
+	h.mu.RLock()
+	hist, ok := h.histograms[value]
+	h.mu.RUnlock()
+	if ok {
+		return hist
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hist, ok = h.histograms[value]; !ok {
+		hist = NewHistogram(h.buckets)
+		h.histograms[value] = hist
+	}
+	return hist
+}
+
+// Collect adds the samples of every histogram to f, sorted by label value.
+func (h *HistogramVec) Collect(f *Family) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, value := range sortedKeys(h.histograms) {
+		h.histograms[value].collect(f, Label{h.label, value})
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	counter := NewFamily("requests_total", TypeCounter, "Requests served.\nPer path.")
+	counter.Add(3, Label{"path", `/a"b\c`})
+	counter.Add(1.5)
+	gauge := NewFamily("temperature", TypeGauge, "Current temperature.")
+	gauge.Add(math.Inf(1))
+
+	var b strings.Builder
+	if err := Write(&b, []*Family{counter, gauge}); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	want := `# HELP requests_total Requests served.\nPer path.
+# TYPE requests_total counter
+requests_total{path="/a\"b\\c"} 3
+requests_total 1.5
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature +Inf
+`
+	if b.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("cmd")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Inc("get")
+			}
+		}()
+	}
+	wg.Wait()
+	c.Inc("set")
+
+	if got := c.Get("get"); got != 1000 {
+		t.Errorf("Get(get) = %d, want 1000", got)
+	}
+	if got := c.Get("missing"); got != 0 {
+		t.Errorf("Get(missing) = %d, want 0", got)
+	}
+
+	f := NewFamily("calls_total", TypeCounter, "Calls.")
+	c.Collect(f)
+	want := []Sample{
+		{Name: "calls_total", Labels: []Label{{"cmd", "get"}}, Value: 1000},
+		{Name: "calls_total", Labels: []Label{{"cmd", "set"}}, Value: 1},
+	}
+	if len(f.Samples) != len(want) {
+		t.Fatalf("Collect() added %d samples, want %d", len(f.Samples), len(want))
+	}
+	for i, s := range f.Samples {
+		if s.Name != want[i].Name || s.Labels[0] != want[i].Labels[0] || s.Value != want[i].Value {
+			t.Errorf("sample %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		h.Observe(v)
+	}
+	if h.Count() != 4 || h.Sum() != 2.65 {
+		t.Errorf("Count() = %d, Sum() = %g, want 4 and 2.65", h.Count(), h.Sum())
+	}
+
+	f := NewFamily("latency_seconds", TypeHistogram, "Latency.")
+	h.Collect(f)
+	var b strings.Builder
+	_ = Write(&b, []*Family{f})
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 2.65
+latency_seconds_count 4
+`
+	if b.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("cmd", []float64{1})
+	h.With("set").Observe(2)
+	h.With("get").Observe(0.5)
+	h.With("get").Observe(0.5)
+
+	f := NewFamily("duration_seconds", TypeHistogram, "Duration.")
+	h.Collect(f)
+	var b strings.Builder
+	_ = Write(&b, []*Family{f})
+	want := `# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{cmd="get",le="1"} 2
+duration_seconds_bucket{cmd="get",le="+Inf"} 2
+duration_seconds_sum{cmd="get"} 1
+duration_seconds_count{cmd="get"} 2
+duration_seconds_bucket{cmd="set",le="1"} 0
+duration_seconds_bucket{cmd="set",le="+Inf"} 1
+duration_seconds_sum{cmd="set"} 2
+duration_seconds_count{cmd="set"} 1
+`
+	if b.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,310 @@
+// Package persistence implements the append-only file, which logs every write
+// command so the dataset can be rebuilt by replaying them after a restart.
+package persistence
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// FsyncPolicy is when appended commands are flushed to disk (appendfsync).
+type FsyncPolicy string
+
+// Fsync policies, as named in redis.conf.
+const (
+	// FsyncAlways syncs after every append, before the command is acknowledged.
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncEverySec syncs once a second, so a crash loses at most a second of writes.
+	FsyncEverySec FsyncPolicy = "everysec"
+	// FsyncNo leaves syncing to the operating system.
+	FsyncNo FsyncPolicy = "no"
+)
+
+// ErrAOFTruncated is returned when the append-only file ends in the middle of
+// a command and truncation wasn't allowed.
+var ErrAOFTruncated = errors.New("append-only file is truncated")
+
+// AOF appends commands to an append-only file.
+// It is safe for concurrent use.
+type AOF struct {
+	mu     sync.Mutex
+	file   *os.File
+	policy FsyncPolicy
+	// dirty is set when commands were written since the last sync.
+	dirty bool
+	// pending holds commands a failed write left unwritten, in order.
+	pending []byte
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// OpenAOF opens the append-only file at path for appending, creating it if
+// it doesn't exist.
+func OpenAOF(path string, policy FsyncPolicy) (*AOF, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open append-only file: %w", err)
+	}
+	a := &AOF{file: file, policy: policy, done: make(chan struct{})}
+	a.wg.Add(1)
+	go a.syncEverySecond()
+	return a, nil
+}
+
+// Path returns the path of the append-only file.
+func (a *AOF) Path() string {
+	return a.file.Name()
+}
+
+// SetFsyncPolicy changes when appended commands are synced.
+func (a *AOF) SetFsyncPolicy(policy FsyncPolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+}
+
+// Append writes commands to the file in RESP format, in a single write.
+// With FsyncAlways it returns once they are on disk. If the write fails, what
+// wasn't written is kept and written first by the next Append or Retry, so a
+// failure never leaves a gap or half a command in the middle of the file.
+func (a *AOF) Append(commands ...[]string) error {
+	var buf []byte
+	for _, args := range commands {
+		array := make([]resp.Value, len(args))
+		for i, arg := range args {
+			array[i] = resp.Value{Type: resp.TypeBulkString, Str: arg}
+		}
+		buf = append(buf, resp.Value{Type: resp.TypeArray, Array: array}.Serialize()...)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, buf...)
+	return a.flush()
+}
+
+// Retry writes, and with FsyncAlways syncs, what failed Appends left.
+// It returns nil once the file holds every command appended.
+func (a *AOF) Retry() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flush()
+}
+
+// flush writes the pending commands, syncing them with FsyncAlways (must
+// hold mutex).
+func (a *AOF) flush() error {
+	if len(a.pending) > 0 {
+		n, err := a.file.Write(a.pending)
+		if n > 0 {
+			a.dirty = true
+		}
+		if err != nil {
+			a.pending = a.pending[n:]
+			return fmt.Errorf("failed to write to append-only file: %w", err)
+		}
+		a.pending = nil
+	}
+	if a.policy == FsyncAlways {
+		return a.sync()
+	}
+	return nil
+}
+
+// sync flushes the file to disk (must hold mutex).
+func (a *AOF) sync() error {
+	if !a.dirty {
+		return nil
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync append-only file: %w", err)
+	}
+	a.dirty = false
+	return nil
+}
+
+// syncEverySecond syncs the file once a second under FsyncEverySec, until Close.
+func (a *AOF) syncEverySecond() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			if a.policy == FsyncEverySec {
+				if err := a.sync(); err != nil {
+					log.Printf("Error syncing append-only file: %v", err)
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Close syncs and closes the file, whatever the fsync policy.
+func (a *AOF) Close() error {
+	close(a.done)
+	a.wg.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.flush()
+	a.dirty = true
+	if err == nil {
+		err = a.sync()
+	}
+	if err != nil {
+		_ = a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// AOFReplay describes the replay of an append-only file.
+type AOFReplay struct {
+	Commands int
+	// TruncatedBytes is how much of the file's end was an incomplete command,
+	// or a transaction without its EXEC, and was discarded.
+	TruncatedBytes int64
+}
+
+// ReplayAOF reads the append-only file at path and calls apply with each
+// command's arguments in order. A missing file replays nothing. Commands
+// between MULTI and EXEC are only applied once the EXEC has been read.
+//
+// If the file ends in the middle of a command or transaction, as after a
+// crash during a write, the incomplete tail is cut off the file when truncate
+// is set. Otherwise ErrAOFTruncated is returned after applying the complete
+// commands.
+func ReplayAOF(path string, truncate bool, apply func(args []string) error) (AOFReplay, error) {
+	var result AOFReplay
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to open append-only file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	counter := &countingReader{r: file}
+	reader := bufio.NewReader(counter)
+	offset := func() int64 { return counter.n - int64(reader.Buffered()) }
+
+	// valid is the offset after the last command applied outside a
+	// transaction; an incomplete tail starts there.
+	var valid int64
+	var queued [][]string
+	inMulti := false
+	for {
+		if _, err := reader.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return result, fmt.Errorf("failed to read append-only file: %w", err)
+		}
+
+		start := offset()
+		args, err := readAOFCommand(reader)
+		if errors.Is(err, resp.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("bad append-only file format at offset %d: %w", start, err)
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			if inMulti {
+				return result, fmt.Errorf("bad append-only file format at offset %d: nested MULTI", start)
+			}
+			inMulti, queued = true, nil
+		case "EXEC":
+			if !inMulti {
+				return result, fmt.Errorf("bad append-only file format at offset %d: EXEC without MULTI", start)
+			}
+			for _, q := range queued {
+				if err := apply(q); err != nil {
+					return result, fmt.Errorf("append-only file command at offset %d: %w", start, err)
+				}
+				result.Commands++
+			}
+			inMulti, queued = false, nil
+		default:
+			if inMulti {
+				queued = append(queued, args)
+				continue
+			}
+			if err := apply(args); err != nil {
+				return result, fmt.Errorf("append-only file command at offset %d: %w", start, err)
+			}
+			result.Commands++
+		}
+		if !inMulti {
+			valid = offset()
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return result, fmt.Errorf("failed to read append-only file: %w", err)
+	}
+	if valid == info.Size() {
+		return result, nil
+	}
+	result.TruncatedBytes = info.Size() - valid
+	if !truncate {
+		return result, fmt.Errorf("%w: the last %d bytes, after offset %d, are incomplete", ErrAOFTruncated, result.TruncatedBytes, valid)
+	}
+	if err := os.Truncate(path, valid); err != nil {
+		return result, fmt.Errorf("failed to truncate append-only file: %w", err)
+	}
+	return result, nil
+}
+
+// readAOFCommand reads one command, an array of bulk strings.
+func readAOFCommand(reader *bufio.Reader) ([]string, error) {
+	// The file was written by the server, so it isn't held to client limits
+	v, err := resp.ParseWithLimits(reader, resp.Limits{MaxBulkLen: math.MaxInt32})
+	if err != nil {
+		return nil, err
+	}
+	if v.Type != resp.TypeArray || len(v.Array) == 0 {
+		return nil, errors.New("expected a command")
+	}
+	args := make([]string, len(v.Array))
+	for i, arg := range v.Array {
+		if arg.Type != resp.TypeBulkString {
+			return nil, errors.New("expected a command")
+		}
+		args[i] = arg.Str
+	}
+	return args, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// replayAll replays the file at path and returns the commands applied.
+func replayAll(t *testing.T, path string, truncate bool) ([][]string, AOFReplay, error) {
+	t.Helper()
+	var applied [][]string
+	result, err := ReplayAOF(path, truncate, func(args []string) error {
+		applied = append(applied, args)
+		return nil
+	})
+	return applied, result, err
+}
+
+func TestAOF_AppendAndReplay(t *testing.T) {
+	for _, policy := range []FsyncPolicy{FsyncAlways, FsyncEverySec, FsyncNo} {
+		t.Run(string(policy), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "appendonly.aof")
+			aof, err := OpenAOF(path, policy)
+			if err != nil {
+				t.Fatalf("OpenAOF() error: %v", err)
+			}
+			if err := aof.Append([]string{"SET", "k", "line\r\nbreak"}); err != nil {
+				t.Fatalf("Append() error: %v", err)
+			}
+			if err := aof.Append([]string{"MULTI"}, []string{"RPUSH", "l", "a"}, []string{"EXEC"}); err != nil {
+				t.Fatalf("Append() error: %v", err)
+			}
+			if err := aof.Close(); err != nil {
+				t.Fatalf("Close() error: %v", err)
+			}
+
+			applied, result, err := replayAll(t, path, false)
+			if err != nil {
+				t.Fatalf("ReplayAOF() error: %v", err)
+			}
+			want := [][]string{{"SET", "k", "line\r\nbreak"}, {"RPUSH", "l", "a"}}
+			if !reflect.DeepEqual(applied, want) || result.Commands != 2 {
+				t.Errorf("replayed %v (%d commands), want %v", applied, result.Commands, want)
+			}
+		})
+	}
+}
+
+func TestAOF_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	for _, key := range []string{"a", "b"} {
+		aof, err := OpenAOF(path, FsyncNo)
+		if err != nil {
+			t.Fatalf("OpenAOF() error: %v", err)
+		}
+		_ = aof.Append([]string{"DEL", key})
+		_ = aof.Close()
+	}
+
+	applied, _, err := replayAll(t, path, false)
+	if err != nil || !reflect.DeepEqual(applied, [][]string{{"DEL", "a"}, {"DEL", "b"}}) {
+		t.Errorf("ReplayAOF() = %v, %v", applied, err)
+	}
+}
+
+// TestAOF_RetryAfterFailedWrite checks commands a failed write couldn't log
+// are written once the file can be written again.
+func TestAOF_RetryAfterFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, err := OpenAOF(path, FsyncAlways)
+	if err != nil {
+		t.Fatalf("OpenAOF() error: %v", err)
+	}
+	_ = aof.Append([]string{"DEL", "a"})
+
+	// A read-only handle fails every write
+	file := aof.file
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	aof.file = readOnly
+	if err := aof.Append([]string{"DEL", "b"}); err == nil {
+		t.Fatal("Append() to a failing file succeeded")
+	}
+	if err := aof.Retry(); err == nil {
+		t.Fatal("Retry() to a failing file succeeded")
+	}
+
+	aof.file = file
+	if err := aof.Retry(); err != nil {
+		t.Fatalf("Retry() error: %v", err)
+	}
+	_ = aof.Append([]string{"DEL", "c"})
+	if err := aof.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	applied, _, err := replayAll(t, path, false)
+	if want := [][]string{{"DEL", "a"}, {"DEL", "b"}, {"DEL", "c"}}; err != nil || !reflect.DeepEqual(applied, want) {
+		t.Errorf("ReplayAOF() = %v, %v, want %v", applied, err, want)
+	}
+}
+
+func TestReplayAOF_MissingFile(t *testing.T) {
+	applied, result, err := replayAll(t, filepath.Join(t.TempDir(), "none.aof"), false)
+	if err != nil || len(applied) != 0 || result.Commands != 0 {
+		t.Errorf("ReplayAOF() of a missing file = %v, %+v, %v; want nothing", applied, result, err)
+	}
+}
+
+func TestReplayAOF_Truncated(t *testing.T) {
+	complete := "*2\r\n$3\r\nDEL\r\n$1\r\na\r\n"
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"partial command", "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nva"},
+		{"partial length", "*2\r\n$3"},
+		{"transaction without EXEC", "*1\r\n$5\r\nMULTI\r\n*2\r\n$3\r\nDEL\r\n$1\r\nb\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "appendonly.aof")
+			if err := os.WriteFile(path, []byte(complete+tt.tail), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			applied, result, err := replayAll(t, path, false)
+			if !errors.Is(err, ErrAOFTruncated) {
+				t.Fatalf("ReplayAOF() without truncate error = %v, want ErrAOFTruncated", err)
+			}
+			if len(applied) != 1 || result.TruncatedBytes != int64(len(tt.tail)) {
+				t.Errorf("replayed %v with %d truncated bytes, want 1 command and %d", applied, result.TruncatedBytes, len(tt.tail))
+			}
+
+			applied, _, err = replayAll(t, path, true)
+			if err != nil || !reflect.DeepEqual(applied, [][]string{{"DEL", "a"}}) {
+				t.Errorf("ReplayAOF() with truncate = %v, %v", applied, err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != complete {
+				t.Errorf("file after truncating = %q, want %q", data, complete)
+			}
+		})
+	}
+}
+
+func TestReplayAOF_Corrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unknown type", "?garbage\r\n"},
+		{"not a command", ":1\r\n"},
+		{"EXEC without MULTI", "*1\r\n$4\r\nEXEC\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "appendonly.aof")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// Corruption isn't mistaken for a truncated tail, even when truncating
+			if _, _, err := replayAll(t, path, true); err == nil || errors.Is(err, ErrAOFTruncated) {
+				t.Errorf("ReplayAOF() error = %v, want a format error", err)
+			}
+		})
+	}
+}
+
+func TestReplayAOF_ApplyError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, _ := OpenAOF(path, FsyncNo)
+	_ = aof.Append([]string{"NOSUCH"})
+	_ = aof.Close()
+
+	failure := errors.New("unknown command")
+	_, err := ReplayAOF(path, false, func([]string) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("ReplayAOF() error = %v, want %v", err, failure)
+	}
+}
@@ -0,0 +1,221 @@
+// Package persistence saves snapshots a batch of keys at a time, so saving
+// doesn't need a copy of the whole dataset in memory.
+package persistence
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// saveBatchKeys is how many keys of a store a save copies and writes at a
+// time.
+const saveBatchKeys = 1024
+
+// gobBatchMagic starts a gob snapshot saved a batch of keys at a time. Older
+// snapshots are a single gob-encoded Snapshot, which can't start with it.
+const gobBatchMagic = "MINIREDIS-GOB2\n"
+
+// gobBatch is a batch of keys in a gob snapshot. The file ends with a batch
+// marked last, so a truncated file isn't mistaken for a smaller dataset.
+type gobBatch struct {
+	Keys Snapshot
+	Last bool
+}
+
+// snapshotReader reads the stores for a save, a batch of keys at a time.
+type snapshotReader struct {
+	cursors []store.SnapshotCursor
+}
+
+// beginSnapshot starts reading the stores as they are now. Stores that can't
+// be read a batch at a time are exported whole now instead.
+// See store.StreamingSnapshottable for what a snapshot holds when the stores
+// are written while it is read.
+func (m *Manager) beginSnapshot() *snapshotReader {
+	r := &snapshotReader{}
+	for _, s := range []store.Snapshottable{m.stores.Strings, m.stores.Lists, m.stores.Hashes, m.stores.Sets, m.stores.ZSets, m.stores.Streams} {
+		if s == nil {
+			continue
+		}
+		if streaming := store.AsStreamingSnapshottable(s); streaming != nil {
+			r.cursors = append(r.cursors, streaming.BeginSnapshot())
+		} else {
+			r.cursors = append(r.cursors, &exportedCursor{data: s.ExportData()})
+		}
+	}
+	return r
+}
+
+// len returns how many keys the stores held at the start, counting keys that
+// had expired but weren't deleted yet.
+func (r *snapshotReader) len() int {
+	n := 0
+	for _, c := range r.cursors {
+		n += c.Len()
+	}
+	return n
+}
+
+// next returns the next batch of keys, all from one store. It returns false
+// once every store has been read.
+func (r *snapshotReader) next() (*Snapshot, bool) {
+	for len(r.cursors) > 0 {
+		data, ok := r.cursors[0].Next(saveBatchKeys)
+		if !ok {
+			r.cursors[0].Close()
+			r.cursors = r.cursors[1:]
+			continue
+		}
+		batch := &Snapshot{}
+		batch.add(data)
+		return batch, true
+	}
+	return nil, false
+}
+
+// close ends the snapshot of the stores not read to the end.
+func (r *snapshotReader) close() {
+	for _, c := range r.cursors {
+		c.Close()
+	}
+	r.cursors = nil
+}
+
+// exportedCursor returns a store exported whole as a single batch.
+type exportedCursor struct {
+	data interface{}
+}
+
+// Len implements store.SnapshotCursor. It returns 0, as the number of keys
+// isn't known.
+func (c *exportedCursor) Len() int {
+	return 0
+}
+
+// Next implements store.SnapshotCursor.
+func (c *exportedCursor) Next(int) (interface{}, bool) {
+	data := c.data
+	c.data = nil
+	return data, data != nil
+}
+
+// Close implements store.SnapshotCursor.
+func (c *exportedCursor) Close() {
+	c.data = nil
+}
+
+// add sets the field of the snapshot data has the type of.
+func (s *Snapshot) add(data interface{}) {
+	switch data := data.(type) {
+	case store.StringSnapshot:
+		s.Strings = data
+	case store.ListSnapshot:
+		s.Lists = data
+	case store.HashSnapshot:
+		s.Hashes = data
+	case store.SetSnapshot:
+		s.Sets = data
+	case store.ZSetSnapshot:
+		s.ZSets = data
+	case store.StreamSnapshot:
+		s.Streams = data
+	}
+}
+
+// merge adds the keys of batch to the snapshot.
+func (s *Snapshot) merge(batch *Snapshot) {
+	mergeKeys(&s.Strings.Data, batch.Strings.Data)
+	mergeKeys(&s.Lists.Data, batch.Lists.Data)
+	mergeKeys(&s.Lists.Expires, batch.Lists.Expires)
+	mergeKeys(&s.Hashes.Data, batch.Hashes.Data)
+	mergeKeys(&s.Hashes.Expires, batch.Hashes.Expires)
+	mergeKeys(&s.Sets.Data, batch.Sets.Data)
+	mergeKeys(&s.Sets.Expires, batch.Sets.Expires)
+	mergeKeys(&s.ZSets.Data, batch.ZSets.Data)
+	mergeKeys(&s.ZSets.Expires, batch.ZSets.Expires)
+	mergeKeys(&s.Streams.Data, batch.Streams.Data)
+	mergeKeys(&s.Streams.Expires, batch.Streams.Expires)
+}
+
+// mergeKeys copies the keys of src into *dst, creating it if needed.
+func mergeKeys[V any](dst *map[string]V, src map[string]V) {
+	if len(src) == 0 {
+		return
+	}
+	if *dst == nil {
+		*dst = make(map[string]V, len(src))
+	}
+	maps.Copy(*dst, src)
+}
+
+// snapshotEncoder writes a snapshot file a batch of keys at a time.
+type snapshotEncoder interface {
+	encode(batch *Snapshot) error
+	// close ends the file. It doesn't close the underlying writer.
+	close() error
+}
+
+// newSnapshotEncoder starts a snapshot file in format, for a snapshot of
+// about keys keys.
+func newSnapshotEncoder(w io.Writer, format Format, keys int) snapshotEncoder {
+	if format == FormatRDB {
+		return newRDBEncoder(w, keys, 0)
+	}
+	return newGobEncoder(w)
+}
+
+// gobEncoder writes a gob snapshot a batch of keys at a time.
+type gobEncoder struct {
+	w   *bufio.Writer
+	enc *gob.Encoder
+	err error
+}
+
+func newGobEncoder(w io.Writer) *gobEncoder {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString(gobBatchMagic)
+	return &gobEncoder{w: bw, enc: gob.NewEncoder(bw), err: err}
+}
+
+func (e *gobEncoder) encode(batch *Snapshot) error {
+	if e.err == nil {
+		e.err = e.enc.Encode(&gobBatch{Keys: *batch})
+	}
+	return e.err
+}
+
+func (e *gobEncoder) close() error {
+	if e.err == nil {
+		e.err = e.enc.Encode(&gobBatch{Last: true})
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// decodeGobBatches reads a gob snapshot saved a batch of keys at a time,
+// after its magic string.
+func decodeGobBatches(r io.Reader) (*Snapshot, error) {
+	dec := gob.NewDecoder(r)
+	snapshot := &Snapshot{}
+	for {
+		var batch gobBatch
+		if err := dec.Decode(&batch); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("snapshot is truncated: %w", io.ErrUnexpectedEOF)
+			}
+			return nil, err
+		}
+		snapshot.merge(&batch.Keys)
+		if batch.Last {
+			return snapshot, nil
+		}
+	}
+}
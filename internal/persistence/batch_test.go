@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// exportOnly hides a store's StreamingSnapshottable methods, so saves export
+// it whole.
+type exportOnly struct {
+	store.Snapshottable
+}
+
+func TestManager_SaveInBatches(t *testing.T) {
+	for _, format := range []Format{FormatGob, FormatRDB} {
+		t.Run(string(format), func(t *testing.T) {
+			stringStore := store.New()
+			defer stringStore.Close()
+			listStore, hashStore := store.NewListStore(), store.NewHashStore()
+			const n = 3*saveBatchKeys + 1
+			for i := range n {
+				stringStore.Set(fmt.Sprintf("key:%d", i), fmt.Sprint(i))
+			}
+			listStore.RPush("list", "a", "b")
+			hashStore.HSet("hash", "f", "v")
+
+			path := filepath.Join(t.TempDir(), "dump")
+			manager := NewManager(path, Stores{
+				Strings: store.AsSnapshottable(stringStore),
+				Lists:   store.AsSnapshottable(listStore),
+				Hashes:  exportOnly{store.AsSnapshottable(hashStore)},
+			})
+			manager.SetFormat(format)
+			if err := manager.Save(); err != nil {
+				t.Fatalf("Save() error: %v", err)
+			}
+
+			loaded := NewManager(path, Stores{
+				Strings: store.AsSnapshottable(store.New()),
+				Lists:   store.AsSnapshottable(store.NewListStore()),
+				Hashes:  store.AsSnapshottable(store.NewHashStore()),
+			})
+			result, err := loaded.Load()
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			want := LoadResult{StringKeys: n, ListKeys: 1, HashKeys: 1}
+			if *result != want {
+				t.Errorf("Load() = %+v, want %+v", *result, want)
+			}
+			if !reflect.DeepEqual(loaded.Snapshot(), manager.Snapshot()) {
+				t.Error("loaded snapshot differs from the saved stores")
+			}
+		})
+	}
+}
+
+// TestManager_BackgroundSaveSnapshotsStart checks a background save holds
+// the data as it was when it started, not when its keys were written.
+func TestManager_BackgroundSaveSnapshotsStart(t *testing.T) {
+	stringStore := store.New()
+	defer stringStore.Close()
+	for i := range 2 * saveBatchKeys {
+		stringStore.Set(fmt.Sprintf("key:%d", i), "old")
+	}
+	want := stringStore.(store.Snapshottable).ExportData()
+
+	path := filepath.Join(t.TempDir(), "dump")
+	manager := NewManager(path, Stores{Strings: store.AsSnapshottable(stringStore)})
+	if err := manager.BackgroundSave(); err != nil {
+		t.Fatalf("BackgroundSave() error: %v", err)
+	}
+	for i := range 2 * saveBatchKeys {
+		key := fmt.Sprintf("key:%d", i)
+		if i%2 == 0 {
+			stringStore.Set(key, "new")
+		} else {
+			stringStore.Delete(key)
+		}
+	}
+	stringStore.Set("created", "new")
+	if err := manager.WaitForSave(); err != nil {
+		t.Fatalf("WaitForSave() error: %v", err)
+	}
+
+	loadedStrings := store.New()
+	defer loadedStrings.Close()
+	if _, err := NewManager(path, Stores{Strings: store.AsSnapshottable(loadedStrings)}).Load(); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if got := loadedStrings.(store.Snapshottable).ExportData(); !reflect.DeepEqual(got, want) {
+		t.Error("background save didn't hold the data as it was when it started")
+	}
+}
+
+func TestDecodeSnapshot_Gob(t *testing.T) {
+	snapshot := emptySnapshot()
+	snapshot.Strings.Data["k"] = store.StringEntry{Value: "v"}
+	snapshot.Lists.Data["l"] = []string{"a"}
+
+	var legacy bytes.Buffer
+	if err := gob.NewEncoder(&legacy).Encode(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	var batched bytes.Buffer
+	enc := newGobEncoder(&batched)
+	_ = enc.encode(&Snapshot{Strings: snapshot.Strings})
+	_ = enc.encode(&Snapshot{Lists: snapshot.Lists})
+	_ = enc.w.Flush()
+	// Without the last batch, as if the file had been cut short
+	truncated := bytes.Clone(batched.Bytes())
+	if err := enc.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"legacy": legacy.Bytes(), "batched": batched.Bytes()} {
+		got, err := decodeSnapshot(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Errorf("decodeSnapshot(%s) error: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Strings.Data, snapshot.Strings.Data) || !reflect.DeepEqual(got.Lists.Data, snapshot.Lists.Data) {
+			t.Errorf("decodeSnapshot(%s) = %+v, want %+v", name, got, snapshot)
+		}
+	}
+	if _, err := decodeSnapshot(bufio.NewReader(bytes.NewReader(truncated))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("decodeSnapshot(truncated) error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
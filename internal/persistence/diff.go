@@ -0,0 +1,392 @@
+// Package persistence compares snapshots key by key, reporting what was
+// added, removed or modified between them.
+package persistence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// ChangeOp is how a key, or a part of it, differs between two snapshots.
+type ChangeOp string
+
+// Change operations.
+const (
+	ChangeAdded    ChangeOp = "added"
+	ChangeRemoved  ChangeOp = "removed"
+	ChangeModified ChangeOp = "modified"
+)
+
+// Parts of a key a change can be about. A change to the whole key, its
+// addition or removal, has no part.
+const (
+	PartType    = "type"
+	PartTTL     = "ttl"
+	PartValue   = "value"   // A string's value
+	PartElement = "element" // A list element, named by its index
+	PartField   = "field"   // A hash field
+	PartMember  = "member"  // A set member, or a sorted set member and its score
+	PartEntry   = "entry"   // A stream entry, named by its ID
+	PartGroup   = "group"   // A stream consumer group and its last delivered ID
+)
+
+// Change is one difference between two snapshots. Old and New hold the
+// part's values before and after; a TTL is an RFC 3339 time, or empty if the
+// key doesn't expire.
+type Change struct {
+	Op   ChangeOp `json:"op"`
+	Key  string   `json:"key"`
+	Type string   `json:"type"`
+	Part string   `json:"part,omitempty"`
+	Name string   `json:"name,omitempty"`
+	Old  string   `json:"old,omitempty"`
+	New  string   `json:"new,omitempty"`
+}
+
+// String formats the change for people, one line per change:
+// "+" or "-" for added and removed keys and "~" for modified ones.
+func (c Change) String() string {
+	key := strconv.Quote(c.Key)
+	if c.Part == "" {
+		sign := "+"
+		if c.Op == ChangeRemoved {
+			sign = "-"
+		}
+		return fmt.Sprintf("%s %s (%s)", sign, key, c.Type)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "~ %s (%s) %s", key, c.Type, c.Part)
+	if c.Name != "" {
+		name := c.Name
+		if c.Part == PartField || c.Part == PartMember || c.Part == PartGroup {
+			name = strconv.Quote(name)
+		}
+		b.WriteString(" " + name)
+	}
+	before, after := c.Old, c.New
+	switch c.Part {
+	case PartValue, PartElement, PartField:
+		before, after = strconv.Quote(before), strconv.Quote(after)
+	case PartTTL:
+		before, after = orNone(before), orNone(after)
+	}
+	switch {
+	case c.Op == ChangeAdded && c.New != "":
+		b.WriteString(" added: " + after)
+	case c.Op == ChangeAdded:
+		b.WriteString(" added")
+	case c.Op == ChangeRemoved && c.Old != "":
+		b.WriteString(" removed: " + before)
+	case c.Op == ChangeRemoved:
+		b.WriteString(" removed")
+	default:
+		b.WriteString(": " + before + " -> " + after)
+	}
+	return b.String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// ReadSnapshot loads the snapshot file at path into empty stores and returns
+// their data, without touching any store in use. Keys that have expired are
+// left out, as when the file is loaded by the server. The stores are closed
+// before it returns, so their active expiry doesn't keep the data alive.
+func ReadSnapshot(path string) (*Snapshot, error) {
+	ks := store.NewKeyspace(store.New(), store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore())
+	defer ks.Close()
+	m := NewManager(path, Stores{
+		Strings: store.AsSnapshottable(ks.Strings()),
+		Lists:   store.AsSnapshottable(ks.Lists()),
+		Hashes:  store.AsSnapshottable(ks.Hashes()),
+		Sets:    store.AsSnapshottable(ks.Sets()),
+		ZSets:   store.AsSnapshottable(ks.ZSets()),
+		Streams: store.AsSnapshottable(ks.Streams()),
+	})
+	if _, err := m.Load(); err != nil {
+		return nil, err
+	}
+	return m.Snapshot(), nil
+}
+
+// snapshotKey is a key's type and expiry in a snapshot.
+type snapshotKey struct {
+	typ      string
+	expireMs int64 // 0 if the key doesn't expire
+}
+
+// keys indexes every key in the snapshot.
+func (s *Snapshot) keys() map[string]snapshotKey {
+	keys := make(map[string]snapshotKey)
+	for key, e := range s.Strings.Data {
+		expireMs := e.ExpiresAtMs
+		if expireMs == 0 {
+			expireMs = e.ExpiresAt * 1000
+		}
+		keys[key] = snapshotKey{store.TypeString, expireMs}
+	}
+	for key := range s.Lists.Data {
+		keys[key] = snapshotKey{store.TypeList, s.Lists.Expires[key]}
+	}
+	for key := range s.Hashes.Data {
+		keys[key] = snapshotKey{store.TypeHash, s.Hashes.Expires[key]}
+	}
+	for key := range s.Sets.Data {
+		keys[key] = snapshotKey{store.TypeSet, s.Sets.Expires[key]}
+	}
+	for key := range s.ZSets.Data {
+		keys[key] = snapshotKey{store.TypeZSet, s.ZSets.Expires[key]}
+	}
+	for key := range s.Streams.Data {
+		keys[key] = snapshotKey{store.TypeStream, s.Streams.Expires[key]}
+	}
+	return keys
+}
+
+// Diff returns the changes that turn snapshot a into snapshot b, sorted by
+// key. A key whose type changed is reported as a type change only.
+func Diff(a, b *Snapshot) []Change {
+	aKeys, bKeys := a.keys(), b.keys()
+	all := make([]string, 0, len(aKeys)+len(bKeys))
+	for key := range aKeys {
+		all = append(all, key)
+	}
+	for key := range bKeys {
+		if _, ok := aKeys[key]; !ok {
+			all = append(all, key)
+		}
+	}
+	sort.Strings(all)
+
+	var changes []Change
+	for _, key := range all {
+		before, inA := aKeys[key]
+		after, inB := bKeys[key]
+		switch {
+		case !inB:
+			changes = append(changes, Change{Op: ChangeRemoved, Key: key, Type: before.typ})
+		case !inA:
+			changes = append(changes, Change{Op: ChangeAdded, Key: key, Type: after.typ})
+		case before.typ != after.typ:
+			changes = append(changes, Change{Op: ChangeModified, Key: key, Type: after.typ, Part: PartType, Old: before.typ, New: after.typ})
+		default:
+			d := differ{key: key, typ: after.typ}
+			d.diffValue(a, b)
+			d.diffTTL(before.expireMs, after.expireMs)
+			changes = append(changes, d.changes...)
+		}
+	}
+	return changes
+}
+
+// differ collects the changes to one key whose type is the same in both
+// snapshots.
+type differ struct {
+	key, typ string
+	changes  []Change
+}
+
+func (d *differ) add(op ChangeOp, part, name, before, after string) {
+	d.changes = append(d.changes, Change{Op: op, Key: d.key, Type: d.typ, Part: part, Name: name, Old: before, New: after})
+}
+
+func (d *differ) diffValue(a, b *Snapshot) {
+	key := d.key
+	switch d.typ {
+	case store.TypeString:
+		if before, after := a.Strings.Data[key].Value, b.Strings.Data[key].Value; before != after {
+			d.add(ChangeModified, PartValue, "", before, after)
+		}
+	case store.TypeList:
+		d.diffList(a.Lists.Data[key], b.Lists.Data[key])
+	case store.TypeHash:
+		d.diffMaps(PartField, a.Hashes.Data[key], b.Hashes.Data[key])
+	case store.TypeSet:
+		d.diffMaps(PartMember, setMap(a.Sets.Data[key]), setMap(b.Sets.Data[key]))
+	case store.TypeZSet:
+		d.diffMaps(PartMember, zsetMap(a.ZSets.Data[key]), zsetMap(b.ZSets.Data[key]))
+	case store.TypeStream:
+		d.diffStream(a.Streams.Data[key], b.Streams.Data[key])
+	}
+}
+
+// maxListDiffCells bounds the table used to align two lists, in elements
+// of one times elements of the other. Longer lists are compared by index.
+const maxListDiffCells = 1 << 20
+
+// diffList reports the elements removed from a, by their index in a, and
+// added in b, by their index in b, as in a unified diff. An element replaced
+// in place is reported as modified.
+func (d *differ) diffList(a, b []string) {
+	// Pushes and pops leave a common prefix or suffix, which needn't be aligned
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var removed, added []int
+	flush := func() {
+		inPlace := len(removed) == len(added) && len(removed) > 0 && removed[0] == added[0]
+		for k, i := range removed {
+			if inPlace {
+				if a[i] != b[added[k]] {
+					d.add(ChangeModified, PartElement, strconv.Itoa(prefix+i), a[i], b[added[k]])
+				}
+				continue
+			}
+			d.add(ChangeRemoved, PartElement, strconv.Itoa(prefix+i), a[i], "")
+		}
+		for _, j := range added {
+			if !inPlace {
+				d.add(ChangeAdded, PartElement, strconv.Itoa(prefix+j), "", b[j])
+			}
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	if len(a)*len(b) > maxListDiffCells {
+		for i := range a {
+			removed = append(removed, i)
+		}
+		for j := range b {
+			added = append(added, j)
+		}
+		flush()
+		return
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+}
+
+// diffMaps reports the names added, removed or given a new value, sorted.
+func (d *differ) diffMaps(part string, a, b map[string]string) {
+	for _, name := range sortedNames(a, b) {
+		before, inA := a[name]
+		after, inB := b[name]
+		switch {
+		case !inB:
+			d.add(ChangeRemoved, part, name, before, "")
+		case !inA:
+			d.add(ChangeAdded, part, name, "", after)
+		case before != after:
+			d.add(ChangeModified, part, name, before, after)
+		}
+	}
+}
+
+// diffStream reports entries added and removed, by ID, and consumer groups
+// added, removed or with a new last delivered ID.
+func (d *differ) diffStream(a, b store.StreamData) {
+	d.diffMaps(PartEntry, streamEntryMap(a.Entries), streamEntryMap(b.Entries))
+
+	groups := func(data store.StreamData) map[string]string {
+		m := make(map[string]string, len(data.Groups))
+		for _, g := range data.Groups {
+			m[g.Name] = g.LastID.String()
+		}
+		return m
+	}
+	d.diffMaps(PartGroup, groups(a), groups(b))
+}
+
+func (d *differ) diffTTL(a, b int64) {
+	if a == b {
+		return
+	}
+	switch {
+	case a == 0:
+		d.add(ChangeAdded, PartTTL, "", "", formatExpiry(b))
+	case b == 0:
+		d.add(ChangeRemoved, PartTTL, "", formatExpiry(a), "")
+	default:
+		d.add(ChangeModified, PartTTL, "", formatExpiry(a), formatExpiry(b))
+	}
+}
+
+func formatExpiry(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func setMap(members []string) map[string]string {
+	m := make(map[string]string, len(members))
+	for _, member := range members {
+		m[member] = ""
+	}
+	return m
+}
+
+func zsetMap(members []store.ZMember) map[string]string {
+	m := make(map[string]string, len(members))
+	for _, member := range members {
+		m[member.Member] = strconv.FormatFloat(member.Score, 'g', -1, 64)
+	}
+	return m
+}
+
+// streamEntryMap maps entry IDs to their fields, formatted as in XRANGE.
+func streamEntryMap(entries []store.StreamEntry) map[string]string {
+	m := make(map[string]string, len(entries))
+	for _, e := range entries {
+		m[e.ID.String()] = fmt.Sprint(e.Fields)
+	}
+	return m
+}
+
+func sortedNames(a, b map[string]string) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// emptySnapshot returns a snapshot with every map allocated.
+func emptySnapshot() *Snapshot {
+	return &Snapshot{
+		Strings: store.StringSnapshot{Data: map[string]store.StringEntry{}},
+		Lists:   store.ListSnapshot{Data: map[string][]string{}, Expires: map[string]int64{}},
+		Hashes:  store.HashSnapshot{Data: map[string]map[string]string{}, Expires: map[string]int64{}},
+		Sets:    store.SetSnapshot{Data: map[string][]string{}, Expires: map[string]int64{}},
+		ZSets:   store.ZSetSnapshot{Data: map[string][]store.ZMember{}, Expires: map[string]int64{}},
+		Streams: store.StreamSnapshot{Data: map[string]store.StreamData{}, Expires: map[string]int64{}},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, b := emptySnapshot(), emptySnapshot()
+	a.Strings.Data["same"] = store.StringEntry{Value: "v"}
+	b.Strings.Data["same"] = store.StringEntry{Value: "v"}
+	a.Strings.Data["gone"] = store.StringEntry{Value: "v"}
+	b.Sets.Data["new"] = []string{"m"}
+	a.Strings.Data["retyped"] = store.StringEntry{Value: "v"}
+	b.Lists.Data["retyped"] = []string{"v"}
+
+	a.Strings.Data["str"] = store.StringEntry{Value: "old", ExpiresAt: 1}
+	b.Strings.Data["str"] = store.StringEntry{Value: "new", ExpiresAtMs: 2500}
+
+	a.Lists.Data["list"] = []string{"a", "b", "c", "d"}
+	b.Lists.Data["list"] = []string{"x", "a", "B", "d", "e"}
+	a.Lists.Expires["list"] = 1000
+
+	a.Hashes.Data["hash"] = map[string]string{"kept": "1", "changed": "1", "dropped": "1"}
+	b.Hashes.Data["hash"] = map[string]string{"kept": "1", "changed": "2", "added": "1"}
+
+	a.Sets.Data["set"] = []string{"a", "b"}
+	b.Sets.Data["set"] = []string{"b", "c"}
+	b.Sets.Expires["set"] = 1000
+
+	a.ZSets.Data["zset"] = []store.ZMember{{Member: "a", Score: 1}, {Member: "b", Score: 2}}
+	b.ZSets.Data["zset"] = []store.ZMember{{Member: "a", Score: 1.5}, {Member: "b", Score: 2}}
+
+	a.Streams.Data["stream"] = store.StreamData{
+		Entries: []store.StreamEntry{{ID: store.StreamID{Ms: 1}, Fields: []string{"f", "v"}}},
+		Groups:  []store.StreamGroupData{{Name: "g"}},
+	}
+	b.Streams.Data["stream"] = store.StreamData{
+		Entries: []store.StreamEntry{{ID: store.StreamID{Ms: 1}, Fields: []string{"f", "v"}}, {ID: store.StreamID{Ms: 2}, Fields: []string{"f", "w"}}},
+		Groups:  []store.StreamGroupData{{Name: "g", LastID: store.StreamID{Ms: 1}}},
+	}
+
+	c := func(op ChangeOp, key, typ, part, name, old, new string) Change {
+		return Change{Op: op, Key: key, Type: typ, Part: part, Name: name, Old: old, New: new}
+	}
+	want := []Change{
+		c(ChangeRemoved, "gone", "string", "", "", "", ""),
+		c(ChangeAdded, "hash", "hash", "field", "added", "", "1"),
+		c(ChangeModified, "hash", "hash", "field", "changed", "1", "2"),
+		c(ChangeRemoved, "hash", "hash", "field", "dropped", "1", ""),
+		c(ChangeAdded, "list", "list", "element", "0", "", "x"),
+		c(ChangeRemoved, "list", "list", "element", "1", "b", ""),
+		c(ChangeRemoved, "list", "list", "element", "2", "c", ""),
+		c(ChangeAdded, "list", "list", "element", "2", "", "B"),
+		c(ChangeAdded, "list", "list", "element", "4", "", "e"),
+		c(ChangeRemoved, "list", "list", "ttl", "", "1970-01-01T00:00:01.000Z", ""),
+		c(ChangeAdded, "new", "set", "", "", "", ""),
+		c(ChangeModified, "retyped", "list", "type", "", "string", "list"),
+		c(ChangeRemoved, "set", "set", "member", "a", "", ""),
+		c(ChangeAdded, "set", "set", "member", "c", "", ""),
+		c(ChangeAdded, "set", "set", "ttl", "", "", "1970-01-01T00:00:01.000Z"),
+		c(ChangeModified, "str", "string", "value", "", "old", "new"),
+		c(ChangeModified, "str", "string", "ttl", "", "1970-01-01T00:00:01.000Z", "1970-01-01T00:00:02.500Z"),
+		c(ChangeAdded, "stream", "stream", "entry", "2-0", "", "[f w]"),
+		c(ChangeModified, "stream", "stream", "group", "g", "0-0", "1-0"),
+		c(ChangeModified, "zset", "zset", "member", "a", "1", "1.5"),
+	}
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() =\n%v\nwant\n%v", got, want)
+	}
+	if got := Diff(b, b); len(got) != 0 {
+		t.Errorf("Diff() of a snapshot with itself = %v, want none", got)
+	}
+}
+
+func TestDiffList(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []string
+	}{
+		{[]string{"a", "b"}, []string{"z", "a", "b"}, []string{"~ \"l\" (list) element 0 added: \"z\""}},
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, []string{"~ \"l\" (list) element 1 removed: \"b\""}},
+		{[]string{"a", "b", "c"}, []string{"a", "B", "c"}, []string{"~ \"l\" (list) element 1: \"b\" -> \"B\""}},
+	}
+	for _, tt := range tests {
+		a, b := emptySnapshot(), emptySnapshot()
+		a.Lists.Data["l"], b.Lists.Data["l"] = tt.a, tt.b
+		var got []string
+		for _, change := range Diff(a, b) {
+			got = append(got, change.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Diff(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	tests := []struct {
+		change Change
+		want   string
+	}{
+		{Change{Op: ChangeAdded, Key: "k", Type: "string"}, `+ "k" (string)`},
+		{Change{Op: ChangeRemoved, Key: "k", Type: "list"}, `- "k" (list)`},
+		{Change{Op: ChangeModified, Key: "k", Type: "list", Part: PartType, Old: "string", New: "list"}, `~ "k" (list) type: string -> list`},
+		{Change{Op: ChangeAdded, Key: "k", Type: "hash", Part: PartField, Name: "f", New: "v"}, `~ "k" (hash) field "f" added: "v"`},
+		{Change{Op: ChangeRemoved, Key: "k", Type: "set", Part: PartMember, Name: "m"}, `~ "k" (set) member "m" removed`},
+		{Change{Op: ChangeAdded, Key: "k", Type: "string", Part: PartTTL, New: "2030-01-01T00:00:00.000Z"}, `~ "k" (string) ttl added: 2030-01-01T00:00:00.000Z`},
+		{Change{Op: ChangeModified, Key: "k", Type: "string", Part: PartValue, Old: "a\n", New: "b"}, `~ "k" (string) value: "a\n" -> "b"`},
+	}
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("String() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	st := store.New()
+	st.Set("k", "v")
+	st.SetWithTTL("soon", "v", time.Millisecond)
+	manager := NewManager(path, Stores{Strings: store.AsSnapshottable(st)})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	snapshot, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error: %v", err)
+	}
+	if want := map[string]store.StringEntry{"k": {Value: "v"}}; !reflect.DeepEqual(snapshot.Strings.Data, want) {
+		t.Errorf("strings = %v, want %v without the expired key", snapshot.Strings.Data, want)
+	}
+
+	if _, err := ReadSnapshot(filepath.Join(t.TempDir(), "none.rdb")); err != ErrNoSnapshot {
+		t.Errorf("ReadSnapshot() of a missing file error = %v, want ErrNoSnapshot", err)
+	}
+}
+
+// TestReadSnapshotReleasesStores checks reading a snapshot with volatile keys
+// doesn't leave active expiry running in the stores it loads into.
+func TestReadSnapshotReleasesStores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	strs, lists := store.New(), store.NewListStore()
+	strs.SetWithTTL("s", "v", time.Hour)
+	lists.RPush("l", "a")
+	lists.Expire("l", time.Now().Add(time.Hour))
+	manager := NewManager(path, Stores{Strings: store.AsSnapshottable(strs), Lists: store.AsSnapshottable(lists)})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	strs.Close()
+	lists.Close()
+
+	before := runtime.NumGoroutine()
+	for range 20 {
+		if _, err := ReadSnapshot(path); err != nil {
+			t.Fatalf("ReadSnapshot() error: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after 20 reads, want at most %d", after, before)
+	}
+}
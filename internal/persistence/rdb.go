@@ -0,0 +1,784 @@
+// Package persistence implements the Redis RDB file format, so snapshots can
+// be exchanged with Redis and its tools.
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// Format is the file format snapshots are saved in.
+type Format string
+
+const (
+	// FormatGob is mini-redis's own format, gob-encoded batches of keys. It
+	// holds every type, streams included.
+	FormatGob Format = "gob"
+	// FormatRDB is the Redis RDB format, which Redis and its tools can read.
+	// Streams can't be saved in it yet.
+	FormatRDB Format = "rdb"
+)
+
+// ErrRDBUnsupported is returned for RDB content mini-redis can't represent,
+// such as streams, modules or keys in databases other than 0.
+var ErrRDBUnsupported = errors.New("unsupported RDB content")
+
+const (
+	rdbMagic = "REDIS"
+	// rdbVersion is the version written, the one of Redis 5 and 6, which
+	// every later Redis and redis-rdb-tools read. Files up to
+	// rdbMaxVersion, written by Redis 7.4, can be read.
+	rdbVersion    = 9
+	rdbMaxVersion = 12
+)
+
+// Opcodes and value types, as in Redis's rdb.h.
+const (
+	rdbOpFunction2    = 0xF5
+	rdbOpFunction     = 0xF6
+	rdbOpModuleAux    = 0xF7
+	rdbOpIdle         = 0xF8
+	rdbOpFreq         = 0xF9
+	rdbOpAux          = 0xFA
+	rdbOpResizeDB     = 0xFB
+	rdbOpExpireTimeMs = 0xFC
+	rdbOpExpireTime   = 0xFD
+	rdbOpSelectDB     = 0xFE
+	rdbOpEOF          = 0xFF
+
+	rdbTypeString         = 0
+	rdbTypeList           = 1
+	rdbTypeSet            = 2
+	rdbTypeZSet           = 3
+	rdbTypeHash           = 4
+	rdbTypeZSet2          = 5
+	rdbTypeListZiplist    = 10
+	rdbTypeSetIntset      = 11
+	rdbTypeZSetZiplist    = 12
+	rdbTypeHashZiplist    = 13
+	rdbTypeListQuicklist  = 14
+	rdbTypeHashListpack   = 16
+	rdbTypeZSetListpack   = 17
+	rdbTypeListQuicklist2 = 18
+	rdbTypeSetListpack    = 20
+)
+
+// Length encodings: the top two bits of the first byte say how the length
+// is stored, or that a string is stored specially.
+const (
+	rdbLen6     = 0
+	rdbLen14    = 1
+	rdbLen32    = 0x80
+	rdbLen64    = 0x81
+	rdbEncValue = 3
+
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+)
+
+// Quicklist node containers, in RDB_TYPE_LIST_QUICKLIST_2.
+const (
+	quicklistPlain  = 1
+	quicklistPacked = 2
+)
+
+// crcTable is the Jones CRC-64 Redis checksums files with, reflected as
+// hash/crc64 expects.
+var crcTable = crc64.MakeTable(0x95AC9329AC4BC9B5)
+
+// rdbChecksum extends a Redis CRC-64 with p. Unlike hash/crc64's, it
+// neither starts nor ends by inverting the bits.
+func rdbChecksum(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crcTable, p)
+}
+
+// rdbWriter writes an RDB file, keeping its checksum.
+type rdbWriter struct {
+	w   *bufio.Writer
+	crc uint64
+	err error
+}
+
+func (w *rdbWriter) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	w.crc = rdbChecksum(w.crc, p)
+	_, w.err = w.w.Write(p)
+}
+
+func (w *rdbWriter) writeByte(b byte) {
+	w.write([]byte{b})
+}
+
+func (w *rdbWriter) writeLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		w.writeByte(byte(n))
+	case n < 1<<14:
+		w.write([]byte{rdbLen14<<6 | byte(n>>8), byte(n)})
+	case n <= math.MaxUint32:
+		w.writeByte(rdbLen32)
+		w.write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		w.writeByte(rdbLen64)
+		w.write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func (w *rdbWriter) writeString(s string) {
+	w.writeLength(uint64(len(s)))
+	w.write([]byte(s))
+}
+
+// writeKey writes the header of a key: its expiry, type and name.
+func (w *rdbWriter) writeKey(key string, typ byte, expires map[string]int64) {
+	if ms, ok := expires[key]; ok {
+		w.writeByte(rdbOpExpireTimeMs)
+		w.write(binary.LittleEndian.AppendUint64(nil, uint64(ms)))
+	}
+	w.writeByte(typ)
+	w.writeString(key)
+}
+
+// EncodeRDB writes the snapshot to w in the RDB format, as database 0. Keys
+// are written in order, so the same data always gives the same file.
+func EncodeRDB(w io.Writer, snapshot *Snapshot) error {
+	keys := len(snapshot.Strings.Data) + len(snapshot.Lists.Data) + len(snapshot.Hashes.Data) + len(snapshot.Sets.Data) + len(snapshot.ZSets.Data)
+	volatile := len(snapshot.Lists.Expires) + len(snapshot.Hashes.Expires) + len(snapshot.Sets.Expires) + len(snapshot.ZSets.Expires)
+	for _, entry := range snapshot.Strings.Data {
+		if entry.ExpiresAtMs > 0 || entry.ExpiresAt > 0 {
+			volatile++
+		}
+	}
+	enc := newRDBEncoder(w, keys, volatile)
+	if err := enc.encode(snapshot); err != nil {
+		return err
+	}
+	return enc.close()
+}
+
+// rdbEncoder writes an RDB file a batch of keys at a time.
+type rdbEncoder struct {
+	rw *rdbWriter
+}
+
+// newRDBEncoder starts an RDB file. The numbers of keys and of keys with an
+// expiry only size Redis's tables when loading it, so they may be estimates.
+func newRDBEncoder(w io.Writer, keys, volatile int) *rdbEncoder {
+	rw := &rdbWriter{w: bufio.NewWriter(w)}
+	rw.write([]byte(fmt.Sprintf("%s%04d", rdbMagic, rdbVersion)))
+	rw.writeByte(rdbOpAux)
+	rw.writeString("redis-bits")
+	rw.writeString("64")
+	rw.writeByte(rdbOpAux)
+	rw.writeString("ctime")
+	rw.writeString(strconv.FormatInt(time.Now().Unix(), 10))
+	rw.writeByte(rdbOpSelectDB)
+	rw.writeLength(0)
+	rw.writeByte(rdbOpResizeDB)
+	rw.writeLength(uint64(keys))
+	rw.writeLength(uint64(volatile))
+	return &rdbEncoder{rw: rw}
+}
+
+// encode writes a batch of keys, in order within the batch.
+func (e *rdbEncoder) encode(batch *Snapshot) error {
+	if len(batch.Streams.Data) > 0 {
+		return fmt.Errorf("%w: streams can't be saved in the RDB format", ErrRDBUnsupported)
+	}
+	rw := e.rw
+
+	stringData := batch.Strings.Data
+	stringExpires := make(map[string]int64)
+	for key, entry := range stringData {
+		if entry.ExpiresAtMs > 0 {
+			stringExpires[key] = entry.ExpiresAtMs
+		} else if entry.ExpiresAt > 0 {
+			stringExpires[key] = entry.ExpiresAt * 1000
+		}
+	}
+	for _, key := range sortedKeys(stringData) {
+		rw.writeKey(key, rdbTypeString, stringExpires)
+		rw.writeString(stringData[key].Value)
+	}
+	for _, key := range sortedKeys(batch.Lists.Data) {
+		rw.writeKey(key, rdbTypeList, batch.Lists.Expires)
+		list := batch.Lists.Data[key]
+		rw.writeLength(uint64(len(list)))
+		for _, elem := range list {
+			rw.writeString(elem)
+		}
+	}
+	for _, key := range sortedKeys(batch.Sets.Data) {
+		rw.writeKey(key, rdbTypeSet, batch.Sets.Expires)
+		members := batch.Sets.Data[key]
+		rw.writeLength(uint64(len(members)))
+		for _, member := range members {
+			rw.writeString(member)
+		}
+	}
+	for _, key := range sortedKeys(batch.ZSets.Data) {
+		rw.writeKey(key, rdbTypeZSet2, batch.ZSets.Expires)
+		members := batch.ZSets.Data[key]
+		rw.writeLength(uint64(len(members)))
+		for _, m := range members {
+			rw.writeString(m.Member)
+			rw.write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(m.Score)))
+		}
+	}
+	for _, key := range sortedKeys(batch.Hashes.Data) {
+		rw.writeKey(key, rdbTypeHash, batch.Hashes.Expires)
+		hash := batch.Hashes.Data[key]
+		rw.writeLength(uint64(len(hash)))
+		for _, field := range sortedKeys(hash) {
+			rw.writeString(field)
+			rw.writeString(hash[field])
+		}
+	}
+	return rw.err
+}
+
+// close ends the file with the EOF opcode and its checksum.
+func (e *rdbEncoder) close() error {
+	rw := e.rw
+	rw.writeByte(rdbOpEOF)
+	if rw.err != nil {
+		return rw.err
+	}
+	// The checksum itself isn't checksummed
+	if _, err := rw.w.Write(binary.LittleEndian.AppendUint64(nil, rw.crc)); err != nil {
+		return err
+	}
+	return rw.w.Flush()
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isRDB reports whether a file starting with header is in the RDB format.
+func isRDB(header []byte) bool {
+	return len(header) >= len(rdbMagic) && string(header[:len(rdbMagic)]) == rdbMagic
+}
+
+// rdbReadChunk is the largest value read into a buffer allocated up front.
+const rdbReadChunk = 64 * 1024
+
+// rdbReader reads an RDB file, keeping its checksum.
+type rdbReader struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+func (r *rdbReader) read(n int) ([]byte, error) {
+	var p []byte
+	var err error
+	if n <= rdbReadChunk {
+		p = make([]byte, n)
+		_, err = io.ReadFull(r.r, p)
+	} else {
+		// Large values are read as they come, so a corrupt length fails at
+		// the end of the file instead of allocating it all up front
+		var buf bytes.Buffer
+		_, err = io.CopyN(&buf, r.r, int64(n))
+		p = buf.Bytes()
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	r.crc = rdbChecksum(r.crc, p)
+	return p, nil
+}
+
+func (r *rdbReader) readByte() (byte, error) {
+	p, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return p[0], nil
+}
+
+// readLength reads a length, or with encoded set, how a string is encoded.
+func (r *rdbReader) readLength() (n uint64, encoded bool, err error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case rdbLen6:
+		return uint64(b & 0x3F), false, nil
+	case rdbLen14:
+		next, err := r.readByte()
+		return uint64(b&0x3F)<<8 | uint64(next), false, err
+	case rdbEncValue:
+		return uint64(b & 0x3F), true, nil
+	}
+	switch b {
+	case rdbLen32:
+		p, err := r.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(p)), false, nil
+	case rdbLen64:
+		p, err := r.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(p), false, nil
+	}
+	return 0, false, fmt.Errorf("unknown length encoding 0x%02x", b)
+}
+
+// readLen reads a length that can't be a specially encoded string.
+func (r *rdbReader) readLen() (int, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded || n > math.MaxInt32 {
+		return 0, errors.New("invalid length")
+	}
+	return int(n), nil
+}
+
+func (r *rdbReader) readString() (string, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		if n > math.MaxInt32 {
+			return "", errors.New("invalid string length")
+		}
+		p, err := r.read(int(n))
+		return string(p), err
+	}
+
+	switch n {
+	case rdbEncInt8:
+		p, err := r.read(1)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int8(p[0]))), nil
+	case rdbEncInt16:
+		p, err := r.read(2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(p)))), nil
+	case rdbEncInt32:
+		p, err := r.read(4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(p)))), nil
+	case rdbEncLZF:
+		compressed, err := r.readLen()
+		if err != nil {
+			return "", err
+		}
+		size, err := r.readLen()
+		if err != nil {
+			return "", err
+		}
+		p, err := r.read(compressed)
+		if err != nil {
+			return "", err
+		}
+		out, err := lzfDecompress(p, size)
+		return string(out), err
+	}
+	return "", fmt.Errorf("unknown string encoding %d", n)
+}
+
+// readStrings reads a length and that many strings.
+func (r *rdbReader) readStrings(pairs bool) ([]string, error) {
+	n, err := r.readLen()
+	if err != nil {
+		return nil, err
+	}
+	if pairs {
+		n *= 2
+	}
+	values := make([]string, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		s, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+// DecodeRDB reads a snapshot in the RDB format, such as a dump from Redis.
+// Aux fields and LRU/LFU hints are skipped; streams, modules, functions and
+// keys outside database 0 aren't supported.
+func DecodeRDB(r io.Reader) (*Snapshot, error) {
+	rr := &rdbReader{r: bufio.NewReader(r)}
+	header, err := rr.read(len(rdbMagic) + 4)
+	if err != nil || !isRDB(header) {
+		return nil, errors.New("not an RDB file")
+	}
+	version, err := strconv.Atoi(string(header[len(rdbMagic):]))
+	if err != nil || version < 1 || version > rdbMaxVersion {
+		return nil, fmt.Errorf("unsupported RDB version %q", header[len(rdbMagic):])
+	}
+
+	snapshot := &Snapshot{
+		Strings: store.StringSnapshot{Data: make(map[string]store.StringEntry)},
+		Lists:   store.ListSnapshot{Data: make(map[string][]string), Expires: make(map[string]int64)},
+		Hashes:  store.HashSnapshot{Data: make(map[string]map[string]string), Expires: make(map[string]int64)},
+		Sets:    store.SetSnapshot{Data: make(map[string][]string), Expires: make(map[string]int64)},
+		ZSets:   store.ZSetSnapshot{Data: make(map[string][]store.ZMember), Expires: make(map[string]int64)},
+		Streams: store.StreamSnapshot{Data: make(map[string]store.StreamData), Expires: make(map[string]int64)},
+	}
+	db := uint64(0)
+	expiresAt := int64(-1)
+	for {
+		op, err := rr.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case rdbOpAux:
+			if _, err := rr.readString(); err != nil {
+				return nil, err
+			}
+			if _, err := rr.readString(); err != nil {
+				return nil, err
+			}
+		case rdbOpResizeDB:
+			if _, err := rr.readLen(); err != nil {
+				return nil, err
+			}
+			if _, err := rr.readLen(); err != nil {
+				return nil, err
+			}
+		case rdbOpSelectDB:
+			if db, _, err = rr.readLength(); err != nil {
+				return nil, err
+			}
+		case rdbOpExpireTimeMs:
+			p, err := rr.read(8)
+			if err != nil {
+				return nil, err
+			}
+			expiresAt = int64(binary.LittleEndian.Uint64(p))
+		case rdbOpExpireTime:
+			p, err := rr.read(4)
+			if err != nil {
+				return nil, err
+			}
+			expiresAt = int64(binary.LittleEndian.Uint32(p)) * 1000
+		case rdbOpIdle:
+			if _, err := rr.readLen(); err != nil {
+				return nil, err
+			}
+		case rdbOpFreq:
+			if _, err := rr.readByte(); err != nil {
+				return nil, err
+			}
+		case rdbOpModuleAux, rdbOpFunction, rdbOpFunction2:
+			return nil, fmt.Errorf("%w: module data or functions", ErrRDBUnsupported)
+		case rdbOpEOF:
+			return snapshot, rr.verifyChecksum(version)
+		default:
+			key, err := rr.readString()
+			if err != nil {
+				return nil, err
+			}
+			if db != 0 {
+				return nil, fmt.Errorf("%w: key %q is in database %d", ErrRDBUnsupported, key, db)
+			}
+			if err := rr.readValue(snapshot, op, key, expiresAt); err != nil {
+				return nil, fmt.Errorf("failed to read key %q: %w", key, err)
+			}
+			expiresAt = -1
+		}
+	}
+}
+
+// verifyChecksum reads the checksum ending files since version 5 and checks
+// it, unless it is 0, which means Redis was told not to compute it.
+func (r *rdbReader) verifyChecksum(version int) error {
+	if version < 5 {
+		return nil
+	}
+	want := r.crc
+	p, err := r.read(8)
+	if err != nil {
+		return err
+	}
+	if got := binary.LittleEndian.Uint64(p); got != 0 && got != want {
+		return fmt.Errorf("RDB checksum mismatch: file says %016x, data is %016x", got, want)
+	}
+	return nil
+}
+
+// readValue reads the value of key, of type typ, into the snapshot.
+func (r *rdbReader) readValue(snapshot *Snapshot, typ byte, key string, expiresAt int64) error {
+	setExpiry := func(expires map[string]int64) {
+		if expiresAt >= 0 {
+			expires[key] = expiresAt
+		}
+	}
+
+	switch typ {
+	case rdbTypeString:
+		value, err := r.readString()
+		if err != nil {
+			return err
+		}
+		entry := store.StringEntry{Value: value}
+		if expiresAt >= 0 {
+			entry.ExpiresAt, entry.ExpiresAtMs = expiresAt/1000, expiresAt
+		}
+		snapshot.Strings.Data[key] = entry
+		return nil
+
+	case rdbTypeList, rdbTypeListZiplist, rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		list, err := r.readList(typ)
+		if err != nil {
+			return err
+		}
+		snapshot.Lists.Data[key] = list
+		setExpiry(snapshot.Lists.Expires)
+		return nil
+
+	case rdbTypeSet, rdbTypeSetIntset, rdbTypeSetListpack:
+		var members []string
+		var err error
+		switch typ {
+		case rdbTypeSet:
+			members, err = r.readStrings(false)
+		case rdbTypeSetIntset:
+			members, err = r.readEncoded(intsetEntries)
+		default:
+			members, err = r.readEncoded(listpackEntries)
+		}
+		if err != nil {
+			return err
+		}
+		snapshot.Sets.Data[key] = members
+		setExpiry(snapshot.Sets.Expires)
+		return nil
+
+	case rdbTypeHash, rdbTypeHashZiplist, rdbTypeHashListpack:
+		var pairs []string
+		var err error
+		switch typ {
+		case rdbTypeHash:
+			pairs, err = r.readStrings(true)
+		case rdbTypeHashZiplist:
+			pairs, err = r.readEncoded(ziplistEntries)
+		default:
+			pairs, err = r.readEncoded(listpackEntries)
+		}
+		if err != nil {
+			return err
+		}
+		if len(pairs)%2 != 0 {
+			return errors.New("hash has a field without a value")
+		}
+		hash := make(map[string]string, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			hash[pairs[i]] = pairs[i+1]
+		}
+		snapshot.Hashes.Data[key] = hash
+		setExpiry(snapshot.Hashes.Expires)
+		return nil
+
+	case rdbTypeZSet, rdbTypeZSet2, rdbTypeZSetZiplist, rdbTypeZSetListpack:
+		members, err := r.readZSet(typ)
+		if err != nil {
+			return err
+		}
+		snapshot.ZSets.Data[key] = members
+		setExpiry(snapshot.ZSets.Expires)
+		return nil
+	}
+	return fmt.Errorf("%w: value type %d", ErrRDBUnsupported, typ)
+}
+
+// readEncoded reads a string holding a compact encoding, such as a listpack,
+// and returns its entries.
+func (r *rdbReader) readEncoded(entries func([]byte) ([]string, error)) ([]string, error) {
+	blob, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+	return entries([]byte(blob))
+}
+
+func (r *rdbReader) readList(typ byte) ([]string, error) {
+	switch typ {
+	case rdbTypeList:
+		return r.readStrings(false)
+	case rdbTypeListZiplist:
+		return r.readEncoded(ziplistEntries)
+	}
+
+	// Quicklists are a list of nodes, each a ziplist or, since version 2, a
+	// listpack or a single large element
+	nodes, err := r.readLen()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for i := 0; i < nodes; i++ {
+		container := uint64(quicklistPacked)
+		if typ == rdbTypeListQuicklist2 {
+			if container, _, err = r.readLength(); err != nil {
+				return nil, err
+			}
+		}
+		blob, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []string
+		switch {
+		case container == quicklistPlain:
+			entries = []string{blob}
+		case container != quicklistPacked:
+			return nil, fmt.Errorf("unknown quicklist container %d", container)
+		case typ == rdbTypeListQuicklist2:
+			entries, err = listpackEntries([]byte(blob))
+		default:
+			entries, err = ziplistEntries([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entries...)
+	}
+	return list, nil
+}
+
+// readZSet reads a sorted set, returning its members in rank order.
+func (r *rdbReader) readZSet(typ byte) ([]store.ZMember, error) {
+	var members []store.ZMember
+	var err error
+	switch typ {
+	case rdbTypeZSetZiplist:
+		members, err = r.readZSetPairs(ziplistEntries)
+	case rdbTypeZSetListpack:
+		members, err = r.readZSetPairs(listpackEntries)
+	default:
+		members, err = r.readZSetMembers(typ == rdbTypeZSet2)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Redis writes the other sorted set types from the highest score down
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members, nil
+}
+
+// readZSetPairs reads a sorted set stored as a compact encoding of members
+// each followed by its score.
+func (r *rdbReader) readZSetPairs(entries func([]byte) ([]string, error)) ([]store.ZMember, error) {
+	pairs, err := r.readEncoded(entries)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("sorted set has a member without a score")
+	}
+
+	members := make([]store.ZMember, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(pairs[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid score %q", pairs[i+1])
+		}
+		members = append(members, store.ZMember{Member: pairs[i], Score: score})
+	}
+	return members, nil
+}
+
+// readZSetMembers reads a sorted set stored as members and scores, the
+// scores binary if binary is set and as strings otherwise.
+func (r *rdbReader) readZSetMembers(binaryScores bool) ([]store.ZMember, error) {
+	n, err := r.readLen()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]store.ZMember, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		member, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScores {
+			p, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(p))
+		} else if score, err = r.readDoubleString(); err != nil {
+			return nil, err
+		}
+		members = append(members, store.ZMember{Member: member, Score: score})
+	}
+	return members, nil
+}
+
+// readDoubleString reads a score of the original sorted set type: a length
+// byte and the number in ASCII, with special lengths for NaN and infinities.
+func (r *rdbReader) readDoubleString() (float64, error) {
+	n, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	p, err := r.read(int(n))
+	if err != nil {
+		return 0, err
+	}
+	score, err := strconv.ParseFloat(string(p), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid score %q", p)
+	}
+	return score, nil
+}
@@ -0,0 +1,258 @@
+// Package persistence decodes the compact encodings Redis stores small
+// values in: ziplists, listpacks and intsets, and LZF compressed strings.
+package persistence
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var errTruncatedEncoding = errors.New("truncated compact encoding")
+
+// lzfDecompress decompresses LZF data, which must expand to size bytes.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// A literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errors.New("invalid LZF data: literal past the end")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// A back reference: copy length+2 bytes from offset+1 bytes back
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errors.New("invalid LZF data: reference past the end")
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("invalid LZF data: reference past the end")
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("invalid LZF data: reference before the start")
+		}
+		// Byte by byte, as the copy may overlap what it appends
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("invalid LZF data: expanded to %d bytes, want %d", len(out), size)
+	}
+	return out, nil
+}
+
+// ziplistEntries returns the entries of a ziplist, the encoding of small
+// lists, hashes and sorted sets before Redis 7.
+func ziplistEntries(zl []byte) ([]string, error) {
+	// zlbytes, zltail and zllen come before the entries
+	const header = 10
+	if len(zl) < header+1 {
+		return nil, errTruncatedEncoding
+	}
+	var entries []string
+	i := header
+	for {
+		if i >= len(zl) {
+			return nil, errTruncatedEncoding
+		}
+		if zl[i] == 0xFF {
+			return entries, nil
+		}
+
+		// The previous entry's length, in 1 or 5 bytes
+		if zl[i] == 0xFE {
+			i += 5
+		} else {
+			i++
+		}
+		if i >= len(zl) {
+			return nil, errTruncatedEncoding
+		}
+
+		enc := zl[i]
+		var n int
+		switch enc >> 6 {
+		case 0:
+			n, i = int(enc&0x3F), i+1
+		case 1:
+			if i+2 > len(zl) {
+				return nil, errTruncatedEncoding
+			}
+			n, i = int(enc&0x3F)<<8|int(zl[i+1]), i+2
+		case 2:
+			if i+5 > len(zl) {
+				return nil, errTruncatedEncoding
+			}
+			n, i = int(binary.BigEndian.Uint32(zl[i+1:])), i+5
+		default:
+			v, size, err := ziplistInt(zl[i:])
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, strconv.FormatInt(v, 10))
+			i += size
+			continue
+		}
+		if n < 0 || i+n > len(zl) {
+			return nil, errTruncatedEncoding
+		}
+		entries = append(entries, string(zl[i:i+n]))
+		i += n
+	}
+}
+
+// ziplistInt decodes an integer ziplist entry, returning it and the size of
+// its encoding and data.
+func ziplistInt(p []byte) (int64, int, error) {
+	enc := p[0]
+	size := map[byte]int{0xC0: 2, 0xD0: 4, 0xE0: 8, 0xF0: 3, 0xFE: 1}[enc]
+	if size == 0 {
+		// 1111xxxx is an immediate 0 to 12, stored as 1 to 13
+		if enc >= 0xF1 && enc <= 0xFD {
+			return int64(enc&0x0F) - 1, 1, nil
+		}
+		return 0, 0, fmt.Errorf("invalid ziplist encoding 0x%02x", enc)
+	}
+	if 1+size > len(p) {
+		return 0, 0, errTruncatedEncoding
+	}
+	return littleEndianInt(p[1 : 1+size]), 1 + size, nil
+}
+
+// listpackEntries returns the entries of a listpack, the encoding of small
+// lists, hashes, sets and sorted sets since Redis 7.
+func listpackEntries(lp []byte) ([]string, error) {
+	// The total size and number of entries come before the entries
+	const header = 6
+	if len(lp) < header+1 {
+		return nil, errTruncatedEncoding
+	}
+	var entries []string
+	i := header
+	for {
+		if i >= len(lp) {
+			return nil, errTruncatedEncoding
+		}
+		if lp[i] == 0xFF {
+			return entries, nil
+		}
+
+		entry, size, err := listpackEntry(lp[i:])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		// Each entry ends with its size, for iterating backwards
+		i += size + listpackBacklenSize(size)
+	}
+}
+
+// listpackEntry decodes the listpack entry p starts with, returning it and
+// the size of its encoding and data.
+func listpackEntry(p []byte) (string, int, error) {
+	enc := p[0]
+	str := func(offset, n int) (string, int, error) {
+		if n < 0 || offset+n > len(p) {
+			return "", 0, errTruncatedEncoding
+		}
+		return string(p[offset : offset+n]), offset + n, nil
+	}
+	integer := func(v int64, size int) (string, int, error) {
+		return strconv.FormatInt(v, 10), size, nil
+	}
+
+	switch {
+	case enc>>7 == 0: // 0xxxxxxx: 7 bit unsigned integer
+		return integer(int64(enc), 1)
+	case enc>>6 == 2: // 10xxxxxx: string of up to 63 bytes
+		return str(1, int(enc&0x3F))
+	case enc>>5 == 6: // 110xxxxx: 13 bit signed integer
+		if len(p) < 2 {
+			return "", 0, errTruncatedEncoding
+		}
+		v := int64(enc&0x1F)<<8 | int64(p[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return integer(v, 2)
+	case enc>>4 == 0xE: // 1110xxxx: string of up to 4095 bytes
+		if len(p) < 2 {
+			return "", 0, errTruncatedEncoding
+		}
+		return str(2, int(enc&0x0F)<<8|int(p[1]))
+	}
+
+	switch enc {
+	case 0xF0: // 32 bit string length
+		if len(p) < 5 {
+			return "", 0, errTruncatedEncoding
+		}
+		return str(5, int(binary.LittleEndian.Uint32(p[1:])))
+	case 0xF1, 0xF2, 0xF3, 0xF4: // 16, 24, 32 and 64 bit integers
+		size := map[byte]int{0xF1: 2, 0xF2: 3, 0xF3: 4, 0xF4: 8}[enc]
+		if 1+size > len(p) {
+			return "", 0, errTruncatedEncoding
+		}
+		return integer(littleEndianInt(p[1:1+size]), 1+size)
+	}
+	return "", 0, fmt.Errorf("invalid listpack encoding 0x%02x", enc)
+}
+
+// listpackBacklenSize returns how many bytes the length of an entry of size
+// bytes takes, stored 7 bits per byte.
+func listpackBacklenSize(size int) int {
+	n := 1
+	for size >= 1<<7 {
+		size >>= 7
+		n++
+	}
+	return n
+}
+
+// intsetEntries returns the members of an intset, the encoding of small
+// sets of integers.
+func intsetEntries(is []byte) ([]string, error) {
+	if len(is) < 8 {
+		return nil, errTruncatedEncoding
+	}
+	size := int(binary.LittleEndian.Uint32(is))
+	n := int(binary.LittleEndian.Uint32(is[4:]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("invalid intset encoding %d", size)
+	}
+	if n < 0 || 8+n*size > len(is) {
+		return nil, errTruncatedEncoding
+	}
+	members := make([]string, n)
+	for i := range members {
+		offset := 8 + i*size
+		members[i] = strconv.FormatInt(littleEndianInt(is[offset:offset+size]), 10)
+	}
+	return members, nil
+}
+
+// littleEndianInt decodes a signed little-endian integer of 1 to 8 bytes.
+func littleEndianInt(p []byte) int64 {
+	var v uint64
+	for i := len(p) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(p[i])
+	}
+	// Sign extend
+	shift := 64 - 8*len(p)
+	return int64(v<<shift) >> shift
+}
@@ -0,0 +1,158 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ziplist builds a ziplist of entries, each given as its encoding and data.
+func ziplist(entries ...[]byte) []byte {
+	var body []byte
+	prev, tail := 0, 10
+	for _, entry := range entries {
+		tail = 10 + len(body)
+		if prev < 254 {
+			body = append(body, byte(prev))
+		} else {
+			body = append(append(body, 0xFE), binary.LittleEndian.AppendUint32(nil, uint32(prev))...)
+		}
+		body = append(body, entry...)
+		prev = 10 + len(body) - tail
+	}
+	zl := binary.LittleEndian.AppendUint32(nil, uint32(10+len(body)+1))
+	zl = binary.LittleEndian.AppendUint32(zl, uint32(tail))
+	zl = binary.LittleEndian.AppendUint16(zl, uint16(len(entries)))
+	return append(append(zl, body...), 0xFF)
+}
+
+// listpack builds a listpack of entries, each given as its encoding and
+// data.
+func listpack(entries ...[]byte) []byte {
+	var body []byte
+	for _, entry := range entries {
+		body = append(body, entry...)
+		// The entry's size, most significant 7 bits first
+		if n := len(entry); n < 1<<7 {
+			body = append(body, byte(n))
+		} else {
+			body = append(body, byte(n>>7), byte(n&0x7F)|0x80)
+		}
+	}
+	lp := binary.LittleEndian.AppendUint32(nil, uint32(6+len(body)+1))
+	lp = binary.LittleEndian.AppendUint16(lp, uint16(len(entries)))
+	return append(append(lp, body...), 0xFF)
+}
+
+func TestLZFDecompress(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		size int
+		want string
+	}{
+		{[]byte{0x02, 'a', 'b', 'c'}, 3, "abc"},
+		{[]byte{0x02, 'a', 'b', 'c', 0x80, 0x02}, 9, "abcabcabc"},
+		{[]byte{0x00, 'a', 0xE0, 0x0B, 0x00}, 21, strings.Repeat("a", 21)},
+	}
+	for _, tt := range tests {
+		got, err := lzfDecompress(tt.in, tt.size)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("lzfDecompress(%v) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range [][]byte{{0x02, 'a'}, {0x20, 0x05}, {0x00, 'a', 0xE0}} {
+		if _, err := lzfDecompress(in, 3); err == nil {
+			t.Errorf("lzfDecompress(%v) succeeded, want an error", in)
+		}
+	}
+	if _, err := lzfDecompress([]byte{0x01, 'a', 'b'}, 3); err == nil {
+		t.Error("lzfDecompress() to the wrong size succeeded, want an error")
+	}
+}
+
+func TestZiplistEntries(t *testing.T) {
+	long := strings.Repeat("l", 300)
+	zl := ziplist(
+		[]byte{0x02, 'a', 'b'},
+		append([]byte{0x41, 0x2C}, long...),
+		[]byte{0x80, 0, 0, 0, 3, 'x', 'y', 'z'}, // After a long entry, so its previous length takes 5 bytes
+		[]byte{0xC0, 0xD4, 0xFE},
+		[]byte{0xD0, 0x70, 0x11, 0x01, 0x00},
+		[]byte{0xE0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		[]byte{0xF0, 0xFF, 0xFF, 0xFF},
+		[]byte{0xFE, 0xFB},
+		[]byte{0xF8},
+	)
+	want := []string{"ab", long, "xyz", "-300", "70000", "-1", "-1", "-5", "7"}
+	if got, err := ziplistEntries(zl); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ziplistEntries() = %q, %v; want %q", got, err, want)
+	}
+
+	for _, zl := range [][]byte{ziplist()[:10], ziplist([]byte{0x05, 'a'}), ziplist([]byte{0xFF})} {
+		if _, err := ziplistEntries(zl); err == nil {
+			t.Errorf("ziplistEntries(%v) succeeded, want an error", zl)
+		}
+	}
+}
+
+func TestListpackEntries(t *testing.T) {
+	long := strings.Repeat("l", 200)
+	lp := listpack(
+		[]byte{0x05},
+		[]byte{0x85, 'h', 'e', 'l', 'l', 'o'},
+		[]byte{0xDF, 0xFF},
+		[]byte{0xC1, 0x2C},
+		append([]byte{0xE0, 200}, long...), // Its size takes 2 bytes
+		[]byte{0xF0, 3, 0, 0, 0, 'a', 'b', 'c'},
+		[]byte{0xF1, 0xFE, 0xFF},
+		[]byte{0xF2, 0xA0, 0x86, 0x01},
+		[]byte{0xF3, 0x60, 0x79, 0xFE, 0xFF},
+		[]byte{0xF4, 0, 0, 0, 0, 0, 1, 0, 0},
+	)
+	want := []string{"5", "hello", "-1", "300", long, "abc", "-2", "100000", "-100000", "1099511627776"}
+	if got, err := listpackEntries(lp); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("listpackEntries() = %q, %v; want %q", got, err, want)
+	}
+
+	for _, lp := range [][]byte{listpack()[:6], listpack([]byte{0x85, 'a'}), listpack([]byte{0xF5})} {
+		if _, err := listpackEntries(lp); err == nil {
+			t.Errorf("listpackEntries(%v) succeeded, want an error", lp)
+		}
+	}
+}
+
+func TestIntsetEntries(t *testing.T) {
+	tests := []struct {
+		is   []byte
+		want []string
+	}{
+		{[]byte{2, 0, 0, 0, 2, 0, 0, 0, 0xFF, 0xFF, 0x05, 0x00}, []string{"-1", "5"}},
+		{[]byte{4, 0, 0, 0, 1, 0, 0, 0, 0x60, 0x79, 0xFE, 0xFF}, []string{"-100000"}},
+		{append([]byte{8, 0, 0, 0, 1, 0, 0, 0}, 0, 0, 0, 0, 0, 1, 0, 0), []string{"1099511627776"}},
+	}
+	for _, tt := range tests {
+		if got, err := intsetEntries(tt.is); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("intsetEntries(%v) = %q, %v; want %q", tt.is, got, err, tt.want)
+		}
+	}
+
+	for _, is := range [][]byte{{2, 0, 0, 0}, {3, 0, 0, 0, 0, 0, 0, 0}, {2, 0, 0, 0, 2, 0, 0, 0, 1, 0}} {
+		if _, err := intsetEntries(is); err == nil {
+			t.Errorf("intsetEntries(%v) succeeded, want an error", is)
+		}
+	}
+}
+
+func TestListpackBacklenSize(t *testing.T) {
+	for size, want := range map[int]int{1: 1, 127: 1, 128: 2, 16383: 2, 16384: 3, 1 << 21: 4} {
+		if got := listpackBacklenSize(size); got != want {
+			t.Errorf("listpackBacklenSize(%d) = %d, want %d", size, got, want)
+		}
+	}
+	if !bytes.Equal(listpack([]byte{0x05}), []byte{9, 0, 0, 0, 1, 0, 0x05, 0x01, 0xFF}) {
+		t.Errorf("listpack() = %v", listpack([]byte{0x05}))
+	}
+}
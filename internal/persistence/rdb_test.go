@@ -0,0 +1,258 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// buildRDB returns an RDB file of the given version, with body written
+// between the header and the EOF opcode, ending in a valid checksum.
+func buildRDB(version string, body func(w *rdbWriter)) []byte {
+	var buf bytes.Buffer
+	w := &rdbWriter{w: bufio.NewWriter(&buf)}
+	w.write([]byte("REDIS" + version))
+	body(w)
+	w.writeByte(rdbOpEOF)
+	_, _ = w.w.Write(binary.LittleEndian.AppendUint64(nil, w.crc))
+	_ = w.w.Flush()
+	return buf.Bytes()
+}
+
+func TestRDBChecksum(t *testing.T) {
+	// The check value of CRC-64/Jones, as in Redis's crc64.c
+	if got := rdbChecksum(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("rdbChecksum() = %016x, want e9c6d914c4b8d9ca", got)
+	}
+	if got := rdbChecksum(rdbChecksum(0, []byte("1234")), []byte("56789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("rdbChecksum() in two parts = %016x, want e9c6d914c4b8d9ca", got)
+	}
+}
+
+func TestEncodeRDB_RoundTrip(t *testing.T) {
+	snapshot := emptySnapshot()
+	snapshot.Strings.Data["str"] = store.StringEntry{Value: "v"}
+	snapshot.Strings.Data["ttl"] = store.StringEntry{Value: "v", ExpiresAt: 4102444800, ExpiresAtMs: 4102444800123}
+	snapshot.Strings.Data["big"] = store.StringEntry{Value: strings.Repeat("x", 20000)}
+	snapshot.Lists.Data["list"] = []string{"a", "", "c"}
+	snapshot.Lists.Expires["list"] = 4102444800000
+	snapshot.Sets.Data["set"] = []string{"m1", "m2"}
+	snapshot.Hashes.Data["hash"] = map[string]string{"f1": "v1", "f2": "v2"}
+	snapshot.Hashes.Expires["hash"] = 4102444800000
+	snapshot.ZSets.Data["zset"] = []store.ZMember{{Member: "low", Score: math.Inf(-1)}, {Member: "a", Score: 1.5}, {Member: "b", Score: 1.5}}
+
+	var buf bytes.Buffer
+	if err := EncodeRDB(&buf, snapshot); err != nil {
+		t.Fatalf("EncodeRDB() error: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("REDIS0009")) {
+		t.Errorf("file starts with %q, want REDIS0009", buf.Bytes()[:9])
+	}
+	got, err := DecodeRDB(&buf)
+	if err != nil {
+		t.Fatalf("DecodeRDB() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, snapshot) {
+		t.Errorf("DecodeRDB(EncodeRDB()) =\n%+v\nwant\n%+v", got, snapshot)
+	}
+}
+
+func TestEncodeRDB_Streams(t *testing.T) {
+	snapshot := emptySnapshot()
+	snapshot.Streams.Data["s"] = store.StreamData{}
+	if err := EncodeRDB(&bytes.Buffer{}, snapshot); !errors.Is(err, ErrRDBUnsupported) {
+		t.Errorf("EncodeRDB() with a stream error = %v, want ErrRDBUnsupported", err)
+	}
+}
+
+// TestDecodeRDB_RedisEncodings reads a file as Redis 7 writes it, with the
+// compact encodings of small values.
+func TestDecodeRDB_RedisEncodings(t *testing.T) {
+	data := buildRDB("0011", func(w *rdbWriter) {
+		w.writeByte(rdbOpAux)
+		w.writeString("redis-ver")
+		w.writeString("7.2.4")
+		w.writeByte(rdbOpAux)
+		w.writeString("ctime")
+		w.write([]byte{0xC2, 0x00, 0x00, 0x00, 0x65}) // An int32 encoded value
+		w.writeByte(rdbOpSelectDB)
+		w.writeLength(0)
+		w.writeByte(rdbOpResizeDB)
+		w.writeLength(9)
+		w.writeLength(1)
+
+		// An expiry in seconds and an integer encoded string
+		w.writeByte(rdbOpExpireTime)
+		w.write(binary.LittleEndian.AppendUint32(nil, 4102444800))
+		w.writeByte(rdbTypeString)
+		w.writeString("int")
+		w.write([]byte{0xC1, 0xD4, 0xFE})
+
+		// An LZF compressed string and LRU and LFU hints
+		w.writeByte(rdbOpIdle)
+		w.writeLength(100)
+		w.writeByte(rdbOpFreq)
+		w.writeByte(5)
+		w.writeByte(rdbTypeString)
+		w.writeString("lzf")
+		w.writeByte(0xC3)
+		w.writeLength(5)
+		w.writeLength(21)
+		w.write([]byte{0x00, 'a', 0xE0, 0x0B, 0x00})
+
+		w.writeByte(rdbTypeListQuicklist2)
+		w.writeString("list")
+		w.writeLength(2)
+		w.writeLength(quicklistPacked)
+		w.writeString(string(listpack([]byte{0x81, 'a'}, []byte{0x05})))
+		w.writeLength(quicklistPlain)
+		w.writeString("plain")
+
+		w.writeByte(rdbTypeListQuicklist)
+		w.writeString("oldlist")
+		w.writeLength(1)
+		w.writeString(string(ziplist([]byte{0x01, 'x'}, []byte{0xF2})))
+
+		w.writeByte(rdbTypeHashListpack)
+		w.writeString("hash")
+		w.writeString(string(listpack([]byte{0x81, 'f'}, []byte{0x81, 'v'})))
+
+		w.writeByte(rdbTypeHashZiplist)
+		w.writeString("oldhash")
+		w.writeString(string(ziplist([]byte{0x01, 'f'}, []byte{0xFE, 0x07})))
+
+		w.writeByte(rdbTypeSetIntset)
+		w.writeString("intset")
+		w.writeString(string([]byte{2, 0, 0, 0, 2, 0, 0, 0, 0xFF, 0xFF, 0x05, 0x00}))
+
+		w.writeByte(rdbTypeSetListpack)
+		w.writeString("set")
+		w.writeString(string(listpack([]byte{0x81, 'm'})))
+
+		w.writeByte(rdbTypeZSetListpack)
+		w.writeString("zset")
+		w.writeString(string(listpack([]byte{0x81, 'a'}, []byte{0x02}, []byte{0x81, 'b'}, []byte{0x83, '1', '.', '5'})))
+
+		// The original sorted set type, from the highest score down
+		w.writeByte(rdbTypeZSet)
+		w.writeString("oldzset")
+		w.writeLength(2)
+		w.writeString("top")
+		w.writeByte(254)
+		w.writeString("x")
+		w.writeByte(3)
+		w.write([]byte("0.5"))
+	})
+
+	got, err := DecodeRDB(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeRDB() error: %v", err)
+	}
+	want := emptySnapshot()
+	want.Strings.Data["int"] = store.StringEntry{Value: "-300", ExpiresAt: 4102444800, ExpiresAtMs: 4102444800000}
+	want.Strings.Data["lzf"] = store.StringEntry{Value: strings.Repeat("a", 21)}
+	want.Lists.Data["list"] = []string{"a", "5", "plain"}
+	want.Lists.Data["oldlist"] = []string{"x", "1"}
+	want.Hashes.Data["hash"] = map[string]string{"f": "v"}
+	want.Hashes.Data["oldhash"] = map[string]string{"f": "7"}
+	want.Sets.Data["intset"] = []string{"-1", "5"}
+	want.Sets.Data["set"] = []string{"m"}
+	want.ZSets.Data["zset"] = []store.ZMember{{Member: "b", Score: 1.5}, {Member: "a", Score: 2}}
+	want.ZSets.Data["oldzset"] = []store.ZMember{{Member: "x", Score: 0.5}, {Member: "top", Score: math.Inf(1)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeRDB() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestDecodeRDB_Errors(t *testing.T) {
+	valid := buildRDB("0009", func(w *rdbWriter) {
+		w.writeByte(rdbTypeString)
+		w.writeString("k")
+		w.writeString("v")
+	})
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-10] = 'x' // The value, inside the checksum
+	noChecksum := append(append([]byte(nil), valid[:len(valid)-8]...), make([]byte, 8)...)
+	if _, err := DecodeRDB(bytes.NewReader(noChecksum)); err != nil {
+		t.Errorf("DecodeRDB() with a zero checksum error = %v, want it unchecked", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not RDB", []byte("\x0cgob data"), nil},
+		{"future version", buildRDB("0099", func(*rdbWriter) {}), nil},
+		{"checksum mismatch", corrupt, nil},
+		{"truncated", valid[:len(valid)-12], nil},
+		{"other database", buildRDB("0009", func(w *rdbWriter) {
+			w.writeByte(rdbOpSelectDB)
+			w.writeLength(1)
+			w.writeByte(rdbTypeString)
+			w.writeString("k")
+			w.writeString("v")
+		}), ErrRDBUnsupported},
+		{"stream", buildRDB("0011", func(w *rdbWriter) {
+			w.writeByte(15)
+			w.writeString("s")
+		}), ErrRDBUnsupported},
+		{"module aux", buildRDB("0011", func(w *rdbWriter) { w.writeByte(rdbOpModuleAux) }), ErrRDBUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeRDB(bytes.NewReader(tt.data))
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("DecodeRDB() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_RDBFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	stringStore := store.New()
+	defer stringStore.Close()
+	listStore := store.NewListStore()
+	stringStore.Set("k", "v")
+	listStore.RPush("l", "a", "b")
+
+	manager := NewManager(path, Stores{Strings: store.AsSnapshottable(stringStore), Lists: store.AsSnapshottable(listStore)})
+	if got := manager.Format(); got != FormatGob {
+		t.Errorf("Format() = %q, want gob by default", got)
+	}
+	manager.SetFormat(FormatRDB)
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.HasPrefix(data, []byte("REDIS")) {
+		t.Fatalf("snapshot starts with %q, want the RDB magic", data[:min(len(data), 9)])
+	}
+
+	// Loading doesn't depend on the format set
+	loadedStrings, loadedLists := store.New(), store.NewListStore()
+	defer loadedStrings.Close()
+	loader := NewManager(path, Stores{Strings: store.AsSnapshottable(loadedStrings), Lists: store.AsSnapshottable(loadedLists)})
+	result, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if result.TotalKeys() != 2 {
+		t.Errorf("Load() loaded %d keys, want 2", result.TotalKeys())
+	}
+	if v, _ := loadedStrings.Get("k"); v != "v" {
+		t.Errorf("k = %q after loading, want v", v)
+	}
+	if got := loadedLists.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("l = %v after loading, want [a b]", got)
+	}
+}
@@ -2,11 +2,13 @@
 package persistence
 
 import (
+	"bufio"
 	"encoding/gob"
 	"fmt"
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/scotro/mini-redis/internal/store"
 )
@@ -17,6 +19,8 @@ type Snapshot struct {
 	Lists   store.ListSnapshot
 	Hashes  store.HashSnapshot
 	Sets    store.SetSnapshot
+	ZSets   store.ZSetSnapshot
+	Streams store.StreamSnapshot
 }
 
 // Stores holds references to all the stores that can be snapshotted.
@@ -25,46 +29,207 @@ type Stores struct {
 	Lists   store.Snapshottable
 	Hashes  store.Snapshottable
 	Sets    store.Snapshottable
+	ZSets   store.Snapshottable
+	Streams store.Snapshottable
 }
 
 // Manager handles snapshot operations for mini-redis.
 type Manager struct {
-	mu       sync.Mutex
+	// mu guards the fields below. It is only held briefly, never while a
+	// snapshot is written, so reading the manager's state doesn't wait for a
+	// save.
+	mu     sync.Mutex
+	path   string
+	format Format
+	stores Stores
+	saving bool
+	bgsave *backgroundSave
+
+	// lastSave is when the last successful save finished, or when the
+	// manager was created if there has been none.
+	lastSave time.Time
+	// lastBgsaveErr is the result of the last background save.
+	lastBgsaveErr error
+	stats         SaveStats
+
+	// changes counts the changes made to the stores, and changesAtSave is
+	// its value when the last successful save gathered the data.
+	changes       func() int64
+	changesAtSave int64
+
+	// writing is held while a snapshot is written, so saves take turns.
+	writing sync.Mutex
+}
+
+// backgroundSave is the result of a background save, set before done is
+// closed.
+type backgroundSave struct {
+	done chan struct{}
+	err  error
+}
+
+// saveJob is a save in progress. Where and how it saves are read when it
+// starts, so changing them only affects later saves.
+type saveJob struct {
 	path     string
-	stores   Stores
-	saving   bool
-	saveDone chan error
+	format   Format
+	start    time.Time
+	changes  int64
+	snapshot *snapshotReader
+}
+
+// SaveStats counts the saves a manager has made.
+type SaveStats struct {
+	Saves    int64 // Saves attempted, including failed ones
+	Failures int64
+	// TotalDuration and LastDuration are how long saves took, from gathering
+	// the data to renaming the file into place.
+	TotalDuration time.Duration
+	LastDuration  time.Duration
 }
 
 // NewManager creates a new persistence manager.
 func NewManager(path string, stores Stores) *Manager {
 	return &Manager{
-		path:   path,
-		stores: stores,
+		path:     path,
+		format:   FormatGob,
+		stores:   stores,
+		lastSave: time.Now(),
 	}
 }
 
 // Path returns the snapshot file path.
 func (m *Manager) Path() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.path
 }
 
-// Save synchronously saves all stores to disk.
+// SetPath changes where snapshots are saved. A save in progress keeps
+// writing to the old path.
+func (m *Manager) SetPath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.path = path
+}
+
+// Format returns the format snapshots are saved in.
+func (m *Manager) Format() Format {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.format
+}
+
+// SetFormat changes the format snapshots are saved in, from the next save
+// on. Snapshots are loaded in whichever format they were saved in.
+func (m *Manager) SetFormat(format Format) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.format = format
+}
+
+// SetChangeCounter sets the function counting the changes made to the
+// stores, such as a store.Versions' Changes, and counts changes from now.
+func (m *Manager) SetChangeCounter(changes func() int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes = changes
+	m.changesAtSave = changes()
+}
+
+// ChangesSinceSave returns how many changes were made to the stores since
+// the data of the last successful save was gathered, or 0 without a change
+// counter.
+func (m *Manager) ChangesSinceSave() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.changeCount() - m.changesAtSave
+}
+
+// changeCount reads the change counter (must hold mutex).
+func (m *Manager) changeCount() int64 {
+	if m.changes == nil {
+		return 0
+	}
+	return m.changes()
+}
+
+// Save synchronously saves all stores to disk, after any save in progress.
 func (m *Manager) Save() error {
+	return m.BeginSave()()
+}
+
+// BeginSave starts a synchronous save of the stores as they are now, after
+// any save in progress, and returns a function writing it to disk that
+// returns Save's result. Only starting the save needs writes to the stores
+// held off; they may resume before the function is called. No other save
+// starts writing until it returns.
+func (m *Manager) BeginSave() func() error {
+	m.writing.Lock()
+	m.mu.Lock()
+	job := m.startSave()
+	m.mu.Unlock()
+
+	return func() error {
+		defer m.writing.Unlock()
+		err := m.writeSnapshot(job)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.finishSave(job, err)
+		return err
+	}
+}
+
+// startSave starts a save of the stores as they are now (must hold mutex).
+func (m *Manager) startSave() *saveJob {
+	return &saveJob{
+		path:     m.path,
+		format:   m.format,
+		start:    time.Now(),
+		changes:  m.changeCount(),
+		snapshot: m.beginSnapshot(),
+	}
+}
+
+// finishSave counts a finished save (must hold mutex).
+func (m *Manager) finishSave(job *saveJob, err error) {
+	d := time.Since(job.start)
+	m.stats.Saves++
+	if err != nil {
+		m.stats.Failures++
+	} else {
+		m.changesAtSave = job.changes
+		m.lastSave = time.Now()
+	}
+	m.stats.TotalDuration += d
+	m.stats.LastDuration = d
+}
+
+// Stats returns the manager's save statistics.
+func (m *Manager) Stats() SaveStats {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.stats
+}
 
-	return m.saveInternal()
+// LastSave returns when the last successful save finished.
+func (m *Manager) LastSave() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastSave
 }
 
-// saveInternal performs the actual save operation (must hold mutex).
-func (m *Manager) saveInternal() error {
-	snapshot := m.createSnapshot()
-	return m.writeSnapshot(snapshot)
+// LastBackgroundSaveErr returns the error of the last background save, or
+// nil if it succeeded or there has been none.
+func (m *Manager) LastBackgroundSaveErr() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastBgsaveErr
 }
 
-// createSnapshot gathers data from all stores.
-func (m *Manager) createSnapshot() *Snapshot {
+// Snapshot gathers the current data of all stores.
+func (m *Manager) Snapshot() *Snapshot {
 	snapshot := &Snapshot{}
 
 	if m.stores.Strings != nil {
@@ -91,21 +256,43 @@ func (m *Manager) createSnapshot() *Snapshot {
 		}
 	}
 
+	if m.stores.ZSets != nil {
+		if data, ok := m.stores.ZSets.ExportData().(store.ZSetSnapshot); ok {
+			snapshot.ZSets = data
+		}
+	}
+
+	if m.stores.Streams != nil {
+		if data, ok := m.stores.Streams.ExportData().(store.StreamSnapshot); ok {
+			snapshot.Streams = data
+		}
+	}
+
 	return snapshot
 }
 
-// writeSnapshot writes the snapshot to disk atomically.
-func (m *Manager) writeSnapshot(snapshot *Snapshot) error {
+// writeSnapshot writes a save's snapshot to disk atomically, a batch of keys
+// at a time, and ends the snapshot (must hold writing, but not mutex).
+func (m *Manager) writeSnapshot(job *saveJob) error {
+	snapshot := job.snapshot
+	defer snapshot.close()
+
 	// Write to temp file first for atomicity
-	tmpPath := m.path + ".tmp"
+	tmpPath := job.path + ".tmp"
 
 	file, err := os.Create(tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
 
-	encoder := gob.NewEncoder(file)
-	if err := encoder.Encode(snapshot); err != nil {
+	enc := newSnapshotEncoder(file, job.format, snapshot.len())
+	for batch, ok := snapshot.next(); ok && err == nil; batch, ok = snapshot.next() {
+		err = enc.encode(batch)
+	}
+	if err == nil {
+		err = enc.close()
+	}
+	if err != nil {
 		file.Close()
 		os.Remove(tmpPath)
 		return fmt.Errorf("failed to encode snapshot: %w", err)
@@ -123,11 +310,10 @@ func (m *Manager) writeSnapshot(snapshot *Snapshot) error {
 	}
 
 	// Atomically rename temp file to final path
-	if err := os.Rename(tmpPath, m.path); err != nil {
+	if err := os.Rename(tmpPath, job.path); err != nil {
 		os.Remove(tmpPath)
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
-
 	return nil
 }
 
@@ -140,39 +326,44 @@ func (m *Manager) BackgroundSave() error {
 		return ErrSaveInProgress
 	}
 	m.saving = true
-	m.saveDone = make(chan error, 1)
+	bgsave := &backgroundSave{done: make(chan struct{})}
+	m.bgsave = bgsave
+	// Start the snapshot now, so it holds the data as it is when this
+	// returns; the goroutine copies the keys a batch at a time as it writes
+	job := m.startSave()
 	m.mu.Unlock()
 
-	// Create snapshot while holding no locks
-	// Note: Each store's ExportData is already thread-safe
-	snapshot := m.createSnapshot()
-
 	// Write to disk in goroutine
 	go func() {
-		m.mu.Lock()
-		defer func() {
-			m.saving = false
-			m.mu.Unlock()
-		}()
+		m.writing.Lock()
+		err := m.writeSnapshot(job)
+		m.writing.Unlock()
 
-		err := m.writeSnapshot(snapshot)
-		m.saveDone <- err
+		m.mu.Lock()
+		m.finishSave(job, err)
+		m.lastBgsaveErr = err
+		m.saving = false
+		m.mu.Unlock()
+		bgsave.err = err
+		close(bgsave.done)
 	}()
 
 	return nil
 }
 
-// WaitForSave waits for a background save to complete and returns its result.
+// WaitForSave waits for the last background save to complete and returns
+// its result. Any number of callers may wait for the same save.
 func (m *Manager) WaitForSave() error {
 	m.mu.Lock()
-	done := m.saveDone
+	bgsave := m.bgsave
 	m.mu.Unlock()
 
-	if done == nil {
+	if bgsave == nil {
 		return nil
 	}
 
-	return <-done
+	<-bgsave.done
+	return bgsave.err
 }
 
 // IsSaving returns true if a background save is in progress.
@@ -184,7 +375,7 @@ func (m *Manager) IsSaving() bool {
 
 // Load reads a snapshot from disk and restores all stores.
 func (m *Manager) Load() (*LoadResult, error) {
-	file, err := os.Open(m.path)
+	file, err := os.Open(m.Path())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, ErrNoSnapshot
@@ -196,11 +387,12 @@ func (m *Manager) Load() (*LoadResult, error) {
 	return m.LoadFrom(file)
 }
 
-// LoadFrom reads and restores a snapshot from the given reader.
+// LoadFrom reads and restores a snapshot from the given reader, in either
+// format. The whole snapshot is read before any of it is restored, so the
+// stores are left untouched if it is corrupt.
 func (m *Manager) LoadFrom(r io.Reader) (*LoadResult, error) {
-	var snapshot Snapshot
-	decoder := gob.NewDecoder(r)
-	if err := decoder.Decode(&snapshot); err != nil {
+	snapshot, err := decodeSnapshot(bufio.NewReader(r))
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
 	}
 
@@ -234,24 +426,59 @@ func (m *Manager) LoadFrom(r io.Reader) (*LoadResult, error) {
 		result.SetKeys = len(snapshot.Sets.Data)
 	}
 
+	if m.stores.ZSets != nil {
+		if err := m.stores.ZSets.ImportData(snapshot.ZSets); err != nil {
+			return nil, fmt.Errorf("failed to restore sorted sets: %w", err)
+		}
+		result.ZSetKeys = len(snapshot.ZSets.Data)
+	}
+
+	if m.stores.Streams != nil {
+		if err := m.stores.Streams.ImportData(snapshot.Streams); err != nil {
+			return nil, fmt.Errorf("failed to restore streams: %w", err)
+		}
+		result.StreamKeys = len(snapshot.Streams.Data)
+	}
+
 	return result, nil
 }
 
+// decodeSnapshot decodes a snapshot, telling the formats apart by their
+// magic strings, which a gob stream can't start with. Gob snapshots older
+// than gobBatchMagic are a single gob-encoded Snapshot.
+func decodeSnapshot(r *bufio.Reader) (*Snapshot, error) {
+	header, _ := r.Peek(len(gobBatchMagic))
+	if isRDB(header) {
+		return DecodeRDB(r)
+	}
+	if string(header) == gobBatchMagic {
+		_, _ = r.Discard(len(gobBatchMagic))
+		return decodeGobBatches(r)
+	}
+	var snapshot Snapshot
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
 // LoadResult contains statistics about a loaded snapshot.
 type LoadResult struct {
 	StringKeys int
 	ListKeys   int
 	HashKeys   int
 	SetKeys    int
+	ZSetKeys   int
+	StreamKeys int
 }
 
 // TotalKeys returns the total number of keys loaded.
 func (r *LoadResult) TotalKeys() int {
-	return r.StringKeys + r.ListKeys + r.HashKeys + r.SetKeys
+	return r.StringKeys + r.ListKeys + r.HashKeys + r.SetKeys + r.ZSetKeys + r.StreamKeys
 }
 
 // Exists returns true if a snapshot file exists.
 func (m *Manager) Exists() bool {
-	_, err := os.Stat(m.path)
+	_, err := os.Stat(m.Path())
 	return err == nil
 }
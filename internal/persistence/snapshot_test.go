@@ -1,6 +1,7 @@
 package persistence
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"testing"
@@ -19,6 +20,8 @@ func TestManager_SaveAndLoad(t *testing.T) {
 	listStore := store.NewListStore()
 	hashStore := store.NewHashStore()
 	setStore := store.NewSetStore()
+	zsetStore := store.NewZSetStore()
+	streamStore := store.NewStreamStore()
 
 	// Add test data
 	stringStore.Set("key1", "value1")
@@ -32,12 +35,20 @@ func TestManager_SaveAndLoad(t *testing.T) {
 
 	setStore.SAdd("set1", "member1", "member2", "member3")
 
+	zsetStore.ZAdd("zset1", store.ZAddFlags{}, store.ZMember{Member: "a", Score: 1}, store.ZMember{Member: "b", Score: 2})
+
+	streamStore.XAdd("stream1", store.XAddArgs{ID: store.StreamID{Ms: 1}}, []string{"field", "value"})
+	streamStore.XGroupCreate("stream1", "group1", store.StreamGroupStart{EntriesRead: -1}, false)
+	streamStore.XReadGroup("stream1", "group1", "consumer1", store.StreamID{}, true, 0, false)
+
 	// Create manager and save
 	stores := Stores{
 		Strings: store.AsSnapshottable(stringStore),
 		Lists:   store.AsSnapshottable(listStore),
 		Hashes:  store.AsSnapshottable(hashStore),
 		Sets:    store.AsSnapshottable(setStore),
+		ZSets:   store.AsSnapshottable(zsetStore),
+		Streams: store.AsSnapshottable(streamStore),
 	}
 	manager := NewManager(snapshotPath, stores)
 
@@ -55,12 +66,16 @@ func TestManager_SaveAndLoad(t *testing.T) {
 	listStore2 := store.NewListStore()
 	hashStore2 := store.NewHashStore()
 	setStore2 := store.NewSetStore()
+	zsetStore2 := store.NewZSetStore()
+	streamStore2 := store.NewStreamStore()
 
 	stores2 := Stores{
 		Strings: store.AsSnapshottable(stringStore2),
 		Lists:   store.AsSnapshottable(listStore2),
 		Hashes:  store.AsSnapshottable(hashStore2),
 		Sets:    store.AsSnapshottable(setStore2),
+		ZSets:   store.AsSnapshottable(zsetStore2),
+		Streams: store.AsSnapshottable(streamStore2),
 	}
 	manager2 := NewManager(snapshotPath, stores2)
 
@@ -82,8 +97,14 @@ func TestManager_SaveAndLoad(t *testing.T) {
 	if result.SetKeys != 1 {
 		t.Errorf("Expected 1 set key, got %d", result.SetKeys)
 	}
-	if result.TotalKeys() != 7 {
-		t.Errorf("Expected 7 total keys, got %d", result.TotalKeys())
+	if result.ZSetKeys != 1 {
+		t.Errorf("Expected 1 zset key, got %d", result.ZSetKeys)
+	}
+	if result.StreamKeys != 1 {
+		t.Errorf("Expected 1 stream key, got %d", result.StreamKeys)
+	}
+	if result.TotalKeys() != 9 {
+		t.Errorf("Expected 9 total keys, got %d", result.TotalKeys())
 	}
 
 	// Verify string data
@@ -122,6 +143,19 @@ func TestManager_SaveAndLoad(t *testing.T) {
 		t.Error("Set set1 member2 not restored")
 	}
 
+	// Verify sorted set data
+	if score, ok := zsetStore2.ZScore("zset1", "b"); !ok || score != 2 {
+		t.Errorf("ZSet zset1 member b not restored correctly: got %v, ok=%v", score, ok)
+	}
+
+	// Verify stream data, including the consumer group's pending entries
+	if entries := streamStore2.XRange("stream1", store.StreamID{}, store.MaxStreamID, 0, false); len(entries) != 1 || entries[0].Fields[1] != "value" {
+		t.Errorf("Stream stream1 not restored correctly: got %v", entries)
+	}
+	if summary, err := streamStore2.XPendingSummary("stream1", "group1"); err != nil || summary.Count != 1 {
+		t.Errorf("Stream stream1 pending entries not restored: got %+v, err=%v", summary, err)
+	}
+
 	// Cleanup
 	stringStore.Close()
 	stringStore2.Close()
@@ -165,6 +199,40 @@ func TestManager_BackgroundSave(t *testing.T) {
 	if !manager.Exists() {
 		t.Error("Snapshot file should exist after background save")
 	}
+
+	// Waiting again returns the same result rather than blocking
+	if err := manager.WaitForSave(); err != nil {
+		t.Errorf("second WaitForSave() returned error: %v", err)
+	}
+}
+
+func TestManager_BeginSave(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "test.rdb")
+	stringStore := store.New()
+	defer stringStore.Close()
+	stringStore.Set("key1", "value1")
+	manager := NewManager(snapshotPath, Stores{Strings: store.AsSnapshottable(stringStore)})
+
+	write := manager.BeginSave()
+	// Writes after the save starts aren't saved
+	stringStore.Set("key1", "changed")
+	stringStore.Set("key2", "value2")
+	if err := write(); err != nil {
+		t.Fatalf("BeginSave() write error: %v", err)
+	}
+
+	loadedStore := store.New()
+	defer loadedStore.Close()
+	loaded := NewManager(snapshotPath, Stores{Strings: store.AsSnapshottable(loadedStore)})
+	if _, err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if v, ok := loadedStore.Get("key1"); !ok || v != "value1" {
+		t.Errorf("key1 = %q, %v; want value1", v, ok)
+	}
+	if _, ok := loadedStore.Get("key2"); ok {
+		t.Error("key2, set after the save started, was saved")
+	}
 }
 
 func TestManager_LoadNoSnapshot(t *testing.T) {
@@ -263,9 +331,266 @@ func TestManager_ExpiredKeysNotSaved(t *testing.T) {
 	}
 }
 
+func TestManager_ExpiriesRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	snapshotPath := filepath.Join(tmpDir, "test.rdb")
+
+	stringStore := store.New()
+	defer stringStore.Close()
+	listStore := store.NewListStore()
+	defer listStore.Close()
+	hashStore := store.NewHashStore()
+	defer hashStore.Close()
+	setStore := store.NewSetStore()
+	defer setStore.Close()
+
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	stringStore.Set("str", "v")
+	listStore.RPush("list", "a")
+	hashStore.HSet("hash", "f", "v")
+	setStore.SAdd("set", "m")
+	stringStore.Expire("str", at)
+	listStore.Expire("list", at)
+	hashStore.Expire("hash", at)
+	setStore.Expire("set", at)
+
+	manager := NewManager(snapshotPath, Stores{
+		Strings: store.AsSnapshottable(stringStore),
+		Lists:   store.AsSnapshottable(listStore),
+		Hashes:  store.AsSnapshottable(hashStore),
+		Sets:    store.AsSnapshottable(setStore),
+	})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	stringStore2 := store.New()
+	defer stringStore2.Close()
+	listStore2 := store.NewListStore()
+	defer listStore2.Close()
+	hashStore2 := store.NewHashStore()
+	defer hashStore2.Close()
+	setStore2 := store.NewSetStore()
+	defer setStore2.Close()
+
+	manager2 := NewManager(snapshotPath, Stores{
+		Strings: store.AsSnapshottable(stringStore2),
+		Lists:   store.AsSnapshottable(listStore2),
+		Hashes:  store.AsSnapshottable(hashStore2),
+		Sets:    store.AsSnapshottable(setStore2),
+	})
+	if _, err := manager2.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	for key, s := range map[string]store.Expirable{
+		"str":  stringStore2,
+		"list": listStore2,
+		"hash": hashStore2,
+		"set":  setStore2,
+	} {
+		if got, ok := s.ExpiresAt(key); !ok || !got.Equal(at) {
+			t.Errorf("ExpiresAt(%q) = %v, %v, want %v, true", key, got, ok, at)
+		}
+	}
+}
+
 func TestManager_Path(t *testing.T) {
 	manager := NewManager("/path/to/dump.rdb", Stores{})
 	if manager.Path() != "/path/to/dump.rdb" {
 		t.Errorf("Expected path /path/to/dump.rdb, got %s", manager.Path())
 	}
 }
+
+func TestManager_SetPath(t *testing.T) {
+	dir := t.TempDir()
+	stringStore := store.New()
+	stringStore.Set("key", "value")
+	manager := NewManager(filepath.Join(dir, "old.rdb"), Stores{Strings: store.AsSnapshottable(stringStore)})
+
+	newPath := filepath.Join(dir, "new.rdb")
+	manager.SetPath(newPath)
+	if manager.Path() != newPath {
+		t.Errorf("Expected path %s, got %s", newPath, manager.Path())
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("Expected snapshot at the new path: %v", err)
+	}
+	if !manager.Exists() {
+		t.Error("Expected Exists to check the new path")
+	}
+}
+
+func TestManager_LastSave(t *testing.T) {
+	dir := t.TempDir()
+	stringStore := store.New()
+	defer stringStore.Close()
+	// The snapshot path is a directory, so saving fails
+	manager := NewManager(dir, Stores{Strings: store.AsSnapshottable(stringStore)})
+	started := manager.LastSave()
+
+	if err := manager.BackgroundSave(); err != nil {
+		t.Fatalf("BackgroundSave() failed: %v", err)
+	}
+	if err := manager.WaitForSave(); err == nil {
+		t.Fatal("Expected the save to fail")
+	}
+	if manager.LastBackgroundSaveErr() == nil {
+		t.Error("Expected LastBackgroundSaveErr after a failed save")
+	}
+	if !manager.LastSave().Equal(started) {
+		t.Error("LastSave changed after a failed save")
+	}
+
+	manager.SetPath(filepath.Join(dir, "dump.rdb"))
+	if err := manager.BackgroundSave(); err != nil {
+		t.Fatalf("BackgroundSave() failed: %v", err)
+	}
+	if err := manager.WaitForSave(); err != nil {
+		t.Fatalf("WaitForSave() returned error: %v", err)
+	}
+	if err := manager.LastBackgroundSaveErr(); err != nil {
+		t.Errorf("LastBackgroundSaveErr() = %v after a successful save", err)
+	}
+	if !manager.LastSave().After(started) {
+		t.Error("Expected LastSave to advance after a successful save")
+	}
+}
+
+func TestManager_ChangesSinceSave(t *testing.T) {
+	stringStore := store.New()
+	defer stringStore.Close()
+	manager := NewManager(filepath.Join(t.TempDir(), "dump.rdb"), Stores{Strings: store.AsSnapshottable(stringStore)})
+	if got := manager.ChangesSinceSave(); got != 0 {
+		t.Errorf("ChangesSinceSave() without a counter = %d, want 0", got)
+	}
+
+	changes := int64(10)
+	manager.SetChangeCounter(func() int64 { return changes })
+	changes = 13
+	if got := manager.ChangesSinceSave(); got != 3 {
+		t.Errorf("ChangesSinceSave() = %d, want 3", got)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if got := manager.ChangesSinceSave(); got != 0 {
+		t.Errorf("ChangesSinceSave() after Save = %d, want 0", got)
+	}
+
+	// Changes made while a background save runs are still counted afterwards
+	changes = 20
+	if err := manager.BackgroundSave(); err != nil {
+		t.Fatalf("BackgroundSave() failed: %v", err)
+	}
+	changes = 21
+	if err := manager.WaitForSave(); err != nil {
+		t.Fatalf("WaitForSave() returned error: %v", err)
+	}
+	if got := manager.ChangesSinceSave(); got != 1 {
+		t.Errorf("ChangesSinceSave() after BackgroundSave = %d, want 1", got)
+	}
+}
+
+func TestManager_Stats(t *testing.T) {
+	dir := t.TempDir()
+	stringStore := store.New()
+	defer stringStore.Close()
+	manager := NewManager(filepath.Join(dir, "dump.rdb"), Stores{Strings: store.AsSnapshottable(stringStore)})
+
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	manager.SetPath(dir)
+	if err := manager.BackgroundSave(); err != nil {
+		t.Fatalf("BackgroundSave() failed: %v", err)
+	}
+	_ = manager.WaitForSave()
+
+	stats := manager.Stats()
+	if stats.Saves != 2 || stats.Failures != 1 {
+		t.Errorf("Saves = %d, Failures = %d, want 2 and 1", stats.Saves, stats.Failures)
+	}
+	if stats.LastDuration <= 0 || stats.TotalDuration < stats.LastDuration {
+		t.Errorf("LastDuration = %v, TotalDuration = %v", stats.LastDuration, stats.TotalDuration)
+	}
+}
+
+// heldStore is a store whose snapshots wait for release before returning
+// their keys, holding a save open until then.
+type heldStore struct {
+	store.Snapshottable
+	reading chan struct{} // Closed once a snapshot is read
+	release chan struct{}
+}
+
+func newHeldStore(s store.Snapshottable) *heldStore {
+	return &heldStore{Snapshottable: s, reading: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *heldStore) BeginSnapshot() store.SnapshotCursor {
+	return &heldCursor{SnapshotCursor: store.AsStreamingSnapshottable(s.Snapshottable).BeginSnapshot(), store: s}
+}
+
+type heldCursor struct {
+	store.SnapshotCursor
+	store *heldStore
+	held  bool
+}
+
+func (c *heldCursor) Next(n int) (interface{}, bool) {
+	if !c.held {
+		c.held = true
+		close(c.store.reading)
+		<-c.store.release
+	}
+	return c.SnapshotCursor.Next(n)
+}
+
+// TestManager_StateDuringSave checks the manager's state can be read and
+// changed while a save is being written.
+func TestManager_StateDuringSave(t *testing.T) {
+	dir := t.TempDir()
+	stringStore := store.New()
+	defer stringStore.Close()
+	stringStore.Set("k", "v")
+	held := newHeldStore(store.AsSnapshottable(stringStore))
+	path := filepath.Join(dir, "dump.rdb")
+	manager := NewManager(path, Stores{Strings: held})
+
+	if err := manager.BackgroundSave(); err != nil {
+		t.Fatalf("BackgroundSave() failed: %v", err)
+	}
+	<-held.reading
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if !manager.IsSaving() {
+			t.Error("IsSaving() = false while a save is written")
+		}
+		manager.LastSave()
+		manager.LastBackgroundSaveErr()
+		manager.Stats()
+		manager.ChangesSinceSave()
+		manager.SetPath(filepath.Join(dir, "other.rdb"))
+		manager.SetFormat(FormatRDB)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the manager's state waited for the save")
+	}
+
+	close(held.release)
+	if err := manager.WaitForSave(); err != nil {
+		t.Fatalf("WaitForSave() returned error: %v", err)
+	}
+	// The save kept the path and format it started with
+	if data, err := os.ReadFile(path); err != nil || bytes.HasPrefix(data, []byte("REDIS")) {
+		t.Errorf("snapshot at the old path = %.9q, %v; want a gob snapshot", data, err)
+	}
+}
@@ -4,6 +4,7 @@ package pubsub
 import (
 	"path"
 	"sync"
+	"sync/atomic"
 )
 
 // MessageBufferSize is the size of the subscriber's message buffer.
@@ -42,6 +43,9 @@ type PubSub struct {
 	// Track per-subscriber subscriptions for counting
 	subChannels map[*Subscriber]map[string]struct{} // subscriber -> channels
 	subPatterns map[*Subscriber]map[string]struct{} // subscriber -> patterns
+
+	// dropped counts messages dropped because a subscriber's buffer was full
+	dropped atomic.Int64
 }
 
 // New creates a new PubSub instance.
@@ -308,6 +312,7 @@ func (ps *PubSub) sendMessage(sub *Subscriber, msg Message) bool {
 		return true
 	default:
 		// Buffer full, drop the message (Redis behavior)
+		ps.dropped.Add(1)
 		return false
 	}
 }
@@ -323,6 +328,41 @@ func matchPattern(pattern, channel string) bool {
 	return matched
 }
 
+// SubscriptionCount returns the number of channels and patterns a subscriber is subscribed to.
+func (ps *PubSub) SubscriptionCount(sub *Subscriber) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.subscriptionCount(sub)
+}
+
+// RemoveSubscriber drops every channel and pattern subscription held by a subscriber.
+// Unlike Unsubscribe and PUnsubscribe, no confirmation messages are sent.
+// Used when the subscriber's connection goes away.
+func (ps *PubSub) RemoveSubscriber(sub *Subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for channel := range ps.subChannels[sub] {
+		if subs, ok := ps.channels[channel]; ok {
+			delete(subs, sub)
+			if len(subs) == 0 {
+				delete(ps.channels, channel)
+			}
+		}
+	}
+	delete(ps.subChannels, sub)
+
+	for pattern := range ps.subPatterns[sub] {
+		if subs, ok := ps.patterns[pattern]; ok {
+			delete(subs, sub)
+			if len(subs) == 0 {
+				delete(ps.patterns, pattern)
+			}
+		}
+	}
+	delete(ps.subPatterns, sub)
+}
+
 // GetChannelSubscribers returns the number of subscribers for a channel.
 func (ps *PubSub) GetChannelSubscribers(channel string) int {
 	ps.mu.RLock()
@@ -346,6 +386,26 @@ func (ps *PubSub) GetPatternSubscribers() int {
 	return count
 }
 
+// ChannelCount returns the number of channels with at least one subscriber.
+func (ps *PubSub) ChannelCount() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.channels)
+}
+
+// PatternCount returns the number of distinct patterns subscribed to.
+func (ps *PubSub) PatternCount() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.patterns)
+}
+
+// DroppedMessages returns how many messages were dropped because a
+// subscriber's buffer was full.
+func (ps *PubSub) DroppedMessages() int64 {
+	return ps.dropped.Load()
+}
+
 // GetSubscriberChannels returns the channels a subscriber is subscribed to.
 func (ps *PubSub) GetSubscriberChannels(sub *Subscriber) []string {
 	ps.mu.RLock()
@@ -444,6 +444,10 @@ func TestMessageBufferFull(t *testing.T) {
 	if count != 0 {
 		t.Errorf("expected count 0 (message dropped), got %d", count)
 	}
+	// The subscribe confirmation took one slot, so two messages were dropped
+	if got := ps.DroppedMessages(); got != 2 {
+		t.Errorf("DroppedMessages() = %d, want 2", got)
+	}
 }
 
 func TestGetChannelSubscribers(t *testing.T) {
@@ -623,3 +627,94 @@ func TestConcurrentSubscribeUnsubscribe(t *testing.T) {
 	<-done
 	<-done
 }
+
+func TestSubscriptionCount(t *testing.T) {
+	ps := New()
+	sub := NewSubscriber("sub1")
+
+	if count := ps.SubscriptionCount(sub); count != 0 {
+		t.Errorf("expected 0 subscriptions, got %d", count)
+	}
+
+	ps.Subscribe(sub, "channel1", "channel2")
+	ps.PSubscribe(sub, "news.*")
+
+	if count := ps.SubscriptionCount(sub); count != 3 {
+		t.Errorf("expected 3 subscriptions, got %d", count)
+	}
+
+	ps.Unsubscribe(sub, "channel1")
+	if count := ps.SubscriptionCount(sub); count != 2 {
+		t.Errorf("expected 2 subscriptions, got %d", count)
+	}
+}
+
+func TestRemoveSubscriber(t *testing.T) {
+	ps := New()
+	sub1 := NewSubscriber("sub1")
+	sub2 := NewSubscriber("sub2")
+
+	ps.Subscribe(sub1, "channel1", "channel2")
+	ps.PSubscribe(sub1, "news.*")
+	ps.Subscribe(sub2, "channel1")
+
+	// Drain confirmation messages
+	for i := 0; i < 3; i++ {
+		<-sub1.Messages
+	}
+	<-sub2.Messages
+
+	ps.RemoveSubscriber(sub1)
+
+	if count := ps.SubscriptionCount(sub1); count != 0 {
+		t.Errorf("expected 0 subscriptions after removal, got %d", count)
+	}
+	if n := ps.GetChannelSubscribers("channel1"); n != 1 {
+		t.Errorf("expected 1 subscriber left on channel1, got %d", n)
+	}
+	if n := ps.GetChannelSubscribers("channel2"); n != 0 {
+		t.Errorf("expected channel2 to be removed, got %d subscribers", n)
+	}
+	if n := ps.GetPatternSubscribers(); n != 0 {
+		t.Errorf("expected no pattern subscribers, got %d", n)
+	}
+
+	// No unsubscribe confirmations should be sent
+	select {
+	case msg := <-sub1.Messages:
+		t.Errorf("expected no messages after removal, got %+v", msg)
+	default:
+	}
+
+	// Publishing must no longer reach the removed subscriber
+	if n := ps.Publish("channel1", "hello"); n != 1 {
+		t.Errorf("expected 1 receiver, got %d", n)
+	}
+}
+
+func TestChannelAndPatternCount(t *testing.T) {
+	ps := New()
+	sub1 := NewSubscriber("sub1")
+	sub2 := NewSubscriber("sub2")
+
+	ps.Subscribe(sub1, "a", "b")
+	ps.Subscribe(sub2, "b", "c")
+	ps.PSubscribe(sub1, "news.*")
+	ps.PSubscribe(sub2, "news.*")
+	if got := ps.ChannelCount(); got != 3 {
+		t.Errorf("ChannelCount() = %d, want 3", got)
+	}
+	if got := ps.PatternCount(); got != 1 {
+		t.Errorf("PatternCount() = %d, want 1", got)
+	}
+
+	ps.Unsubscribe(sub1)
+	ps.PUnsubscribe(sub1)
+	ps.PUnsubscribe(sub2)
+	if got := ps.ChannelCount(); got != 2 {
+		t.Errorf("ChannelCount() after unsubscribe = %d, want 2", got)
+	}
+	if got := ps.PatternCount(); got != 0 {
+		t.Errorf("PatternCount() after unsubscribe = %d, want 0", got)
+	}
+}
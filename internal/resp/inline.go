@@ -0,0 +1,175 @@
+// Package resp implements parsing of inline commands, as sent by telnet
+// sessions and health-check probes.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrUnbalancedQuotes is returned for inline commands with an unterminated quoted argument.
+var ErrUnbalancedQuotes = errors.New("unbalanced quotes in request")
+
+// ParseCommand reads a client command. Commands are normally RESP arrays,
+// but as in Redis, input that doesn't start with '*' is read as an inline
+// command: arguments separated by whitespace, with optional quoting,
+// terminated by a newline. Inline commands are returned as an array of bulk
+// strings, just like their RESP form. Blank lines are skipped.
+// Zero fields of limits use DefaultLimits.
+func ParseCommand(reader *bufio.Reader, limits Limits) (Value, error) {
+	limits = limits.withDefaults()
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return Value{}, ErrUnexpectedEOF
+			}
+			return Value{}, err
+		}
+		if first[0] == TypeArray {
+			return ParseWithLimits(reader, limits)
+		}
+
+		raw, err := readRawLine(reader, limits.MaxInlineLen)
+		if err != nil {
+			return Value{}, err
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(string(raw), "\n"), "\r")
+
+		args, err := SplitArgs(line)
+		if err != nil {
+			return Value{}, err
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		array := make([]Value, len(args))
+		for i, arg := range args {
+			array[i] = Value{Type: TypeBulkString, Str: arg}
+		}
+		return Value{Type: TypeArray, Array: array}, nil
+	}
+}
+
+// SplitArgs splits a line into arguments using the Redis inline rules.
+// Arguments are separated by whitespace. In double quotes the escapes \n, \r,
+// \t, \b, \a and \xHH are recognized and any other backslash escapes the next
+// character; in single quotes only \' is an escape. A closing quote must be
+// followed by whitespace or the end of the line.
+func SplitArgs(line string) ([]string, error) {
+	args := []string{}
+	i := 0
+	for {
+		for i < len(line) && isArgSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		// Quotes may open anywhere in an argument, as in Redis: a"b c" is "ab c"
+		current := []byte{}
+		for i < len(line) && !isArgSpace(line[i]) {
+			var section []byte
+			var err error
+			switch line[i] {
+			case '"':
+				section, i, err = splitDoubleQuoted(line, i+1)
+			case '\'':
+				section, i, err = splitSingleQuoted(line, i+1)
+			default:
+				section = []byte{line[i]}
+				i++
+			}
+			if err != nil {
+				return nil, err
+			}
+			current = append(current, section...)
+		}
+		args = append(args, string(current))
+	}
+}
+
+// splitDoubleQuoted reads a double quoted argument starting just after the
+// opening quote. Returns the unescaped argument and the index after the closing quote.
+func splitDoubleQuoted(line string, i int) ([]byte, int, error) {
+	current := []byte{}
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+			current = append(current, hexValue(line[i+2])<<4|hexValue(line[i+3]))
+			i += 4
+		case c == '\\' && i+1 < len(line):
+			switch e := line[i+1]; e {
+			case 'n':
+				current = append(current, '\n')
+			case 'r':
+				current = append(current, '\r')
+			case 't':
+				current = append(current, '\t')
+			case 'b':
+				current = append(current, '\b')
+			case 'a':
+				current = append(current, '\a')
+			default:
+				current = append(current, e)
+			}
+			i += 2
+		case c == '"':
+			if i+1 < len(line) && !isArgSpace(line[i+1]) {
+				return nil, 0, ErrUnbalancedQuotes
+			}
+			return current, i + 1, nil
+		default:
+			current = append(current, c)
+			i++
+		}
+	}
+	return nil, 0, ErrUnbalancedQuotes
+}
+
+// splitSingleQuoted reads a single quoted argument starting just after the
+// opening quote. Returns the argument and the index after the closing quote.
+func splitSingleQuoted(line string, i int) ([]byte, int, error) {
+	current := []byte{}
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+			current = append(current, '\'')
+			i += 2
+		case c == '\'':
+			if i+1 < len(line) && !isArgSpace(line[i+1]) {
+				return nil, 0, ErrUnbalancedQuotes
+			}
+			return current, i + 1, nil
+		default:
+			current = append(current, c)
+			i++
+		}
+	}
+	return nil, 0, ErrUnbalancedQuotes
+}
+
+func isArgSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == 0
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,106 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single word", line: "PING", want: []string{"PING"}},
+		{name: "extra whitespace", line: "  SET \t key   value ", want: []string{"SET", "key", "value"}},
+		{name: "empty line", line: "", want: []string{}},
+		{name: "double quotes", line: `SET key "hello world"`, want: []string{"SET", "key", "hello world"}},
+		{name: "double quote escapes", line: `ECHO "a\nb\t\"c\"\\"`, want: []string{"ECHO", "a\nb\t\"c\"\\"}},
+		{name: "hex escape", line: `ECHO "\x41\x7a"`, want: []string{"ECHO", "Az"}},
+		{name: "incomplete hex escape", line: `ECHO "\x4"`, want: []string{"ECHO", "x4"}},
+		{name: "single quotes", line: `ECHO 'it\'s \n raw'`, want: []string{"ECHO", `it's \n raw`}},
+		{name: "empty quoted argument", line: `SET key ""`, want: []string{"SET", "key", ""}},
+		{name: "quote inside word", line: `SET a"b c"`, want: []string{"SET", "ab c"}},
+		{name: "unterminated double quote", line: `SET key "value`, wantErr: true},
+		{name: "unterminated single quote", line: `SET key 'value`, wantErr: true},
+		{name: "text after closing quote", line: `SET key "a"b`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitArgs(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnbalancedQuotes) {
+					t.Errorf("SplitArgs() error = %v, want ErrUnbalancedQuotes", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	bulk := func(strs ...string) Value {
+		array := make([]Value, len(strs))
+		for i, s := range strs {
+			array[i] = Value{Type: TypeBulkString, Str: s}
+		}
+		return Value{Type: TypeArray, Array: array}
+	}
+
+	// Inline and RESP commands can be mixed on one connection
+	input := "PING\r\n" +
+		"\r\n" +
+		"*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n" +
+		"SET key \"two words\"\n"
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	for _, want := range []Value{
+		bulk("PING"),
+		bulk("ECHO", "hi"),
+		bulk("SET", "key", "two words"),
+	} {
+		got, err := ParseCommand(reader, Limits{})
+		if err != nil {
+			t.Fatalf("ParseCommand() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseCommand() = %v, want %v", got, want)
+		}
+	}
+
+	if _, err := ParseCommand(reader, Limits{}); err != ErrUnexpectedEOF {
+		t.Errorf("ParseCommand() at end of input error = %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"unbalanced quotes", "SET key \"value\r\n", ErrUnbalancedQuotes},
+		{"line without newline", "PING", ErrUnexpectedEOF},
+		{"only blank lines", "\r\n\n", ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCommand(bufio.NewReader(strings.NewReader(tt.input)), Limits{})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ParseCommand() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
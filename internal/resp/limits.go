@@ -0,0 +1,81 @@
+// Package resp implements the limits that protect the parser from untrusted input.
+package resp
+
+import (
+	"errors"
+	"math"
+)
+
+// Errors for input exceeding the parser's limits
+var (
+	ErrBulkTooLong      = errors.New("invalid bulk length")
+	ErrMultibulkTooLong = errors.New("invalid multibulk length")
+	ErrTooDeep          = errors.New("too many nested aggregates")
+	ErrLineTooLong      = errors.New("too big inline request")
+)
+
+const (
+	// bulkChunk is how much of a bulk string is allocated before any of it has been read.
+	bulkChunk = 64 * 1024
+
+	// maxPrealloc is how many aggregate elements are allocated before any of them have been read.
+	maxPrealloc = 1024
+)
+
+// Limits bounds what the parser accepts.
+type Limits struct {
+	// MaxBulkLen is the longest bulk string accepted (proto-max-bulk-len).
+	MaxBulkLen int
+
+	// MaxMultibulkLen is the most elements an aggregate may announce.
+	MaxMultibulkLen int
+
+	// MaxDepth is how deeply aggregates may be nested.
+	MaxDepth int
+
+	// MaxInlineLen is the longest inline command or protocol line accepted.
+	MaxInlineLen int
+}
+
+// DefaultLimits returns the limits Redis applies by default.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxBulkLen:      512 * 1024 * 1024,
+		MaxMultibulkLen: math.MaxInt32,
+		MaxDepth:        32,
+		MaxInlineLen:    64 * 1024,
+	}
+}
+
+// withDefaults fills zero fields from DefaultLimits.
+func (l Limits) withDefaults() Limits {
+	def := DefaultLimits()
+	if l.MaxBulkLen <= 0 {
+		l.MaxBulkLen = def.MaxBulkLen
+	}
+	if l.MaxMultibulkLen <= 0 {
+		l.MaxMultibulkLen = def.MaxMultibulkLen
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = def.MaxDepth
+	}
+	if l.MaxInlineLen <= 0 {
+		l.MaxInlineLen = def.MaxInlineLen
+	}
+	return l
+}
+
+// IsProtocolError reports whether err was caused by malformed or oversized
+// input, as opposed to the connection failing or ending.
+func IsProtocolError(err error) bool {
+	for _, target := range []error{
+		ErrInvalidType, ErrInvalidFormat, ErrInvalidLength, ErrInvalidInteger,
+		ErrBulkTooLong, ErrMultibulkTooLong, ErrTooDeep, ErrLineTooLong,
+		ErrUnbalancedQuotes,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits := Limits{MaxBulkLen: 8, MaxMultibulkLen: 4, MaxDepth: 2, MaxInlineLen: 16}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"bulk at limit", "$8\r\n12345678\r\n", nil},
+		{"bulk over limit", "$9\r\n123456789\r\n", ErrBulkTooLong},
+		{"huge bulk header", "$999999999999\r\n", ErrBulkTooLong},
+		{"verbatim over limit", "=9\r\ntxt:12345\r\n", ErrBulkTooLong},
+		{"array at limit", "*4\r\n:1\r\n:2\r\n:3\r\n:4\r\n", nil},
+		{"array over limit", "*5\r\n", ErrMultibulkTooLong},
+		{"huge array header", "*999999999999\r\n", ErrMultibulkTooLong},
+		{"map over limit", "%5\r\n", ErrMultibulkTooLong},
+		{"nesting at limit", "*1\r\n*1\r\n:1\r\n", nil},
+		{"nesting over limit", "*1\r\n*1\r\n*1\r\n:1\r\n", ErrTooDeep},
+		{"nested sets over limit", "~1\r\n>1\r\n%1\r\n", ErrTooDeep},
+		{"attribute chain over limit", "|0\r\n|0\r\n|0\r\n:1\r\n", ErrTooDeep},
+		{"line at limit", "+1234567890123456\r\n", nil},
+		{"line over limit", "+12345678901234567\r\n", ErrLineTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWithLimits(bufio.NewReader(strings.NewReader(tt.input)), limits)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseWithLimits() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && !IsProtocolError(err) {
+				t.Errorf("IsProtocolError(%v) = false, want true", err)
+			}
+		})
+	}
+}
+
+func TestParseCommandLimits(t *testing.T) {
+	limits := Limits{MaxInlineLen: 16}
+
+	if _, err := ParseCommand(bufio.NewReader(strings.NewReader("SET key 12345678\r\n")), limits); err != nil {
+		t.Errorf("ParseCommand() at limit error = %v", err)
+	}
+
+	// The line is rejected as soon as it outgrows the limit, without waiting for the newline
+	long := io.MultiReader(strings.NewReader("SET key "+strings.Repeat("x", 5000)), neverEnding{})
+	if _, err := ParseCommand(bufio.NewReader(long), limits); !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("ParseCommand() error = %v, want ErrLineTooLong", err)
+	}
+}
+
+func TestParseLargeBulkString(t *testing.T) {
+	// Bulk strings larger than one read chunk are assembled piece by piece
+	content := strings.Repeat("abcdefgh", 3*bulkChunk/8+1)
+	input := "$" + strconv.Itoa(len(content)) + "\r\n" + content + "\r\n"
+	got, err := Parse(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.Str != content {
+		t.Errorf("Parse() returned %d bytes, want %d", len(got.Str), len(content))
+	}
+
+	// A length header alone does not make the parser allocate the announced size
+	truncated := "$100000000\r\n" + content[:10]
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := Parse(bufio.NewReader(strings.NewReader(truncated))); err != ErrUnexpectedEOF {
+		t.Errorf("Parse() of truncated bulk string error = %v, want ErrUnexpectedEOF", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Parse() of truncated bulk string allocated %d bytes", allocated)
+	}
+}
+
+func TestIsProtocolError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrInvalidFormat, true},
+		{ErrUnbalancedQuotes, true},
+		{ErrTooDeep, true},
+		{ErrUnexpectedEOF, false},
+		{io.ErrClosedPipe, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsProtocolError(tt.err); got != tt.want {
+			t.Errorf("IsProtocolError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// neverEnding is a reader that produces an endless stream of 'x'.
+type neverEnding struct{}
+
+func (neverEnding) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
@@ -1,4 +1,5 @@
 // Package resp implements the Redis Serialization Protocol (RESP) parser.
+// Both RESP2 and the RESP3 types negotiated with HELLO are supported.
 package resp
 
 import (
@@ -6,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 	"strconv"
 )
 
@@ -16,29 +19,69 @@ const (
 	TypeInteger      = ':'
 	TypeBulkString   = '$'
 	TypeArray        = '*'
+
+	// RESP3 types
+	TypeMap       = '%'
+	TypeSet       = '~'
+	TypeDouble    = ','
+	TypeBoolean   = '#'
+	TypeNull      = '_'
+	TypeBigNumber = '('
+	TypeVerbatim  = '='
+	TypePush      = '>'
+	TypeAttribute = '|'
+)
+
+// Protocol versions a connection can speak
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
 // Common errors
 var (
-	ErrInvalidType     = errors.New("invalid RESP type")
-	ErrInvalidFormat   = errors.New("invalid RESP format")
-	ErrInvalidLength   = errors.New("invalid length")
-	ErrUnexpectedEOF   = errors.New("unexpected end of input")
-	ErrInvalidInteger  = errors.New("invalid integer format")
+	ErrInvalidType    = errors.New("invalid RESP type")
+	ErrInvalidFormat  = errors.New("invalid RESP format")
+	ErrInvalidLength  = errors.New("invalid length")
+	ErrUnexpectedEOF  = errors.New("unexpected end of input")
+	ErrInvalidInteger = errors.New("invalid integer format")
 )
 
 // Value represents a RESP value
 type Value struct {
-	Type  byte     // '+', '-', ':', '$', '*'
-	Str   string   // For simple strings, errors, and bulk strings
-	Num   int      // For integers
-	Array []Value  // For arrays
-	Null  bool     // For null bulk strings and null arrays
+	Type   byte    // One of the Type constants
+	Str    string  // For simple strings, errors, bulk strings, big numbers and verbatim strings
+	Num    int     // For integers
+	Double float64 // For doubles
+	Bool   bool    // For booleans
+	Format string  // For verbatim strings: the three character format, e.g. "txt"
+	Array  []Value // For arrays, sets and pushes; maps hold alternating keys and values
+	Attrs  []Value // Attributes sent ahead of the value, as alternating keys and values
+	Null   bool    // For null bulk strings, null arrays and RESP3 nulls
 }
 
-// Parse reads and parses a RESP value from the reader.
+// Parse reads and parses a RESP value from the reader, enforcing DefaultLimits.
 func Parse(reader *bufio.Reader) (Value, error) {
-	typeByte, err := reader.ReadByte()
+	return ParseWithLimits(reader, DefaultLimits())
+}
+
+// ParseWithLimits reads and parses a RESP value from the reader.
+// Lengths and nesting beyond the limits are rejected while parsing, before
+// anything is allocated for them. Zero fields of limits use DefaultLimits.
+func ParseWithLimits(reader *bufio.Reader, limits Limits) (Value, error) {
+	p := &parser{reader: reader, limits: limits.withDefaults()}
+	return p.parse()
+}
+
+// parser holds the state of parsing one value.
+type parser struct {
+	reader *bufio.Reader
+	limits Limits
+	depth  int // Number of aggregates currently being parsed
+}
+
+func (p *parser) parse() (Value, error) {
+	typeByte, err := p.reader.ReadByte()
 	if err != nil {
 		if err == io.EOF {
 			return Value{}, ErrUnexpectedEOF
@@ -48,23 +91,39 @@ func Parse(reader *bufio.Reader) (Value, error) {
 
 	switch typeByte {
 	case TypeSimpleString:
-		return parseSimpleString(reader)
+		return p.parseSimpleString()
 	case TypeError:
-		return parseError(reader)
+		return p.parseError()
 	case TypeInteger:
-		return parseInteger(reader)
+		return p.parseInteger()
 	case TypeBulkString:
-		return parseBulkString(reader)
+		return p.parseBulkString()
 	case TypeArray:
-		return parseArray(reader)
+		return p.parseArray()
+	case TypeMap:
+		return p.parseAggregate(TypeMap, 2)
+	case TypeSet, TypePush:
+		return p.parseAggregate(typeByte, 1)
+	case TypeAttribute:
+		return p.parseAttribute()
+	case TypeDouble:
+		return p.parseDouble()
+	case TypeBoolean:
+		return p.parseBoolean()
+	case TypeNull:
+		return p.parseNull()
+	case TypeBigNumber:
+		return p.parseBigNumber()
+	case TypeVerbatim:
+		return p.parseVerbatim()
 	default:
 		return Value{}, fmt.Errorf("%w: %c", ErrInvalidType, typeByte)
 	}
 }
 
 // parseSimpleString parses a simple string (+OK\r\n)
-func parseSimpleString(reader *bufio.Reader) (Value, error) {
-	line, err := readLine(reader)
+func (p *parser) parseSimpleString() (Value, error) {
+	line, err := p.readLine()
 	if err != nil {
 		return Value{}, err
 	}
@@ -72,8 +131,8 @@ func parseSimpleString(reader *bufio.Reader) (Value, error) {
 }
 
 // parseError parses an error (-ERR message\r\n)
-func parseError(reader *bufio.Reader) (Value, error) {
-	line, err := readLine(reader)
+func (p *parser) parseError() (Value, error) {
+	line, err := p.readLine()
 	if err != nil {
 		return Value{}, err
 	}
@@ -81,8 +140,8 @@ func parseError(reader *bufio.Reader) (Value, error) {
 }
 
 // parseInteger parses an integer (:1000\r\n)
-func parseInteger(reader *bufio.Reader) (Value, error) {
-	line, err := readLine(reader)
+func (p *parser) parseInteger() (Value, error) {
+	line, err := p.readLine()
 	if err != nil {
 		return Value{}, err
 	}
@@ -96,8 +155,8 @@ func parseInteger(reader *bufio.Reader) (Value, error) {
 }
 
 // parseBulkString parses a bulk string ($5\r\nhello\r\n)
-func parseBulkString(reader *bufio.Reader) (Value, error) {
-	line, err := readLine(reader)
+func (p *parser) parseBulkString() (Value, error) {
+	line, err := p.readLine()
 	if err != nil {
 		return Value{}, err
 	}
@@ -116,64 +175,241 @@ func parseBulkString(reader *bufio.Reader) (Value, error) {
 		return Value{}, ErrInvalidLength
 	}
 
-	// Read the string content plus \r\n
-	buf := make([]byte, length+2)
-	_, err = io.ReadFull(reader, buf)
+	str, err := p.readBulk(length)
 	if err != nil {
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			return Value{}, ErrUnexpectedEOF
-		}
 		return Value{}, err
 	}
+	return Value{Type: TypeBulkString, Str: str}, nil
+}
+
+// readBulk reads length bytes of string content followed by \r\n.
+// The buffer grows as the content arrives, so a length header alone can't
+// make the parser allocate more than bulkChunk bytes.
+func (p *parser) readBulk(length int) (string, error) {
+	if length > p.limits.MaxBulkLen {
+		return "", ErrBulkTooLong
+	}
+
+	total := length + 2
+	buf := make([]byte, 0, min(total, bulkChunk))
+	for len(buf) < total {
+		n := min(total-len(buf), max(len(buf), bulkChunk))
+		buf = slices.Grow(buf, n)
+		if _, err := io.ReadFull(p.reader, buf[len(buf):len(buf)+n]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return "", ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		buf = buf[:len(buf)+n]
+	}
 
 	// Verify trailing \r\n
 	if buf[length] != '\r' || buf[length+1] != '\n' {
-		return Value{}, ErrInvalidFormat
+		return "", ErrInvalidFormat
 	}
 
-	return Value{Type: TypeBulkString, Str: string(buf[:length])}, nil
+	return string(buf[:length]), nil
 }
 
-// parseArray parses an array (*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n)
-func parseArray(reader *bufio.Reader) (Value, error) {
-	line, err := readLine(reader)
+// readCount reads the element count of an aggregate and enters it.
+// The caller must call p.leave once its elements are parsed.
+func (p *parser) readCount() (int, error) {
+	line, err := p.readLine()
 	if err != nil {
-		return Value{}, err
+		return 0, err
 	}
 
 	count, err := strconv.Atoi(line)
+	if err != nil || count < -1 {
+		return 0, ErrInvalidLength
+	}
+	if count > p.limits.MaxMultibulkLen {
+		return 0, ErrMultibulkTooLong
+	}
+
+	p.depth++
+	if p.depth > p.limits.MaxDepth {
+		return 0, ErrTooDeep
+	}
+	return count, nil
+}
+
+// leave exits an aggregate entered by readCount.
+func (p *parser) leave() {
+	p.depth--
+}
+
+// parseArray parses an array (*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n)
+func (p *parser) parseArray() (Value, error) {
+	count, err := p.readCount()
 	if err != nil {
-		return Value{}, ErrInvalidLength
+		return Value{}, err
 	}
+	defer p.leave()
 
 	// Handle null array (*-1\r\n)
 	if count == -1 {
 		return Value{Type: TypeArray, Null: true}, nil
 	}
 
-	if count < 0 {
-		return Value{}, ErrInvalidLength
+	array, err := p.parseElements(count)
+	if err != nil {
+		return Value{}, err
 	}
+	return Value{Type: TypeArray, Array: array}, nil
+}
 
-	array := make([]Value, count)
+// parseElements parses count values. Space is reserved for at most
+// maxPrealloc of them up front; the rest is allocated as they arrive.
+func (p *parser) parseElements(count int) ([]Value, error) {
+	array := make([]Value, 0, min(count, maxPrealloc))
 	for i := 0; i < count; i++ {
-		val, err := Parse(reader)
+		val, err := p.parse()
 		if err != nil {
-			return Value{}, err
+			return nil, err
 		}
-		array[i] = val
+		array = append(array, val)
 	}
+	return array, nil
+}
 
-	return Value{Type: TypeArray, Array: array}, nil
+// parseAggregate parses a set (~), push (>), map (%) or attribute (|).
+// Maps and attributes announce a number of pairs, so perEntry is 2 for them;
+// their keys and values are stored alternately in Array.
+func (p *parser) parseAggregate(typ byte, perEntry int) (Value, error) {
+	count, err := p.readCount()
+	if err != nil {
+		return Value{}, err
+	}
+	defer p.leave()
+
+	if count < 0 {
+		return Value{}, ErrInvalidLength
+	}
+
+	array, err := p.parseElements(count * perEntry)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: typ, Array: array}, nil
 }
 
-// readLine reads until \r\n and returns the line without the delimiter.
-func readLine(reader *bufio.Reader) (string, error) {
-	line, err := reader.ReadString('\n')
+// parseAttribute parses an attribute (|1\r\n+key\r\n+value\r\n) and the value it
+// annotates, which follows it. The attribute pairs are attached to that value.
+func (p *parser) parseAttribute() (Value, error) {
+	attrs, err := p.parseAggregate(TypeAttribute, 2)
 	if err != nil {
-		if err == io.EOF {
-			return "", ErrUnexpectedEOF
+		return Value{}, err
+	}
+
+	// A chain of attributes counts as nesting, so it can't recurse without bound
+	p.depth++
+	defer p.leave()
+	if p.depth > p.limits.MaxDepth {
+		return Value{}, ErrTooDeep
+	}
+
+	val, err := p.parse()
+	if err != nil {
+		return Value{}, err
+	}
+	val.Attrs = append(attrs.Array, val.Attrs...)
+	return val, nil
+}
+
+// parseDouble parses a double (,3.14\r\n), including inf, -inf and nan.
+func (p *parser) parseDouble() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	f, err := strconv.ParseFloat(line, 64)
+	if err != nil {
+		return Value{}, ErrInvalidFormat
+	}
+	return Value{Type: TypeDouble, Double: f}, nil
+}
+
+// parseBoolean parses a boolean (#t\r\n or #f\r\n).
+func (p *parser) parseBoolean() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch line {
+	case "t":
+		return Value{Type: TypeBoolean, Bool: true}, nil
+	case "f":
+		return Value{Type: TypeBoolean, Bool: false}, nil
+	default:
+		return Value{}, ErrInvalidFormat
+	}
+}
+
+// parseNull parses a null (_\r\n).
+func (p *parser) parseNull() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if line != "" {
+		return Value{}, ErrInvalidFormat
+	}
+	return Value{Type: TypeNull, Null: true}, nil
+}
+
+// parseBigNumber parses a big number ((3492890328409238509324850943850943825024385\r\n).
+func (p *parser) parseBigNumber() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	digits := line
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	if digits == "" {
+		return Value{}, ErrInvalidInteger
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return Value{}, ErrInvalidInteger
 		}
+	}
+	return Value{Type: TypeBigNumber, Str: line}, nil
+}
+
+// parseVerbatim parses a verbatim string (=15\r\ntxt:Some string\r\n).
+func (p *parser) parseVerbatim() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	length, err := strconv.Atoi(line)
+	if err != nil || length < 0 {
+		return Value{}, ErrInvalidLength
+	}
+
+	str, err := p.readBulk(length)
+	if err != nil {
+		return Value{}, err
+	}
+	// The content starts with a three character format and a colon
+	if len(str) < 4 || str[3] != ':' {
+		return Value{}, ErrInvalidFormat
+	}
+	return Value{Type: TypeVerbatim, Format: str[:3], Str: str[4:]}, nil
+}
+
+// readLine reads until \r\n and returns the line without the delimiter.
+func (p *parser) readLine() (string, error) {
+	line, err := readRawLine(p.reader, p.limits.MaxInlineLen)
+	if err != nil {
 		return "", err
 	}
 
@@ -182,33 +418,186 @@ func readLine(reader *bufio.Reader) (string, error) {
 		return "", ErrInvalidFormat
 	}
 
-	return line[:len(line)-2], nil
+	return string(line[:len(line)-2]), nil
+}
+
+// readRawLine reads up to and including the next \n. Lines with more than
+// maxLen bytes before the newline are rejected without buffering them whole.
+// The returned slice is only valid until the next read.
+func readRawLine(reader *bufio.Reader, maxLen int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLen+2 {
+			return nil, ErrLineTooLong
+		}
+		switch err {
+		case nil:
+			if line == nil {
+				return chunk, nil
+			}
+			return append(line, chunk...), nil
+		case bufio.ErrBufferFull:
+			line = append(line, chunk...)
+		case io.EOF:
+			return nil, ErrUnexpectedEOF
+		default:
+			return nil, err
+		}
+	}
 }
 
 // Serialize converts the Value back to RESP format.
 func (v Value) Serialize() []byte {
+	return v.AppendTo(nil)
+}
+
+// AppendTo appends the RESP encoding of v to buf and returns the extended buffer.
+// Values are encoded as their own type. It only allocates when buf has to grow,
+// so a buffer reused across replies makes serialization allocation-free.
+func (v Value) AppendTo(buf []byte) []byte {
+	return v.appendProto(buf, 0)
+}
+
+// AppendProto is like AppendTo, but encodes v for a connection speaking the
+// given protocol version. For RESP2, RESP3 types are sent as their RESP2
+// equivalents: maps, sets and pushes as arrays, doubles, big numbers and
+// verbatim strings as bulk strings, booleans as integers and nulls as null
+// bulk strings; attributes are dropped. For RESP3, null bulk strings and
+// null arrays are sent as the RESP3 null.
+func (v Value) AppendProto(buf []byte, proto int) []byte {
+	return v.appendProto(buf, proto)
+}
+
+// appendProto encodes v for protocol version proto, or as-is when proto is 0.
+func (v Value) appendProto(buf []byte, proto int) []byte {
+	if len(v.Attrs) > 0 && proto != RESP2 {
+		buf = appendHeader(buf, TypeAttribute, len(v.Attrs)/2)
+		for i := range v.Attrs {
+			buf = v.Attrs[i].appendProto(buf, proto)
+		}
+	}
+
 	switch v.Type {
-	case TypeSimpleString:
-		return []byte(fmt.Sprintf("+%s\r\n", v.Str))
-	case TypeError:
-		return []byte(fmt.Sprintf("-%s\r\n", v.Str))
+	case TypeSimpleString, TypeError:
+		buf = append(buf, v.Type)
+		buf = append(buf, v.Str...)
+		return append(buf, '\r', '\n')
 	case TypeInteger:
-		return []byte(fmt.Sprintf(":%d\r\n", v.Num))
+		buf = append(buf, TypeInteger)
+		buf = strconv.AppendInt(buf, int64(v.Num), 10)
+		return append(buf, '\r', '\n')
 	case TypeBulkString:
 		if v.Null {
-			return []byte("$-1\r\n")
+			return appendNull(buf, proto, "$-1\r\n")
 		}
-		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(v.Str), v.Str))
+		return appendBulk(buf, TypeBulkString, v.Str)
 	case TypeArray:
 		if v.Null {
-			return []byte("*-1\r\n")
+			return appendNull(buf, proto, "*-1\r\n")
+		}
+		return v.appendElements(buf, TypeArray, len(v.Array), proto)
+	case TypeMap:
+		if proto == RESP2 {
+			return v.appendElements(buf, TypeArray, len(v.Array), proto)
 		}
-		result := []byte(fmt.Sprintf("*%d\r\n", len(v.Array)))
-		for _, elem := range v.Array {
-			result = append(result, elem.Serialize()...)
+		return v.appendElements(buf, TypeMap, len(v.Array)/2, proto)
+	case TypeSet, TypePush:
+		if proto == RESP2 {
+			return v.appendElements(buf, TypeArray, len(v.Array), proto)
 		}
-		return result
+		return v.appendElements(buf, v.Type, len(v.Array), proto)
+	case TypeDouble:
+		if proto == RESP2 {
+			var num [32]byte
+			digits := appendDouble(num[:0], v.Double)
+			buf = appendHeader(buf, TypeBulkString, len(digits))
+			buf = append(buf, digits...)
+			return append(buf, '\r', '\n')
+		}
+		buf = append(buf, TypeDouble)
+		buf = appendDouble(buf, v.Double)
+		return append(buf, '\r', '\n')
+	case TypeBoolean:
+		switch {
+		case proto == RESP2 && v.Bool:
+			return append(buf, ":1\r\n"...)
+		case proto == RESP2:
+			return append(buf, ":0\r\n"...)
+		case v.Bool:
+			return append(buf, "#t\r\n"...)
+		default:
+			return append(buf, "#f\r\n"...)
+		}
+	case TypeNull:
+		if proto == RESP2 {
+			return append(buf, "$-1\r\n"...)
+		}
+		return append(buf, "_\r\n"...)
+	case TypeBigNumber:
+		if proto == RESP2 {
+			return appendBulk(buf, TypeBulkString, v.Str)
+		}
+		buf = append(buf, TypeBigNumber)
+		buf = append(buf, v.Str...)
+		return append(buf, '\r', '\n')
+	case TypeVerbatim:
+		if proto == RESP2 {
+			return appendBulk(buf, TypeBulkString, v.Str)
+		}
+		buf = appendHeader(buf, TypeVerbatim, len(v.Format)+1+len(v.Str))
+		buf = append(buf, v.Format...)
+		buf = append(buf, ':')
+		buf = append(buf, v.Str...)
+		return append(buf, '\r', '\n')
+	default:
+		return buf
+	}
+}
+
+// appendElements appends an aggregate header with count entries, followed by
+// every element of v.Array.
+func (v Value) appendElements(buf []byte, typ byte, count int, proto int) []byte {
+	buf = appendHeader(buf, typ, count)
+	for i := range v.Array {
+		buf = v.Array[i].appendProto(buf, proto)
+	}
+	return buf
+}
+
+// appendHeader appends a type marker followed by a length line, e.g. "$5\r\n".
+func appendHeader(buf []byte, typ byte, n int) []byte {
+	buf = append(buf, typ)
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return append(buf, '\r', '\n')
+}
+
+// appendBulk appends a length-prefixed string such as a bulk string.
+func appendBulk(buf []byte, typ byte, s string) []byte {
+	buf = appendHeader(buf, typ, len(s))
+	buf = append(buf, s...)
+	return append(buf, '\r', '\n')
+}
+
+// appendNull appends the RESP3 null for RESP3 connections, and the given
+// RESP2 null encoding otherwise.
+func appendNull(buf []byte, proto int, resp2 string) []byte {
+	if proto == RESP3 {
+		return append(buf, "_\r\n"...)
+	}
+	return append(buf, resp2...)
+}
+
+// appendDouble formats a double the way RESP3 spells it.
+func appendDouble(buf []byte, f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return append(buf, "inf"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-inf"...)
+	case math.IsNaN(f):
+		return append(buf, "nan"...)
 	default:
-		return nil
+		return strconv.AppendFloat(buf, f, 'g', -1, 64)
 	}
 }
@@ -3,6 +3,8 @@ package resp
 import (
 	"bufio"
 	"bytes"
+	"math"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -614,6 +616,235 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
+func TestParseRESP3(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Value
+		wantErr bool
+	}{
+		{
+			name:  "map",
+			input: "%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n",
+			want: Value{Type: TypeMap, Array: []Value{
+				{Type: TypeSimpleString, Str: "first"}, {Type: TypeInteger, Num: 1},
+				{Type: TypeSimpleString, Str: "second"}, {Type: TypeInteger, Num: 2},
+			}},
+		},
+		{
+			name:  "set",
+			input: "~2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			want:  Value{Type: TypeSet, Array: []Value{{Type: TypeBulkString, Str: "a"}, {Type: TypeBulkString, Str: "b"}}},
+		},
+		{
+			name:  "push",
+			input: ">2\r\n$7\r\nmessage\r\n$2\r\nhi\r\n",
+			want:  Value{Type: TypePush, Array: []Value{{Type: TypeBulkString, Str: "message"}, {Type: TypeBulkString, Str: "hi"}}},
+		},
+		{name: "empty map", input: "%0\r\n", want: Value{Type: TypeMap, Array: []Value{}}},
+		{name: "double", input: ",3.25\r\n", want: Value{Type: TypeDouble, Double: 3.25}},
+		{name: "double exponent", input: ",1.5e3\r\n", want: Value{Type: TypeDouble, Double: 1500}},
+		{name: "double inf", input: ",inf\r\n", want: Value{Type: TypeDouble, Double: math.Inf(1)}},
+		{name: "double negative inf", input: ",-inf\r\n", want: Value{Type: TypeDouble, Double: math.Inf(-1)}},
+		{name: "boolean true", input: "#t\r\n", want: Value{Type: TypeBoolean, Bool: true}},
+		{name: "boolean false", input: "#f\r\n", want: Value{Type: TypeBoolean}},
+		{name: "null", input: "_\r\n", want: Value{Type: TypeNull, Null: true}},
+		{name: "big number", input: "(-3492890328409238509324850943850943825024385\r\n", want: Value{Type: TypeBigNumber, Str: "-3492890328409238509324850943850943825024385"}},
+		{name: "verbatim", input: "=15\r\ntxt:Some string\r\n", want: Value{Type: TypeVerbatim, Format: "txt", Str: "Some string"}},
+		{
+			name:  "attribute",
+			input: "|1\r\n+ttl\r\n:3600\r\n$5\r\nvalue\r\n",
+			want: Value{Type: TypeBulkString, Str: "value", Attrs: []Value{
+				{Type: TypeSimpleString, Str: "ttl"}, {Type: TypeInteger, Num: 3600},
+			}},
+		},
+		{name: "invalid double", input: ",abc\r\n", wantErr: true},
+		{name: "invalid boolean", input: "#x\r\n", wantErr: true},
+		{name: "null with content", input: "_x\r\n", wantErr: true},
+		{name: "invalid big number", input: "(12a\r\n", wantErr: true},
+		{name: "verbatim without format", input: "=3\r\ntxt\r\n", wantErr: true},
+		{name: "negative map length", input: "%-1\r\n", wantErr: true},
+		{name: "truncated map", input: "%1\r\n+key\r\n", wantErr: true},
+		{name: "attribute without value", input: "|1\r\n+a\r\n+b\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTripRESP3(t *testing.T) {
+	inputs := []string{
+		"%1\r\n$3\r\nkey\r\n~1\r\n:1\r\n",
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n",
+		",1.5\r\n",
+		",-inf\r\n",
+		",nan\r\n",
+		"#t\r\n",
+		"_\r\n",
+		"(123456789012345678901234567890\r\n",
+		"=15\r\ntxt:Some string\r\n",
+		"|1\r\n+key\r\n+value\r\n:7\r\n",
+	}
+
+	for _, input := range inputs {
+		parsed, err := Parse(bufio.NewReader(strings.NewReader(input)))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", input, err)
+		}
+		if got := string(parsed.Serialize()); got != input {
+			t.Errorf("RoundTrip() got %q, want %q", got, input)
+		}
+	}
+}
+
+func TestAppendProto(t *testing.T) {
+	tests := []struct {
+		name  string
+		value Value
+		resp2 string
+		resp3 string
+	}{
+		{
+			name:  "map",
+			value: Value{Type: TypeMap, Array: []Value{{Type: TypeBulkString, Str: "f"}, {Type: TypeBulkString, Str: "v"}}},
+			resp2: "*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+			resp3: "%1\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name:  "set",
+			value: Value{Type: TypeSet, Array: []Value{{Type: TypeBulkString, Str: "a"}}},
+			resp2: "*1\r\n$1\r\na\r\n",
+			resp3: "~1\r\n$1\r\na\r\n",
+		},
+		{
+			name:  "push",
+			value: Value{Type: TypePush, Array: []Value{{Type: TypeInteger, Num: 1}}},
+			resp2: "*1\r\n:1\r\n",
+			resp3: ">1\r\n:1\r\n",
+		},
+		{name: "double", value: Value{Type: TypeDouble, Double: 2.5}, resp2: "$3\r\n2.5\r\n", resp3: ",2.5\r\n"},
+		{name: "boolean", value: Value{Type: TypeBoolean, Bool: true}, resp2: ":1\r\n", resp3: "#t\r\n"},
+		{name: "null", value: Value{Type: TypeNull, Null: true}, resp2: "$-1\r\n", resp3: "_\r\n"},
+		{name: "null bulk string", value: Value{Type: TypeBulkString, Null: true}, resp2: "$-1\r\n", resp3: "_\r\n"},
+		{name: "null array", value: Value{Type: TypeArray, Null: true}, resp2: "*-1\r\n", resp3: "_\r\n"},
+		{name: "big number", value: Value{Type: TypeBigNumber, Str: "12345"}, resp2: "$5\r\n12345\r\n", resp3: "(12345\r\n"},
+		{name: "verbatim", value: Value{Type: TypeVerbatim, Format: "txt", Str: "hi"}, resp2: "$2\r\nhi\r\n", resp3: "=6\r\ntxt:hi\r\n"},
+		{
+			name:  "attribute",
+			value: Value{Type: TypeInteger, Num: 1, Attrs: []Value{{Type: TypeSimpleString, Str: "a"}, {Type: TypeSimpleString, Str: "b"}}},
+			resp2: ":1\r\n",
+			resp3: "|1\r\n+a\r\n+b\r\n:1\r\n",
+		},
+		{
+			name:  "nested",
+			value: Value{Type: TypeArray, Array: []Value{{Type: TypeMap, Array: []Value{{Type: TypeSimpleString, Str: "k"}, {Type: TypeNull, Null: true}}}}},
+			resp2: "*1\r\n*2\r\n+k\r\n$-1\r\n",
+			resp3: "*1\r\n%1\r\n+k\r\n_\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.value.AppendProto(nil, RESP2)); got != tt.resp2 {
+				t.Errorf("AppendProto(RESP2) = %q, want %q", got, tt.resp2)
+			}
+			if got := string(tt.value.AppendProto(nil, RESP3)); got != tt.resp3 {
+				t.Errorf("AppendProto(RESP3) = %q, want %q", got, tt.resp3)
+			}
+		})
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	values := []Value{
+		{Type: TypeSimpleString, Str: "OK"},
+		{Type: TypeError, Str: "ERR oops"},
+		{Type: TypeInteger, Num: -42},
+		{Type: TypeBulkString, Str: "hello"},
+		{Type: TypeBulkString, Null: true},
+		{Type: TypeArray, Null: true},
+		{Type: TypeArray, Array: []Value{
+			{Type: TypeBulkString, Str: "a"},
+			{Type: TypeArray, Array: []Value{{Type: TypeInteger, Num: 1}}},
+		}},
+	}
+
+	// Values are appended after whatever the buffer already holds
+	buf := []byte("prefix")
+	want := "prefix"
+	for _, v := range values {
+		buf = v.AppendTo(buf)
+		want += string(v.Serialize())
+	}
+	if string(buf) != want {
+		t.Errorf("AppendTo() = %q, want %q", buf, want)
+	}
+}
+
+func TestAppendToDoesNotAllocate(t *testing.T) {
+	v := Value{Type: TypeArray, Array: []Value{
+		{Type: TypeBulkString, Str: "message"},
+		{Type: TypeBulkString, Str: "channel"},
+		{Type: TypeInteger, Num: 12345},
+		{Type: TypeBulkString, Null: true},
+	}}
+
+	buf := make([]byte, 0, 128)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = v.AppendTo(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("AppendTo() allocated %v times per run, want 0", allocs)
+	}
+}
+
+func BenchmarkAppendTo(b *testing.B) {
+	v := Value{Type: TypeArray, Array: []Value{
+		{Type: TypeBulkString, Str: "value"},
+		{Type: TypeInteger, Num: 1000},
+	}}
+
+	buf := make([]byte, 0, 128)
+	b.ReportAllocs()
+	for b.Loop() {
+		buf = v.AppendTo(buf[:0])
+	}
+}
+
+// FuzzParse checks that arbitrary input never panics or exceeds the limits,
+// and that anything accepted serializes back to input that parses the same way.
+// Seeds live in testdata/fuzz/FuzzParse.
+func FuzzParse(f *testing.F) {
+	f.Add([]byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"))
+	f.Add([]byte("%1\r\n+key\r\n,3.14\r\n"))
+
+	limits := Limits{MaxBulkLen: 1024, MaxMultibulkLen: 64, MaxDepth: 8, MaxInlineLen: 256}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := ParseWithLimits(bufio.NewReader(bytes.NewReader(data)), limits)
+		if err != nil {
+			return
+		}
+
+		encoded := v.Serialize()
+		reparsed, err := ParseWithLimits(bufio.NewReader(bytes.NewReader(encoded)), limits)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed on serialized value %q: %v", data, encoded, err)
+		}
+		if again := reparsed.Serialize(); !bytes.Equal(again, encoded) {
+			t.Fatalf("Parse(%q) round trip = %q, want %q", data, again, encoded)
+		}
+	})
+}
+
 // compareArrays recursively compares two slices of Value
 func compareArrays(a, b []Value) bool {
 	if len(a) != len(b) {
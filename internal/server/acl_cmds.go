@@ -0,0 +1,162 @@
+// Package server contains ACL command handlers for the Redis server.
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// checkACL checks that the client's user may run cmd with args.
+// Refusals are recorded in the ACL log and returned as a NOPERM reply.
+func (s *Server) checkACL(c *client, cmd string, args []resp.Value) (resp.Value, bool) {
+	denial := s.acl.Check(c.user, cmd, argStrings(args))
+	if denial == nil {
+		return resp.Value{}, true
+	}
+
+	context := "toplevel"
+	if c.inExec {
+		context = "multi"
+	}
+	s.acl.Log().Add(denial.Reason, context, denial.Object, c.user, c.info())
+	return respError(denial.Message(c.user)), false
+}
+
+// handleACL handles the ACL command.
+// ACL SETUSER username [rule ...] | GETUSER username | DELUSER username [username ...]
+// | LIST | WHOAMI | CAT [category] | LOG [count | RESET]
+func (s *Server) handleACL(c *client, args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return respError("ERR wrong number of arguments for 'acl' command")
+	}
+
+	name := args[0].Str
+	sub := strings.ToUpper(name)
+	args = args[1:]
+	wrongArgs := respError(fmt.Sprintf("ERR wrong number of arguments for 'acl|%s' command", strings.ToLower(sub)))
+
+	switch sub {
+	case "SETUSER":
+		if len(args) < 1 {
+			return wrongArgs
+		}
+		if err := s.acl.SetUser(args[0].Str, argStrings(args[1:])...); err != nil {
+			return respError("ERR " + err.Error())
+		}
+		return respSimpleString("OK")
+
+	case "GETUSER":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		u, ok := s.acl.User(args[0].Str)
+		if !ok {
+			return respNullBulkString()
+		}
+		return resp.Value{Type: resp.TypeMap, Array: []resp.Value{
+			respBulkString("flags"), bulkStringArray(u.Flags()),
+			respBulkString("passwords"), bulkStringArray(u.Passwords()),
+			respBulkString("commands"), respBulkString(u.CommandRules()),
+			respBulkString("keys"), respBulkString(u.KeyRules()),
+			respBulkString("channels"), respBulkString(u.ChannelRules()),
+			respBulkString("selectors"), {Type: resp.TypeArray, Array: []resp.Value{}},
+		}}
+
+	case "DELUSER":
+		if len(args) < 1 {
+			return wrongArgs
+		}
+		deleted, err := s.acl.DelUser(argStrings(args)...)
+		if err != nil {
+			return respError("ERR " + err.Error())
+		}
+		return respInteger(deleted)
+
+	case "LIST":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return bulkStringArray(s.acl.List())
+
+	case "WHOAMI":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return respBulkString(c.user)
+
+	case "CAT":
+		switch len(args) {
+		case 0:
+			return bulkStringArray(acl.Categories)
+		case 1:
+			names, ok := acl.CommandsInCategory(strings.ToLower(args[0].Str))
+			if !ok {
+				return respError(fmt.Sprintf("ERR Unknown category '%s'", args[0].Str))
+			}
+			return bulkStringArray(names)
+		default:
+			return wrongArgs
+		}
+
+	case "LOG":
+		return s.handleACLLog(args)
+
+	default:
+		return respError(fmt.Sprintf("ERR unknown subcommand '%s'. Try ACL HELP.", name))
+	}
+}
+
+// handleACLLog handles ACL LOG [count | RESET].
+// Entries are returned newest first, 10 by default.
+func (s *Server) handleACLLog(args []resp.Value) resp.Value {
+	count := 10
+	switch {
+	case len(args) > 1:
+		return respError("ERR wrong number of arguments for 'acl|log' command")
+	case len(args) == 1 && strings.EqualFold(args[0].Str, "RESET"):
+		s.acl.Log().Reset()
+		return respSimpleString("OK")
+	case len(args) == 1:
+		n, err := strconv.Atoi(args[0].Str)
+		if err != nil {
+			return respError("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			return respError("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	now := time.Now()
+	entries := s.acl.Log().Entries(count)
+	result := make([]resp.Value, len(entries))
+	for i, e := range entries {
+		result[i] = resp.Value{Type: resp.TypeMap, Array: []resp.Value{
+			respBulkString("count"), respInteger(e.Count),
+			respBulkString("reason"), respBulkString(e.Reason),
+			respBulkString("context"), respBulkString(e.Context),
+			respBulkString("object"), respBulkString(e.Object),
+			respBulkString("username"), respBulkString(e.Username),
+			respBulkString("age-seconds"), {Type: resp.TypeDouble, Double: now.Sub(e.Created).Seconds()},
+			respBulkString("client-info"), respBulkString(e.ClientInfo),
+			respBulkString("entry-id"), respInteger(int(e.ID)),
+			respBulkString("timestamp-created"), respInteger(int(e.Created.UnixMilli())),
+			respBulkString("timestamp-last-updated"), respInteger(int(e.Updated.UnixMilli())),
+		}}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: result}
+}
+
+// bulkStringArray converts strings to an array of bulk strings.
+func bulkStringArray(strs []string) resp.Value {
+	array := make([]resp.Value, len(strs))
+	for i, s := range strs {
+		array[i] = respBulkString(s)
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// dialAs connects and authenticates as the given user.
+func dialAs(t *testing.T, addr, user, password string) *pubsubConn {
+	t.Helper()
+	c := dialPubSub(t, addr)
+	c.send(t, "AUTH", user, password)
+	if got := c.read(t); got.Str != "OK" {
+		t.Fatalf("AUTH %s = %v, want OK", user, got)
+	}
+	return c
+}
+
+func TestACLPermissions(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+	admin := dial(t, addr)
+
+	if got := sendCommand(t, admin, "ACL", "SETUSER", "alice", "on", ">pw", "~app:*", "&news.*", "+@read", "+set", "+@pubsub", "+multi", "+exec", "+blpop"); got.Str != "OK" {
+		t.Fatalf("ACL SETUSER = %v, want OK", got)
+	}
+	alice := dialAs(t, addr, "alice", "pw")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SET", "app:1", "v"}, "OK"},
+		{[]string{"GET", "app:1"}, "v"},
+		{[]string{"GET", "other"}, "NOPERM No permissions to access a key"},
+		{[]string{"DEL", "app:1"}, "NOPERM User alice has no permissions to run the 'del' command"},
+		{[]string{"ACL", "WHOAMI"}, "NOPERM User alice has no permissions to run the 'acl' command"},
+		{[]string{"PUBLISH", "sport", "hi"}, "NOPERM No permissions to access a channel"},
+		{[]string{"SUBSCRIBE", "sport"}, "NOPERM No permissions to access a channel"},
+		{[]string{"BLPOP", "other", "0"}, "NOPERM No permissions to access a key"},
+		{[]string{"PUBLISH", "news.tech", "hi"}, ""},
+	}
+	for _, tt := range tests {
+		alice.send(t, tt.args...)
+		got := alice.read(t)
+		if tt.want == "" {
+			if got.Type == resp.TypeError {
+				t.Errorf("%v = %v, want success", tt.args, got)
+			}
+			continue
+		}
+		if got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	// Denials are checked when commands are queued
+	alice.send(t, "MULTI")
+	alice.read(t)
+	alice.send(t, "GET", "other")
+	if got := alice.read(t); got.Str != "NOPERM No permissions to access a key" {
+		t.Errorf("queued GET other = %v, want NOPERM", got)
+	}
+	alice.send(t, "GET", "app:1")
+	alice.read(t)
+
+	// ...and again when EXEC runs them
+	sendCommand(t, admin, "ACL", "SETUSER", "alice", "-get")
+	alice.send(t, "EXEC")
+	got := alice.read(t)
+	if len(got.Array) != 1 || got.Array[0].Str != "NOPERM User alice has no permissions to run the 'get' command" {
+		t.Errorf("EXEC = %v, want NOPERM for GET", got)
+	}
+
+	log := sendCommand(t, admin, "ACL", "LOG", "1")
+	if len(log.Array) != 1 {
+		t.Fatalf("ACL LOG 1 = %v, want one entry", log)
+	}
+	entry := mapReply(log.Array[0])
+	if entry["reason"].Str != "command" || entry["context"].Str != "multi" || entry["object"].Str != "get" || entry["username"].Str != "alice" {
+		t.Errorf("ACL LOG entry = %v, want get denied in multi", log.Array[0])
+	}
+}
+
+func TestACLLog(t *testing.T) {
+	_, addr := startTestServer(t)
+	admin := dial(t, addr)
+
+	sendCommand(t, admin, "ACL", "SETUSER", "bob", "on", ">pw", "~*", "+get")
+	bob := dialAs(t, addr, "bob", "pw")
+	for i := 0; i < 3; i++ {
+		bob.send(t, "SET", "k", "v")
+		bob.read(t)
+	}
+	sendCommand(t, dial(t, addr), "AUTH", "bob", "wrong")
+
+	log := sendCommand(t, admin, "ACL", "LOG")
+	if len(log.Array) != 2 {
+		t.Fatalf("ACL LOG = %v, want two entries", log)
+	}
+	auth, denied := mapReply(log.Array[0]), mapReply(log.Array[1])
+	if auth["reason"].Str != "auth" || auth["object"].Str != "AUTH" || auth["username"].Str != "bob" {
+		t.Errorf("newest entry = %v, want failed AUTH", log.Array[0])
+	}
+	if denied["reason"].Str != "command" || denied["object"].Str != "set" || denied["count"].Num != 3 || denied["context"].Str != "toplevel" {
+		t.Errorf("oldest entry = %v, want SET denied 3 times", log.Array[1])
+	}
+	for _, field := range []string{"age-seconds", "client-info", "entry-id", "timestamp-created", "timestamp-last-updated"} {
+		if _, ok := denied[field]; !ok {
+			t.Errorf("entry has no %s field", field)
+		}
+	}
+
+	if got := sendCommand(t, admin, "ACL", "LOG", "RESET"); got.Str != "OK" {
+		t.Errorf("ACL LOG RESET = %v, want OK", got)
+	}
+	if got := sendCommand(t, admin, "ACL", "LOG"); len(got.Array) != 0 {
+		t.Errorf("ACL LOG after RESET = %v, want empty", got)
+	}
+	if got := sendCommand(t, admin, "ACL", "LOG", "-1"); got.Str != "ERR value is out of range, must be positive" {
+		t.Errorf("ACL LOG -1 = %v", got)
+	}
+}
+
+func TestACLUserManagement(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "ACL", "WHOAMI"); got.Str != "default" {
+		t.Errorf("ACL WHOAMI = %v, want default", got)
+	}
+
+	sendCommand(t, conn, "ACL", "SETUSER", "carol", "on", "nopass", "~cache:*", "+@read", "-keys")
+	user := mapReply(sendCommand(t, conn, "ACL", "GETUSER", "carol"))
+	if len(user["flags"].Array) != 2 || user["flags"].Array[0].Str != "on" || user["flags"].Array[1].Str != "nopass" {
+		t.Errorf("GETUSER flags = %v, want [on nopass]", user["flags"])
+	}
+	if user["commands"].Str != "-@all +@read -keys" || user["keys"].Str != "~cache:*" || user["channels"].Str != "" {
+		t.Errorf("GETUSER = %v", user)
+	}
+	if got := sendCommand(t, conn, "ACL", "GETUSER", "nobody"); !got.Null {
+		t.Errorf("GETUSER nobody = %v, want null", got)
+	}
+
+	list := sendCommand(t, conn, "ACL", "LIST")
+	if len(list.Array) != 2 || list.Array[0].Str != "user carol on nopass ~cache:* resetchannels -@all +@read -keys" {
+		t.Errorf("ACL LIST = %v", list)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ACL", "SETUSER", "carol", "+bogus"}, "ERR Error in ACL SETUSER modifier '+bogus': Unknown command or category name in ACL"},
+		{[]string{"ACL", "DELUSER", "default"}, "ERR The 'default' user cannot be removed"},
+		{[]string{"ACL", "CAT", "bogus"}, "ERR Unknown category 'bogus'"},
+		{[]string{"ACL", "BOGUS"}, "ERR unknown subcommand 'BOGUS'. Try ACL HELP."},
+		{[]string{"ACL", "GETUSER"}, "ERR wrong number of arguments for 'acl|getuser' command"},
+		{[]string{"ACL"}, "ERR wrong number of arguments for 'acl' command"},
+	}
+	for _, tt := range tests {
+		if got := sendCommand(t, conn, tt.args...); got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	if got := sendCommand(t, conn, "ACL", "CAT"); len(got.Array) != 21 {
+		t.Errorf("ACL CAT returned %d categories, want 21", len(got.Array))
+	}
+	if got := sendCommand(t, conn, "ACL", "CAT", "transaction"); len(got.Array) != 5 {
+		t.Errorf("ACL CAT transaction = %v, want 5 commands", got)
+	}
+
+	if got := sendCommand(t, conn, "ACL", "DELUSER", "carol", "nobody"); got.Num != 1 {
+		t.Errorf("ACL DELUSER = %v, want 1", got)
+	}
+	// A deleted user can no longer authenticate
+	if got := sendCommand(t, conn, "AUTH", "carol", "x"); got.Type != resp.TypeError {
+		t.Errorf("AUTH as deleted user = %v, want error", got)
+	}
+}
+
+func TestACLFileAndRequirePass(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	content := "user reader on >readpw ~* +@read\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write ACL file: %v", err)
+	}
+
+	_, addr := startTestServerWithConfig(t, Config{RequirePass: "adminpw", ACLFile: path})
+
+	reader := dialAs(t, addr, "reader", "readpw")
+	reader.send(t, "ACL", "WHOAMI")
+	if got := reader.read(t); got.Type != resp.TypeError {
+		t.Errorf("reader ACL WHOAMI = %v, want NOPERM", got)
+	}
+	reader.send(t, "GET", "k")
+	if got := reader.read(t); got.Type == resp.TypeError {
+		t.Errorf("reader GET = %v, want success", got)
+	}
+
+	// The file doesn't define the default user, so requirepass still applies
+	conn := dial(t, addr)
+	if got := sendCommand(t, conn, "GET", "k"); got.Str != "NOAUTH Authentication required." {
+		t.Errorf("GET without AUTH = %v, want NOAUTH", got)
+	}
+	if got := sendCommand(t, conn, "AUTH", "adminpw"); got.Str != "OK" {
+		t.Errorf("AUTH adminpw = %v, want OK", got)
+	}
+}
+
+func TestACLFileErrorFailsStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	if err := os.WriteFile(path, []byte("user x +nosuchcommand\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write ACL file: %v", err)
+	}
+
+	srv := createTestServer(t)
+	srv.config.ACLFile = path
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Fatal("Start() succeeded with an invalid ACL file")
+	}
+}
@@ -0,0 +1,262 @@
+// Package server contains the append-only file integration: logging write
+// commands as they run and replaying them at startup.
+package server
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// AOFConfig configures the append-only file.
+type AOFConfig struct {
+	Path  string
+	Fsync persistence.FsyncPolicy
+	// LoadTruncated, when set, cuts an incomplete command off the end of the
+	// file at startup instead of refusing to start.
+	LoadTruncated bool
+}
+
+// loadAOF replays the append-only file, then opens it to log new writes.
+func (s *Server) loadAOF() error {
+	cfg := s.config.AOF
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	// As in Redis, replies are ignored: only commands that succeeded were
+	// logged, and replaying them rebuilds the same dataset
+	replay, err := persistence.ReplayAOF(cfg.Path, cfg.LoadTruncated, func(args []string) error {
+		if !acl.IsCommand(strings.ToLower(args[0])) {
+			return fmt.Errorf("unknown command '%s'", args[0])
+		}
+		_, _ = s.executeQueued(nil, args[0], args[1:])
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load append-only file: %w", err)
+	}
+	if replay.TruncatedBytes > 0 {
+		log.Printf("Warning: truncated the last %d bytes of the append-only file, an incomplete command", replay.TruncatedBytes)
+	}
+	log.Printf("Replayed %d commands from the append-only file", replay.Commands)
+	if s.persistenceHandler != nil {
+		// As after loading a snapshot, the data loaded doesn't count as changed
+		s.persistenceHandler.manager.SetChangeCounter(s.keyspace.Versions().Changes)
+	}
+
+	s.aof, err = persistence.OpenAOF(cfg.Path, cfg.Fsync)
+	return err
+}
+
+// closeAOF syncs and closes the append-only file, if open.
+func (s *Server) closeAOF() {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	if s.aof == nil {
+		return
+	}
+	if err := s.aof.Close(); err != nil {
+		log.Printf("Error closing append-only file: %v", err)
+	}
+	s.aof = nil
+}
+
+// feedAOF logs a command c ran, given its reply, if it may have changed the
+// dataset. Inside EXEC the records are held until the transaction ends. The
+// caller holds execMu.
+func (s *Server) feedAOF(c *client, cmd string, args []resp.Value, reply resp.Value) error {
+	if s.aof == nil || reply.Type == resp.TypeError || !acl.IsWriteCommand(strings.ToLower(cmd)) {
+		return nil
+	}
+	records := s.aofRecords(cmd, argStrings(args), reply)
+	if len(records) == 0 {
+		return nil
+	}
+	if c != nil && c.inExec {
+		s.aofTx = append(s.aofTx, records...)
+		return nil
+	}
+	return s.appendAOF(records)
+}
+
+// flushAOFTransaction logs the records held while EXEC ran.
+func (s *Server) flushAOFTransaction() error {
+	if len(s.aofTx) == 0 {
+		return nil
+	}
+	records := s.aofTx
+	s.aofTx = nil
+	return s.appendAOF(records)
+}
+
+// appendAOF writes records to the append-only file, wrapped in MULTI/EXEC
+// if there are several so they are replayed all or nothing.
+func (s *Server) appendAOF(records [][]string) error {
+	if len(records) > 1 {
+		records = append(append([][]string{{"MULTI"}}, records...), []string{"EXEC"})
+	}
+	s.aofLastWriteErr = s.aof.Append(records...)
+	if s.aofLastWriteErr != nil {
+		log.Printf("Error writing to append-only file: %v", s.aofLastWriteErr)
+	}
+	return s.aofLastWriteErr
+}
+
+// aofWriteError returns the reply to a command whose records couldn't be
+// written to the append-only file. The command has run, but as in Redis the
+// client is told the write may not survive a restart.
+func aofWriteError(err error) resp.Value {
+	return respError("MISCONF Errors writing to the AOF file: " + err.Error())
+}
+
+// checkAOFWritable reports whether cmd may run. As in Redis, write commands
+// are refused while the last append failed, until the records it left are
+// written. The caller holds execMu.
+func (s *Server) checkAOFWritable(cmd string) (resp.Value, bool) {
+	if s.aof == nil || s.aofLastWriteErr == nil || !acl.IsWriteCommand(strings.ToLower(cmd)) {
+		return resp.Value{}, true
+	}
+	if s.aofLastWriteErr = s.aof.Retry(); s.aofLastWriteErr != nil {
+		return aofWriteError(s.aofLastWriteErr), false
+	}
+	return resp.Value{}, true
+}
+
+// aofRecords returns the commands to log for a write command, given its
+// reply. Commands whose effect depends on when or how they ran are rewritten
+// so replaying them gives the same result: relative expiry times become
+// absolute, blocking commands become their non-blocking forms and generated
+// stream IDs are made explicit.
+func (s *Server) aofRecords(cmd string, args []string, reply resp.Value) [][]string {
+	switch cmd {
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		if reply.Num != 1 {
+			return nil
+		}
+		return [][]string{s.aofExpiry(args[0])}
+
+	case "SET":
+		if len(args) > 2 {
+			return [][]string{{"SET", args[0], args[1]}, s.aofExpiry(args[0])}
+		}
+
+	case "BLPOP", "BRPOP":
+		if reply.Null || len(reply.Array) != 2 {
+			return nil
+		}
+		return [][]string{{cmd[1:], reply.Array[0].Str}}
+
+	case "BLMOVE":
+		if reply.Null {
+			return nil
+		}
+		return [][]string{append([]string{"LMOVE"}, args[:4]...)}
+
+	case "BLMPOP":
+		// BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+		if reply.Null || len(reply.Array) != 2 {
+			return nil
+		}
+		numKeys, _ := strconv.Atoi(args[1])
+		return [][]string{{"LMPOP", "1", reply.Array[0].Str, args[2+numKeys], "COUNT", strconv.Itoa(len(reply.Array[1].Array))}}
+
+	case "XADD":
+		if reply.Null {
+			return nil
+		}
+		record := append([]string{cmd}, args...)
+		record[xaddIDIndex(args)+1] = reply.Str
+		return [][]string{record}
+
+	case "XCLAIM":
+		// XCLAIM key group consumer min-idle-time id [id ...] [options]
+		// Only the entries claimed are claimed again, whatever their idle time
+		ids := claimedIDs(reply.Array)
+		if len(ids) == 0 {
+			return nil
+		}
+		end := 4
+		for end < len(args) {
+			if _, ok := parseStreamID(args[end], 0); !ok {
+				break
+			}
+			end++
+		}
+		record := append([]string{cmd, args[0], args[1], args[2], "0"}, ids...)
+		return [][]string{append(record, args[end:]...)}
+
+	case "XAUTOCLAIM":
+		// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+		if len(reply.Array) != 3 {
+			return nil
+		}
+		var records [][]string
+		if ids := claimedIDs(reply.Array[1].Array); len(ids) > 0 {
+			record := append([]string{"XCLAIM", args[0], args[1], args[2], "0"}, ids...)
+			for _, arg := range args[5:] {
+				if strings.EqualFold(arg, "JUSTID") {
+					record = append(record, "JUSTID")
+				}
+			}
+			records = append(records, record)
+		}
+		// Entries deleted from the stream were dropped from the pending list
+		if deleted := claimedIDs(reply.Array[2].Array); len(deleted) > 0 {
+			records = append(records, append([]string{"XACK", args[0], args[1]}, deleted...))
+		}
+		return records
+	}
+	return [][]string{append([]string{cmd}, args...)}
+}
+
+// aofExpiry returns the record setting key's expiry to its absolute time,
+// or deleting it if an expiry in the past removed it.
+func (s *Server) aofExpiry(key string) []string {
+	at, ok := s.keyspace.ExpiresAt(key)
+	if !ok {
+		return []string{"DEL", key}
+	}
+	return []string{"PEXPIREAT", key, strconv.FormatInt(at.UnixMilli(), 10)}
+}
+
+// xaddIDIndex returns the index of the entry ID in XADD's arguments, after
+// the key and any NOMKSTREAM and trimming options.
+func xaddIDIndex(args []string) int {
+	i := 1
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			i++
+		case "MAXLEN", "MINID":
+			_, next, err := parseStreamTrim(bulkStringArray(args).Array, i)
+			if err != nil {
+				return i
+			}
+			i = next
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// claimedIDs returns the IDs of claimed entries, given as IDs (JUSTID) or as
+// entries.
+func claimedIDs(values []resp.Value) []string {
+	ids := make([]string, 0, len(values))
+	for _, v := range values {
+		switch {
+		case v.Null:
+		case v.Type == resp.TypeArray && len(v.Array) > 0:
+			ids = append(ids, v.Array[0].Str)
+		case v.Type == resp.TypeBulkString:
+			ids = append(ids, v.Str)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// startAOFServer starts a server with empty stores that logs to the
+// append-only file at path, after replaying it.
+func startAOFServer(t *testing.T, path string) (*Server, string) {
+	t.Helper()
+	return startTestServerWithConfig(t, Config{Port: 0, AOF: &AOFConfig{Path: path, Fsync: persistence.FsyncAlways, LoadTruncated: true}})
+}
+
+// aofCommands returns every command in the append-only file at path,
+// including MULTI and EXEC.
+func aofCommands(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open append-only file: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var commands [][]string
+	reader := bufio.NewReader(file)
+	for {
+		v, err := resp.Parse(reader)
+		if errors.Is(err, resp.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return commands
+		}
+		if err != nil {
+			t.Fatalf("Failed to parse append-only file: %v", err)
+		}
+		commands = append(commands, argStrings(v.Array))
+	}
+}
+
+// replyString formats a reply compactly, arrays as [a b c].
+func replyString(v resp.Value) string {
+	switch v.Type {
+	case resp.TypeArray:
+		parts := make([]string, len(v.Array))
+		for i, elem := range v.Array {
+			parts[i] = replyString(elem)
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	case resp.TypeInteger:
+		return strconv.Itoa(v.Num)
+	}
+	return v.Str
+}
+
+func TestAOFRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	srv, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+	for _, cmd := range [][]string{
+		{"SET", "str", "v"},
+		{"SET", "ttl", "v", "EX", "100"},
+		{"SET", "gone", "v"},
+		{"PEXPIRE", "gone", "-1"},
+		{"RPUSH", "list", "a", "b", "c"},
+		{"LPOP", "list"},
+		{"HSET", "hash", "f", "v"},
+		{"SADD", "set", "m"},
+		{"ZADD", "zset", "1", "m"},
+		{"XADD", "stream", "*", "f", "v"},
+		{"XGROUP", "CREATE", "stream", "group", "0"},
+		{"XREADGROUP", "GROUP", "group", "alice", "STREAMS", "stream", ">"},
+		{"LPUSH", "str", "x"}, // WRONGTYPE, so not logged
+	} {
+		sendCommand(t, conn, cmd...)
+	}
+	id := sendCommand(t, conn, "XRANGE", "stream", "-", "+").Array[0].Array[0].Str
+	_ = conn.Close()
+	srv.Stop()
+
+	_, addr = startAOFServer(t, path)
+	conn = dial(t, addr)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"GET", "str"}, "v"},
+		{[]string{"EXISTS", "gone"}, "0"},
+		{[]string{"LRANGE", "list", "0", "-1"}, "[b c]"},
+		{[]string{"HGET", "hash", "f"}, "v"},
+		{[]string{"SISMEMBER", "set", "m"}, "1"},
+		{[]string{"ZSCORE", "zset", "m"}, "1"},
+		{[]string{"XPENDING", "stream", "group"}, "[1 " + id + " " + id + " [[alice 1]]]"},
+	}
+	for _, tt := range tests {
+		if got := replyString(sendCommand(t, conn, tt.args...)); got != tt.want {
+			t.Errorf("%v after restart = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+	if ttl := sendCommand(t, conn, "TTL", "ttl"); ttl.Num < 99 || ttl.Num > 100 {
+		t.Errorf("TTL after restart = %d, want about 100", ttl.Num)
+	}
+}
+
+func TestAOFRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	srv, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "SET", "k", "v", "EX", "100")
+	at, _ := srv.keyspace.ExpiresAt("k")
+	sendCommand(t, conn, "GET", "k")
+	sendCommand(t, conn, "EXPIRE", "missing", "10")
+	sendCommand(t, conn, "EXPIRE", "k", "0")
+	id := sendCommand(t, conn, "XADD", "s", "MAXLEN", "~", "10", "*", "f", "v").Str
+	sendCommand(t, conn, "XADD", "s", "NOMKSTREAM", "1-1", "f", "v") // Fails, as the ID is too small
+
+	want := [][]string{
+		{"MULTI"}, {"SET", "k", "v"}, {"PEXPIREAT", "k", strconv.FormatInt(at.UnixMilli(), 10)}, {"EXEC"},
+		{"DEL", "k"},
+		{"XADD", "s", "MAXLEN", "~", "10", id, "f", "v"},
+	}
+	if got := aofCommands(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("append-only file = %v, want %v", got, want)
+	}
+}
+
+func TestAOFBlockingCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	srv, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+	blocked := dial(t, addr)
+
+	replies := sendAsync(blocked, "BLPOP", "nothing", "queue", "0")
+	waitForBlocked(t, srv, "queue", 1)
+	sendCommand(t, conn, "RPUSH", "queue", "a", "b", "c")
+	receive(t, replies)
+	sendCommand(t, blocked, "BLMPOP", "0", "2", "nothing", "queue", "RIGHT", "COUNT", "5")
+	sendCommand(t, blocked, "BRPOP", "nothing", "0.01") // Times out
+
+	want := [][]string{
+		{"RPUSH", "queue", "a", "b", "c"},
+		{"LPOP", "queue"},
+		{"LMPOP", "1", "queue", "RIGHT", "COUNT", "2"},
+	}
+	if got := aofCommands(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("append-only file = %v, want %v", got, want)
+	}
+}
+
+func TestAOFTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	_, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "SET", "a", "1")
+	sendCommand(t, conn, "GET", "a")
+	sendCommand(t, conn, "RPUSH", "a", "x") // WRONGTYPE when run
+	sendCommand(t, conn, "SET", "b", "2")
+	sendCommand(t, conn, "EXEC")
+
+	want := [][]string{{"MULTI"}, {"SET", "a", "1"}, {"SET", "b", "2"}, {"EXEC"}}
+	if got := aofCommands(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("append-only file = %v, want %v", got, want)
+	}
+}
+
+func TestAOFStreamClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	_, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "XADD", "s", "1-1", "f", "v")
+	sendCommand(t, conn, "XADD", "s", "2-1", "f", "v")
+	sendCommand(t, conn, "XGROUP", "CREATE", "s", "g", "0")
+	sendCommand(t, conn, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	sendCommand(t, conn, "XDEL", "s", "2-1")
+	sendCommand(t, conn, "XCLAIM", "s", "g", "bob", "0", "1-1", "9-9", "RETRYCOUNT", "5")
+	sendCommand(t, conn, "XAUTOCLAIM", "s", "g", "carol", "0", "0", "JUSTID")
+	sendCommand(t, conn, "XCLAIM", "s", "g", "bob", "3600000", "1-1") // Claims nothing
+
+	commands := aofCommands(t, path)
+	want := [][]string{
+		{"XCLAIM", "s", "g", "bob", "0", "1-1", "RETRYCOUNT", "5"},
+		{"MULTI"}, {"XCLAIM", "s", "g", "carol", "0", "1-1", "JUSTID"}, {"XACK", "s", "g", "2-1"}, {"EXEC"},
+	}
+	if got := commands[5:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("append-only file ends with %v, want %v", got, want)
+	}
+}
+
+func TestAOFTruncatedStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	data := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n*3\r\n$3\r\nSET\r\n$1\r\nx"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{Port: 0, AOF: &AOFConfig{Path: path, Fsync: persistence.FsyncEverySec}}
+	srv := New(store.New(), store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore(), nil, nil, cfg)
+	t.Cleanup(srv.keyspace.Close)
+	if err := srv.Start(); !errors.Is(err, persistence.ErrAOFTruncated) {
+		srv.Stop()
+		t.Fatalf("Start() with a truncated file error = %v, want ErrAOFTruncated", err)
+	}
+
+	_, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+	if got := sendCommand(t, conn, "GET", "k"); got.Str != "v" {
+		t.Errorf("GET k = %v, want v", got)
+	}
+	sendCommand(t, conn, "SET", "x", "y")
+	if got := aofCommands(t, path); !reflect.DeepEqual(got, [][]string{{"SET", "k", "v"}, {"SET", "x", "y"}}) {
+		t.Errorf("append-only file = %v, want the incomplete command replaced", got)
+	}
+}
+
+func TestAOFConfigSetFsync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	_, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "CONFIG", "SET", "appendfsync", "no"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET appendfsync = %v", got)
+	}
+	_, fields := infoFields(t, conn, "persistence")
+	if fields["aof_enabled"] != "1" || fields["aof_last_write_status"] != "ok" {
+		t.Errorf("aof_enabled = %q, aof_last_write_status = %q; want 1 and ok", fields["aof_enabled"], fields["aof_last_write_status"])
+	}
+	if got := sendCommand(t, conn, "CONFIG", "SET", "appendonly", "yes"); !strings.Contains(got.Str, "immutable") {
+		t.Errorf("CONFIG SET appendonly = %v, want an immutable config error", got)
+	}
+}
+
+func TestAOFWriteError(t *testing.T) {
+	failing, err := persistence.OpenAOF("/dev/full", persistence.FsyncAlways)
+	if err != nil {
+		t.Skipf("/dev/full unavailable: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	srv, addr := startAOFServer(t, path)
+	conn := dial(t, addr)
+
+	// Every write to /dev/full fails with ENOSPC
+	srv.execMu.Lock()
+	aof := srv.aof
+	srv.aof = failing
+	srv.execMu.Unlock()
+
+	if got := sendCommand(t, conn, "SET", "a", "1"); !strings.HasPrefix(got.Str, "MISCONF") {
+		t.Errorf("SET with a failing append-only file = %v, want a MISCONF error", got)
+	}
+	if got := sendCommand(t, conn, "SET", "b", "2"); !strings.HasPrefix(got.Str, "MISCONF") {
+		t.Errorf("SET after a failed append = %v, want a MISCONF error", got)
+	}
+	if got := sendCommand(t, conn, "GET", "b"); !got.Null {
+		t.Errorf("GET b = %v, want nil as the SET was refused", got)
+	}
+	if got := sendCommand(t, conn, "GET", "a"); got.Str != "1" {
+		t.Errorf("GET a = %v, want 1", got)
+	}
+	if _, fields := infoFields(t, conn, "persistence"); fields["aof_last_write_status"] != "err" {
+		t.Errorf("aof_last_write_status = %q, want err", fields["aof_last_write_status"])
+	}
+
+	// Writes are accepted again once the file can be written
+	srv.execMu.Lock()
+	srv.aof = aof
+	srv.execMu.Unlock()
+	_ = failing.Close()
+	if got := sendCommand(t, conn, "SET", "c", "3"); got.Str != "OK" {
+		t.Errorf("SET once the append-only file can be written = %v, want OK", got)
+	}
+	if got := aofCommands(t, path); !reflect.DeepEqual(got, [][]string{{"SET", "c", "3"}}) {
+		t.Errorf("append-only file = %v, want only the SET that was logged", got)
+	}
+}
+
+func TestXAddIDIndex(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"s", "*", "f", "v"}, 1},
+		{[]string{"s", "NOMKSTREAM", "1-1", "f", "v"}, 2},
+		{[]string{"s", "maxlen", "5", "*", "f", "v"}, 3},
+		{[]string{"s", "MINID", "~", "1-1", "LIMIT", "10", "NOMKSTREAM", "*", "f", "v"}, 7},
+	}
+	for _, tt := range tests {
+		if got := xaddIDIndex(tt.args); got != tt.want {
+			t.Errorf("xaddIDIndex(%q) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package server implements blocking commands for the Redis server.
+package server
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// blockingCommand is a parsed BLPOP, BRPOP, BLMOVE, BLMPOP, XREAD or
+// XREADGROUP call.
+type blockingCommand struct {
+	keys []string
+	// keyType is the type the command reads, store.TypeList or
+	// store.TypeStream. A waiting client is only served by a key of that type.
+	keyType string
+	// timeout is how long the client may wait; zero waits forever.
+	timeout time.Duration
+	// serve completes the command using key. It returns false, without
+	// side effects, if key holds no elements yet.
+	serve func(key string) (resp.Value, bool)
+	// timeoutReply is sent when the timeout passes without the command being served.
+	timeoutReply resp.Value
+}
+
+// tryServe runs the command against the first of its keys that can serve it.
+func (bc *blockingCommand) tryServe() (resp.Value, bool) {
+	for _, key := range bc.keys {
+		if reply, ok := bc.serve(key); ok {
+			return reply, true
+		}
+	}
+	return resp.Value{}, false
+}
+
+// blockedClient is a connection waiting in a blocking command.
+type blockedClient struct {
+	cmd *blockingCommand
+	// reply receives the result once the command is served.
+	reply chan resp.Value
+	// waiting is true while the client is queued on its keys.
+	waiting bool
+	// served, if set, is called with the reply when the command is served,
+	// under execMu, and returns the reply to send.
+	served func(reply resp.Value) resp.Value
+}
+
+// blockingManager keeps blocked clients in FIFO queues per key and serves
+// them when writes make their keys ready.
+// All methods must be called with the server's execMu held, so a client is
+// served atomically with the write that woke it.
+type blockingManager struct {
+	// keyType returns the type of the value at a key, as TYPE does.
+	keyType func(key string) string
+	waiters map[string][]*blockedClient
+	// ready holds the keys signalled since the last serveReady, in signal order.
+	ready    []string
+	readySet map[string]bool
+	// blocked is the number of clients waiting, for INFO.
+	blocked int
+}
+
+// newBlockingManager creates an empty blocking manager that reads the type
+// of keys with keyType.
+func newBlockingManager(keyType func(key string) string) *blockingManager {
+	return &blockingManager{
+		keyType:  keyType,
+		waiters:  make(map[string][]*blockedClient),
+		readySet: make(map[string]bool),
+	}
+}
+
+// block queues a client on each of its command's keys.
+func (m *blockingManager) block(bc *blockedClient) {
+	if !bc.waiting {
+		m.blocked++
+	}
+	bc.waiting = true
+	for _, key := range bc.cmd.keys {
+		if !slices.Contains(m.waiters[key], bc) {
+			m.waiters[key] = append(m.waiters[key], bc)
+		}
+	}
+}
+
+// unblock removes a client from all of its queues.
+// Returns false if the client was no longer waiting because it had been served.
+func (m *blockingManager) unblock(bc *blockedClient) bool {
+	if !bc.waiting {
+		return false
+	}
+	bc.waiting = false
+	m.blocked--
+
+	for _, key := range bc.cmd.keys {
+		queue := slices.DeleteFunc(m.waiters[key], func(other *blockedClient) bool {
+			return other == bc
+		})
+		if len(queue) == 0 {
+			delete(m.waiters, key)
+		} else {
+			m.waiters[key] = queue
+		}
+	}
+	return true
+}
+
+// blockedClients returns the number of clients waiting.
+func (m *blockingManager) blockedClients() int {
+	return m.blocked
+}
+
+// signalReady records that key may now serve blocked clients.
+// Keys nobody is waiting on are ignored.
+func (m *blockingManager) signalReady(key string) {
+	if len(m.waiters[key]) == 0 || m.readySet[key] {
+		return
+	}
+	m.readySet[key] = true
+	m.ready = append(m.ready, key)
+}
+
+// serveReady serves the clients blocked on ready keys, oldest first, until
+// each key runs out of elements. Serving a client may signal more keys
+// (BLMOVE pushes onto its destination); those are served in the same pass.
+// As in Redis, clients waiting for another type than the key now holds, as
+// when it was deleted and recreated, keep waiting rather than get WRONGTYPE.
+func (m *blockingManager) serveReady() {
+	for len(m.ready) > 0 {
+		key := m.ready[0]
+		m.ready = m.ready[1:]
+		delete(m.readySet, key)
+
+		typ := m.keyType(key)
+		for i := 0; i < len(m.waiters[key]); {
+			bc := m.waiters[key][i]
+			if bc.cmd.keyType != typ {
+				i++
+				continue
+			}
+			reply, ok := bc.cmd.serve(key)
+			if !ok {
+				break
+			}
+			m.unblock(bc)
+			if bc.served != nil {
+				reply = bc.served(reply)
+			}
+			bc.reply <- reply
+		}
+	}
+	m.ready = nil
+}
+
+// parseBlocking parses a blocking list or stream command.
+func (s *Server) parseBlocking(cmd string, args []resp.Value) (*blockingCommand, *resp.Value) {
+	if cmd == "XREAD" || cmd == "XREADGROUP" {
+		return s.streamHandler.parseBlockingRead(cmd, args)
+	}
+	return s.listHandler.parseBlocking(cmd, args)
+}
+
+// handleBlockingCommand runs BLPOP, BRPOP, BLMOVE, BLMPOP, XREAD or
+// XREADGROUP for a connection.
+// If none of the keys can serve the command right away, the client waits
+// without holding execMu until a write serves it, the timeout passes, the
+// connection closes or the server stops.
+// Returns false if there is no reply because the client is going away.
+func (s *Server) handleBlockingCommand(c *client, cmd string, args []resp.Value) (resp.Value, bool) {
+	s.execMu.Lock()
+	if reply, ok := s.checkAOFWritable(cmd); !ok {
+		s.execMu.Unlock()
+		return reply, true
+	}
+	bc, errResp := s.parseBlocking(cmd, args)
+	if errResp != nil {
+		s.execMu.Unlock()
+		return *errResp, true
+	}
+	if reply, ok := bc.tryServe(); ok {
+		if err := s.feedAOF(c, cmd, args, reply); err != nil {
+			reply = aofWriteError(err)
+		}
+		// BLMOVE may have pushed onto a key other clients are waiting on
+		s.blocking.serveReady()
+		s.execMu.Unlock()
+		return reply, true
+	}
+
+	waiter := &blockedClient{cmd: bc, reply: make(chan resp.Value, 1)}
+	waiter.served = func(reply resp.Value) resp.Value {
+		if err := s.feedAOF(c, cmd, args, reply); err != nil {
+			return aofWriteError(err)
+		}
+		return reply
+	}
+	s.blocking.block(waiter)
+	s.execMu.Unlock()
+
+	// Replies to commands pipelined before this one must not wait behind it
+	if err := c.flush(); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+
+	var timeout <-chan time.Time
+	if bc.timeout > 0 {
+		timer := time.NewTimer(bc.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	disconnected, stopWatching := c.watchDisconnect()
+	defer stopWatching()
+
+	select {
+	case reply := <-waiter.reply:
+		return reply, true
+	case <-timeout:
+	case <-disconnected:
+		c.closing = true
+	case <-s.quit:
+		c.closing = true
+	}
+
+	s.execMu.Lock()
+	stillWaiting := s.blocking.unblock(waiter)
+	s.execMu.Unlock()
+
+	if !stillWaiting {
+		// Served between the wakeup and taking the lock
+		return <-waiter.reply, true
+	}
+	if c.closing {
+		return resp.Value{}, false
+	}
+	return bc.timeoutReply, true
+}
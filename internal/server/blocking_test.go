@@ -0,0 +1,386 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// sendAsync sends a command and delivers its reply on the returned channel.
+// The channel is closed without a value if the connection fails.
+func sendAsync(conn net.Conn, args ...string) <-chan resp.Value {
+	replies := make(chan resp.Value, 1)
+	go func() {
+		defer close(replies)
+		if _, err := conn.Write(resp.Value{Type: resp.TypeArray, Array: makeArgs(args...)}.Serialize()); err != nil {
+			return
+		}
+		if v, err := resp.Parse(bufio.NewReader(conn)); err == nil {
+			replies <- v
+		}
+	}()
+	return replies
+}
+
+// waitForBlocked waits until n clients are blocked on key.
+func waitForBlocked(t *testing.T, srv *Server, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		srv.execMu.Lock()
+		blocked := len(srv.blocking.waiters[key])
+		srv.execMu.Unlock()
+		if blocked == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d clients blocked on %q", n, key)
+}
+
+// receive waits for an asynchronous reply.
+func receive(t *testing.T, replies <-chan resp.Value) resp.Value {
+	t.Helper()
+	select {
+	case v, ok := <-replies:
+		if !ok {
+			t.Fatal("connection failed before a reply arrived")
+		}
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for reply")
+	}
+	return resp.Value{}
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestBlockingPopServedInFIFOOrder(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	var replies []<-chan resp.Value
+	for i := 0; i < 3; i++ {
+		replies = append(replies, sendAsync(dial(t, addr), "BLPOP", "queue", "0"))
+		waitForBlocked(t, srv, "queue", i+1)
+	}
+
+	sendCommand(t, dial(t, addr), "RPUSH", "queue", "a", "b", "c")
+	for i, want := range []string{"a", "b", "c"} {
+		got := receive(t, replies[i])
+		if len(got.Array) != 2 || got.Array[0].Str != "queue" || got.Array[1].Str != want {
+			t.Errorf("client %d got %v, want [queue %s]", i, got, want)
+		}
+	}
+
+	if got := sendCommand(t, dial(t, addr), "EXISTS", "queue"); got.Num != 0 {
+		t.Errorf("EXISTS queue = %v, want 0 after all elements were handed out", got)
+	}
+}
+
+func TestBlockingPopOnlyServesAvailableElements(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	first := sendAsync(dial(t, addr), "BRPOP", "a", "b", "0")
+	waitForBlocked(t, srv, "b", 1)
+	second := sendAsync(dial(t, addr), "BRPOP", "b", "0")
+	waitForBlocked(t, srv, "b", 2)
+
+	sendCommand(t, dial(t, addr), "LPUSH", "b", "x")
+	if got := receive(t, first); got.Array[0].Str != "b" || got.Array[1].Str != "x" {
+		t.Errorf("first client got %v, want [b x]", got)
+	}
+
+	// The second client keeps waiting until another element arrives
+	waitForBlocked(t, srv, "b", 1)
+	sendCommand(t, dial(t, addr), "LPUSH", "b", "y")
+	if got := receive(t, second); got.Array[1].Str != "y" {
+		t.Errorf("second client got %v, want [b y]", got)
+	}
+}
+
+func TestBlockingMoveChain(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	// The element is moved into "stage" and from there straight to the BLPOP client
+	popped := sendAsync(dial(t, addr), "BLPOP", "stage", "0")
+	waitForBlocked(t, srv, "stage", 1)
+	moved := sendAsync(dial(t, addr), "BLMOVE", "jobs", "stage", "LEFT", "RIGHT", "0")
+	waitForBlocked(t, srv, "jobs", 1)
+
+	sendCommand(t, dial(t, addr), "RPUSH", "jobs", "job1")
+	if got := receive(t, moved); got.Str != "job1" {
+		t.Errorf("BLMOVE = %v, want job1", got)
+	}
+	if got := receive(t, popped); got.Array[0].Str != "stage" || got.Array[1].Str != "job1" {
+		t.Errorf("BLPOP = %v, want [stage job1]", got)
+	}
+}
+
+func TestBlockingMPopCount(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	replies := sendAsync(dial(t, addr), "BLMPOP", "0", "2", "a", "b", "RIGHT", "COUNT", "2")
+	waitForBlocked(t, srv, "b", 1)
+
+	sendCommand(t, dial(t, addr), "RPUSH", "b", "1", "2", "3")
+	got := receive(t, replies)
+	if got.Array[0].Str != "b" || len(got.Array[1].Array) != 2 || got.Array[1].Array[0].Str != "3" || got.Array[1].Array[1].Str != "2" {
+		t.Errorf("BLMPOP = %v, want [b [3 2]]", got)
+	}
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	srv, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	start := time.Now()
+	if got := sendCommand(t, conn, "BLPOP", "queue", "0.05"); got.Type != resp.TypeArray || !got.Null {
+		t.Errorf("BLPOP after timeout = %v, want null array", got)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("BLPOP returned after %v, want at least 50ms", elapsed)
+	}
+	if got := sendCommand(t, conn, "BLMOVE", "queue", "dst", "LEFT", "LEFT", "0.01"); !got.Null {
+		t.Errorf("BLMOVE after timeout = %v, want null", got)
+	}
+
+	// The connection is usable and the timed out client is no longer queued
+	waitForBlocked(t, srv, "queue", 0)
+	sendCommand(t, conn, "RPUSH", "queue", "a")
+	if got := sendCommand(t, conn, "LLEN", "queue"); got.Num != 1 {
+		t.Errorf("LLEN = %v, want 1", got)
+	}
+}
+
+func TestBlockingPopReleasedOnDisconnect(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	sendAsync(conn, "BLPOP", "queue", "0")
+	waitForBlocked(t, srv, "queue", 1)
+
+	_ = conn.Close()
+	waitForBlocked(t, srv, "queue", 0)
+
+	// The element stays in the list instead of going to the departed client
+	other := dial(t, addr)
+	sendCommand(t, other, "RPUSH", "queue", "a")
+	if got := sendCommand(t, other, "LLEN", "queue"); got.Num != 1 {
+		t.Errorf("LLEN = %v, want 1", got)
+	}
+}
+
+func TestBlockingPopReleasedOnStop(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	replies := sendAsync(dial(t, addr), "BLPOP", "queue", "0")
+	waitForBlocked(t, srv, "queue", 1)
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not release the blocked client")
+	}
+	if _, ok := <-replies; ok {
+		t.Error("blocked client got a reply, want the connection closed")
+	}
+}
+
+func TestBlockingPopWithPipelinedCommand(t *testing.T) {
+	srv, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	// PING is sent behind BLPOP and must run after it is served
+	pipeline := append(resp.Value{Type: resp.TypeArray, Array: makeArgs("BLPOP", "queue", "0")}.Serialize(),
+		resp.Value{Type: resp.TypeArray, Array: makeArgs("PING")}.Serialize()...)
+	if _, err := conn.Write(pipeline); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	waitForBlocked(t, srv, "queue", 1)
+
+	sendCommand(t, dial(t, addr), "RPUSH", "queue", "a")
+
+	reader := bufio.NewReader(conn)
+	for _, want := range []string{"a", "PONG"} {
+		got, err := resp.Parse(reader)
+		if err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if got.Str != want && (len(got.Array) != 2 || got.Array[1].Str != want) {
+			t.Errorf("reply = %v, want %s", got, want)
+		}
+	}
+}
+
+func TestBlockingPopInsideMulti(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "BLPOP", "queue", "0")
+	sendCommand(t, conn, "RPUSH", "queue", "a")
+	sendCommand(t, conn, "BRPOP", "queue", "0")
+
+	got := sendCommand(t, conn, "EXEC")
+	if len(got.Array) != 3 {
+		t.Fatalf("EXEC = %v, want 3 replies", got)
+	}
+	if !got.Array[0].Null {
+		t.Errorf("BLPOP inside MULTI = %v, want null instead of blocking", got.Array[0])
+	}
+	if got.Array[2].Array[1].Str != "a" {
+		t.Errorf("BRPOP inside MULTI = %v, want [queue a]", got.Array[2])
+	}
+}
+
+func TestBlockedClientServedAfterExec(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	replies := sendAsync(dial(t, addr), "BLPOP", "queue", "0")
+	waitForBlocked(t, srv, "queue", 1)
+
+	conn := dial(t, addr)
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "RPUSH", "queue", "a", "b")
+	sendCommand(t, conn, "LPOP", "queue")
+	sendCommand(t, conn, "EXEC")
+
+	// The blocked client only sees the state after the whole transaction
+	if got := receive(t, replies); got.Array[1].Str != "b" {
+		t.Errorf("BLPOP = %v, want [queue b]", got)
+	}
+}
+
+func TestBlockingXRead(t *testing.T) {
+	srv, addr := startTestServer(t)
+	conn := dial(t, addr)
+	sendCommand(t, conn, "XADD", "s", "1-0", "f", "old")
+
+	replies := sendAsync(dial(t, addr), "XREAD", "BLOCK", "0", "STREAMS", "s", "$")
+	waitForBlocked(t, srv, "s", 1)
+	sendCommand(t, conn, "XADD", "s", "2-0", "f", "new")
+
+	got := receive(t, replies)
+	if len(got.Array) != 1 || got.Array[0].Array[0].Str != "s" || !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"2-0"}) {
+		t.Errorf("XREAD BLOCK = %v, want [s [2-0]]", got)
+	}
+
+	// Entries already there are returned without blocking
+	if got := sendCommand(t, conn, "XREAD", "BLOCK", "0", "STREAMS", "s", "0"); len(got.Array) != 1 {
+		t.Errorf("XREAD BLOCK with entries = %v, want them right away", got)
+	}
+	if got := sendCommand(t, conn, "XREAD", "STREAMS", "s", "$"); !got.Null {
+		t.Errorf("XREAD without BLOCK = %v, want null right away", got)
+	}
+
+	start := time.Now()
+	if got := sendCommand(t, conn, "XREAD", "BLOCK", "50", "STREAMS", "s", "missing", "$", "$"); !got.Null {
+		t.Errorf("XREAD BLOCK after timeout = %v, want null", got)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("XREAD BLOCK 50 returned after %v", elapsed)
+	}
+}
+
+// TestBlockedClientKeepsWaitingOnOtherType checks a waiting client isn't
+// served WRONGTYPE when its key is deleted and recreated as another type.
+func TestBlockedClientKeepsWaitingOnOtherType(t *testing.T) {
+	tests := []struct {
+		name     string
+		block    []string
+		recreate []string // Run in a transaction, so the key is signalled as the wrong type
+		write    []string
+	}{
+		{"BLPOP", []string{"BLPOP", "k", "0"}, []string{"XADD", "k", "1-0", "f", "v"}, []string{"RPUSH", "k", "a"}},
+		{"XREAD", []string{"XREAD", "BLOCK", "0", "STREAMS", "k", "$"}, []string{"RPUSH", "k", "a"}, []string{"XADD", "k", "1-0", "f", "v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, addr := startTestServer(t)
+			conn := dial(t, addr)
+			replies := sendAsync(dial(t, addr), tt.block...)
+			waitForBlocked(t, srv, "k", 1)
+
+			sendCommand(t, conn, "MULTI")
+			sendCommand(t, conn, tt.write...)
+			sendCommand(t, conn, "DEL", "k")
+			sendCommand(t, conn, tt.recreate...)
+			sendCommand(t, conn, "EXEC")
+			waitForBlocked(t, srv, "k", 1)
+
+			sendCommand(t, conn, "DEL", "k")
+			sendCommand(t, conn, tt.write...)
+			if got := receive(t, replies); got.Type == resp.TypeError || got.Null {
+				t.Errorf("%s = %v, want the element written once the key had its type", tt.name, got)
+			}
+		})
+	}
+
+	// A client waiting for another type doesn't hold up those behind it
+	srv, addr := startTestServer(t)
+	xread := sendAsync(dial(t, addr), "XREAD", "BLOCK", "0", "STREAMS", "k", "$")
+	waitForBlocked(t, srv, "k", 1)
+	blpop := sendAsync(dial(t, addr), "BLPOP", "k", "0")
+	waitForBlocked(t, srv, "k", 2)
+	sendCommand(t, dial(t, addr), "RPUSH", "k", "a")
+	if got := receive(t, blpop); len(got.Array) != 2 || got.Array[1].Str != "a" {
+		t.Errorf("BLPOP behind an XREAD = %v, want [k a]", got)
+	}
+	select {
+	case got := <-xread:
+		t.Errorf("XREAD on a list = %v, want it still waiting", got)
+	default:
+	}
+}
+
+func TestBlockingXReadGroup(t *testing.T) {
+	srv, addr := startTestServer(t)
+	conn := dial(t, addr)
+	sendCommand(t, conn, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+
+	first := sendAsync(dial(t, addr), "XREADGROUP", "GROUP", "g", "c1", "BLOCK", "0", "STREAMS", "s", ">")
+	waitForBlocked(t, srv, "s", 1)
+	second := sendAsync(dial(t, addr), "XREADGROUP", "GROUP", "g", "c2", "BLOCK", "0", "STREAMS", "s", ">")
+	waitForBlocked(t, srv, "s", 2)
+
+	// Each entry is delivered once, to the client that has waited longest
+	sendCommand(t, conn, "XADD", "s", "1-0", "f", "v")
+	if got := receive(t, first); !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"1-0"}) {
+		t.Errorf("first XREADGROUP = %v, want [s [1-0]]", got)
+	}
+	waitForBlocked(t, srv, "s", 1)
+	sendCommand(t, conn, "XADD", "s", "2-0", "f", "v")
+	if got := receive(t, second); !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"2-0"}) {
+		t.Errorf("second XREADGROUP = %v, want [s [2-0]]", got)
+	}
+	if got := sendCommand(t, conn, "XPENDING", "s", "g"); got.Array[0].Num != 2 {
+		t.Errorf("XPENDING = %v, want 2 entries pending", got)
+	}
+
+	// Reading the consumer's pending entries never blocks
+	got := sendCommand(t, conn, "XREADGROUP", "GROUP", "g", "c3", "BLOCK", "0", "STREAMS", "s", "0")
+	if len(got.Array) != 1 || len(got.Array[0].Array[1].Array) != 0 {
+		t.Errorf("XREADGROUP BLOCK of pending entries = %v, want [s []]", got)
+	}
+}
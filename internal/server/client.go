@@ -0,0 +1,248 @@
+// Package server contains per-connection client state for the Redis server.
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/pubsub"
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/transaction"
+)
+
+// errClientClosed is returned when writing to a client whose writer has stopped.
+var errClientClosed = errors.New("client connection closed")
+
+// client holds the state owned by a single connection.
+type client struct {
+	id   int64
+	conn net.Conn
+	// reader flushes writer whenever it has to wait for more input, so replies
+	// to pipelined commands go out in one write once the pipeline is drained.
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	// proto is the protocol version negotiated with HELLO. The writer
+	// goroutine reads it too, so it is accessed atomically.
+	proto atomic.Int32
+	// name is the client name set with HELLO SETNAME.
+	name string
+	// authenticated is set once the client passes AUTH or HELLO AUTH, or on
+	// connecting if the default user needs no password.
+	authenticated bool
+	// user is the ACL user the connection runs commands as.
+	user string
+	// inExec is set while EXEC runs the queued commands.
+	inExec bool
+
+	// tx holds the connection's MULTI queue and watched keys.
+	tx *TransactionHandler
+
+	// subscriber is created on the first SUBSCRIBE/PSUBSCRIBE family command.
+	// From then on a writer goroutine owns the connection: it streams
+	// subscriber messages and command replies in the order they were produced.
+	subscriber *pubsub.Subscriber
+	replies    chan resp.Value
+	stop       chan struct{}
+	writerDone chan struct{}
+
+	// closing is set by QUIT; the connection is closed after the reply is written.
+	closing bool
+}
+
+// newClient creates the state for a newly accepted connection.
+// The version tracker is shared by all clients so WATCH sees writes from any connection.
+func newClient(id int64, conn net.Conn, versionTracker transaction.VersionTracker) *client {
+	c := &client{
+		id:     id,
+		conn:   conn,
+		writer: bufio.NewWriter(conn),
+		tx:     NewTransactionHandler(versionTracker),
+		user:   acl.DefaultUser,
+	}
+	c.reader = bufio.NewReader(flushingReader{c})
+	c.proto.Store(resp.RESP2)
+	return c
+}
+
+// flushingReader reads from the client's connection, first flushing any
+// buffered replies. bufio.Reader only reads from it once the buffered input
+// holds no complete command, which is exactly when the client may be waiting
+// for the replies so far.
+type flushingReader struct {
+	c *client
+}
+
+func (r flushingReader) Read(p []byte) (int, error) {
+	// After subscribing, the writer belongs to the writer goroutine
+	if r.c.replies == nil && r.c.writer.Buffered() > 0 {
+		if err := r.c.writer.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return r.c.conn.Read(p)
+}
+
+// write sends a reply to the client.
+// Before the client has subscribed, replies are serialized into the buffered
+// writer, which is flushed before the next read from the connection.
+// Afterwards they are handed to the writer goroutine so they can't overtake
+// subscription confirmations that were queued before them.
+func (c *client) write(v resp.Value) error {
+	if c.replies == nil {
+		return c.buffer(v)
+	}
+
+	select {
+	case c.replies <- v:
+		return nil
+	case <-c.writerDone:
+		return errClientClosed
+	}
+}
+
+// watchDisconnect reports on the returned channel if the peer closes the
+// connection while the client is blocked and not reading commands.
+// The stop function must be called before the reader is used again.
+func (c *client) watchDisconnect() (<-chan struct{}, func()) {
+	gone := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		// Peek leaves pipelined commands buffered for the next read
+		if _, err := c.reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			close(gone)
+		}
+	}()
+
+	stop := func() {
+		// Interrupt the pending Peek, then restore blocking reads
+		_ = c.conn.SetReadDeadline(time.Now())
+		<-done
+		_ = c.conn.SetReadDeadline(time.Time{})
+	}
+	return gone, stop
+}
+
+// protocol returns the RESP version the client speaks.
+func (c *client) protocol() int {
+	return int(c.proto.Load())
+}
+
+// info describes the connection in the format of CLIENT INFO.
+func (c *client) info() string {
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s user=%s resp=%d",
+		c.id, c.conn.RemoteAddr(), c.conn.LocalAddr(), c.name, c.user, c.protocol())
+}
+
+// buffer serializes a reply for the client's protocol version straight into
+// the writer's spare capacity.
+func (c *client) buffer(v resp.Value) error {
+	_, err := c.writer.Write(v.AppendProto(c.writer.AvailableBuffer(), c.protocol()))
+	return err
+}
+
+// flush writes any buffered replies to the connection.
+// After subscribing, the writer goroutine flushes on its own.
+func (c *client) flush() error {
+	if c.replies != nil {
+		return nil
+	}
+	return c.writer.Flush()
+}
+
+// startSubscriber creates the client's subscriber and starts the writer goroutine.
+// Replies buffered so far are flushed first, as the writer goroutine takes over
+// the connection. Does nothing if the client already has a subscriber.
+func (c *client) startSubscriber() {
+	if c.subscriber != nil {
+		return
+	}
+	if err := c.writer.Flush(); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+
+	c.subscriber = pubsub.NewSubscriber(fmt.Sprintf("client-%d", c.id))
+	c.replies = make(chan resp.Value)
+	c.stop = make(chan struct{})
+	c.writerDone = make(chan struct{})
+
+	go c.writeLoop()
+}
+
+// writeLoop streams subscriber messages and command replies to the connection.
+// Everything queued at the time is written with a single flush.
+func (c *client) writeLoop() {
+	defer close(c.writerDone)
+
+	for {
+		select {
+		case msg := <-c.subscriber.Messages:
+			if !c.writeValue(FormatPush(msg)) || !c.drainMessages() || !c.flushWriter() {
+				return
+			}
+		case v := <-c.replies:
+			// Anything already queued on the subscriber was produced before
+			// this reply (e.g. SUBSCRIBE confirmations), so it goes out first.
+			if !c.drainMessages() || !c.writeValue(v) || !c.flushWriter() {
+				return
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// drainMessages writes all subscriber messages that are currently queued.
+// Returns false if a write failed.
+func (c *client) drainMessages() bool {
+	for {
+		select {
+		case msg := <-c.subscriber.Messages:
+			if !c.writeValue(FormatPush(msg)) {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// writeValue buffers a value from the writer goroutine.
+// On failure the connection is closed so the reading side stops as well.
+func (c *client) writeValue(v resp.Value) bool {
+	if err := c.buffer(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+		_ = c.conn.Close()
+		return false
+	}
+	return true
+}
+
+// flushWriter flushes the values buffered by the writer goroutine.
+// On failure the connection is closed so the reading side stops as well.
+func (c *client) flushWriter() bool {
+	if err := c.writer.Flush(); err != nil {
+		log.Printf("Error writing response: %v", err)
+		_ = c.conn.Close()
+		return false
+	}
+	return true
+}
+
+// stopWriter stops the writer goroutine, if any, and waits for it to exit.
+func (c *client) stopWriter() {
+	if c.stop == nil {
+		return
+	}
+	close(c.stop)
+	<-c.writerDone
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// scriptedConn is a net.Conn that serves fixed input and records every write.
+type scriptedConn struct {
+	net.Conn
+	input  io.Reader
+	writes [][]byte
+}
+
+func (c *scriptedConn) Read(p []byte) (int, error) {
+	return c.input.Read(p)
+}
+
+func (c *scriptedConn) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, bytes.Clone(p))
+	return len(p), nil
+}
+
+func (c *scriptedConn) Close() error {
+	return nil
+}
+
+// pipeline serializes commands back to back, as a pipelining client sends them.
+func pipeline(commands ...[]string) []byte {
+	var buf []byte
+	for _, args := range commands {
+		buf = resp.Value{Type: resp.TypeArray, Array: makeArgs(args...)}.AppendTo(buf)
+	}
+	return buf
+}
+
+// serveScripted runs a connection over the given input until it is exhausted.
+func serveScripted(srv *Server, input io.Reader) *scriptedConn {
+	conn := &scriptedConn{input: input}
+	srv.wg.Add(1)
+	srv.handleConnection(conn)
+	return conn
+}
+
+func TestPipelinedRepliesAreWrittenTogether(t *testing.T) {
+	srv := createTestServer(t)
+
+	// Small enough to fit in the connection's read buffer in one go
+	var commands [][]string
+	for i := 0; i < 50; i++ {
+		commands = append(commands, []string{"PING"}, []string{"RPUSH", "list", "x"})
+	}
+	commands = append(commands, []string{"LLEN", "list"})
+
+	conn := serveScripted(srv, bytes.NewReader(pipeline(commands...)))
+	if len(conn.writes) != 1 {
+		t.Errorf("replies took %d writes, want 1", len(conn.writes))
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(bytes.Join(conn.writes, nil)))
+	var last resp.Value
+	for range commands {
+		v, err := resp.Parse(reader)
+		if err != nil {
+			t.Fatalf("Failed to parse reply: %v", err)
+		}
+		last = v
+	}
+	if last.Num != 50 {
+		t.Errorf("LLEN = %v, want 50", last)
+	}
+}
+
+func TestRepliesFlushedBeforeWaitingForInput(t *testing.T) {
+	srv := createTestServer(t)
+
+	// Each chunk ends on a command boundary, so the reader has to wait for
+	// more input after it and the replies so far must be sent first
+	first := pipeline([]string{"SET", "k", "v"}, []string{"GET", "k"})
+	second := pipeline([]string{"PING"})
+	conn := serveScripted(srv, io.MultiReader(bytes.NewReader(first), bytes.NewReader(second)))
+
+	want := []string{"+OK\r\n$1\r\nv\r\n", "+PONG\r\n"}
+	if len(conn.writes) != len(want) {
+		t.Fatalf("got %d writes %q, want %q", len(conn.writes), conn.writes, want)
+	}
+	for i, w := range want {
+		if string(conn.writes[i]) != w {
+			t.Errorf("write %d = %q, want %q", i, conn.writes[i], w)
+		}
+	}
+}
+
+func TestQuitReplyFlushed(t *testing.T) {
+	srv := createTestServer(t)
+
+	conn := serveScripted(srv, strings.NewReader(string(pipeline([]string{"PING"}, []string{"QUIT"}, []string{"PING"}))))
+	if got := string(bytes.Join(conn.writes, nil)); got != "+PONG\r\n+OK\r\n" {
+		t.Errorf("output = %q, want PONG and OK only", got)
+	}
+}
+
+func TestInlineCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"health check probe", "PING\r\n", "+PONG\r\n"},
+		{"bare newlines", "SET k v\nGET k\n", "+OK\r\n$1\r\nv\r\n"},
+		{"quoted arguments", "SET k \"a b\\n\"\r\nGET k\r\n", "+OK\r\n$4\r\na b\n\r\n"},
+		{"blank lines skipped", "\r\n\r\nPING\r\n", "+PONG\r\n"},
+		{"mixed with RESP", "PING\r\n" + string(pipeline([]string{"ECHO", "hi"})), "+PONG\r\n$2\r\nhi\r\n"},
+		{"unbalanced quotes", "SET k \"v\r\nPING\r\n", "-ERR Protocol error: unbalanced quotes in request\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := serveScripted(createTestServer(t), strings.NewReader(tt.input))
+			if got := string(bytes.Join(conn.writes, nil)); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtocolErrorsCloseConnection(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"bulk over proto-max-bulk-len", "*2\r\n$4\r\nECHO\r\n$999999999999\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+		{"multibulk over limit", "*100\r\n", "-ERR Protocol error: invalid multibulk length\r\n"},
+		{"nested too deeply", "*1\r\n*1\r\n*1\r\n*1\r\n", "-ERR Protocol error: too many nested aggregates\r\n"},
+		{"inline too long", strings.Repeat("x", 300) + "\r\n", "-ERR Protocol error: too big inline request\r\n"},
+		{"malformed length", "*x\r\n", "-ERR Protocol error: invalid length\r\n"},
+		{"earlier replies kept", "PING\r\n*2\r\n$4\r\nECHO\r\n$5\r\nhello\r\n", "+PONG\r\n-ERR Protocol error: invalid bulk length\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := createTestServer(t)
+			srv.limits.Store(&resp.Limits{MaxBulkLen: 4, MaxMultibulkLen: 10, MaxDepth: 3, MaxInlineLen: 256})
+
+			// Nothing after the violation is executed
+			conn := serveScripted(srv, strings.NewReader(tt.input+"PING\r\n"))
+			if got := string(bytes.Join(conn.writes, nil)); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Package server contains the CONFIG command handler and the mapping between
+// configuration parameters and the server's Config.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/config"
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// ConfigFromParams returns the server configuration the parameters describe.
+// Port 0 disables plaintext connections, as in redis.conf.
+func ConfigFromParams(params *config.Config) Config {
+	cfg := DefaultConfig()
+	cfg.Params = params
+
+	cfg.Port = params.Int("port")
+	if cfg.Port == 0 {
+		cfg.Port = -1
+	}
+	cfg.Bind = params.Fields("bind")
+	cfg.UnixSocket = params.String("unixsocket")
+	perm, _ := strconv.ParseUint(params.String("unixsocketperm"), 8, 32)
+	cfg.UnixSocketPerm = os.FileMode(perm)
+	cfg.Timeout = time.Duration(params.Int("timeout")) * time.Second
+	cfg.RequirePass = params.String("requirepass")
+	cfg.ACLFile = params.String("aclfile")
+	cfg.Protocol.MaxBulkLen = params.Int("proto-max-bulk-len")
+
+	if port := params.Int("tls-port"); port != 0 {
+		cfg.TLS = &TLSConfig{
+			Port:       port,
+			CertFile:   params.String("tls-cert-file"),
+			KeyFile:    params.String("tls-key-file"),
+			CACertFile: params.String("tls-ca-cert-file"),
+			ClientAuth: clientAuthTypes[params.String("tls-auth-clients")],
+		}
+	}
+	if port := params.Int("metrics-port"); port != 0 {
+		cfg.Metrics = &MetricsConfig{Port: port}
+	}
+	if params.Bool("appendonly") {
+		cfg.AOF = &AOFConfig{
+			Path:          filepath.Join(params.String("dir"), params.String("appendfilename")),
+			Fsync:         persistence.FsyncPolicy(params.String("appendfsync")),
+			LoadTruncated: params.Bool("aof-load-truncated"),
+		}
+	}
+	return cfg
+}
+
+// paramsFromConfig returns parameters describing a Config built without them.
+// Values the parameters can't hold, such as a random port, keep their defaults.
+func paramsFromConfig(cfg Config, persistMgr *persistence.Manager) *config.Config {
+	params := config.New()
+	set := func(name, value string) {
+		_ = params.Set(name, value)
+	}
+
+	set("port", strconv.Itoa(max(cfg.Port, 0)))
+	if len(cfg.Bind) > 0 {
+		set("bind", strings.Join(cfg.Bind, " "))
+	}
+	set("unixsocket", cfg.UnixSocket)
+	set("unixsocketperm", strconv.FormatUint(uint64(cfg.UnixSocketPerm.Perm()), 8))
+	set("timeout", strconv.Itoa(int(cfg.Timeout/time.Second)))
+	set("requirepass", cfg.RequirePass)
+	set("aclfile", cfg.ACLFile)
+	if cfg.Protocol.MaxBulkLen > 0 {
+		set("proto-max-bulk-len", strconv.Itoa(cfg.Protocol.MaxBulkLen))
+	}
+
+	if cfg.TLS != nil {
+		set("tls-port", strconv.Itoa(cfg.TLS.Port))
+		set("tls-cert-file", cfg.TLS.CertFile)
+		set("tls-key-file", cfg.TLS.KeyFile)
+		set("tls-ca-cert-file", cfg.TLS.CACertFile)
+		for name, auth := range clientAuthTypes {
+			if auth == cfg.TLS.ClientAuth {
+				set("tls-auth-clients", name)
+			}
+		}
+	}
+
+	if cfg.Metrics != nil {
+		set("metrics-port", strconv.Itoa(cfg.Metrics.Port))
+	}
+
+	if cfg.AOF != nil {
+		set("appendonly", "yes")
+		set("dir", filepath.Dir(cfg.AOF.Path))
+		set("appendfilename", filepath.Base(cfg.AOF.Path))
+		set("appendfsync", string(cfg.AOF.Fsync))
+		if !cfg.AOF.LoadTruncated {
+			set("aof-load-truncated", "no")
+		}
+	}
+
+	if persistMgr != nil {
+		set("dir", filepath.Dir(persistMgr.Path()))
+		set("dbfilename", filepath.Base(persistMgr.Path()))
+		set("snapshot-format", string(persistMgr.Format()))
+	}
+	return params
+}
+
+// handleConfig handles the CONFIG command.
+// CONFIG GET pattern [pattern ...] | SET parameter value [parameter value ...]
+// | REWRITE | RESETSTAT
+func (s *Server) handleConfig(args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return respError("ERR wrong number of arguments for 'config' command")
+	}
+
+	name := args[0].Str
+	sub := strings.ToUpper(name)
+	args = args[1:]
+	wrongArgs := respError(fmt.Sprintf("ERR wrong number of arguments for 'config|%s' command", strings.ToLower(sub)))
+
+	switch sub {
+	case "GET":
+		if len(args) == 0 {
+			return wrongArgs
+		}
+		pairs := s.params.Match(argStrings(args)...)
+		return resp.Value{Type: resp.TypeMap, Array: bulkStringArray(pairs).Array}
+
+	case "SET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return wrongArgs
+		}
+		return s.handleConfigSet(argStrings(args))
+
+	case "REWRITE":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		if err := s.params.Rewrite(); err != nil {
+			if errors.Is(err, config.ErrNoConfigFile) {
+				return respError("ERR " + err.Error())
+			}
+			return respError("ERR Rewriting config file: " + err.Error())
+		}
+		return respSimpleString("OK")
+
+	case "RESETSTAT":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		s.stats.reset(s.keyspace.ExpiryStats().ExpiredKeys)
+		return respSimpleString("OK")
+
+	default:
+		return respError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CONFIG HELP.", name))
+	}
+}
+
+// handleConfigSet sets parameters given as name/value pairs. Either every
+// parameter is set or, if one is refused, none are.
+func (s *Server) handleConfigSet(pairs []string) resp.Value {
+	values := make(map[string]string, len(pairs)/2)
+	var names []string
+	for i := 0; i < len(pairs); i += 2 {
+		name := strings.ToLower(pairs[i])
+		if !config.Exists(name) {
+			return respError(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", pairs[i]))
+		}
+		if !config.Mutable(name) {
+			return configSetError(name, errors.New("can't set immutable config"))
+		}
+		if _, ok := values[name]; ok {
+			return configSetError(name, errors.New("duplicate parameter"))
+		}
+		value, err := config.Check(name, pairs[i+1])
+		if err == nil && name == "dir" {
+			err = checkDir(value)
+		}
+		if err == nil && name == "snapshot-format" {
+			err = s.checkSnapshotFormat(persistence.Format(value))
+		}
+		if err != nil {
+			return configSetError(name, err)
+		}
+		values[name] = value
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		_ = s.params.Set(name, values[name])
+	}
+	for _, name := range names {
+		if err := s.applyParam(name, values[name]); err != nil {
+			return configSetError(name, err)
+		}
+	}
+	return respSimpleString("OK")
+}
+
+func configSetError(name string, err error) resp.Value {
+	return respError(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - %s", name, err))
+}
+
+// checkDir reports whether dir is an existing directory snapshots can go in.
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.New("No such file or directory")
+	}
+	if !info.IsDir() {
+		return errors.New("Not a directory")
+	}
+	return nil
+}
+
+// checkSnapshotFormat reports whether the dataset can be saved in format.
+// Streams have no RDB encoding here, so the RDB format is refused while any
+// exist rather than every save failing later.
+func (s *Server) checkSnapshotFormat(format persistence.Format) error {
+	if format == persistence.FormatRDB && s.keyspace.Streams().Len() > 0 {
+		return errors.New("streams can't be saved in the RDB format, delete them or keep the gob format")
+	}
+	return nil
+}
+
+// applyParam makes a parameter changed by CONFIG SET take effect. Parameters
+// the server only reads when it needs them, such as save, need nothing.
+func (s *Server) applyParam(name, value string) error {
+	switch name {
+	case "requirepass":
+		// As in Redis, requirepass is the default user's only password
+		if value == "" {
+			return s.acl.SetUser(acl.DefaultUser, "nopass")
+		}
+		return s.acl.SetUser(acl.DefaultUser, "resetpass", ">"+value)
+	case "timeout":
+		s.idleTimeout.Store(int64(s.params.Int(name)) * int64(time.Second))
+	case "proto-max-bulk-len":
+		limits := *s.limits.Load()
+		limits.MaxBulkLen = s.params.Int(name)
+		s.limits.Store(&limits)
+	case "acllog-max-len":
+		s.acl.Log().SetMaxLen(s.params.Int(name))
+	case "dir", "dbfilename":
+		if s.persistenceHandler != nil {
+			s.persistenceHandler.manager.SetPath(filepath.Join(s.params.String("dir"), s.params.String("dbfilename")))
+		}
+	case "snapshot-format":
+		if s.persistenceHandler != nil {
+			s.persistenceHandler.manager.SetFormat(persistence.Format(value))
+		}
+	case "appendfsync":
+		if s.aof != nil {
+			s.aof.SetFsyncPolicy(persistence.FsyncPolicy(value))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/config"
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// configValues converts a CONFIG GET reply to a map.
+func configValues(t *testing.T, v resp.Value) map[string]string {
+	t.Helper()
+	if v.Type != resp.TypeArray || len(v.Array)%2 != 0 {
+		t.Fatalf("CONFIG GET = %v, want an array of pairs", v)
+	}
+	values := make(map[string]string)
+	for i := 0; i < len(v.Array); i += 2 {
+		values[v.Array[i].Str] = v.Array[i+1].Str
+	}
+	return values
+}
+
+func TestConfigGet(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Port = 0
+	cfg.RequirePass = ""
+	cfg.Timeout = 30 * time.Second
+	_, addr := startTestServerWithConfig(t, cfg)
+	conn := dial(t, addr)
+
+	tests := []struct {
+		args []string
+		want map[string]string
+	}{
+		{[]string{"timeout"}, map[string]string{"timeout": "30"}},
+		{[]string{"TIMEOUT"}, map[string]string{"timeout": "30"}},
+		{[]string{"max*"}, map[string]string{"maxmemory": "0"}},
+		{[]string{"dbfilename", "save"}, map[string]string{"dbfilename": "dump.rdb", "save": "3600 1 300 100 60 10000"}},
+		{[]string{"nosuchparam"}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		got := configValues(t, sendCommand(t, conn, append([]string{"CONFIG", "GET"}, tt.args...)...))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CONFIG GET %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	if got := sendCommand(t, conn, "CONFIG", "GET"); got.Str != "ERR wrong number of arguments for 'config|get' command" {
+		t.Errorf("CONFIG GET without pattern = %v", got)
+	}
+	if got := sendCommand(t, conn, "CONFIG", "FOO"); got.Str != "ERR unknown subcommand 'FOO'. Try CONFIG HELP." {
+		t.Errorf("CONFIG FOO = %v", got)
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "CONFIG", "SET", "maxmemory", "10mb", "save", "60 100"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET = %v, want OK", got)
+	}
+	got := configValues(t, sendCommand(t, conn, "CONFIG", "GET", "maxmemory", "save"))
+	if want := map[string]string{"maxmemory": "10485760", "save": "60 100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CONFIG GET after SET = %v, want %v", got, want)
+	}
+
+	errors := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"nosuchparam", "1"}, "ERR Unknown option or number of arguments for CONFIG SET - 'nosuchparam'"},
+		{[]string{"port", "6380"}, "ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config"},
+		{[]string{"maxmemory", "lots"}, "ERR CONFIG SET failed (possibly related to argument 'maxmemory') - argument must be a memory value"},
+		{[]string{"timeout", "1", "TIMEOUT", "2"}, "ERR CONFIG SET failed (possibly related to argument 'timeout') - duplicate parameter"},
+		{[]string{"dir", filepath.Join(t.TempDir(), "missing")}, "ERR CONFIG SET failed (possibly related to argument 'dir') - No such file or directory"},
+		{[]string{"maxmemory"}, "ERR wrong number of arguments for 'config|set' command"},
+		// Nothing is set if any parameter is refused
+		{[]string{"maxmemory", "1mb", "timeout", "-1"}, "ERR CONFIG SET failed (possibly related to argument 'timeout') - argument must be between 0 and 9223372036854775807 inclusive"},
+	}
+	for _, tt := range errors {
+		if got := sendCommand(t, conn, append([]string{"CONFIG", "SET"}, tt.args...)...); got.Str != tt.want {
+			t.Errorf("CONFIG SET %v = %q, want %q", tt.args, got.Str, tt.want)
+		}
+	}
+	if got := configValues(t, sendCommand(t, conn, "CONFIG", "GET", "maxmemory")); got["maxmemory"] != "10485760" {
+		t.Errorf("maxmemory = %q after refused CONFIG SET, want it unchanged", got["maxmemory"])
+	}
+}
+
+func TestConfigSetRequirePass(t *testing.T) {
+	_, addr := startTestServer(t)
+	admin := dial(t, addr)
+
+	if got := sendCommand(t, admin, "CONFIG", "SET", "requirepass", "secret"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET requirepass = %v, want OK", got)
+	}
+	conn := dial(t, addr)
+	if got := sendCommand(t, conn, "PING"); got.Str != "NOAUTH Authentication required." {
+		t.Errorf("PING without AUTH = %v, want NOAUTH", got)
+	}
+	if got := sendCommand(t, conn, "AUTH", "secret"); got.Str != "OK" {
+		t.Errorf("AUTH = %v, want OK", got)
+	}
+
+	if got := sendCommand(t, admin, "CONFIG", "SET", "requirepass", ""); got.Str != "OK" {
+		t.Fatalf("CONFIG SET requirepass \"\" = %v, want OK", got)
+	}
+	if got := sendCommand(t, dial(t, addr), "PING"); got.Str != "PONG" {
+		t.Errorf("PING after clearing requirepass = %v, want PONG", got)
+	}
+}
+
+func TestConfigSetProtoMaxBulkLen(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "CONFIG", "SET", "proto-max-bulk-len", "1mb"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET proto-max-bulk-len = %v, want OK", got)
+	}
+	got := sendCommand(t, conn, "SET", "big", strings.Repeat("x", 1024*1024+1))
+	if got.Str != "ERR Protocol error: invalid bulk length" {
+		t.Errorf("SET of a value over the limit = %v, want a protocol error", got)
+	}
+}
+
+func TestConfigSetTimeout(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+	admin := dial(t, addr)
+	subscriber := dialPubSub(t, addr)
+	subscriber.send(t, "SUBSCRIBE", "news")
+	subscriber.read(t)
+
+	if got := sendCommand(t, admin, "CONFIG", "SET", "timeout", "1"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET timeout = %v, want OK", got)
+	}
+	idle := dial(t, addr)
+	if got := sendCommand(t, idle, "PING"); got.Str != "PONG" {
+		t.Fatalf("PING = %v, want PONG", got)
+	}
+
+	// The idle client is disconnected, but subscribers are left alone
+	_ = idle.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read from idle client = %v, want EOF", err)
+	}
+	subscriber.send(t, "PING")
+	if got := subscriber.read(t); got.Type != resp.TypeArray || len(got.Array) != 2 || got.Array[0].Str != "pong" {
+		t.Errorf("subscriber PING = %v, want pong", got)
+	}
+}
+
+func TestConfigSetDir(t *testing.T) {
+	st := store.New()
+	stores := persistence.Stores{Strings: store.AsSnapshottable(st)}
+	manager := persistence.NewManager(filepath.Join(t.TempDir(), "dump.rdb"), stores)
+	cfg := DefaultConfig()
+	cfg.Port = 0
+	srv := New(st, store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore(), manager, nil, cfg)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Stop()
+		srv.keyspace.Close()
+	})
+	conn := dial(t, srv.Addr().String())
+
+	dir := t.TempDir()
+	if got := sendCommand(t, conn, "CONFIG", "SET", "dir", dir, "dbfilename", "data.rdb"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET dir dbfilename = %v, want OK", got)
+	}
+	if got := sendCommand(t, conn, "SAVE"); got.Str != "OK" {
+		t.Fatalf("SAVE = %v, want OK", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data.rdb")); err != nil {
+		t.Errorf("Expected the snapshot in the new directory: %v", err)
+	}
+}
+
+// TestConfigSetDirDuringSave checks the snapshot location and format can be
+// changed while a background save is written, which keeps the ones it
+// started with.
+func TestConfigSetDirDuringSave(t *testing.T) {
+	srv, conn, release := startHeldSave(t, Config{})
+	oldPath := srv.persistenceHandler.manager.Path()
+	dir := t.TempDir()
+	if got := sendCommand(t, conn, "CONFIG", "SET", "dir", dir, "dbfilename", "data.rdb", "snapshot-format", "rdb"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET during a save = %v, want OK", got)
+	}
+
+	release()
+	if data, err := os.ReadFile(oldPath); err != nil || bytes.HasPrefix(data, []byte("REDIS")) {
+		t.Errorf("snapshot at the old path = %.9q, %v; want a gob snapshot", data, err)
+	}
+	if got := sendCommand(t, conn, "SAVE"); got.Str != "OK" {
+		t.Fatalf("SAVE = %v, want OK", got)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "data.rdb")); err != nil || !bytes.HasPrefix(data, []byte("REDIS")) {
+		t.Errorf("snapshot at the new path = %.9q, %v; want an RDB snapshot", data, err)
+	}
+}
+
+func TestConfigRewrite(t *testing.T) {
+	_, addr := startTestServer(t)
+	if got := sendCommand(t, dial(t, addr), "CONFIG", "REWRITE"); got.Str != "ERR The server is running without a config file" {
+		t.Errorf("CONFIG REWRITE without a file = %v", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(path, []byte("# Test config\nport 0\nmaxmemory 1mb\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	params, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	cfg := ConfigFromParams(params)
+	cfg.Port = 0
+	_, addr = startTestServerWithConfig(t, cfg)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "CONFIG", "SET", "maxmemory", "2mb", "timeout", "60"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET = %v, want OK", got)
+	}
+	if got := sendCommand(t, conn, "CONFIG", "REWRITE"); got.Str != "OK" {
+		t.Fatalf("CONFIG REWRITE = %v, want OK", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	want := "# Test config\nport 0\nmaxmemory 2097152\n# Generated by CONFIG REWRITE\ntimeout 60\n"
+	if string(data) != want {
+		t.Errorf("Rewritten config file:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestConfigResetStat(t *testing.T) {
+	srv, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "SET", "k", "v")
+	sendCommand(t, conn, "PEXPIRE", "k", "1")
+	time.Sleep(5 * time.Millisecond)
+	sendCommand(t, conn, "GET", "k")
+	if srv.stats.commandsProcessed.Load() == 0 || srv.stats.connectionsReceived.Load() == 0 {
+		t.Fatal("Expected commands and connections to be counted")
+	}
+	if got := srv.stats.expiredKeys(srv.keyspace.ExpiryStats().ExpiredKeys); got != 1 {
+		t.Errorf("expired keys = %d, want 1", got)
+	}
+
+	if got := sendCommand(t, conn, "CONFIG", "RESETSTAT"); got.Str != "OK" {
+		t.Fatalf("CONFIG RESETSTAT = %v, want OK", got)
+	}
+	if got := srv.stats.commandsProcessed.Load(); got != 0 {
+		t.Errorf("commands processed = %d after reset, want 0", got)
+	}
+	if got := srv.stats.expiredKeys(srv.keyspace.ExpiryStats().ExpiredKeys); got != 0 {
+		t.Errorf("expired keys = %d after reset, want 0", got)
+	}
+}
+
+func TestConfigFromParams(t *testing.T) {
+	params := config.New()
+	for name, value := range map[string]string{
+		"port":               "0",
+		"bind":               "127.0.0.1 -::1",
+		"unixsocket":         "/tmp/redis.sock",
+		"unixsocketperm":     "770",
+		"timeout":            "5",
+		"requirepass":        "secret",
+		"proto-max-bulk-len": "2mb",
+		"tls-port":           "6380",
+		"tls-auth-clients":   "optional",
+		"metrics-port":       "9121",
+		"dir":                "/data",
+		"appendonly":         "yes",
+		"appendfsync":        "always",
+	} {
+		if err := params.Set(name, value); err != nil {
+			t.Fatalf("Set(%s) error = %v", name, err)
+		}
+	}
+
+	cfg := ConfigFromParams(params)
+	if cfg.Port != -1 {
+		t.Errorf("Port = %d, want -1 for port 0", cfg.Port)
+	}
+	if !reflect.DeepEqual(cfg.Bind, []string{"127.0.0.1", "-::1"}) {
+		t.Errorf("Bind = %q", cfg.Bind)
+	}
+	if cfg.UnixSocket != "/tmp/redis.sock" || cfg.UnixSocketPerm != 0o770 {
+		t.Errorf("UnixSocket = %q %#o", cfg.UnixSocket, cfg.UnixSocketPerm)
+	}
+	if cfg.Timeout != 5*time.Second || cfg.RequirePass != "secret" || cfg.Protocol.MaxBulkLen != 2*1024*1024 {
+		t.Errorf("Timeout = %v, RequirePass = %q, MaxBulkLen = %d", cfg.Timeout, cfg.RequirePass, cfg.Protocol.MaxBulkLen)
+	}
+	if cfg.TLS == nil || cfg.TLS.Port != 6380 || cfg.TLS.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("TLS = %+v, want port 6380 with optional client certificates", cfg.TLS)
+	}
+	if cfg.Metrics == nil || cfg.Metrics.Port != 9121 {
+		t.Errorf("Metrics = %+v, want port 9121", cfg.Metrics)
+	}
+	if want := (AOFConfig{Path: "/data/appendonly.aof", Fsync: persistence.FsyncAlways, LoadTruncated: true}); cfg.AOF == nil || *cfg.AOF != want {
+		t.Errorf("AOF = %+v, want %+v", cfg.AOF, want)
+	}
+	if cfg.Params != params {
+		t.Error("Params not kept")
+	}
+
+	if cfg := ConfigFromParams(config.New()); cfg.TLS != nil || cfg.Metrics != nil || cfg.AOF != nil || cfg.Port != 6379 {
+		t.Errorf("default Config = %+v, want port 6379 without TLS, metrics or AOF", cfg)
+	}
+}
@@ -0,0 +1,124 @@
+// Package server contains connection command handlers for the Redis server.
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// handleHello handles the HELLO command.
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+// Switches the connection's protocol version, optionally authenticating and
+// naming it, and returns a map describing the server and connection.
+// The reply is encoded in the newly selected protocol.
+func (s *Server) handleHello(c *client, args []resp.Value) resp.Value {
+	proto := c.protocol()
+	if len(args) > 0 {
+		ver, err := strconv.Atoi(args[0].Str)
+		if err != nil {
+			return respError("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != resp.RESP2 && ver != resp.RESP3 {
+			return respError("NOPROTO unsupported protocol version")
+		}
+		proto = ver
+	}
+
+	var username, password, name string
+	auth, setName := false, false
+	for i := 1; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i].Str); {
+		case opt == "AUTH" && remaining >= 2:
+			auth = true
+			username, password = args[i+1].Str, args[i+2].Str
+			i += 2
+		case opt == "SETNAME" && remaining >= 1:
+			setName = true
+			name = args[i+1].Str
+			i++
+		default:
+			return respError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i].Str))
+		}
+	}
+
+	// Nothing changes unless every option is valid
+	if setName && !validClientName(name) {
+		return respError("ERR Client names cannot contain spaces, newlines or special characters.")
+	}
+	if auth && !s.authenticate(c, username, password) {
+		return respError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	if !auth && s.authRequired(c) {
+		return respError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	if setName {
+		c.name = name
+	}
+	c.proto.Store(int32(proto))
+
+	return resp.Value{Type: resp.TypeMap, Array: []resp.Value{
+		respBulkString("server"), respBulkString("redis"),
+		respBulkString("version"), respBulkString(redisVersion),
+		respBulkString("proto"), respInteger(proto),
+		respBulkString("id"), respInteger(int(c.id)),
+		respBulkString("mode"), respBulkString("standalone"),
+		respBulkString("role"), respBulkString("master"),
+		respBulkString("modules"), {Type: resp.TypeArray, Array: []resp.Value{}},
+	}}
+}
+
+// handleAuth handles the AUTH command.
+// AUTH [username] password
+// Without a username, the password is checked against the default user.
+func (s *Server) handleAuth(c *client, args []resp.Value) resp.Value {
+	var username, password string
+	switch len(args) {
+	case 1:
+		if !s.acl.RequiresAuth() {
+			return respError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+		username, password = acl.DefaultUser, args[0].Str
+	case 2:
+		username, password = args[0].Str, args[1].Str
+	default:
+		return respError("ERR wrong number of arguments for 'auth' command")
+	}
+
+	if !s.authenticate(c, username, password) {
+		return respError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	return respSimpleString("OK")
+}
+
+// authenticate checks a username and password and, if they are valid,
+// switches the client to that user. Failures are recorded in the ACL log.
+func (s *Server) authenticate(c *client, username, password string) bool {
+	if !s.acl.Authenticate(username, password) {
+		s.acl.Log().Add("auth", "toplevel", "AUTH", username, c.info())
+		return false
+	}
+	c.user = username
+	c.authenticated = true
+	return true
+}
+
+// authRequired reports whether the client must authenticate before running commands.
+func (s *Server) authRequired(c *client) bool {
+	return !c.authenticated && s.acl.RequiresAuth()
+}
+
+// validClientName reports whether name only holds printable characters other than space.
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// mapReply converts a RESP3 map or RESP2 flat array reply into a Go map.
+func mapReply(v resp.Value) map[string]resp.Value {
+	m := make(map[string]resp.Value)
+	for i := 0; i+1 < len(v.Array); i += 2 {
+		m[v.Array[i].Str] = v.Array[i+1]
+	}
+	return m
+}
+
+func TestHello(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	got := sendCommand(t, conn, "HELLO")
+	if got.Type != resp.TypeArray || mapReply(got)["proto"].Num != 2 {
+		t.Errorf("HELLO = %v, want RESP2 flat array with proto 2", got)
+	}
+
+	got = sendCommand(t, conn, "HELLO", "3")
+	if got.Type != resp.TypeMap {
+		t.Fatalf("HELLO 3 = %v, want map", got)
+	}
+	info := mapReply(got)
+	if info["proto"].Num != 3 || info["server"].Str != "redis" || info["version"].Str != redisVersion || info["role"].Str != "master" {
+		t.Errorf("HELLO 3 = %v", got)
+	}
+	if info["id"].Num <= 0 {
+		t.Errorf("HELLO 3 id = %v, want the connection's client ID", info["id"])
+	}
+
+	got = sendCommand(t, conn, "HELLO", "2")
+	if got.Type != resp.TypeArray || mapReply(got)["proto"].Num != 2 {
+		t.Errorf("HELLO 2 = %v, want flat array with proto 2", got)
+	}
+}
+
+func TestHelloOptions(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"HELLO", "4"}, "NOPROTO unsupported protocol version"},
+		{[]string{"HELLO", "three"}, "ERR Protocol version is not an integer or out of range"},
+		{[]string{"HELLO", "3", "AUTH", "bob", "secret"}, "WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"HELLO", "3", "SETNAME", "my client"}, "ERR Client names cannot contain spaces, newlines or special characters."},
+		{[]string{"HELLO", "3", "AUTH", "default"}, "ERR Syntax error in HELLO option 'AUTH'"},
+		{[]string{"HELLO", "3", "BOGUS"}, "ERR Syntax error in HELLO option 'BOGUS'"},
+		{[]string{"HELLO", "2", "AUTH", "default", "anything", "SETNAME", "worker-1"}, ""},
+	}
+
+	for _, tt := range tests {
+		got := sendCommand(t, conn, tt.args...)
+		if tt.wantErr == "" {
+			if got.Type == resp.TypeError {
+				t.Errorf("%v = %v, want success", tt.args, got)
+			}
+			continue
+		}
+		if got.Type != resp.TypeError || got.Str != tt.wantErr {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.wantErr)
+		}
+	}
+
+	// Failed HELLO calls leave the connection on RESP2
+	if got := sendCommand(t, conn, "HGETALL", "missing"); got.Type != resp.TypeArray {
+		t.Errorf("HGETALL after failed HELLO = %v, want RESP2 array", got)
+	}
+}
+
+func TestRESP3Replies(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "HSET", "hash", "f", "v")
+	sendCommand(t, conn, "SADD", "set", "a", "b")
+
+	if got := sendCommand(t, conn, "HGETALL", "hash"); got.Type != resp.TypeArray || len(got.Array) != 2 {
+		t.Errorf("RESP2 HGETALL = %v, want flat array", got)
+	}
+	if got := sendCommand(t, conn, "GET", "missing"); got.Type != resp.TypeBulkString || !got.Null {
+		t.Errorf("RESP2 GET missing = %v, want null bulk string", got)
+	}
+
+	sendCommand(t, conn, "HELLO", "3")
+
+	tests := []struct {
+		args     []string
+		wantType byte
+	}{
+		{[]string{"HGETALL", "hash"}, resp.TypeMap},
+		{[]string{"SMEMBERS", "set"}, resp.TypeSet},
+		{[]string{"SINTER", "set"}, resp.TypeSet},
+		{[]string{"GET", "missing"}, resp.TypeNull},
+		{[]string{"BLPOP", "missing", "0.01"}, resp.TypeNull},
+		{[]string{"LRANGE", "missing", "0", "-1"}, resp.TypeArray},
+	}
+	for _, tt := range tests {
+		if got := sendCommand(t, conn, tt.args...); got.Type != tt.wantType {
+			t.Errorf("RESP3 %v = %v, want type %c", tt.args, got, tt.wantType)
+		}
+	}
+
+	if got := sendCommand(t, conn, "HGETALL", "hash"); len(got.Array) != 2 || got.Array[0].Str != "f" || got.Array[1].Str != "v" {
+		t.Errorf("RESP3 HGETALL = %v, want map f => v", got)
+	}
+}
+
+func TestRESP3PubSubPushes(t *testing.T) {
+	_, ps, addr := startPubSubTestServer(t)
+	c := dialPubSub(t, addr)
+
+	c.send(t, "HELLO", "3")
+	c.read(t)
+	c.send(t, "SUBSCRIBE", "news")
+	if got := c.read(t); got.Type != resp.TypePush || got.Array[0].Str != "subscribe" {
+		t.Fatalf("SUBSCRIBE = %v, want subscribe push", got)
+	}
+
+	// RESP3 clients can keep issuing regular commands while subscribed
+	c.send(t, "SET", "k", "v")
+	if got := c.read(t); got.Str != "OK" {
+		t.Errorf("SET while subscribed = %v, want OK", got)
+	}
+	c.send(t, "PING")
+	if got := c.read(t); got.Type != resp.TypeSimpleString || got.Str != "PONG" {
+		t.Errorf("PING while subscribed = %v, want +PONG", got)
+	}
+
+	waitForSubscribers(t, ps, "news", 1)
+	sendCommand(t, dial(t, addr), "PUBLISH", "news", "hello")
+	if got := c.read(t); got.Type != resp.TypePush || len(got.Array) != 3 || got.Array[0].Str != "message" || got.Array[2].Str != "hello" {
+		t.Errorf("published message = %v, want push [message news hello]", got)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	_, addr := startTestServerWithConfig(t, Config{RequirePass: "s3cret"})
+	conn := dial(t, addr)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"GET", "k"}, "NOAUTH Authentication required."},
+		{[]string{"MULTI"}, "NOAUTH Authentication required."},
+		{[]string{"SUBSCRIBE", "news"}, "NOAUTH Authentication required."},
+		{[]string{"HELLO", "3"}, "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"},
+		{[]string{"AUTH", "wrong"}, "WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH", "bob", "s3cret"}, "WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH"}, "ERR wrong number of arguments for 'auth' command"},
+		{[]string{"PING"}, "NOAUTH Authentication required."},
+	}
+	for _, tt := range tests {
+		if got := sendCommand(t, conn, tt.args...); got.Type != resp.TypeError || got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	if got := sendCommand(t, conn, "AUTH", "s3cret"); got.Str != "OK" {
+		t.Fatalf("AUTH s3cret = %v, want OK", got)
+	}
+	if got := sendCommand(t, conn, "SET", "k", "v"); got.Str != "OK" {
+		t.Errorf("SET after AUTH = %v, want OK", got)
+	}
+
+	// Authentication belongs to the connection
+	other := dial(t, addr)
+	if got := sendCommand(t, other, "GET", "k"); got.Str != "NOAUTH Authentication required." {
+		t.Errorf("GET on new connection = %v, want NOAUTH", got)
+	}
+	if got := sendCommand(t, other, "AUTH", "default", "s3cret"); got.Str != "OK" {
+		t.Fatalf("AUTH default s3cret = %v, want OK", got)
+	}
+	if got := sendCommand(t, other, "GET", "k"); got.Str != "v" {
+		t.Errorf("GET after AUTH default = %v, want v", got)
+	}
+}
+
+func TestHelloAuth(t *testing.T) {
+	_, addr := startTestServerWithConfig(t, Config{RequirePass: "s3cret"})
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "HELLO", "3", "AUTH", "default", "wrong"); got.Type != resp.TypeError {
+		t.Fatalf("HELLO with wrong password = %v, want error", got)
+	}
+	if got := sendCommand(t, conn, "HELLO", "3", "AUTH", "default", "s3cret"); got.Type != resp.TypeMap {
+		t.Fatalf("HELLO with password = %v, want map", got)
+	}
+	if got := sendCommand(t, conn, "DBSIZE"); got.Type != resp.TypeInteger {
+		t.Errorf("DBSIZE after HELLO AUTH = %v, want integer", got)
+	}
+}
+
+func TestAuthWithoutRequirePass(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "PING"); got.Str != "PONG" {
+		t.Errorf("PING without requirepass = %v, want PONG", got)
+	}
+	want := "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"
+	if got := sendCommand(t, conn, "AUTH", "anything"); got.Str != want {
+		t.Errorf("AUTH anything = %v, want %q", got, want)
+	}
+	if got := sendCommand(t, conn, "AUTH", "default", "anything"); got.Str != "OK" {
+		t.Errorf("AUTH default anything = %v, want OK", got)
+	}
+}
@@ -0,0 +1,79 @@
+// Package server contains the DIFF command, which compares the dataset with
+// a snapshot file.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// handleDiff handles the DIFF command.
+// DIFF path [JSON]
+// Compares the snapshot file at path, relative to dir, with the dataset.
+// Returns the changes that turn the snapshot into the dataset, one per line,
+// formatted for people or, with JSON, as JSON objects.
+// The file is read and compared without holding execMu; if execMu isn't nil,
+// it is locked only while the dataset is copied. Inside MULTI it is nil, as
+// EXEC already holds it.
+func (s *Server) handleDiff(args []resp.Value, execMu sync.Locker) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return respError("ERR wrong number of arguments for 'diff' command")
+	}
+	asJSON := false
+	if len(args) == 2 {
+		if !strings.EqualFold(args[1].Str, "JSON") {
+			return respError("ERR syntax error")
+		}
+		asJSON = true
+	}
+
+	path := args[0].Str
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.params.String("dir"), path)
+	}
+	snapshot, err := persistence.ReadSnapshot(path)
+	if errors.Is(err, persistence.ErrNoSnapshot) {
+		return respError("ERR no snapshot file at " + path)
+	}
+	if err != nil {
+		return respError("ERR " + err.Error())
+	}
+
+	if execMu != nil {
+		execMu.Lock()
+	}
+	live := persistence.NewManager("", s.keyspaceStores()).Snapshot()
+	if execMu != nil {
+		execMu.Unlock()
+	}
+	changes := persistence.Diff(snapshot, live)
+	lines := make([]resp.Value, len(changes))
+	for i, change := range changes {
+		line := change.String()
+		if asJSON {
+			data, _ := json.Marshal(change)
+			line = string(data)
+		}
+		lines[i] = respBulkString(line)
+	}
+	return resp.Value{Type: resp.TypeArray, Array: lines}
+}
+
+// keyspaceStores returns the keyspace's stores, for snapshotting.
+func (s *Server) keyspaceStores() persistence.Stores {
+	return persistence.Stores{
+		Strings: store.AsSnapshottable(s.keyspace.Strings()),
+		Lists:   store.AsSnapshottable(s.keyspace.Lists()),
+		Hashes:  store.AsSnapshottable(s.keyspace.Hashes()),
+		Sets:    store.AsSnapshottable(s.keyspace.Sets()),
+		ZSets:   store.AsSnapshottable(s.keyspace.ZSets()),
+		Streams: store.AsSnapshottable(s.keyspace.Streams()),
+	}
+}
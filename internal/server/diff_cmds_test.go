@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/config"
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	params := config.New()
+	_ = params.Set("dir", dir)
+	cfg := ConfigFromParams(params)
+	cfg.Port = 0
+	srv, addr := startTestServerWithConfig(t, cfg)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "SET", "kept", "v")
+	sendCommand(t, conn, "SET", "changed", "old")
+	sendCommand(t, conn, "RPUSH", "list", "a")
+	manager := persistence.NewManager(filepath.Join(dir, "before.rdb"), srv.keyspaceStores())
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	sendCommand(t, conn, "SET", "changed", "new")
+	sendCommand(t, conn, "RPUSH", "list", "b")
+	sendCommand(t, conn, "DEL", "kept")
+	sendCommand(t, conn, "HSET", "hash", "f", "v")
+
+	want := []string{
+		`~ "changed" (string) value: "old" -> "new"`,
+		`+ "hash" (hash)`,
+		`- "kept" (string)`,
+		`~ "list" (list) element 1 added: "b"`,
+	}
+	if got := argStrings(sendCommand(t, conn, "DIFF", "before.rdb").Array); !reflect.DeepEqual(got, want) {
+		t.Errorf("DIFF = %q, want %q", got, want)
+	}
+
+	lines := sendCommand(t, conn, "DIFF", filepath.Join(dir, "before.rdb"), "json").Array
+	var change persistence.Change
+	if err := json.Unmarshal([]byte(lines[0].Str), &change); err != nil {
+		t.Fatalf("DIFF JSON line %q: %v", lines[0].Str, err)
+	}
+	if change != (persistence.Change{Op: persistence.ChangeModified, Key: "changed", Type: "string", Part: "value", Old: "old", New: "new"}) {
+		t.Errorf("first DIFF JSON change = %+v", change)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"DIFF"}, "ERR wrong number of arguments"},
+		{[]string{"DIFF", "before.rdb", "XML"}, "ERR syntax error"},
+		{[]string{"DIFF", "missing.rdb"}, "ERR no snapshot file"},
+	}
+	for _, tt := range tests {
+		if got := sendCommand(t, conn, tt.args...); got.Type != resp.TypeError || !strings.HasPrefix(got.Str, tt.want) {
+			t.Errorf("%v = %v, want an error starting %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestDiffDecodesWithoutLock checks DIFF reads the snapshot file before it
+// takes the execution lock, and still runs inside MULTI, which holds it.
+func TestDiffDecodesWithoutLock(t *testing.T) {
+	dir := t.TempDir()
+	params := config.New()
+	_ = params.Set("dir", dir)
+	cfg := ConfigFromParams(params)
+	cfg.Port = 0
+	srv, addr := startTestServerWithConfig(t, cfg)
+	conn := dial(t, addr)
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.rdb"), []byte("REDIS0011garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got resp.Value
+	func() {
+		srv.execMu.Lock()
+		defer srv.execMu.Unlock()
+		got = receive(t, sendAsync(conn, "DIFF", "corrupt.rdb"))
+	}()
+	if got.Type != resp.TypeError {
+		t.Errorf("DIFF of a corrupt file = %v, want an error", got)
+	}
+
+	if err := persistence.NewManager(filepath.Join(dir, "dump.rdb"), srv.keyspaceStores()).Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "SET", "k", "v")
+	sendCommand(t, conn, "DIFF", "dump.rdb")
+	reply := sendCommand(t, conn, "EXEC")
+	if len(reply.Array) != 2 || !reflect.DeepEqual(argStrings(reply.Array[1].Array), []string{`+ "k" (string)`}) {
+		t.Errorf("EXEC = %v, want DIFF to report k", reply)
+	}
+}
@@ -0,0 +1,166 @@
+// Package server implements key expiration command handlers.
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// handleExpire handles the EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT commands.
+// EXPIRE key seconds [NX | XX | GT | LT]
+// Returns 1 if the timeout was set, 0 if the key doesn't exist or a condition wasn't met.
+// A time in the past deletes the key.
+func (s *Server) handleExpire(cmd string, args []resp.Value) resp.Value {
+	name := strings.ToLower(cmd)
+	if len(args) < 2 {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+
+	key := args[0].Str
+	n, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return respError("ERR value is not an integer or out of range")
+	}
+
+	var nx, xx, gt, lt bool
+	for _, arg := range args[2:] {
+		switch strings.ToUpper(arg.Str) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return respError(fmt.Sprintf("ERR Unsupported option %s", arg.Str))
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return respError("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return respError("ERR GT and LT options at the same time are not compatible")
+	}
+
+	at, ok := expireTime(cmd, n)
+	if !ok {
+		return respError(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
+	}
+
+	if !s.keyspace.Exists(key) {
+		return respInteger(0)
+	}
+
+	// A key without a timeout is treated as having an infinite TTL for GT and LT
+	current, volatile := s.keyspace.ExpiresAt(key)
+	switch {
+	case nx && volatile,
+		xx && !volatile,
+		gt && (!volatile || !at.After(current)),
+		lt && volatile && !at.Before(current):
+		return respInteger(0)
+	}
+
+	if !s.keyspace.Expire(key, at) {
+		return respInteger(0)
+	}
+	return respInteger(1)
+}
+
+// expireTime converts the argument of an EXPIRE family command into an absolute time.
+// Returns false if the time overflows.
+func expireTime(cmd string, n int64) (time.Time, bool) {
+	ms := n
+	if cmd == "EXPIRE" || cmd == "EXPIREAT" {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return time.Time{}, false
+		}
+		ms = n * 1000
+	}
+
+	if cmd == "EXPIRE" || cmd == "PEXPIRE" {
+		now := time.Now().UnixMilli()
+		if (ms > 0 && now > math.MaxInt64-ms) || (ms < 0 && now < math.MinInt64-ms) {
+			return time.Time{}, false
+		}
+		ms += now
+	}
+
+	return time.UnixMilli(ms), true
+}
+
+// handlePersist handles the PERSIST command.
+// PERSIST key
+// Returns 1 if the timeout was removed, 0 if the key doesn't exist or has no timeout.
+func (s *Server) handlePersist(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return respError("ERR wrong number of arguments for 'persist' command")
+	}
+
+	if s.keyspace.Persist(args[0].Str) {
+		return respInteger(1)
+	}
+	return respInteger(0)
+}
+
+// handleTTL handles the TTL and PTTL commands.
+// TTL key
+// Returns the remaining time to live in seconds (milliseconds for PTTL),
+// -2 if the key doesn't exist, or -1 if it has no timeout.
+func (s *Server) handleTTL(cmd string, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	}
+
+	key := args[0].Str
+	if !s.keyspace.Exists(key) {
+		return respInteger(-2) // key does not exist
+	}
+
+	at, volatile := s.keyspace.ExpiresAt(key)
+	if !volatile {
+		return respInteger(-1) // key exists but has no TTL
+	}
+
+	remaining := time.Until(at).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	if cmd == "TTL" {
+		// Round to the nearest second, as Redis does
+		return respInteger(int((remaining + 500) / 1000))
+	}
+	return respInteger(int(remaining))
+}
+
+// handleExpireTime handles the EXPIRETIME and PEXPIRETIME commands.
+// EXPIRETIME key
+// Returns the absolute Unix time in seconds (milliseconds for PEXPIRETIME) at
+// which the key expires, -2 if the key doesn't exist, or -1 if it has no timeout.
+func (s *Server) handleExpireTime(cmd string, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	}
+
+	key := args[0].Str
+	if !s.keyspace.Exists(key) {
+		return respInteger(-2)
+	}
+
+	at, volatile := s.keyspace.ExpiresAt(key)
+	if !volatile {
+		return respInteger(-1)
+	}
+
+	if cmd == "EXPIRETIME" {
+		return respInteger(int(at.Unix()))
+	}
+	return respInteger(int(at.UnixMilli()))
+}
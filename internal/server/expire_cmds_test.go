@@ -0,0 +1,205 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// runCommand executes a command directly against the server and returns the reply.
+func runCommand(srv *Server, args ...string) resp.Value {
+	return srv.executeCommand(nil, resp.Value{Type: resp.TypeArray, Array: makeArgs(args...)})
+}
+
+func TestHandleExpireAllTypes(t *testing.T) {
+	srv := createTestServer(t)
+
+	runCommand(srv, "SET", "str", "v")
+	runCommand(srv, "RPUSH", "list", "a")
+	runCommand(srv, "HSET", "hash", "f", "v")
+	runCommand(srv, "SADD", "set", "m")
+
+	for _, key := range []string{"str", "list", "hash", "set"} {
+		if got := runCommand(srv, "EXPIRE", key, "100"); got.Num != 1 {
+			t.Errorf("EXPIRE %s = %v, want 1", key, got)
+		}
+		if got := runCommand(srv, "TTL", key); got.Num != 100 {
+			t.Errorf("TTL %s = %v, want 100", key, got)
+		}
+		if got := runCommand(srv, "PTTL", key); got.Num <= 99000 || got.Num > 100000 {
+			t.Errorf("PTTL %s = %v, want about 100000", key, got)
+		}
+		if got := runCommand(srv, "PERSIST", key); got.Num != 1 {
+			t.Errorf("PERSIST %s = %v, want 1", key, got)
+		}
+		if got := runCommand(srv, "TTL", key); got.Num != -1 {
+			t.Errorf("TTL %s after PERSIST = %v, want -1", key, got)
+		}
+	}
+}
+
+func TestHandleExpireVariants(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "RPUSH", "list", "a")
+
+	at := time.Now().Add(time.Hour)
+	sec := strconv.FormatInt(at.Unix(), 10)
+	ms := strconv.FormatInt(at.UnixMilli(), 10)
+
+	if got := runCommand(srv, "EXPIREAT", "list", sec); got.Num != 1 {
+		t.Fatalf("EXPIREAT = %v, want 1", got)
+	}
+	if got := runCommand(srv, "EXPIRETIME", "list"); strconv.Itoa(got.Num) != sec {
+		t.Errorf("EXPIRETIME = %v, want %s", got, sec)
+	}
+
+	if got := runCommand(srv, "PEXPIREAT", "list", ms); got.Num != 1 {
+		t.Fatalf("PEXPIREAT = %v, want 1", got)
+	}
+	if got := runCommand(srv, "PEXPIRETIME", "list"); strconv.Itoa(got.Num) != ms {
+		t.Errorf("PEXPIRETIME = %v, want %s", got, ms)
+	}
+
+	if got := runCommand(srv, "PEXPIRE", "list", "5000"); got.Num != 1 {
+		t.Fatalf("PEXPIRE = %v, want 1", got)
+	}
+	if got := runCommand(srv, "TTL", "list"); got.Num != 5 {
+		t.Errorf("TTL after PEXPIRE = %v, want 5", got)
+	}
+
+	// A time in the past deletes the key
+	if got := runCommand(srv, "PEXPIREAT", "list", "1"); got.Num != 1 {
+		t.Fatalf("PEXPIREAT in the past = %v, want 1", got)
+	}
+	if got := runCommand(srv, "EXISTS", "list"); got.Num != 0 {
+		t.Errorf("EXISTS after PEXPIREAT in the past = %v, want 0", got)
+	}
+}
+
+func TestHandleExpireMissingKey(t *testing.T) {
+	srv := createTestServer(t)
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"EXPIRE", "missing", "10"}, 0},
+		{[]string{"PEXPIRE", "missing", "10"}, 0},
+		{[]string{"EXPIREAT", "missing", "10"}, 0},
+		{[]string{"PEXPIREAT", "missing", "10"}, 0},
+		{[]string{"PERSIST", "missing"}, 0},
+		{[]string{"TTL", "missing"}, -2},
+		{[]string{"PTTL", "missing"}, -2},
+		{[]string{"EXPIRETIME", "missing"}, -2},
+		{[]string{"PEXPIRETIME", "missing"}, -2},
+	}
+
+	for _, tt := range tests {
+		got := runCommand(srv, tt.args...)
+		if got.Type != resp.TypeInteger || got.Num != tt.want {
+			t.Errorf("%v = %v, want %d", tt.args, got, tt.want)
+		}
+	}
+
+	runCommand(srv, "SET", "key", "v")
+	for _, cmd := range []string{"TTL", "PTTL", "EXPIRETIME", "PEXPIRETIME"} {
+		if got := runCommand(srv, cmd, "key"); got.Num != -1 {
+			t.Errorf("%s on key without TTL = %v, want -1", cmd, got)
+		}
+	}
+}
+
+func TestHandleExpireOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string // initial TTL in seconds, empty for none
+		args    []string
+		want    int
+	}{
+		{"NX without ttl", "", []string{"100", "NX"}, 1},
+		{"NX with ttl", "50", []string{"100", "NX"}, 0},
+		{"XX without ttl", "", []string{"100", "XX"}, 0},
+		{"XX with ttl", "50", []string{"100", "XX"}, 1},
+		{"GT without ttl", "", []string{"100", "GT"}, 0},
+		{"GT greater", "50", []string{"100", "GT"}, 1},
+		{"GT smaller", "50", []string{"10", "GT"}, 0},
+		{"LT without ttl", "", []string{"100", "LT"}, 1},
+		{"LT smaller", "50", []string{"10", "LT"}, 1},
+		{"LT greater", "50", []string{"100", "LT"}, 0},
+		{"XX GT combined", "50", []string{"100", "XX", "GT"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := createTestServer(t)
+			runCommand(srv, "HSET", "key", "f", "v")
+			if tt.initial != "" {
+				runCommand(srv, "EXPIRE", "key", tt.initial)
+			}
+
+			got := runCommand(srv, append([]string{"EXPIRE", "key"}, tt.args...)...)
+			if got.Type != resp.TypeInteger || got.Num != tt.want {
+				t.Errorf("EXPIRE key %v = %v, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleExpireErrors(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "SET", "key", "v")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"missing args", []string{"EXPIRE", "key"}, "ERR wrong number of arguments for 'expire' command"},
+		{"not an integer", []string{"EXPIRE", "key", "abc"}, "ERR value is not an integer or out of range"},
+		{"unknown option", []string{"EXPIRE", "key", "10", "YY"}, "ERR Unsupported option YY"},
+		{"NX and XX", []string{"EXPIRE", "key", "10", "NX", "XX"}, "ERR NX and XX, GT or LT options at the same time are not compatible"},
+		{"GT and LT", []string{"EXPIRE", "key", "10", "GT", "LT"}, "ERR GT and LT options at the same time are not compatible"},
+		{"overflow", []string{"EXPIRE", "key", "9223372036854775807"}, "ERR invalid expire time in 'expire' command"},
+		{"pttl args", []string{"PTTL"}, "ERR wrong number of arguments for 'pttl' command"},
+		{"persist args", []string{"PERSIST", "a", "b"}, "ERR wrong number of arguments for 'persist' command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runCommand(srv, tt.args...)
+			if got.Type != resp.TypeError || got.Str != tt.want {
+				t.Errorf("%v = %v, want error %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpireCollectionsOverTCP(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "SADD", "myset", "a", "b")
+	if got := sendCommand(t, conn, "PEXPIRE", "myset", "50"); got.Num != 1 {
+		t.Fatalf("PEXPIRE = %v, want 1", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if got := sendCommand(t, conn, "SCARD", "myset"); got.Num != 0 {
+		t.Errorf("SCARD after expiry = %v, want 0", got)
+	}
+	if got := sendCommand(t, conn, "TTL", "myset"); got.Num != -2 {
+		t.Errorf("TTL after expiry = %v, want -2", got)
+	}
+	if got := sendCommand(t, conn, "TYPE", "myset"); got.Str != "none" {
+		t.Errorf("TYPE after expiry = %v, want none", got)
+	}
+}
@@ -9,26 +9,23 @@ import (
 // HashCommands handles Redis hash commands.
 // This struct is designed to be integrated with Server during the integration phase.
 type HashCommands struct {
-	hashStore   store.HashStore
-	stringStore store.Store // For type checking against string keys
+	hashStore store.HashStore
+	keyspace  *store.Keyspace // For type checking against keys of other types
 }
 
-// NewHashCommands creates a new HashCommands handler.
-func NewHashCommands(hashStore store.HashStore, stringStore store.Store) *HashCommands {
+// NewHashCommands creates a new HashCommands handler operating on the keyspace's hash store.
+func NewHashCommands(keyspace *store.Keyspace) *HashCommands {
 	return &HashCommands{
-		hashStore:   hashStore,
-		stringStore: stringStore,
+		hashStore: keyspace.Hashes(),
+		keyspace:  keyspace,
 	}
 }
 
-// wrongTypeError is the standard Redis error for type mismatches.
-const wrongTypeError = "WRONGTYPE Operation against a key holding the wrong kind of value"
-
-// checkKeyType returns an error response if the key exists in the string store.
+// checkKeyType returns an error response if the key holds a type other than hash.
 func (h *HashCommands) checkKeyType(key string) *resp.Value {
-	if _, exists := h.stringStore.Get(key); exists {
-		err := respError(wrongTypeError)
-		return &err
+	if err := h.keyspace.CheckType(key, store.TypeHash); err != nil {
+		errResp := respError(err.Error())
+		return &errResp
 	}
 	return nil
 }
@@ -48,7 +45,7 @@ func (h *HashCommands) HandleHSet(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string keys
+	// Check for type conflict with other types
 	if err := h.checkKeyType(key); err != nil {
 		return *err
 	}
@@ -74,7 +71,7 @@ func (h *HashCommands) HandleHGet(args []resp.Value) resp.Value {
 	key := args[0].Str
 	field := args[1].Str
 
-	// Check for type conflict with string keys
+	// Check for type conflict with other types
 	if err := h.checkKeyType(key); err != nil {
 		return *err
 	}
@@ -96,7 +93,7 @@ func (h *HashCommands) HandleHDel(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string keys
+	// Check for type conflict with other types
 	if err := h.checkKeyType(key); err != nil {
 		return *err
 	}
@@ -112,7 +109,7 @@ func (h *HashCommands) HandleHDel(args []resp.Value) resp.Value {
 
 // HandleHGetAll handles the HGETALL command.
 // HGETALL key
-// Returns all fields and values as an array [field1, value1, field2, value2, ...].
+// Returns all fields and values as a map, which RESP2 clients receive as [field1, value1, ...].
 func (h *HashCommands) HandleHGetAll(args []resp.Value) resp.Value {
 	if len(args) != 1 {
 		return respError("ERR wrong number of arguments for 'hgetall' command")
@@ -120,20 +117,20 @@ func (h *HashCommands) HandleHGetAll(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string keys
+	// Check for type conflict with other types
 	if err := h.checkKeyType(key); err != nil {
 		return *err
 	}
 
 	hash := h.hashStore.HGetAll(key)
 
-	// Build the flat array response
+	// RESP3 clients get a map; RESP2 clients see it as a flat array
 	array := make([]resp.Value, 0, len(hash)*2)
 	for field, value := range hash {
 		array = append(array, respBulkString(field), respBulkString(value))
 	}
 
-	return resp.Value{Type: resp.TypeArray, Array: array}
+	return resp.Value{Type: resp.TypeMap, Array: array}
 }
 
 // HandleHKeys handles the HKEYS command.
@@ -146,7 +143,7 @@ func (h *HashCommands) HandleHKeys(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string keys
+	// Check for type conflict with other types
 	if err := h.checkKeyType(key); err != nil {
 		return *err
 	}
@@ -171,7 +168,7 @@ func (h *HashCommands) HandleHLen(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string keys
+	// Check for type conflict with other types
 	if err := h.checkKeyType(key); err != nil {
 		return *err
 	}
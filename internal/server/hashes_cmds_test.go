@@ -11,7 +11,8 @@ import (
 func newTestHashCommands() (*HashCommands, store.HashStore, store.Store) {
 	hashStore := store.NewHashStore()
 	stringStore := store.New()
-	return NewHashCommands(hashStore, stringStore), hashStore, stringStore
+	keyspace := store.NewKeyspace(stringStore, store.NewListStore(), hashStore, store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore())
+	return NewHashCommands(keyspace), hashStore, stringStore
 }
 
 func makeArgs(strs ...string) []resp.Value {
@@ -275,14 +276,14 @@ func TestHandleHGetAll(t *testing.T) {
 				hs.HSet("myhash", "field1", "value1", "field2", "value2")
 			},
 			args:       []string{"myhash"},
-			wantType:   resp.TypeArray,
+			wantType:   resp.TypeMap,
 			wantLen:    4, // 2 fields * 2 (field + value)
 			wantFields: map[string]string{"field1": "value1", "field2": "value2"},
 		},
 		{
 			name:     "get all from non-existent key",
 			args:     []string{"myhash"},
-			wantType: resp.TypeArray,
+			wantType: resp.TypeMap,
 			wantLen:  0,
 		},
 		{
@@ -317,7 +318,7 @@ func TestHandleHGetAll(t *testing.T) {
 				t.Errorf("HandleHGetAll() type = %c, want %c", result.Type, tt.wantType)
 			}
 
-			if tt.wantType == resp.TypeArray {
+			if tt.wantType == resp.TypeMap {
 				if len(result.Array) != tt.wantLen {
 					t.Errorf("HandleHGetAll() array len = %d, want %d", len(result.Array), tt.wantLen)
 				}
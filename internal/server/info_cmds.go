@@ -0,0 +1,193 @@
+// Package server contains the INFO command handler for the Redis server.
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// infoSection is one section of INFO: a title and its fields in order.
+type infoSection struct {
+	name   string
+	fields func(s *Server) [][2]string
+}
+
+// infoSections are the INFO sections, in the order they are reported.
+var infoSections = []infoSection{
+	{"Server", (*Server).serverInfo},
+	{"Clients", (*Server).clientsInfo},
+	{"Memory", (*Server).memoryInfo},
+	{"Persistence", (*Server).persistenceInfo},
+	{"Stats", (*Server).statsInfo},
+	{"Keyspace", (*Server).keyspaceInfo},
+}
+
+// handleInfo handles the INFO command.
+// INFO [section [section ...]]
+// With no sections, or "default", "all" or "everything", every section is
+// reported. Unknown sections are ignored.
+func (s *Server) handleInfo(args []resp.Value) resp.Value {
+	all := len(args) == 0
+	wanted := make(map[string]bool, len(args))
+	for _, arg := range args {
+		name := strings.ToLower(arg.Str)
+		switch name {
+		case "default", "all", "everything":
+			all = true
+		default:
+			wanted[name] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[strings.ToLower(section.name)] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", section.name)
+		for _, field := range section.fields(s) {
+			fmt.Fprintf(&b, "%s:%s\r\n", field[0], field[1])
+		}
+	}
+	return respBulkString(b.String())
+}
+
+func (s *Server) serverInfo() [][2]string {
+	now := time.Now()
+	uptime := int64(now.Sub(s.startTime).Seconds())
+	return [][2]string{
+		{"redis_version", redisVersion},
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS + " " + runtime.GOARCH},
+		{"arch_bits", strconv.Itoa(strconv.IntSize)},
+		{"go_version", runtime.Version()},
+		{"process_id", strconv.Itoa(os.Getpid())},
+		{"run_id", s.runID},
+		{"tcp_port", strconv.Itoa(s.tcpPort())},
+		{"server_time_usec", strconv.FormatInt(now.UnixMicro(), 10)},
+		{"uptime_in_seconds", strconv.FormatInt(uptime, 10)},
+		{"uptime_in_days", strconv.FormatInt(uptime/86400, 10)},
+		{"config_file", s.params.Path()},
+	}
+}
+
+func (s *Server) clientsInfo() [][2]string {
+	return [][2]string{
+		{"connected_clients", strconv.FormatInt(s.connectedClients.Load(), 10)},
+		{"blocked_clients", strconv.Itoa(s.blocking.blockedClients())},
+	}
+}
+
+func (s *Server) memoryInfo() [][2]string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	maxmemory := s.params.Int("maxmemory")
+	return [][2]string{
+		{"used_memory", strconv.FormatUint(mem.HeapAlloc, 10)},
+		{"used_memory_human", bytesToHuman(int64(mem.HeapAlloc))},
+		{"maxmemory", strconv.Itoa(maxmemory)},
+		{"maxmemory_human", bytesToHuman(int64(maxmemory))},
+	}
+}
+
+func (s *Server) persistenceInfo() [][2]string {
+	saving, status := false, "ok"
+	aofStatus := "ok"
+	if s.aofLastWriteErr != nil {
+		aofStatus = "err"
+	}
+	if s.persistenceHandler != nil {
+		m := s.persistenceHandler.manager
+		saving = m.IsSaving()
+		if m.LastBackgroundSaveErr() != nil {
+			status = "err"
+		}
+	}
+	return [][2]string{
+		{"loading", "0"},
+		{"rdb_changes_since_last_save", strconv.FormatInt(s.changesSinceSave(), 10)},
+		{"rdb_bgsave_in_progress", boolInfo(saving)},
+		{"rdb_last_save_time", strconv.FormatInt(s.lastSave().Unix(), 10)},
+		{"rdb_last_bgsave_status", status},
+		{"aof_enabled", boolInfo(s.aof != nil)},
+		{"aof_last_write_status", aofStatus},
+	}
+}
+
+func (s *Server) statsInfo() [][2]string {
+	channels, patterns := 0, 0
+	if s.pubsubHandler != nil {
+		channels, patterns = s.pubsubHandler.ps.ChannelCount(), s.pubsubHandler.ps.PatternCount()
+	}
+	expired := s.stats.expiredKeys(s.keyspace.ExpiryStats().ExpiredKeys)
+	return [][2]string{
+		{"total_connections_received", strconv.FormatInt(s.stats.connectionsReceived.Load(), 10)},
+		{"total_commands_processed", strconv.FormatInt(s.stats.commandsProcessed.Load(), 10)},
+		{"expired_keys", strconv.FormatInt(expired, 10)},
+		{"pubsub_channels", strconv.Itoa(channels)},
+		{"pubsub_patterns", strconv.Itoa(patterns)},
+	}
+}
+
+// keyspaceInfo reports db0, the only database, if it holds any keys.
+func (s *Server) keyspaceInfo() [][2]string {
+	keys := s.keyspace.Size()
+	if keys == 0 {
+		return nil
+	}
+	expires := s.keyspace.ExpiryStats().VolatileKeys
+	return [][2]string{
+		{"db0", fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", keys, expires)},
+	}
+}
+
+// tcpPort returns the port of the first plaintext TCP listener, or 0 if
+// there is none.
+func (s *Server) tcpPort() int {
+	if addr, ok := s.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// newRunID returns a random identifier for this run of the server, 40 hex
+// characters as in Redis.
+func newRunID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func boolInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// bytesToHuman formats a byte count the way INFO does, e.g. "1.50M".
+func bytesToHuman(n int64) string {
+	const unit = 1024
+	switch {
+	case n < unit:
+		return fmt.Sprintf("%dB", n)
+	case n < unit*unit:
+		return fmt.Sprintf("%.2fK", float64(n)/unit)
+	case n < unit*unit*unit:
+		return fmt.Sprintf("%.2fM", float64(n)/(unit*unit))
+	default:
+		return fmt.Sprintf("%.2fG", float64(n)/(unit*unit*unit))
+	}
+}
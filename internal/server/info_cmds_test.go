@@ -0,0 +1,215 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// infoFields sends INFO with args and returns its sections and fields.
+func infoFields(t *testing.T, conn net.Conn, args ...string) ([]string, map[string]string) {
+	t.Helper()
+	v := sendCommand(t, conn, append([]string{"INFO"}, args...)...)
+	if v.Type != resp.TypeBulkString {
+		t.Fatalf("INFO %v = %v, want a bulk string", args, v)
+	}
+	var sections []string
+	fields := make(map[string]string)
+	for _, line := range strings.Split(v.Str, "\r\n") {
+		if name, ok := strings.CutPrefix(line, "# "); ok {
+			sections = append(sections, name)
+		} else if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+	return sections, fields
+}
+
+func TestInfoSections(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+	sendCommand(t, conn, "SET", "k", "v")
+
+	everything := []string{"Server", "Clients", "Memory", "Persistence", "Stats", "Keyspace"}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, everything},
+		{[]string{"all"}, everything},
+		{[]string{"EVERYTHING"}, everything},
+		{[]string{"server"}, []string{"Server"}},
+		{[]string{"keyspace", "CLIENTS"}, []string{"Clients", "Keyspace"}},
+		{[]string{"nosuchsection"}, nil},
+	}
+	for _, tt := range tests {
+		if got, _ := infoFields(t, conn, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("INFO %v sections = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestInfoServer(t *testing.T) {
+	srv, addr := startTestServer(t)
+	_, fields := infoFields(t, dial(t, addr), "server")
+
+	port := strconv.Itoa(srv.Addr().(*net.TCPAddr).Port)
+	want := map[string]string{"redis_version": redisVersion, "redis_mode": "standalone", "tcp_port": port, "uptime_in_days": "0"}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, fields[key], value)
+		}
+	}
+	if len(fields["run_id"]) != 40 {
+		t.Errorf("run_id = %q, want 40 characters", fields["run_id"])
+	}
+}
+
+func TestInfoClients(t *testing.T) {
+	srv, addr := startTestServer(t)
+	conn := dial(t, addr)
+	blocked := dial(t, addr)
+
+	replies := sendAsync(blocked, "BLPOP", "queue", "0")
+	waitForBlocked(t, srv, "queue", 1)
+
+	_, fields := infoFields(t, conn, "clients")
+	if fields["connected_clients"] != "2" || fields["blocked_clients"] != "1" {
+		t.Errorf("connected_clients = %s, blocked_clients = %s, want 2 and 1", fields["connected_clients"], fields["blocked_clients"])
+	}
+
+	sendCommand(t, conn, "RPUSH", "queue", "a")
+	receive(t, replies)
+	if _, fields = infoFields(t, conn, "clients"); fields["blocked_clients"] != "0" {
+		t.Errorf("blocked_clients after serving = %s, want 0", fields["blocked_clients"])
+	}
+}
+
+func TestInfoStats(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+	subscriber := dialPubSub(t, addr)
+	subscriber.send(t, "SUBSCRIBE", "news")
+	subscriber.read(t)
+	subscriber.send(t, "PSUBSCRIBE", "news.*")
+	subscriber.read(t)
+
+	conn := dial(t, addr)
+	sendCommand(t, conn, "SET", "k", "v")
+	sendCommand(t, conn, "PEXPIRE", "k", "1")
+	time.Sleep(5 * time.Millisecond)
+	sendCommand(t, conn, "GET", "k")
+
+	_, fields := infoFields(t, conn, "stats")
+	want := map[string]string{
+		"total_connections_received": "2",
+		"total_commands_processed":   "6", // Both subscriptions, SET, PEXPIRE, GET and INFO
+		"expired_keys":               "1",
+		"pubsub_channels":            "1",
+		"pubsub_patterns":            "1",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, fields[key], value)
+		}
+	}
+}
+
+func TestInfoKeyspace(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn := dial(t, addr)
+
+	if _, fields := infoFields(t, conn, "keyspace"); len(fields) != 0 {
+		t.Errorf("INFO keyspace on an empty server = %v, want no fields", fields)
+	}
+
+	sendCommand(t, conn, "SET", "a", "1")
+	sendCommand(t, conn, "RPUSH", "b", "1")
+	sendCommand(t, conn, "EXPIRE", "a", "100")
+	_, fields := infoFields(t, conn, "keyspace")
+	if want := "keys=2,expires=1,avg_ttl=0"; fields["db0"] != want {
+		t.Errorf("db0 = %q, want %q", fields["db0"], want)
+	}
+}
+
+func TestInfoPersistence(t *testing.T) {
+	_, addr := startTestServer(t)
+	if _, fields := infoFields(t, dial(t, addr), "persistence"); fields["rdb_bgsave_in_progress"] != "0" || fields["rdb_last_bgsave_status"] != "ok" {
+		t.Errorf("INFO persistence without persistence = %v", fields)
+	}
+
+	st := store.New()
+	stores := persistence.Stores{Strings: store.AsSnapshottable(st)}
+	// A directory where the snapshot should be makes saves fail
+	path := t.TempDir()
+	manager := persistence.NewManager(path, stores)
+	srv := New(st, store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore(), manager, nil, Config{Port: 0})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Stop()
+		srv.keyspace.Close()
+	})
+	conn := dial(t, srv.Addr().String())
+
+	sendCommand(t, conn, "BGSAVE")
+	_ = manager.WaitForSave()
+	_, fields := infoFields(t, conn, "persistence")
+	if fields["rdb_last_bgsave_status"] != "err" {
+		t.Errorf("rdb_last_bgsave_status after a failed save = %q, want err", fields["rdb_last_bgsave_status"])
+	}
+
+	manager.SetPath(filepath.Join(path, "dump.rdb"))
+	before := time.Now().Unix()
+	sendCommand(t, conn, "BGSAVE")
+	_ = manager.WaitForSave()
+	_, fields = infoFields(t, conn, "persistence")
+	if fields["rdb_last_bgsave_status"] != "ok" {
+		t.Errorf("rdb_last_bgsave_status = %q, want ok", fields["rdb_last_bgsave_status"])
+	}
+	if saved, _ := strconv.ParseInt(fields["rdb_last_save_time"], 10, 64); saved < before {
+		t.Errorf("rdb_last_save_time = %d, want at least %d", saved, before)
+	}
+}
+
+func TestBytesToHuman(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1536, "1.50K"},
+		{10 << 20, "10.00M"},
+		{3 << 30, "3.00G"},
+	}
+	for _, tt := range tests {
+		if got := bytesToHuman(tt.n); got != tt.want {
+			t.Errorf("bytesToHuman(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestInfoPersistenceDuringSave checks INFO reports a background save in
+// progress without waiting for it.
+func TestInfoPersistenceDuringSave(t *testing.T) {
+	_, conn, release := startHeldSave(t, Config{})
+	_, fields := infoFields(t, conn, "persistence")
+	if fields["rdb_bgsave_in_progress"] != "1" {
+		t.Errorf("rdb_bgsave_in_progress during a save = %q, want 1", fields["rdb_bgsave_in_progress"])
+	}
+
+	release()
+	_, fields = infoFields(t, conn, "persistence")
+	if fields["rdb_bgsave_in_progress"] != "0" {
+		t.Errorf("rdb_bgsave_in_progress after the save = %q, want 0", fields["rdb_bgsave_in_progress"])
+	}
+}
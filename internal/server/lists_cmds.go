@@ -2,7 +2,10 @@
 package server
 
 import (
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/scotro/mini-redis/internal/resp"
 	"github.com/scotro/mini-redis/internal/store"
@@ -12,29 +15,38 @@ import (
 // This is designed to be integrated into the main Server struct.
 type ListCommandHandler struct {
 	listStore store.ListStore
-	// stringStore is used for type checking against existing string keys
-	stringStore store.Store
+	// keyspace is used for type checking against keys of other types
+	keyspace *store.Keyspace
+	// blocking is told about pushes so it can wake blocked clients.
+	// It is nil when the handler is used without a server.
+	blocking *blockingManager
 }
 
-// NewListCommandHandler creates a new handler with the given stores.
-func NewListCommandHandler(listStore store.ListStore, stringStore store.Store) *ListCommandHandler {
+// NewListCommandHandler creates a new handler operating on the keyspace's list store.
+func NewListCommandHandler(keyspace *store.Keyspace) *ListCommandHandler {
 	return &ListCommandHandler{
-		listStore:   listStore,
-		stringStore: stringStore,
+		listStore: keyspace.Lists(),
+		keyspace:  keyspace,
 	}
 }
 
 // checkType verifies that an operation can be performed on a key.
 // Returns a WRONGTYPE error if the key exists but is not a list.
 func (h *ListCommandHandler) checkType(key string) *resp.Value {
-	// Check if key exists as a string
-	if _, exists := h.stringStore.Get(key); exists {
-		errResp := respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	if err := h.keyspace.CheckType(key, store.TypeList); err != nil {
+		errResp := respError(err.Error())
 		return &errResp
 	}
 	return nil
 }
 
+// signalReady tells blocked clients that key has new elements.
+func (h *ListCommandHandler) signalReady(key string) {
+	if h.blocking != nil {
+		h.blocking.signalReady(key)
+	}
+}
+
 // HandleLPush handles the LPUSH command.
 // LPUSH key value [value ...]
 // Prepends values to a list. Returns the length of the list after the push.
@@ -56,6 +68,7 @@ func (h *ListCommandHandler) HandleLPush(args []resp.Value) resp.Value {
 	}
 
 	length := h.listStore.LPush(key, values...)
+	h.signalReady(key)
 	return respInteger(length)
 }
 
@@ -80,6 +93,7 @@ func (h *ListCommandHandler) HandleRPush(args []resp.Value) resp.Value {
 	}
 
 	length := h.listStore.RPush(key, values...)
+	h.signalReady(key)
 	return respInteger(length)
 }
 
@@ -181,3 +195,254 @@ func (h *ListCommandHandler) HandleLLen(args []resp.Value) resp.Value {
 	length := h.listStore.LLen(key)
 	return respInteger(length)
 }
+
+// HandleLMove handles the LMOVE command.
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+// Moves an element between lists. Returns the element, or nil if source is empty.
+func (h *ListCommandHandler) HandleLMove(args []resp.Value) resp.Value {
+	if len(args) != 4 {
+		return respError("ERR wrong number of arguments for 'lmove' command")
+	}
+
+	fromLeft, ok1 := parseListEnd(args[2].Str)
+	toLeft, ok2 := parseListEnd(args[3].Str)
+	if !ok1 || !ok2 {
+		return respError("ERR syntax error")
+	}
+
+	reply, _ := h.move(args[0].Str, args[1].Str, fromLeft, toLeft)
+	return reply
+}
+
+// HandleLMPop handles the LMPOP command.
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+// Pops from the first non-empty list. Returns [key, elements], or nil if all lists are empty.
+func (h *ListCommandHandler) HandleLMPop(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return respError("ERR wrong number of arguments for 'lmpop' command")
+	}
+
+	bc, errResp := h.parseMPop(args)
+	if errResp != nil {
+		return *errResp
+	}
+	if reply, ok := bc.tryServe(); ok {
+		return reply
+	}
+	return bc.timeoutReply
+}
+
+// HandleBlocking handles BLPOP, BRPOP, BLMOVE and BLMPOP without blocking,
+// as they behave inside MULTI: if no key can serve the command, the timeout
+// reply is returned immediately.
+func (h *ListCommandHandler) HandleBlocking(cmd string, args []resp.Value) resp.Value {
+	bc, errResp := h.parseBlocking(cmd, args)
+	if errResp != nil {
+		return *errResp
+	}
+	if reply, ok := bc.tryServe(); ok {
+		return reply
+	}
+	return bc.timeoutReply
+}
+
+// parseBlocking parses the arguments of BLPOP, BRPOP, BLMOVE or BLMPOP.
+//
+//	BLPOP key [key ...] timeout
+//	BRPOP key [key ...] timeout
+//	BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+//	BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (h *ListCommandHandler) parseBlocking(cmd string, args []resp.Value) (*blockingCommand, *resp.Value) {
+	fail := func(msg string) (*blockingCommand, *resp.Value) {
+		errResp := respError(msg)
+		return nil, &errResp
+	}
+	wrongArgs := "ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command"
+
+	switch cmd {
+	case "BLPOP", "BRPOP":
+		if len(args) < 2 {
+			return fail(wrongArgs)
+		}
+		timeout, errResp := parseBlockingTimeout(args[len(args)-1].Str)
+		if errResp != nil {
+			return nil, errResp
+		}
+		left := cmd == "BLPOP"
+		return &blockingCommand{
+			keyType: store.TypeList,
+			keys:    argStrings(args[:len(args)-1]),
+			timeout: timeout,
+			serve: func(key string) (resp.Value, bool) {
+				return h.pop(key, left, 1, func(values []string) resp.Value {
+					return resp.Value{Type: resp.TypeArray, Array: []resp.Value{respBulkString(key), respBulkString(values[0])}}
+				})
+			},
+			timeoutReply: resp.Value{Type: resp.TypeArray, Null: true},
+		}, nil
+
+	case "BLMOVE":
+		if len(args) != 5 {
+			return fail(wrongArgs)
+		}
+		fromLeft, ok1 := parseListEnd(args[2].Str)
+		toLeft, ok2 := parseListEnd(args[3].Str)
+		if !ok1 || !ok2 {
+			return fail("ERR syntax error")
+		}
+		timeout, errResp := parseBlockingTimeout(args[4].Str)
+		if errResp != nil {
+			return nil, errResp
+		}
+		destination := args[1].Str
+		return &blockingCommand{
+			keyType: store.TypeList,
+			keys:    []string{args[0].Str},
+			timeout: timeout,
+			serve: func(key string) (resp.Value, bool) {
+				return h.move(key, destination, fromLeft, toLeft)
+			},
+			timeoutReply: respNullBulkString(),
+		}, nil
+
+	case "BLMPOP":
+		if len(args) < 4 {
+			return fail(wrongArgs)
+		}
+		timeout, errResp := parseBlockingTimeout(args[0].Str)
+		if errResp != nil {
+			return nil, errResp
+		}
+		bc, errResp := h.parseMPop(args[1:])
+		if errResp != nil {
+			return nil, errResp
+		}
+		bc.timeout = timeout
+		return bc, nil
+	}
+	return fail("ERR unknown command '" + cmd + "'")
+}
+
+// parseMPop parses "numkeys key [key ...] LEFT|RIGHT [COUNT count]" for LMPOP and BLMPOP.
+func (h *ListCommandHandler) parseMPop(args []resp.Value) (*blockingCommand, *resp.Value) {
+	fail := func(msg string) (*blockingCommand, *resp.Value) {
+		errResp := respError(msg)
+		return nil, &errResp
+	}
+
+	numKeys, err := strconv.Atoi(args[0].Str)
+	if err != nil {
+		return fail("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return fail("ERR numkeys should be greater than 0")
+	}
+	if numKeys >= len(args)-1 {
+		return fail("ERR syntax error")
+	}
+
+	keys := argStrings(args[1 : 1+numKeys])
+	left, ok := parseListEnd(args[1+numKeys].Str)
+	if !ok {
+		return fail("ERR syntax error")
+	}
+
+	count := 1
+	rest := args[2+numKeys:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(rest[0].Str) != "COUNT" {
+			return fail("ERR syntax error")
+		}
+		count, err = strconv.Atoi(rest[1].Str)
+		if err != nil {
+			return fail("ERR value is not an integer or out of range")
+		}
+		if count <= 0 {
+			return fail("ERR count should be greater than 0")
+		}
+	}
+
+	return &blockingCommand{
+		keyType: store.TypeList,
+		keys:    keys,
+		serve: func(key string) (resp.Value, bool) {
+			return h.pop(key, left, count, func(values []string) resp.Value {
+				elements := make([]resp.Value, len(values))
+				for i, v := range values {
+					elements[i] = respBulkString(v)
+				}
+				return resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+					respBulkString(key),
+					{Type: resp.TypeArray, Array: elements},
+				}}
+			})
+		},
+		timeoutReply: resp.Value{Type: resp.TypeArray, Null: true},
+	}, nil
+}
+
+// pop removes up to count elements from one end of key and formats them with reply.
+// Returns false if key holds no elements.
+func (h *ListCommandHandler) pop(key string, left bool, count int, reply func([]string) resp.Value) (resp.Value, bool) {
+	if errResp := h.checkType(key); errResp != nil {
+		return *errResp, true
+	}
+
+	var values []string
+	if left {
+		values = h.listStore.LPopCount(key, count)
+	} else {
+		values = h.listStore.RPopCount(key, count)
+	}
+	if len(values) == 0 {
+		return resp.Value{}, false
+	}
+	return reply(values), true
+}
+
+// move pops an element from source and pushes it onto destination.
+// Returns false if source holds no elements.
+func (h *ListCommandHandler) move(source, destination string, fromLeft, toLeft bool) (resp.Value, bool) {
+	if errResp := h.checkType(source); errResp != nil {
+		return *errResp, true
+	}
+	if h.listStore.LLen(source) == 0 {
+		return respNullBulkString(), false
+	}
+	if errResp := h.checkType(destination); errResp != nil {
+		return *errResp, true
+	}
+
+	value, _ := h.listStore.LMove(source, destination, fromLeft, toLeft)
+	h.signalReady(destination)
+	return respBulkString(value), true
+}
+
+// parseListEnd parses LEFT or RIGHT, returning true for LEFT.
+func parseListEnd(s string) (left bool, ok bool) {
+	switch strings.ToUpper(s) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// parseBlockingTimeout parses a timeout in seconds; fractions are allowed and 0 blocks forever.
+func parseBlockingTimeout(s string) (time.Duration, *resp.Value) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		errResp := respError("ERR timeout is not a float or out of range")
+		return 0, &errResp
+	}
+	if seconds < 0 {
+		errResp := respError("ERR timeout is negative")
+		return 0, &errResp
+	}
+	if seconds > math.MaxInt64/float64(time.Second) {
+		errResp := respError("ERR timeout is out of range")
+		return 0, &errResp
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
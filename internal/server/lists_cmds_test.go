@@ -1,6 +1,7 @@
 package server
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/scotro/mini-redis/internal/resp"
@@ -8,7 +9,7 @@ import (
 )
 
 func newTestListHandler() *ListCommandHandler {
-	return NewListCommandHandler(store.NewListStore(), store.New())
+	return NewListCommandHandler(store.NewKeyspace(store.New(), store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore()))
 }
 
 func makeListArgs(strs ...string) []resp.Value {
@@ -413,7 +414,7 @@ func TestWrongTypeError(t *testing.T) {
 
 	stringStore.Set("stringkey", "value")
 
-	h := NewListCommandHandler(listStore, stringStore)
+	h := NewListCommandHandler(store.NewKeyspace(stringStore, listStore, store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore()))
 
 	tests := []struct {
 		name    string
@@ -509,3 +510,108 @@ func TestQueueBehavior(t *testing.T) {
 		t.Errorf("Expected null after emptying queue, got %q", got.Str)
 	}
 }
+
+func TestHandleLMove(t *testing.T) {
+	h := newTestListHandler()
+	h.HandleRPush(makeListArgs("src", "a", "b", "c"))
+
+	tests := []struct {
+		args    []string
+		want    resp.Value
+		wantSrc []string
+		wantDst []string
+	}{
+		{[]string{"src", "dst", "LEFT", "RIGHT"}, respBulkString("a"), []string{"b", "c"}, []string{"a"}},
+		{[]string{"src", "dst", "right", "left"}, respBulkString("c"), []string{"b"}, []string{"c", "a"}},
+		{[]string{"src", "dst", "UP", "LEFT"}, respError("ERR syntax error"), []string{"b"}, []string{"c", "a"}},
+		{[]string{"src", "dst", "LEFT", "LEFT"}, respBulkString("b"), []string{}, []string{"b", "c", "a"}},
+		{[]string{"src", "dst", "LEFT", "LEFT"}, respNullBulkString(), []string{}, []string{"b", "c", "a"}},
+	}
+
+	for _, tt := range tests {
+		got := h.HandleLMove(makeListArgs(tt.args...))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LMOVE %v = %v, want %v", tt.args, got, tt.want)
+		}
+		if list := bulkStrings(h.HandleLRange(makeListArgs("src", "0", "-1"))); !reflect.DeepEqual(list, tt.wantSrc) {
+			t.Errorf("after LMOVE %v, src = %v, want %v", tt.args, list, tt.wantSrc)
+		}
+		if list := bulkStrings(h.HandleLRange(makeListArgs("dst", "0", "-1"))); !reflect.DeepEqual(list, tt.wantDst) {
+			t.Errorf("after LMOVE %v, dst = %v, want %v", tt.args, list, tt.wantDst)
+		}
+	}
+}
+
+func TestHandleLMPop(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantKey string
+		want    []string
+		wantErr string
+	}{
+		{name: "first non-empty list", args: []string{"2", "empty", "list", "LEFT"}, wantKey: "list", want: []string{"a"}},
+		{name: "right with count", args: []string{"1", "list", "RIGHT", "COUNT", "2"}, wantKey: "list", want: []string{"c", "b"}},
+		{name: "count exceeds length", args: []string{"1", "list", "LEFT", "COUNT", "10"}, wantKey: "list", want: []string{"a", "b", "c"}},
+		{name: "all empty", args: []string{"1", "empty", "LEFT"}},
+		{name: "zero numkeys", args: []string{"0", "list", "LEFT"}, wantErr: "ERR numkeys should be greater than 0"},
+		{name: "too few keys", args: []string{"3", "list", "LEFT"}, wantErr: "ERR syntax error"},
+		{name: "bad direction", args: []string{"1", "list", "UP"}, wantErr: "ERR syntax error"},
+		{name: "zero count", args: []string{"1", "list", "LEFT", "COUNT", "0"}, wantErr: "ERR count should be greater than 0"},
+		{name: "trailing argument", args: []string{"1", "list", "LEFT", "COUNT"}, wantErr: "ERR syntax error"},
+		{name: "wrong type", args: []string{"2", "empty", "str", "LEFT"}, wantErr: "WRONGTYPE Operation against a key holding the wrong kind of value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := createTestServer(t)
+			runCommand(srv, "RPUSH", "list", "a", "b", "c")
+			runCommand(srv, "SET", "str", "v")
+
+			got := runCommand(srv, append([]string{"LMPOP"}, tt.args...)...)
+			switch {
+			case tt.wantErr != "":
+				if got.Str != tt.wantErr {
+					t.Errorf("LMPOP %v = %v, want %q", tt.args, got, tt.wantErr)
+				}
+			case tt.want == nil:
+				if got.Type != resp.TypeArray || !got.Null {
+					t.Errorf("LMPOP %v = %v, want null array", tt.args, got)
+				}
+			default:
+				if len(got.Array) != 2 || got.Array[0].Str != tt.wantKey || !reflect.DeepEqual(bulkStrings(got.Array[1]), tt.want) {
+					t.Errorf("LMPOP %v = %v, want [%s %v]", tt.args, got, tt.wantKey, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleBlockingWithoutWaiting(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "RPUSH", "list", "a", "b")
+	runCommand(srv, "SET", "str", "v")
+
+	tests := []struct {
+		args []string
+		want resp.Value
+	}{
+		{[]string{"BLPOP", "empty", "list", "0"}, resp.Value{Type: resp.TypeArray, Array: []resp.Value{respBulkString("list"), respBulkString("a")}}},
+		{[]string{"BRPOP", "empty", "1.5"}, resp.Value{Type: resp.TypeArray, Null: true}},
+		{[]string{"BLMOVE", "list", "other", "LEFT", "RIGHT", "0"}, respBulkString("b")},
+		{[]string{"BLMOVE", "list", "other", "LEFT", "RIGHT", "0"}, respNullBulkString()},
+		{[]string{"BLMPOP", "0", "2", "list", "other", "RIGHT"}, resp.Value{Type: resp.TypeArray, Array: []resp.Value{respBulkString("other"), {Type: resp.TypeArray, Array: []resp.Value{respBulkString("b")}}}}},
+		{[]string{"BLPOP", "str", "0"}, respError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"BLPOP", "list", "x"}, respError("ERR timeout is not a float or out of range")},
+		{[]string{"BLPOP", "list", "-1"}, respError("ERR timeout is negative")},
+		{[]string{"BLPOP", "list"}, respError("ERR wrong number of arguments for 'blpop' command")},
+		{[]string{"BLMOVE", "list", "other", "LEFT", "0"}, respError("ERR wrong number of arguments for 'blmove' command")},
+		{[]string{"BLMPOP", "0", "0", "list", "LEFT"}, respError("ERR numkeys should be greater than 0")},
+	}
+
+	for _, tt := range tests {
+		if got := runCommand(srv, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
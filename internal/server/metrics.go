@@ -0,0 +1,147 @@
+// Package server contains the Prometheus metrics the server exposes over HTTP.
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/metrics"
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// MetricsConfig configures the HTTP listener serving /metrics.
+type MetricsConfig struct {
+	// Port is the HTTP port; 0 picks a free port. It binds to the same
+	// addresses as the plaintext and TLS listeners.
+	Port int
+}
+
+// commandMetrics counts the commands clients send and how long they take.
+type commandMetrics struct {
+	calls    *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newCommandMetrics() *commandMetrics {
+	return &commandMetrics{
+		calls:    metrics.NewCounterVec("cmd"),
+		duration: metrics.NewHistogramVec("cmd", metrics.LatencyBuckets),
+	}
+}
+
+// observe records a command that started at start. Commands the server
+// doesn't know are counted together, so clients can't create labels at will.
+// Commands queued by MULTI are counted when queued; EXEC's latency covers
+// running them.
+func (m *commandMetrics) observe(value resp.Value, start time.Time) {
+	name := "unknown"
+	if value.Type == resp.TypeArray && len(value.Array) > 0 {
+		if cmd := strings.ToLower(value.Array[0].Str); acl.IsCommand(cmd) {
+			name = cmd
+		}
+	}
+	m.calls.Inc(name)
+	m.duration.With(name).Observe(time.Since(start).Seconds())
+}
+
+// listenMetrics opens the metrics listeners.
+func (s *Server) listenMetrics() error {
+	listeners, err := s.listenTCP(s.config.Metrics.Port, nil)
+	if err != nil {
+		return err
+	}
+	for _, listener := range listeners {
+		log.Printf("Serving metrics on http://%s/metrics", listener.Addr())
+	}
+	s.metricsListeners = listeners
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	s.metricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return nil
+}
+
+// serveMetricsHTTP serves HTTP on the metrics listeners until the server stops.
+func (s *Server) serveMetricsHTTP() {
+	for _, listener := range s.metricsListeners {
+		s.wg.Add(1)
+		go func(listener net.Listener) {
+			defer s.wg.Done()
+			if err := s.metricsServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Metrics listener stopped: %v", err)
+			}
+		}(listener)
+	}
+}
+
+// MetricsAddr returns the address of the first metrics listener (useful for testing).
+func (s *Server) MetricsAddr() net.Addr {
+	if len(s.metricsListeners) == 0 {
+		return nil
+	}
+	return s.metricsListeners[0].Addr()
+}
+
+// serveMetrics writes the server's metrics in the Prometheus text format.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Write(w, s.collectMetrics()); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// collectMetrics gathers the current value of every metric.
+func (s *Server) collectMetrics() []*metrics.Family {
+	calls := metrics.NewFamily("mini_redis_commands_total", metrics.TypeCounter, "Commands received, by command name.")
+	s.commandMetrics.calls.Collect(calls)
+	duration := metrics.NewFamily("mini_redis_command_duration_seconds", metrics.TypeHistogram, "Time taken to run commands, by command name.")
+	s.commandMetrics.duration.Collect(duration)
+
+	clients := metrics.NewFamily("mini_redis_connected_clients", metrics.TypeGauge, "Client connections currently open.")
+	clients.Add(float64(s.connectedClients.Load()))
+
+	keys := metrics.NewFamily("mini_redis_keys", metrics.TypeGauge, "Keys held, by type.")
+	sizes := s.keyspace.SizeByType()
+	for _, typ := range []string{store.TypeString, store.TypeList, store.TypeHash, store.TypeSet, store.TypeZSet, store.TypeStream} {
+		keys.Add(float64(sizes[typ]), metrics.Label{Name: "type", Value: typ})
+	}
+	expiryStats := s.keyspace.ExpiryStats()
+	expires := metrics.NewFamily("mini_redis_keys_with_expiry", metrics.TypeGauge, "Keys with a TTL.")
+	expires.Add(float64(expiryStats.VolatileKeys))
+	expired := metrics.NewFamily("mini_redis_expired_keys_total", metrics.TypeCounter, "Keys deleted because their TTL passed.")
+	expired.Add(float64(expiryStats.ExpiredKeys))
+
+	families := []*metrics.Family{calls, duration, clients, keys, expires, expired}
+
+	if s.pubsubHandler != nil {
+		dropped := metrics.NewFamily("mini_redis_pubsub_dropped_messages_total", metrics.TypeCounter, "Pub/sub messages dropped because a subscriber's buffer was full.")
+		dropped.Add(float64(s.pubsubHandler.ps.DroppedMessages()))
+		families = append(families, dropped)
+	}
+
+	if s.persistenceHandler != nil {
+		stats := s.persistenceHandler.manager.Stats()
+		saveDuration := metrics.NewFamily("mini_redis_snapshot_duration_seconds", metrics.TypeSummary, "Time taken to save snapshots, including failed saves.")
+		saveDuration.Samples = append(saveDuration.Samples,
+			metrics.Sample{Name: saveDuration.Name + "_sum", Value: stats.TotalDuration.Seconds()},
+			metrics.Sample{Name: saveDuration.Name + "_count", Value: float64(stats.Saves)},
+		)
+		lastDuration := metrics.NewFamily("mini_redis_snapshot_last_duration_seconds", metrics.TypeGauge, "Time taken by the last snapshot save.")
+		lastDuration.Add(stats.LastDuration.Seconds())
+		failures := metrics.NewFamily("mini_redis_snapshot_failures_total", metrics.TypeCounter, "Snapshot saves that failed.")
+		failures.Add(float64(stats.Failures))
+		families = append(families, saveDuration, lastDuration, failures)
+	}
+	return families
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/persistence"
+	"github.com/scotro/mini-redis/internal/pubsub"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// startMetricsTestServer starts a server with persistence, pub/sub and the
+// metrics listener enabled.
+func startMetricsTestServer(t *testing.T) *Server {
+	t.Helper()
+	st := store.New()
+	stores := persistence.Stores{Strings: store.AsSnapshottable(st)}
+	manager := persistence.NewManager(filepath.Join(t.TempDir(), "dump.rdb"), stores)
+	srv := New(st, store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore(), manager, pubsub.New(), Config{Port: 0, Metrics: &MetricsConfig{Port: 0}})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Stop()
+		srv.keyspace.Close()
+	})
+	return srv
+}
+
+// scrapeClient gives up on scrapes that hang.
+var scrapeClient = &http.Client{Timeout: 5 * time.Second}
+
+// scrape fetches /metrics and returns its samples keyed by name and labels.
+func scrape(t *testing.T, srv *Server) map[string]string {
+	t.Helper()
+	resp, err := scrapeClient.Get("http://" + srv.MetricsAddr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+
+	samples := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		samples[line[:i]] = line[i+1:]
+	}
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	srv := startMetricsTestServer(t)
+	conn := dial(t, srv.Addr().String())
+	sendCommand(t, conn, "SET", "a", "1")
+	sendCommand(t, conn, "SET", "b", "2")
+	sendCommand(t, conn, "RPUSH", "list", "x")
+	sendCommand(t, conn, "EXPIRE", "a", "100")
+	sendCommand(t, conn, "GET", "a")
+	sendCommand(t, conn, "NOSUCHCOMMAND")
+	sendCommand(t, conn, "SAVE")
+
+	samples := scrape(t, srv)
+	want := map[string]string{
+		`mini_redis_commands_total{cmd="set"}`:                            "2",
+		`mini_redis_commands_total{cmd="get"}`:                            "1",
+		`mini_redis_commands_total{cmd="unknown"}`:                        "1",
+		`mini_redis_command_duration_seconds_count{cmd="set"}`:            "2",
+		`mini_redis_command_duration_seconds_bucket{cmd="set",le="+Inf"}`: "2",
+		`mini_redis_connected_clients`:                                    "1",
+		`mini_redis_keys{type="string"}`:                                  "2",
+		`mini_redis_keys{type="list"}`:                                    "1",
+		`mini_redis_keys{type="hash"}`:                                    "0",
+		`mini_redis_keys_with_expiry`:                                     "1",
+		`mini_redis_expired_keys_total`:                                   "0",
+		`mini_redis_pubsub_dropped_messages_total`:                        "0",
+		`mini_redis_snapshot_duration_seconds_count`:                      "1",
+		`mini_redis_snapshot_failures_total`:                              "0",
+	}
+	for name, value := range want {
+		if samples[name] != value {
+			t.Errorf("%s = %q, want %q", name, samples[name], value)
+		}
+	}
+}
+
+// TestMetricsDuringSave checks a scrape doesn't wait for a background save.
+func TestMetricsDuringSave(t *testing.T) {
+	srv, _, release := startHeldSave(t, Config{Metrics: &MetricsConfig{Port: 0}})
+	if got := scrape(t, srv)["mini_redis_snapshot_duration_seconds_count"]; got != "0" {
+		t.Errorf("saves counted during the first save = %q, want 0", got)
+	}
+	release()
+	if got := scrape(t, srv)["mini_redis_snapshot_duration_seconds_count"]; got != "1" {
+		t.Errorf("saves counted after the first save = %q, want 1", got)
+	}
+}
+
+func TestMetricsOnlyServesGet(t *testing.T) {
+	srv := startMetricsTestServer(t)
+	resp, err := http.Post("http://"+srv.MetricsAddr().String()+"/metrics", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST /metrics failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /metrics status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	srv, _ := startTestServer(t)
+	if srv.MetricsAddr() != nil {
+		t.Errorf("MetricsAddr() = %v without a metrics port", srv.MetricsAddr())
+	}
+}
@@ -2,11 +2,19 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/config"
 	"github.com/scotro/mini-redis/internal/persistence"
 	"github.com/scotro/mini-redis/internal/resp"
 )
 
 // PersistenceHandler handles persistence-related Redis commands (SAVE, BGSAVE).
+// LASTSAVE and SHUTDOWN, which need the server, are handled by the Server.
 type PersistenceHandler struct {
 	manager *persistence.Manager
 }
@@ -25,6 +33,10 @@ func (h *PersistenceHandler) HandleSave(args []resp.Value) resp.Value {
 	if len(args) != 0 {
 		return respError("ERR wrong number of arguments for 'save' command")
 	}
+	// Rather than wait for the background save under the execution lock
+	if h.manager.IsSaving() {
+		return respError("ERR Background save already in progress")
+	}
 
 	if err := h.manager.Save(); err != nil {
 		return respError("ERR " + err.Error())
@@ -50,3 +62,173 @@ func (h *PersistenceHandler) HandleBGSave(args []resp.Value) resp.Value {
 
 	return respSimpleString("Background saving started")
 }
+
+// handleLastSave handles the LASTSAVE command.
+// LASTSAVE
+// Returns the Unix time of the last successful save.
+func (s *Server) handleLastSave(args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		return respError("ERR wrong number of arguments for 'lastsave' command")
+	}
+	return respInteger(int(s.lastSave().Unix()))
+}
+
+// lastSave returns when the last successful save finished, or when the
+// server started if there has been none.
+func (s *Server) lastSave() time.Time {
+	if s.persistenceHandler == nil {
+		return s.startTime
+	}
+	return s.persistenceHandler.manager.LastSave()
+}
+
+// changesSinceSave returns how many changes were made since the last
+// successful save, or since the server started if persistence is off.
+func (s *Server) changesSinceSave() int64 {
+	if s.persistenceHandler == nil {
+		return s.keyspace.Versions().Changes()
+	}
+	return s.persistenceHandler.manager.ChangesSinceSave()
+}
+
+const (
+	// saveRulesInterval is how often the save rules are checked.
+	saveRulesInterval = 100 * time.Millisecond
+	// saveRetryDelay is how long to wait after a failed automatic save
+	// before trying again, as in Redis.
+	saveRetryDelay = 5 * time.Second
+)
+
+// runSaveRules starts a background save whenever a save rule is met,
+// until the server stops. The rules are read on every check, so CONFIG SET
+// save takes effect at once.
+func (s *Server) runSaveRules() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(saveRulesInterval)
+	defer ticker.Stop()
+
+	m := s.persistenceHandler.manager
+	var lastAttempt time.Time
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+
+		if m.IsSaving() || (m.LastBackgroundSaveErr() != nil && time.Since(lastAttempt) < saveRetryDelay) {
+			continue
+		}
+		rule, ok := dueSaveRule(s.params.SaveRules(), m.ChangesSinceSave(), time.Since(m.LastSave()))
+		if !ok {
+			continue
+		}
+
+		log.Printf("%d changes in %d seconds. Saving...", rule.Changes, rule.Seconds)
+		lastAttempt = time.Now()
+		// The data is gathered under the execution lock, so the snapshot
+		// doesn't catch a transaction halfway
+		s.execMu.Lock()
+		err := m.BackgroundSave()
+		s.execMu.Unlock()
+		if err != nil && !errors.Is(err, persistence.ErrSaveInProgress) {
+			log.Printf("Error starting background save: %v", err)
+		}
+	}
+}
+
+// dueSaveRule returns the first rule met by changes made over since.
+func dueSaveRule(rules []config.SaveRule, changes int64, since time.Duration) (config.SaveRule, bool) {
+	for _, rule := range rules {
+		if changes >= int64(rule.Changes) && since >= time.Duration(rule.Seconds)*time.Second {
+			return rule, true
+		}
+	}
+	return config.SaveRule{}, false
+}
+
+// ShutdownMode is whether Shutdown saves a final snapshot.
+type ShutdownMode int
+
+const (
+	// ShutdownDefault saves if persistence is configured with save rules.
+	ShutdownDefault ShutdownMode = iota
+	// ShutdownSave always saves, failing if persistence isn't configured.
+	ShutdownSave
+	// ShutdownNoSave never saves.
+	ShutdownNoSave
+)
+
+// Shutdown saves a final snapshot as mode says, then stops the server. If
+// the save fails the server keeps running and the error is returned.
+func (s *Server) Shutdown(mode ShutdownMode) error {
+	if err := s.finalSave(mode); err != nil {
+		return err
+	}
+	s.Stop()
+	return nil
+}
+
+// finalSave saves a snapshot before shutting down, if mode calls for one.
+func (s *Server) finalSave(mode ShutdownMode) error {
+	if mode == ShutdownNoSave {
+		return nil
+	}
+	if s.persistenceHandler == nil {
+		if mode == ShutdownSave {
+			return errors.New("persistence not configured")
+		}
+		return nil
+	}
+	if mode == ShutdownDefault && len(s.params.SaveRules()) == 0 {
+		return nil
+	}
+
+	log.Println("Saving the final snapshot before exiting...")
+	// Commands are only held off while the save starts, not while it is
+	// written. Starting it waits for a background save being written, so
+	// that is waited for first, without execMu
+	manager := s.persistenceHandler.manager
+	s.execMu.Lock()
+	for manager.IsSaving() {
+		s.execMu.Unlock()
+		_ = manager.WaitForSave()
+		s.execMu.Lock()
+	}
+	write := manager.BeginSave()
+	s.execMu.Unlock()
+	if err := write(); err != nil {
+		return fmt.Errorf("failed to save the final snapshot: %w", err)
+	}
+	log.Println("Snapshot saved")
+	return nil
+}
+
+// handleShutdown handles the SHUTDOWN command.
+// SHUTDOWN [NOSAVE | SAVE]
+// Saves a final snapshot as Shutdown does, then stops the server. On success
+// there is no reply: every connection is closed.
+func (s *Server) handleShutdown(c *client, args []resp.Value) (resp.Value, bool) {
+	mode := ShutdownDefault
+	if len(args) > 1 {
+		return respError("ERR syntax error"), true
+	}
+	if len(args) == 1 {
+		switch strings.ToUpper(args[0].Str) {
+		case "SAVE":
+			mode = ShutdownSave
+		case "NOSAVE":
+			mode = ShutdownNoSave
+		default:
+			return respError("ERR syntax error"), true
+		}
+	}
+
+	if err := s.finalSave(mode); err != nil {
+		log.Printf("Error trying to shut down: %v", err)
+		return respError("ERR Errors trying to SHUTDOWN. Check logs."), true
+	}
+	c.closing = true
+	s.beginStop()
+	return resp.Value{}, false
+}
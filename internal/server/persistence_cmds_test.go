@@ -1,11 +1,16 @@
 package server
 
 import (
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/scotro/mini-redis/internal/config"
 	"github.com/scotro/mini-redis/internal/persistence"
 	"github.com/scotro/mini-redis/internal/resp"
 	"github.com/scotro/mini-redis/internal/store"
@@ -227,3 +232,386 @@ func TestPersistence_Integration(t *testing.T) {
 		stringStore.Close()
 	}
 }
+
+// startPersistenceServer starts a server with the default config, save
+// rules included, that saves its snapshot to path.
+func startPersistenceServer(t *testing.T, path string) (*Server, *persistence.Manager, string) {
+	t.Helper()
+	st, lists, hashes, sets, zsets, streams := store.New(), store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore()
+	manager := persistence.NewManager(path, persistence.Stores{
+		Strings: store.AsSnapshottable(st),
+		Lists:   store.AsSnapshottable(lists),
+		Hashes:  store.AsSnapshottable(hashes),
+		Sets:    store.AsSnapshottable(sets),
+		ZSets:   store.AsSnapshottable(zsets),
+		Streams: store.AsSnapshottable(streams),
+	})
+	cfg := DefaultConfig()
+	cfg.Port = 0
+	srv := New(st, lists, hashes, sets, zsets, streams, manager, nil, cfg)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Stop()
+		srv.keyspace.Close()
+	})
+	return srv, manager, srv.Addr().String()
+}
+
+// awaitClosed waits for the server to close conn after sending args.
+func awaitClosed(t *testing.T, conn net.Conn, args ...string) {
+	t.Helper()
+	select {
+	case reply, ok := <-sendAsync(conn, args...):
+		if ok {
+			t.Fatalf("%v = %v, want the connection closed", args, reply)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %v to close the connection", args)
+	}
+}
+
+func TestLastSave(t *testing.T) {
+	_, _, addr := startPersistenceServer(t, filepath.Join(t.TempDir(), "dump.rdb"))
+	conn := dial(t, addr)
+
+	started := sendCommand(t, conn, "LASTSAVE")
+	if started.Type != resp.TypeInteger || int64(started.Num) > time.Now().Unix() {
+		t.Fatalf("LASTSAVE = %v, want the startup time", started)
+	}
+	time.Sleep(time.Second)
+	sendCommand(t, conn, "SAVE")
+	if got := sendCommand(t, conn, "LASTSAVE"); got.Num <= started.Num {
+		t.Errorf("LASTSAVE after SAVE = %d, want after %d", got.Num, started.Num)
+	}
+	if got := sendCommand(t, conn, "LASTSAVE", "extra"); got.Type != resp.TypeError {
+		t.Errorf("LASTSAVE extra = %v, want an error", got)
+	}
+}
+
+// TestLastSaveDuringSave checks LASTSAVE and SAVE answer at once while a
+// background save is written, rather than waiting for it.
+func TestLastSaveDuringSave(t *testing.T) {
+	_, conn, release := startHeldSave(t, Config{})
+	during := sendCommand(t, conn, "LASTSAVE")
+	if during.Type != resp.TypeInteger || int64(during.Num) > time.Now().Unix() {
+		t.Errorf("LASTSAVE during a save = %v, want the startup time", during)
+	}
+	if got := sendCommand(t, conn, "SAVE"); got.Str != "ERR Background save already in progress" {
+		t.Errorf("SAVE during a save = %v", got)
+	}
+
+	release()
+	if got := sendCommand(t, conn, "LASTSAVE"); got.Num < during.Num {
+		t.Errorf("LASTSAVE after the save = %d, want at least %d", got.Num, during.Num)
+	}
+}
+
+// TestShutdownDuringSave checks SHUTDOWN waits for a background save
+// without holding up other clients, then saves and stops.
+func TestShutdownDuringSave(t *testing.T) {
+	srv, conn, release := startHeldSave(t, Config{})
+	shutdown := dial(t, srv.Addr().String())
+	closed := sendAsync(shutdown, "SHUTDOWN", "SAVE")
+	time.Sleep(50 * time.Millisecond) // Let SHUTDOWN start waiting for the save
+
+	if got := sendCommand(t, conn, "SET", "k", "v"); got.Str != "OK" {
+		t.Errorf("SET while SHUTDOWN waits for a save = %v, want OK", got)
+	}
+	if got := sendCommand(t, conn, "GET", "k"); got.Str != "v" {
+		t.Errorf("GET while SHUTDOWN waits for a save = %v, want v", got)
+	}
+
+	release()
+	select {
+	case reply, ok := <-closed:
+		if ok {
+			t.Fatalf("SHUTDOWN SAVE = %v, want the connection closed", reply)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for SHUTDOWN SAVE to close the connection")
+	}
+	if saves := srv.persistenceHandler.manager.Stats().Saves; saves != 2 {
+		t.Errorf("saves = %d, want the background save and the final one", saves)
+	}
+}
+
+func TestChangesSinceLastSave(t *testing.T) {
+	_, _, addr := startPersistenceServer(t, filepath.Join(t.TempDir(), "dump.rdb"))
+	conn := dial(t, addr)
+
+	changes := func() string {
+		_, fields := infoFields(t, conn, "persistence")
+		return fields["rdb_changes_since_last_save"]
+	}
+	if got := changes(); got != "0" {
+		t.Errorf("rdb_changes_since_last_save at startup = %s, want 0", got)
+	}
+	sendCommand(t, conn, "SET", "a", "1")
+	sendCommand(t, conn, "RPUSH", "l", "x", "y")
+	sendCommand(t, conn, "GET", "a")
+	if got := changes(); got != "2" {
+		t.Errorf("rdb_changes_since_last_save = %s, want 2", got)
+	}
+	sendCommand(t, conn, "SAVE")
+	if got := changes(); got != "0" {
+		t.Errorf("rdb_changes_since_last_save after SAVE = %s, want 0", got)
+	}
+}
+
+func TestDueSaveRule(t *testing.T) {
+	rules := []config.SaveRule{{Seconds: 900, Changes: 1}, {Seconds: 60, Changes: 100}}
+	tests := []struct {
+		changes int64
+		since   time.Duration
+		want    config.SaveRule
+		ok      bool
+	}{
+		{0, time.Hour, config.SaveRule{}, false},
+		{1, 899 * time.Second, config.SaveRule{}, false},
+		{1, 900 * time.Second, rules[0], true},
+		{100, 59 * time.Second, config.SaveRule{}, false},
+		{100, time.Minute, rules[1], true},
+		{500, time.Hour, rules[0], true},
+	}
+	for _, tt := range tests {
+		got, ok := dueSaveRule(rules, tt.changes, tt.since)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("dueSaveRule(%d, %v) = %v, %v; want %v, %v", tt.changes, tt.since, got, ok, tt.want, tt.ok)
+		}
+	}
+	if _, ok := dueSaveRule(nil, 1000, time.Hour); ok {
+		t.Error("dueSaveRule() without rules is due")
+	}
+}
+
+func TestSaveRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	_, manager, addr := startPersistenceServer(t, path)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "CONFIG", "SET", "save", "1 2"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET save = %v, want OK", got)
+	}
+	sendCommand(t, conn, "SET", "a", "1")
+	time.Sleep(1200 * time.Millisecond)
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("Saved with fewer changes than the rule needs")
+	}
+
+	sendCommand(t, conn, "SET", "b", "2")
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.Stats().Saves == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = manager.WaitForSave()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected a save once the rule was met: %v", err)
+	}
+	if got := manager.ChangesSinceSave(); got != 0 {
+		t.Errorf("ChangesSinceSave() after the automatic save = %d, want 0", got)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		args  []string
+		saved bool
+	}{
+		{[]string{"SHUTDOWN"}, true},
+		{[]string{"SHUTDOWN", "SAVE"}, true},
+		{[]string{"SHUTDOWN", "nosave"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(strings.Join(tt.args, " ")), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dump.rdb")
+			srv, _, addr := startPersistenceServer(t, path)
+			conn := dial(t, addr)
+			other := dial(t, addr)
+			sendCommand(t, other, "PING")
+
+			sendCommand(t, conn, "SET", "k", "v")
+			awaitClosed(t, conn, tt.args...)
+			select {
+			case <-srv.Done():
+			case <-time.After(2 * time.Second):
+				t.Fatal("Done() not closed after SHUTDOWN")
+			}
+			// Every other client is disconnected too
+			awaitClosed(t, other, "PING")
+			srv.Stop()
+
+			if _, err := os.Stat(path); (err == nil) != tt.saved {
+				t.Errorf("snapshot exists = %v, want %v", err == nil, tt.saved)
+			}
+		})
+	}
+}
+
+func TestShutdownErrors(t *testing.T) {
+	// A directory where the snapshot should be makes saves fail
+	srv, _, addr := startPersistenceServer(t, t.TempDir())
+	conn := dial(t, addr)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SHUTDOWN", "NOW"}, "ERR syntax error"},
+		{[]string{"SHUTDOWN", "SAVE", "NOSAVE"}, "ERR syntax error"},
+		{[]string{"SHUTDOWN"}, "ERR Errors trying to SHUTDOWN. Check logs."},
+	}
+	for _, tt := range tests {
+		if got := sendCommand(t, conn, tt.args...); got.Str != tt.want {
+			t.Errorf("%v = %v, want %s", tt.args, got, tt.want)
+		}
+	}
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "SHUTDOWN")
+	if got := sendCommand(t, conn, "EXEC"); len(got.Array) != 1 || got.Array[0].Type != resp.TypeError {
+		t.Errorf("EXEC with SHUTDOWN = %v, want an error reply", got)
+	}
+	if got := sendCommand(t, conn, "PING"); got.Str != "PONG" {
+		t.Errorf("PING after a failed SHUTDOWN = %v, want PONG", got)
+	}
+	select {
+	case <-srv.Done():
+		t.Error("Done() closed after a failed SHUTDOWN")
+	default:
+	}
+
+	// Without persistence, SHUTDOWN SAVE has nothing to save to
+	_, addr = startTestServer(t)
+	if got := sendCommand(t, dial(t, addr), "SHUTDOWN", "SAVE"); got.Type != resp.TypeError {
+		t.Errorf("SHUTDOWN SAVE without persistence = %v, want an error", got)
+	}
+}
+
+func TestConfigSetSnapshotFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	_, manager, addr := startPersistenceServer(t, path)
+	conn := dial(t, addr)
+
+	if got := sendCommand(t, conn, "CONFIG", "GET", "snapshot-format"); len(got.Array) != 2 || got.Array[1].Str != "gob" {
+		t.Errorf("CONFIG GET snapshot-format = %v, want gob", got)
+	}
+	if got := sendCommand(t, conn, "CONFIG", "SET", "snapshot-format", "json"); got.Type != resp.TypeError {
+		t.Errorf("CONFIG SET snapshot-format json = %v, want an error", got)
+	}
+	if got := sendCommand(t, conn, "CONFIG", "SET", "snapshot-format", "rdb"); got.Str != "OK" {
+		t.Fatalf("CONFIG SET snapshot-format rdb = %v, want OK", got)
+	}
+	if manager.Format() != persistence.FormatRDB {
+		t.Errorf("Format() = %q after CONFIG SET, want rdb", manager.Format())
+	}
+	sendCommand(t, conn, "SET", "k", "v")
+	sendCommand(t, conn, "SAVE")
+	if data, err := os.ReadFile(path); err != nil || !strings.HasPrefix(string(data), "REDIS0009") {
+		t.Errorf("snapshot = %.9q, %v; want an RDB file", data, err)
+	}
+}
+
+func TestSnapshotFormatWithStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	_, _, addr := startPersistenceServer(t, path)
+	conn := dial(t, addr)
+
+	sendCommand(t, conn, "XADD", "s", "1-1", "f", "v")
+	if got := sendCommand(t, conn, "CONFIG", "SET", "snapshot-format", "rdb"); !strings.Contains(got.Str, "streams") {
+		t.Errorf("CONFIG SET snapshot-format rdb with a stream = %v, want an error about streams", got)
+	}
+	if got := sendCommand(t, conn, "CONFIG", "GET", "snapshot-format"); len(got.Array) != 2 || got.Array[1].Str != "gob" {
+		t.Errorf("CONFIG GET snapshot-format = %v, want gob", got)
+	}
+	if got := sendCommand(t, conn, "SAVE"); got.Str != "OK" {
+		t.Errorf("SAVE = %v, want OK", got)
+	}
+
+	// Once the streams are gone the format can be changed
+	sendCommand(t, conn, "DEL", "s")
+	if got := sendCommand(t, conn, "CONFIG", "SET", "snapshot-format", "rdb"); got.Str != "OK" {
+		t.Errorf("CONFIG SET snapshot-format rdb without streams = %v, want OK", got)
+	}
+
+	// A server whose loaded data has a stream refuses to start with the RDB format
+	st, lists, hashes, sets, zsets, streams := store.New(), store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore()
+	streams.XAdd("s", store.XAddArgs{ID: store.StreamID{Ms: 1}}, []string{"f", "v"})
+	loaded := persistence.NewManager(path, persistence.Stores{
+		Strings: store.AsSnapshottable(st),
+		Lists:   store.AsSnapshottable(lists),
+		Hashes:  store.AsSnapshottable(hashes),
+		Sets:    store.AsSnapshottable(sets),
+		ZSets:   store.AsSnapshottable(zsets),
+		Streams: store.AsSnapshottable(streams),
+	})
+	loaded.SetFormat(persistence.FormatRDB)
+	srv := New(st, lists, hashes, sets, zsets, streams, loaded, nil, Config{Port: 0})
+	t.Cleanup(srv.keyspace.Close)
+	if err := srv.Start(); err == nil || !strings.Contains(err.Error(), "streams") {
+		srv.Stop()
+		t.Errorf("Start() with the RDB format and a stream error = %v, want an error about streams", err)
+	}
+}
+
+// heldStore is a store whose first snapshot waits for release before
+// returning its keys, holding a save open until then.
+type heldStore struct {
+	store.Snapshottable
+	hold    sync.Once
+	reading chan struct{} // Closed once the first snapshot is read
+	release chan struct{}
+}
+
+func (s *heldStore) BeginSnapshot() store.SnapshotCursor {
+	return &heldCursor{SnapshotCursor: store.AsStreamingSnapshottable(s.Snapshottable).BeginSnapshot(), store: s}
+}
+
+type heldCursor struct {
+	store.SnapshotCursor
+	store *heldStore
+}
+
+func (c *heldCursor) Next(n int) (interface{}, bool) {
+	c.store.hold.Do(func() {
+		close(c.store.reading)
+		<-c.store.release
+	})
+	return c.SnapshotCursor.Next(n)
+}
+
+// startHeldSave starts a server with cfg and a background save that is held
+// open until release is called or the test ends. The returned connection
+// fails commands that wait for the save.
+func startHeldSave(t *testing.T, cfg Config) (srv *Server, conn net.Conn, release func()) {
+	t.Helper()
+	st := store.New()
+	held := &heldStore{Snapshottable: store.AsSnapshottable(st), reading: make(chan struct{}), release: make(chan struct{})}
+	manager := persistence.NewManager(filepath.Join(t.TempDir(), "dump.rdb"), persistence.Stores{Strings: held})
+	cfg.Port = 0
+	srv = New(st, store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore(), manager, nil, cfg)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Stop()
+		srv.keyspace.Close()
+	})
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			close(held.release)
+			_ = manager.WaitForSave()
+		})
+	}
+	t.Cleanup(release)
+
+	conn = dial(t, srv.Addr().String())
+	if got := sendCommand(t, conn, "BGSAVE"); got.Str != "Background saving started" {
+		t.Fatalf("BGSAVE = %v", got)
+	}
+	<-held.reading
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return srv, conn, release
+}
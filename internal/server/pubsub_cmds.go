@@ -101,6 +101,30 @@ func (h *PubSubHandler) HandlePublish(args []resp.Value) resp.Value {
 	return respInteger(count)
 }
 
+// SubscriptionCount returns the number of channels and patterns the subscriber is subscribed to.
+// A client with a non-zero count is in subscribe mode.
+func (h *PubSubHandler) SubscriptionCount(sub *pubsub.Subscriber) int {
+	return h.ps.SubscriptionCount(sub)
+}
+
+// RemoveSubscriber drops all subscriptions held by the subscriber.
+// Called when the subscriber's connection is closed.
+func (h *PubSubHandler) RemoveSubscriber(sub *pubsub.Subscriber) {
+	h.ps.RemoveSubscriber(sub)
+}
+
+// FormatSubscribePong formats the reply to PING while in subscribe mode.
+// Redis replies with a two element array instead of a simple string in this context.
+func FormatSubscribePong(message string) resp.Value {
+	return resp.Value{
+		Type: resp.TypeArray,
+		Array: []resp.Value{
+			respBulkString("pong"),
+			respBulkString(message),
+		},
+	}
+}
+
 // FormatSubscribeMessage formats a subscribe/unsubscribe confirmation message as RESP.
 func FormatSubscribeMessage(msg pubsub.Message) resp.Value {
 	return resp.Value{
@@ -166,6 +190,16 @@ func FormatMessage(msg pubsub.Message) resp.Value {
 	}
 }
 
+// FormatPush formats a pub/sub message as an out-of-band push frame.
+// RESP2 clients receive it as the plain array FormatMessage builds.
+func FormatPush(msg pubsub.Message) resp.Value {
+	v := FormatMessage(msg)
+	if v.Type == resp.TypeArray {
+		v.Type = resp.TypePush
+	}
+	return v
+}
+
 // IsSubscriptionCommand returns true if the command is valid in subscription mode.
 // In subscription mode, only SUBSCRIBE, UNSUBSCRIBE, PSUBSCRIBE, PUNSUBSCRIBE, PING, and QUIT are valid.
 func IsSubscriptionCommand(cmd string) bool {
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"bufio"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/scotro/mini-redis/internal/pubsub"
 	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
 )
 
 func TestNewPubSubHandler(t *testing.T) {
@@ -538,3 +541,219 @@ func TestPublishedMessageSerializationFormat(t *testing.T) {
 		t.Errorf("expected %q, got %q", expected, string(serialized))
 	}
 }
+
+func TestFormatSubscribePong(t *testing.T) {
+	result := FormatSubscribePong("hello")
+
+	expected := "*2\r\n$4\r\npong\r\n$5\r\nhello\r\n"
+	if string(result.Serialize()) != expected {
+		t.Errorf("expected %q, got %q", expected, string(result.Serialize()))
+	}
+}
+
+// startPubSubTestServer starts a server with pub/sub enabled.
+func startPubSubTestServer(t *testing.T) (*Server, *pubsub.PubSub, string) {
+	t.Helper()
+	st := store.New()
+	ps := pubsub.New()
+	srv := New(st, store.NewListStore(), store.NewHashStore(), store.NewSetStore(), store.NewZSetStore(), store.NewStreamStore(), nil, ps, Config{Port: 0})
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	t.Cleanup(func() {
+		srv.Stop()
+		st.Close()
+	})
+
+	return srv, ps, srv.Addr().String()
+}
+
+// pubsubConn wraps a connection with a persistent reader, since subscribe mode
+// delivers several replies per command.
+type pubsubConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialPubSub(t *testing.T, addr string) *pubsubConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &pubsubConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *pubsubConn) send(t *testing.T, args ...string) {
+	t.Helper()
+	cmdArray := make([]resp.Value, len(args))
+	for i, arg := range args {
+		cmdArray[i] = resp.Value{Type: resp.TypeBulkString, Str: arg}
+	}
+	cmd := resp.Value{Type: resp.TypeArray, Array: cmdArray}
+	if _, err := c.conn.Write(cmd.Serialize()); err != nil {
+		t.Fatalf("Failed to send command: %v", err)
+	}
+}
+
+func (c *pubsubConn) read(t *testing.T) resp.Value {
+	t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	v, err := resp.Parse(c.reader)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	return v
+}
+
+// expectArray reads a reply and checks it is an array of the given bulk strings / integers.
+func (c *pubsubConn) expectArray(t *testing.T, want ...interface{}) {
+	t.Helper()
+	v := c.read(t)
+	if v.Type != resp.TypeArray || len(v.Array) != len(want) {
+		t.Fatalf("expected array of %d elements, got %+v", len(want), v)
+	}
+	for i, w := range want {
+		switch w := w.(type) {
+		case string:
+			if v.Array[i].Type != resp.TypeBulkString || v.Array[i].Str != w {
+				t.Errorf("element %d: expected %q, got %+v", i, w, v.Array[i])
+			}
+		case int:
+			if v.Array[i].Type != resp.TypeInteger || v.Array[i].Num != w {
+				t.Errorf("element %d: expected %d, got %+v", i, w, v.Array[i])
+			}
+		}
+	}
+}
+
+// waitForSubscribers waits until a channel has the expected number of subscribers.
+func waitForSubscribers(t *testing.T, ps *pubsub.PubSub, channel string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for ps.GetChannelSubscribers(channel) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers on %q, got %d", n, channel, ps.GetChannelSubscribers(channel))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerSubscribeAndPublish(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+
+	sub := dialPubSub(t, addr)
+	sub.send(t, "SUBSCRIBE", "news", "sports")
+	sub.expectArray(t, "subscribe", "news", 1)
+	sub.expectArray(t, "subscribe", "sports", 2)
+
+	pub := dialPubSub(t, addr)
+	pub.send(t, "PUBLISH", "news", "hello")
+	if v := pub.read(t); v.Type != resp.TypeInteger || v.Num != 1 {
+		t.Errorf("expected :1 from PUBLISH, got %+v", v)
+	}
+
+	sub.expectArray(t, "message", "news", "hello")
+}
+
+func TestServerPSubscribe(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+
+	sub := dialPubSub(t, addr)
+	sub.send(t, "PSUBSCRIBE", "news.*")
+	sub.expectArray(t, "psubscribe", "news.*", 1)
+
+	pub := dialPubSub(t, addr)
+	pub.send(t, "PUBLISH", "news.tech", "gophers")
+	if v := pub.read(t); v.Type != resp.TypeInteger || v.Num != 1 {
+		t.Errorf("expected :1 from PUBLISH, got %+v", v)
+	}
+
+	sub.expectArray(t, "pmessage", "news.*", "news.tech", "gophers")
+}
+
+func TestServerSubscribeModeRestrictsCommands(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+
+	c := dialPubSub(t, addr)
+	c.send(t, "SUBSCRIBE", "news")
+	c.expectArray(t, "subscribe", "news", 1)
+
+	c.send(t, "GET", "key")
+	if v := c.read(t); v.Type != resp.TypeError {
+		t.Errorf("expected error for GET in subscribe mode, got %+v", v)
+	}
+
+	c.send(t, "PING")
+	c.expectArray(t, "pong", "")
+
+	c.send(t, "PING", "hi")
+	c.expectArray(t, "pong", "hi")
+}
+
+func TestServerUnsubscribeLeavesSubscribeMode(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+
+	c := dialPubSub(t, addr)
+	c.send(t, "SUBSCRIBE", "a", "b")
+	c.expectArray(t, "subscribe", "a", 1)
+	c.expectArray(t, "subscribe", "b", 2)
+
+	c.send(t, "UNSUBSCRIBE", "a")
+	c.expectArray(t, "unsubscribe", "a", 1)
+
+	c.send(t, "UNSUBSCRIBE", "b")
+	c.expectArray(t, "unsubscribe", "b", 0)
+
+	// Back in normal mode: regular commands work and PING is a simple string
+	c.send(t, "SET", "key", "value")
+	if v := c.read(t); v.Type != resp.TypeSimpleString || v.Str != "OK" {
+		t.Errorf("expected +OK, got %+v", v)
+	}
+	c.send(t, "PING")
+	if v := c.read(t); v.Type != resp.TypeSimpleString || v.Str != "PONG" {
+		t.Errorf("expected +PONG, got %+v", v)
+	}
+}
+
+func TestServerSubscriptionsCleanedUpOnDisconnect(t *testing.T) {
+	_, ps, addr := startPubSubTestServer(t)
+
+	c := dialPubSub(t, addr)
+	c.send(t, "SUBSCRIBE", "news")
+	c.expectArray(t, "subscribe", "news", 1)
+	c.send(t, "PSUBSCRIBE", "news.*")
+	c.expectArray(t, "psubscribe", "news.*", 2)
+
+	_ = c.conn.Close()
+
+	waitForSubscribers(t, ps, "news", 0)
+	deadline := time.Now().Add(2 * time.Second)
+	for ps.GetPatternSubscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected pattern subscriptions to be removed, got %d", ps.GetPatternSubscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerQuit(t *testing.T) {
+	_, _, addr := startPubSubTestServer(t)
+
+	c := dialPubSub(t, addr)
+	c.send(t, "SUBSCRIBE", "news")
+	c.expectArray(t, "subscribe", "news", 1)
+
+	c.send(t, "QUIT")
+	if v := c.read(t); v.Type != resp.TypeSimpleString || v.Str != "OK" {
+		t.Errorf("expected +OK, got %+v", v)
+	}
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := resp.Parse(c.reader); err != resp.ErrUnexpectedEOF {
+		t.Errorf("expected connection to be closed after QUIT, got %v", err)
+	}
+}
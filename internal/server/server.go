@@ -2,30 +2,89 @@
 package server
 
 import (
-	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/scotro/mini-redis/internal/acl"
+	"github.com/scotro/mini-redis/internal/config"
 	"github.com/scotro/mini-redis/internal/persistence"
 	"github.com/scotro/mini-redis/internal/pubsub"
 	"github.com/scotro/mini-redis/internal/resp"
 	"github.com/scotro/mini-redis/internal/store"
+	"github.com/scotro/mini-redis/internal/transaction"
 )
 
+// redisVersion is the Redis version the server reports to clients.
+const redisVersion = "7.2.0"
+
 // Config holds server configuration.
 type Config struct {
+	// Port is the plaintext port; 0 picks a free port and a negative port
+	// disables plaintext connections.
 	Port int
+
+	// Bind lists the addresses the plaintext and TLS listeners bind to, as in
+	// redis.conf: "*" is every address and a leading "-" marks an address
+	// that may be unavailable. Empty means every address.
+	Bind []string
+
+	// TLS, when set, adds a TLS listener alongside the plaintext one.
+	TLS *TLSConfig
+
+	// Metrics, when set, adds an HTTP listener serving Prometheus metrics
+	// at /metrics.
+	Metrics *MetricsConfig
+
+	// AOF, when set, logs write commands to an append-only file, which is
+	// replayed at startup before connections are accepted.
+	AOF *AOFConfig
+
+	// UnixSocket, when set, is the path of a unix domain socket to accept
+	// connections on as well. UnixSocketPerm, if not zero, is the socket
+	// file's permission mode.
+	UnixSocket     string
+	UnixSocketPerm os.FileMode
+
+	// RequirePass, when set, is the password clients must send with AUTH
+	// before running other commands. It is the default user's password.
+	RequirePass string
+
+	// ACLFile, when set, is an ACL file whose users are loaded at startup.
+	ACLFile string
+
+	// Timeout, when set, closes connections idle for longer. Subscribed
+	// clients are never closed.
+	Timeout time.Duration
+
+	// Expiry tunes active expiration. Zero fields use store.DefaultExpiryConfig.
+	Expiry store.ExpiryConfig
+
+	// Protocol limits what clients may send. Zero fields use resp.DefaultLimits.
+	Protocol resp.Limits
+
+	// Params holds the parameters reported by CONFIG GET and changed by
+	// CONFIG SET, and the file CONFIG REWRITE updates. ConfigFromParams
+	// builds a Config that agrees with it. If nil, they are taken from the
+	// other fields.
+	Params *config.Config
 }
 
 // DefaultConfig returns the default server configuration.
 func DefaultConfig() Config {
 	return Config{
-		Port: 6379,
+		Port:     6379,
+		Expiry:   store.DefaultExpiryConfig(),
+		Protocol: resp.DefaultLimits(),
 	}
 }
 
@@ -36,33 +95,103 @@ type Server struct {
 	listStore          store.ListStore
 	hashStore          store.HashStore
 	setStore           store.SetStore
+	zsetStore          store.ZSetStore
+	streamStore        store.StreamStore
+	keyspace           *store.Keyspace
 	listHandler        *ListCommandHandler
 	hashHandler        *HashCommands
+	zsetHandler        *ZSetCommands
+	streamHandler      *StreamCommands
+	blocking           *blockingManager
+	acl                *acl.ACL
 	persistenceHandler *PersistenceHandler
 	pubsubHandler      *PubSubHandler
-	listener           net.Listener
+	versionTracker     transaction.VersionTracker
+	params             *config.Config
+	stats              serverStats
+	startTime          time.Time
+	runID              string
+	connectedClients   atomic.Int64
+	listeners          []net.Listener
+	tlsListeners       []net.Listener
+	unixListener       net.Listener
+	metricsListeners   []net.Listener
+	metricsServer      *http.Server
+	commandMetrics     *commandMetrics
+	aof                *persistence.AOF
 	wg                 sync.WaitGroup
 	quit               chan struct{}
+	stopOnce           sync.Once
+	nextClientID       atomic.Int64
+
+	// conns holds the open client connections, closed when the server stops.
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+
+	// limits and idleTimeout can be changed by CONFIG SET while connections
+	// read commands.
+	limits      atomic.Pointer[resp.Limits]
+	idleTimeout atomic.Int64
+
+	// execMu serializes command execution across connections, so a
+	// transaction's queued commands run without any other client interleaving.
+	execMu sync.Mutex
+
+	// aofTx holds the records of the transaction EXEC is running, and
+	// aofLastWriteErr the result of the last append; both are guarded by execMu.
+	aofTx           [][]string
+	aofLastWriteErr error
 }
 
 // New creates a new server with the given stores and configuration.
 // Pass nil for persistMgr or ps if those features are not needed.
-func New(s store.Store, listStore store.ListStore, hashStore store.HashStore, setStore store.SetStore, persistMgr *persistence.Manager, ps *pubsub.PubSub, cfg Config) *Server {
+func New(s store.Store, listStore store.ListStore, hashStore store.HashStore, setStore store.SetStore, zsetStore store.ZSetStore, streamStore store.StreamStore, persistMgr *persistence.Manager, ps *pubsub.PubSub, cfg Config) *Server {
 	srv := &Server{
-		config:    cfg,
-		store:     s,
-		listStore: listStore,
-		hashStore: hashStore,
-		setStore:  setStore,
-		quit:      make(chan struct{}),
+		config:         cfg,
+		store:          s,
+		listStore:      listStore,
+		hashStore:      hashStore,
+		setStore:       setStore,
+		zsetStore:      zsetStore,
+		streamStore:    streamStore,
+		acl:            acl.New(),
+		startTime:      time.Now(),
+		runID:          newRunID(),
+		commandMetrics: newCommandMetrics(),
+		quit:           make(chan struct{}),
+		conns:          make(map[net.Conn]struct{}),
+	}
+	// Join the stores into one keyspace; its version tracker lets WATCH see writes to any type
+	srv.keyspace = store.NewKeyspace(s, listStore, hashStore, setStore, zsetStore, streamStore)
+	srv.blocking = newBlockingManager(srv.keyspace.Type)
+	srv.versionTracker = srv.keyspace.Versions()
+	srv.keyspace.SetExpiryConfig(cfg.Expiry)
+	limits := cfg.Protocol
+	srv.limits.Store(&limits)
+	srv.idleTimeout.Store(int64(cfg.Timeout))
+
+	srv.params = cfg.Params
+	if srv.params == nil {
+		srv.params = paramsFromConfig(cfg, persistMgr)
+	}
+	srv.acl.Log().SetMaxLen(srv.params.Int("acllog-max-len"))
+
+	if cfg.RequirePass != "" {
+		_ = srv.acl.SetUser(acl.DefaultUser, "resetpass", ">"+cfg.RequirePass)
 	}
+
 	// Initialize command handlers
-	srv.listHandler = NewListCommandHandler(listStore, s)
-	srv.hashHandler = NewHashCommands(hashStore, s)
+	srv.listHandler = NewListCommandHandler(srv.keyspace)
+	srv.listHandler.blocking = srv.blocking
+	srv.hashHandler = NewHashCommands(srv.keyspace)
+	srv.zsetHandler = NewZSetCommands(srv.keyspace)
+	srv.streamHandler = NewStreamCommands(srv.keyspace)
+	srv.streamHandler.blocking = srv.blocking
 
 	// Initialize persistence handler if manager provided
 	if persistMgr != nil {
 		srv.persistenceHandler = NewPersistenceHandler(persistMgr)
+		persistMgr.SetChangeCounter(srv.keyspace.Versions().Changes)
 	}
 
 	// Initialize pubsub handler if PubSub provided
@@ -73,42 +202,252 @@ func New(s store.Store, listStore store.ListStore, hashStore store.HashStore, se
 	return srv
 }
 
-// Start begins listening for connections.
+// tlsHandshakeTimeout bounds how long a TLS client may take to complete the handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// Start loads the ACL file and replays the append-only file, if any, checks
+// the data loaded can be saved in the snapshot format, and begins listening
+// for connections on the plaintext port, the TLS port and the unix socket,
+// as configured.
 func (s *Server) Start() error {
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	if s.config.ACLFile != "" {
+		if err := s.acl.LoadFile(s.config.ACLFile); err != nil {
+			return fmt.Errorf("failed to load ACL file: %w", err)
+		}
+	}
+	if s.config.AOF != nil {
+		if err := s.loadAOF(); err != nil {
+			return err
+		}
+	}
+	if s.persistenceHandler != nil {
+		if err := s.checkSnapshotFormat(s.persistenceHandler.manager.Format()); err != nil {
+			s.closeAOF()
+			return fmt.Errorf("invalid snapshot-format: %w", err)
+		}
 	}
-	s.listener = listener
-	log.Printf("Mini-Redis server listening on %s", addr)
 
-	go s.acceptConnections()
+	if err := s.listen(); err != nil {
+		s.closeListeners()
+		s.closeAOF()
+		return err
+	}
+	for _, listener := range s.allListeners() {
+		go s.acceptConnections(listener)
+	}
+	if s.metricsServer != nil {
+		s.serveMetricsHTTP()
+	}
+	if s.persistenceHandler != nil {
+		s.wg.Add(1)
+		go s.runSaveRules()
+	}
 	return nil
 }
 
-// Stop gracefully shuts down the server.
-func (s *Server) Stop() {
-	close(s.quit)
-	if s.listener != nil {
-		if err := s.listener.Close(); err != nil {
+// listen opens the configured listeners. On error, the ones already open
+// are left for the caller to close.
+func (s *Server) listen() error {
+	if s.config.Port < 0 && s.config.TLS == nil && s.config.UnixSocket == "" {
+		return errors.New("no listeners configured: the plaintext port is disabled and neither TLS nor a unix socket is set")
+	}
+
+	if s.config.Port >= 0 {
+		listeners, err := s.listenTCP(s.config.Port, nil)
+		if err != nil {
+			return err
+		}
+		for _, listener := range listeners {
+			log.Printf("Mini-Redis server listening on %s", listener.Addr())
+		}
+		s.listeners = listeners
+	}
+
+	if s.config.TLS != nil {
+		tlsConfig, err := s.config.TLS.load()
+		if err != nil {
+			return err
+		}
+		listeners, err := s.listenTCP(s.config.TLS.Port, tlsConfig)
+		if err != nil {
+			return err
+		}
+		for _, listener := range listeners {
+			log.Printf("Mini-Redis server listening for TLS on %s", listener.Addr())
+		}
+		s.tlsListeners = listeners
+	}
+
+	if s.config.UnixSocket != "" {
+		listener, err := listenUnix(s.config.UnixSocket, s.config.UnixSocketPerm)
+		if err != nil {
+			return err
+		}
+		s.unixListener = listener
+		log.Printf("Mini-Redis server listening on unix socket %s", s.config.UnixSocket)
+	}
+
+	// Opened last, so the listeners are only left open once everything else is
+	if s.config.Metrics != nil {
+		return s.listenMetrics()
+	}
+	return nil
+}
+
+// listenTCP listens on port at each bind address, over TLS if tlsConfig is
+// set. Addresses marked optional are skipped if they can't be bound.
+func (s *Server) listenTCP(port int, tlsConfig *tls.Config) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, host := range bindHosts(s.config.Bind) {
+		optional := strings.HasPrefix(host, "-")
+		addr := net.JoinHostPort(strings.TrimPrefix(host, "-"), strconv.Itoa(port))
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			if optional {
+				log.Printf("Skipping optional bind address %s: %v", addr, err)
+				continue
+			}
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("failed to listen on port %d: no bind address is available", port)
+	}
+	return listeners, nil
+}
+
+// bindHosts returns the hosts to listen on for the bind addresses. A
+// wildcard, "*" or "::*", listens on every address, IPv4 and IPv6 alike,
+// so it replaces the others.
+func bindHosts(bind []string) []string {
+	hosts := make([]string, 0, len(bind))
+	for _, addr := range bind {
+		switch strings.TrimPrefix(addr, "-") {
+		case "*", "::*":
+			return []string{""}
+		}
+		hosts = append(hosts, addr)
+	}
+	if len(hosts) == 0 {
+		return []string{""}
+	}
+	return hosts
+}
+
+// allListeners returns the listeners that are open.
+func (s *Server) allListeners() []net.Listener {
+	open := append(append([]net.Listener(nil), s.listeners...), s.tlsListeners...)
+	if s.unixListener != nil {
+		open = append(open, s.unixListener)
+	}
+	return open
+}
+
+// closeListeners closes every open listener. Closing the unix socket
+// listener also removes the socket file.
+func (s *Server) closeListeners() {
+	for _, listener := range s.allListeners() {
+		if err := listener.Close(); err != nil {
 			log.Printf("Error closing listener: %v", err)
 		}
 	}
+}
+
+// Stop gracefully shuts down the server and closes the append-only file.
+// Clients blocked in BLPOP and friends are released and disconnected. Calling Stop again has no effect.
+func (s *Server) Stop() {
+	s.beginStop()
 	s.wg.Wait()
+	s.closeAOF()
+}
+
+// beginStop tells every goroutine to stop and closes the listeners and the
+// client connections, without waiting.
+func (s *Server) beginStop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+		s.closeListeners()
+		if s.metricsServer != nil {
+			_ = s.metricsServer.Close()
+		}
+		s.connsMu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.connsMu.Unlock()
+	})
+}
+
+// Done returns a channel closed once the server begins stopping, such as
+// after a SHUTDOWN command. Stop must still be called to finish.
+func (s *Server) Done() <-chan struct{} {
+	return s.quit
+}
+
+// stopping reports whether the server has begun stopping.
+func (s *Server) stopping() bool {
+	select {
+	case <-s.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// trackConn adds conn to the open connections, unless the server is
+// stopping, in which case it returns false.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.stopping() {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrackConn removes conn from the open connections.
+func (s *Server) untrackConn(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, conn)
 }
 
-// Addr returns the server's listener address (useful for testing).
+// Addr returns the address of the server's first plaintext listener (useful for testing).
 func (s *Server) Addr() net.Addr {
-	if s.listener == nil {
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	return s.listeners[0].Addr()
+}
+
+// TLSAddr returns the address of the server's first TLS listener (useful for testing).
+func (s *Server) TLSAddr() net.Addr {
+	if len(s.tlsListeners) == 0 {
+		return nil
+	}
+	return s.tlsListeners[0].Addr()
+}
+
+// UnixAddr returns the server's unix socket address (useful for testing).
+func (s *Server) UnixAddr() net.Addr {
+	if s.unixListener == nil {
 		return nil
 	}
-	return s.listener.Addr()
+	return s.unixListener.Addr()
 }
 
-func (s *Server) acceptConnections() {
+func (s *Server) acceptConnections(listener net.Listener) {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-s.quit:
@@ -119,6 +458,7 @@ func (s *Server) acceptConnections() {
 			}
 		}
 
+		s.stats.connectionsReceived.Add(1)
 		s.wg.Add(1)
 		go s.handleConnection(conn)
 	}
@@ -127,12 +467,34 @@ func (s *Server) acceptConnections() {
 func (s *Server) handleConnection(conn net.Conn) {
 	defer s.wg.Done()
 	defer func() {
-		if err := conn.Close(); err != nil {
+		// The connection was already closed if the server is stopping
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			log.Printf("Error closing connection: %v", err)
 		}
 	}()
+	if !s.trackConn(conn) {
+		return
+	}
+	defer s.untrackConn(conn)
+
+	// Finish the TLS handshake up front, so failures are reported as such
+	// and clients that never complete it don't hold the connection open
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		_ = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			log.Printf("TLS handshake failed: %v", err)
+			return
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
 
-	reader := bufio.NewReader(conn)
+	c := newClient(s.nextClientID.Add(1), conn, s.versionTracker)
+	s.connectedClients.Add(1)
+	defer s.connectedClients.Add(-1)
+	// As in Redis, clients that connect while no password is needed stay
+	// authenticated if one is set later
+	c.authenticated = !s.acl.RequiresAuth()
+	defer s.closeClient(c)
 
 	for {
 		select {
@@ -141,23 +503,232 @@ func (s *Server) handleConnection(conn net.Conn) {
 		default:
 		}
 
-		value, err := resp.Parse(reader)
+		// Idle clients are closed once the timeout passes, unless subscribed
+		idle := false
+		if timeout := time.Duration(s.idleTimeout.Load()); timeout > 0 && !s.inSubscribeMode(c) {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
+			idle = true
+		}
+		value, err := resp.ParseCommand(c.reader, *s.limits.Load())
+		if idle {
+			_ = conn.SetReadDeadline(time.Time{})
+		}
 		if err != nil {
-			if err != resp.ErrUnexpectedEOF {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				// Idle timeout
+				return
+			}
+			if resp.IsProtocolError(err) {
+				// The rest of the input can't be trusted, so reply and drop the connection
+				_ = c.write(respError("ERR Protocol error: " + err.Error()))
+			} else if err != resp.ErrUnexpectedEOF && !s.stopping() {
 				log.Printf("Error parsing command: %v", err)
 			}
 			return
 		}
 
-		response := s.executeCommand(value)
-		if _, err := conn.Write(response.Serialize()); err != nil {
-			log.Printf("Error writing response: %v", err)
+		s.stats.commandsProcessed.Add(1)
+		start := time.Now()
+		response, ok := s.handleClientCommand(c, value)
+		s.commandMetrics.observe(value, start)
+		if ok {
+			if err := c.write(response); err != nil {
+				if !s.stopping() {
+					log.Printf("Error writing response: %v", err)
+				}
+				return
+			}
+		}
+
+		if c.closing {
 			return
 		}
 	}
 }
 
-func (s *Server) executeCommand(value resp.Value) resp.Value {
+// closeClient releases everything a client holds once its connection ends.
+// Replies still buffered, such as the reply to QUIT, are flushed first.
+func (s *Server) closeClient(c *client) {
+	if err := c.flush(); err != nil && !s.stopping() {
+		log.Printf("Error writing response: %v", err)
+	}
+	if c.subscriber != nil && s.pubsubHandler != nil {
+		s.pubsubHandler.RemoveSubscriber(c.subscriber)
+	}
+	c.tx.Close()
+	c.stopWriter()
+}
+
+// handleClientCommand executes a command on behalf of a connection.
+// Commands that depend on per-connection state are handled here; everything
+// else is passed to executeCommand under the execution lock.
+// Returns false if the command has no direct reply (subscription confirmations
+// are delivered through the client's subscriber instead).
+func (s *Server) handleClientCommand(c *client, value resp.Value) (resp.Value, bool) {
+	if value.Type != resp.TypeArray || len(value.Array) == 0 || value.Array[0].Type != resp.TypeBulkString {
+		return s.executeCommand(c, value), true
+	}
+
+	cmd := strings.ToUpper(value.Array[0].Str)
+	args := value.Array[1:]
+
+	if s.authRequired(c) && cmd != "AUTH" && cmd != "HELLO" && cmd != "QUIT" {
+		return respError("NOAUTH Authentication required."), true
+	}
+
+	// RESP3 clients receive messages as push frames, so they may run any command while subscribed
+	subscribed := s.inSubscribeMode(c) && c.protocol() == resp.RESP2
+	if subscribed && !IsSubscriptionCommand(cmd) {
+		return respError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd))), true
+	}
+
+	// Commands queued by MULTI are checked now and again when EXEC runs them;
+	// commands handled below never reach executeCommand, so they are checked here
+	if c.tx.InTransaction() || isConnectionCommand(cmd) {
+		if reply, ok := s.checkACL(c, cmd, args); !ok {
+			return reply, true
+		}
+	}
+
+	// Inside MULTI everything except the transaction commands is queued
+	if c.tx.InTransaction() && !IsTransactionCommand(cmd) && cmd != "QUIT" {
+		return c.tx.QueueCommand(cmd, argStrings(args)), true
+	}
+
+	switch cmd {
+	case "MULTI":
+		return c.tx.HandleMulti(args), true
+	case "EXEC":
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+		defer s.blocking.serveReady()
+		c.inExec = true
+		defer func() { c.inExec = false }()
+		reply := c.tx.HandleExec(args, func(cmd string, args []string) (resp.Value, error) {
+			return s.executeQueued(c, cmd, args)
+		})
+		if err := s.flushAOFTransaction(); err != nil {
+			return aofWriteError(err), true
+		}
+		return reply, true
+	case "DISCARD":
+		return c.tx.HandleDiscard(args), true
+	case "WATCH":
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+		return c.tx.HandleWatch(args), true
+	case "UNWATCH":
+		return c.tx.HandleUnwatch(args), true
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return s.handleSubscription(c, cmd, args)
+	case "PING":
+		if subscribed {
+			if len(args) > 1 {
+				return respError("ERR wrong number of arguments for 'ping' command"), true
+			}
+			message := ""
+			if len(args) == 1 {
+				message = args[0].Str
+			}
+			return FormatSubscribePong(message), true
+		}
+	case "QUIT":
+		c.closing = true
+		return respSimpleString("OK"), true
+	case "AUTH":
+		return s.handleAuth(c, args), true
+	case "HELLO":
+		return s.handleHello(c, args), true
+	case "ACL":
+		return s.handleACL(c, args), true
+	case "SHUTDOWN":
+		return s.handleShutdown(c, args)
+	case "BLPOP", "BRPOP", "BLMOVE", "BLMPOP", "XREAD", "XREADGROUP":
+		return s.handleBlockingCommand(c, cmd, args)
+	case "DIFF":
+		return s.handleDiff(args, &s.execMu), true
+	}
+
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	// Clients blocked on keys this command pushed to are served before anyone else runs
+	defer s.blocking.serveReady()
+	return s.executeCommand(c, value), true
+}
+
+// isConnectionCommand reports whether cmd is run by handleClientCommand
+// rather than executeCommand, as it depends on the connection's state.
+func isConnectionCommand(cmd string) bool {
+	switch cmd {
+	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH",
+		"SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE",
+		"AUTH", "HELLO", "QUIT", "ACL", "SHUTDOWN",
+		"BLPOP", "BRPOP", "BLMOVE", "BLMPOP", "XREAD", "XREADGROUP",
+		"DIFF":
+		return true
+	default:
+		return false
+	}
+}
+
+// executeQueued runs a command queued by MULTI on behalf of c.
+// The caller holds execMu for the whole EXEC, so queued commands run back to back.
+func (s *Server) executeQueued(c *client, cmd string, args []string) (resp.Value, error) {
+	array := make([]resp.Value, 0, len(args)+1)
+	array = append(array, respBulkString(cmd))
+	for _, arg := range args {
+		array = append(array, respBulkString(arg))
+	}
+	return s.executeCommand(c, resp.Value{Type: resp.TypeArray, Array: array}), nil
+}
+
+// argStrings converts command arguments to plain strings.
+func argStrings(args []resp.Value) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.Str
+	}
+	return strs
+}
+
+// inSubscribeMode returns true if the client has at least one channel or pattern subscription.
+func (s *Server) inSubscribeMode(c *client) bool {
+	if c.subscriber == nil || s.pubsubHandler == nil {
+		return false
+	}
+	return s.pubsubHandler.SubscriptionCount(c.subscriber) > 0
+}
+
+// handleSubscription handles SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE.
+// Confirmations are queued on the client's subscriber and streamed by its writer goroutine.
+func (s *Server) handleSubscription(c *client, cmd string, args []resp.Value) (resp.Value, bool) {
+	if s.pubsubHandler == nil {
+		return respError("ERR pubsub not configured"), true
+	}
+
+	c.startSubscriber()
+
+	var result resp.Value
+	switch cmd {
+	case "SUBSCRIBE":
+		result = s.pubsubHandler.HandleSubscribe(c.subscriber, args)
+	case "PSUBSCRIBE":
+		result = s.pubsubHandler.HandlePSubscribe(c.subscriber, args)
+	case "UNSUBSCRIBE":
+		result = s.pubsubHandler.HandleUnsubscribe(c.subscriber, args)
+	case "PUNSUBSCRIBE":
+		result = s.pubsubHandler.HandlePUnsubscribe(c.subscriber, args)
+	}
+
+	if result.Type == resp.TypeError {
+		return result, true
+	}
+	return resp.Value{}, false
+}
+
+// executeCommand runs a command after checking that c's user may run it.
+// A nil client is the server itself, which may run anything.
+func (s *Server) executeCommand(c *client, value resp.Value) resp.Value {
 	if value.Type != resp.TypeArray || len(value.Array) == 0 {
 		return respError("ERR invalid command format")
 	}
@@ -170,6 +741,24 @@ func (s *Server) executeCommand(value resp.Value) resp.Value {
 	cmd := strings.ToUpper(cmdVal.Str)
 	args := value.Array[1:]
 
+	if c != nil {
+		if reply, ok := s.checkACL(c, cmd, args); !ok {
+			return reply
+		}
+	}
+
+	if reply, ok := s.checkAOFWritable(cmd); !ok {
+		return reply
+	}
+	reply := s.runCommand(cmd, args)
+	if err := s.feedAOF(c, cmd, args, reply); err != nil {
+		return aofWriteError(err)
+	}
+	return reply
+}
+
+// runCommand runs a command, given in uppercase, and returns its reply.
+func (s *Server) runCommand(cmd string, args []resp.Value) resp.Value {
 	switch cmd {
 	case "PING":
 		return s.handlePing(args)
@@ -181,10 +770,25 @@ func (s *Server) executeCommand(value resp.Value) resp.Value {
 		return s.handleSet(args)
 	case "DEL":
 		return s.handleDel(args)
-	case "EXPIRE":
-		return s.handleExpire(args)
-	case "TTL":
-		return s.handleTTL(args)
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		return s.handleExpire(cmd, args)
+	case "PERSIST":
+		return s.handlePersist(args)
+	case "TTL", "PTTL":
+		return s.handleTTL(cmd, args)
+	case "EXPIRETIME", "PEXPIRETIME":
+		return s.handleExpireTime(cmd, args)
+	case "FLUSHDB", "FLUSHALL":
+		return s.handleFlush(cmd, args)
+	// Key commands
+	case "EXISTS":
+		return s.handleExists(args)
+	case "TYPE":
+		return s.handleType(args)
+	case "KEYS":
+		return s.handleKeys(args)
+	case "DBSIZE":
+		return s.handleDBSize(args)
 	// List commands
 	case "LPUSH":
 		return s.listHandler.HandleLPush(args)
@@ -198,6 +802,13 @@ func (s *Server) executeCommand(value resp.Value) resp.Value {
 		return s.listHandler.HandleLRange(args)
 	case "LLEN":
 		return s.listHandler.HandleLLen(args)
+	case "LMOVE":
+		return s.listHandler.HandleLMove(args)
+	case "LMPOP":
+		return s.listHandler.HandleLMPop(args)
+	case "BLPOP", "BRPOP", "BLMOVE", "BLMPOP":
+		// Connections block in handleClientCommand; inside MULTI these don't block
+		return s.listHandler.HandleBlocking(cmd, args)
 	// Hash commands
 	case "HSET":
 		return s.hashHandler.HandleHSet(args)
@@ -224,6 +835,61 @@ func (s *Server) executeCommand(value resp.Value) resp.Value {
 		return s.handleSCard(args)
 	case "SINTER":
 		return s.handleSInter(args)
+	// Sorted set commands
+	case "ZADD":
+		return s.zsetHandler.HandleZAdd(args)
+	case "ZINCRBY":
+		return s.zsetHandler.HandleZIncrBy(args)
+	case "ZREM":
+		return s.zsetHandler.HandleZRem(args)
+	case "ZSCORE":
+		return s.zsetHandler.HandleZScore(args)
+	case "ZMSCORE":
+		return s.zsetHandler.HandleZMScore(args)
+	case "ZCARD":
+		return s.zsetHandler.HandleZCard(args)
+	case "ZCOUNT":
+		return s.zsetHandler.HandleZCount(args)
+	case "ZRANK", "ZREVRANK":
+		return s.zsetHandler.HandleZRank(cmd, args)
+	case "ZRANGE":
+		return s.zsetHandler.HandleZRange(args)
+	case "ZRANGESTORE":
+		return s.zsetHandler.HandleZRangeStore(args)
+	case "ZPOPMIN", "ZPOPMAX":
+		return s.zsetHandler.HandleZPop(cmd, args)
+	case "ZREMRANGEBYRANK":
+		return s.zsetHandler.HandleZRemRangeByRank(args)
+	case "ZREMRANGEBYSCORE":
+		return s.zsetHandler.HandleZRemRangeByScore(args)
+	case "ZREMRANGEBYLEX":
+		return s.zsetHandler.HandleZRemRangeByLex(args)
+	case "XADD":
+		return s.streamHandler.HandleXAdd(args)
+	case "XLEN":
+		return s.streamHandler.HandleXLen(args)
+	case "XRANGE", "XREVRANGE":
+		return s.streamHandler.HandleXRange(cmd, args)
+	case "XDEL":
+		return s.streamHandler.HandleXDel(args)
+	case "XTRIM":
+		return s.streamHandler.HandleXTrim(args)
+	case "XREAD":
+		return s.streamHandler.HandleXRead(args)
+	case "XGROUP":
+		return s.streamHandler.HandleXGroup(args)
+	case "XREADGROUP":
+		return s.streamHandler.HandleXReadGroup(args)
+	case "XACK":
+		return s.streamHandler.HandleXAck(args)
+	case "XPENDING":
+		return s.streamHandler.HandleXPending(args)
+	case "XCLAIM":
+		return s.streamHandler.HandleXClaim(args)
+	case "XAUTOCLAIM":
+		return s.streamHandler.HandleXAutoClaim(args)
+	case "XINFO":
+		return s.streamHandler.HandleXInfo(args)
 
 	// Persistence commands
 	case "SAVE":
@@ -236,6 +902,20 @@ func (s *Server) executeCommand(value resp.Value) resp.Value {
 			return respError("ERR persistence not configured")
 		}
 		return s.persistenceHandler.HandleBGSave(args)
+	case "LASTSAVE":
+		return s.handleLastSave(args)
+	case "SHUTDOWN":
+		// Stopping the server closes the connection, so it is handled by handleClientCommand
+		return respError(fmt.Sprintf("ERR '%s' is not allowed in this context", strings.ToLower(cmd)))
+	case "DIFF":
+		// Only EXEC runs DIFF here, holding execMu; clients reach it through handleClientCommand
+		return s.handleDiff(args, nil)
+
+	// Server commands
+	case "CONFIG":
+		return s.handleConfig(args)
+	case "INFO":
+		return s.handleInfo(args)
 
 	// Pub/Sub commands
 	case "PUBLISH":
@@ -243,18 +923,19 @@ func (s *Server) executeCommand(value resp.Value) resp.Value {
 			return respError("ERR pubsub not configured")
 		}
 		return s.pubsubHandler.HandlePublish(args)
-	case "SUBSCRIBE", "PSUBSCRIBE":
-		// SUBSCRIBE/PSUBSCRIBE require per-connection subscriber state
-		// Full integration requires refactoring handleConnection()
-		return respError("ERR SUBSCRIBE/PSUBSCRIBE not yet integrated (requires per-connection state)")
-	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
-		return respError("ERR UNSUBSCRIBE/PUNSUBSCRIBE not yet integrated (requires per-connection state)")
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		// Subscriptions belong to a connection and are handled by handleClientCommand
+		return respError(fmt.Sprintf("ERR '%s' is not allowed in this context", strings.ToLower(cmd)))
 
 	// Transaction commands
 	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH":
-		// Transactions require per-connection Transaction state
-		// Full integration requires refactoring handleConnection()
-		return respError("ERR transactions not yet integrated (requires per-connection state)")
+		// Transaction state belongs to a connection and is handled by handleClientCommand
+		return respError(fmt.Sprintf("ERR '%s' is not allowed in this context", strings.ToLower(cmd)))
+
+	// Connection commands
+	case "AUTH", "HELLO", "ACL":
+		// Authentication, the protocol version and the current user belong to a connection and are handled by handleClientCommand
+		return respError(fmt.Sprintf("ERR '%s' is not allowed in this context", strings.ToLower(cmd)))
 
 	default:
 		return respError(fmt.Sprintf("ERR unknown command '%s'", cmd))
@@ -305,6 +986,10 @@ func (s *Server) handleGet(args []resp.Value) resp.Value {
 	}
 
 	key := args[0].Str
+	if err := s.keyspace.CheckType(key, store.TypeString); err != nil {
+		return respError(err.Error())
+	}
+
 	value, exists := s.store.Get(key)
 	if !exists {
 		return respNullBulkString()
@@ -332,6 +1017,7 @@ func (s *Server) handleSet(args []resp.Value) resp.Value {
 			if err != nil || seconds <= 0 {
 				return respError("ERR invalid expire time in 'set' command")
 			}
+			s.keyspace.Overwrite(key, store.TypeString)
 			s.store.SetWithTTL(key, value, time.Duration(seconds)*time.Second)
 			return respSimpleString("OK")
 		default:
@@ -339,6 +1025,8 @@ func (s *Server) handleSet(args []resp.Value) resp.Value {
 		}
 	}
 
+	// SET replaces whatever the key held, whatever its type
+	s.keyspace.Overwrite(key, store.TypeString)
 	s.store.Set(key, value)
 	return respSimpleString("OK")
 }
@@ -350,52 +1038,67 @@ func (s *Server) handleDel(args []resp.Value) resp.Value {
 
 	deleted := 0
 	for _, arg := range args {
-		if s.store.Delete(arg.Str) {
+		if s.keyspace.Delete(arg.Str) {
 			deleted++
 		}
 	}
 	return respInteger(deleted)
 }
 
-func (s *Server) handleExpire(args []resp.Value) resp.Value {
-	if len(args) != 2 {
-		return respError("ERR wrong number of arguments for 'expire' command")
+func (s *Server) handleFlush(cmd string, args []resp.Value) resp.Value {
+	if len(args) > 1 {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
 	}
-
-	key := args[0].Str
-	seconds, err := strconv.Atoi(args[1].Str)
-	if err != nil {
-		return respError("ERR value is not an integer or out of range")
+	if len(args) == 1 {
+		// ASYNC and SYNC are accepted for compatibility; flushing is always synchronous
+		mode := strings.ToUpper(args[0].Str)
+		if mode != "ASYNC" && mode != "SYNC" {
+			return respError("ERR syntax error")
+		}
 	}
 
-	// Get current value, then set with TTL
-	value, exists := s.store.Get(key)
-	if !exists {
-		return respInteger(0)
+	s.keyspace.Flush()
+	return respSimpleString("OK")
+}
+
+func (s *Server) handleExists(args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return respError("ERR wrong number of arguments for 'exists' command")
 	}
 
-	s.store.SetWithTTL(key, value, time.Duration(seconds)*time.Second)
-	return respInteger(1)
+	// Keys are counted once per occurrence, as in Redis
+	count := 0
+	for _, arg := range args {
+		if s.keyspace.Exists(arg.Str) {
+			count++
+		}
+	}
+	return respInteger(count)
 }
 
-func (s *Server) handleTTL(args []resp.Value) resp.Value {
+func (s *Server) handleType(args []resp.Value) resp.Value {
 	if len(args) != 1 {
-		return respError("ERR wrong number of arguments for 'ttl' command")
+		return respError("ERR wrong number of arguments for 'type' command")
 	}
+	return respSimpleString(s.keyspace.Type(args[0].Str))
+}
 
-	key := args[0].Str
-
-	// First check if key exists
-	_, exists := s.store.Get(key)
-	if !exists {
-		return respInteger(-2) // key does not exist
+func (s *Server) handleKeys(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return respError("ERR wrong number of arguments for 'keys' command")
 	}
 
-	// Check TTL
-	ttl, hasTTL := s.store.TTL(key)
-	if !hasTTL {
-		return respInteger(-1) // key exists but has no TTL
+	keys := s.keyspace.Keys(args[0].Str)
+	array := make([]resp.Value, len(keys))
+	for i, key := range keys {
+		array[i] = respBulkString(key)
 	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
 
-	return respInteger(int(ttl.Seconds()))
+func (s *Server) handleDBSize(args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		return respError("ERR wrong number of arguments for 'dbsize' command")
+	}
+	return respInteger(s.keyspace.Size())
 }
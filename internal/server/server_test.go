@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"net"
+	"reflect"
 	"testing"
 	"time"
 
@@ -12,13 +13,17 @@ import (
 )
 
 func startTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	return startTestServerWithConfig(t, Config{Port: 0}) // Use port 0 to get a random available port
+}
+
+func startTestServerWithConfig(t *testing.T, cfg Config) (*Server, string) {
 	t.Helper()
 	st := store.New()
 	listStore := store.NewListStore()
 	hashStore := store.NewHashStore()
 	setStore := store.NewSetStore()
-	cfg := Config{Port: 0} // Use port 0 to get a random available port
-	srv := New(st, listStore, hashStore, setStore, nil, nil, cfg)
+	srv := New(st, listStore, hashStore, setStore, store.NewZSetStore(), store.NewStreamStore(), nil, nil, cfg)
 
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Failed to start server: %v", err)
@@ -26,9 +31,13 @@ func startTestServer(t *testing.T) (*Server, string) {
 
 	t.Cleanup(func() {
 		srv.Stop()
-		st.Close()
+		srv.keyspace.Close()
 	})
 
+	if srv.Addr() == nil {
+		// Plaintext disabled; callers use srv.TLSAddr()
+		return srv, ""
+	}
 	return srv, srv.Addr().String()
 }
 
@@ -342,3 +351,213 @@ func TestCaseInsensitiveCommands(t *testing.T) {
 		t.Errorf("Expected +PONG, got %v", response)
 	}
 }
+
+func TestWrongTypeAcrossTypes(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "SET", "str", "v")
+	sendCommand(t, conn, "RPUSH", "list", "a")
+	sendCommand(t, conn, "HSET", "hash", "f", "v")
+	sendCommand(t, conn, "SADD", "set", "m")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"GET on list", []string{"GET", "list"}},
+		{"RPUSH on hash", []string{"RPUSH", "hash", "x"}},
+		{"LRANGE on set", []string{"LRANGE", "set", "0", "-1"}},
+		{"HSET on list", []string{"HSET", "list", "f", "v"}},
+		{"HGET on set", []string{"HGET", "set", "f"}},
+		{"SADD on hash", []string{"SADD", "hash", "m"}},
+		{"SMEMBERS on list", []string{"SMEMBERS", "list"}},
+		{"SINTER with hash", []string{"SINTER", "set", "hash"}},
+		{"LPUSH on string", []string{"LPUSH", "str", "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := sendCommand(t, conn, tt.args...)
+			if response.Type != resp.TypeError || response.Str != "WRONGTYPE Operation against a key holding the wrong kind of value" {
+				t.Errorf("Expected WRONGTYPE error, got %v", response)
+			}
+		})
+	}
+}
+
+func TestSetOverwritesOtherTypes(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "RPUSH", "key", "a", "b")
+
+	response := sendCommand(t, conn, "SET", "key", "value")
+	if response.Type != resp.TypeSimpleString || response.Str != "OK" {
+		t.Fatalf("Expected +OK, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "TYPE", "key")
+	if response.Str != "string" {
+		t.Errorf("Expected type string, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "RPUSH", "key", "c")
+	if response.Type != resp.TypeError {
+		t.Errorf("Expected WRONGTYPE after SET replaced the list, got %v", response)
+	}
+}
+
+func TestTypeCommand(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "SET", "str", "v")
+	sendCommand(t, conn, "RPUSH", "list", "a")
+	sendCommand(t, conn, "HSET", "hash", "f", "v")
+	sendCommand(t, conn, "SADD", "set", "m")
+
+	tests := map[string]string{
+		"str":     "string",
+		"list":    "list",
+		"hash":    "hash",
+		"set":     "set",
+		"missing": "none",
+	}
+
+	for key, want := range tests {
+		response := sendCommand(t, conn, "TYPE", key)
+		if response.Type != resp.TypeSimpleString || response.Str != want {
+			t.Errorf("TYPE %s: expected +%s, got %v", key, want, response)
+		}
+	}
+}
+
+func TestExistsAndDelAllTypes(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "SET", "str", "v")
+	sendCommand(t, conn, "RPUSH", "list", "a")
+	sendCommand(t, conn, "HSET", "hash", "f", "v")
+	sendCommand(t, conn, "SADD", "set", "m")
+
+	response := sendCommand(t, conn, "EXISTS", "str", "list", "hash", "set", "missing", "str")
+	if response.Type != resp.TypeInteger || response.Num != 5 {
+		t.Errorf("Expected :5, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "DEL", "str", "list", "hash", "set", "missing")
+	if response.Type != resp.TypeInteger || response.Num != 4 {
+		t.Errorf("Expected :4, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "EXISTS", "str", "list", "hash", "set")
+	if response.Type != resp.TypeInteger || response.Num != 0 {
+		t.Errorf("Expected :0, got %v", response)
+	}
+}
+
+func TestKeysAndDBSize(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "SET", "user:1", "v")
+	sendCommand(t, conn, "RPUSH", "user:2", "a")
+	sendCommand(t, conn, "HSET", "user:3", "f", "v")
+	sendCommand(t, conn, "SADD", "other", "m")
+
+	response := sendCommand(t, conn, "KEYS", "user:*")
+	if response.Type != resp.TypeArray || len(response.Array) != 3 {
+		t.Errorf("Expected 3 keys, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "KEYS", "*")
+	if response.Type != resp.TypeArray || len(response.Array) != 4 {
+		t.Errorf("Expected 4 keys, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "DBSIZE")
+	if response.Type != resp.TypeInteger || response.Num != 4 {
+		t.Errorf("Expected :4, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "FLUSHDB")
+	if response.Type != resp.TypeSimpleString || response.Str != "OK" {
+		t.Errorf("Expected +OK, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "DBSIZE")
+	if response.Type != resp.TypeInteger || response.Num != 0 {
+		t.Errorf("Expected :0 after FLUSHDB, got %v", response)
+	}
+}
+
+func TestBindHosts(t *testing.T) {
+	tests := []struct {
+		bind []string
+		want []string
+	}{
+		{nil, []string{""}},
+		{[]string{"*"}, []string{""}},
+		{[]string{"*", "-::*"}, []string{""}},
+		{[]string{"127.0.0.1", "-::1"}, []string{"127.0.0.1", "-::1"}},
+		{[]string{"127.0.0.1", "-::*"}, []string{""}},
+	}
+
+	for _, tt := range tests {
+		if got := bindHosts(tt.bind); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bindHosts(%q) = %q, want %q", tt.bind, got, tt.want)
+		}
+	}
+}
+
+func TestBindAddresses(t *testing.T) {
+	// 192.0.2.1 is reserved for documentation, so it can't be bound
+	cfg := DefaultConfig()
+	cfg.Port = 0
+	cfg.Bind = []string{"127.0.0.1", "-192.0.2.1"}
+	srv, addr := startTestServerWithConfig(t, cfg)
+
+	if host, _, _ := net.SplitHostPort(addr); host != "127.0.0.1" {
+		t.Errorf("Addr() = %s, want 127.0.0.1", addr)
+	}
+	if len(srv.listeners) != 1 {
+		t.Errorf("got %d listeners, want the optional address skipped", len(srv.listeners))
+	}
+	if got := sendCommand(t, dial(t, addr), "PING"); got.Str != "PONG" {
+		t.Errorf("PING = %v, want PONG", got)
+	}
+
+	required := createTestServer(t)
+	required.config.Bind = []string{"127.0.0.1", "192.0.2.1"}
+	if err := required.Start(); err == nil {
+		required.Stop()
+		t.Fatal("Expected Start to fail when a required address can't be bound")
+	}
+}
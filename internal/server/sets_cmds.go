@@ -34,9 +34,9 @@ func (s *Server) handleSAdd(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string store
-	if _, exists := s.store.Get(key); exists {
-		return respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	// Check for type conflict with other types
+	if err := s.keyspace.CheckType(key, store.TypeSet); err != nil {
+		return respError(err.Error())
 	}
 
 	members := make([]string, len(args)-1)
@@ -58,9 +58,9 @@ func (s *Server) handleSRem(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string store
-	if _, exists := s.store.Get(key); exists {
-		return respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	// Check for type conflict with other types
+	if err := s.keyspace.CheckType(key, store.TypeSet); err != nil {
+		return respError(err.Error())
 	}
 
 	members := make([]string, len(args)-1)
@@ -74,7 +74,7 @@ func (s *Server) handleSRem(args []resp.Value) resp.Value {
 
 // handleSMembers handles the SMEMBERS command.
 // SMEMBERS key
-// Returns all members of the set.
+// Returns all members of the set, as a RESP3 set or a RESP2 array.
 func (s *Server) handleSMembers(args []resp.Value) resp.Value {
 	if len(args) != 1 {
 		return respError("ERR wrong number of arguments for 'smembers' command")
@@ -82,9 +82,9 @@ func (s *Server) handleSMembers(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string store
-	if _, exists := s.store.Get(key); exists {
-		return respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	// Check for type conflict with other types
+	if err := s.keyspace.CheckType(key, store.TypeSet); err != nil {
+		return respError(err.Error())
 	}
 
 	members := s.setStore.SMembers(key)
@@ -93,7 +93,7 @@ func (s *Server) handleSMembers(args []resp.Value) resp.Value {
 		array[i] = respBulkString(m)
 	}
 
-	return resp.Value{Type: resp.TypeArray, Array: array}
+	return resp.Value{Type: resp.TypeSet, Array: array}
 }
 
 // handleSIsMember handles the SISMEMBER command.
@@ -107,9 +107,9 @@ func (s *Server) handleSIsMember(args []resp.Value) resp.Value {
 	key := args[0].Str
 	member := args[1].Str
 
-	// Check for type conflict with string store
-	if _, exists := s.store.Get(key); exists {
-		return respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	// Check for type conflict with other types
+	if err := s.keyspace.CheckType(key, store.TypeSet); err != nil {
+		return respError(err.Error())
 	}
 
 	if s.setStore.SIsMember(key, member) {
@@ -128,9 +128,9 @@ func (s *Server) handleSCard(args []resp.Value) resp.Value {
 
 	key := args[0].Str
 
-	// Check for type conflict with string store
-	if _, exists := s.store.Get(key); exists {
-		return respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	// Check for type conflict with other types
+	if err := s.keyspace.CheckType(key, store.TypeSet); err != nil {
+		return respError(err.Error())
 	}
 
 	return respInteger(s.setStore.SCard(key))
@@ -147,9 +147,9 @@ func (s *Server) handleSInter(args []resp.Value) resp.Value {
 	keys := make([]string, len(args))
 	for i, arg := range args {
 		key := arg.Str
-		// Check for type conflict with string store
-		if _, exists := s.store.Get(key); exists {
-			return respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		// Check for type conflict with other types
+		if err := s.keyspace.CheckType(key, store.TypeSet); err != nil {
+			return respError(err.Error())
 		}
 		keys[i] = key
 	}
@@ -160,5 +160,5 @@ func (s *Server) handleSInter(args []resp.Value) resp.Value {
 		array[i] = respBulkString(m)
 	}
 
-	return resp.Value{Type: resp.TypeArray, Array: array}
+	return resp.Value{Type: resp.TypeSet, Array: array}
 }
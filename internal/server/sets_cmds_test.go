@@ -16,9 +16,9 @@ func createTestServer(t *testing.T) *Server {
 	hashStore := store.NewHashStore()
 	setStore := store.NewSetStore()
 	cfg := Config{Port: 0}
-	srv := New(st, listStore, hashStore, setStore, nil, nil, cfg)
+	srv := New(st, listStore, hashStore, setStore, store.NewZSetStore(), store.NewStreamStore(), nil, nil, cfg)
 	t.Cleanup(func() {
-		st.Close()
+		srv.keyspace.Close()
 	})
 	return srv
 }
@@ -150,8 +150,8 @@ func TestHandleSMembers(t *testing.T) {
 
 	// Empty set
 	result := srv.handleSMembers(makeSetArgs("nonexistent"))
-	if result.Type != resp.TypeArray {
-		t.Errorf("Type = %c, want array", result.Type)
+	if result.Type != resp.TypeSet {
+		t.Errorf("Type = %c, want set", result.Type)
 	}
 	if len(result.Array) != 0 {
 		t.Errorf("Empty set returned %d members, want 0", len(result.Array))
@@ -161,8 +161,8 @@ func TestHandleSMembers(t *testing.T) {
 	srv.setStore.SAdd("myset", "c", "a", "b")
 	result = srv.handleSMembers(makeSetArgs("myset"))
 
-	if result.Type != resp.TypeArray {
-		t.Errorf("Type = %c, want array", result.Type)
+	if result.Type != resp.TypeSet {
+		t.Errorf("Type = %c, want set", result.Type)
 	}
 	if len(result.Array) != 3 {
 		t.Errorf("Got %d members, want 3", len(result.Array))
@@ -330,8 +330,8 @@ func TestHandleSInter(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			result := srv.handleSInter(makeSetArgs(tt.keys...))
 
-			if result.Type != resp.TypeArray {
-				t.Errorf("Type = %c, want array", result.Type)
+			if result.Type != resp.TypeSet {
+				t.Errorf("Type = %c, want set", result.Type)
 				return
 			}
 
@@ -0,0 +1,28 @@
+// Package server contains the statistics the server keeps about its activity.
+package server
+
+import "sync/atomic"
+
+// serverStats counts connections and commands since startup or the last
+// CONFIG RESETSTAT.
+type serverStats struct {
+	connectionsReceived atomic.Int64
+	commandsProcessed   atomic.Int64
+
+	// expiredBase is the keyspace's expired key count at the last reset;
+	// the keyspace keeps its own total, which can't be reset.
+	expiredBase atomic.Int64
+}
+
+// reset zeroes the counters. expired is the keyspace's current expired key count.
+func (st *serverStats) reset(expired int64) {
+	st.connectionsReceived.Store(0)
+	st.commandsProcessed.Store(0)
+	st.expiredBase.Store(expired)
+}
+
+// expiredKeys returns how many keys expired since the last reset, given the
+// keyspace's current expired key count.
+func (st *serverStats) expiredKeys(expired int64) int64 {
+	return expired - st.expiredBase.Load()
+}
@@ -0,0 +1,1142 @@
+// Package server provides stream command handlers for the Redis server.
+package server
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// errInvalidStreamID is the reply for an ID that can't be parsed.
+const errInvalidStreamID = "ERR Invalid stream ID specified as stream command argument"
+
+// StreamCommands handles Redis stream commands.
+type StreamCommands struct {
+	streamStore store.StreamStore
+	keyspace    *store.Keyspace // For type checking against keys of other types
+	// blocking is told about added entries so it can wake blocked readers.
+	// It is nil when the handler is used without a server.
+	blocking *blockingManager
+}
+
+// NewStreamCommands creates a new StreamCommands handler operating on the keyspace's stream store.
+func NewStreamCommands(keyspace *store.Keyspace) *StreamCommands {
+	return &StreamCommands{
+		streamStore: keyspace.Streams(),
+		keyspace:    keyspace,
+	}
+}
+
+// checkKeyType returns an error response if the key holds a type other than stream.
+func (x *StreamCommands) checkKeyType(key string) *resp.Value {
+	if err := x.keyspace.CheckType(key, store.TypeStream); err != nil {
+		errResp := respError(err.Error())
+		return &errResp
+	}
+	return nil
+}
+
+// HandleXAdd handles the XADD command.
+// XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]] * | id field value [field value ...]
+// Returns the ID of the added entry, or nil if NOMKSTREAM is set and the stream doesn't exist.
+func (x *StreamCommands) HandleXAdd(args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return respError("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	key := args[0].Str
+	var xargs store.XAddArgs
+
+	i := 1
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		if opt == "NOMKSTREAM" {
+			xargs.NoMkStream = true
+			continue
+		}
+		if opt != "MAXLEN" && opt != "MINID" {
+			break
+		}
+		trim, next, err := parseStreamTrim(args, i)
+		if err != nil {
+			return *err
+		}
+		xargs.Trim = trim
+		i = next - 1
+	}
+
+	if i >= len(args) {
+		return respError("ERR syntax error")
+	}
+	fields := argStrings(args[i+1:])
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return respError("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	idArg := args[i].Str
+	switch {
+	case idArg == "*":
+		xargs.AutoID = true
+	case strings.HasSuffix(idArg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return respError(errInvalidStreamID)
+		}
+		xargs.ID.Ms = ms
+		xargs.AutoSeq = true
+	default:
+		id, ok := parseStreamID(idArg, 0)
+		if !ok {
+			return respError(errInvalidStreamID)
+		}
+		xargs.ID = id
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	id, added, err := x.streamStore.XAdd(key, xargs, fields)
+	if err != nil {
+		return respError(err.Error())
+	}
+	if !added {
+		return respNullBulkString()
+	}
+	x.signalReady(key)
+	return respBulkString(id.String())
+}
+
+// signalReady tells blocked readers that key has new entries.
+func (x *StreamCommands) signalReady(key string) {
+	if x.blocking != nil {
+		x.blocking.signalReady(key)
+	}
+}
+
+// HandleXLen handles the XLEN command.
+// XLEN key
+// Returns the number of entries in the stream.
+func (x *StreamCommands) HandleXLen(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return respError("ERR wrong number of arguments for 'xlen' command")
+	}
+
+	key := args[0].Str
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(x.streamStore.XLen(key))
+}
+
+// HandleXRange handles the XRANGE and XREVRANGE commands.
+// XRANGE key start end [COUNT count]
+// XREVRANGE key end start [COUNT count]
+// Returns the entries within the range.
+func (x *StreamCommands) HandleXRange(cmd string, args []resp.Value) resp.Value {
+	if len(args) != 3 && len(args) != 5 {
+		if len(args) > 3 {
+			return respError("ERR syntax error")
+		}
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	}
+
+	key := args[0].Str
+	reverse := cmd == "XREVRANGE"
+	startArg, endArg := args[1].Str, args[2].Str
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+
+	start, ok := parseRangeStart(startArg)
+	if !ok {
+		return respError(errInvalidStreamID)
+	}
+	end, ok := parseRangeEnd(endArg)
+	if !ok {
+		return respError(errInvalidStreamID)
+	}
+
+	count := -1
+	if len(args) == 5 {
+		if strings.ToUpper(args[3].Str) != "COUNT" {
+			return respError("ERR syntax error")
+		}
+		n, err := strconv.Atoi(args[4].Str)
+		if err != nil {
+			return respError("ERR value is not an integer or out of range")
+		}
+		count = max(n, 0)
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+	if count == 0 {
+		return streamEntriesReply(nil)
+	}
+	return streamEntriesReply(x.streamStore.XRange(key, start, end, count, reverse))
+}
+
+// HandleXDel handles the XDEL command.
+// XDEL key id [id ...]
+// Returns the number of entries deleted.
+func (x *StreamCommands) HandleXDel(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return respError("ERR wrong number of arguments for 'xdel' command")
+	}
+
+	key := args[0].Str
+	ids, err := parseStreamIDs(args[1:])
+	if err != nil {
+		return *err
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(x.streamStore.XDel(key, ids...))
+}
+
+// HandleXTrim handles the XTRIM command.
+// XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count]
+// Returns the number of entries evicted.
+func (x *StreamCommands) HandleXTrim(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return respError("ERR wrong number of arguments for 'xtrim' command")
+	}
+
+	key := args[0].Str
+	if strategy := strings.ToUpper(args[1].Str); strategy != "MAXLEN" && strategy != "MINID" {
+		return respError("ERR syntax error")
+	}
+	trim, next, err := parseStreamTrim(args, 1)
+	if err != nil {
+		return *err
+	}
+	if next != len(args) {
+		return respError("ERR syntax error")
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(int(x.streamStore.XTrim(key, trim)))
+}
+
+// HandleXRead handles the XREAD command.
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// Returns the entries after each ID as [key, entries] pairs, or nil if there are none.
+// BLOCK is ignored here, as inside MULTI; connections wait through parseBlockingRead.
+func (x *StreamCommands) HandleXRead(args []resp.Value) resp.Value {
+	opts, err := parseStreamReadArgs("xread", args, false)
+	if err != nil {
+		return *err
+	}
+
+	for _, key := range opts.keys {
+		if err := x.checkKeyType(key); err != nil {
+			return *err
+		}
+	}
+
+	results := make([]resp.Value, 0, len(opts.keys))
+	for i, key := range opts.keys {
+		var after store.StreamID
+		if opts.ids[i] == "$" {
+			after = x.streamStore.XLastID(key)
+		} else {
+			id, ok := parseStreamID(opts.ids[i], 0)
+			if !ok {
+				return respError(errInvalidStreamID)
+			}
+			after = id
+		}
+
+		start, ok := after.Next()
+		if !ok {
+			continue
+		}
+		entries := x.streamStore.XRange(key, start, store.MaxStreamID, opts.count, false)
+		if len(entries) > 0 {
+			results = append(results, streamKeyReply(key, entries))
+		}
+	}
+
+	if len(results) == 0 {
+		return resp.Value{Type: resp.TypeArray, Null: true}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: results}
+}
+
+// HandleXGroup handles the XGROUP command and its subcommands.
+// XGROUP CREATE key group id | $ [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group id | $ [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func (x *StreamCommands) HandleXGroup(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return respError("ERR wrong number of arguments for 'xgroup' command")
+	}
+
+	sub := strings.ToUpper(args[0].Str)
+	switch sub {
+	case "CREATE", "SETID":
+		if len(args) < 4 {
+			return respError(fmt.Sprintf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub)))
+		}
+	case "DESTROY":
+		if len(args) != 3 {
+			return respError("ERR wrong number of arguments for 'xgroup|destroy' command")
+		}
+	case "CREATECONSUMER", "DELCONSUMER":
+		if len(args) != 4 {
+			return respError(fmt.Sprintf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub)))
+		}
+	default:
+		return respError(fmt.Sprintf("ERR unknown subcommand '%s'. Try XGROUP HELP.", args[0].Str))
+	}
+
+	key, group := args[1].Str, args[2].Str
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+	if sub != "CREATE" && !x.keyspace.Exists(key) {
+		return respError(store.ErrStreamKeyRequired.Error())
+	}
+
+	switch sub {
+	case "CREATE", "SETID":
+		return x.xgroupStart(sub, key, group, args[3:])
+	case "DESTROY":
+		destroyed, err := x.streamStore.XGroupDestroy(key, group)
+		if err != nil {
+			return respError(err.Error())
+		}
+		if destroyed {
+			return respInteger(1)
+		}
+		return respInteger(0)
+	case "CREATECONSUMER":
+		created, err := x.streamStore.XGroupCreateConsumer(key, group, args[3].Str)
+		if err != nil {
+			return noConsumerGroupError(key, group)
+		}
+		if created {
+			return respInteger(1)
+		}
+		return respInteger(0)
+	default: // DELCONSUMER
+		pending, err := x.streamStore.XGroupDelConsumer(key, group, args[3].Str)
+		if err != nil {
+			return noConsumerGroupError(key, group)
+		}
+		return respInteger(pending)
+	}
+}
+
+// xgroupStart handles XGROUP CREATE and XGROUP SETID, given the arguments after the group name.
+func (x *StreamCommands) xgroupStart(sub, key, group string, args []resp.Value) resp.Value {
+	start := store.StreamGroupStart{EntriesRead: -1}
+	if args[0].Str == "$" {
+		start.LastEntry = true
+	} else {
+		id, ok := parseStreamID(args[0].Str, 0)
+		if !ok {
+			return respError(errInvalidStreamID)
+		}
+		start.ID = id
+	}
+
+	mkStream := false
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].Str); {
+		case opt == "MKSTREAM" && sub == "CREATE":
+			mkStream = true
+		case opt == "ENTRIESREAD" && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1].Str, 10, 64)
+			if err != nil || n < -1 {
+				return respError("ERR value for ENTRIESREAD must be positive or -1")
+			}
+			start.EntriesRead = n
+			i++
+		default:
+			return respError("ERR syntax error")
+		}
+	}
+
+	if sub == "SETID" {
+		if err := x.streamStore.XGroupSetID(key, group, start); err != nil {
+			return noConsumerGroupError(key, group)
+		}
+		return respSimpleString("OK")
+	}
+	if err := x.streamStore.XGroupCreate(key, group, start, mkStream); err != nil {
+		return respError(err.Error())
+	}
+	return respSimpleString("OK")
+}
+
+// HandleXReadGroup handles the XREADGROUP command.
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// With ID ">" returns entries never delivered to the group; otherwise returns the
+// consumer's pending entries after the ID. BLOCK is ignored here, as inside
+// MULTI; connections wait through parseBlockingRead.
+func (x *StreamCommands) HandleXReadGroup(args []resp.Value) resp.Value {
+	if len(args) < 6 || strings.ToUpper(args[0].Str) != "GROUP" {
+		if len(args) >= 6 {
+			return respError("ERR syntax error")
+		}
+		return respError("ERR wrong number of arguments for 'xreadgroup' command")
+	}
+
+	group, consumer := args[1].Str, args[2].Str
+	opts, err := parseStreamReadArgs("xreadgroup", args[3:], true)
+	if err != nil {
+		return *err
+	}
+
+	type read struct {
+		after   store.StreamID
+		newOnly bool
+	}
+	reads := make([]read, len(opts.keys))
+	for i, key := range opts.keys {
+		if err := x.checkKeyType(key); err != nil {
+			return *err
+		}
+		if opts.ids[i] == ">" {
+			reads[i].newOnly = true
+		} else {
+			id, ok := parseStreamID(opts.ids[i], 0)
+			if !ok {
+				return respError(errInvalidStreamID)
+			}
+			reads[i].after = id
+		}
+		if !x.streamStore.HasGroup(key, group) {
+			return respError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group))
+		}
+	}
+
+	results := make([]resp.Value, 0, len(opts.keys))
+	for i, key := range opts.keys {
+		entries, err := x.streamStore.XReadGroup(key, group, consumer, reads[i].after, reads[i].newOnly, opts.count, opts.noAck)
+		if err != nil {
+			return respError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group))
+		}
+		// New entries are only reported for streams that have some; history always is
+		if len(entries) > 0 || !reads[i].newOnly {
+			results = append(results, streamKeyReply(key, entries))
+		}
+	}
+
+	if len(results) == 0 {
+		return resp.Value{Type: resp.TypeArray, Null: true}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: results}
+}
+
+// HandleXAck handles the XACK command.
+// XACK key group id [id ...]
+// Returns the number of entries acknowledged.
+func (x *StreamCommands) HandleXAck(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return respError("ERR wrong number of arguments for 'xack' command")
+	}
+
+	key, group := args[0].Str, args[1].Str
+	ids, err := parseStreamIDs(args[2:])
+	if err != nil {
+		return *err
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(x.streamStore.XAck(key, group, ids...))
+}
+
+// HandleXPending handles the XPENDING command.
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+// Without a range returns a summary: the number of pending entries, the smallest
+// and greatest pending IDs, and the number pending per consumer. With a range
+// returns [id, consumer, idle milliseconds, delivery count] for each entry.
+func (x *StreamCommands) HandleXPending(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return respError("ERR wrong number of arguments for 'xpending' command")
+	}
+
+	key, group := args[0].Str, args[1].Str
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	if len(args) == 2 {
+		summary, err := x.streamStore.XPendingSummary(key, group)
+		if err != nil {
+			return noGroupError(key, group)
+		}
+		return pendingSummaryReply(summary)
+	}
+
+	rest := args[2:]
+	var minIdle time.Duration
+	if strings.ToUpper(rest[0].Str) == "IDLE" {
+		if len(rest) < 2 {
+			return respError("ERR syntax error")
+		}
+		ms, err := strconv.ParseInt(rest[1].Str, 10, 64)
+		if err != nil {
+			return respError("ERR value is not an integer or out of range")
+		}
+		minIdle = time.Duration(ms) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return respError("ERR syntax error")
+	}
+
+	start, ok := parseRangeStart(rest[0].Str)
+	if !ok {
+		return respError(errInvalidStreamID)
+	}
+	end, ok := parseRangeEnd(rest[1].Str)
+	if !ok {
+		return respError(errInvalidStreamID)
+	}
+	count, err := strconv.Atoi(rest[2].Str)
+	if err != nil {
+		return respError("ERR value is not an integer or out of range")
+	}
+	count = max(count, 0)
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = rest[3].Str
+	}
+
+	pending, perr := x.streamStore.XPending(key, group, start, end, count, consumer, minIdle)
+	if perr != nil {
+		return noGroupError(key, group)
+	}
+
+	array := make([]resp.Value, len(pending))
+	for i, p := range pending {
+		array[i] = resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+			respBulkString(p.ID.String()),
+			respBulkString(p.Consumer),
+			respInteger(int(p.Idle.Milliseconds())),
+			respInteger(int(p.DeliveryCount)),
+		}}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
+
+// HandleXClaim handles the XCLAIM command.
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+// Returns the claimed entries, or only their IDs with JUSTID.
+func (x *StreamCommands) HandleXClaim(args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		return respError("ERR wrong number of arguments for 'xclaim' command")
+	}
+
+	key, group, consumer := args[0].Str, args[1].Str, args[2].Str
+	minIdle, ok := parseMinIdle(args[3].Str)
+	if !ok {
+		return respError("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	xargs := store.XClaimArgs{MinIdle: minIdle}
+
+	var ids []store.StreamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, ok := parseStreamID(args[i].Str, 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return respError(errInvalidStreamID)
+	}
+
+	now := time.Now()
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		switch opt {
+		case "FORCE":
+			xargs.Force = true
+			continue
+		case "JUSTID":
+			xargs.JustID = true
+			continue
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+		default:
+			return respError(fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", args[i].Str))
+		}
+
+		if i+1 >= len(args) {
+			return respError("ERR syntax error")
+		}
+		i++
+		if opt == "LASTID" {
+			id, ok := parseStreamID(args[i].Str, 0)
+			if !ok {
+				return respError(errInvalidStreamID)
+			}
+			xargs.LastID = id
+			continue
+		}
+
+		n, err := strconv.ParseInt(args[i].Str, 10, 64)
+		if err != nil {
+			return respError(fmt.Sprintf("ERR Invalid %s option argument for XCLAIM", opt))
+		}
+		switch opt {
+		case "IDLE":
+			xargs.DeliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+		case "TIME":
+			xargs.DeliveryTime = time.UnixMilli(n)
+		case "RETRYCOUNT":
+			xargs.RetryCount = n
+			xargs.HasRetryCount = true
+		}
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	claimed, err := x.streamStore.XClaim(key, group, consumer, xargs, ids...)
+	if err != nil {
+		return noGroupError(key, group)
+	}
+	if xargs.JustID {
+		return streamIDsReply(entryIDs(claimed))
+	}
+	return streamEntriesReply(claimed)
+}
+
+// HandleXAutoClaim handles the XAUTOCLAIM command.
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+// Returns the ID to continue from, the claimed entries (or IDs with JUSTID), and
+// the IDs of pending entries that no longer exist in the stream.
+func (x *StreamCommands) HandleXAutoClaim(args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		return respError("ERR wrong number of arguments for 'xautoclaim' command")
+	}
+
+	key, group, consumer := args[0].Str, args[1].Str, args[2].Str
+	minIdle, ok := parseMinIdle(args[3].Str)
+	if !ok {
+		return respError("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	start, ok := parseRangeStart(args[4].Str)
+	if !ok {
+		return respError(errInvalidStreamID)
+	}
+
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "JUSTID":
+			justID = true
+		case "COUNT":
+			if i+1 >= len(args) {
+				return respError("ERR syntax error")
+			}
+			n, err := strconv.Atoi(args[i+1].Str)
+			if err != nil {
+				return respError("ERR value is not an integer or out of range")
+			}
+			if n < 1 || n > math.MaxInt32/10 {
+				return respError("ERR COUNT must be > 0")
+			}
+			count = n
+			i++
+		default:
+			return respError("ERR syntax error")
+		}
+	}
+
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	next, claimed, deleted, err := x.streamStore.XAutoClaim(key, group, consumer, minIdle, start, count, justID)
+	if err != nil {
+		return noGroupError(key, group)
+	}
+
+	claimedReply := streamEntriesReply(claimed)
+	if justID {
+		claimedReply = streamIDsReply(entryIDs(claimed))
+	}
+	return resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+		respBulkString(next.String()),
+		claimedReply,
+		streamIDsReply(deleted),
+	}}
+}
+
+// HandleXInfo handles the XINFO command and its subcommands.
+// XINFO STREAM key
+// XINFO GROUPS key
+// XINFO CONSUMERS key group
+// Replies are flat arrays of alternating field names and values.
+func (x *StreamCommands) HandleXInfo(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return respError("ERR wrong number of arguments for 'xinfo' command")
+	}
+
+	sub := strings.ToUpper(args[0].Str)
+	switch sub {
+	case "STREAM", "GROUPS":
+		if len(args) != 2 {
+			if sub == "STREAM" && len(args) > 2 {
+				return respError("ERR syntax error")
+			}
+			return respError(fmt.Sprintf("ERR wrong number of arguments for 'xinfo|%s' command", strings.ToLower(sub)))
+		}
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return respError("ERR wrong number of arguments for 'xinfo|consumers' command")
+		}
+	default:
+		return respError(fmt.Sprintf("ERR unknown subcommand '%s'. Try XINFO HELP.", args[0].Str))
+	}
+
+	key := args[1].Str
+	if err := x.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	switch sub {
+	case "STREAM":
+		info, exists := x.streamStore.XInfoStream(key)
+		if !exists {
+			return respError("ERR no such key")
+		}
+		return streamInfoReply(info)
+	case "GROUPS":
+		groups, exists := x.streamStore.XInfoGroups(key)
+		if !exists {
+			return respError("ERR no such key")
+		}
+		array := make([]resp.Value, len(groups))
+		for i, g := range groups {
+			array[i] = fieldsReply([]infoField{
+				{"name", respBulkString(g.Name)},
+				{"consumers", respInteger(g.Consumers)},
+				{"pending", respInteger(g.Pending)},
+				{"last-delivered-id", respBulkString(g.LastID.String())},
+				{"entries-read", optionalInteger(g.EntriesRead)},
+				{"lag", optionalInteger(g.Lag)},
+			})
+		}
+		return resp.Value{Type: resp.TypeArray, Array: array}
+	default: // CONSUMERS
+		group := args[2].Str
+		consumers, err := x.streamStore.XInfoConsumers(key, group)
+		if err != nil {
+			return noConsumerGroupError(key, group)
+		}
+		array := make([]resp.Value, len(consumers))
+		for i, c := range consumers {
+			inactive := int64(-1)
+			if c.Inactive >= 0 {
+				inactive = c.Inactive.Milliseconds()
+			}
+			array[i] = fieldsReply([]infoField{
+				{"name", respBulkString(c.Name)},
+				{"pending", respInteger(c.Pending)},
+				{"idle", respInteger(int(c.Idle.Milliseconds()))},
+				{"inactive", respInteger(int(inactive))},
+			})
+		}
+		return resp.Value{Type: resp.TypeArray, Array: array}
+	}
+}
+
+// streamReadArgs holds the parsed arguments of XREAD and XREADGROUP.
+type streamReadArgs struct {
+	count int
+	block int // BLOCK milliseconds; -1 without BLOCK
+	noAck bool
+	keys  []string
+	ids   []string
+}
+
+// parseStreamReadArgs parses [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...].
+// NOACK and the ">" ID are only accepted for XREADGROUP.
+func parseStreamReadArgs(cmd string, args []resp.Value, group bool) (streamReadArgs, *resp.Value) {
+	opts := streamReadArgs{count: -1, block: -1}
+	fail := func(msg string) (streamReadArgs, *resp.Value) {
+		errResp := respError(msg)
+		return streamReadArgs{}, &errResp
+	}
+
+	i := 0
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		if opt == "STREAMS" {
+			break
+		}
+		switch {
+		case opt == "NOACK" && group:
+			opts.noAck = true
+		case (opt == "COUNT" || opt == "BLOCK") && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1].Str)
+			if err != nil {
+				if opt == "BLOCK" {
+					return fail("ERR timeout is not an integer or out of range")
+				}
+				return fail("ERR value is not an integer or out of range")
+			}
+			if opt == "BLOCK" && n < 0 {
+				return fail("ERR timeout is negative")
+			}
+			if opt == "COUNT" && n > 0 {
+				opts.count = n
+			}
+			if opt == "BLOCK" {
+				opts.block = n
+			}
+			i++
+		default:
+			return fail("ERR syntax error")
+		}
+	}
+
+	streams := args[min(i+1, len(args)):]
+	if i == len(args) || len(streams) == 0 {
+		return fail(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd))
+	}
+	if len(streams)%2 != 0 {
+		idHint := "'$'"
+		if group {
+			idHint = "'>'"
+		}
+		return fail(fmt.Sprintf("ERR Unbalanced '%s' list of streams: for each stream key an ID or %s must be specified.", cmd, idHint))
+	}
+
+	half := len(streams) / 2
+	opts.keys = argStrings(streams[:half])
+	opts.ids = argStrings(streams[half:])
+	for _, id := range opts.ids {
+		if id == ">" && !group {
+			return fail("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		}
+		if id == "$" && group {
+			return fail("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		}
+	}
+	return opts, nil
+}
+
+// parseBlockingRead parses XREAD or XREADGROUP for a connection. With BLOCK,
+// the command is served once XADD adds entries it returns, as BLPOP is once a
+// list is pushed to; XREADGROUP reading pending entries never waits. XREAD's
+// "$" is resolved now, so only entries added from now on are waited for.
+func (x *StreamCommands) parseBlockingRead(cmd string, args []resp.Value) (*blockingCommand, *resp.Value) {
+	read, optArgs := x.HandleXRead, args
+	if cmd == "XREADGROUP" {
+		read = x.HandleXReadGroup
+		if len(args) < 6 || strings.ToUpper(args[0].Str) != "GROUP" {
+			errResp := read(args)
+			return nil, &errResp
+		}
+		optArgs = args[3:]
+	}
+	opts, errResp := parseStreamReadArgs(strings.ToLower(cmd), optArgs, cmd == "XREADGROUP")
+	if errResp != nil {
+		return nil, errResp
+	}
+
+	if slices.Contains(opts.ids, "$") {
+		args = slices.Clone(args)
+		ids := args[len(args)-len(opts.ids):]
+		for i, id := range opts.ids {
+			if id == "$" {
+				ids[i] = respBulkString(x.streamStore.XLastID(opts.keys[i]).String())
+			}
+		}
+	}
+	return &blockingCommand{
+		keyType: store.TypeStream,
+		keys:    opts.keys,
+		timeout: time.Duration(opts.block) * time.Millisecond,
+		serve: func(string) (resp.Value, bool) {
+			reply := read(args)
+			// Without BLOCK, nothing to read is replied to right away
+			return reply, !reply.Null || opts.block < 0
+		},
+		timeoutReply: resp.Value{Type: resp.TypeArray, Null: true},
+	}, nil
+}
+
+// parseStreamTrim parses MAXLEN | MINID [= | ~] threshold [LIMIT count] starting at args[i].
+// As in Redis, a "~" trim evicts whole nodes of store.StreamNodeEntries entries,
+// at most 100 nodes' worth unless LIMIT says otherwise.
+// Returns the trim and the index of the first argument after it.
+func parseStreamTrim(args []resp.Value, i int) (store.StreamTrim, int, *resp.Value) {
+	fail := func(msg string) (store.StreamTrim, int, *resp.Value) {
+		errResp := respError(msg)
+		return store.StreamTrim{}, 0, &errResp
+	}
+
+	var trim store.StreamTrim
+	if strings.ToUpper(args[i].Str) == "MAXLEN" {
+		trim.Strategy = store.TrimMaxLen
+	} else {
+		trim.Strategy = store.TrimMinID
+	}
+	i++
+
+	if i < len(args) && (args[i].Str == "~" || args[i].Str == "=") {
+		trim.Approx = args[i].Str == "~"
+		i++
+	}
+	if i >= len(args) {
+		return fail("ERR syntax error")
+	}
+
+	if trim.Strategy == store.TrimMaxLen {
+		n, err := strconv.ParseInt(args[i].Str, 10, 64)
+		if err != nil {
+			return fail("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			return fail("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.MaxLen = n
+	} else {
+		id, ok := parseStreamID(args[i].Str, 0)
+		if !ok {
+			return fail(errInvalidStreamID)
+		}
+		trim.MinID = id
+	}
+	i++
+
+	if i < len(args) && strings.ToUpper(args[i].Str) == "LIMIT" {
+		if i+1 >= len(args) {
+			return fail("ERR syntax error")
+		}
+		n, err := strconv.ParseInt(args[i+1].Str, 10, 64)
+		if err != nil || n < 0 {
+			return fail("ERR The LIMIT argument must be >= 0.")
+		}
+		if !trim.Approx {
+			return fail("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		trim.Limit = n
+		i += 2
+	} else if trim.Approx {
+		trim.Limit = 100 * store.StreamNodeEntries
+	}
+	return trim, i, nil
+}
+
+// parseStreamID parses "<ms>-<seq>" or "<ms>", in which case the sequence is missingSeq.
+func parseStreamID(s string, missingSeq uint64) (store.StreamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return store.StreamID{}, false
+	}
+	if !hasSeq {
+		return store.StreamID{Ms: ms, Seq: missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return store.StreamID{}, false
+	}
+	return store.StreamID{Ms: ms, Seq: seq}, true
+}
+
+// parseStreamIDs parses a list of complete or millisecond-only IDs.
+func parseStreamIDs(args []resp.Value) ([]store.StreamID, *resp.Value) {
+	ids := make([]store.StreamID, len(args))
+	for i, arg := range args {
+		id, ok := parseStreamID(arg.Str, 0)
+		if !ok {
+			errResp := respError(errInvalidStreamID)
+			return nil, &errResp
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseRangeStart parses the start of an ID range: "-", an ID, or "(" and an exclusive ID.
+func parseRangeStart(s string) (store.StreamID, bool) {
+	if s == "-" {
+		return store.StreamID{}, true
+	}
+	if exclusive, ok := strings.CutPrefix(s, "("); ok {
+		id, ok := parseStreamID(exclusive, 0)
+		if !ok {
+			return id, false
+		}
+		return id.Next()
+	}
+	return parseStreamID(s, 0)
+}
+
+// parseRangeEnd parses the end of an ID range: "+", an ID, or "(" and an exclusive ID.
+func parseRangeEnd(s string) (store.StreamID, bool) {
+	if s == "+" {
+		return store.MaxStreamID, true
+	}
+	if exclusive, ok := strings.CutPrefix(s, "("); ok {
+		id, ok := parseStreamID(exclusive, math.MaxUint64)
+		if !ok {
+			return id, false
+		}
+		return id.Prev()
+	}
+	return parseStreamID(s, math.MaxUint64)
+}
+
+// parseMinIdle parses a min-idle-time in milliseconds.
+func parseMinIdle(s string) (time.Duration, bool) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(max(ms, 0)) * time.Millisecond, true
+}
+
+// noGroupError is the reply when a stream or one of its groups doesn't exist.
+func noGroupError(key, group string) resp.Value {
+	return respError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+}
+
+// noConsumerGroupError is the reply of XGROUP and XINFO when an existing stream lacks the group.
+func noConsumerGroupError(key, group string) resp.Value {
+	return respError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+}
+
+// streamEntryReply formats an entry as [id, [field, value, ...]].
+// The fields of an entry deleted from the stream are nil.
+func streamEntryReply(entry store.StreamEntry) resp.Value {
+	fields := resp.Value{Type: resp.TypeArray, Null: true}
+	if entry.Fields != nil {
+		fields = resp.Value{Type: resp.TypeArray, Array: make([]resp.Value, len(entry.Fields))}
+		for i, f := range entry.Fields {
+			fields.Array[i] = respBulkString(f)
+		}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: []resp.Value{respBulkString(entry.ID.String()), fields}}
+}
+
+// streamEntriesReply formats a list of entries.
+func streamEntriesReply(entries []store.StreamEntry) resp.Value {
+	array := make([]resp.Value, len(entries))
+	for i, entry := range entries {
+		array[i] = streamEntryReply(entry)
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
+
+// streamKeyReply formats the entries read from one stream as [key, entries].
+func streamKeyReply(key string, entries []store.StreamEntry) resp.Value {
+	return resp.Value{Type: resp.TypeArray, Array: []resp.Value{respBulkString(key), streamEntriesReply(entries)}}
+}
+
+// streamIDsReply formats a list of IDs.
+func streamIDsReply(ids []store.StreamID) resp.Value {
+	array := make([]resp.Value, len(ids))
+	for i, id := range ids {
+		array[i] = respBulkString(id.String())
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
+
+// entryIDs returns the IDs of entries.
+func entryIDs(entries []store.StreamEntry) []store.StreamID {
+	ids := make([]store.StreamID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+// pendingSummaryReply formats the summary form of XPENDING.
+func pendingSummaryReply(summary store.StreamPendingSummary) resp.Value {
+	if summary.Count == 0 {
+		return resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+			respInteger(0),
+			respNullBulkString(),
+			respNullBulkString(),
+			{Type: resp.TypeArray, Null: true},
+		}}
+	}
+
+	consumers := make([]resp.Value, len(summary.Consumers))
+	for i, c := range summary.Consumers {
+		consumers[i] = resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+			respBulkString(c.Name),
+			respBulkString(strconv.Itoa(c.Pending)),
+		}}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+		respInteger(summary.Count),
+		respBulkString(summary.First.String()),
+		respBulkString(summary.Last.String()),
+		{Type: resp.TypeArray, Array: consumers},
+	}}
+}
+
+// streamInfoReply formats XINFO STREAM.
+func streamInfoReply(info store.StreamInfo) resp.Value {
+	first := resp.Value{Type: resp.TypeArray, Null: true}
+	last := first
+	if info.First != nil {
+		first = streamEntryReply(*info.First)
+		last = streamEntryReply(*info.Last)
+	}
+	return fieldsReply([]infoField{
+		{"length", respInteger(info.Length)},
+		{"last-generated-id", respBulkString(info.LastID.String())},
+		{"max-deleted-entry-id", respBulkString(info.MaxDeletedID.String())},
+		{"entries-added", respInteger(int(info.EntriesAdded))},
+		{"recorded-first-entry-id", respBulkString(info.FirstID.String())},
+		{"groups", respInteger(info.Groups)},
+		{"first-entry", first},
+		{"last-entry", last},
+	})
+}
+
+// infoField is a named value of an XINFO reply.
+type infoField struct {
+	name  string
+	value resp.Value
+}
+
+// fieldsReply builds a flat array of alternating field names and values.
+func fieldsReply(fields []infoField) resp.Value {
+	array := make([]resp.Value, 0, 2*len(fields))
+	for _, f := range fields {
+		array = append(array, respBulkString(f.name), f.value)
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
+
+// optionalInteger formats n, or nil if it is negative (unknown).
+func optionalInteger(n int64) resp.Value {
+	if n < 0 {
+		return respNullBulkString()
+	}
+	return respInteger(int(n))
+}
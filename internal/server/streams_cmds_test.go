@@ -0,0 +1,458 @@
+package server
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// replyIDs returns the IDs of an array of [id, fields] stream entries.
+func replyIDs(v resp.Value) []string {
+	ids := make([]string, len(v.Array))
+	for i, entry := range v.Array {
+		ids[i] = entry.Array[0].Str
+	}
+	return ids
+}
+
+func TestHandleXAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want resp.Value
+	}{
+		{"explicit", []string{"5-3", "f", "v"}, respBulkString("5-3")},
+		{"ms only", []string{"6", "f", "v"}, respBulkString("6-0")},
+		{"auto sequence", []string{"5-*", "f", "v"}, respBulkString("5-2")},
+		{"nomkstream existing", []string{"NOMKSTREAM", "7-0", "f", "v"}, respBulkString("7-0")},
+		{"with trim", []string{"MAXLEN", "~", "1", "7-0", "f", "v"}, respBulkString("7-0")},
+		{"too small", []string{"5-1", "f", "v"}, respError("ERR The ID specified in XADD is equal or smaller than the target stream top item")},
+		{"zero", []string{"0-0", "f", "v"}, respError("ERR The ID specified in XADD must be greater than 0-0")},
+		{"invalid id", []string{"abc", "f", "v"}, respError("ERR Invalid stream ID specified as stream command argument")},
+		{"odd fields", []string{"*", "f", "v", "g"}, respError("ERR wrong number of arguments for 'xadd' command")},
+		{"negative maxlen", []string{"MAXLEN", "-1", "*", "f", "v"}, respError("ERR The MAXLEN argument must be >= 0.")},
+		{"limit without ~", []string{"MAXLEN", "1", "LIMIT", "10", "*", "f", "v"}, respError("ERR syntax error, LIMIT cannot be used without the special ~ option")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := createTestServer(t)
+			runCommand(srv, "XADD", "s", "5-1", "f", "v")
+
+			got := runCommand(srv, append([]string{"XADD", "s"}, tt.args...)...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("XADD s %v = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleXAddNoMkStream(t *testing.T) {
+	srv := createTestServer(t)
+
+	if got := runCommand(srv, "XADD", "s", "NOMKSTREAM", "*", "f", "v"); !got.Null {
+		t.Errorf("XADD NOMKSTREAM on missing key = %v, want nil", got)
+	}
+	if got := runCommand(srv, "XADD", "new", "0-0", "f", "v"); got.Str != "ERR The ID specified in XADD must be greater than 0-0" {
+		t.Errorf("XADD 0-0 on new stream = %v", got)
+	}
+	if got := runCommand(srv, "EXISTS", "s", "new"); got.Num != 0 {
+		t.Errorf("EXISTS = %v, want 0", got)
+	}
+}
+
+func TestHandleXRange(t *testing.T) {
+	srv := createTestServer(t)
+	for _, id := range []string{"1-0", "1-1", "2-0", "3-0"} {
+		runCommand(srv, "XADD", "s", id, "f", id)
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"XRANGE", "s", "-", "+"}, []string{"1-0", "1-1", "2-0", "3-0"}},
+		{[]string{"XRANGE", "s", "1", "1"}, []string{"1-0", "1-1"}},
+		{[]string{"XRANGE", "s", "(1-0", "(3-0"}, []string{"1-1", "2-0"}},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "2"}, []string{"1-0", "1-1"}},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "0"}, []string{}},
+		{[]string{"XREVRANGE", "s", "+", "-", "COUNT", "3"}, []string{"3-0", "2-0", "1-1"}},
+		{[]string{"XREVRANGE", "s", "2", "1-1"}, []string{"2-0", "1-1"}},
+		{[]string{"XRANGE", "missing", "-", "+"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got := runCommand(srv, tt.args...)
+		if got.Type != resp.TypeArray {
+			t.Fatalf("%v = %v, want array", tt.args, got)
+		}
+		if ids := replyIDs(got); !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.args, ids, tt.want)
+		}
+	}
+
+	entry := runCommand(srv, "XRANGE", "s", "2", "2").Array[0]
+	if fields := bulkStrings(entry.Array[1]); !reflect.DeepEqual(fields, []string{"f", "2-0"}) {
+		t.Errorf("XRANGE fields = %v, want [f 2-0]", fields)
+	}
+
+	if got := runCommand(srv, "XRANGE", "s", "x", "+"); got.Str != "ERR Invalid stream ID specified as stream command argument" {
+		t.Errorf("XRANGE with invalid ID = %v", got)
+	}
+}
+
+func TestHandleXLenDelTrim(t *testing.T) {
+	srv := createTestServer(t)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		runCommand(srv, "XADD", "s", id, "f", "v")
+	}
+
+	tests := []struct {
+		args []string
+		want resp.Value
+	}{
+		{[]string{"XLEN", "s"}, respInteger(5)},
+		{[]string{"XDEL", "s", "2-0", "9-0"}, respInteger(1)},
+		{[]string{"XTRIM", "s", "MINID", "4"}, respInteger(2)},
+		{[]string{"XLEN", "s"}, respInteger(2)},
+		{[]string{"XTRIM", "s", "MAXLEN", "=", "0"}, respInteger(2)},
+		{[]string{"XLEN", "s"}, respInteger(0)},
+		{[]string{"TYPE", "s"}, respSimpleString("stream")},
+		{[]string{"XLEN", "missing"}, respInteger(0)},
+		{[]string{"XTRIM", "s", "MAXLEN"}, respError("ERR wrong number of arguments for 'xtrim' command")},
+		{[]string{"XTRIM", "s", "SIZE", "1"}, respError("ERR syntax error")},
+	}
+
+	for _, tt := range tests {
+		if got := runCommand(srv, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleXTrimApprox(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"MAXLEN", "~", "10"}, 200},
+		{[]string{"MAXLEN", "~", "10", "LIMIT", "0"}, 200},
+		{[]string{"MAXLEN", "~", "10", "LIMIT", "150"}, 100},
+		{[]string{"MINID", "~", "51"}, 0},
+		{[]string{"MAXLEN", "=", "10"}, 240},
+	}
+
+	for _, tt := range tests {
+		srv := createTestServer(t)
+		for i := 1; i <= 250; i++ {
+			runCommand(srv, "XADD", "s", strconv.Itoa(i), "f", "v")
+		}
+		if got := runCommand(srv, append([]string{"XTRIM", "s"}, tt.args...)...); !reflect.DeepEqual(got, respInteger(tt.want)) {
+			t.Errorf("XTRIM s %v = %v, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleXRead(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "XADD", "a", "1-0", "f", "v")
+	runCommand(srv, "XADD", "a", "2-0", "f", "v")
+	runCommand(srv, "XADD", "b", "1-0", "f", "v")
+
+	got := runCommand(srv, "XREAD", "COUNT", "1", "STREAMS", "a", "b", "0", "0")
+	if len(got.Array) != 2 {
+		t.Fatalf("XREAD = %v, want two streams", got)
+	}
+	if got.Array[0].Array[0].Str != "a" || !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"1-0"}) {
+		t.Errorf("XREAD stream a = %v, want [a [1-0]]", got.Array[0])
+	}
+
+	// Streams without new entries are left out
+	got = runCommand(srv, "XREAD", "STREAMS", "a", "b", "1", "1-0")
+	if len(got.Array) != 1 || got.Array[0].Array[0].Str != "a" || !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"2-0"}) {
+		t.Errorf("XREAD after 1-0 = %v, want only a with 2-0", got)
+	}
+
+	// BLOCK is accepted; with nothing new the reply is nil
+	if got = runCommand(srv, "XREAD", "BLOCK", "0", "STREAMS", "a", "$"); got.Type != resp.TypeArray || !got.Null {
+		t.Errorf("XREAD $ = %v, want null array", got)
+	}
+
+	errors := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"XREAD", "STREAMS", "a", "b", "0"}, "ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."},
+		{[]string{"XREAD", "STREAMS", "a", ">"}, "ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option."},
+		{[]string{"XREAD", "COUNT", "x", "STREAMS", "a", "0"}, "ERR value is not an integer or out of range"},
+		{[]string{"XREAD", "NOACK", "STREAMS", "a", "0"}, "ERR syntax error"},
+		{[]string{"XREAD", "COUNT", "1"}, "ERR wrong number of arguments for 'xread' command"},
+	}
+	for _, tt := range errors {
+		if got := runCommand(srv, tt.args...); got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleXGroup(t *testing.T) {
+	srv := createTestServer(t)
+
+	tests := []struct {
+		args []string
+		want resp.Value
+	}{
+		{[]string{"XGROUP", "CREATE", "s", "g", "$"}, respError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")},
+		{[]string{"XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"}, respSimpleString("OK")},
+		{[]string{"XGROUP", "CREATE", "s", "g", "0"}, respError("BUSYGROUP Consumer Group name already exists")},
+		{[]string{"XGROUP", "CREATE", "s", "g2", "0", "ENTRIESREAD", "-2"}, respError("ERR value for ENTRIESREAD must be positive or -1")},
+		{[]string{"XGROUP", "CREATECONSUMER", "s", "g", "alice"}, respInteger(1)},
+		{[]string{"XGROUP", "CREATECONSUMER", "s", "g", "alice"}, respInteger(0)},
+		{[]string{"XGROUP", "CREATECONSUMER", "s", "nope", "alice"}, respError("NOGROUP No such consumer group 'nope' for key name 's'")},
+		{[]string{"XGROUP", "DELCONSUMER", "s", "g", "alice"}, respInteger(0)},
+		{[]string{"XGROUP", "SETID", "s", "g", "0"}, respSimpleString("OK")},
+		{[]string{"XGROUP", "SETID", "missing", "g", "0"}, respError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")},
+		{[]string{"XGROUP", "DESTROY", "s", "g"}, respInteger(1)},
+		{[]string{"XGROUP", "DESTROY", "s", "g"}, respInteger(0)},
+		{[]string{"XGROUP", "BOGUS"}, respError("ERR unknown subcommand 'BOGUS'. Try XGROUP HELP.")},
+	}
+
+	for _, tt := range tests {
+		if got := runCommand(srv, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleXReadGroup(t *testing.T) {
+	srv := createTestServer(t)
+	for _, id := range []string{"1", "2", "3"} {
+		runCommand(srv, "XADD", "s", id, "f", "v")
+	}
+	runCommand(srv, "XGROUP", "CREATE", "s", "g", "0")
+
+	got := runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">")
+	if len(got.Array) != 1 || !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"1-0", "2-0"}) {
+		t.Fatalf("XREADGROUP > = %v, want 1-0 and 2-0", got)
+	}
+	runCommand(srv, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">")
+
+	if got = runCommand(srv, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"); !got.Null {
+		t.Errorf("XREADGROUP > with nothing new = %v, want nil", got)
+	}
+
+	// History is returned even when empty
+	got = runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "1")
+	if len(got.Array) != 1 || !reflect.DeepEqual(replyIDs(got.Array[0].Array[1]), []string{"2-0"}) {
+		t.Errorf("XREADGROUP history after 1 = %v, want 2-0", got)
+	}
+	runCommand(srv, "XACK", "s", "g", "1", "2")
+	got = runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+	if len(got.Array) != 1 || len(got.Array[0].Array[1].Array) != 0 {
+		t.Errorf("XREADGROUP history after XACK = %v, want an empty list for s", got)
+	}
+
+	// Deleted pending entries come back with nil fields
+	runCommand(srv, "XDEL", "s", "3")
+	got = runCommand(srv, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "0")
+	entry := got.Array[0].Array[1].Array[0]
+	if entry.Array[0].Str != "3-0" || !entry.Array[1].Null {
+		t.Errorf("deleted pending entry = %v, want [3-0 nil]", entry)
+	}
+
+	errors := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"XREADGROUP", "GROUP", "nope", "alice", "STREAMS", "s", ">"}, "NOGROUP No such key 's' or consumer group 'nope' in XREADGROUP with GROUP option"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "$"}, "ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s"}, "ERR wrong number of arguments for 'xreadgroup' command"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "t", ">"}, "ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified."},
+	}
+	for _, tt := range errors {
+		if got := runCommand(srv, tt.args...); got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleXPending(t *testing.T) {
+	srv := createTestServer(t)
+
+	runCommand(srv, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+	got := runCommand(srv, "XPENDING", "s", "g")
+	if len(got.Array) != 4 || got.Array[0].Num != 0 || !got.Array[1].Null || !got.Array[3].Null {
+		t.Errorf("XPENDING on empty group = %v, want [0 nil nil nil]", got)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		runCommand(srv, "XADD", "s", id, "f", "v")
+	}
+	runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">")
+	runCommand(srv, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">")
+
+	got = runCommand(srv, "XPENDING", "s", "g")
+	if got.Array[0].Num != 3 || got.Array[1].Str != "1-0" || got.Array[2].Str != "3-0" {
+		t.Errorf("XPENDING summary = %v, want 3 pending from 1-0 to 3-0", got)
+	}
+	consumers := got.Array[3].Array
+	if len(consumers) != 2 || !reflect.DeepEqual(bulkStrings(consumers[0]), []string{"alice", "2"}) || !reflect.DeepEqual(bulkStrings(consumers[1]), []string{"bob", "1"}) {
+		t.Errorf("XPENDING consumers = %v, want alice 2 and bob 1", consumers)
+	}
+
+	got = runCommand(srv, "XPENDING", "s", "g", "-", "+", "10", "alice")
+	if len(got.Array) != 2 || got.Array[0].Array[0].Str != "1-0" || got.Array[0].Array[1].Str != "alice" || got.Array[0].Array[3].Num != 1 {
+		t.Errorf("XPENDING - + 10 alice = %v, want 1-0 and 2-0 delivered once to alice", got)
+	}
+	if got = runCommand(srv, "XPENDING", "s", "g", "IDLE", "60000", "-", "+", "10"); len(got.Array) != 0 {
+		t.Errorf("XPENDING IDLE 60000 = %v, want none", got)
+	}
+	if got = runCommand(srv, "XPENDING", "s", "nope"); got.Str != "NOGROUP No such key 's' or consumer group 'nope'" {
+		t.Errorf("XPENDING on missing group = %v", got)
+	}
+}
+
+func TestHandleXClaim(t *testing.T) {
+	srv := createTestServer(t)
+	for _, id := range []string{"1", "2", "3"} {
+		runCommand(srv, "XADD", "s", id, "f", "v")
+	}
+	runCommand(srv, "XGROUP", "CREATE", "s", "g", "0")
+	runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+
+	if got := runCommand(srv, "XCLAIM", "s", "g", "bob", "3600000", "1"); len(got.Array) != 0 {
+		t.Errorf("XCLAIM with min idle 1h = %v, want none", got)
+	}
+
+	got := runCommand(srv, "XCLAIM", "s", "g", "bob", "0", "1", "2", "RETRYCOUNT", "5")
+	if !reflect.DeepEqual(replyIDs(got), []string{"1-0", "2-0"}) {
+		t.Errorf("XCLAIM = %v, want 1-0 and 2-0", got)
+	}
+	got = runCommand(srv, "XPENDING", "s", "g", "1", "1", "1")
+	if got.Array[0].Array[1].Str != "bob" || got.Array[0].Array[3].Num != 5 {
+		t.Errorf("pending 1-0 after XCLAIM = %v, want bob with 5 deliveries", got)
+	}
+
+	got = runCommand(srv, "XCLAIM", "s", "g", "carol", "0", "3", "JUSTID")
+	if !reflect.DeepEqual(bulkStrings(got), []string{"3-0"}) {
+		t.Errorf("XCLAIM JUSTID = %v, want [3-0]", got)
+	}
+
+	errors := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"XCLAIM", "s", "g", "bob", "x", "1"}, "ERR Invalid min-idle-time argument for XCLAIM"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1", "BOGUS"}, "ERR Unrecognized XCLAIM option 'BOGUS'"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1", "IDLE"}, "ERR syntax error"},
+		{[]string{"XCLAIM", "s", "nope", "bob", "0", "1"}, "NOGROUP No such key 's' or consumer group 'nope'"},
+	}
+	for _, tt := range errors {
+		if got := runCommand(srv, tt.args...); got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleXAutoClaim(t *testing.T) {
+	srv := createTestServer(t)
+	for _, id := range []string{"1", "2", "3"} {
+		runCommand(srv, "XADD", "s", id, "f", "v")
+	}
+	runCommand(srv, "XGROUP", "CREATE", "s", "g", "0")
+	runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	runCommand(srv, "XDEL", "s", "1")
+
+	got := runCommand(srv, "XAUTOCLAIM", "s", "g", "bob", "0", "-", "COUNT", "1")
+	if got.Array[0].Str != "3-0" || !reflect.DeepEqual(replyIDs(got.Array[1]), []string{"2-0"}) || !reflect.DeepEqual(bulkStrings(got.Array[2]), []string{"1-0"}) {
+		t.Errorf("XAUTOCLAIM COUNT 1 = %v, want [3-0 [2-0] [1-0]]", got)
+	}
+
+	got = runCommand(srv, "XAUTOCLAIM", "s", "g", "bob", "0", "3-0", "JUSTID")
+	if got.Array[0].Str != "0-0" || !reflect.DeepEqual(bulkStrings(got.Array[1]), []string{"3-0"}) || len(got.Array[2].Array) != 0 {
+		t.Errorf("XAUTOCLAIM JUSTID = %v, want [0-0 [3-0] []]", got)
+	}
+
+	if got = runCommand(srv, "XAUTOCLAIM", "s", "g", "bob", "0", "-", "COUNT", "0"); got.Str != "ERR COUNT must be > 0" {
+		t.Errorf("XAUTOCLAIM COUNT 0 = %v", got)
+	}
+}
+
+func TestHandleXInfo(t *testing.T) {
+	srv := createTestServer(t)
+	for _, id := range []string{"1", "2", "3"} {
+		runCommand(srv, "XADD", "s", id, "f", "v")
+	}
+	runCommand(srv, "XGROUP", "CREATE", "s", "g", "0")
+	runCommand(srv, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+
+	info := runCommand(srv, "XINFO", "STREAM", "s")
+	fields := map[string]resp.Value{}
+	for i := 0; i+1 < len(info.Array); i += 2 {
+		fields[info.Array[i].Str] = info.Array[i+1]
+	}
+	if fields["length"].Num != 3 || fields["last-generated-id"].Str != "3-0" || fields["entries-added"].Num != 3 || fields["groups"].Num != 1 {
+		t.Errorf("XINFO STREAM = %v", info)
+	}
+	if fields["first-entry"].Array[0].Str != "1-0" || fields["last-entry"].Array[0].Str != "3-0" {
+		t.Errorf("XINFO STREAM first/last entries = %v, %v", fields["first-entry"], fields["last-entry"])
+	}
+
+	groups := runCommand(srv, "XINFO", "GROUPS", "s")
+	want := []resp.Value{
+		respBulkString("name"), respBulkString("g"),
+		respBulkString("consumers"), respInteger(1),
+		respBulkString("pending"), respInteger(1),
+		respBulkString("last-delivered-id"), respBulkString("1-0"),
+		respBulkString("entries-read"), respInteger(1),
+		respBulkString("lag"), respInteger(2),
+	}
+	if len(groups.Array) != 1 || !reflect.DeepEqual(groups.Array[0].Array, want) {
+		t.Errorf("XINFO GROUPS = %v, want %v", groups, want)
+	}
+
+	consumers := runCommand(srv, "XINFO", "CONSUMERS", "s", "g")
+	if len(consumers.Array) != 1 || consumers.Array[0].Array[1].Str != "alice" || consumers.Array[0].Array[3].Num != 1 {
+		t.Errorf("XINFO CONSUMERS = %v, want alice with 1 pending", consumers)
+	}
+
+	errors := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"XINFO", "STREAM", "missing"}, "ERR no such key"},
+		{[]string{"XINFO", "CONSUMERS", "s", "nope"}, "NOGROUP No such consumer group 'nope' for key name 's'"},
+		{[]string{"XINFO", "BOGUS", "s"}, "ERR unknown subcommand 'BOGUS'. Try XINFO HELP."},
+	}
+	for _, tt := range errors {
+		if got := runCommand(srv, tt.args...); got.Str != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestStreamWrongType(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "SET", "str", "v")
+	runCommand(srv, "XADD", "s", "*", "f", "v")
+
+	for _, args := range [][]string{
+		{"XADD", "str", "*", "f", "v"},
+		{"XRANGE", "str", "-", "+"},
+		{"XREAD", "STREAMS", "str", "0"},
+		{"XGROUP", "CREATE", "str", "g", "$", "MKSTREAM"},
+		{"XREADGROUP", "GROUP", "g", "c", "STREAMS", "str", ">"},
+		{"XINFO", "STREAM", "str"},
+	} {
+		if got := runCommand(srv, args...); !strings.HasPrefix(got.Str, "WRONGTYPE") {
+			t.Errorf("%v = %v, want WRONGTYPE", args, got)
+		}
+	}
+
+	if got := runCommand(srv, "LPUSH", "s", "a"); !strings.HasPrefix(got.Str, "WRONGTYPE") {
+		t.Errorf("LPUSH on stream = %v, want WRONGTYPE", got)
+	}
+}
@@ -0,0 +1,62 @@
+// Package server contains TLS listener configuration for the Redis server.
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures the TLS listener.
+type TLSConfig struct {
+	Port     int
+	CertFile string
+	KeyFile  string
+
+	// CACertFile holds the CA certificates client certificates are verified
+	// against. It is required unless ClientAuth is tls.NoClientCert.
+	CACertFile string
+
+	// ClientAuth is whether clients must present a certificate (mTLS):
+	// tls.NoClientCert, tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert.
+	ClientAuth tls.ClientAuthType
+}
+
+// clientAuthTypes maps the values of the tls-auth-clients parameter to
+// client certificate policies.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"yes":      tls.RequireAndVerifyClientCert,
+	"no":       tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+}
+
+// load reads the certificates and builds the crypto/tls configuration.
+func (c *TLSConfig) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   c.ClientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientAuth == tls.NoClientCert {
+		return cfg, nil
+	}
+	if c.CACertFile == "" {
+		return nil, errors.New("verifying client certificates requires a CA certificate file")
+	}
+	pem, err := os.ReadFile(c.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	cfg.ClientCAs = x509.NewCertPool()
+	if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", c.CACertFile)
+	}
+	return cfg, nil
+}
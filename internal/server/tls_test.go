@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// testPKI holds a self-signed CA with a server and a client certificate
+// issued by it, written to files for the server to load.
+type testPKI struct {
+	caFile, certFile, keyFile string
+	pool                      *x509.CertPool
+	client                    tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey := newTestKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mini-redis test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key := newTestKey(t)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		return der, key
+	}
+
+	pki := &testPKI{
+		caFile:   filepath.Join(dir, "ca.crt"),
+		certFile: filepath.Join(dir, "server.crt"),
+		keyFile:  filepath.Join(dir, "server.key"),
+		pool:     x509.NewCertPool(),
+	}
+	pki.pool.AddCert(ca)
+	writePEM(t, pki.caFile, "CERTIFICATE", caDER)
+
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	writePEM(t, pki.certFile, "CERTIFICATE", serverDER)
+	writePEM(t, pki.keyFile, "EC PRIVATE KEY", marshalTestKey(t, serverKey))
+
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	pki.client = tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+	return pki
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+func marshalTestKey(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return der
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// tlsConfig returns a Config with a TLS listener on a free port.
+func (pki *testPKI) tlsConfig(clientAuth tls.ClientAuthType) Config {
+	cfg := DefaultConfig()
+	cfg.TLS = &TLSConfig{
+		CertFile:   pki.certFile,
+		KeyFile:    pki.keyFile,
+		CACertFile: pki.caFile,
+		ClientAuth: clientAuth,
+	}
+	return cfg
+}
+
+// dialTLS connects to addr over TLS, presenting the client certificate if withCert is set.
+func (pki *testPKI) dialTLS(addr string, withCert bool) (*tls.Conn, error) {
+	cfg := &tls.Config{RootCAs: pki.pool, ServerName: "localhost"}
+	if withCert {
+		cfg.Certificates = []tls.Certificate{pki.client}
+	}
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// With TLS 1.3 a refused client certificate is only reported on the first read
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	return conn, nil
+}
+
+// tlsPing sends PING over a new TLS connection and returns the reply.
+func (pki *testPKI) tlsPing(addr string, withCert bool) (resp.Value, error) {
+	conn, err := pki.dialTLS(addr, withCert)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	defer conn.Close()
+
+	cmd := resp.Value{Type: resp.TypeArray, Array: []resp.Value{{Type: resp.TypeBulkString, Str: "PING"}}}
+	if _, err := conn.Write(cmd.Serialize()); err != nil {
+		return resp.Value{}, err
+	}
+	return resp.Parse(bufio.NewReader(conn))
+}
+
+func TestTLSListener(t *testing.T) {
+	pki := newTestPKI(t)
+	srv, addr := startTestServerWithConfig(t, pki.tlsConfig(tls.NoClientCert))
+
+	reply, err := pki.tlsPing(srv.TLSAddr().String(), false)
+	if err != nil {
+		t.Fatalf("PING over TLS failed: %v", err)
+	}
+	if reply.Str != "PONG" {
+		t.Errorf("Expected PONG over TLS, got %+v", reply)
+	}
+
+	// The plaintext listener keeps working alongside TLS
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if reply := sendCommand(t, conn, "PING"); reply.Str != "PONG" {
+		t.Errorf("Expected PONG over plaintext, got %+v", reply)
+	}
+}
+
+func TestTLSOnly(t *testing.T) {
+	pki := newTestPKI(t)
+	cfg := pki.tlsConfig(tls.NoClientCert)
+	cfg.Port = -1
+	srv, _ := startTestServerWithConfig(t, cfg)
+
+	if srv.Addr() != nil {
+		t.Errorf("Expected no plaintext listener, got %v", srv.Addr())
+	}
+	if _, err := pki.tlsPing(srv.TLSAddr().String(), false); err != nil {
+		t.Errorf("PING over TLS failed: %v", err)
+	}
+}
+
+func TestTLSClientCertificates(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		withCert   bool
+		wantErr    bool
+	}{
+		{"required with certificate", tls.RequireAndVerifyClientCert, true, false},
+		{"required without certificate", tls.RequireAndVerifyClientCert, false, true},
+		{"optional with certificate", tls.VerifyClientCertIfGiven, true, false},
+		{"optional without certificate", tls.VerifyClientCertIfGiven, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := startTestServerWithConfig(t, pki.tlsConfig(tt.clientAuth))
+
+			reply, err := pki.tlsPing(srv.TLSAddr().String(), tt.withCert)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected the connection to be refused, got %+v", reply)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PING over TLS failed: %v", err)
+			}
+			if reply.Str != "PONG" {
+				t.Errorf("Expected PONG, got %+v", reply)
+			}
+		})
+	}
+}
+
+func TestTLSPlaintextClientRefused(t *testing.T) {
+	pki := newTestPKI(t)
+	srv, _ := startTestServerWithConfig(t, pki.tlsConfig(tls.NoClientCert))
+
+	conn, err := net.Dial("tcp", srv.TLSAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if _, err := resp.Parse(bufio.NewReader(conn)); err == nil {
+		t.Error("Expected a plaintext client on the TLS port to get no reply")
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name   string
+		modify func(cfg *TLSConfig)
+	}{
+		{"missing certificate", func(cfg *TLSConfig) { cfg.CertFile = filepath.Join(t.TempDir(), "missing.crt") }},
+		{"key does not match", func(cfg *TLSConfig) { cfg.KeyFile = cfg.CertFile }},
+		{"client auth without CA", func(cfg *TLSConfig) { cfg.CACertFile = "" }},
+		{"CA file without certificates", func(cfg *TLSConfig) { cfg.CACertFile = pki.keyFile }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := createTestServer(t)
+			srv.config.TLS = pki.tlsConfig(tls.RequireAndVerifyClientCert).TLS
+			tt.modify(srv.config.TLS)
+			if err := srv.Start(); err == nil {
+				srv.Stop()
+				t.Fatal("Expected Start to fail")
+			}
+			if srv.Addr() == nil {
+				return
+			}
+			// The plaintext listener must have been closed again
+			if conn, err := net.Dial("tcp", srv.Addr().String()); err == nil {
+				conn.Close()
+				t.Error("Expected the plaintext listener to be closed")
+			}
+		})
+	}
+}
+
+func TestNoListeners(t *testing.T) {
+	srv := createTestServer(t)
+	srv.config.Port = -1
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Fatal("Expected Start to fail without listeners")
+	}
+}
@@ -55,7 +55,9 @@ func (h *TransactionHandler) HandleExec(args []resp.Value, executor transaction.
 		getVersion = h.versionTracker.GetVersion
 	}
 
+	watched := h.tx.WatchedKeys()
 	results, err := h.tx.Exec(executor, getVersion)
+	h.releaseWatches(watched)
 	if err != nil {
 		return respError(err.Error())
 	}
@@ -76,7 +78,10 @@ func (h *TransactionHandler) HandleDiscard(args []resp.Value) resp.Value {
 		return respError("ERR wrong number of arguments for 'discard' command")
 	}
 
-	if err := h.tx.Discard(); err != nil {
+	watched := h.tx.WatchedKeys()
+	err := h.tx.Discard()
+	h.releaseWatches(watched)
+	if err != nil {
 		return respError(err.Error())
 	}
 
@@ -104,7 +109,10 @@ func (h *TransactionHandler) HandleWatch(args []resp.Value) resp.Value {
 		getVersion = func(key string) int64 { return 0 }
 	}
 
+	// Keys are tracked before their versions are read, so no write is missed
+	added := h.trackWatches(keys)
 	if err := h.tx.Watch(getVersion, keys...); err != nil {
+		h.untrackWatches(added)
 		return respError(err.Error())
 	}
 
@@ -119,10 +127,57 @@ func (h *TransactionHandler) HandleUnwatch(args []resp.Value) resp.Value {
 		return respError("ERR wrong number of arguments for 'unwatch' command")
 	}
 
-	h.tx.Unwatch()
+	h.Close()
 	return respSimpleString("OK")
 }
 
+// Close stops watching every key, releasing them in the version tracker.
+// Called when the connection closes.
+func (h *TransactionHandler) Close() {
+	watched := h.tx.WatchedKeys()
+	h.tx.Unwatch()
+	h.releaseWatches(watched)
+}
+
+// trackWatches tells a tracker that only keeps versions of watched keys about
+// the keys this connection doesn't watch yet. It returns those keys.
+func (h *TransactionHandler) trackWatches(keys []string) []string {
+	tracker, ok := h.versionTracker.(transaction.WatchTracker)
+	if !ok {
+		return nil
+	}
+	watched := h.tx.WatchedKeys()
+	var added []string
+	for _, key := range keys {
+		if _, ok := watched[key]; !ok {
+			watched[key] = 0
+			added = append(added, key)
+		}
+	}
+	tracker.Watch(added...)
+	return added
+}
+
+// untrackWatches undoes trackWatches.
+func (h *TransactionHandler) untrackWatches(keys []string) {
+	if tracker, ok := h.versionTracker.(transaction.WatchTracker); ok && len(keys) > 0 {
+		tracker.Unwatch(keys...)
+	}
+}
+
+// releaseWatches untracks the keys of watched the connection no longer
+// watches.
+func (h *TransactionHandler) releaseWatches(watched map[string]int64) {
+	current := h.tx.WatchedKeys()
+	var released []string
+	for key := range watched {
+		if _, ok := current[key]; !ok {
+			released = append(released, key)
+		}
+	}
+	h.untrackWatches(released)
+}
+
 // InTransaction returns true if currently in MULTI mode.
 // This allows the server to decide whether to queue commands or execute them.
 func (h *TransactionHandler) InTransaction() bool {
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"net"
 	"strings"
 	"testing"
 
 	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
 	"github.com/scotro/mini-redis/internal/transaction"
 )
 
@@ -80,13 +82,13 @@ func TestHandleExec(t *testing.T) {
 	}
 
 	tests := []struct {
-		name      string
-		setup     func(*TransactionHandler, *transaction.MemoryVersionTracker)
-		args      []string
-		wantType  byte
-		wantLen   int
-		wantNull  bool
-		wantErr   string
+		name     string
+		setup    func(*TransactionHandler, *transaction.MemoryVersionTracker)
+		args     []string
+		wantType byte
+		wantLen  int
+		wantNull bool
+		wantErr  string
 	}{
 		{
 			name:     "exec without multi",
@@ -356,6 +358,54 @@ func TestHandleUnwatch(t *testing.T) {
 	}
 }
 
+// TestWatchReleasedFromTracker checks every way of ending a WATCH stops the
+// shared tracker keeping the key's version.
+func TestWatchReleasedFromTracker(t *testing.T) {
+	noop := func(string, []string) (resp.Value, error) { return resp.Value{}, nil }
+	tests := []struct {
+		name string
+		end  func(*TransactionHandler)
+	}{
+		{"UNWATCH", func(h *TransactionHandler) { h.HandleUnwatch(makeArgs()) }},
+		{"EXEC", func(h *TransactionHandler) {
+			h.HandleMulti(makeArgs())
+			h.HandleExec(makeArgs(), noop)
+		}},
+		{"DISCARD", func(h *TransactionHandler) {
+			h.HandleMulti(makeArgs())
+			h.HandleDiscard(makeArgs())
+		}},
+		{"disconnect", func(h *TransactionHandler) { h.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			versions := store.NewVersions()
+			h := NewTransactionHandler(versions)
+			other := NewTransactionHandler(versions)
+			h.HandleWatch(makeArgs("key", "key"))
+			h.HandleWatch(makeArgs("key", "mine"))
+			other.HandleWatch(makeArgs("key"))
+
+			tt.end(h)
+			versions.IncrementVersion("key")
+			versions.IncrementVersion("mine")
+			if versions.GetVersion("key") == 0 {
+				t.Error("key another client watches is no longer tracked")
+			}
+			if got := versions.GetVersion("mine"); got != 0 {
+				t.Errorf("GetVersion(unwatched) = %d, want 0", got)
+			}
+
+			other.Close()
+			versions.IncrementVersion("key")
+			if got := versions.GetVersion("key"); got != 0 {
+				t.Errorf("GetVersion(key) = %d after every watcher left, want 0", got)
+			}
+		})
+	}
+}
+
 func TestInTransaction(t *testing.T) {
 	h, _ := newTestTransactionHandler()
 
@@ -491,3 +541,218 @@ func TestTransactionFlowWithModifiedKey(t *testing.T) {
 		t.Error("EXEC should return null array when WATCH fails")
 	}
 }
+
+func TestServerMultiExec(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	response := sendCommand(t, conn, "MULTI")
+	if response.Type != resp.TypeSimpleString || response.Str != "OK" {
+		t.Fatalf("Expected +OK, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "SET", "key", "value")
+	if response.Type != resp.TypeSimpleString || response.Str != "QUEUED" {
+		t.Errorf("Expected +QUEUED, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "GET", "key")
+	if response.Type != resp.TypeSimpleString || response.Str != "QUEUED" {
+		t.Errorf("Expected +QUEUED, got %v", response)
+	}
+
+	// Queued commands must not have run yet
+	other, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = other.Close() }()
+
+	response = sendCommand(t, other, "GET", "key")
+	if !response.Null {
+		t.Errorf("Expected key to be unset before EXEC, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "EXEC")
+	if response.Type != resp.TypeArray || len(response.Array) != 2 {
+		t.Fatalf("Expected array of 2 results, got %v", response)
+	}
+	if response.Array[0].Str != "OK" {
+		t.Errorf("Expected OK from SET, got %v", response.Array[0])
+	}
+	if response.Array[1].Str != "value" {
+		t.Errorf("Expected value from GET, got %v", response.Array[1])
+	}
+
+	// Back to normal mode
+	response = sendCommand(t, conn, "GET", "key")
+	if response.Type != resp.TypeBulkString || response.Str != "value" {
+		t.Errorf("Expected $value, got %v", response)
+	}
+}
+
+func TestServerDiscard(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "SET", "key", "value")
+
+	response := sendCommand(t, conn, "DISCARD")
+	if response.Type != resp.TypeSimpleString || response.Str != "OK" {
+		t.Errorf("Expected +OK, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "GET", "key")
+	if !response.Null {
+		t.Errorf("Expected discarded SET not to run, got %v", response)
+	}
+}
+
+func TestServerTransactionErrors(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	response := sendCommand(t, conn, "EXEC")
+	if response.Type != resp.TypeError || response.Str != "ERR EXEC without MULTI" {
+		t.Errorf("Expected EXEC without MULTI error, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "DISCARD")
+	if response.Type != resp.TypeError || response.Str != "ERR DISCARD without MULTI" {
+		t.Errorf("Expected DISCARD without MULTI error, got %v", response)
+	}
+
+	sendCommand(t, conn, "MULTI")
+
+	response = sendCommand(t, conn, "MULTI")
+	if response.Type != resp.TypeError || response.Str != "ERR MULTI calls can not be nested" {
+		t.Errorf("Expected nested MULTI error, got %v", response)
+	}
+
+	response = sendCommand(t, conn, "WATCH", "key")
+	if response.Type != resp.TypeError || response.Str != "ERR WATCH inside MULTI is not allowed" {
+		t.Errorf("Expected WATCH inside MULTI error, got %v", response)
+	}
+
+	// Command errors are reported per command inside the EXEC result
+	sendCommand(t, conn, "SET", "key")
+	response = sendCommand(t, conn, "EXEC")
+	if response.Type != resp.TypeArray || len(response.Array) != 1 || response.Array[0].Type != resp.TypeError {
+		t.Errorf("Expected array with one error, got %v", response)
+	}
+}
+
+func TestServerTransactionsAreIsolated(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Each connection has its own transaction state
+	sendCommand(t, conn, "MULTI")
+
+	other, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = other.Close() }()
+
+	response := sendCommand(t, other, "SET", "key", "other")
+	if response.Type != resp.TypeSimpleString || response.Str != "OK" {
+		t.Errorf("Expected other connection to execute immediately, got %v", response)
+	}
+
+	sendCommand(t, conn, "GET", "key")
+	response = sendCommand(t, conn, "EXEC")
+	if response.Type != resp.TypeArray || len(response.Array) != 1 || response.Array[0].Str != "other" {
+		t.Errorf("Expected [other], got %v", response)
+	}
+}
+
+func TestServerWatchDetectsModification(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	other, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = other.Close() }()
+
+	tests := []struct {
+		name   string
+		key    string
+		modify []string
+	}{
+		{"string write", "watched", []string{"SET", "watched", "x"}},
+		{"list write", "watched-list", []string{"RPUSH", "watched-list", "x"}},
+		{"hash write", "watched-hash", []string{"HSET", "watched-hash", "f", "v"}},
+		{"set write", "watched-set", []string{"SADD", "watched-set", "m"}},
+		{"string delete", "watched", []string{"DEL", "watched"}},
+		{"flush", "watched-list", []string{"FLUSHALL"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key
+			response := sendCommand(t, conn, "WATCH", key)
+			if response.Type != resp.TypeSimpleString || response.Str != "OK" {
+				t.Fatalf("Expected +OK from WATCH, got %v", response)
+			}
+
+			sendCommand(t, other, tt.modify...)
+
+			sendCommand(t, conn, "MULTI")
+			sendCommand(t, conn, "SET", "result", "ran")
+			response = sendCommand(t, conn, "EXEC")
+			if response.Type != resp.TypeArray || !response.Null {
+				t.Errorf("Expected null array from EXEC, got %v", response)
+			}
+		})
+	}
+}
+
+func TestServerWatchUnmodifiedKey(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sendCommand(t, conn, "SET", "watched", "value")
+	sendCommand(t, conn, "WATCH", "watched")
+	sendCommand(t, conn, "SET", "unrelated", "value")
+
+	sendCommand(t, conn, "MULTI")
+	sendCommand(t, conn, "GET", "watched")
+	response := sendCommand(t, conn, "EXEC")
+	if response.Type != resp.TypeArray || len(response.Array) != 1 || response.Array[0].Str != "value" {
+		t.Errorf("Expected [value], got %v", response)
+	}
+}
@@ -0,0 +1,35 @@
+// Package server contains the unix domain socket listener for the Redis server.
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// listenUnix listens on a unix domain socket at path, setting the socket
+// file's mode to perm unless it is zero. A socket file left behind by a
+// previous run is replaced; any other file at path is an error. The socket
+// file is removed again when the listener is closed.
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("failed to listen on %s: file exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to set permissions on %s: %w", path, err)
+		}
+	}
+	return listener, nil
+}
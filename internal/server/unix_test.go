@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	cfg := DefaultConfig()
+	cfg.Port = -1
+	cfg.UnixSocket = path
+	cfg.UnixSocketPerm = 0o700
+	srv, _ := startTestServerWithConfig(t, cfg)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Socket file missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("Expected socket mode 0700, got %#o", perm)
+	}
+
+	conn, err := net.Dial("unix", srv.UnixAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if reply := sendCommand(t, conn, "SET", "k", "v"); reply.Str != "OK" {
+		t.Errorf("Expected OK, got %+v", reply)
+	}
+	if reply := sendCommand(t, conn, "GET", "k"); reply.Str != "v" {
+		t.Errorf("Expected v, got %+v", reply)
+	}
+	conn.Close()
+
+	srv.Stop()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket file to be removed on Stop, got %v", err)
+	}
+}
+
+func TestUnixSocketAlongsideTCP(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Port = 0
+	cfg.UnixSocket = filepath.Join(t.TempDir(), "redis.sock")
+	srv, addr := startTestServerWithConfig(t, cfg)
+
+	for _, dial := range []struct{ network, addr string }{
+		{"tcp", addr},
+		{"unix", srv.UnixAddr().String()},
+	} {
+		conn, err := net.Dial(dial.network, dial.addr)
+		if err != nil {
+			t.Fatalf("Failed to connect over %s: %v", dial.network, err)
+		}
+		if reply := sendCommand(t, conn, "PING"); reply.Str != "PONG" {
+			t.Errorf("Expected PONG over %s, got %+v", dial.network, reply)
+		}
+		conn.Close()
+	}
+}
+
+func TestUnixSocketExistingFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// A socket left behind by a previous run is replaced
+	stale := filepath.Join(dir, "stale.sock")
+	listener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	srv := createTestServer(t)
+	srv.config.Port = -1
+	srv.config.UnixSocket = stale
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected a stale socket to be replaced, got %v", err)
+	}
+	srv.Stop()
+
+	// Any other file is left alone
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("data"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	srv = createTestServer(t)
+	srv.config.Port = -1
+	srv.config.UnixSocket = regular
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Fatal("Expected Start to fail when the path is a regular file")
+	}
+	if data, err := os.ReadFile(regular); err != nil || string(data) != "data" {
+		t.Errorf("Expected the file to be untouched, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,611 @@
+// Package server provides sorted set command handlers for the Redis server.
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/scotro/mini-redis/internal/resp"
+	"github.com/scotro/mini-redis/internal/store"
+)
+
+// ZSetCommands handles Redis sorted set commands.
+type ZSetCommands struct {
+	zsetStore store.ZSetStore
+	keyspace  *store.Keyspace // For type checking against keys of other types
+}
+
+// NewZSetCommands creates a new ZSetCommands handler operating on the keyspace's sorted set store.
+func NewZSetCommands(keyspace *store.Keyspace) *ZSetCommands {
+	return &ZSetCommands{
+		zsetStore: keyspace.ZSets(),
+		keyspace:  keyspace,
+	}
+}
+
+// checkKeyType returns an error response if the key holds a type other than sorted set.
+func (z *ZSetCommands) checkKeyType(key string) *resp.Value {
+	if err := z.keyspace.CheckType(key, store.TypeZSet); err != nil {
+		errResp := respError(err.Error())
+		return &errResp
+	}
+	return nil
+}
+
+// Range kinds of ZRANGE and ZRANGESTORE.
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec holds the parsed arguments of ZRANGE and ZRANGESTORE.
+type zrangeSpec struct {
+	start, stop string
+	by          int
+	rev         bool
+	withScores  bool
+	offset      int
+	count       int
+}
+
+// HandleZAdd handles the ZADD command.
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+// Returns the number of members added (plus updated with CH), or the new
+// score with INCR (nil if a condition prevented the update).
+func (z *ZSetCommands) HandleZAdd(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return respError("ERR wrong number of arguments for 'zadd' command")
+	}
+
+	key := args[0].Str
+	var flags store.ZAddFlags
+	var ch, incr bool
+
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "NX":
+			flags.NX = true
+		case "XX":
+			flags.XX = true
+		case "GT":
+			flags.GT = true
+		case "LT":
+			flags.LT = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+
+	elements := args[i:]
+	if len(elements) == 0 || len(elements)%2 != 0 {
+		return respError("ERR syntax error")
+	}
+	if flags.NX && flags.XX {
+		return respError("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags.GT && flags.NX) || (flags.LT && flags.NX) || (flags.GT && flags.LT) {
+		return respError("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(elements) > 2 {
+		return respError("ERR INCR option supports a single increment-element pair")
+	}
+
+	members := make([]store.ZMember, 0, len(elements)/2)
+	for j := 0; j < len(elements); j += 2 {
+		score, ok := parseScore(elements[j].Str)
+		if !ok {
+			return respError("ERR value is not a valid float")
+		}
+		members = append(members, store.ZMember{Member: elements[j+1].Str, Score: score})
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	if incr {
+		score, ok, err := z.zsetStore.ZIncrBy(key, flags, members[0].Member, members[0].Score)
+		if err != nil {
+			return respError(err.Error())
+		}
+		if !ok {
+			return respNullBulkString()
+		}
+		return respBulkString(formatScore(score))
+	}
+
+	added, updated := z.zsetStore.ZAdd(key, flags, members...)
+	if ch {
+		return respInteger(added + updated)
+	}
+	return respInteger(added)
+}
+
+// HandleZIncrBy handles the ZINCRBY command.
+// ZINCRBY key increment member
+// Returns the new score of member.
+func (z *ZSetCommands) HandleZIncrBy(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return respError("ERR wrong number of arguments for 'zincrby' command")
+	}
+
+	key := args[0].Str
+	increment, ok := parseScore(args[1].Str)
+	if !ok {
+		return respError("ERR value is not a valid float")
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	score, _, err := z.zsetStore.ZIncrBy(key, store.ZAddFlags{}, args[2].Str, increment)
+	if err != nil {
+		return respError(err.Error())
+	}
+	return respBulkString(formatScore(score))
+}
+
+// HandleZRem handles the ZREM command.
+// ZREM key member [member ...]
+// Returns the number of members removed.
+func (z *ZSetCommands) HandleZRem(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return respError("ERR wrong number of arguments for 'zrem' command")
+	}
+
+	key := args[0].Str
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	members := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		members[i] = arg.Str
+	}
+	return respInteger(z.zsetStore.ZRem(key, members...))
+}
+
+// HandleZScore handles the ZSCORE command.
+// ZSCORE key member
+// Returns the score of member, or nil if member or key doesn't exist.
+func (z *ZSetCommands) HandleZScore(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return respError("ERR wrong number of arguments for 'zscore' command")
+	}
+
+	key := args[0].Str
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	score, ok := z.zsetStore.ZScore(key, args[1].Str)
+	if !ok {
+		return respNullBulkString()
+	}
+	return respBulkString(formatScore(score))
+}
+
+// HandleZMScore handles the ZMSCORE command.
+// ZMSCORE key member [member ...]
+// Returns the score of each member, with nil for members that don't exist.
+func (z *ZSetCommands) HandleZMScore(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return respError("ERR wrong number of arguments for 'zmscore' command")
+	}
+
+	key := args[0].Str
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	array := make([]resp.Value, len(args)-1)
+	for i, arg := range args[1:] {
+		if score, ok := z.zsetStore.ZScore(key, arg.Str); ok {
+			array[i] = respBulkString(formatScore(score))
+		} else {
+			array[i] = respNullBulkString()
+		}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
+
+// HandleZCard handles the ZCARD command.
+// ZCARD key
+// Returns the number of members, or 0 if key doesn't exist.
+func (z *ZSetCommands) HandleZCard(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return respError("ERR wrong number of arguments for 'zcard' command")
+	}
+
+	key := args[0].Str
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(z.zsetStore.ZCard(key))
+}
+
+// HandleZCount handles the ZCOUNT command.
+// ZCOUNT key min max
+// Returns the number of members with a score between min and max.
+func (z *ZSetCommands) HandleZCount(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return respError("ERR wrong number of arguments for 'zcount' command")
+	}
+
+	key := args[0].Str
+	min, max, err := parseScoreRange(args[1].Str, args[2].Str)
+	if err != nil {
+		return *err
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(z.zsetStore.ZCount(key, min, max))
+}
+
+// HandleZRank handles the ZRANK and ZREVRANK commands.
+// ZRANK key member [WITHSCORE]
+// Returns the rank of member, or nil if member or key doesn't exist.
+// ZREVRANK ranks from the highest score.
+func (z *ZSetCommands) HandleZRank(cmd string, args []resp.Value) resp.Value {
+	if len(args) != 2 && len(args) != 3 {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	}
+
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2].Str) != "WITHSCORE" {
+			return respError("ERR syntax error")
+		}
+		withScore = true
+	}
+
+	key := args[0].Str
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	rank, score, ok := z.zsetStore.ZRank(key, args[1].Str, cmd == "ZREVRANK")
+	if !ok {
+		if withScore {
+			return resp.Value{Type: resp.TypeArray, Null: true}
+		}
+		return respNullBulkString()
+	}
+	if withScore {
+		return resp.Value{Type: resp.TypeArray, Array: []resp.Value{
+			respInteger(rank),
+			respBulkString(formatScore(score)),
+		}}
+	}
+	return respInteger(rank)
+}
+
+// HandleZRange handles the ZRANGE command.
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+// Returns the members in the range, with their scores if WITHSCORES is given.
+func (z *ZSetCommands) HandleZRange(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return respError("ERR wrong number of arguments for 'zrange' command")
+	}
+
+	key := args[0].Str
+	spec, err := parseZRangeSpec(args[1:], true)
+	if err != nil {
+		return *err
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	members, err := z.zrange(key, spec)
+	if err != nil {
+		return *err
+	}
+	return zmembersReply(members, spec.withScores)
+}
+
+// HandleZRangeStore handles the ZRANGESTORE command.
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+// Stores the range in dst, replacing whatever it held, and returns its size.
+func (z *ZSetCommands) HandleZRangeStore(args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return respError("ERR wrong number of arguments for 'zrangestore' command")
+	}
+
+	dst := args[0].Str
+	src := args[1].Str
+	spec, err := parseZRangeSpec(args[2:], false)
+	if err != nil {
+		return *err
+	}
+
+	if err := z.checkKeyType(src); err != nil {
+		return *err
+	}
+
+	members, err := z.zrange(src, spec)
+	if err != nil {
+		return *err
+	}
+
+	// Like SET, the destination is replaced whatever its type
+	z.keyspace.Overwrite(dst, store.TypeZSet)
+	z.zsetStore.ZReplace(dst, members)
+	return respInteger(len(members))
+}
+
+// parseZRangeSpec parses the arguments of ZRANGE and ZRANGESTORE that follow the key(s).
+func parseZRangeSpec(args []resp.Value, allowWithScores bool) (zrangeSpec, *resp.Value) {
+	spec := zrangeSpec{start: args[0].Str, stop: args[1].Str, count: -1}
+	limit := false
+
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].Str); {
+		case opt == "WITHSCORES" && allowWithScores:
+			spec.withScores = true
+		case opt == "BYSCORE":
+			spec.by = zrangeByScore
+		case opt == "BYLEX":
+			spec.by = zrangeByLex
+		case opt == "REV":
+			spec.rev = true
+		case opt == "LIMIT" && i+2 < len(args):
+			offset, err1 := strconv.Atoi(args[i+1].Str)
+			count, err2 := strconv.Atoi(args[i+2].Str)
+			if err1 != nil || err2 != nil {
+				errResp := respError("ERR value is not an integer or out of range")
+				return spec, &errResp
+			}
+			spec.offset, spec.count = offset, count
+			limit = true
+			i += 2
+		default:
+			errResp := respError("ERR syntax error")
+			return spec, &errResp
+		}
+	}
+
+	if limit && spec.by == zrangeByRank {
+		errResp := respError("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+		return spec, &errResp
+	}
+	if spec.withScores && spec.by == zrangeByLex {
+		errResp := respError("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+		return spec, &errResp
+	}
+	return spec, nil
+}
+
+// zrange runs a parsed ZRANGE against key.
+func (z *ZSetCommands) zrange(key string, spec zrangeSpec) ([]store.ZMember, *resp.Value) {
+	// With REV, score and lex ranges are given from the high end down
+	lo, hi := spec.start, spec.stop
+	if spec.rev {
+		lo, hi = hi, lo
+	}
+
+	switch spec.by {
+	case zrangeByScore:
+		min, max, err := parseScoreRange(lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		return z.zsetStore.ZRangeByScore(key, min, max, spec.rev, spec.offset, spec.count), nil
+	case zrangeByLex:
+		min, max, err := parseLexRange(lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		return z.zsetStore.ZRangeByLex(key, min, max, spec.rev, spec.offset, spec.count), nil
+	default:
+		start, stop, err := parseRankRange(spec.start, spec.stop)
+		if err != nil {
+			return nil, err
+		}
+		return z.zsetStore.ZRange(key, start, stop, spec.rev), nil
+	}
+}
+
+// HandleZPop handles the ZPOPMIN and ZPOPMAX commands.
+// ZPOPMIN key [count]
+// Returns the popped members and their scores.
+func (z *ZSetCommands) HandleZPop(cmd string, args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	}
+
+	key := args[0].Str
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Str)
+		if err != nil || n < 0 {
+			return respError("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+
+	var popped []store.ZMember
+	if cmd == "ZPOPMAX" {
+		popped = z.zsetStore.ZPopMax(key, count)
+	} else {
+		popped = z.zsetStore.ZPopMin(key, count)
+	}
+	return zmembersReply(popped, true)
+}
+
+// HandleZRemRangeByRank handles the ZREMRANGEBYRANK command.
+// ZREMRANGEBYRANK key start stop
+// Returns the number of members removed.
+func (z *ZSetCommands) HandleZRemRangeByRank(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return respError("ERR wrong number of arguments for 'zremrangebyrank' command")
+	}
+
+	key := args[0].Str
+	start, stop, err := parseRankRange(args[1].Str, args[2].Str)
+	if err != nil {
+		return *err
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(z.zsetStore.ZRemRangeByRank(key, start, stop))
+}
+
+// HandleZRemRangeByScore handles the ZREMRANGEBYSCORE command.
+// ZREMRANGEBYSCORE key min max
+// Returns the number of members removed.
+func (z *ZSetCommands) HandleZRemRangeByScore(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return respError("ERR wrong number of arguments for 'zremrangebyscore' command")
+	}
+
+	key := args[0].Str
+	min, max, err := parseScoreRange(args[1].Str, args[2].Str)
+	if err != nil {
+		return *err
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(z.zsetStore.ZRemRangeByScore(key, min, max))
+}
+
+// HandleZRemRangeByLex handles the ZREMRANGEBYLEX command.
+// ZREMRANGEBYLEX key min max
+// Returns the number of members removed.
+func (z *ZSetCommands) HandleZRemRangeByLex(args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return respError("ERR wrong number of arguments for 'zremrangebylex' command")
+	}
+
+	key := args[0].Str
+	min, max, err := parseLexRange(args[1].Str, args[2].Str)
+	if err != nil {
+		return *err
+	}
+
+	if err := z.checkKeyType(key); err != nil {
+		return *err
+	}
+	return respInteger(z.zsetStore.ZRemRangeByLex(key, min, max))
+}
+
+// zmembersReply formats members as a flat array, interleaving scores if withScores is set.
+func zmembersReply(members []store.ZMember, withScores bool) resp.Value {
+	size := len(members)
+	if withScores {
+		size *= 2
+	}
+
+	array := make([]resp.Value, 0, size)
+	for _, m := range members {
+		array = append(array, respBulkString(m.Member))
+		if withScores {
+			array = append(array, respBulkString(formatScore(m.Score)))
+		}
+	}
+	return resp.Value{Type: resp.TypeArray, Array: array}
+}
+
+// parseScore parses a score, accepting "inf", "+inf" and "-inf". NaN is rejected.
+func parseScore(s string) (float64, bool) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// formatScore formats a score the way Redis replies with it.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	if abs := math.Abs(score); abs == 0 || (abs >= 1e-6 && abs < 1e21) {
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// parseRankRange parses the start and stop ranks of a rank range.
+func parseRankRange(start, stop string) (int, int, *resp.Value) {
+	a, err1 := strconv.Atoi(start)
+	b, err2 := strconv.Atoi(stop)
+	if err1 != nil || err2 != nil {
+		errResp := respError("ERR value is not an integer or out of range")
+		return 0, 0, &errResp
+	}
+	return a, b, nil
+}
+
+// parseScoreRange parses the bounds of a score range, where "(" marks an exclusive bound.
+func parseScoreRange(min, max string) (store.ScoreBound, store.ScoreBound, *resp.Value) {
+	lo, ok1 := parseScoreBound(min)
+	hi, ok2 := parseScoreBound(max)
+	if !ok1 || !ok2 {
+		errResp := respError("ERR min or max is not a float")
+		return lo, hi, &errResp
+	}
+	return lo, hi, nil
+}
+
+// parseScoreBound parses one end of a score range.
+func parseScoreBound(s string) (store.ScoreBound, bool) {
+	var bound store.ScoreBound
+	if strings.HasPrefix(s, "(") {
+		bound.Exclusive = true
+		s = s[1:]
+	}
+	score, ok := parseScore(s)
+	bound.Value = score
+	return bound, ok
+}
+
+// parseLexRange parses the bounds of a lexicographic range.
+func parseLexRange(min, max string) (store.LexBound, store.LexBound, *resp.Value) {
+	lo, ok1 := parseLexBound(min)
+	hi, ok2 := parseLexBound(max)
+	if !ok1 || !ok2 {
+		errResp := respError("ERR min or max not valid string range item")
+		return lo, hi, &errResp
+	}
+	return lo, hi, nil
+}
+
+// parseLexBound parses one end of a lexicographic range: "-", "+", "[value" or "(value".
+func parseLexBound(s string) (store.LexBound, bool) {
+	switch {
+	case s == "-":
+		return store.LexBound{Inf: -1}, true
+	case s == "+":
+		return store.LexBound{Inf: 1}, true
+	case strings.HasPrefix(s, "["):
+		return store.LexBound{Value: s[1:]}, true
+	case strings.HasPrefix(s, "("):
+		return store.LexBound{Value: s[1:], Exclusive: true}, true
+	}
+	return store.LexBound{}, false
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/scotro/mini-redis/internal/resp"
+)
+
+// bulkStrings returns the strings of an array reply, with "<nil>" for null entries.
+func bulkStrings(v resp.Value) []string {
+	result := make([]string, len(v.Array))
+	for i, item := range v.Array {
+		if item.Null {
+			result[i] = "<nil>"
+		} else {
+			result[i] = item.Str
+		}
+	}
+	return result
+}
+
+func TestHandleZAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    resp.Value
+		members []string // ZRANGE z 0 -1 WITHSCORES afterwards
+	}{
+		{"add", []string{"2", "b", "3", "c"}, respInteger(2), []string{"a", "1", "b", "2", "c", "3"}},
+		{"update", []string{"5", "a"}, respInteger(0), []string{"a", "5"}},
+		{"CH counts updates", []string{"CH", "5", "a", "2", "b"}, respInteger(2), []string{"b", "2", "a", "5"}},
+		{"NX", []string{"NX", "5", "a", "2", "b"}, respInteger(1), []string{"a", "1", "b", "2"}},
+		{"XX", []string{"XX", "5", "a", "2", "b"}, respInteger(0), []string{"a", "5"}},
+		{"GT CH", []string{"GT", "CH", "0", "a"}, respInteger(0), []string{"a", "1"}},
+		{"LT CH", []string{"LT", "CH", "0", "a"}, respInteger(1), []string{"a", "0"}},
+		{"INCR", []string{"INCR", "2.5", "a"}, respBulkString("3.5"), []string{"a", "3.5"}},
+		{"INCR NX blocked", []string{"NX", "INCR", "1", "a"}, respNullBulkString(), []string{"a", "1"}},
+		{"inf score", []string{"+inf", "a"}, respInteger(0), []string{"a", "inf"}},
+		{"missing member", []string{"1"}, respError("ERR wrong number of arguments for 'zadd' command"), []string{"a", "1"}},
+		{"odd pairs", []string{"1", "a", "2"}, respError("ERR syntax error"), []string{"a", "1"}},
+		{"NX and XX", []string{"NX", "XX", "1", "a"}, respError("ERR XX and NX options at the same time are not compatible"), []string{"a", "1"}},
+		{"GT and LT", []string{"GT", "LT", "1", "a"}, respError("ERR GT, LT, and/or NX options at the same time are not compatible"), []string{"a", "1"}},
+		{"INCR with pairs", []string{"INCR", "1", "a", "2", "b"}, respError("ERR INCR option supports a single increment-element pair"), []string{"a", "1"}},
+		{"bad score", []string{"abc", "a"}, respError("ERR value is not a valid float"), []string{"a", "1"}},
+		{"nan score", []string{"nan", "a"}, respError("ERR value is not a valid float"), []string{"a", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := createTestServer(t)
+			runCommand(srv, "ZADD", "z", "1", "a")
+
+			got := runCommand(srv, append([]string{"ZADD", "z"}, tt.args...)...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ZADD z %v = %v, want %v", tt.args, got, tt.want)
+			}
+
+			members := bulkStrings(runCommand(srv, "ZRANGE", "z", "0", "-1", "WITHSCORES"))
+			if !reflect.DeepEqual(members, tt.members) {
+				t.Errorf("ZRANGE WITHSCORES = %v, want %v", members, tt.members)
+			}
+		})
+	}
+}
+
+func TestHandleZScoreAndCard(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "ZADD", "z", "1.5", "a", "2", "b")
+
+	if got := runCommand(srv, "ZSCORE", "z", "a"); got.Str != "1.5" {
+		t.Errorf("ZSCORE z a = %v, want 1.5", got)
+	}
+	if got := runCommand(srv, "ZSCORE", "z", "missing"); !got.Null {
+		t.Errorf("ZSCORE z missing = %v, want nil", got)
+	}
+	if got := bulkStrings(runCommand(srv, "ZMSCORE", "z", "a", "missing", "b")); !reflect.DeepEqual(got, []string{"1.5", "<nil>", "2"}) {
+		t.Errorf("ZMSCORE = %v", got)
+	}
+	if got := runCommand(srv, "ZINCRBY", "z", "-0.5", "a"); got.Str != "1" {
+		t.Errorf("ZINCRBY = %v, want 1", got)
+	}
+	if got := runCommand(srv, "ZCARD", "z"); got.Num != 2 {
+		t.Errorf("ZCARD = %v, want 2", got)
+	}
+	if got := runCommand(srv, "ZREM", "z", "a", "missing"); got.Num != 1 {
+		t.Errorf("ZREM = %v, want 1", got)
+	}
+	if got := runCommand(srv, "ZCARD", "missing"); got.Num != 0 {
+		t.Errorf("ZCARD missing = %v, want 0", got)
+	}
+}
+
+func TestHandleZCountAndRank(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "ZADD", "z", "1", "a", "2", "b", "3", "c")
+
+	tests := []struct {
+		args []string
+		want resp.Value
+	}{
+		{[]string{"ZCOUNT", "z", "-inf", "+inf"}, respInteger(3)},
+		{[]string{"ZCOUNT", "z", "(1", "3"}, respInteger(2)},
+		{[]string{"ZCOUNT", "z", "x", "3"}, respError("ERR min or max is not a float")},
+		{[]string{"ZRANK", "z", "c"}, respInteger(2)},
+		{[]string{"ZREVRANK", "z", "c"}, respInteger(0)},
+		{[]string{"ZRANK", "z", "missing"}, respNullBulkString()},
+		{[]string{"ZRANK", "z", "b", "WITHSCORE"}, resp.Value{Type: resp.TypeArray, Array: []resp.Value{respInteger(1), respBulkString("2")}}},
+		{[]string{"ZRANK", "z", "missing", "WITHSCORE"}, resp.Value{Type: resp.TypeArray, Null: true}},
+	}
+
+	for _, tt := range tests {
+		if got := runCommand(srv, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleZRange(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	runCommand(srv, "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"rank", []string{"z", "0", "-1"}, []string{"a", "b", "c", "d"}},
+		{"rank rev", []string{"z", "0", "1", "REV"}, []string{"d", "c"}},
+		{"withscores", []string{"z", "0", "0", "WITHSCORES"}, []string{"a", "1"}},
+		{"byscore", []string{"z", "(1", "3", "BYSCORE"}, []string{"b", "c"}},
+		{"byscore rev", []string{"z", "3", "-inf", "BYSCORE", "REV"}, []string{"c", "b", "a"}},
+		{"byscore limit", []string{"z", "-inf", "+inf", "BYSCORE", "LIMIT", "1", "2"}, []string{"b", "c"}},
+		{"byscore negative count", []string{"z", "-inf", "+inf", "BYSCORE", "LIMIT", "2", "-1"}, []string{"c", "d"}},
+		{"bylex", []string{"lex", "[b", "+", "BYLEX"}, []string{"b", "c", "d"}},
+		{"bylex rev limit", []string{"lex", "(c", "-", "BYLEX", "REV", "LIMIT", "0", "1"}, []string{"b"}},
+		{"missing key", []string{"missing", "0", "-1"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runCommand(srv, append([]string{"ZRANGE"}, tt.args...)...)
+			if got.Type != resp.TypeArray {
+				t.Fatalf("ZRANGE %v = %v, want array", tt.args, got)
+			}
+			if members := bulkStrings(got); !reflect.DeepEqual(members, tt.want) {
+				t.Errorf("ZRANGE %v = %v, want %v", tt.args, members, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleZRangeErrors(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "ZADD", "z", "1", "a")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"z", "0"}, "ERR wrong number of arguments for 'zrange' command"},
+		{[]string{"z", "0", "-1", "LIMIT", "0", "1"}, "ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"},
+		{[]string{"z", "-", "+", "BYLEX", "WITHSCORES"}, "ERR syntax error, WITHSCORES not supported in combination with BYLEX"},
+		{[]string{"z", "0", "-1", "BOGUS"}, "ERR syntax error"},
+		{[]string{"z", "a", "b"}, "ERR value is not an integer or out of range"},
+		{[]string{"z", "a", "b", "BYSCORE"}, "ERR min or max is not a float"},
+		{[]string{"z", "a", "b", "BYLEX"}, "ERR min or max not valid string range item"},
+	}
+
+	for _, tt := range tests {
+		got := runCommand(srv, append([]string{"ZRANGE"}, tt.args...)...)
+		if got.Type != resp.TypeError || got.Str != tt.want {
+			t.Errorf("ZRANGE %v = %v, want error %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHandleZRangeStore(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "ZADD", "src", "1", "a", "2", "b", "3", "c")
+	runCommand(srv, "SET", "dst", "string")
+
+	if got := runCommand(srv, "ZRANGESTORE", "dst", "src", "2", "+inf", "BYSCORE"); got.Num != 2 {
+		t.Fatalf("ZRANGESTORE = %v, want 2", got)
+	}
+	if got := runCommand(srv, "TYPE", "dst"); got.Str != "zset" {
+		t.Errorf("TYPE dst = %v, want zset", got)
+	}
+	if got := bulkStrings(runCommand(srv, "ZRANGE", "dst", "0", "-1", "WITHSCORES")); !reflect.DeepEqual(got, []string{"b", "2", "c", "3"}) {
+		t.Errorf("ZRANGE dst = %v", got)
+	}
+
+	// An empty range deletes the destination
+	if got := runCommand(srv, "ZRANGESTORE", "dst", "src", "10", "20"); got.Num != 0 {
+		t.Fatalf("ZRANGESTORE empty = %v, want 0", got)
+	}
+	if got := runCommand(srv, "EXISTS", "dst"); got.Num != 0 {
+		t.Errorf("EXISTS dst after empty ZRANGESTORE = %v, want 0", got)
+	}
+
+	if got := runCommand(srv, "ZRANGESTORE", "dst", "src", "0", "-1", "WITHSCORES"); got.Str != "ERR syntax error" {
+		t.Errorf("ZRANGESTORE WITHSCORES = %v, want syntax error", got)
+	}
+}
+
+func TestHandleZPop(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "ZADD", "z", "1", "a", "2", "b", "3", "c")
+
+	if got := bulkStrings(runCommand(srv, "ZPOPMIN", "z")); !reflect.DeepEqual(got, []string{"a", "1"}) {
+		t.Errorf("ZPOPMIN = %v", got)
+	}
+	if got := bulkStrings(runCommand(srv, "ZPOPMAX", "z", "5")); !reflect.DeepEqual(got, []string{"c", "3", "b", "2"}) {
+		t.Errorf("ZPOPMAX 5 = %v", got)
+	}
+	if got := runCommand(srv, "ZPOPMIN", "z"); got.Type != resp.TypeArray || len(got.Array) != 0 {
+		t.Errorf("ZPOPMIN on missing key = %v, want empty array", got)
+	}
+	if got := runCommand(srv, "ZPOPMIN", "z", "-1"); got.Str != "ERR value is out of range, must be positive" {
+		t.Errorf("ZPOPMIN -1 = %v", got)
+	}
+}
+
+func TestHandleZRemRange(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+		left []string
+	}{
+		{[]string{"ZREMRANGEBYRANK", "z", "0", "1"}, 2, []string{"c", "d"}},
+		{[]string{"ZREMRANGEBYRANK", "z", "-1", "-1"}, 1, []string{"a", "b", "c"}},
+		{[]string{"ZREMRANGEBYSCORE", "z", "(1", "3"}, 2, []string{"a", "d"}},
+		{[]string{"ZREMRANGEBYLEX", "z", "[b", "(d"}, 2, []string{"a", "d"}},
+	}
+
+	for _, tt := range tests {
+		srv := createTestServer(t)
+		runCommand(srv, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+		if tt.args[0] == "ZREMRANGEBYLEX" {
+			runCommand(srv, "ZADD", "z", "0", "a", "0", "b", "0", "c", "0", "d")
+		}
+
+		if got := runCommand(srv, tt.args...); got.Num != tt.want {
+			t.Errorf("%v = %v, want %d", tt.args, got, tt.want)
+		}
+		if got := bulkStrings(runCommand(srv, "ZRANGE", "z", "0", "-1")); !reflect.DeepEqual(got, tt.left) {
+			t.Errorf("after %v: ZRANGE = %v, want %v", tt.args, got, tt.left)
+		}
+	}
+}
+
+func TestZSetWrongType(t *testing.T) {
+	srv := createTestServer(t)
+	runCommand(srv, "SET", "str", "v")
+	runCommand(srv, "ZADD", "z", "1", "a")
+
+	for _, args := range [][]string{
+		{"ZADD", "str", "1", "a"},
+		{"ZSCORE", "str", "a"},
+		{"ZRANGE", "str", "0", "-1"},
+		{"ZRANGESTORE", "dst", "str", "0", "-1"},
+		{"ZPOPMIN", "str"},
+	} {
+		if got := runCommand(srv, args...); got.Type != resp.TypeError || got.Str != "WRONGTYPE Operation against a key holding the wrong kind of value" {
+			t.Errorf("%v = %v, want WRONGTYPE", args, got)
+		}
+	}
+
+	if got := runCommand(srv, "GET", "z"); got.Type != resp.TypeError {
+		t.Errorf("GET on zset = %v, want WRONGTYPE", got)
+	}
+	if got := runCommand(srv, "TYPE", "z"); got.Str != "zset" {
+		t.Errorf("TYPE z = %v, want zset", got)
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{1, "1"},
+		{1.5, "1.5"},
+		{-2.25, "-2.25"},
+		{1000000, "1000000"},
+		{0.1, "0.1"},
+		{1e30, "1e+30"},
+	}
+	for _, tt := range tests {
+		if got := formatScore(tt.in); got != tt.want {
+			t.Errorf("formatScore(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
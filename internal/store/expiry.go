@@ -0,0 +1,284 @@
+// Package store provides key expiration shared by all data types.
+package store
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cleanupInterval is how often stores run an active expiry cycle.
+const cleanupInterval = 100 * time.Millisecond
+
+// Expirable is implemented by stores whose keys can be given a time to live.
+type Expirable interface {
+	// Expire sets the time at which key expires.
+	// A time that is not in the future deletes the key immediately.
+	// Returns false if the key doesn't exist.
+	Expire(key string, at time.Time) bool
+
+	// Persist removes the expiration of key.
+	// Returns false if the key doesn't exist or has no expiration.
+	Persist(key string) bool
+
+	// ExpiresAt returns the time at which key expires.
+	// Returns false if the key doesn't exist or has no expiration.
+	ExpiresAt(key string) (time.Time, bool)
+}
+
+// ExpiryConfig tunes active expiration.
+//
+// Every cleanupInterval a store samples SampleSize random keys that have a
+// TTL and deletes the expired ones. While more than StaleThreshold of a sample
+// was expired, it samples again, until the cycle has run for CycleBudget.
+// Zero fields take their value from DefaultExpiryConfig.
+type ExpiryConfig struct {
+	SampleSize     int
+	StaleThreshold float64
+	CycleBudget    time.Duration
+}
+
+// DefaultExpiryConfig returns the active expiration settings Redis uses.
+func DefaultExpiryConfig() ExpiryConfig {
+	return ExpiryConfig{
+		SampleSize:     20,
+		StaleThreshold: 0.1,
+		CycleBudget:    25 * time.Millisecond,
+	}
+}
+
+// withDefaults fills zero fields from DefaultExpiryConfig.
+func (c ExpiryConfig) withDefaults() ExpiryConfig {
+	def := DefaultExpiryConfig()
+	if c.SampleSize <= 0 {
+		c.SampleSize = def.SampleSize
+	}
+	if c.StaleThreshold <= 0 {
+		c.StaleThreshold = def.StaleThreshold
+	}
+	if c.CycleBudget <= 0 {
+		c.CycleBudget = def.CycleBudget
+	}
+	return c
+}
+
+// ExpiryStats reports expiration activity.
+type ExpiryStats struct {
+	// ExpiredKeys is the number of keys deleted because their TTL passed,
+	// whether found by a lookup or by active expiry.
+	ExpiredKeys int64
+
+	// StaleRatio estimates the fraction of volatile keys that are expired
+	// but not yet deleted. It is a moving average over active expiry samples.
+	StaleRatio float64
+
+	// VolatileKeys is the number of keys with a TTL.
+	VolatileKeys int64
+}
+
+// ExpiryTuner is implemented by stores whose active expiration can be tuned and observed.
+type ExpiryTuner interface {
+	SetExpiryConfig(cfg ExpiryConfig)
+	ExpiryStats() ExpiryStats
+}
+
+// volatileKey is a key with a TTL.
+type volatileKey struct {
+	key string
+	at  time.Time
+}
+
+// expiryIndex holds the expiration times of a store's volatile keys.
+// Keys are kept in a slice as well as a map so active expiry can sample them
+// at random in constant time instead of scanning the whole store.
+//
+// The index itself is guarded by the owning store's lock; the statistics and
+// configuration are safe to use without it.
+type expiryIndex struct {
+	pos  map[string]int
+	keys []volatileKey
+
+	config     atomic.Pointer[ExpiryConfig]
+	expired    atomic.Int64
+	volatile   atomic.Int64  // len(keys), readable without the store's lock
+	staleRatio atomic.Uint64 // float64 bits
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// newExpiryIndex creates an empty index with the default configuration.
+func newExpiryIndex() *expiryIndex {
+	e := &expiryIndex{
+		pos:  make(map[string]int),
+		done: make(chan struct{}),
+	}
+	e.setConfig(ExpiryConfig{})
+	return e
+}
+
+// get returns the expiration time of key.
+func (e *expiryIndex) get(key string) (time.Time, bool) {
+	i, ok := e.pos[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.keys[i].at, true
+}
+
+// set records the expiration time of key.
+func (e *expiryIndex) set(key string, at time.Time) {
+	if i, ok := e.pos[key]; ok {
+		e.keys[i].at = at
+		return
+	}
+	e.pos[key] = len(e.keys)
+	e.keys = append(e.keys, volatileKey{key: key, at: at})
+	e.volatile.Store(int64(len(e.keys)))
+}
+
+// remove forgets the expiration time of key, if any.
+func (e *expiryIndex) remove(key string) {
+	i, ok := e.pos[key]
+	if !ok {
+		return
+	}
+	last := len(e.keys) - 1
+	if i != last {
+		e.keys[i] = e.keys[last]
+		e.pos[e.keys[i].key] = i
+	}
+	e.keys[last] = volatileKey{}
+	e.keys = e.keys[:last]
+	delete(e.pos, key)
+	e.volatile.Store(int64(len(e.keys)))
+}
+
+// clear forgets all expiration times.
+func (e *expiryIndex) clear() {
+	e.pos = make(map[string]int)
+	e.keys = nil
+	e.volatile.Store(0)
+}
+
+// len returns the number of volatile keys.
+func (e *expiryIndex) len() int {
+	return len(e.keys)
+}
+
+// isExpired returns true if key has an expiration time that is not after now.
+func (e *expiryIndex) isExpired(key string, now time.Time) bool {
+	at, ok := e.get(key)
+	return ok && !now.Before(at)
+}
+
+// restore sets or clears the expiration of an imported key.
+func (e *expiryIndex) restore(key string, at time.Time, volatile bool) {
+	if volatile {
+		e.set(key, at)
+	} else {
+		e.remove(key)
+	}
+}
+
+// unixMilli returns the expiration time of key in Unix milliseconds for
+// export, or 0 if it has none.
+func (e *expiryIndex) unixMilli(key string) int64 {
+	at, ok := e.get(key)
+	if !ok {
+		return 0
+	}
+	return at.UnixMilli()
+}
+
+// countExpired records that a key was deleted because it expired.
+func (e *expiryIndex) countExpired() {
+	e.expired.Add(1)
+}
+
+// setConfig replaces the active expiry configuration.
+func (e *expiryIndex) setConfig(cfg ExpiryConfig) {
+	cfg = cfg.withDefaults()
+	e.config.Store(&cfg)
+}
+
+// stats returns the expiration statistics.
+func (e *expiryIndex) stats() ExpiryStats {
+	return ExpiryStats{
+		ExpiredKeys:  e.expired.Load(),
+		StaleRatio:   math.Float64frombits(e.staleRatio.Load()),
+		VolatileKeys: e.volatile.Load(),
+	}
+}
+
+// start runs an active expiry cycle every cleanupInterval until stop is called.
+// The goroutine is started the first time a key is given an expiration, so
+// stores that never use TTLs don't pay for it. Calling start more than once
+// has no effect.
+func (e *expiryIndex) start(mu sync.Locker, expireKey func(key string)) {
+	e.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(cleanupInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-e.done:
+					return
+				case <-ticker.C:
+					e.cycle(mu, expireKey)
+				}
+			}
+		}()
+	})
+}
+
+// stop ends the active expiry goroutine. It is safe to call more than once.
+func (e *expiryIndex) stop() {
+	e.stopOnce.Do(func() {
+		close(e.done)
+	})
+}
+
+// cycle samples random volatile keys and deletes the expired ones with
+// expireKey. It keeps sampling while the share of expired keys in a sample is
+// above the stale threshold and the cycle budget isn't spent. The store lock
+// is taken per sample, so clients are never stalled for a whole cycle.
+func (e *expiryIndex) cycle(mu sync.Locker, expireKey func(key string)) {
+	cfg := e.config.Load()
+	start := time.Now()
+
+	for {
+		mu.Lock()
+		sampled := min(cfg.SampleSize, len(e.keys))
+		expired := 0
+		now := time.Now()
+		for i := 0; i < sampled && len(e.keys) > 0; i++ {
+			vk := e.keys[rand.IntN(len(e.keys))]
+			if !now.Before(vk.at) {
+				expireKey(vk.key)
+				expired++
+			}
+		}
+		mu.Unlock()
+
+		if sampled == 0 {
+			return
+		}
+
+		ratio := float64(expired) / float64(sampled)
+		e.updateStaleRatio(ratio)
+		if ratio <= cfg.StaleThreshold || time.Since(start) >= cfg.CycleBudget {
+			return
+		}
+	}
+}
+
+// updateStaleRatio folds a sample's expired ratio into the moving average.
+func (e *expiryIndex) updateStaleRatio(ratio float64) {
+	prev := math.Float64frombits(e.staleRatio.Load())
+	e.staleRatio.Store(math.Float64bits(ratio*0.05 + prev*0.95))
+}
@@ -0,0 +1,355 @@
+package store
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// expirableStore is a store under test together with helpers to create a key
+// and check whether it exists.
+type expirableStore struct {
+	name   string
+	store  Expirable
+	create func(key string)
+	exists func(key string) bool
+	keys   func() []string
+	len    func() int
+	close  func()
+}
+
+func newExpirableStores() []expirableStore {
+	strs := New()
+	lists := NewListStore()
+	hashes := NewHashStore()
+	sets := NewSetStore()
+	zsets := NewZSetStore()
+	streams := NewStreamStore()
+
+	return []expirableStore{
+		{
+			name:   "string",
+			store:  strs,
+			create: func(key string) { strs.Set(key, "v") },
+			exists: func(key string) bool { _, ok := strs.Get(key); return ok },
+			keys:   strs.Keys,
+			len:    strs.Len,
+			close:  strs.Close,
+		},
+		{
+			name:   "list",
+			store:  lists,
+			create: func(key string) { lists.RPush(key, "a") },
+			exists: func(key string) bool { return lists.LLen(key) > 0 },
+			keys:   lists.Keys,
+			len:    lists.Len,
+			close:  lists.Close,
+		},
+		{
+			name:   "hash",
+			store:  hashes,
+			create: func(key string) { hashes.HSet(key, "f", "v") },
+			exists: func(key string) bool { return hashes.HLen(key) > 0 },
+			keys:   hashes.Keys,
+			len:    hashes.Len,
+			close:  hashes.Close,
+		},
+		{
+			name:   "set",
+			store:  sets,
+			create: func(key string) { sets.SAdd(key, "m") },
+			exists: func(key string) bool { return sets.SCard(key) > 0 },
+			keys:   sets.Keys,
+			len:    sets.Len,
+			close:  sets.Close,
+		},
+		{
+			name:   "zset",
+			store:  zsets,
+			create: func(key string) { zsets.ZAdd(key, ZAddFlags{}, ZMember{Member: "m", Score: 1}) },
+			exists: func(key string) bool { return zsets.ZCard(key) > 0 },
+			keys:   zsets.Keys,
+			len:    zsets.Len,
+			close:  zsets.Close,
+		},
+		{
+			name:   "stream",
+			store:  streams,
+			create: func(key string) { streams.XAdd(key, XAddArgs{AutoID: true}, []string{"f", "v"}) },
+			exists: func(key string) bool { return streams.XLen(key) > 0 },
+			keys:   streams.Keys,
+			len:    streams.Len,
+			close:  streams.Close,
+		},
+	}
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	for _, tt := range newExpirableStores() {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+
+			at := time.Now().Add(time.Hour)
+			if tt.store.Expire("missing", at) {
+				t.Error("Expire(missing) = true, want false")
+			}
+
+			tt.create("key")
+			if _, ok := tt.store.ExpiresAt("key"); ok {
+				t.Error("ExpiresAt() on new key reported an expiration")
+			}
+			if tt.store.Persist("key") {
+				t.Error("Persist() on key without expiration = true, want false")
+			}
+
+			if !tt.store.Expire("key", at) {
+				t.Fatal("Expire() = false, want true")
+			}
+			got, ok := tt.store.ExpiresAt("key")
+			if !ok || !got.Equal(at) {
+				t.Errorf("ExpiresAt() = %v, %v, want %v, true", got, ok, at)
+			}
+
+			if !tt.store.Persist("key") {
+				t.Error("Persist() = false, want true")
+			}
+			if _, ok := tt.store.ExpiresAt("key"); ok {
+				t.Error("ExpiresAt() after Persist reported an expiration")
+			}
+			if !tt.exists("key") {
+				t.Error("key missing after Persist")
+			}
+		})
+	}
+}
+
+func TestExpireInPastDeletes(t *testing.T) {
+	for _, tt := range newExpirableStores() {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+
+			tt.create("key")
+			if !tt.store.Expire("key", time.Now().Add(-time.Second)) {
+				t.Fatal("Expire() = false, want true")
+			}
+			if tt.exists("key") {
+				t.Error("key still exists after Expire in the past")
+			}
+		})
+	}
+}
+
+func TestLen(t *testing.T) {
+	for _, tt := range newExpirableStores() {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+
+			tt.create("key")
+			tt.create("other")
+			tt.store.Expire("key", time.Now().Add(10*time.Millisecond))
+			if got := tt.len(); got != 2 {
+				t.Errorf("Len() = %d, want 2", got)
+			}
+
+			// An expired key is counted until it is deleted
+			time.Sleep(20 * time.Millisecond)
+			tt.store.Persist("key")
+			if got := tt.len(); got != 1 {
+				t.Errorf("Len() after a write to the expired key = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestLazyExpiry(t *testing.T) {
+	for _, tt := range newExpirableStores() {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+
+			tt.create("key")
+			tt.create("other")
+			tt.store.Expire("key", time.Now().Add(10*time.Millisecond))
+			time.Sleep(20 * time.Millisecond)
+
+			if tt.exists("key") {
+				t.Error("expired key still readable")
+			}
+			if _, ok := tt.store.ExpiresAt("key"); ok {
+				t.Error("ExpiresAt() reported expired key")
+			}
+			if keys := tt.keys(); len(keys) != 1 || keys[0] != "other" {
+				t.Errorf("Keys() = %v, want [other]", keys)
+			}
+
+			// Writing to an expired key starts a fresh value without the old TTL
+			tt.create("key")
+			if _, ok := tt.store.ExpiresAt("key"); ok {
+				t.Error("recreated key inherited the expired TTL")
+			}
+		})
+	}
+}
+
+func TestActiveExpiry(t *testing.T) {
+	lists := NewListStore().(*memoryListStore)
+	defer lists.Close()
+
+	lists.RPush("key", "a")
+	lists.Expire("key", time.Now().Add(10*time.Millisecond))
+	time.Sleep(cleanupInterval + 50*time.Millisecond)
+
+	lists.mu.RLock()
+	_, inData := lists.data["key"]
+	_, inExpires := lists.expires.get("key")
+	lists.mu.RUnlock()
+
+	if inData || inExpires {
+		t.Errorf("expired list not removed by active expiry (data=%v, expires=%v)", inData, inExpires)
+	}
+}
+
+func TestExpireBumpsVersion(t *testing.T) {
+	for _, tt := range newExpirableStores() {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+
+			v := NewSharedVersions(tt.store)
+			v.Watch("key")
+			tt.create("key")
+			before := v.GetVersion("key")
+
+			tt.store.Expire("key", time.Now().Add(time.Hour))
+			afterExpire := v.GetVersion("key")
+			if afterExpire == before {
+				t.Error("Expire() did not bump the version")
+			}
+
+			tt.store.Persist("key")
+			if v.GetVersion("key") == afterExpire {
+				t.Error("Persist() did not bump the version")
+			}
+		})
+	}
+}
+
+func TestExpiryIndex(t *testing.T) {
+	e := newExpiryIndex()
+	at := time.Now().Add(time.Hour)
+
+	e.set("a", at)
+	e.set("b", at)
+	e.set("c", at)
+	e.set("a", at.Add(time.Second))
+	if e.len() != 3 {
+		t.Fatalf("len() = %d, want 3", e.len())
+	}
+	if got := e.stats().VolatileKeys; got != 3 {
+		t.Errorf("VolatileKeys = %d, want 3", got)
+	}
+
+	e.remove("a")
+	e.remove("missing")
+	if e.len() != 2 {
+		t.Fatalf("len() after remove = %d, want 2", e.len())
+	}
+	if _, ok := e.get("a"); ok {
+		t.Error("get(a) found removed key")
+	}
+	for _, key := range []string{"b", "c"} {
+		if got, ok := e.get(key); !ok || !got.Equal(at) {
+			t.Errorf("get(%q) = %v, %v, want %v, true", key, got, ok, at)
+		}
+	}
+
+	if got := e.stats().VolatileKeys; got != 2 {
+		t.Errorf("VolatileKeys after remove = %d, want 2", got)
+	}
+
+	e.clear()
+	if e.len() != 0 {
+		t.Errorf("len() after clear = %d, want 0", e.len())
+	}
+	if got := e.stats().VolatileKeys; got != 0 {
+		t.Errorf("VolatileKeys after clear = %d, want 0", got)
+	}
+}
+
+// newStoreWithExpiredKeys returns a string store holding expired and live
+// volatile keys, with its background expiry stopped so cycles can be run by hand.
+func newStoreWithExpiredKeys(t *testing.T, expired, live int) *memoryStore {
+	t.Helper()
+	s := New().(*memoryStore)
+	s.Close()
+
+	for i := 0; i < expired; i++ {
+		s.SetWithTTL("expired:"+strconv.Itoa(i), "v", time.Millisecond)
+	}
+	for i := 0; i < live; i++ {
+		s.SetWithTTL("live:"+strconv.Itoa(i), "v", time.Hour)
+	}
+	time.Sleep(5 * time.Millisecond)
+	return s
+}
+
+func TestActiveExpiryCycle(t *testing.T) {
+	s := newStoreWithExpiredKeys(t, 1000, 100)
+
+	s.expires.cycle(&s.mu, s.expireKey)
+
+	stats := s.ExpiryStats()
+	if stats.ExpiredKeys < 900 {
+		t.Errorf("ExpiredKeys = %d, want at least 900", stats.ExpiredKeys)
+	}
+	if stats.StaleRatio <= 0 {
+		t.Errorf("StaleRatio = %v, want > 0", stats.StaleRatio)
+	}
+	if got := s.expires.len(); got > 200 {
+		t.Errorf("%d volatile keys left, want most expired keys removed", got)
+	}
+	if got := len(s.Keys()); got != 100 {
+		t.Errorf("Keys() returned %d keys, want 100", got)
+	}
+}
+
+func TestActiveExpiryCycleBudget(t *testing.T) {
+	s := newStoreWithExpiredKeys(t, 1000, 0)
+	s.SetExpiryConfig(ExpiryConfig{SampleSize: 10, CycleBudget: time.Nanosecond})
+
+	s.expires.cycle(&s.mu, s.expireKey)
+
+	// The budget is spent after the first sample, so at most one sample is expired
+	if got := s.ExpiryStats().ExpiredKeys; got == 0 || got > 10 {
+		t.Errorf("ExpiredKeys = %d, want between 1 and 10", got)
+	}
+}
+
+func TestActiveExpiryStopsBelowThreshold(t *testing.T) {
+	s := newStoreWithExpiredKeys(t, 0, 100)
+
+	s.expires.cycle(&s.mu, s.expireKey)
+
+	if got := s.ExpiryStats().ExpiredKeys; got != 0 {
+		t.Errorf("ExpiredKeys = %d, want 0", got)
+	}
+	if got := s.expires.len(); got != 100 {
+		t.Errorf("%d volatile keys left, want 100", got)
+	}
+}
+
+func TestLazyExpiryCountsExpiredKeys(t *testing.T) {
+	for _, tt := range newExpirableStores() {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+
+			tt.create("key")
+			tt.store.Expire("key", time.Now().Add(time.Millisecond))
+			time.Sleep(5 * time.Millisecond)
+
+			// Recreating the key deletes the expired value first
+			tt.create("key")
+			if got := tt.store.(ExpiryTuner).ExpiryStats().ExpiredKeys; got != 1 {
+				t.Errorf("ExpiredKeys = %d, want 1", got)
+			}
+		})
+	}
+}
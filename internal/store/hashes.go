@@ -3,6 +3,7 @@ package store
 
 import (
 	"sync"
+	"time"
 )
 
 // HashStore defines the interface for hash operations.
@@ -14,18 +15,29 @@ type HashStore interface {
 	HKeys(key string) []string
 	HLen(key string) int
 	KeyType(key string) string
+	Delete(key string) bool
+	Keys() []string
+	Len() int
+	Flush()
+	Close()
+	Expirable
+	ExpiryTuner
 }
 
 // MemoryHashStore is a thread-safe in-memory implementation of HashStore.
 type MemoryHashStore struct {
-	mu     sync.RWMutex
-	hashes map[string]map[string]string
+	versioned
+	snapshots[map[string]string]
+	mu      sync.RWMutex
+	hashes  map[string]map[string]string
+	expires *expiryIndex
 }
 
 // NewHashStore creates a new HashStore.
 func NewHashStore() HashStore {
 	return &MemoryHashStore{
-		hashes: make(map[string]map[string]string),
+		hashes:  make(map[string]map[string]string),
+		expires: newExpiryIndex(),
 	}
 }
 
@@ -39,6 +51,8 @@ func (s *MemoryHashStore) HSet(key string, fieldValues ...string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	hash, exists := s.hashes[key]
 	if !exists {
 		hash = make(map[string]string)
@@ -54,6 +68,7 @@ func (s *MemoryHashStore) HSet(key string, fieldValues ...string) int {
 		}
 		hash[field] = value
 	}
+	s.touch(key)
 
 	return newFields
 }
@@ -64,7 +79,7 @@ func (s *MemoryHashStore) HGet(key, field string) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	hash, exists := s.hashes[key]
+	hash, exists := s.lookup(key)
 	if !exists {
 		return "", false
 	}
@@ -79,6 +94,8 @@ func (s *MemoryHashStore) HDel(key string, fields ...string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	hash, exists := s.hashes[key]
 	if !exists {
 		return 0
@@ -95,6 +112,10 @@ func (s *MemoryHashStore) HDel(key string, fields ...string) int {
 	// Auto-delete empty hashes (Redis behavior)
 	if len(hash) == 0 {
 		delete(s.hashes, key)
+		s.expires.remove(key)
+	}
+	if deleted > 0 {
+		s.touch(key)
 	}
 
 	return deleted
@@ -106,7 +127,7 @@ func (s *MemoryHashStore) HGetAll(key string) map[string]string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	hash, exists := s.hashes[key]
+	hash, exists := s.lookup(key)
 	if !exists {
 		return make(map[string]string)
 	}
@@ -125,7 +146,7 @@ func (s *MemoryHashStore) HKeys(key string) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	hash, exists := s.hashes[key]
+	hash, exists := s.lookup(key)
 	if !exists {
 		return []string{}
 	}
@@ -143,7 +164,7 @@ func (s *MemoryHashStore) HLen(key string) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	hash, exists := s.hashes[key]
+	hash, exists := s.lookup(key)
 	if !exists {
 		return 0
 	}
@@ -156,8 +177,154 @@ func (s *MemoryHashStore) KeyType(key string) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if _, exists := s.hashes[key]; exists {
+	if _, exists := s.lookup(key); exists {
 		return "hash"
 	}
 	return "none"
 }
+
+// Flush removes all hashes from the store.
+func (s *MemoryHashStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserveAll()
+	for key := range s.hashes {
+		s.touch(key)
+	}
+	s.hashes = make(map[string]map[string]string)
+	s.expires.clear()
+}
+
+// Delete removes a hash. Returns true if the key existed.
+func (s *MemoryHashStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	_, exists := s.hashes[key]
+	if exists {
+		delete(s.hashes, key)
+		s.expires.remove(key)
+		s.touch(key)
+	}
+	return exists
+}
+
+// Keys returns the keys of all hashes in the store.
+func (s *MemoryHashStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.hashes))
+	for key := range s.hashes {
+		if !s.expires.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of keys in the store. Like Redis's DBSIZE, it counts
+// keys that have expired but haven't been deleted yet.
+func (s *MemoryHashStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.hashes)
+}
+
+// Expire sets the time at which a hash expires.
+// A time that is not in the future deletes the hash immediately.
+// Returns false if the key doesn't exist.
+func (s *MemoryHashStore) Expire(key string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, exists := s.hashes[key]; !exists {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		delete(s.hashes, key)
+		s.expires.remove(key)
+	} else {
+		s.expires.set(key, at)
+		s.expires.start(&s.mu, s.expireKey)
+	}
+	s.touch(key)
+	return true
+}
+
+// Persist removes the expiration of a hash.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemoryHashStore) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, ok := s.expires.get(key); !ok {
+		return false
+	}
+	s.expires.remove(key)
+	s.touch(key)
+	return true
+}
+
+// ExpiresAt returns the time at which a hash expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemoryHashStore) ExpiresAt(key string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); !exists {
+		return time.Time{}, false
+	}
+	return s.expires.get(key)
+}
+
+// Close stops the background cleanup goroutine.
+func (s *MemoryHashStore) Close() {
+	s.expires.stop()
+}
+
+// lookup returns the hash stored at key, treating expired hashes as missing.
+// Caller must hold s.mu.
+func (s *MemoryHashStore) lookup(key string) (map[string]string, bool) {
+	hash, exists := s.hashes[key]
+	if !exists || s.expires.isExpired(key, time.Now()) {
+		return nil, false
+	}
+	return hash, true
+}
+
+// removeIfExpired lazily deletes key if it has expired.
+// Caller must hold s.mu for writing.
+func (s *MemoryHashStore) removeIfExpired(key string) {
+	if s.expires.isExpired(key, time.Now()) {
+		s.expireKey(key)
+	}
+}
+
+// expireKey deletes a hash whose TTL has passed.
+// Caller must hold s.mu for writing.
+func (s *MemoryHashStore) expireKey(key string) {
+	delete(s.hashes, key)
+	s.expires.remove(key)
+	s.expires.countExpired()
+	s.touch(key)
+}
+
+// SetExpiryConfig tunes active expiration.
+func (s *MemoryHashStore) SetExpiryConfig(cfg ExpiryConfig) {
+	s.expires.setConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics.
+func (s *MemoryHashStore) ExpiryStats() ExpiryStats {
+	return s.expires.stats()
+}
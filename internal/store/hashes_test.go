@@ -445,3 +445,26 @@ func TestHGetAllReturnsCopy(t *testing.T) {
 		t.Errorf("HGetAll() did not return a copy, original was modified")
 	}
 }
+
+func TestHashStoreDeleteAndKeys(t *testing.T) {
+	s := NewHashStore()
+	s.HSet("hash1", "f", "v")
+	s.HSet("hash2", "f", "v")
+
+	if len(s.Keys()) != 2 {
+		t.Errorf("Keys() returned %d keys, want 2", len(s.Keys()))
+	}
+
+	if !s.Delete("hash1") {
+		t.Error("Delete(hash1) = false, want true")
+	}
+	if s.Delete("hash1") {
+		t.Error("Delete(hash1) twice = true, want false")
+	}
+	if s.HLen("hash1") != 0 {
+		t.Error("hash1 still exists after Delete")
+	}
+	if len(s.Keys()) != 1 {
+		t.Errorf("Keys() after Delete returned %d keys, want 1", len(s.Keys()))
+	}
+}
@@ -0,0 +1,278 @@
+// Package store provides the keyspace shared by all data types.
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/scotro/mini-redis/internal/glob"
+)
+
+// Type names as reported by the TYPE command.
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeList   = "list"
+	TypeHash   = "hash"
+	TypeSet    = "set"
+	TypeZSet   = "zset"
+	TypeStream = "stream"
+)
+
+// ErrWrongType is returned when an operation targets a key holding another type.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// Keyspace joins the per-type stores into a single namespace in which every key
+// holds at most one type. It answers which type a key holds and implements the
+// generic key operations (TYPE, EXISTS, DEL, KEYS, EXPIRE) across all stores.
+//
+// The typed stores don't know about each other, so checking a key's type and
+// then writing to a store is only safe when callers serialize commands, as the
+// server does with its execution lock.
+type Keyspace struct {
+	strings  Store
+	lists    ListStore
+	hashes   HashStore
+	sets     SetStore
+	zsets    ZSetStore
+	streams  StreamStore
+	versions *Versions
+}
+
+// NewKeyspace creates a keyspace over the given stores.
+// The stores are attached to a shared Versions so WATCH sees writes to any type.
+func NewKeyspace(strings Store, lists ListStore, hashes HashStore, sets SetStore, zsets ZSetStore, streams StreamStore) *Keyspace {
+	return &Keyspace{
+		strings:  strings,
+		lists:    lists,
+		hashes:   hashes,
+		sets:     sets,
+		zsets:    zsets,
+		streams:  streams,
+		versions: NewSharedVersions(strings, lists, hashes, sets, zsets, streams),
+	}
+}
+
+// Strings returns the string store.
+func (k *Keyspace) Strings() Store {
+	return k.strings
+}
+
+// Lists returns the list store.
+func (k *Keyspace) Lists() ListStore {
+	return k.lists
+}
+
+// Hashes returns the hash store.
+func (k *Keyspace) Hashes() HashStore {
+	return k.hashes
+}
+
+// Sets returns the set store.
+func (k *Keyspace) Sets() SetStore {
+	return k.sets
+}
+
+// ZSets returns the sorted set store.
+func (k *Keyspace) ZSets() ZSetStore {
+	return k.zsets
+}
+
+// Streams returns the stream store.
+func (k *Keyspace) Streams() StreamStore {
+	return k.streams
+}
+
+// Versions returns the version tracker shared by all stores.
+func (k *Keyspace) Versions() *Versions {
+	return k.versions
+}
+
+// Type returns the type of the value stored at key, or TypeNone if the key doesn't exist.
+func (k *Keyspace) Type(key string) string {
+	if _, exists := k.strings.Get(key); exists {
+		return TypeString
+	}
+	if k.lists.KeyType(key) != TypeNone {
+		return TypeList
+	}
+	if k.hashes.KeyType(key) != TypeNone {
+		return TypeHash
+	}
+	if k.sets.KeyType(key) != TypeNone {
+		return TypeSet
+	}
+	if k.zsets.KeyType(key) != TypeNone {
+		return TypeZSet
+	}
+	if k.streams.KeyType(key) != TypeNone {
+		return TypeStream
+	}
+	return TypeNone
+}
+
+// CheckType returns ErrWrongType if key exists and holds a type other than typ.
+// A missing key passes the check, since any type may create it.
+func (k *Keyspace) CheckType(key, typ string) error {
+	if t := k.Type(key); t != TypeNone && t != typ {
+		return ErrWrongType
+	}
+	return nil
+}
+
+// Overwrite removes key unless it already holds typ.
+// Commands that replace a value regardless of its type, like SET, call this before writing.
+func (k *Keyspace) Overwrite(key, typ string) {
+	if t := k.Type(key); t != TypeNone && t != typ {
+		k.Delete(key)
+	}
+}
+
+// Exists returns true if key holds a value of any type.
+func (k *Keyspace) Exists(key string) bool {
+	return k.Type(key) != TypeNone
+}
+
+// Delete removes key whatever its type. Returns true if the key existed.
+func (k *Keyspace) Delete(key string) bool {
+	deleted := k.strings.Delete(key)
+	deleted = k.lists.Delete(key) || deleted
+	deleted = k.hashes.Delete(key) || deleted
+	deleted = k.sets.Delete(key) || deleted
+	deleted = k.zsets.Delete(key) || deleted
+	deleted = k.streams.Delete(key) || deleted
+	return deleted
+}
+
+// Keys returns all keys of any type matching the glob pattern.
+func (k *Keyspace) Keys(pattern string) []string {
+	var keys []string
+	for _, storeKeys := range [][]string{
+		k.strings.Keys(),
+		k.lists.Keys(),
+		k.hashes.Keys(),
+		k.sets.Keys(),
+		k.zsets.Keys(),
+		k.streams.Keys(),
+	} {
+		for _, key := range storeKeys {
+			if glob.Match(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys
+}
+
+// Size returns the number of keys across all types.
+func (k *Keyspace) Size() int {
+	return k.strings.Len() + k.lists.Len() + k.hashes.Len() + k.sets.Len() + k.zsets.Len() + k.streams.Len()
+}
+
+// SizeByType returns the number of keys of each type, keyed by type name.
+func (k *Keyspace) SizeByType() map[string]int {
+	return map[string]int{
+		TypeString: k.strings.Len(),
+		TypeList:   k.lists.Len(),
+		TypeHash:   k.hashes.Len(),
+		TypeSet:    k.sets.Len(),
+		TypeZSet:   k.zsets.Len(),
+		TypeStream: k.streams.Len(),
+	}
+}
+
+// Flush removes every key of every type.
+func (k *Keyspace) Flush() {
+	k.strings.Flush()
+	k.lists.Flush()
+	k.hashes.Flush()
+	k.sets.Flush()
+	k.zsets.Flush()
+	k.streams.Flush()
+}
+
+// expirable returns the store holding key, or nil if the key doesn't exist.
+func (k *Keyspace) expirable(key string) Expirable {
+	switch k.Type(key) {
+	case TypeString:
+		return k.strings
+	case TypeList:
+		return k.lists
+	case TypeHash:
+		return k.hashes
+	case TypeSet:
+		return k.sets
+	case TypeZSet:
+		return k.zsets
+	case TypeStream:
+		return k.streams
+	}
+	return nil
+}
+
+// Expire sets the time at which key expires, whatever its type.
+// A time that is not in the future deletes the key immediately.
+// Returns false if the key doesn't exist.
+func (k *Keyspace) Expire(key string, at time.Time) bool {
+	s := k.expirable(key)
+	if s == nil {
+		return false
+	}
+	return s.Expire(key, at)
+}
+
+// Persist removes the expiration of key.
+// Returns false if the key doesn't exist or has no expiration.
+func (k *Keyspace) Persist(key string) bool {
+	s := k.expirable(key)
+	if s == nil {
+		return false
+	}
+	return s.Persist(key)
+}
+
+// ExpiresAt returns the time at which key expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (k *Keyspace) ExpiresAt(key string) (time.Time, bool) {
+	s := k.expirable(key)
+	if s == nil {
+		return time.Time{}, false
+	}
+	return s.ExpiresAt(key)
+}
+
+// SetExpiryConfig tunes active expiration in every store.
+func (k *Keyspace) SetExpiryConfig(cfg ExpiryConfig) {
+	k.strings.SetExpiryConfig(cfg)
+	k.lists.SetExpiryConfig(cfg)
+	k.hashes.SetExpiryConfig(cfg)
+	k.sets.SetExpiryConfig(cfg)
+	k.zsets.SetExpiryConfig(cfg)
+	k.streams.SetExpiryConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics across all stores.
+// StaleRatio is the highest ratio reported by any store.
+func (k *Keyspace) ExpiryStats() ExpiryStats {
+	var total ExpiryStats
+	for _, s := range []ExpiryTuner{k.strings, k.lists, k.hashes, k.sets, k.zsets, k.streams} {
+		stats := s.ExpiryStats()
+		total.ExpiredKeys += stats.ExpiredKeys
+		total.VolatileKeys += stats.VolatileKeys
+		total.StaleRatio = max(total.StaleRatio, stats.StaleRatio)
+	}
+	return total
+}
+
+// Close stops the background cleanup of every store.
+func (k *Keyspace) Close() {
+	k.strings.Close()
+	k.lists.Close()
+	k.hashes.Close()
+	k.sets.Close()
+	k.zsets.Close()
+	k.streams.Close()
+}
@@ -0,0 +1,228 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestKeyspace(t *testing.T) *Keyspace {
+	t.Helper()
+	strs := New()
+	t.Cleanup(strs.Close)
+	return NewKeyspace(strs, NewListStore(), NewHashStore(), NewSetStore(), NewZSetStore(), NewStreamStore())
+}
+
+func TestKeyspaceType(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().Set("str", "v")
+	ks.Lists().RPush("list", "a")
+	ks.Hashes().HSet("hash", "f", "v")
+	ks.Sets().SAdd("set", "m")
+	ks.ZSets().ZAdd("zset", ZAddFlags{}, ZMember{Member: "m", Score: 1})
+	ks.Streams().XAdd("stream", XAddArgs{AutoID: true}, []string{"f", "v"})
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"str", TypeString},
+		{"list", TypeList},
+		{"hash", TypeHash},
+		{"set", TypeSet},
+		{"zset", TypeZSet},
+		{"stream", TypeStream},
+		{"missing", TypeNone},
+	}
+
+	for _, tt := range tests {
+		if got := ks.Type(tt.key); got != tt.want {
+			t.Errorf("Type(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKeyspaceTypeExpiredString(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().SetWithTTL("str", "v", time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	if got := ks.Type("str"); got != TypeNone {
+		t.Errorf("Type(expired) = %q, want %q", got, TypeNone)
+	}
+}
+
+func TestKeyspaceCheckType(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().Set("str", "v")
+	ks.Lists().RPush("list", "a")
+	ks.Hashes().HSet("hash", "f", "v")
+	ks.Sets().SAdd("set", "m")
+
+	types := []string{TypeString, TypeList, TypeHash, TypeSet}
+	keys := map[string]string{TypeString: "str", TypeList: "list", TypeHash: "hash", TypeSet: "set"}
+
+	// Every key must fail the check for every type but its own
+	for _, held := range types {
+		for _, want := range types {
+			err := ks.CheckType(keys[held], want)
+			if held == want && err != nil {
+				t.Errorf("CheckType(%s key, %s) = %v, want nil", held, want, err)
+			}
+			if held != want && err != ErrWrongType {
+				t.Errorf("CheckType(%s key, %s) = %v, want ErrWrongType", held, want, err)
+			}
+		}
+		if err := ks.CheckType("missing", held); err != nil {
+			t.Errorf("CheckType(missing, %s) = %v, want nil", held, err)
+		}
+	}
+}
+
+func TestKeyspaceOverwrite(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Lists().RPush("key", "a")
+	ks.Overwrite("key", TypeString)
+	if ks.Lists().LLen("key") != 0 {
+		t.Error("Overwrite did not remove the list")
+	}
+
+	ks.Strings().Set("key", "v")
+	ks.Overwrite("key", TypeString)
+	if _, ok := ks.Strings().Get("key"); !ok {
+		t.Error("Overwrite removed a key that already had the requested type")
+	}
+}
+
+func TestKeyspaceExistsAndDelete(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().Set("str", "v")
+	ks.Lists().RPush("list", "a")
+	ks.Hashes().HSet("hash", "f", "v")
+	ks.Sets().SAdd("set", "m")
+
+	for _, key := range []string{"str", "list", "hash", "set"} {
+		if !ks.Exists(key) {
+			t.Errorf("Exists(%q) = false, want true", key)
+		}
+		if !ks.Delete(key) {
+			t.Errorf("Delete(%q) = false, want true", key)
+		}
+		if ks.Exists(key) {
+			t.Errorf("Exists(%q) after Delete = true, want false", key)
+		}
+		if ks.Delete(key) {
+			t.Errorf("second Delete(%q) = true, want false", key)
+		}
+	}
+}
+
+func TestKeyspaceKeys(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().Set("user:1", "v")
+	ks.Lists().RPush("user:2", "a")
+	ks.Hashes().HSet("user:3", "f", "v")
+	ks.Sets().SAdd("session:1", "m")
+
+	keys := ks.Keys("user:*")
+	sort.Strings(keys)
+	want := []string{"user:1", "user:2", "user:3"}
+	if len(keys) != len(want) {
+		t.Fatalf("Keys(user:*) = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("Keys(user:*)[%d] = %q, want %q", i, keys[i], want[i])
+		}
+	}
+
+	if got := ks.Keys("*"); len(got) != 4 {
+		t.Errorf("Keys(*) returned %d keys, want 4", len(got))
+	}
+	if got := ks.Keys("nomatch*"); got == nil || len(got) != 0 {
+		t.Errorf("Keys(nomatch*) = %v, want empty slice", got)
+	}
+	if got := ks.Size(); got != 4 {
+		t.Errorf("Size() = %d, want 4", got)
+	}
+	wantSizes := map[string]int{TypeString: 1, TypeList: 1, TypeHash: 1, TypeSet: 1, TypeZSet: 0, TypeStream: 0}
+	if got := ks.SizeByType(); !reflect.DeepEqual(got, wantSizes) {
+		t.Errorf("SizeByType() = %v, want %v", got, wantSizes)
+	}
+}
+
+func TestKeyspaceFlush(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().Set("str", "v")
+	ks.Lists().RPush("list", "a")
+	ks.Hashes().HSet("hash", "f", "v")
+	ks.Sets().SAdd("set", "m")
+
+	ks.Flush()
+
+	if got := ks.Size(); got != 0 {
+		t.Errorf("Size() after Flush = %d, want 0", got)
+	}
+}
+
+func TestKeyspaceSharesVersions(t *testing.T) {
+	ks := newTestKeyspace(t)
+	ks.Versions().Watch("key")
+
+	ks.Lists().RPush("key", "a")
+	listVersion := ks.Versions().GetVersion("key")
+	if listVersion == 0 {
+		t.Fatal("list write did not bump the shared version")
+	}
+
+	ks.Delete("key")
+	ks.Sets().SAdd("key", "m")
+	if ks.Versions().GetVersion("key") == listVersion {
+		t.Error("set write did not bump the shared version")
+	}
+}
+
+func TestKeyspaceExpire(t *testing.T) {
+	ks := newTestKeyspace(t)
+
+	ks.Strings().Set("str", "v")
+	ks.Lists().RPush("list", "a")
+	ks.Hashes().HSet("hash", "f", "v")
+	ks.Sets().SAdd("set", "m")
+
+	at := time.Now().Add(time.Hour)
+	for _, key := range []string{"str", "list", "hash", "set"} {
+		if !ks.Expire(key, at) {
+			t.Errorf("Expire(%q) = false, want true", key)
+		}
+		if got, ok := ks.ExpiresAt(key); !ok || !got.Equal(at) {
+			t.Errorf("ExpiresAt(%q) = %v, %v, want %v, true", key, got, ok, at)
+		}
+		if got := ks.ExpiryStats().VolatileKeys; got != 1 {
+			t.Errorf("VolatileKeys with %q expiring = %d, want 1", key, got)
+		}
+		if !ks.Persist(key) {
+			t.Errorf("Persist(%q) = false, want true", key)
+		}
+	}
+
+	if ks.Expire("missing", at) {
+		t.Error("Expire(missing) = true, want false")
+	}
+	if ks.Persist("missing") {
+		t.Error("Persist(missing) = true, want false")
+	}
+
+	ks.Expire("list", time.Now().Add(-time.Second))
+	if ks.Exists("list") {
+		t.Error("list still exists after Expire in the past")
+	}
+}
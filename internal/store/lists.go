@@ -3,6 +3,7 @@ package store
 
 import (
 	"sync"
+	"time"
 )
 
 // ListStore defines the interface for list operations.
@@ -11,21 +12,35 @@ type ListStore interface {
 	RPush(key string, values ...string) int
 	LPop(key string) (string, bool)
 	RPop(key string) (string, bool)
+	LPopCount(key string, count int) []string
+	RPopCount(key string, count int) []string
+	LMove(source, destination string, fromLeft, toLeft bool) (string, bool)
 	LRange(key string, start, stop int) []string
 	LLen(key string) int
 	KeyType(key string) string
+	Delete(key string) bool
+	Keys() []string
+	Len() int
+	Flush()
+	Close()
+	Expirable
+	ExpiryTuner
 }
 
 // memoryListStore is a thread-safe in-memory implementation of ListStore.
 type memoryListStore struct {
-	mu   sync.RWMutex
-	data map[string][]string
+	versioned
+	snapshots[[]string]
+	mu      sync.RWMutex
+	data    map[string][]string
+	expires *expiryIndex
 }
 
 // NewListStore creates a new ListStore.
 func NewListStore() ListStore {
 	return &memoryListStore{
-		data: make(map[string][]string),
+		data:    make(map[string][]string),
+		expires: newExpiryIndex(),
 	}
 }
 
@@ -36,6 +51,8 @@ func (s *memoryListStore) LPush(key string, values ...string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	list, exists := s.data[key]
 	if !exists {
 		list = make([]string, 0, len(values))
@@ -50,6 +67,7 @@ func (s *memoryListStore) LPush(key string, values ...string) int {
 	copy(newList[len(values):], list)
 
 	s.data[key] = newList
+	s.touch(key)
 	return len(newList)
 }
 
@@ -58,6 +76,8 @@ func (s *memoryListStore) RPush(key string, values ...string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	list, exists := s.data[key]
 	if !exists {
 		list = make([]string, 0, len(values))
@@ -65,6 +85,7 @@ func (s *memoryListStore) RPush(key string, values ...string) int {
 
 	list = append(list, values...)
 	s.data[key] = list
+	s.touch(key)
 	return len(list)
 }
 
@@ -74,6 +95,8 @@ func (s *memoryListStore) LPop(key string) (string, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	list, exists := s.data[key]
 	if !exists || len(list) == 0 {
 		return "", false
@@ -85,9 +108,11 @@ func (s *memoryListStore) LPop(key string) (string, bool) {
 	// Delete empty lists (Redis behavior)
 	if len(list) == 0 {
 		delete(s.data, key)
+		s.expires.remove(key)
 	} else {
 		s.data[key] = list
 	}
+	s.touch(key)
 
 	return value, true
 }
@@ -98,6 +123,8 @@ func (s *memoryListStore) RPop(key string) (string, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	list, exists := s.data[key]
 	if !exists || len(list) == 0 {
 		return "", false
@@ -109,13 +136,90 @@ func (s *memoryListStore) RPop(key string) (string, bool) {
 	// Delete empty lists (Redis behavior)
 	if len(list) == 0 {
 		delete(s.data, key)
+		s.expires.remove(key)
 	} else {
 		s.data[key] = list
 	}
+	s.touch(key)
 
 	return value, true
 }
 
+// LPopCount removes and returns up to count elements from the head of the list.
+// Returns nil if the list is empty or doesn't exist.
+func (s *memoryListStore) LPopCount(key string, count int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.popCount(key, count, true)
+}
+
+// RPopCount removes and returns up to count elements from the tail of the list,
+// last element first. Returns nil if the list is empty or doesn't exist.
+func (s *memoryListStore) RPopCount(key string, count int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.popCount(key, count, false)
+}
+
+// LMove atomically pops an element from one end of source and pushes it onto
+// one end of destination. Source and destination may be the same list, which
+// rotates it. Returns ("", false) if source is empty or doesn't exist.
+func (s *memoryListStore) LMove(source, destination string, fromLeft, toLeft bool) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	popped := s.popCount(source, 1, fromLeft)
+	if popped == nil {
+		return "", false
+	}
+	value := popped[0]
+
+	s.preserve(destination)
+	s.removeIfExpired(destination)
+	list := s.data[destination]
+	if toLeft {
+		list = append([]string{value}, list...)
+	} else {
+		list = append(list, value)
+	}
+	s.data[destination] = list
+	s.touch(destination)
+	return value, true
+}
+
+// popCount removes up to count elements from one end of a list.
+// Caller must hold s.mu for writing.
+func (s *memoryListStore) popCount(key string, count int, left bool) []string {
+	s.preserve(key)
+	s.removeIfExpired(key)
+	list, exists := s.data[key]
+	if !exists || len(list) == 0 || count <= 0 {
+		return nil
+	}
+	count = min(count, len(list))
+
+	values := make([]string, count)
+	if left {
+		copy(values, list[:count])
+		list = list[count:]
+	} else {
+		for i := range values {
+			values[i] = list[len(list)-1-i]
+		}
+		list = list[:len(list)-count]
+	}
+
+	// Delete empty lists (Redis behavior)
+	if len(list) == 0 {
+		delete(s.data, key)
+		s.expires.remove(key)
+	} else {
+		s.data[key] = list
+	}
+	s.touch(key)
+	return values
+}
+
 // LRange returns the specified range of elements from the list.
 // Start and stop are zero-based indices. Negative indices count from the end.
 // The range is inclusive on both ends.
@@ -123,7 +227,7 @@ func (s *memoryListStore) LRange(key string, start, stop int) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	list, exists := s.data[key]
+	list, exists := s.lookup(key)
 	if !exists {
 		return []string{}
 	}
@@ -162,7 +266,7 @@ func (s *memoryListStore) LLen(key string) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	list, exists := s.data[key]
+	list, exists := s.lookup(key)
 	if !exists {
 		return 0
 	}
@@ -174,9 +278,155 @@ func (s *memoryListStore) KeyType(key string) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, exists := s.data[key]
+	_, exists := s.lookup(key)
 	if !exists {
 		return "none"
 	}
 	return "list"
 }
+
+// Flush removes all lists from the store.
+func (s *memoryListStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserveAll()
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string][]string)
+	s.expires.clear()
+}
+
+// Delete removes a list. Returns true if the key existed.
+func (s *memoryListStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	_, exists := s.data[key]
+	if exists {
+		delete(s.data, key)
+		s.expires.remove(key)
+		s.touch(key)
+	}
+	return exists
+}
+
+// Keys returns the keys of all lists in the store.
+func (s *memoryListStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if !s.expires.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of keys in the store. Like Redis's DBSIZE, it counts
+// keys that have expired but haven't been deleted yet.
+func (s *memoryListStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Expire sets the time at which a list expires.
+// A time that is not in the future deletes the list immediately.
+// Returns false if the key doesn't exist.
+func (s *memoryListStore) Expire(key string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, exists := s.data[key]; !exists {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		delete(s.data, key)
+		s.expires.remove(key)
+	} else {
+		s.expires.set(key, at)
+		s.expires.start(&s.mu, s.expireKey)
+	}
+	s.touch(key)
+	return true
+}
+
+// Persist removes the expiration of a list.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *memoryListStore) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, ok := s.expires.get(key); !ok {
+		return false
+	}
+	s.expires.remove(key)
+	s.touch(key)
+	return true
+}
+
+// ExpiresAt returns the time at which a list expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *memoryListStore) ExpiresAt(key string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); !exists {
+		return time.Time{}, false
+	}
+	return s.expires.get(key)
+}
+
+// Close stops the background cleanup goroutine.
+func (s *memoryListStore) Close() {
+	s.expires.stop()
+}
+
+// lookup returns the list stored at key, treating expired lists as missing.
+// Caller must hold s.mu.
+func (s *memoryListStore) lookup(key string) ([]string, bool) {
+	list, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, time.Now()) {
+		return nil, false
+	}
+	return list, true
+}
+
+// removeIfExpired lazily deletes key if it has expired.
+// Caller must hold s.mu for writing.
+func (s *memoryListStore) removeIfExpired(key string) {
+	if s.expires.isExpired(key, time.Now()) {
+		s.expireKey(key)
+	}
+}
+
+// expireKey deletes a list whose TTL has passed.
+// Caller must hold s.mu for writing.
+func (s *memoryListStore) expireKey(key string) {
+	delete(s.data, key)
+	s.expires.remove(key)
+	s.expires.countExpired()
+	s.touch(key)
+}
+
+// SetExpiryConfig tunes active expiration.
+func (s *memoryListStore) SetExpiryConfig(cfg ExpiryConfig) {
+	s.expires.setConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics.
+func (s *memoryListStore) ExpiryStats() ExpiryStats {
+	return s.expires.stats()
+}
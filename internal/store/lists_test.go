@@ -1,6 +1,7 @@
 package store
 
 import (
+	"reflect"
 	"sync"
 	"testing"
 )
@@ -259,6 +260,95 @@ func TestRPop(t *testing.T) {
 	}
 }
 
+func TestPopCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		left     bool
+		count    int
+		want     []string
+		wantList []string
+	}{
+		{"left partial", true, 2, []string{"a", "b"}, []string{"c"}},
+		{"right partial", false, 2, []string{"c", "b"}, []string{"a"}},
+		{"count exceeds length", true, 10, []string{"a", "b", "c"}, []string{}},
+		{"zero count", false, 0, nil, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewListStore()
+			s.RPush("mylist", "a", "b", "c")
+
+			var got []string
+			if tt.left {
+				got = s.LPopCount("mylist", tt.count)
+			} else {
+				got = s.RPopCount("mylist", tt.count)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pop %d = %v, want %v", tt.count, got, tt.want)
+			}
+			if list := s.LRange("mylist", 0, -1); !reflect.DeepEqual(list, tt.wantList) {
+				t.Errorf("LRange() = %v, want %v", list, tt.wantList)
+			}
+		})
+	}
+
+	s := NewListStore()
+	if got := s.LPopCount("missing", 1); got != nil {
+		t.Errorf("LPopCount() on missing key = %v, want nil", got)
+	}
+	s.RPush("mylist", "a")
+	s.RPopCount("mylist", 1)
+	if s.KeyType("mylist") != "none" {
+		t.Error("emptied list should be deleted")
+	}
+}
+
+func TestLMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst string
+		fromLeft bool
+		toLeft   bool
+		want     string
+		wantSrc  []string
+		wantDst  []string
+	}{
+		{"left to right", "src", "dst", true, false, "a", []string{"b", "c"}, []string{"x", "a"}},
+		{"right to left", "src", "dst", false, true, "c", []string{"a", "b"}, []string{"c", "x"}},
+		{"rotate", "src", "src", true, false, "a", []string{"b", "c", "a"}, []string{"b", "c", "a"}},
+		{"new destination", "src", "new", false, false, "c", []string{"a", "b"}, []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewListStore()
+			s.RPush("src", "a", "b", "c")
+			s.RPush("dst", "x")
+
+			got, ok := s.LMove(tt.src, tt.dst, tt.fromLeft, tt.toLeft)
+			if !ok || got != tt.want {
+				t.Errorf("LMove() = %q, %v, want %q, true", got, ok, tt.want)
+			}
+			if list := s.LRange(tt.src, 0, -1); !reflect.DeepEqual(list, tt.wantSrc) {
+				t.Errorf("source = %v, want %v", list, tt.wantSrc)
+			}
+			if list := s.LRange(tt.dst, 0, -1); !reflect.DeepEqual(list, tt.wantDst) {
+				t.Errorf("destination = %v, want %v", list, tt.wantDst)
+			}
+		})
+	}
+
+	s := NewListStore()
+	if _, ok := s.LMove("missing", "dst", true, true); ok {
+		t.Error("LMove() from missing key should fail")
+	}
+	if s.KeyType("dst") != "none" {
+		t.Error("failed LMove should not create the destination")
+	}
+}
+
 func TestLRange(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -535,3 +625,27 @@ func TestListConcurrentAccess(t *testing.T) {
 		t.Errorf("LLen() after pops = %d, want 0", got)
 	}
 }
+
+func TestListStoreDeleteAndKeys(t *testing.T) {
+	s := NewListStore()
+	s.RPush("list1", "a")
+	s.RPush("list2", "b")
+
+	keys := s.Keys()
+	if len(keys) != 2 {
+		t.Errorf("Keys() returned %d keys, want 2", len(keys))
+	}
+
+	if !s.Delete("list1") {
+		t.Error("Delete(list1) = false, want true")
+	}
+	if s.Delete("list1") {
+		t.Error("Delete(list1) twice = true, want false")
+	}
+	if s.LLen("list1") != 0 {
+		t.Error("list1 still exists after Delete")
+	}
+	if len(s.Keys()) != 1 {
+		t.Errorf("Keys() after Delete returned %d keys, want 1", len(s.Keys()))
+	}
+}
@@ -3,6 +3,7 @@ package store
 
 import (
 	"sync"
+	"time"
 )
 
 // SetStore defines the interface for set operations.
@@ -14,18 +15,29 @@ type SetStore interface {
 	SCard(key string) int
 	SInter(keys ...string) []string
 	KeyType(key string) string
+	Delete(key string) bool
+	Keys() []string
+	Len() int
+	Flush()
+	Close()
+	Expirable
+	ExpiryTuner
 }
 
 // MemorySetStore is a thread-safe in-memory implementation of SetStore.
 type MemorySetStore struct {
-	mu   sync.RWMutex
-	data map[string]map[string]struct{}
+	versioned
+	snapshots[[]string]
+	mu      sync.RWMutex
+	data    map[string]map[string]struct{}
+	expires *expiryIndex
 }
 
 // NewSetStore creates a new MemorySetStore.
 func NewSetStore() *MemorySetStore {
 	return &MemorySetStore{
-		data: make(map[string]map[string]struct{}),
+		data:    make(map[string]map[string]struct{}),
+		expires: newExpiryIndex(),
 	}
 }
 
@@ -34,6 +46,8 @@ func (s *MemorySetStore) SAdd(key string, members ...string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	if s.data[key] == nil {
 		s.data[key] = make(map[string]struct{})
 	}
@@ -45,6 +59,9 @@ func (s *MemorySetStore) SAdd(key string, members ...string) int {
 			added++
 		}
 	}
+	if added > 0 {
+		s.touch(key)
+	}
 	return added
 }
 
@@ -53,6 +70,8 @@ func (s *MemorySetStore) SRem(key string, members ...string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	set, exists := s.data[key]
 	if !exists {
 		return 0
@@ -69,6 +88,10 @@ func (s *MemorySetStore) SRem(key string, members ...string) int {
 	// Auto-delete empty sets (Redis behavior)
 	if len(set) == 0 {
 		delete(s.data, key)
+		s.expires.remove(key)
+	}
+	if removed > 0 {
+		s.touch(key)
 	}
 
 	return removed
@@ -79,7 +102,7 @@ func (s *MemorySetStore) SMembers(key string) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	set, exists := s.data[key]
+	set, exists := s.lookup(key)
 	if !exists {
 		return []string{}
 	}
@@ -96,7 +119,7 @@ func (s *MemorySetStore) SIsMember(key, member string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	set, exists := s.data[key]
+	set, exists := s.lookup(key)
 	if !exists {
 		return false
 	}
@@ -110,7 +133,7 @@ func (s *MemorySetStore) SCard(key string) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	set, exists := s.data[key]
+	set, exists := s.lookup(key)
 	if !exists {
 		return 0
 	}
@@ -129,7 +152,7 @@ func (s *MemorySetStore) SInter(keys ...string) []string {
 
 	// Check if any key doesn't exist - if so, intersection is empty
 	for _, key := range keys {
-		if _, exists := s.data[key]; !exists {
+		if _, exists := s.lookup(key); !exists {
 			return []string{}
 		}
 	}
@@ -170,8 +193,154 @@ func (s *MemorySetStore) KeyType(key string) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if _, exists := s.data[key]; exists {
+	if _, exists := s.lookup(key); exists {
 		return "set"
 	}
 	return "none"
 }
+
+// Flush removes all sets from the store.
+func (s *MemorySetStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserveAll()
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]map[string]struct{})
+	s.expires.clear()
+}
+
+// Delete removes a set. Returns true if the key existed.
+func (s *MemorySetStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	_, exists := s.data[key]
+	if exists {
+		delete(s.data, key)
+		s.expires.remove(key)
+		s.touch(key)
+	}
+	return exists
+}
+
+// Keys returns the keys of all sets in the store.
+func (s *MemorySetStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if !s.expires.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of keys in the store. Like Redis's DBSIZE, it counts
+// keys that have expired but haven't been deleted yet.
+func (s *MemorySetStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Expire sets the time at which a set expires.
+// A time that is not in the future deletes the set immediately.
+// Returns false if the key doesn't exist.
+func (s *MemorySetStore) Expire(key string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, exists := s.data[key]; !exists {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		delete(s.data, key)
+		s.expires.remove(key)
+	} else {
+		s.expires.set(key, at)
+		s.expires.start(&s.mu, s.expireKey)
+	}
+	s.touch(key)
+	return true
+}
+
+// Persist removes the expiration of a set.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemorySetStore) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, ok := s.expires.get(key); !ok {
+		return false
+	}
+	s.expires.remove(key)
+	s.touch(key)
+	return true
+}
+
+// ExpiresAt returns the time at which a set expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemorySetStore) ExpiresAt(key string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); !exists {
+		return time.Time{}, false
+	}
+	return s.expires.get(key)
+}
+
+// Close stops the background cleanup goroutine.
+func (s *MemorySetStore) Close() {
+	s.expires.stop()
+}
+
+// lookup returns the set stored at key, treating expired sets as missing.
+// Caller must hold s.mu.
+func (s *MemorySetStore) lookup(key string) (map[string]struct{}, bool) {
+	set, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, time.Now()) {
+		return nil, false
+	}
+	return set, true
+}
+
+// removeIfExpired lazily deletes key if it has expired.
+// Caller must hold s.mu for writing.
+func (s *MemorySetStore) removeIfExpired(key string) {
+	if s.expires.isExpired(key, time.Now()) {
+		s.expireKey(key)
+	}
+}
+
+// expireKey deletes a set whose TTL has passed.
+// Caller must hold s.mu for writing.
+func (s *MemorySetStore) expireKey(key string) {
+	delete(s.data, key)
+	s.expires.remove(key)
+	s.expires.countExpired()
+	s.touch(key)
+}
+
+// SetExpiryConfig tunes active expiration.
+func (s *MemorySetStore) SetExpiryConfig(cfg ExpiryConfig) {
+	s.expires.setConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics.
+func (s *MemorySetStore) ExpiryStats() ExpiryStats {
+	return s.expires.stats()
+}
@@ -367,3 +367,26 @@ func TestConcurrentSInter(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestSetStoreDeleteAndKeys(t *testing.T) {
+	s := NewSetStore()
+	s.SAdd("set1", "a")
+	s.SAdd("set2", "b")
+
+	if len(s.Keys()) != 2 {
+		t.Errorf("Keys() returned %d keys, want 2", len(s.Keys()))
+	}
+
+	if !s.Delete("set1") {
+		t.Error("Delete(set1) = false, want true")
+	}
+	if s.Delete("set1") {
+		t.Error("Delete(set1) twice = true, want false")
+	}
+	if s.SCard("set1") != 0 {
+		t.Error("set1 still exists after Delete")
+	}
+	if len(s.Keys()) != 1 {
+		t.Errorf("Keys() after Delete returned %d keys, want 1", len(s.Keys()))
+	}
+}
@@ -0,0 +1,304 @@
+// Package store provides the skiplist that orders sorted set members.
+package store
+
+import "math/rand/v2"
+
+const (
+	// skiplistMaxLevel bounds node height; enough for 2^64 elements with p = 1/4.
+	skiplistMaxLevel = 32
+	// skiplistP is the probability that a node is promoted to the next level.
+	skiplistP = 0.25
+)
+
+// ScoreBound is one end of a score range, as in ZRANGE BYSCORE.
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+// LexBound is one end of a lexicographic range, as in ZRANGE BYLEX.
+// Inf is -1 for "-" (before every member), 1 for "+" (after every member),
+// and 0 for a bound on Value.
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	Inf       int
+}
+
+// aboveMin returns true if score is not below the bound.
+func (b ScoreBound) aboveMin(score float64) bool {
+	if b.Exclusive {
+		return score > b.Value
+	}
+	return score >= b.Value
+}
+
+// belowMax returns true if score is not above the bound.
+func (b ScoreBound) belowMax(score float64) bool {
+	if b.Exclusive {
+		return score < b.Value
+	}
+	return score <= b.Value
+}
+
+// aboveMin returns true if member is not below the bound.
+func (b LexBound) aboveMin(member string) bool {
+	switch b.Inf {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	if b.Exclusive {
+		return member > b.Value
+	}
+	return member >= b.Value
+}
+
+// belowMax returns true if member is not above the bound.
+func (b LexBound) belowMax(member string) bool {
+	switch b.Inf {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	if b.Exclusive {
+		return member < b.Value
+	}
+	return member <= b.Value
+}
+
+// skiplistNode is an element of a skiplist.
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+// skiplistLevel links a node to the next node at one level.
+// span is the number of elements the link skips, used to compute ranks.
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+// skiplist keeps sorted set members ordered by score, then by member.
+// It is the same structure Redis uses: ranks and range lookups are O(log n).
+type skiplist struct {
+	head   *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+// newSkiplist creates an empty skiplist.
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+// randomLevel picks the height of a new node.
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// before returns true if node sorts before (score, member).
+func (n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds a member. The member must not already be in the list.
+func (zsl *skiplist) insert(score float64, member string) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.head
+			update[i].levels[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &skiplistNode{member: member, score: score, levels: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < zsl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != zsl.head {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+}
+
+// delete removes a member with the given score. Returns false if it wasn't found.
+func (zsl *skiplist) delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+	zsl.deleteNode(x, update[:])
+	return true
+}
+
+// deleteNode unlinks x, given the last node before it at every level.
+func (zsl *skiplist) deleteNode(x *skiplistNode, update []*skiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.head.levels[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// rank returns the 0-based position of a member with the given score.
+// Returns false if it isn't in the list.
+func (zsl *skiplist) rank(score float64, member string) (int, bool) {
+	rank := 0
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil &&
+			(x.levels[i].forward.before(score, member) ||
+				(x.levels[i].forward.score == score && x.levels[i].forward.member == member)) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x != zsl.head && x.score == score && x.member == member {
+			return rank - 1, true
+		}
+	}
+	return 0, false
+}
+
+// byRank returns the node at a 0-based position, or nil if out of range.
+func (zsl *skiplist) byRank(rank int) *skiplistNode {
+	if rank < 0 || rank >= zsl.length {
+		return nil
+	}
+
+	traversed := 0
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank+1 {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstInScoreRange returns the first node with a score within [min, max], or nil.
+func (zsl *skiplist) firstInScoreRange(min, max ScoreBound) *skiplistNode {
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !min.aboveMin(x.levels[i].forward.score) {
+			x = x.levels[i].forward
+		}
+	}
+	x = x.levels[0].forward
+	if x == nil || !max.belowMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lastInScoreRange returns the last node with a score within [min, max], or nil.
+func (zsl *skiplist) lastInScoreRange(min, max ScoreBound) *skiplistNode {
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && max.belowMax(x.levels[i].forward.score) {
+			x = x.levels[i].forward
+		}
+	}
+	if x == zsl.head || !min.aboveMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+// firstInLexRange returns the first node with a member within [min, max], or nil.
+// Lexicographic ranges are only meaningful when all members have the same score.
+func (zsl *skiplist) firstInLexRange(min, max LexBound) *skiplistNode {
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !min.aboveMin(x.levels[i].forward.member) {
+			x = x.levels[i].forward
+		}
+	}
+	x = x.levels[0].forward
+	if x == nil || !max.belowMax(x.member) {
+		return nil
+	}
+	return x
+}
+
+// lastInLexRange returns the last node with a member within [min, max], or nil.
+func (zsl *skiplist) lastInLexRange(min, max LexBound) *skiplistNode {
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && max.belowMax(x.levels[i].forward.member) {
+			x = x.levels[i].forward
+		}
+	}
+	if x == zsl.head || !min.aboveMin(x.member) {
+		return nil
+	}
+	return x
+}
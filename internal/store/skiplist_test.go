@@ -0,0 +1,149 @@
+package store
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// checkSkiplist verifies order, length, ranks and backward links against want.
+func checkSkiplist(t *testing.T, zsl *skiplist, want []ZMember) {
+	t.Helper()
+
+	if zsl.length != len(want) {
+		t.Fatalf("length = %d, want %d", zsl.length, len(want))
+	}
+
+	i := 0
+	var prev *skiplistNode
+	for x := zsl.head.levels[0].forward; x != nil; x = x.levels[0].forward {
+		if x.member != want[i].Member || x.score != want[i].Score {
+			t.Fatalf("node %d = (%v, %q), want (%v, %q)", i, x.score, x.member, want[i].Score, want[i].Member)
+		}
+		if x.backward != prev {
+			t.Fatalf("node %d has wrong backward link", i)
+		}
+		if rank, ok := zsl.rank(x.score, x.member); !ok || rank != i {
+			t.Fatalf("rank(%q) = %d, %v, want %d", x.member, rank, ok, i)
+		}
+		if got := zsl.byRank(i); got != x {
+			t.Fatalf("byRank(%d) returned the wrong node", i)
+		}
+		prev = x
+		i++
+	}
+	if zsl.tail != prev {
+		t.Fatal("tail does not point at the last node")
+	}
+}
+
+func TestSkiplistInsertDelete(t *testing.T) {
+	zsl := newSkiplist()
+	var want []ZMember
+
+	for i := 0; i < 500; i++ {
+		m := ZMember{Member: "m" + strconv.Itoa(i), Score: float64(rand.IntN(50))}
+		zsl.insert(m.Score, m.Member)
+		want = append(want, m)
+	}
+	sortZMembers(want)
+	checkSkiplist(t, zsl, want)
+
+	// Delete every third member
+	var kept []ZMember
+	for i, m := range want {
+		if i%3 == 0 {
+			if !zsl.delete(m.Score, m.Member) {
+				t.Fatalf("delete(%q) = false, want true", m.Member)
+			}
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	checkSkiplist(t, zsl, kept)
+
+	if zsl.delete(1000, "missing") {
+		t.Error("delete(missing) = true, want false")
+	}
+	if _, ok := zsl.rank(1000, "missing"); ok {
+		t.Error("rank(missing) found a member")
+	}
+	if zsl.byRank(len(kept)) != nil || zsl.byRank(-1) != nil {
+		t.Error("byRank out of range returned a node")
+	}
+}
+
+func TestSkiplistScoreRange(t *testing.T) {
+	zsl := newSkiplist()
+	for i := 1; i <= 5; i++ {
+		zsl.insert(float64(i), "m"+strconv.Itoa(i))
+	}
+
+	tests := []struct {
+		name        string
+		min, max    ScoreBound
+		first, last string
+	}{
+		{"inclusive", ScoreBound{Value: 2}, ScoreBound{Value: 4}, "m2", "m4"},
+		{"exclusive", ScoreBound{Value: 2, Exclusive: true}, ScoreBound{Value: 4, Exclusive: true}, "m3", "m3"},
+		{"whole", ScoreBound{Value: 0}, ScoreBound{Value: 10}, "m1", "m5"},
+		{"empty", ScoreBound{Value: 6}, ScoreBound{Value: 10}, "", ""},
+		{"between members", ScoreBound{Value: 2.5}, ScoreBound{Value: 2.7}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := zsl.firstInScoreRange(tt.min, tt.max)
+			last := zsl.lastInScoreRange(tt.min, tt.max)
+			if nodeMember(first) != tt.first || nodeMember(last) != tt.last {
+				t.Errorf("range = %q..%q, want %q..%q", nodeMember(first), nodeMember(last), tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestSkiplistLexRange(t *testing.T) {
+	zsl := newSkiplist()
+	for _, m := range []string{"a", "b", "c", "d"} {
+		zsl.insert(0, m)
+	}
+
+	tests := []struct {
+		name        string
+		min, max    LexBound
+		first, last string
+	}{
+		{"all", LexBound{Inf: -1}, LexBound{Inf: 1}, "a", "d"},
+		{"inclusive", LexBound{Value: "b"}, LexBound{Value: "c"}, "b", "c"},
+		{"exclusive", LexBound{Value: "a", Exclusive: true}, LexBound{Value: "d", Exclusive: true}, "b", "c"},
+		{"empty", LexBound{Value: "e"}, LexBound{Inf: 1}, "", ""},
+		{"inverted infinities", LexBound{Inf: 1}, LexBound{Inf: -1}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := zsl.firstInLexRange(tt.min, tt.max)
+			last := zsl.lastInLexRange(tt.min, tt.max)
+			if nodeMember(first) != tt.first || nodeMember(last) != tt.last {
+				t.Errorf("range = %q..%q, want %q..%q", nodeMember(first), nodeMember(last), tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func nodeMember(n *skiplistNode) string {
+	if n == nil {
+		return ""
+	}
+	return n.member
+}
+
+func sortZMembers(members []ZMember) {
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+}
@@ -17,8 +17,9 @@ type Snapshottable interface {
 
 // StringEntry represents a string entry for export/import.
 type StringEntry struct {
-	Value     string
-	ExpiresAt int64 // Unix timestamp, 0 means no expiration
+	Value       string
+	ExpiresAt   int64 // Unix timestamp, 0 means no expiration
+	ExpiresAtMs int64 // Unix timestamp in milliseconds; preferred over ExpiresAt when set
 }
 
 // StringSnapshot represents exported string store data.
@@ -28,43 +29,109 @@ type StringSnapshot struct {
 
 // ListSnapshot represents exported list store data.
 type ListSnapshot struct {
-	Data map[string][]string
+	Data    map[string][]string
+	Expires map[string]int64 // Unix milliseconds, keyed by volatile keys only
 }
 
 // HashSnapshot represents exported hash store data.
 type HashSnapshot struct {
-	Data map[string]map[string]string
+	Data    map[string]map[string]string
+	Expires map[string]int64 // Unix milliseconds, keyed by volatile keys only
 }
 
 // SetSnapshot represents exported set store data.
 type SetSnapshot struct {
-	Data map[string][]string
+	Data    map[string][]string
+	Expires map[string]int64 // Unix milliseconds, keyed by volatile keys only
+}
+
+// ZSetSnapshot represents exported sorted set store data.
+// Members are listed in rank order.
+type ZSetSnapshot struct {
+	Data    map[string][]ZMember
+	Expires map[string]int64 // Unix milliseconds, keyed by volatile keys only
+}
+
+// StreamSnapshot represents exported stream store data.
+type StreamSnapshot struct {
+	Data    map[string]StreamData
+	Expires map[string]int64 // Unix milliseconds, keyed by volatile keys only
+}
+
+// StreamData is an exported stream, including its consumer groups.
+type StreamData struct {
+	Entries      []StreamEntry
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	Groups       []StreamGroupData
+}
+
+// StreamGroupData is an exported consumer group and its pending entries list.
+type StreamGroupData struct {
+	Name        string
+	LastID      StreamID
+	EntriesRead int64
+	Consumers   []StreamConsumerData
+	Pending     []StreamPendingData
+}
+
+// StreamConsumerData is an exported consumer.
+type StreamConsumerData struct {
+	Name       string
+	SeenTime   time.Time
+	ActiveTime time.Time
+}
+
+// StreamPendingData is an exported pending entry.
+type StreamPendingData struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  time.Time
+	DeliveryCount int64
 }
 
 // ExportData exports all string data for snapshotting.
 func (s *memoryStore) ExportData() interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return exportKeys(mapKeys(s.data), s.copyKey, stringBatch)
+}
 
-	snapshot := StringSnapshot{
-		Data: make(map[string]StringEntry, len(s.data)),
-	}
+// BeginSnapshot implements StreamingSnapshottable.
+func (s *memoryStore) BeginSnapshot() SnapshotCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginSnapshot(&s.mu, mapKeys(s.data), s.copyKey, stringBatch)
+}
 
-	for key, e := range s.data {
-		// Skip expired entries
-		if e.isExpired() {
-			continue
-		}
+// copyKey copies a string for export, skipping it if it has expired.
+// Caller must hold s.mu.
+func (s *memoryStore) copyKey(key string, now time.Time) (keyCopy[string], bool) {
+	e, exists := s.data[key]
+	if !exists || e.isExpired() {
+		return keyCopy[string]{}, false
+	}
+	kc := keyCopy[string]{value: e.value}
+	if !e.expiresAt.IsZero() {
+		kc.expiresAt = e.expiresAt.UnixMilli()
+	}
+	return kc, true
+}
 
-		entry := StringEntry{
-			Value: e.value,
-		}
-		if !e.expiresAt.IsZero() {
-			entry.ExpiresAt = e.expiresAt.Unix()
+// stringBatch builds a StringSnapshot from copied strings.
+func stringBatch(keys []string, copies []keyCopy[string]) interface{} {
+	snapshot := StringSnapshot{
+		Data: make(map[string]StringEntry, len(keys)),
+	}
+	for i, key := range keys {
+		entry := StringEntry{Value: copies[i].value}
+		if ms := copies[i].expiresAt; ms != 0 {
+			entry.ExpiresAt = time.UnixMilli(ms).Unix()
+			entry.ExpiresAtMs = ms
 		}
 		snapshot.Data[key] = entry
 	}
-
 	return snapshot
 }
 
@@ -80,18 +147,21 @@ func (s *memoryStore) ImportData(data interface{}) error {
 
 	now := time.Now()
 	for key, e := range snapshot.Data {
-		entry := &entry{
-			value: e.Value,
-		}
-		if e.ExpiresAt > 0 {
+		if e.ExpiresAt > 0 || e.ExpiresAtMs > 0 {
 			expiresAt := time.Unix(e.ExpiresAt, 0)
+			if e.ExpiresAtMs > 0 {
+				expiresAt = time.UnixMilli(e.ExpiresAtMs)
+			}
 			// Skip already expired entries
 			if expiresAt.Before(now) {
 				continue
 			}
-			entry.expiresAt = expiresAt
+			s.setExpiry(key, e.Value, expiresAt)
+		} else {
+			s.data[key] = &entry{value: e.Value}
+			s.expires.remove(key)
 		}
-		s.data[key] = entry
+		s.touch(key)
 	}
 
 	return nil
@@ -101,19 +171,32 @@ func (s *memoryStore) ImportData(data interface{}) error {
 func (s *memoryListStore) ExportData() interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return exportKeys(mapKeys(s.data), s.copyKey, listBatch)
+}
 
-	snapshot := ListSnapshot{
-		Data: make(map[string][]string, len(s.data)),
-	}
+// BeginSnapshot implements StreamingSnapshottable.
+func (s *memoryListStore) BeginSnapshot() SnapshotCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginSnapshot(&s.mu, mapKeys(s.data), s.copyKey, listBatch)
+}
 
-	for key, list := range s.data {
-		// Make a copy of the list
-		listCopy := make([]string, len(list))
-		copy(listCopy, list)
-		snapshot.Data[key] = listCopy
+// copyKey copies a list for export, skipping it if it has expired.
+// Caller must hold s.mu.
+func (s *memoryListStore) copyKey(key string, now time.Time) (keyCopy[[]string], bool) {
+	list, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, now) {
+		return keyCopy[[]string]{}, false
 	}
+	listCopy := make([]string, len(list))
+	copy(listCopy, list)
+	return keyCopy[[]string]{value: listCopy, expiresAt: s.expires.unixMilli(key)}, true
+}
 
-	return snapshot
+// listBatch builds a ListSnapshot from copied lists.
+func listBatch(keys []string, copies []keyCopy[[]string]) interface{} {
+	data, expires := splitCopies(keys, copies)
+	return ListSnapshot{Data: data, Expires: expires}
 }
 
 // ImportData imports list data from a snapshot.
@@ -126,10 +209,22 @@ func (s *memoryListStore) ImportData(data interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	for key, list := range snapshot.Data {
+		expiresAt, volatile := snapshotExpiry(snapshot.Expires, key)
+		// Skip already expired lists
+		if volatile && !expiresAt.After(now) {
+			continue
+		}
+
 		listCopy := make([]string, len(list))
 		copy(listCopy, list)
 		s.data[key] = listCopy
+		s.expires.restore(key, expiresAt, volatile)
+		s.touch(key)
+	}
+	if s.expires.len() > 0 {
+		s.expires.start(&s.mu, s.expireKey)
 	}
 
 	return nil
@@ -139,20 +234,34 @@ func (s *memoryListStore) ImportData(data interface{}) error {
 func (s *MemoryHashStore) ExportData() interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return exportKeys(mapKeys(s.hashes), s.copyKey, hashBatch)
+}
 
-	snapshot := HashSnapshot{
-		Data: make(map[string]map[string]string, len(s.hashes)),
-	}
+// BeginSnapshot implements StreamingSnapshottable.
+func (s *MemoryHashStore) BeginSnapshot() SnapshotCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginSnapshot(&s.mu, mapKeys(s.hashes), s.copyKey, hashBatch)
+}
 
-	for key, hash := range s.hashes {
-		hashCopy := make(map[string]string, len(hash))
-		for field, value := range hash {
-			hashCopy[field] = value
-		}
-		snapshot.Data[key] = hashCopy
+// copyKey copies a hash for export, skipping it if it has expired.
+// Caller must hold s.mu.
+func (s *MemoryHashStore) copyKey(key string, now time.Time) (keyCopy[map[string]string], bool) {
+	hash, exists := s.hashes[key]
+	if !exists || s.expires.isExpired(key, now) {
+		return keyCopy[map[string]string]{}, false
+	}
+	hashCopy := make(map[string]string, len(hash))
+	for field, value := range hash {
+		hashCopy[field] = value
 	}
+	return keyCopy[map[string]string]{value: hashCopy, expiresAt: s.expires.unixMilli(key)}, true
+}
 
-	return snapshot
+// hashBatch builds a HashSnapshot from copied hashes.
+func hashBatch(keys []string, copies []keyCopy[map[string]string]) interface{} {
+	data, expires := splitCopies(keys, copies)
+	return HashSnapshot{Data: data, Expires: expires}
 }
 
 // ImportData imports hash data from a snapshot.
@@ -165,12 +274,24 @@ func (s *MemoryHashStore) ImportData(data interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	for key, hash := range snapshot.Data {
+		expiresAt, volatile := snapshotExpiry(snapshot.Expires, key)
+		// Skip already expired hashes
+		if volatile && !expiresAt.After(now) {
+			continue
+		}
+
 		hashCopy := make(map[string]string, len(hash))
 		for field, value := range hash {
 			hashCopy[field] = value
 		}
 		s.hashes[key] = hashCopy
+		s.expires.restore(key, expiresAt, volatile)
+		s.touch(key)
+	}
+	if s.expires.len() > 0 {
+		s.expires.start(&s.mu, s.expireKey)
 	}
 
 	return nil
@@ -180,20 +301,30 @@ func (s *MemoryHashStore) ImportData(data interface{}) error {
 func (s *MemorySetStore) ExportData() interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return exportKeys(mapKeys(s.data), s.copyKey, setBatch)
+}
 
-	snapshot := SetSnapshot{
-		Data: make(map[string][]string, len(s.data)),
-	}
+// BeginSnapshot implements StreamingSnapshottable.
+func (s *MemorySetStore) BeginSnapshot() SnapshotCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginSnapshot(&s.mu, mapKeys(s.data), s.copyKey, setBatch)
+}
 
-	for key, set := range s.data {
-		members := make([]string, 0, len(set))
-		for member := range set {
-			members = append(members, member)
-		}
-		snapshot.Data[key] = members
+// copyKey copies a set's members for export, skipping it if it has expired.
+// Caller must hold s.mu.
+func (s *MemorySetStore) copyKey(key string, now time.Time) (keyCopy[[]string], bool) {
+	set, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, now) {
+		return keyCopy[[]string]{}, false
 	}
+	return keyCopy[[]string]{value: mapKeys(set), expiresAt: s.expires.unixMilli(key)}, true
+}
 
-	return snapshot
+// setBatch builds a SetSnapshot from copied sets.
+func setBatch(keys []string, copies []keyCopy[[]string]) interface{} {
+	data, expires := splitCopies(keys, copies)
+	return SetSnapshot{Data: data, Expires: expires}
 }
 
 // ImportData imports set data from a snapshot.
@@ -206,17 +337,103 @@ func (s *MemorySetStore) ImportData(data interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	for key, members := range snapshot.Data {
+		expiresAt, volatile := snapshotExpiry(snapshot.Expires, key)
+		// Skip already expired sets
+		if volatile && !expiresAt.After(now) {
+			continue
+		}
+
 		set := make(map[string]struct{}, len(members))
 		for _, member := range members {
 			set[member] = struct{}{}
 		}
 		s.data[key] = set
+		s.expires.restore(key, expiresAt, volatile)
+		s.touch(key)
+	}
+	if s.expires.len() > 0 {
+		s.expires.start(&s.mu, s.expireKey)
 	}
 
 	return nil
 }
 
+// ExportData exports all sorted set data for snapshotting.
+func (s *MemoryZSetStore) ExportData() interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return exportKeys(mapKeys(s.data), s.copyKey, zsetBatch)
+}
+
+// BeginSnapshot implements StreamingSnapshottable.
+func (s *MemoryZSetStore) BeginSnapshot() SnapshotCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginSnapshot(&s.mu, mapKeys(s.data), s.copyKey, zsetBatch)
+}
+
+// copyKey copies a sorted set's members in rank order for export, skipping
+// it if it has expired.
+// Caller must hold s.mu.
+func (s *MemoryZSetStore) copyKey(key string, now time.Time) (keyCopy[[]ZMember], bool) {
+	z, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, now) {
+		return keyCopy[[]ZMember]{}, false
+	}
+	return keyCopy[[]ZMember]{value: z.rangeByRank(0, -1, false), expiresAt: s.expires.unixMilli(key)}, true
+}
+
+// zsetBatch builds a ZSetSnapshot from copied sorted sets.
+func zsetBatch(keys []string, copies []keyCopy[[]ZMember]) interface{} {
+	data, expires := splitCopies(keys, copies)
+	return ZSetSnapshot{Data: data, Expires: expires}
+}
+
+// ImportData imports sorted set data from a snapshot.
+func (s *MemoryZSetStore) ImportData(data interface{}) error {
+	snapshot, ok := data.(ZSetSnapshot)
+	if !ok {
+		return ErrInvalidSnapshotData
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, members := range snapshot.Data {
+		expiresAt, volatile := snapshotExpiry(snapshot.Expires, key)
+		// Skip already expired sorted sets
+		if volatile && !expiresAt.After(now) {
+			continue
+		}
+
+		z := newZSet()
+		for _, m := range members {
+			z.add(m.Member, m.Score)
+		}
+		s.data[key] = z
+		s.expires.restore(key, expiresAt, volatile)
+		s.touch(key)
+	}
+	if s.expires.len() > 0 {
+		s.expires.start(&s.mu, s.expireKey)
+	}
+
+	return nil
+}
+
+// snapshotExpiry returns the expiration time recorded for key in a snapshot's Expires map.
+// Returns false if the key has no expiration.
+func snapshotExpiry(expires map[string]int64, key string) (time.Time, bool) {
+	ms, ok := expires[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
 // AsSnapshottable type asserts any store to Snapshottable.
 // Returns nil if the store doesn't implement Snapshottable.
 func AsSnapshottable(s interface{}) Snapshottable {
@@ -225,3 +442,120 @@ func AsSnapshottable(s interface{}) Snapshottable {
 	}
 	return nil
 }
+
+// ExportData exports all stream data, including consumer groups, for snapshotting.
+func (s *MemoryStreamStore) ExportData() interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return exportKeys(mapKeys(s.data), s.copyKey, streamBatch)
+}
+
+// BeginSnapshot implements StreamingSnapshottable.
+func (s *MemoryStreamStore) BeginSnapshot() SnapshotCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beginSnapshot(&s.mu, mapKeys(s.data), s.copyKey, streamBatch)
+}
+
+// copyKey copies a stream and its consumer groups for export, skipping it if
+// it has expired.
+// Caller must hold s.mu.
+func (s *MemoryStreamStore) copyKey(key string, now time.Time) (keyCopy[StreamData], bool) {
+	st, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, now) {
+		return keyCopy[StreamData]{}, false
+	}
+
+	data := StreamData{
+		Entries:      append([]StreamEntry(nil), st.entries...),
+		LastID:       st.lastID,
+		MaxDeletedID: st.maxDeletedID,
+		EntriesAdded: st.entriesAdded,
+	}
+	for name, g := range st.groups {
+		group := StreamGroupData{
+			Name:        name,
+			LastID:      g.lastID,
+			EntriesRead: g.entriesRead,
+		}
+		for _, c := range g.consumers {
+			group.Consumers = append(group.Consumers, StreamConsumerData{
+				Name:       c.name,
+				SeenTime:   c.seenTime,
+				ActiveTime: c.activeTime,
+			})
+		}
+		for _, id := range sortedIDs(g.pending) {
+			pe := g.pending[id]
+			group.Pending = append(group.Pending, StreamPendingData{
+				ID:            id,
+				Consumer:      pe.consumer.name,
+				DeliveryTime:  pe.deliveryTime,
+				DeliveryCount: pe.deliveryCount,
+			})
+		}
+		data.Groups = append(data.Groups, group)
+	}
+	return keyCopy[StreamData]{value: data, expiresAt: s.expires.unixMilli(key)}, true
+}
+
+// streamBatch builds a StreamSnapshot from copied streams.
+func streamBatch(keys []string, copies []keyCopy[StreamData]) interface{} {
+	data, expires := splitCopies(keys, copies)
+	return StreamSnapshot{Data: data, Expires: expires}
+}
+
+// ImportData imports stream data from a snapshot.
+func (s *MemoryStreamStore) ImportData(data interface{}) error {
+	snapshot, ok := data.(StreamSnapshot)
+	if !ok {
+		return ErrInvalidSnapshotData
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, sd := range snapshot.Data {
+		expiresAt, volatile := snapshotExpiry(snapshot.Expires, key)
+		// Skip already expired streams
+		if volatile && !expiresAt.After(now) {
+			continue
+		}
+
+		st := newStream()
+		st.entries = append([]StreamEntry(nil), sd.Entries...)
+		st.lastID = sd.LastID
+		st.maxDeletedID = sd.MaxDeletedID
+		st.entriesAdded = sd.EntriesAdded
+		for _, gd := range sd.Groups {
+			g := &consumerGroup{
+				lastID:      gd.LastID,
+				entriesRead: gd.EntriesRead,
+				pending:     make(map[StreamID]*pendingEntry, len(gd.Pending)),
+				consumers:   make(map[string]*streamConsumer, len(gd.Consumers)),
+			}
+			for _, cd := range gd.Consumers {
+				c := g.consumer(cd.Name, cd.SeenTime)
+				c.activeTime = cd.ActiveTime
+			}
+			for _, pd := range gd.Pending {
+				c, exists := g.consumers[pd.Consumer]
+				if !exists {
+					c = g.consumer(pd.Consumer, pd.DeliveryTime)
+				}
+				pe := g.assign(pd.ID, c, pd.DeliveryTime)
+				pe.deliveryCount = pd.DeliveryCount
+			}
+			st.groups[gd.Name] = g
+		}
+		s.data[key] = st
+		s.expires.restore(key, expiresAt, volatile)
+		s.touch(key)
+	}
+	if s.expires.len() > 0 {
+		s.expires.start(&s.mu, s.expireKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package store provides streaming snapshots, which copy a store a batch of
+// keys at a time instead of all at once.
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// StreamingSnapshottable is implemented by stores that can be snapshotted a
+// batch of keys at a time, so saving doesn't need a copy of the whole store.
+//
+// A snapshot holds the store as it was when BeginSnapshot was called, though
+// only the key names are recorded then. Keys are copied as the cursor reaches
+// them, under the store's lock, so writers wait for one batch at most. A key
+// written before the cursor reaches it is copied first, on its first write,
+// so the snapshot still sees the value it had at the start. Keys created
+// after the start are left out, and keys that expire meanwhile may be left
+// out, as if they had expired before it.
+//
+// Snapshots of several stores are only taken at the same point in time if
+// writes to all of them are held off while each BeginSnapshot is called, as
+// the server's execution lock does.
+type StreamingSnapshottable interface {
+	Snapshottable
+	// BeginSnapshot starts a snapshot of the store as it is now.
+	BeginSnapshot() SnapshotCursor
+}
+
+// SnapshotCursor reads a snapshot started by BeginSnapshot.
+type SnapshotCursor interface {
+	// Len returns how many keys the store held when the snapshot started.
+	Len() int
+	// Next returns the next n keys, as the same type ExportData returns,
+	// leaving out keys deleted before the snapshot started. It returns false
+	// once every key has been returned.
+	Next(n int) (interface{}, bool)
+	// Close ends the snapshot. It must be called, even if not every key was
+	// read, as writes keep copying keys for the snapshot until it is.
+	Close()
+}
+
+// AsStreamingSnapshottable type asserts any store to StreamingSnapshottable.
+// Returns nil if the store doesn't implement StreamingSnapshottable.
+func AsStreamingSnapshottable(s interface{}) StreamingSnapshottable {
+	if snap, ok := s.(StreamingSnapshottable); ok {
+		return snap
+	}
+	return nil
+}
+
+// keyCopy is a copy of a key's value and expiry, taken for a snapshot.
+type keyCopy[T any] struct {
+	value     T
+	expiresAt int64 // Unix milliseconds, 0 if the key doesn't expire
+}
+
+// snapshots is embedded by stores to keep the snapshots in progress over
+// them. It is guarded by the store's lock.
+type snapshots[T any] struct {
+	active map[*snapshotCursor[T]]struct{}
+}
+
+// snapshotCursor implements SnapshotCursor for a store holding values of type
+// T. Its fields are guarded by the store's lock.
+type snapshotCursor[T any] struct {
+	mu    sync.Locker
+	owner *snapshots[T]
+	size  int
+	// keys are the keys not returned yet, in the order they are returned.
+	// Those in pending are copied when returned, while those written since the
+	// start were copied into preserved then.
+	keys      []string
+	pending   map[string]struct{}
+	preserved map[string]keyCopy[T]
+	// copyKey copies a key, returning false if it doesn't exist or has
+	// expired, and batch builds the store's snapshot type from copies.
+	copyKey func(key string, now time.Time) (keyCopy[T], bool)
+	batch   func(keys []string, copies []keyCopy[T]) interface{}
+}
+
+// beginSnapshot starts a snapshot of keys.
+// Caller must hold mu for writing.
+func (s *snapshots[T]) beginSnapshot(mu sync.Locker, keys []string, copyKey func(string, time.Time) (keyCopy[T], bool), batch func([]string, []keyCopy[T]) interface{}) SnapshotCursor {
+	c := &snapshotCursor[T]{
+		mu:        mu,
+		owner:     s,
+		size:      len(keys),
+		keys:      keys,
+		pending:   make(map[string]struct{}, len(keys)),
+		preserved: make(map[string]keyCopy[T]),
+		copyKey:   copyKey,
+		batch:     batch,
+	}
+	for _, key := range keys {
+		c.pending[key] = struct{}{}
+	}
+	if s.active == nil {
+		s.active = make(map[*snapshotCursor[T]]struct{})
+	}
+	s.active[c] = struct{}{}
+	return c
+}
+
+// preserve copies keys that are about to be written into the snapshots that
+// haven't reached them.
+// Caller must hold the store's lock for writing.
+func (s *snapshots[T]) preserve(keys ...string) {
+	if len(s.active) == 0 {
+		return
+	}
+	now := time.Now()
+	for c := range s.active {
+		for _, key := range keys {
+			c.preserve(key, now)
+		}
+	}
+}
+
+// preserveAll copies every key the snapshots haven't reached, before the
+// store is flushed.
+// Caller must hold the store's lock for writing.
+func (s *snapshots[T]) preserveAll() {
+	if len(s.active) == 0 {
+		return
+	}
+	now := time.Now()
+	for c := range s.active {
+		for key := range c.pending {
+			c.preserve(key, now)
+		}
+	}
+}
+
+// preserve copies key if the snapshot hasn't reached or copied it yet.
+func (c *snapshotCursor[T]) preserve(key string, now time.Time) {
+	if _, ok := c.pending[key]; !ok {
+		return
+	}
+	delete(c.pending, key)
+	if kc, ok := c.copyKey(key, now); ok {
+		c.preserved[key] = kc
+	}
+}
+
+// Len implements SnapshotCursor.
+func (c *snapshotCursor[T]) Len() int {
+	return c.size
+}
+
+// Next implements SnapshotCursor.
+func (c *snapshotCursor[T]) Next(n int) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.keys) == 0 {
+		return nil, false
+	}
+	n = min(n, len(c.keys))
+	keys := make([]string, 0, n)
+	copies := make([]keyCopy[T], 0, n)
+	now := time.Now()
+	for _, key := range c.keys[:n] {
+		kc, ok := c.preserved[key]
+		if ok {
+			delete(c.preserved, key)
+		} else if _, ok = c.pending[key]; ok {
+			delete(c.pending, key)
+			kc, ok = c.copyKey(key, now)
+		}
+		if ok {
+			keys = append(keys, key)
+			copies = append(copies, kc)
+		}
+	}
+	c.keys = c.keys[n:]
+	return c.batch(keys, copies), true
+}
+
+// Close implements SnapshotCursor.
+func (c *snapshotCursor[T]) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.owner.active, c)
+	c.keys, c.pending, c.preserved = nil, nil, nil
+}
+
+// exportKeys copies every key in keys that exists and hasn't expired, and
+// builds the store's snapshot type from the copies.
+// Caller must hold the store's lock.
+func exportKeys[T any](keys []string, copyKey func(string, time.Time) (keyCopy[T], bool), batch func([]string, []keyCopy[T]) interface{}) interface{} {
+	now := time.Now()
+	copied := make([]string, 0, len(keys))
+	copies := make([]keyCopy[T], 0, len(keys))
+	for _, key := range keys {
+		if kc, ok := copyKey(key, now); ok {
+			copied = append(copied, key)
+			copies = append(copies, kc)
+		}
+	}
+	return batch(copied, copies)
+}
+
+// splitCopies splits copies into values and expiry times, the way every
+// snapshot type but strings holds them.
+func splitCopies[T any](keys []string, copies []keyCopy[T]) (map[string]T, map[string]int64) {
+	data := make(map[string]T, len(keys))
+	expires := make(map[string]int64)
+	for i, key := range keys {
+		data[key] = copies[i].value
+		if copies[i].expiresAt != 0 {
+			expires[key] = copies[i].expiresAt
+		}
+	}
+	return data, expires
+}
+
+// mapKeys returns the keys of m.
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
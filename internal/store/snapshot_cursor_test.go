@@ -0,0 +1,218 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// drainStrings reads a string snapshot to the end, returning its keys and the
+// size of every batch.
+func drainStrings(t *testing.T, c SnapshotCursor, n int) (map[string]StringEntry, []int) {
+	t.Helper()
+	data := make(map[string]StringEntry)
+	var sizes []int
+	for {
+		batch, ok := c.Next(n)
+		if !ok {
+			return data, sizes
+		}
+		snapshot, isString := batch.(StringSnapshot)
+		if !isString {
+			t.Fatalf("Next() returned %T, want StringSnapshot", batch)
+		}
+		sizes = append(sizes, len(snapshot.Data))
+		for key, e := range snapshot.Data {
+			data[key] = e
+		}
+	}
+}
+
+func TestSnapshotCursor_Batches(t *testing.T) {
+	s := New().(*memoryStore)
+	defer s.Close()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.Set(key, "v-"+key)
+	}
+	s.SetWithTTL("ttl", "v", time.Hour)
+	want := s.ExportData().(StringSnapshot).Data
+
+	c := s.BeginSnapshot()
+	defer c.Close()
+	if c.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", c.Len())
+	}
+	got, sizes := drainStrings(t, c, 4)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(sizes, []int{4, 2}) {
+		t.Errorf("batch sizes = %v, want [4 2]", sizes)
+	}
+}
+
+func TestSnapshotCursor_CopyOnWrite(t *testing.T) {
+	s := New().(*memoryStore)
+	defer s.Close()
+	s.Set("changed", "old")
+	s.Set("deleted", "old")
+	s.Set("unchanged", "old")
+	s.SetWithTTL("persisted", "old", time.Hour)
+	want := s.ExportData().(StringSnapshot).Data
+
+	c := s.BeginSnapshot()
+	defer c.Close()
+	s.Set("changed", "new")
+	s.Set("changed", "newer")
+	s.Delete("deleted")
+	s.Persist("persisted")
+	s.Set("created", "new")
+
+	got, _ := drainStrings(t, c, 1)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot = %v, want %v as it was at the start", got, want)
+	}
+	if v, _ := s.Get("changed"); v != "newer" {
+		t.Errorf("changed = %q after the snapshot, want newer", v)
+	}
+}
+
+func TestSnapshotCursor_DeletedBeforeStart(t *testing.T) {
+	s := New().(*memoryStore)
+	defer s.Close()
+	s.Set("live", "v")
+	s.SetWithTTL("expired", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	c := s.BeginSnapshot()
+	defer c.Close()
+	got, _ := drainStrings(t, c, 10)
+	if _, ok := got["expired"]; ok || len(got) != 1 {
+		t.Errorf("snapshot = %v, want only live", got)
+	}
+}
+
+func TestSnapshotCursor_Close(t *testing.T) {
+	s := New().(*memoryStore)
+	defer s.Close()
+	s.Set("k", "v")
+
+	first, second := s.BeginSnapshot(), s.BeginSnapshot()
+	first.Close()
+	if len(s.active) != 1 {
+		t.Errorf("%d snapshots active after closing one, want 1", len(s.active))
+	}
+	if _, ok := first.Next(10); ok {
+		t.Error("Next() after Close() returned a batch")
+	}
+
+	s.Set("k", "new")
+	second.Close()
+	if len(s.active) != 0 {
+		t.Errorf("%d snapshots active after closing both, want 0", len(s.active))
+	}
+}
+
+// TestSnapshotCursor_Stores checks every store keeps the values its keys had
+// when the snapshot started, whether they are written, deleted or flushed.
+func TestSnapshotCursor_Stores(t *testing.T) {
+	lists := NewListStore().(*memoryListStore)
+	hashes := NewHashStore().(*MemoryHashStore)
+	sets := NewSetStore()
+	zsets := NewZSetStore()
+	streams := NewStreamStore()
+	for _, s := range []interface{ Close() }{lists, hashes, sets, zsets, streams} {
+		defer s.Close()
+	}
+
+	tests := []struct {
+		name  string
+		store StreamingSnapshottable
+		setup func()
+		write func()
+	}{
+		{"lists", lists, func() {
+			lists.RPush("a", "1", "2")
+			lists.RPush("b", "1")
+			lists.Expire("b", time.Now().Add(time.Hour))
+		}, func() {
+			lists.LMove("a", "b", true, true)
+			lists.RPop("a")
+		}},
+		{"hashes", hashes, func() {
+			hashes.HSet("a", "f", "1")
+			hashes.HSet("b", "f", "1", "g", "2")
+		}, func() {
+			hashes.HSet("a", "f", "2")
+			hashes.HDel("b", "f", "g")
+		}},
+		{"sets", sets, func() {
+			sets.SAdd("a", "m")
+			sets.SAdd("b", "m")
+		}, func() {
+			sets.SAdd("a", "n")
+			sets.Flush()
+		}},
+		{"zsets", zsets, func() {
+			zsets.ZAdd("a", ZAddFlags{}, ZMember{Member: "m", Score: 1})
+			zsets.ZAdd("b", ZAddFlags{}, ZMember{Member: "m", Score: 1}, ZMember{Member: "n", Score: 2})
+		}, func() {
+			zsets.ZIncrBy("a", ZAddFlags{}, "m", 5)
+			zsets.ZPopMin("b", 1)
+			zsets.ZReplace("a", nil)
+		}},
+		{"streams", streams, func() {
+			streams.XAdd("a", XAddArgs{ID: StreamID{Ms: 1}}, []string{"f", "v"})
+			streams.XGroupCreate("a", "g", StreamGroupStart{}, false)
+		}, func() {
+			streams.XAdd("a", XAddArgs{ID: StreamID{Ms: 2}}, []string{"f", "v"})
+			streams.XReadGroup("a", "g", "c", StreamID{}, true, 10, false)
+			streams.Delete("a")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			want := tt.store.ExportData()
+
+			c := tt.store.BeginSnapshot()
+			defer c.Close()
+			tt.write()
+			if reflect.DeepEqual(tt.store.ExportData(), want) {
+				t.Fatal("writes didn't change the store")
+			}
+
+			got, ok := c.Next(100)
+			if !ok {
+				t.Fatal("Next() returned no batch")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("snapshot =\n%+v\nwant\n%+v", got, want)
+			}
+			if _, ok := c.Next(100); ok {
+				t.Error("Next() returned a batch after every key")
+			}
+		})
+	}
+}
+
+func TestAsStreamingSnapshottable(t *testing.T) {
+	strings := New()
+	defer strings.Close()
+
+	tests := []struct {
+		name  string
+		store interface{}
+		isNil bool
+	}{
+		{"StringStore", strings, false},
+		{"StreamStore", NewStreamStore(), false},
+		{"Snapshottable only", struct{ Snapshottable }{strings.(Snapshottable)}, true},
+		{"nil", nil, true},
+	}
+	for _, tt := range tests {
+		if got := AsStreamingSnapshottable(tt.store); (got == nil) != tt.isNil {
+			t.Errorf("AsStreamingSnapshottable(%s) = %v, want nil %v", tt.name, got, tt.isNil)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 )
@@ -127,6 +129,116 @@ func TestListStore_ExportImportData(t *testing.T) {
 	}
 }
 
+func TestStringStore_ExportImportMillisecondExpiry(t *testing.T) {
+	src := New().(*memoryStore)
+	defer src.Close()
+
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond).Add(250 * time.Millisecond)
+	src.Set("key", "value")
+	src.Expire("key", at)
+
+	snapshot := src.ExportData().(StringSnapshot)
+	if got := snapshot.Data["key"].ExpiresAtMs; got != at.UnixMilli() {
+		t.Errorf("ExpiresAtMs = %d, want %d", got, at.UnixMilli())
+	}
+
+	dst := New().(*memoryStore)
+	defer dst.Close()
+	if err := dst.ImportData(snapshot); err != nil {
+		t.Fatalf("ImportData failed: %v", err)
+	}
+	if got, ok := dst.ExpiresAt("key"); !ok || !got.Equal(at) {
+		t.Errorf("ExpiresAt() = %v, %v, want %v, true", got, ok, at)
+	}
+}
+
+func TestCollectionStores_ExportImportExpires(t *testing.T) {
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	past := time.Now().Add(-time.Hour).UnixMilli()
+
+	tests := []struct {
+		name     string
+		src, dst func() Snapshottable
+		fill     func(s Snapshottable)
+		withPast func(snapshot interface{}) interface{}
+	}{
+		{
+			name: "list",
+			src:  func() Snapshottable { return NewListStore().(*memoryListStore) },
+			dst:  func() Snapshottable { return NewListStore().(*memoryListStore) },
+			fill: func(s Snapshottable) {
+				s.(ListStore).RPush("volatile", "a")
+				s.(ListStore).RPush("persistent", "a")
+			},
+			withPast: func(snapshot interface{}) interface{} {
+				snap := snapshot.(ListSnapshot)
+				snap.Data["stale"] = []string{"a"}
+				snap.Expires["stale"] = past
+				return snap
+			},
+		},
+		{
+			name: "hash",
+			src:  func() Snapshottable { return NewHashStore().(*MemoryHashStore) },
+			dst:  func() Snapshottable { return NewHashStore().(*MemoryHashStore) },
+			fill: func(s Snapshottable) {
+				s.(HashStore).HSet("volatile", "f", "v")
+				s.(HashStore).HSet("persistent", "f", "v")
+			},
+			withPast: func(snapshot interface{}) interface{} {
+				snap := snapshot.(HashSnapshot)
+				snap.Data["stale"] = map[string]string{"f": "v"}
+				snap.Expires["stale"] = past
+				return snap
+			},
+		},
+		{
+			name: "set",
+			src:  func() Snapshottable { return NewSetStore() },
+			dst:  func() Snapshottable { return NewSetStore() },
+			fill: func(s Snapshottable) {
+				s.(SetStore).SAdd("volatile", "m")
+				s.(SetStore).SAdd("persistent", "m")
+			},
+			withPast: func(snapshot interface{}) interface{} {
+				snap := snapshot.(SetSnapshot)
+				snap.Data["stale"] = []string{"m"}
+				snap.Expires["stale"] = past
+				return snap
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := tt.src()
+			tt.fill(src)
+			src.(Expirable).Expire("volatile", at)
+
+			snapshot := tt.withPast(src.ExportData())
+
+			dst := tt.dst()
+			defer dst.(interface{ Close() }).Close()
+			if err := dst.ImportData(snapshot); err != nil {
+				t.Fatalf("ImportData failed: %v", err)
+			}
+
+			exp := dst.(Expirable)
+			if got, ok := exp.ExpiresAt("volatile"); !ok || !got.Equal(at) {
+				t.Errorf("ExpiresAt(volatile) = %v, %v, want %v, true", got, ok, at)
+			}
+			if _, ok := exp.ExpiresAt("persistent"); ok {
+				t.Error("persistent key gained an expiration")
+			}
+			keys := dst.(interface{ Keys() []string }).Keys()
+			sort.Strings(keys)
+			if len(keys) != 2 || keys[0] != "persistent" || keys[1] != "volatile" {
+				t.Errorf("Keys() = %v, want [persistent volatile] (stale key skipped)", keys)
+			}
+		})
+	}
+}
+
 func TestListStore_ImportInvalidData(t *testing.T) {
 	s := NewListStore().(*memoryListStore)
 
@@ -215,6 +327,110 @@ func TestSetStore_ImportInvalidData(t *testing.T) {
 	}
 }
 
+func TestZSetStore_ExportImportData(t *testing.T) {
+	src := NewZSetStore()
+	defer src.Close()
+
+	src.ZAdd("z", ZAddFlags{}, ZMember{Member: "b", Score: 2}, ZMember{Member: "a", Score: 1})
+	src.ZAdd("volatile", ZAddFlags{}, ZMember{Member: "m", Score: 1})
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	src.Expire("volatile", at)
+
+	snapshot, ok := src.ExportData().(ZSetSnapshot)
+	if !ok {
+		t.Fatal("ExportData did not return ZSetSnapshot")
+	}
+	if got := snapshot.Data["z"]; len(got) != 2 || got[0].Member != "a" || got[1].Member != "b" {
+		t.Errorf("exported members = %v, want a then b", got)
+	}
+
+	dst := NewZSetStore()
+	defer dst.Close()
+	if err := dst.ImportData(snapshot); err != nil {
+		t.Fatalf("ImportData failed: %v", err)
+	}
+
+	if score, ok := dst.ZScore("z", "b"); !ok || score != 2 {
+		t.Errorf("ZScore(z, b) = %v, %v, want 2, true", score, ok)
+	}
+	if rank, _, ok := dst.ZRank("z", "b", false); !ok || rank != 1 {
+		t.Errorf("ZRank(z, b) = %d, %v, want 1, true", rank, ok)
+	}
+	if got, ok := dst.ExpiresAt("volatile"); !ok || !got.Equal(at) {
+		t.Errorf("ExpiresAt(volatile) = %v, %v, want %v, true", got, ok, at)
+	}
+}
+
+func TestZSetStore_ImportInvalidData(t *testing.T) {
+	s := NewZSetStore()
+	defer s.Close()
+
+	if err := s.ImportData("invalid"); err != ErrInvalidSnapshotData {
+		t.Errorf("Expected ErrInvalidSnapshotData, got %v", err)
+	}
+}
+
+func TestStreamStore_ExportImportData(t *testing.T) {
+	src := NewStreamStore()
+	defer src.Close()
+
+	for i := uint64(1); i <= 3; i++ {
+		src.XAdd("s", XAddArgs{ID: StreamID{Ms: i}}, []string{"n", "v"})
+	}
+	src.XDel("s", StreamID{Ms: 2})
+	src.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+	src.XReadGroup("s", "g", "alice", StreamID{}, true, 1, false)
+	src.XAdd("volatile", XAddArgs{AutoID: true}, []string{"f", "v"})
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	src.Expire("volatile", at)
+
+	snapshot, ok := src.ExportData().(StreamSnapshot)
+	if !ok {
+		t.Fatal("ExportData did not return StreamSnapshot")
+	}
+
+	dst := NewStreamStore()
+	defer dst.Close()
+	if err := dst.ImportData(snapshot); err != nil {
+		t.Fatalf("ImportData failed: %v", err)
+	}
+
+	want, _ := src.XInfoStream("s")
+	got, ok := dst.XInfoStream("s")
+	if !ok || got.Length != want.Length || got.LastID != want.LastID || got.MaxDeletedID != want.MaxDeletedID || got.EntriesAdded != want.EntriesAdded {
+		t.Errorf("XInfoStream(s) = %+v, want %+v", got, want)
+	}
+
+	wantGroups, _ := src.XInfoGroups("s")
+	if groups, _ := dst.XInfoGroups("s"); !reflect.DeepEqual(groups, wantGroups) {
+		t.Errorf("XInfoGroups(s) = %+v, want %+v", groups, wantGroups)
+	}
+
+	pending, err := dst.XPending("s", "g", StreamID{}, MaxStreamID, 10, "", 0)
+	if err != nil || len(pending) != 1 || pending[0].Consumer != "alice" || pending[0].DeliveryCount != 1 {
+		t.Errorf("XPending(s, g) = %+v, %v, want 1-0 pending for alice", pending, err)
+	}
+
+	// The restored group continues where it left off
+	entries, _ := dst.XReadGroup("s", "g", "bob", StreamID{}, true, 0, false)
+	if len(entries) != 1 || entries[0].ID != (StreamID{Ms: 3}) {
+		t.Errorf("XReadGroup after import = %v, want 3-0", entries)
+	}
+
+	if got, ok := dst.ExpiresAt("volatile"); !ok || !got.Equal(at) {
+		t.Errorf("ExpiresAt(volatile) = %v, %v, want %v, true", got, ok, at)
+	}
+}
+
+func TestStreamStore_ImportInvalidData(t *testing.T) {
+	s := NewStreamStore()
+	defer s.Close()
+
+	if err := s.ImportData("invalid"); err != ErrInvalidSnapshotData {
+		t.Errorf("Expected ErrInvalidSnapshotData, got %v", err)
+	}
+}
+
 func TestAsSnapshottable(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -13,11 +13,17 @@ type Store interface {
 	SetWithTTL(key string, value string, ttl time.Duration)
 	Delete(key string) bool
 	Keys() []string
+	Len() int
 	TTL(key string) (time.Duration, bool)
+	Flush()
 	Close()
+	Expirable
+	ExpiryTuner
 }
 
 // entry holds a value and its optional expiration time.
+// Entries are replaced rather than modified, so Get and TTL can read one
+// after releasing the lock.
 type entry struct {
 	value     string
 	expiresAt time.Time // zero value means no expiration
@@ -32,48 +38,47 @@ func (e *entry) isExpired() bool {
 }
 
 // memoryStore is a thread-safe in-memory implementation of Store.
+// Keys with a TTL are also tracked in expires, which drives active expiry.
 type memoryStore struct {
+	versioned
+	snapshots[string]
 	mu      sync.RWMutex
 	data    map[string]*entry
-	done    chan struct{}
-	stopped bool
+	expires *expiryIndex
 }
 
 // New creates a new Store with background cleanup.
 func New() Store {
-	s := &memoryStore{
-		data: make(map[string]*entry),
-		done: make(chan struct{}),
+	return &memoryStore{
+		data:    make(map[string]*entry),
+		expires: newExpiryIndex(),
 	}
-	go s.cleanupLoop()
-	return s
 }
 
-// cleanupLoop periodically removes expired keys.
-func (s *memoryStore) cleanupLoop() {
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+// expireKey deletes a key whose TTL has passed.
+// Caller must hold s.mu for writing.
+func (s *memoryStore) expireKey(key string) {
+	delete(s.data, key)
+	s.expires.remove(key)
+	s.expires.countExpired()
+	s.touch(key)
+}
 
-	for {
-		select {
-		case <-s.done:
-			return
-		case <-ticker.C:
-			s.removeExpired()
-		}
+// removeIfExpired lazily deletes key if it has expired.
+// Caller must hold s.mu for writing.
+func (s *memoryStore) removeIfExpired(key string) {
+	if e, exists := s.data[key]; exists && e.isExpired() {
+		s.expireKey(key)
 	}
 }
 
-// removeExpired deletes all expired entries.
-func (s *memoryStore) removeExpired() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for key, e := range s.data {
-		if e.isExpired() {
-			delete(s.data, key)
-		}
-	}
+// setExpiry stores value under key to expire at the given time, and starts
+// active expiry.
+// Caller must hold s.mu for writing.
+func (s *memoryStore) setExpiry(key, value string, at time.Time) {
+	s.data[key] = &entry{value: value, expiresAt: at}
+	s.expires.set(key, at)
+	s.expires.start(&s.mu, s.expireKey)
 }
 
 // Get retrieves a value by key. Returns false if key doesn't exist or is expired.
@@ -88,7 +93,9 @@ func (s *memoryStore) Get(key string) (string, bool) {
 
 	if e.isExpired() {
 		// Lazily delete expired key
-		s.Delete(key)
+		s.mu.Lock()
+		s.removeIfExpired(key)
+		s.mu.Unlock()
 		return "", false
 	}
 
@@ -100,9 +107,13 @@ func (s *memoryStore) Set(key string, value string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	s.data[key] = &entry{
 		value: value,
 	}
+	s.expires.remove(key)
+	s.touch(key)
 }
 
 // SetWithTTL stores a key-value pair that expires after the given duration.
@@ -110,10 +121,10 @@ func (s *memoryStore) SetWithTTL(key string, value string, ttl time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.data[key] = &entry{
-		value:     value,
-		expiresAt: time.Now().Add(ttl),
-	}
+	s.preserve(key)
+	s.removeIfExpired(key)
+	s.setExpiry(key, value, time.Now().Add(ttl))
+	s.touch(key)
 }
 
 // Delete removes a key from the store. Returns true if the key existed.
@@ -121,13 +132,30 @@ func (s *memoryStore) Delete(key string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.preserve(key)
+	s.removeIfExpired(key)
 	_, exists := s.data[key]
 	if exists {
 		delete(s.data, key)
+		s.expires.remove(key)
+		s.touch(key)
 	}
 	return exists
 }
 
+// Flush removes all keys from the store.
+func (s *memoryStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserveAll()
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]*entry)
+	s.expires.clear()
+}
+
 // Keys returns all non-expired keys in the store.
 func (s *memoryStore) Keys() []string {
 	s.mu.RLock()
@@ -142,6 +170,14 @@ func (s *memoryStore) Keys() []string {
 	return keys
 }
 
+// Len returns the number of keys in the store. Like Redis's DBSIZE, it counts
+// keys that have expired but haven't been deleted yet.
+func (s *memoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
 // TTL returns the remaining time-to-live for a key.
 // Returns (0, false) if the key doesn't exist or has no TTL.
 // Returns (duration, true) if the key has a TTL set.
@@ -170,15 +206,73 @@ func (s *memoryStore) TTL(key string) (time.Duration, bool) {
 	return remaining, true
 }
 
-// Close stops the background cleanup goroutine.
-func (s *memoryStore) Close() {
+// Expire sets the time at which a key expires.
+// A time that is not in the future deletes the key immediately.
+// Returns false if the key doesn't exist.
+func (s *memoryStore) Expire(key string, at time.Time) bool {
 	s.mu.Lock()
-	if s.stopped {
-		s.mu.Unlock()
-		return
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	e, exists := s.data[key]
+	if !exists || e.isExpired() {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		delete(s.data, key)
+		s.expires.remove(key)
+	} else {
+		s.setExpiry(key, e.value, at)
+	}
+	s.touch(key)
+	return true
+}
+
+// Persist removes the expiration of a key.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *memoryStore) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	e, exists := s.data[key]
+	if !exists || e.expiresAt.IsZero() || e.isExpired() {
+		return false
 	}
-	s.stopped = true
-	s.mu.Unlock()
 
-	close(s.done)
+	s.data[key] = &entry{value: e.value}
+	s.expires.remove(key)
+	s.touch(key)
+	return true
+}
+
+// ExpiresAt returns the time at which a key expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *memoryStore) ExpiresAt(key string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, exists := s.data[key]
+	if !exists || e.expiresAt.IsZero() || e.isExpired() {
+		return time.Time{}, false
+	}
+	return e.expiresAt, true
+}
+
+// SetExpiryConfig tunes active expiration.
+func (s *memoryStore) SetExpiryConfig(cfg ExpiryConfig) {
+	s.expires.setConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics.
+func (s *memoryStore) ExpiryStats() ExpiryStats {
+	return s.expires.stats()
+}
+
+// Close stops the background cleanup goroutine.
+func (s *memoryStore) Close() {
+	s.expires.stop()
 }
@@ -337,6 +337,36 @@ func TestConcurrentTTL(t *testing.T) {
 	wg.Wait()
 }
 
+// TestConcurrentExpireAndRead runs EXPIRE and PERSIST against GET and TTL on
+// the same key; run with -race.
+func TestConcurrentExpireAndRead(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.Set("key", "value")
+
+	var wg sync.WaitGroup
+	const numOps = 1000
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range numOps {
+			s.Expire("key", time.Now().Add(time.Hour))
+			s.Persist("key")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range numOps {
+			if v, ok := s.Get("key"); !ok || v != "value" {
+				t.Errorf("Get() = %q, %v, want value", v, ok)
+				return
+			}
+			s.TTL("key")
+		}
+	}()
+	wg.Wait()
+}
+
 func TestCloseIdempotent(t *testing.T) {
 	s := New()
 
@@ -0,0 +1,1280 @@
+// Package store provides stream storage implementation.
+package store
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stream errors, worded as Redis replies them.
+var (
+	ErrStreamIDTooSmall  = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero      = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamExhausted   = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+	ErrStreamKeyRequired = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	ErrBusyGroup         = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrNoGroup           = errors.New("NOGROUP No such key or consumer group")
+)
+
+// StreamID identifies a stream entry: a millisecond timestamp and a sequence
+// number that orders entries added within the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the greatest possible stream ID.
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// String formats the ID as "<ms>-<seq>".
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare returns -1, 0 or 1 if id is less than, equal to or greater than other.
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Less returns true if id sorts before other.
+func (id StreamID) Less(other StreamID) bool {
+	return id.Compare(other) < 0
+}
+
+// IsZero returns true for 0-0.
+func (id StreamID) IsZero() bool {
+	return id == StreamID{}
+}
+
+// Next returns the smallest ID greater than id. Returns false if id is MaxStreamID.
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev returns the greatest ID less than id. Returns false if id is 0-0.
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// StreamEntry is a stream entry: its ID and its field-value pairs, flattened.
+// Entries are never modified once added, so their Fields may be shared.
+// Fields is nil for an entry that is pending but was deleted from the stream.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// StreamTrimStrategy selects how a stream is trimmed.
+type StreamTrimStrategy int
+
+// Trim strategies of XADD and XTRIM.
+const (
+	TrimNone   StreamTrimStrategy = iota
+	TrimMaxLen                    // Keep at most MaxLen entries
+	TrimMinID                     // Evict entries with an ID below MinID
+)
+
+// StreamNodeEntries is how many entries Redis packs in a node of a stream by
+// default. Approximate trims evict entries in multiples of it, as Redis evicts
+// only whole nodes.
+const StreamNodeEntries = 100
+
+// StreamTrim describes a trim of the oldest stream entries.
+type StreamTrim struct {
+	Strategy StreamTrimStrategy
+	MaxLen   int64
+	MinID    StreamID
+	Approx   bool  // "~": evict only whole nodes of StreamNodeEntries entries
+	Limit    int64 // Maximum number of entries to evict; 0 means no limit
+}
+
+// XAddArgs are the options of XADD.
+type XAddArgs struct {
+	ID         StreamID
+	AutoID     bool // "*": generate the whole ID
+	AutoSeq    bool // "<ms>-*": generate only the sequence number
+	NoMkStream bool
+	Trim       StreamTrim
+}
+
+// StreamGroupStart is the position from which a consumer group delivers entries.
+type StreamGroupStart struct {
+	ID          StreamID
+	LastEntry   bool  // "$": start after the stream's last entry
+	EntriesRead int64 // ENTRIESREAD; negative to estimate it from the ID
+}
+
+// XClaimArgs are the options of XCLAIM.
+type XClaimArgs struct {
+	MinIdle       time.Duration
+	DeliveryTime  time.Time // Set by IDLE or TIME; zero means now
+	RetryCount    int64
+	HasRetryCount bool
+	Force         bool
+	JustID        bool
+	LastID        StreamID
+}
+
+// StreamPending is an entry of a consumer group's pending entries list.
+type StreamPending struct {
+	ID            StreamID
+	Consumer      string
+	Idle          time.Duration
+	DeliveryCount int64
+}
+
+// StreamPendingSummary is the summary form of XPENDING.
+type StreamPendingSummary struct {
+	Count       int
+	First, Last StreamID
+	Consumers   []StreamConsumerInfo // Name and Pending only, sorted by name
+}
+
+// StreamInfo describes a stream, as reported by XINFO STREAM.
+type StreamInfo struct {
+	Length       int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	FirstID      StreamID
+	Groups       int
+	First, Last  *StreamEntry // nil if the stream is empty
+}
+
+// StreamGroupInfo describes a consumer group, as reported by XINFO GROUPS.
+type StreamGroupInfo struct {
+	Name        string
+	Consumers   int
+	Pending     int
+	LastID      StreamID
+	EntriesRead int64 // -1 if unknown
+	Lag         int64 // -1 if unknown
+}
+
+// StreamConsumerInfo describes a consumer, as reported by XINFO CONSUMERS.
+type StreamConsumerInfo struct {
+	Name     string
+	Pending  int
+	Idle     time.Duration // Since the consumer last attempted an interaction
+	Inactive time.Duration // Since the consumer last read or claimed an entry; -1 if never
+}
+
+// StreamStore defines the interface for stream operations.
+// Methods that take a group return ErrNoGroup if the key or group doesn't exist.
+type StreamStore interface {
+	XAdd(key string, args XAddArgs, fields []string) (StreamID, bool, error)
+	XLen(key string) int
+	XRange(key string, start, end StreamID, count int, reverse bool) []StreamEntry
+	XDel(key string, ids ...StreamID) int
+	XTrim(key string, trim StreamTrim) int64
+	XLastID(key string) StreamID
+	XGroupCreate(key, group string, start StreamGroupStart, mkStream bool) error
+	XGroupSetID(key, group string, start StreamGroupStart) error
+	XGroupDestroy(key, group string) (bool, error)
+	XGroupCreateConsumer(key, group, consumer string) (bool, error)
+	XGroupDelConsumer(key, group, consumer string) (int, error)
+	HasGroup(key, group string) bool
+	XReadGroup(key, group, consumer string, after StreamID, newOnly bool, count int, noAck bool) ([]StreamEntry, error)
+	XAck(key, group string, ids ...StreamID) int
+	XPendingSummary(key, group string) (StreamPendingSummary, error)
+	XPending(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]StreamPending, error)
+	XClaim(key, group, consumer string, args XClaimArgs, ids ...StreamID) ([]StreamEntry, error)
+	XAutoClaim(key, group, consumer string, minIdle time.Duration, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error)
+	XInfoStream(key string) (StreamInfo, bool)
+	XInfoGroups(key string) ([]StreamGroupInfo, bool)
+	XInfoConsumers(key, group string) ([]StreamConsumerInfo, error)
+	KeyType(key string) string
+	Delete(key string) bool
+	Keys() []string
+	Len() int
+	Flush()
+	Close()
+	Expirable
+	ExpiryTuner
+}
+
+// stream is a single stream. Entries are kept in ID order, so lookups and
+// range starts are binary searches.
+type stream struct {
+	entries      []StreamEntry
+	evicted      int // Slots trimmed from the front of entries' array since it was last compacted
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+	groups       map[string]*consumerGroup
+}
+
+// consumerGroup tracks which entries a group has delivered and which are unacknowledged.
+type consumerGroup struct {
+	lastID      StreamID
+	entriesRead int64 // -1 if unknown
+	pending     map[StreamID]*pendingEntry
+	consumers   map[string]*streamConsumer
+}
+
+// pendingEntry is an entry delivered to a consumer but not yet acknowledged.
+type pendingEntry struct {
+	consumer      *streamConsumer
+	deliveryTime  time.Time
+	deliveryCount int64
+}
+
+// streamConsumer is a member of a consumer group.
+type streamConsumer struct {
+	name       string
+	seenTime   time.Time
+	activeTime time.Time // Zero if the consumer never read or claimed an entry
+	pending    map[StreamID]struct{}
+}
+
+// newStream creates an empty stream.
+func newStream() *stream {
+	return &stream{groups: make(map[string]*consumerGroup)}
+}
+
+// search returns the index of the first entry with an ID not less than id.
+func (st *stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+}
+
+// find returns the entry with the given ID.
+func (st *stream) find(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// firstID returns the ID of the first entry, or 0-0 if the stream is empty.
+func (st *stream) firstID() StreamID {
+	if len(st.entries) == 0 {
+		return StreamID{}
+	}
+	return st.entries[0].ID
+}
+
+// nextID works out the ID of a new entry from the XADD arguments.
+func (st *stream) nextID(args XAddArgs, now time.Time) (StreamID, error) {
+	last := st.lastID
+	switch {
+	case args.AutoID:
+		ms := uint64(now.UnixMilli())
+		if ms > last.Ms {
+			return StreamID{Ms: ms}, nil
+		}
+		id, ok := last.Next()
+		if !ok {
+			return StreamID{}, ErrStreamExhausted
+		}
+		return id, nil
+	case args.AutoSeq:
+		if args.ID.Ms < last.Ms {
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+		if args.ID.Ms == last.Ms {
+			if last.Seq == math.MaxUint64 {
+				return StreamID{}, ErrStreamIDTooSmall
+			}
+			return StreamID{Ms: last.Ms, Seq: last.Seq + 1}, nil
+		}
+		if args.ID.Ms == 0 {
+			return StreamID{Seq: 1}, nil
+		}
+		return StreamID{Ms: args.ID.Ms}, nil
+	}
+
+	if args.ID.IsZero() {
+		return StreamID{}, ErrStreamIDZero
+	}
+	if !last.Less(args.ID) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return args.ID, nil
+}
+
+// trim evicts the oldest entries as described by t. Returns the number evicted.
+func (st *stream) trim(t StreamTrim) int64 {
+	var n int64
+	switch t.Strategy {
+	case TrimMaxLen:
+		n = max(int64(len(st.entries))-t.MaxLen, 0)
+	case TrimMinID:
+		n = int64(st.search(t.MinID))
+	}
+	if t.Limit > 0 {
+		n = min(n, t.Limit)
+	}
+	if t.Approx {
+		n -= n % StreamNodeEntries
+	}
+	if n == 0 {
+		return 0
+	}
+	// Reslice rather than copy, so a capped XADD doesn't copy the whole
+	// stream. Evicted slots are cleared so their fields can be collected, and
+	// the array is compacted once they outnumber the entries left.
+	clear(st.entries[:n])
+	st.entries = st.entries[n:]
+	st.evicted += int(n)
+	if st.evicted > len(st.entries) {
+		st.entries = append([]StreamEntry(nil), st.entries...)
+		st.evicted = 0
+	}
+	return n
+}
+
+// rangeEntries returns up to count entries with IDs within [start, end],
+// in descending order if reverse is set. A count of 0 or less means no limit.
+func (st *stream) rangeEntries(start, end StreamID, count int, reverse bool) []StreamEntry {
+	result := []StreamEntry{}
+	if end.Less(start) {
+		return result
+	}
+
+	lo := st.search(start)
+	hi := st.search(end)
+	if hi < len(st.entries) && st.entries[hi].ID == end {
+		hi++
+	}
+
+	if reverse {
+		for i := hi - 1; i >= lo && (count <= 0 || len(result) < count); i-- {
+			result = append(result, st.entries[i])
+		}
+	} else {
+		for i := lo; i < hi && (count <= 0 || len(result) < count); i++ {
+			result = append(result, st.entries[i])
+		}
+	}
+	return result
+}
+
+// hasTombstonesAfter returns true if an entry with an ID not less than id was
+// deleted, which makes entry counts derived from IDs unreliable.
+func (st *stream) hasTombstonesAfter(id StreamID) bool {
+	if len(st.entries) == 0 || st.maxDeletedID.IsZero() {
+		return false
+	}
+	return !st.maxDeletedID.Less(id)
+}
+
+// estimateEntriesRead returns how many entries a group that delivered up to id
+// has read since the stream was created, or -1 if it can't be known.
+func (st *stream) estimateEntriesRead(id StreamID) int64 {
+	added := int64(st.entriesAdded)
+	if added == 0 {
+		return 0
+	}
+	if len(st.entries) == 0 && !st.lastID.Less(id) {
+		return added
+	}
+	switch id.Compare(st.lastID) {
+	case 0:
+		return added
+	case 1:
+		return -1
+	}
+
+	// Without deletions after the first entry, everything before it was trimmed
+	if st.maxDeletedID.IsZero() || st.maxDeletedID.Less(st.firstID()) {
+		switch id.Compare(st.firstID()) {
+		case -1:
+			return added - int64(len(st.entries))
+		case 0:
+			return added - int64(len(st.entries)) + 1
+		}
+	}
+	return -1
+}
+
+// lag returns how many entries the group has yet to read, or -1 if it can't be known.
+func (st *stream) lag(g *consumerGroup) int64 {
+	if st.entriesAdded == 0 {
+		return 0
+	}
+	entriesRead := g.entriesRead
+	if entriesRead < 0 || st.hasTombstonesAfter(g.lastID) {
+		entriesRead = st.estimateEntriesRead(g.lastID)
+	}
+	if entriesRead < 0 {
+		return -1
+	}
+	return int64(st.entriesAdded) - entriesRead
+}
+
+// startGroup applies a StreamGroupStart to a group.
+func (st *stream) startGroup(g *consumerGroup, start StreamGroupStart) {
+	g.lastID = start.ID
+	if start.LastEntry {
+		g.lastID = st.lastID
+	}
+	g.entriesRead = start.EntriesRead
+	if g.entriesRead < 0 {
+		g.entriesRead = st.estimateEntriesRead(g.lastID)
+	}
+}
+
+// consumer returns the named consumer, creating it if needed, and marks it as seen.
+func (g *consumerGroup) consumer(name string, now time.Time) *streamConsumer {
+	c, exists := g.consumers[name]
+	if !exists {
+		c = &streamConsumer{name: name, pending: make(map[StreamID]struct{})}
+		g.consumers[name] = c
+	}
+	c.seenTime = now
+	return c
+}
+
+// assign records id as delivered to c, moving it from another consumer if needed.
+func (g *consumerGroup) assign(id StreamID, c *streamConsumer, deliveryTime time.Time) *pendingEntry {
+	pe, exists := g.pending[id]
+	if !exists {
+		pe = &pendingEntry{}
+		g.pending[id] = pe
+	} else if pe.consumer != c {
+		delete(pe.consumer.pending, id)
+	}
+	pe.consumer = c
+	pe.deliveryTime = deliveryTime
+	c.pending[id] = struct{}{}
+	return pe
+}
+
+// ack removes id from the pending entries list. Returns false if it wasn't pending.
+func (g *consumerGroup) ack(id StreamID) bool {
+	pe, exists := g.pending[id]
+	if !exists {
+		return false
+	}
+	delete(pe.consumer.pending, id)
+	delete(g.pending, id)
+	return true
+}
+
+// sortedIDs returns the keys of a set of IDs in ascending order.
+func sortedIDs[V any](ids map[StreamID]V) []StreamID {
+	sorted := make([]StreamID, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Less(sorted[j])
+	})
+	return sorted
+}
+
+// MemoryStreamStore is a thread-safe in-memory implementation of StreamStore.
+type MemoryStreamStore struct {
+	versioned
+	snapshots[StreamData]
+	mu      sync.RWMutex
+	data    map[string]*stream
+	expires *expiryIndex
+}
+
+// NewStreamStore creates a new MemoryStreamStore.
+func NewStreamStore() *MemoryStreamStore {
+	return &MemoryStreamStore{
+		data:    make(map[string]*stream),
+		expires: newExpiryIndex(),
+	}
+}
+
+// XAdd appends an entry to a stream, creating the stream unless args.NoMkStream is set,
+// and then trims it. Returns the new entry's ID, or false if the stream doesn't
+// exist and NoMkStream is set.
+func (s *MemoryStreamStore) XAdd(key string, args XAddArgs, fields []string) (StreamID, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	st, exists := s.data[key]
+	if !exists {
+		if args.NoMkStream {
+			return StreamID{}, false, nil
+		}
+		st = newStream()
+	}
+
+	id, err := st.nextID(args, time.Now())
+	if err != nil {
+		return StreamID{}, true, err
+	}
+
+	st.entries = append(st.entries, StreamEntry{ID: id, Fields: append([]string(nil), fields...)})
+	st.lastID = id
+	st.entriesAdded++
+	st.trim(args.Trim)
+	s.data[key] = st
+	s.touch(key)
+	return id, true, nil
+}
+
+// XLen returns the number of entries in a stream.
+func (s *MemoryStreamStore) XLen(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.lookup(key)
+	if !exists {
+		return 0
+	}
+	return len(st.entries)
+}
+
+// XRange returns up to count entries with IDs within [start, end], in descending
+// order if reverse is set. A count of 0 or less means no limit.
+func (s *MemoryStreamStore) XRange(key string, start, end StreamID, count int, reverse bool) []StreamEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.lookup(key)
+	if !exists {
+		return []StreamEntry{}
+	}
+	return st.rangeEntries(start, end, count, reverse)
+}
+
+// XDel removes entries from a stream. Returns the number removed.
+// Consumer groups keep deleted entries pending until they are acknowledged or claimed.
+func (s *MemoryStreamStore) XDel(key string, ids ...StreamID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	st, exists := s.data[key]
+	if !exists {
+		return 0
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		i := st.search(id)
+		if i == len(st.entries) || st.entries[i].ID != id {
+			continue
+		}
+		st.entries = append(st.entries[:i], st.entries[i+1:]...)
+		if st.maxDeletedID.Less(id) {
+			st.maxDeletedID = id
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		s.touch(key)
+	}
+	return deleted
+}
+
+// XTrim evicts the oldest entries of a stream. Returns the number evicted.
+func (s *MemoryStreamStore) XTrim(key string, trim StreamTrim) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	st, exists := s.data[key]
+	if !exists {
+		return 0
+	}
+
+	n := st.trim(trim)
+	if n > 0 {
+		s.touch(key)
+	}
+	return n
+}
+
+// XLastID returns the ID of the last entry ever added to a stream,
+// or 0-0 if the stream doesn't exist.
+func (s *MemoryStreamStore) XLastID(key string) StreamID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.lookup(key)
+	if !exists {
+		return StreamID{}
+	}
+	return st.lastID
+}
+
+// XGroupCreate creates a consumer group. If the stream doesn't exist it is created
+// when mkStream is set; otherwise ErrStreamKeyRequired is returned.
+// Returns ErrBusyGroup if the group already exists.
+func (s *MemoryStreamStore) XGroupCreate(key, group string, start StreamGroupStart, mkStream bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	st, exists := s.data[key]
+	if !exists {
+		if !mkStream {
+			return ErrStreamKeyRequired
+		}
+		st = newStream()
+		s.data[key] = st
+	}
+	if _, exists := st.groups[group]; exists {
+		return ErrBusyGroup
+	}
+
+	g := &consumerGroup{
+		pending:   make(map[StreamID]*pendingEntry),
+		consumers: make(map[string]*streamConsumer),
+	}
+	st.startGroup(g, start)
+	st.groups[group] = g
+	s.touch(key)
+	return nil
+}
+
+// XGroupSetID sets the last delivered ID of a consumer group.
+func (s *MemoryStreamStore) XGroupSetID(key, group string, start StreamGroupStart) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := s.group(key, group)
+	if err != nil {
+		return err
+	}
+	st.startGroup(g, start)
+	s.touch(key)
+	return nil
+}
+
+// XGroupDestroy removes a consumer group and its pending entries.
+// Returns false if the group doesn't exist, or ErrStreamKeyRequired if the stream doesn't.
+func (s *MemoryStreamStore) XGroupDestroy(key, group string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	st, exists := s.data[key]
+	if !exists {
+		return false, ErrStreamKeyRequired
+	}
+	if _, exists := st.groups[group]; !exists {
+		return false, nil
+	}
+	delete(st.groups, group)
+	s.touch(key)
+	return true, nil
+}
+
+// XGroupCreateConsumer adds a consumer to a group. Returns false if it already existed.
+func (s *MemoryStreamStore) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := s.group(key, group)
+	if err != nil {
+		return false, err
+	}
+	if _, exists := g.consumers[consumer]; exists {
+		return false, nil
+	}
+	g.consumer(consumer, time.Now())
+	s.touch(key)
+	return true, nil
+}
+
+// XGroupDelConsumer removes a consumer from a group, dropping its pending entries.
+// Returns the number of entries it had pending.
+func (s *MemoryStreamStore) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := s.group(key, group)
+	if err != nil {
+		return 0, err
+	}
+	c, exists := g.consumers[consumer]
+	if !exists {
+		return 0, nil
+	}
+
+	pending := len(c.pending)
+	for id := range c.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, consumer)
+	s.touch(key)
+	return pending, nil
+}
+
+// HasGroup returns true if the stream exists and has the consumer group.
+func (s *MemoryStreamStore) HasGroup(key, group string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.lookup(key)
+	if !exists {
+		return false
+	}
+	_, exists = st.groups[group]
+	return exists
+}
+
+// XReadGroup reads entries on behalf of a consumer, creating the consumer if needed.
+//
+// With newOnly set (ID ">") it delivers up to count entries the group has not
+// delivered yet and, unless noAck is set, adds them to the pending entries list.
+// Otherwise it returns up to count of the consumer's own pending entries with IDs
+// greater than after; entries deleted from the stream are returned with nil Fields.
+// A count of 0 or less means no limit.
+func (s *MemoryStreamStore) XReadGroup(key, group, consumer string, after StreamID, newOnly bool, count int, noAck bool) ([]StreamEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := s.group(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, known := g.consumers[consumer]
+	c := g.consumer(consumer, now)
+	if !known {
+		s.touch(key)
+	}
+	result := []StreamEntry{}
+
+	if !newOnly {
+		for _, id := range sortedIDs(c.pending) {
+			if count > 0 && len(result) == count {
+				break
+			}
+			if !after.Less(id) {
+				continue
+			}
+			entry, _ := st.find(id)
+			entry.ID = id
+			result = append(result, entry)
+		}
+		return result, nil
+	}
+
+	start, ok := g.lastID.Next()
+	if !ok {
+		return result, nil
+	}
+	result = st.rangeEntries(start, MaxStreamID, count, false)
+	for _, entry := range result {
+		if g.entriesRead >= 0 && !st.hasTombstonesAfter(entry.ID) {
+			g.entriesRead++
+		} else {
+			g.entriesRead = st.estimateEntriesRead(entry.ID)
+		}
+		g.lastID = entry.ID
+
+		if !noAck {
+			pe := g.assign(entry.ID, c, now)
+			pe.deliveryCount = 1
+		}
+	}
+	if len(result) > 0 {
+		c.activeTime = now
+		s.touch(key)
+	}
+	return result, nil
+}
+
+// XAck acknowledges pending entries. Returns the number that were pending.
+func (s *MemoryStreamStore) XAck(key, group string, ids ...StreamID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := s.group(key, group)
+	if err != nil {
+		return 0
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if g.ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		s.touch(key)
+	}
+	return acked
+}
+
+// XPendingSummary summarizes a consumer group's pending entries.
+func (s *MemoryStreamStore) XPendingSummary(key, group string) (StreamPendingSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, g, err := s.groupReadOnly(key, group)
+	if err != nil {
+		return StreamPendingSummary{}, err
+	}
+
+	summary := StreamPendingSummary{Count: len(g.pending)}
+	if summary.Count == 0 {
+		return summary, nil
+	}
+
+	ids := sortedIDs(g.pending)
+	summary.First = ids[0]
+	summary.Last = ids[len(ids)-1]
+	for _, c := range g.consumers {
+		if len(c.pending) > 0 {
+			summary.Consumers = append(summary.Consumers, StreamConsumerInfo{Name: c.name, Pending: len(c.pending)})
+		}
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool {
+		return summary.Consumers[i].Name < summary.Consumers[j].Name
+	})
+	return summary, nil
+}
+
+// XPending returns up to count pending entries with IDs within [start, end] that have
+// been idle for at least minIdle, optionally only those of one consumer.
+func (s *MemoryStreamStore) XPending(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]StreamPending, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, g, err := s.groupReadOnly(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := []StreamPending{}
+	for _, id := range sortedIDs(g.pending) {
+		if len(result) == count {
+			break
+		}
+		if id.Less(start) || end.Less(id) {
+			continue
+		}
+		pe := g.pending[id]
+		if consumer != "" && pe.consumer.name != consumer {
+			continue
+		}
+		idle := max(now.Sub(pe.deliveryTime), 0)
+		if idle < minIdle {
+			continue
+		}
+		result = append(result, StreamPending{
+			ID:            id,
+			Consumer:      pe.consumer.name,
+			Idle:          idle,
+			DeliveryCount: pe.deliveryCount,
+		})
+	}
+	return result, nil
+}
+
+// XClaim transfers pending entries idle for at least args.MinIdle to a consumer.
+// Entries that were deleted from the stream are dropped from the pending entries
+// list instead. With args.Force, entries that exist in the stream but aren't
+// pending are claimed too. Returns the claimed entries; with args.JustID their
+// Fields are nil.
+func (s *MemoryStreamStore) XClaim(key, group, consumer string, args XClaimArgs, ids ...StreamID) ([]StreamEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := s.group(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deliveryTime := args.DeliveryTime
+	if deliveryTime.IsZero() || deliveryTime.After(now) {
+		deliveryTime = now
+	}
+	if g.lastID.Less(args.LastID) {
+		g.lastID = args.LastID
+	}
+
+	c := g.consumer(consumer, now)
+	result := []StreamEntry{}
+	for _, id := range ids {
+		entry, inStream := st.find(id)
+		pe, pending := g.pending[id]
+		if !pending {
+			if !args.Force || !inStream {
+				continue
+			}
+		} else {
+			if !inStream {
+				g.ack(id)
+				continue
+			}
+			if args.MinIdle > 0 && now.Sub(pe.deliveryTime) < args.MinIdle {
+				continue
+			}
+		}
+
+		pe = g.assign(id, c, deliveryTime)
+		if args.HasRetryCount {
+			pe.deliveryCount = args.RetryCount
+		} else if !args.JustID {
+			pe.deliveryCount++
+		}
+		if args.JustID {
+			entry.Fields = nil
+		}
+		result = append(result, entry)
+	}
+	if len(result) > 0 {
+		c.activeTime = now
+	}
+	s.touch(key)
+	return result, nil
+}
+
+// XAutoClaim scans the pending entries list from start and claims entries idle for
+// at least minIdle, examining at most count*10 entries and claiming at most count.
+// Returns the ID to continue scanning from (0-0 when the scan is complete), the
+// claimed entries and the IDs of pending entries that were deleted from the stream,
+// which are removed from the list.
+func (s *MemoryStreamStore) XAutoClaim(key, group, consumer string, minIdle time.Duration, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := s.group(key, group)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+
+	now := time.Now()
+	c := g.consumer(consumer, now)
+	claimed := []StreamEntry{}
+	deleted := []StreamID{}
+	next := StreamID{}
+
+	attempts := count * 10
+	for _, id := range sortedIDs(g.pending) {
+		if id.Less(start) {
+			continue
+		}
+		if attempts == 0 || len(claimed) == count {
+			next = id
+			break
+		}
+		attempts--
+
+		entry, inStream := st.find(id)
+		if !inStream {
+			g.ack(id)
+			deleted = append(deleted, id)
+			continue
+		}
+		pe := g.pending[id]
+		if minIdle > 0 && now.Sub(pe.deliveryTime) < minIdle {
+			continue
+		}
+
+		pe = g.assign(id, c, now)
+		if justID {
+			entry.Fields = nil
+		} else {
+			pe.deliveryCount++
+		}
+		claimed = append(claimed, entry)
+	}
+	if len(claimed) > 0 {
+		c.activeTime = now
+	}
+	s.touch(key)
+	return next, claimed, deleted, nil
+}
+
+// XInfoStream describes a stream. Returns false if it doesn't exist.
+func (s *MemoryStreamStore) XInfoStream(key string) (StreamInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.lookup(key)
+	if !exists {
+		return StreamInfo{}, false
+	}
+
+	info := StreamInfo{
+		Length:       len(st.entries),
+		LastID:       st.lastID,
+		MaxDeletedID: st.maxDeletedID,
+		EntriesAdded: st.entriesAdded,
+		FirstID:      st.firstID(),
+		Groups:       len(st.groups),
+	}
+	if len(st.entries) > 0 {
+		first, last := st.entries[0], st.entries[len(st.entries)-1]
+		info.First, info.Last = &first, &last
+	}
+	return info, true
+}
+
+// XInfoGroups describes the consumer groups of a stream, sorted by name.
+// Returns false if the stream doesn't exist.
+func (s *MemoryStreamStore) XInfoGroups(key string) ([]StreamGroupInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.lookup(key)
+	if !exists {
+		return nil, false
+	}
+
+	groups := make([]StreamGroupInfo, 0, len(st.groups))
+	for name, g := range st.groups {
+		groups = append(groups, StreamGroupInfo{
+			Name:        name,
+			Consumers:   len(g.consumers),
+			Pending:     len(g.pending),
+			LastID:      g.lastID,
+			EntriesRead: g.entriesRead,
+			Lag:         st.lag(g),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups, true
+}
+
+// XInfoConsumers describes the consumers of a group, sorted by name.
+func (s *MemoryStreamStore) XInfoConsumers(key, group string) ([]StreamConsumerInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, g, err := s.groupReadOnly(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	consumers := make([]StreamConsumerInfo, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		inactive := time.Duration(-1)
+		if !c.activeTime.IsZero() {
+			inactive = max(now.Sub(c.activeTime), 0)
+		}
+		consumers = append(consumers, StreamConsumerInfo{
+			Name:     c.name,
+			Pending:  len(c.pending),
+			Idle:     max(now.Sub(c.seenTime), 0),
+			Inactive: inactive,
+		})
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers, nil
+}
+
+// KeyType returns the type of the key ("stream" or "none").
+func (s *MemoryStreamStore) KeyType(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); exists {
+		return TypeStream
+	}
+	return TypeNone
+}
+
+// Flush removes all streams from the store.
+func (s *MemoryStreamStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserveAll()
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]*stream)
+	s.expires.clear()
+}
+
+// Delete removes a stream. Returns true if the key existed.
+func (s *MemoryStreamStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	_, exists := s.data[key]
+	if exists {
+		delete(s.data, key)
+		s.expires.remove(key)
+		s.touch(key)
+	}
+	return exists
+}
+
+// Keys returns the keys of all streams in the store.
+func (s *MemoryStreamStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if !s.expires.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of keys in the store. Like Redis's DBSIZE, it counts
+// keys that have expired but haven't been deleted yet.
+func (s *MemoryStreamStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Expire sets the time at which a stream expires.
+// A time that is not in the future deletes the stream immediately.
+// Returns false if the key doesn't exist.
+func (s *MemoryStreamStore) Expire(key string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, exists := s.data[key]; !exists {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		delete(s.data, key)
+		s.expires.remove(key)
+	} else {
+		s.expires.set(key, at)
+		s.expires.start(&s.mu, s.expireKey)
+	}
+	s.touch(key)
+	return true
+}
+
+// Persist removes the expiration of a stream.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemoryStreamStore) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, ok := s.expires.get(key); !ok {
+		return false
+	}
+	s.expires.remove(key)
+	s.touch(key)
+	return true
+}
+
+// ExpiresAt returns the time at which a stream expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemoryStreamStore) ExpiresAt(key string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); !exists {
+		return time.Time{}, false
+	}
+	return s.expires.get(key)
+}
+
+// Close stops the background cleanup goroutine.
+func (s *MemoryStreamStore) Close() {
+	s.expires.stop()
+}
+
+// lookup returns the stream stored at key, treating expired streams as missing.
+// Caller must hold s.mu.
+func (s *MemoryStreamStore) lookup(key string) (*stream, bool) {
+	st, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, time.Now()) {
+		return nil, false
+	}
+	return st, true
+}
+
+// group returns a stream and one of its consumer groups for writing.
+// Caller must hold s.mu for writing.
+func (s *MemoryStreamStore) group(key, group string) (*stream, *consumerGroup, error) {
+	s.preserve(key)
+	s.removeIfExpired(key)
+	return s.groupReadOnly(key, group)
+}
+
+// groupReadOnly returns a stream and one of its consumer groups.
+// Caller must hold s.mu.
+func (s *MemoryStreamStore) groupReadOnly(key, group string) (*stream, *consumerGroup, error) {
+	st, exists := s.lookup(key)
+	if !exists {
+		return nil, nil, ErrNoGroup
+	}
+	g, exists := st.groups[group]
+	if !exists {
+		return nil, nil, ErrNoGroup
+	}
+	return st, g, nil
+}
+
+// removeIfExpired lazily deletes key if it has expired.
+// Caller must hold s.mu for writing.
+func (s *MemoryStreamStore) removeIfExpired(key string) {
+	if s.expires.isExpired(key, time.Now()) {
+		s.expireKey(key)
+	}
+}
+
+// expireKey deletes a stream whose TTL has passed.
+// Caller must hold s.mu for writing.
+func (s *MemoryStreamStore) expireKey(key string) {
+	delete(s.data, key)
+	s.expires.remove(key)
+	s.expires.countExpired()
+	s.touch(key)
+}
+
+// SetExpiryConfig tunes active expiration.
+func (s *MemoryStreamStore) SetExpiryConfig(cfg ExpiryConfig) {
+	s.expires.setConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics.
+func (s *MemoryStreamStore) ExpiryStats() ExpiryStats {
+	return s.expires.stats()
+}
@@ -0,0 +1,553 @@
+package store
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStreamStore(t *testing.T) *MemoryStreamStore {
+	t.Helper()
+	s := NewStreamStore()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// addEntries appends entries with IDs 1-0 through n-0 to a stream.
+func addEntries(t *testing.T, s *MemoryStreamStore, key string, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		if _, _, err := s.XAdd(key, XAddArgs{ID: StreamID{Ms: uint64(i)}}, []string{"n", "v"}); err != nil {
+			t.Fatalf("XAdd(%d-0) failed: %v", i, err)
+		}
+	}
+}
+
+// entryIDs returns the IDs of entries.
+func entryIDs(entries []StreamEntry) []StreamID {
+	ids := make([]StreamID, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestStreamIDNextPrev(t *testing.T) {
+	tests := []struct {
+		id       StreamID
+		next     StreamID
+		nextOK   bool
+		prev     StreamID
+		prevOK   bool
+		asString string
+	}{
+		{StreamID{Ms: 1, Seq: 1}, StreamID{Ms: 1, Seq: 2}, true, StreamID{Ms: 1}, true, "1-1"},
+		{StreamID{Ms: 1, Seq: math.MaxUint64}, StreamID{Ms: 2}, true, StreamID{Ms: 1, Seq: math.MaxUint64 - 1}, true, "1-18446744073709551615"},
+		{StreamID{Ms: 2}, StreamID{Ms: 2, Seq: 1}, true, StreamID{Ms: 1, Seq: math.MaxUint64}, true, "2-0"},
+		{StreamID{}, StreamID{Seq: 1}, true, StreamID{}, false, "0-0"},
+		{MaxStreamID, MaxStreamID, false, StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64 - 1}, true, "18446744073709551615-18446744073709551615"},
+	}
+
+	for _, tt := range tests {
+		if next, ok := tt.id.Next(); next != tt.next || ok != tt.nextOK {
+			t.Errorf("%v.Next() = %v, %v, want %v, %v", tt.id, next, ok, tt.next, tt.nextOK)
+		}
+		if prev, ok := tt.id.Prev(); prev != tt.prev || ok != tt.prevOK {
+			t.Errorf("%v.Prev() = %v, %v, want %v, %v", tt.id, prev, ok, tt.prev, tt.prevOK)
+		}
+		if got := tt.id.String(); got != tt.asString {
+			t.Errorf("String() = %q, want %q", got, tt.asString)
+		}
+	}
+}
+
+func TestXAddIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    XAddArgs
+		want    StreamID
+		wantErr error
+	}{
+		{"explicit", XAddArgs{ID: StreamID{Ms: 6}}, StreamID{Ms: 6}, nil},
+		{"equal to last", XAddArgs{ID: StreamID{Ms: 5, Seq: 2}}, StreamID{}, ErrStreamIDTooSmall},
+		{"smaller than last", XAddArgs{ID: StreamID{Ms: 4}}, StreamID{}, ErrStreamIDTooSmall},
+		{"auto sequence same ms", XAddArgs{ID: StreamID{Ms: 5}, AutoSeq: true}, StreamID{Ms: 5, Seq: 3}, nil},
+		{"auto sequence later ms", XAddArgs{ID: StreamID{Ms: 9}, AutoSeq: true}, StreamID{Ms: 9}, nil},
+		{"auto sequence earlier ms", XAddArgs{ID: StreamID{Ms: 4}, AutoSeq: true}, StreamID{}, ErrStreamIDTooSmall},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStreamStore(t)
+			s.XAdd("s", XAddArgs{ID: StreamID{Ms: 5, Seq: 2}}, []string{"f", "v"})
+
+			id, _, err := s.XAdd("s", tt.args, []string{"f", "v"})
+			if err != tt.wantErr {
+				t.Fatalf("XAdd() error = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.want {
+				t.Errorf("XAdd() = %v, want %v", id, tt.want)
+			}
+		})
+	}
+}
+
+func TestXAddEdgeCases(t *testing.T) {
+	s := newTestStreamStore(t)
+
+	if _, _, err := s.XAdd("s", XAddArgs{}, []string{"f", "v"}); err != ErrStreamIDZero {
+		t.Errorf("XAdd(0-0) error = %v, want ErrStreamIDZero", err)
+	}
+	if id, _, _ := s.XAdd("s", XAddArgs{AutoSeq: true}, []string{"f", "v"}); id != (StreamID{Seq: 1}) {
+		t.Errorf("XAdd(0-*) = %v, want 0-1", id)
+	}
+
+	before := uint64(time.Now().UnixMilli())
+	id, _, err := s.XAdd("auto", XAddArgs{AutoID: true}, []string{"f", "v"})
+	if err != nil || id.Ms < before || id.Seq != 0 {
+		t.Errorf("XAdd(*) = %v, %v, want a current timestamp", id, err)
+	}
+
+	// IDs generated for a stream whose last ID is in the future still increase
+	s.XAdd("future", XAddArgs{ID: StreamID{Ms: math.MaxUint64 - 1, Seq: 7}}, []string{"f", "v"})
+	if id, _, _ := s.XAdd("future", XAddArgs{AutoID: true}, []string{"f", "v"}); id != (StreamID{Ms: math.MaxUint64 - 1, Seq: 8}) {
+		t.Errorf("XAdd(*) after a future ID = %v, want the next sequence", id)
+	}
+
+	s.XAdd("full", XAddArgs{ID: MaxStreamID}, []string{"f", "v"})
+	if _, _, err := s.XAdd("full", XAddArgs{AutoID: true}, []string{"f", "v"}); err != ErrStreamExhausted {
+		t.Errorf("XAdd(*) after the max ID error = %v, want ErrStreamExhausted", err)
+	}
+
+	if _, added, _ := s.XAdd("missing", XAddArgs{AutoID: true, NoMkStream: true}, []string{"f", "v"}); added {
+		t.Error("XAdd(NOMKSTREAM) created the stream")
+	}
+	if s.KeyType("missing") != TypeNone {
+		t.Error("NOMKSTREAM stream exists")
+	}
+}
+
+func TestXAddTrim(t *testing.T) {
+	tests := []struct {
+		name string
+		trim StreamTrim
+		want []StreamID
+	}{
+		{"maxlen", StreamTrim{Strategy: TrimMaxLen, MaxLen: 2}, []StreamID{{Ms: 4}, {Ms: 5}}},
+		{"maxlen zero", StreamTrim{Strategy: TrimMaxLen}, []StreamID{}},
+		{"minid", StreamTrim{Strategy: TrimMinID, MinID: StreamID{Ms: 3}}, []StreamID{{Ms: 3}, {Ms: 4}, {Ms: 5}}},
+		{"limit", StreamTrim{Strategy: TrimMaxLen, MaxLen: 1, Limit: 2}, []StreamID{{Ms: 3}, {Ms: 4}, {Ms: 5}}},
+		{"approx", StreamTrim{Strategy: TrimMaxLen, MaxLen: 1, Approx: true}, []StreamID{{Ms: 1}, {Ms: 2}, {Ms: 3}, {Ms: 4}, {Ms: 5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStreamStore(t)
+			addEntries(t, s, "s", 4)
+			s.XAdd("s", XAddArgs{ID: StreamID{Ms: 5}, Trim: tt.trim}, []string{"n", "v"})
+
+			if got := entryIDs(s.XRange("s", StreamID{}, MaxStreamID, 0, false)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries after trim = %v, want %v", got, tt.want)
+			}
+			if info, _ := s.XInfoStream("s"); info.EntriesAdded != 5 || info.LastID != (StreamID{Ms: 5}) {
+				t.Errorf("XInfoStream() = %+v, want 5 entries added up to 5-0", info)
+			}
+		})
+	}
+}
+
+func TestXRange(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 5)
+
+	tests := []struct {
+		name       string
+		start, end StreamID
+		count      int
+		reverse    bool
+		want       []StreamID
+	}{
+		{"all", StreamID{}, MaxStreamID, 0, false, []StreamID{{Ms: 1}, {Ms: 2}, {Ms: 3}, {Ms: 4}, {Ms: 5}}},
+		{"inner", StreamID{Ms: 2}, StreamID{Ms: 3}, 0, false, []StreamID{{Ms: 2}, {Ms: 3}}},
+		{"count", StreamID{}, MaxStreamID, 2, false, []StreamID{{Ms: 1}, {Ms: 2}}},
+		{"reverse count", StreamID{}, MaxStreamID, 2, true, []StreamID{{Ms: 5}, {Ms: 4}}},
+		{"between entries", StreamID{Ms: 2, Seq: 1}, StreamID{Ms: 3, Seq: 5}, 0, false, []StreamID{{Ms: 3}}},
+		{"empty", StreamID{Ms: 4}, StreamID{Ms: 3}, 0, false, []StreamID{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := entryIDs(s.XRange("s", tt.start, tt.end, tt.count, tt.reverse))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("XRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := s.XRange("missing", StreamID{}, MaxStreamID, 0, false); len(got) != 0 {
+		t.Errorf("XRange(missing) = %v, want empty", got)
+	}
+}
+
+func TestXDelAndTrim(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 5)
+
+	if got := s.XDel("s", StreamID{Ms: 2}, StreamID{Ms: 4}, StreamID{Ms: 9}); got != 2 {
+		t.Errorf("XDel() = %d, want 2", got)
+	}
+	if got := s.XLen("s"); got != 3 {
+		t.Errorf("XLen() = %d, want 3", got)
+	}
+	if info, _ := s.XInfoStream("s"); info.MaxDeletedID != (StreamID{Ms: 4}) {
+		t.Errorf("MaxDeletedID = %v, want 4-0", info.MaxDeletedID)
+	}
+
+	if got := s.XTrim("s", StreamTrim{Strategy: TrimMaxLen, MaxLen: 1}); got != 2 {
+		t.Errorf("XTrim() = %d, want 2", got)
+	}
+
+	// Streams are not deleted when they become empty
+	s.XDel("s", StreamID{Ms: 5})
+	if s.KeyType("s") != TypeStream || s.XLen("s") != 0 {
+		t.Error("empty stream was deleted")
+	}
+	if got := s.XLastID("s"); got != (StreamID{Ms: 5}) {
+		t.Errorf("XLastID() = %v, want 5-0", got)
+	}
+}
+
+// TestXAddCapped checks a stream capped by XADD keeps the newest entries and
+// doesn't grow its array.
+func TestXAddCapped(t *testing.T) {
+	s := newTestStreamStore(t)
+	const maxLen = 10
+	for i := 1; i <= 10000; i++ {
+		args := XAddArgs{ID: StreamID{Ms: uint64(i)}, Trim: StreamTrim{Strategy: TrimMaxLen, MaxLen: maxLen}}
+		if _, _, err := s.XAdd("s", args, []string{"n", "v"}); err != nil {
+			t.Fatalf("XAdd(%d-0) failed: %v", i, err)
+		}
+	}
+
+	got := entryIDs(s.XRange("s", StreamID{}, MaxStreamID, 0, false))
+	if len(got) != maxLen || got[0] != (StreamID{Ms: 10000 - maxLen + 1}) || got[maxLen-1] != (StreamID{Ms: 10000}) {
+		t.Errorf("entries = %v, want the last %d", got, maxLen)
+	}
+	st := s.data["s"]
+	if size := cap(st.entries) + st.evicted; size > 4*maxLen {
+		t.Errorf("stream array holds %d slots for %d entries", size, maxLen)
+	}
+}
+
+func TestXTrimApprox(t *testing.T) {
+	tests := []struct {
+		name string
+		trim StreamTrim
+		want int64
+	}{
+		{"maxlen", StreamTrim{Strategy: TrimMaxLen, MaxLen: 10}, 200},
+		{"minid", StreamTrim{Strategy: TrimMinID, MinID: StreamID{Ms: 150}}, 100},
+		{"limit", StreamTrim{Strategy: TrimMaxLen, MaxLen: 10, Limit: 150}, 100},
+		{"limit below a node", StreamTrim{Strategy: TrimMaxLen, MaxLen: 10, Limit: 50}, 0},
+		{"less than a node over", StreamTrim{Strategy: TrimMaxLen, MaxLen: 200}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStreamStore(t)
+			addEntries(t, s, "s", 250)
+			tt.trim.Approx = true
+
+			if got := s.XTrim("s", tt.trim); got != tt.want {
+				t.Errorf("XTrim() = %d, want %d", got, tt.want)
+			}
+			if got := s.XLen("s"); got != 250-int(tt.want) {
+				t.Errorf("XLen() = %d, want %d", got, 250-tt.want)
+			}
+		})
+	}
+}
+
+func TestXGroupCreate(t *testing.T) {
+	s := newTestStreamStore(t)
+
+	if err := s.XGroupCreate("s", "g", StreamGroupStart{}, false); err != ErrStreamKeyRequired {
+		t.Errorf("XGroupCreate(missing) error = %v, want ErrStreamKeyRequired", err)
+	}
+	if err := s.XGroupCreate("s", "g", StreamGroupStart{LastEntry: true, EntriesRead: -1}, true); err != nil {
+		t.Fatalf("XGroupCreate(MKSTREAM) failed: %v", err)
+	}
+	if err := s.XGroupCreate("s", "g", StreamGroupStart{}, false); err != ErrBusyGroup {
+		t.Errorf("XGroupCreate(existing) error = %v, want ErrBusyGroup", err)
+	}
+	if !s.HasGroup("s", "g") || s.HasGroup("s", "other") {
+		t.Error("HasGroup() reports the wrong groups")
+	}
+
+	if created, _ := s.XGroupCreateConsumer("s", "g", "alice"); !created {
+		t.Error("XGroupCreateConsumer() = false, want true")
+	}
+	if created, _ := s.XGroupCreateConsumer("s", "g", "alice"); created {
+		t.Error("XGroupCreateConsumer(existing) = true, want false")
+	}
+	if _, err := s.XGroupCreateConsumer("s", "missing", "alice"); err != ErrNoGroup {
+		t.Errorf("XGroupCreateConsumer(missing group) error = %v, want ErrNoGroup", err)
+	}
+
+	if destroyed, _ := s.XGroupDestroy("s", "g"); !destroyed {
+		t.Error("XGroupDestroy() = false, want true")
+	}
+	if destroyed, _ := s.XGroupDestroy("s", "g"); destroyed {
+		t.Error("XGroupDestroy(missing) = true, want false")
+	}
+}
+
+func TestXReadGroup(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 3)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+
+	entries, err := s.XReadGroup("s", "g", "alice", StreamID{}, true, 2, false)
+	if err != nil || !reflect.DeepEqual(entryIDs(entries), []StreamID{{Ms: 1}, {Ms: 2}}) {
+		t.Fatalf("XReadGroup(>) = %v, %v, want 1-0 and 2-0", entryIDs(entries), err)
+	}
+	entries, _ = s.XReadGroup("s", "g", "bob", StreamID{}, true, 0, false)
+	if !reflect.DeepEqual(entryIDs(entries), []StreamID{{Ms: 3}}) {
+		t.Errorf("XReadGroup(>) for bob = %v, want 3-0", entryIDs(entries))
+	}
+	if entries, _ = s.XReadGroup("s", "g", "bob", StreamID{}, true, 0, false); len(entries) != 0 {
+		t.Errorf("XReadGroup(>) with nothing new = %v, want empty", entries)
+	}
+
+	// History only holds the consumer's own pending entries
+	entries, _ = s.XReadGroup("s", "g", "alice", StreamID{}, false, 0, false)
+	if !reflect.DeepEqual(entryIDs(entries), []StreamID{{Ms: 1}, {Ms: 2}}) {
+		t.Errorf("XReadGroup(0) = %v, want 1-0 and 2-0", entryIDs(entries))
+	}
+	entries, _ = s.XReadGroup("s", "g", "alice", StreamID{Ms: 1}, false, 0, false)
+	if !reflect.DeepEqual(entryIDs(entries), []StreamID{{Ms: 2}}) {
+		t.Errorf("XReadGroup(1-0) = %v, want 2-0", entryIDs(entries))
+	}
+
+	// A deleted entry stays pending, without fields
+	s.XDel("s", StreamID{Ms: 1})
+	entries, _ = s.XReadGroup("s", "g", "alice", StreamID{}, false, 1, false)
+	if len(entries) != 1 || entries[0].ID != (StreamID{Ms: 1}) || entries[0].Fields != nil {
+		t.Errorf("XReadGroup(0) after XDEL = %+v, want 1-0 with nil fields", entries)
+	}
+
+	if got := s.XAck("s", "g", StreamID{Ms: 1}, StreamID{Ms: 2}, StreamID{Ms: 9}); got != 2 {
+		t.Errorf("XAck() = %d, want 2", got)
+	}
+	if entries, _ = s.XReadGroup("s", "g", "alice", StreamID{}, false, 0, false); len(entries) != 0 {
+		t.Errorf("XReadGroup(0) after XACK = %v, want empty", entryIDs(entries))
+	}
+
+	if _, err := s.XReadGroup("s", "missing", "alice", StreamID{}, true, 0, false); err != ErrNoGroup {
+		t.Errorf("XReadGroup(missing group) error = %v, want ErrNoGroup", err)
+	}
+}
+
+func TestXReadGroupNoAck(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 2)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+
+	if entries, _ := s.XReadGroup("s", "g", "alice", StreamID{}, true, 0, true); len(entries) != 2 {
+		t.Fatalf("XReadGroup(NOACK) returned %d entries, want 2", len(entries))
+	}
+	if summary, _ := s.XPendingSummary("s", "g"); summary.Count != 0 {
+		t.Errorf("pending after NOACK = %d, want 0", summary.Count)
+	}
+}
+
+func TestXPending(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 4)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+	s.XReadGroup("s", "g", "alice", StreamID{}, true, 3, false)
+	s.XReadGroup("s", "g", "bob", StreamID{}, true, 1, false)
+
+	summary, err := s.XPendingSummary("s", "g")
+	if err != nil {
+		t.Fatalf("XPendingSummary() failed: %v", err)
+	}
+	want := StreamPendingSummary{
+		Count: 4,
+		First: StreamID{Ms: 1},
+		Last:  StreamID{Ms: 4},
+		Consumers: []StreamConsumerInfo{
+			{Name: "alice", Pending: 3},
+			{Name: "bob", Pending: 1},
+		},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("XPendingSummary() = %+v, want %+v", summary, want)
+	}
+
+	pending, _ := s.XPending("s", "g", StreamID{Ms: 2}, MaxStreamID, 10, "alice", 0)
+	if len(pending) != 2 || pending[0].ID != (StreamID{Ms: 2}) || pending[1].ID != (StreamID{Ms: 3}) || pending[0].DeliveryCount != 1 {
+		t.Errorf("XPending(alice from 2-0) = %+v, want 2-0 and 3-0", pending)
+	}
+	if pending, _ = s.XPending("s", "g", StreamID{}, MaxStreamID, 10, "", time.Hour); len(pending) != 0 {
+		t.Errorf("XPending(IDLE 1h) = %+v, want none", pending)
+	}
+	if _, err := s.XPendingSummary("missing", "g"); err != ErrNoGroup {
+		t.Errorf("XPendingSummary(missing) error = %v, want ErrNoGroup", err)
+	}
+}
+
+func TestXClaim(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 3)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+	s.XReadGroup("s", "g", "alice", StreamID{}, true, 2, false)
+
+	// Entries delivered just now aren't idle long enough
+	claimed, _ := s.XClaim("s", "g", "bob", XClaimArgs{MinIdle: time.Hour}, StreamID{Ms: 1})
+	if len(claimed) != 0 {
+		t.Errorf("XClaim(min idle 1h) = %v, want none", entryIDs(claimed))
+	}
+
+	claimed, _ = s.XClaim("s", "g", "bob", XClaimArgs{}, StreamID{Ms: 1}, StreamID{Ms: 3})
+	if !reflect.DeepEqual(entryIDs(claimed), []StreamID{{Ms: 1}}) || claimed[0].Fields == nil {
+		t.Errorf("XClaim() = %+v, want 1-0 with fields", claimed)
+	}
+	pending, _ := s.XPending("s", "g", StreamID{Ms: 1}, StreamID{Ms: 1}, 1, "", 0)
+	if len(pending) != 1 || pending[0].Consumer != "bob" || pending[0].DeliveryCount != 2 {
+		t.Errorf("pending 1-0 = %+v, want bob with 2 deliveries", pending)
+	}
+
+	// FORCE claims entries that aren't pending; JUSTID leaves the delivery count alone
+	claimed, _ = s.XClaim("s", "g", "bob", XClaimArgs{Force: true, JustID: true}, StreamID{Ms: 3})
+	if len(claimed) != 1 || claimed[0].Fields != nil {
+		t.Errorf("XClaim(FORCE JUSTID) = %+v, want 3-0 without fields", claimed)
+	}
+	if pending, _ = s.XPending("s", "g", StreamID{Ms: 3}, StreamID{Ms: 3}, 1, "", 0); len(pending) != 1 || pending[0].DeliveryCount != 0 {
+		t.Errorf("pending 3-0 = %+v, want 0 deliveries", pending)
+	}
+
+	claimed, _ = s.XClaim("s", "g", "carol", XClaimArgs{RetryCount: 7, HasRetryCount: true, DeliveryTime: time.Now().Add(-time.Minute)}, StreamID{Ms: 2})
+	pending, _ = s.XPending("s", "g", StreamID{Ms: 2}, StreamID{Ms: 2}, 1, "", 0)
+	if len(claimed) != 1 || len(pending) != 1 || pending[0].DeliveryCount != 7 || pending[0].Idle < time.Minute {
+		t.Errorf("pending 2-0 after XClaim(RETRYCOUNT IDLE) = %+v, want 7 deliveries idle a minute", pending)
+	}
+
+	// Claiming an entry deleted from the stream drops it from the pending list
+	s.XDel("s", StreamID{Ms: 1})
+	if claimed, _ = s.XClaim("s", "g", "alice", XClaimArgs{}, StreamID{Ms: 1}); len(claimed) != 0 {
+		t.Errorf("XClaim(deleted) = %v, want none", entryIDs(claimed))
+	}
+	if summary, _ := s.XPendingSummary("s", "g"); summary.Count != 2 {
+		t.Errorf("pending count = %d, want 2", summary.Count)
+	}
+}
+
+func TestXAutoClaim(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 5)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+	s.XReadGroup("s", "g", "alice", StreamID{}, true, 0, false)
+	s.XDel("s", StreamID{Ms: 2})
+
+	next, claimed, deleted, err := s.XAutoClaim("s", "g", "bob", 0, StreamID{}, 2, false)
+	if err != nil {
+		t.Fatalf("XAutoClaim() failed: %v", err)
+	}
+	if next != (StreamID{Ms: 4}) {
+		t.Errorf("next = %v, want 4-0", next)
+	}
+	if !reflect.DeepEqual(entryIDs(claimed), []StreamID{{Ms: 1}, {Ms: 3}}) {
+		t.Errorf("claimed = %v, want 1-0 and 3-0", entryIDs(claimed))
+	}
+	if !reflect.DeepEqual(deleted, []StreamID{{Ms: 2}}) {
+		t.Errorf("deleted = %v, want 2-0", deleted)
+	}
+
+	next, claimed, _, _ = s.XAutoClaim("s", "g", "bob", 0, next, 10, true)
+	if next != (StreamID{}) || len(claimed) != 2 || claimed[0].Fields != nil {
+		t.Errorf("second XAutoClaim() = %v, %+v, want 0-0 and 4-0, 5-0 without fields", next, claimed)
+	}
+
+	consumers, _ := s.XInfoConsumers("s", "g")
+	if len(consumers) != 2 || consumers[0].Pending != 0 || consumers[1].Pending != 4 {
+		t.Errorf("XInfoConsumers() = %+v, want alice 0 and bob 4 pending", consumers)
+	}
+}
+
+func TestXInfoGroupsLag(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 5)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+	s.XReadGroup("s", "g", "alice", StreamID{}, true, 2, false)
+
+	groups, _ := s.XInfoGroups("s")
+	want := []StreamGroupInfo{{Name: "g", Consumers: 1, Pending: 2, LastID: StreamID{Ms: 2}, EntriesRead: 2, Lag: 3}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("XInfoGroups() = %+v, want %+v", groups, want)
+	}
+
+	// A deletion ahead of the group makes the lag unknown
+	s.XDel("s", StreamID{Ms: 4})
+	if groups, _ = s.XInfoGroups("s"); groups[0].Lag != -1 {
+		t.Errorf("lag after XDEL = %d, want -1", groups[0].Lag)
+	}
+
+	// Once the group has read everything, the lag is known again
+	s.XReadGroup("s", "g", "alice", StreamID{}, true, 0, false)
+	if groups, _ = s.XInfoGroups("s"); groups[0].Lag != 0 || groups[0].EntriesRead != 5 {
+		t.Errorf("XInfoGroups() after reading all = %+v, want lag 0 and 5 read", groups[0])
+	}
+
+	s.XGroupCreate("s", "latest", StreamGroupStart{LastEntry: true, EntriesRead: -1}, false)
+	if groups, _ = s.XInfoGroups("s"); groups[1].Name != "latest" || groups[1].LastID != (StreamID{Ms: 5}) || groups[1].Lag != 0 {
+		t.Errorf("group created at $ = %+v, want last ID 5-0 and lag 0", groups[1])
+	}
+}
+
+func TestXGroupDelConsumer(t *testing.T) {
+	s := newTestStreamStore(t)
+	addEntries(t, s, "s", 3)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, false)
+	s.XReadGroup("s", "g", "alice", StreamID{}, true, 0, false)
+
+	if got, _ := s.XGroupDelConsumer("s", "g", "alice"); got != 3 {
+		t.Errorf("XGroupDelConsumer() = %d, want 3", got)
+	}
+	if summary, _ := s.XPendingSummary("s", "g"); summary.Count != 0 {
+		t.Errorf("pending after XGroupDelConsumer() = %d, want 0", summary.Count)
+	}
+	if consumers, _ := s.XInfoConsumers("s", "g"); len(consumers) != 0 {
+		t.Errorf("consumers = %+v, want none", consumers)
+	}
+}
+
+func TestStreamConcurrentAccess(t *testing.T) {
+	s := newTestStreamStore(t)
+	s.XGroupCreate("s", "g", StreamGroupStart{EntriesRead: -1}, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.XAdd("s", XAddArgs{AutoID: true}, []string{"f", "v"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				entries, _ := s.XReadGroup("s", "g", "c", StreamID{}, true, 10, false)
+				s.XAck("s", "g", entryIDs(entries)...)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := s.XLen("s"); got != 1000 {
+		t.Errorf("XLen() = %d, want 1000", got)
+	}
+}
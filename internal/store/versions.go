@@ -0,0 +1,130 @@
+// Package store provides per-key version tracking shared between stores.
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Versions tracks a version number for every watched key that has been
+// modified. Versions are drawn from a single counter, so a key that is
+// deleted and recreated never returns to a version it had before. This lets
+// WATCH detect any change, including a delete followed by a write.
+//
+// Only keys passed to Watch are tracked, and they are forgotten once every
+// watcher has called Unwatch, so the map stays as small as the set of
+// watched keys however many keys are written.
+//
+// Versions implements transaction.VersionTracker and transaction.WatchTracker.
+type Versions struct {
+	mu      sync.Mutex
+	clock   int64
+	keys    map[string]int64
+	watched map[string]int
+}
+
+// NewVersions creates an empty version tracker.
+func NewVersions() *Versions {
+	return &Versions{
+		keys:    make(map[string]int64),
+		watched: make(map[string]int),
+	}
+}
+
+// GetVersion returns the current version of a key.
+// Returns 0 for keys that haven't been modified since they were first
+// watched, and for keys nobody watches.
+func (v *Versions) GetVersion(key string) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.keys[key]
+}
+
+// IncrementVersion records a modification of the key.
+func (v *Versions) IncrementVersion(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clock++
+	if v.watched[key] > 0 {
+		v.keys[key] = v.clock
+	}
+}
+
+// Changes returns how many key modifications have been recorded, watched or
+// not.
+func (v *Versions) Changes() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.clock
+}
+
+// DeleteVersion forgets the version of a key.
+// Stores don't call this on delete; a deletion is a modification and bumps the
+// version like any other write.
+func (v *Versions) DeleteVersion(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.keys, key)
+}
+
+// Watch starts tracking the versions of keys, once for every call.
+func (v *Versions) Watch(keys ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range keys {
+		v.watched[key]++
+	}
+}
+
+// Unwatch undoes a call to Watch. A key's version is forgotten once it has
+// no watchers left.
+func (v *Versions) Unwatch(keys ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range keys {
+		if v.watched[key] > 1 {
+			v.watched[key]--
+			continue
+		}
+		delete(v.watched, key)
+		delete(v.keys, key)
+	}
+}
+
+// VersionTracked is implemented by stores that report key modifications.
+type VersionTracked interface {
+	TrackVersions(v *Versions)
+}
+
+// NewSharedVersions creates a Versions and attaches it to every store that implements VersionTracked.
+// Writes made through any of the stores then bump the same per-key version.
+func NewSharedVersions(stores ...interface{}) *Versions {
+	v := NewVersions()
+	for _, s := range stores {
+		if vt, ok := s.(VersionTracked); ok {
+			vt.TrackVersions(v)
+		}
+	}
+	return v
+}
+
+// versioned is embedded by stores to bump versions on a shared tracker.
+type versioned struct {
+	versions atomic.Pointer[Versions]
+}
+
+// TrackVersions makes the store bump versions on v whenever a key is modified.
+func (vs *versioned) TrackVersions(v *Versions) {
+	vs.versions.Store(v)
+}
+
+// touch bumps the version of the given keys, if a tracker is attached.
+func (vs *versioned) touch(keys ...string) {
+	v := vs.versions.Load()
+	if v == nil {
+		return
+	}
+	for _, key := range keys {
+		v.IncrementVersion(key)
+	}
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVersions(t *testing.T) {
+	v := NewVersions()
+	v.Watch("key")
+
+	if got := v.GetVersion("key"); got != 0 {
+		t.Errorf("GetVersion(unmodified) = %d, want 0", got)
+	}
+
+	v.IncrementVersion("key")
+	first := v.GetVersion("key")
+	if first == 0 {
+		t.Fatal("IncrementVersion did not change the version")
+	}
+
+	v.IncrementVersion("other")
+	if got := v.GetVersion("key"); got != first {
+		t.Errorf("modifying another key changed version: got %d, want %d", got, first)
+	}
+
+	v.IncrementVersion("key")
+	if got := v.GetVersion("key"); got == first {
+		t.Error("second IncrementVersion did not change the version")
+	}
+
+	v.DeleteVersion("key")
+	if got := v.GetVersion("key"); got != 0 {
+		t.Errorf("GetVersion after DeleteVersion = %d, want 0", got)
+	}
+}
+
+func TestVersionsChanges(t *testing.T) {
+	v := NewVersions()
+	start := v.Changes()
+	v.IncrementVersion("a")
+	v.IncrementVersion("a")
+	v.IncrementVersion("b")
+	if got := v.Changes() - start; got != 3 {
+		t.Errorf("Changes() advanced by %d, want 3", got)
+	}
+}
+
+func TestVersionsNeverRepeat(t *testing.T) {
+	v := NewVersions()
+	v.Watch("key")
+	seen := make(map[int64]bool)
+
+	for i := 0; i < 100; i++ {
+		v.IncrementVersion("key")
+		version := v.GetVersion("key")
+		if seen[version] {
+			t.Fatalf("version %d was handed out twice", version)
+		}
+		seen[version] = true
+	}
+}
+
+func TestNewSharedVersions(t *testing.T) {
+	strs := New()
+	defer strs.Close()
+	lists := NewListStore()
+	hashes := NewHashStore()
+	sets := NewSetStore()
+
+	v := NewSharedVersions(strs, lists, hashes, sets, "not a store")
+	v.Watch("s1", "s2", "l1", "h1", "set1")
+
+	tests := []struct {
+		name   string
+		key    string
+		modify func()
+	}{
+		{"Set", "s1", func() { strs.Set("s1", "v") }},
+		{"SetWithTTL", "s2", func() { strs.SetWithTTL("s2", "v", time.Hour) }},
+		{"Delete", "s1", func() { strs.Delete("s1") }},
+		{"LPush", "l1", func() { lists.LPush("l1", "a", "b") }},
+		{"RPush", "l1", func() { lists.RPush("l1", "c") }},
+		{"LPop", "l1", func() { lists.LPop("l1") }},
+		{"RPop", "l1", func() { lists.RPop("l1") }},
+		{"HSet", "h1", func() { hashes.HSet("h1", "f", "v") }},
+		{"HDel", "h1", func() { hashes.HDel("h1", "f") }},
+		{"SAdd", "set1", func() { sets.SAdd("set1", "m") }},
+		{"SRem", "set1", func() { sets.SRem("set1", "m") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := v.GetVersion(tt.key)
+			tt.modify()
+			if after := v.GetVersion(tt.key); after == before {
+				t.Errorf("%s did not bump the version of %q", tt.name, tt.key)
+			}
+		})
+	}
+}
+
+func TestVersionsUnchangedByNoOps(t *testing.T) {
+	strs := New()
+	defer strs.Close()
+	lists := NewListStore()
+	hashes := NewHashStore()
+	sets := NewSetStore()
+	v := NewSharedVersions(strs, lists, hashes, sets)
+	v.Watch("missing", "set", "hash")
+
+	sets.SAdd("set", "m")
+	hashes.HSet("hash", "f", "v")
+	setVersion := v.GetVersion("set")
+	hashVersion := v.GetVersion("hash")
+
+	strs.Delete("missing")
+	lists.LPop("missing")
+	sets.SAdd("set", "m")
+	sets.SRem("set", "other")
+	hashes.HDel("hash", "other")
+
+	if got := v.GetVersion("missing"); got != 0 {
+		t.Errorf("no-op on missing key bumped version to %d", got)
+	}
+	if got := v.GetVersion("set"); got != setVersion {
+		t.Error("no-op set operations bumped the version")
+	}
+	if got := v.GetVersion("hash"); got != hashVersion {
+		t.Error("no-op hash operations bumped the version")
+	}
+}
+
+func TestVersionsBumpedOnFlush(t *testing.T) {
+	strs := New()
+	defer strs.Close()
+	lists := NewListStore()
+	hashes := NewHashStore()
+	sets := NewSetStore()
+	v := NewSharedVersions(strs, lists, hashes, sets)
+	v.Watch("s", "l", "h", "set")
+
+	strs.Set("s", "v")
+	lists.RPush("l", "a")
+	hashes.HSet("h", "f", "v")
+	sets.SAdd("set", "m")
+
+	before := map[string]int64{}
+	for _, key := range []string{"s", "l", "h", "set"} {
+		before[key] = v.GetVersion(key)
+	}
+
+	strs.Flush()
+	lists.Flush()
+	hashes.Flush()
+	sets.Flush()
+
+	for key, version := range before {
+		if v.GetVersion(key) == version {
+			t.Errorf("Flush did not bump version of %q", key)
+		}
+	}
+	if len(strs.Keys()) != 0 || lists.LLen("l") != 0 || hashes.HLen("h") != 0 || sets.SCard("set") != 0 {
+		t.Error("Flush did not remove all keys")
+	}
+}
+
+func TestVersionsBumpedOnExpiry(t *testing.T) {
+	s := New()
+	defer s.Close()
+	v := NewSharedVersions(s)
+	v.Watch("key")
+
+	s.SetWithTTL("key", "value", 10*time.Millisecond)
+	before := v.GetVersion("key")
+
+	// Wait for the background cleanup to remove the key
+	time.Sleep(200 * time.Millisecond)
+
+	if v.GetVersion("key") == before {
+		t.Error("expiry did not bump the version")
+	}
+}
+
+func TestVersionsBumpedOnImport(t *testing.T) {
+	src := NewListStore()
+	src.RPush("list", "a")
+
+	dst := NewListStore()
+	v := NewSharedVersions(dst)
+	v.Watch("list")
+
+	if err := dst.(Snapshottable).ImportData(src.(Snapshottable).ExportData()); err != nil {
+		t.Fatalf("ImportData failed: %v", err)
+	}
+	if v.GetVersion("list") == 0 {
+		t.Error("ImportData did not bump the version")
+	}
+}
+
+func TestVersionsWatchCounted(t *testing.T) {
+	v := NewVersions()
+	v.Watch("key")
+	v.Watch("key")
+	v.IncrementVersion("key")
+	version := v.GetVersion("key")
+
+	v.Unwatch("key")
+	if got := v.GetVersion("key"); got != version {
+		t.Errorf("GetVersion with a watcher left = %d, want %d", got, version)
+	}
+	v.Unwatch("key")
+	if got := v.GetVersion("key"); got != 0 {
+		t.Errorf("GetVersion with no watchers = %d, want 0", got)
+	}
+	v.IncrementVersion("key")
+	if len(v.keys) != 0 || len(v.watched) != 0 {
+		t.Errorf("%d versions and %d watched keys kept after Unwatch, want none", len(v.keys), len(v.watched))
+	}
+}
+
+// TestVersionsBoundedByWatches checks writing many keys only keeps versions
+// for the watched ones.
+func TestVersionsBoundedByWatches(t *testing.T) {
+	strs := New()
+	defer strs.Close()
+	v := NewSharedVersions(strs)
+	v.Watch("watched")
+
+	const n = 100000
+	for i := range n {
+		key := fmt.Sprintf("key:%d", i)
+		strs.Set(key, "v")
+		strs.Delete(key)
+	}
+	strs.Set("watched", "v")
+	strs.Flush()
+
+	if len(v.keys) != 1 {
+		t.Errorf("%d versions kept after %d writes, want 1", len(v.keys), n)
+	}
+	if v.GetVersion("watched") == 0 {
+		t.Error("watched key's version not kept")
+	}
+	if got := v.Changes(); got < 2*n {
+		t.Errorf("Changes() = %d, want at least %d", got, 2*n)
+	}
+}
@@ -0,0 +1,700 @@
+// Package store provides sorted set storage implementation.
+package store
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrScoreNaN is returned when an increment would make a score NaN, e.g. inf + -inf.
+var ErrScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+
+// ZMember is a sorted set member and its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZAddFlags are the conditions of ZADD.
+// NX only adds new members and XX only updates existing ones.
+// GT and LT only update a member if the new score is greater or less than the current one;
+// they don't prevent new members from being added.
+type ZAddFlags struct {
+	NX, XX, GT, LT bool
+}
+
+// ZSetStore defines the interface for sorted set operations.
+// Ranks are 0-based. Negative start/stop ranks count from the end.
+// A negative count means no limit.
+type ZSetStore interface {
+	ZAdd(key string, flags ZAddFlags, members ...ZMember) (added, updated int)
+	ZIncrBy(key string, flags ZAddFlags, member string, increment float64) (float64, bool, error)
+	ZRem(key string, members ...string) int
+	ZScore(key, member string) (float64, bool)
+	ZCard(key string) int
+	ZCount(key string, min, max ScoreBound) int
+	ZRank(key, member string, reverse bool) (int, float64, bool)
+	ZRange(key string, start, stop int, reverse bool) []ZMember
+	ZRangeByScore(key string, min, max ScoreBound, reverse bool, offset, count int) []ZMember
+	ZRangeByLex(key string, min, max LexBound, reverse bool, offset, count int) []ZMember
+	ZPopMin(key string, count int) []ZMember
+	ZPopMax(key string, count int) []ZMember
+	ZRemRangeByRank(key string, start, stop int) int
+	ZRemRangeByScore(key string, min, max ScoreBound) int
+	ZRemRangeByLex(key string, min, max LexBound) int
+	ZReplace(key string, members []ZMember)
+	KeyType(key string) string
+	Delete(key string) bool
+	Keys() []string
+	Len() int
+	Flush()
+	Close()
+	Expirable
+	ExpiryTuner
+}
+
+// zset is a single sorted set: the map answers score lookups in O(1) and the
+// skiplist keeps members ordered for ranks and ranges.
+type zset struct {
+	scores map[string]float64
+	zsl    *skiplist
+}
+
+// newZSet creates an empty sorted set.
+func newZSet() *zset {
+	return &zset{
+		scores: make(map[string]float64),
+		zsl:    newSkiplist(),
+	}
+}
+
+// add inserts or rescores a member.
+func (z *zset) add(member string, score float64) {
+	if cur, exists := z.scores[member]; exists {
+		if cur == score {
+			return
+		}
+		z.zsl.delete(cur, member)
+	}
+	z.scores[member] = score
+	z.zsl.insert(score, member)
+}
+
+// remove deletes a member. Returns false if it wasn't in the set.
+func (z *zset) remove(member string) bool {
+	score, exists := z.scores[member]
+	if !exists {
+		return false
+	}
+	delete(z.scores, member)
+	z.zsl.delete(score, member)
+	return true
+}
+
+// rankRange converts start/stop ranks, which may be negative, to a 0-based
+// inclusive range. Returns false if the range is empty.
+func (z *zset) rankRange(start, stop int) (int, int, bool) {
+	length := z.zsl.length
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, true
+}
+
+// MemoryZSetStore is a thread-safe in-memory implementation of ZSetStore.
+type MemoryZSetStore struct {
+	versioned
+	snapshots[[]ZMember]
+	mu      sync.RWMutex
+	data    map[string]*zset
+	expires *expiryIndex
+}
+
+// NewZSetStore creates a new MemoryZSetStore.
+func NewZSetStore() *MemoryZSetStore {
+	return &MemoryZSetStore{
+		data:    make(map[string]*zset),
+		expires: newExpiryIndex(),
+	}
+}
+
+// ZAdd adds members or updates their scores, subject to flags.
+// Returns the number of members added and the number of existing members whose score changed.
+func (s *MemoryZSetStore) ZAdd(key string, flags ZAddFlags, members ...ZMember) (added, updated int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	z := s.data[key]
+	for _, m := range members {
+		var cur float64
+		var exists bool
+		if z != nil {
+			cur, exists = z.scores[m.Member]
+		}
+
+		if exists {
+			if flags.NX || !scoreAllowed(flags, cur, m.Score) || cur == m.Score {
+				continue
+			}
+			z.add(m.Member, m.Score)
+			updated++
+			continue
+		}
+
+		if flags.XX {
+			continue
+		}
+		if z == nil {
+			z = newZSet()
+			s.data[key] = z
+		}
+		z.add(m.Member, m.Score)
+		added++
+	}
+
+	if added+updated > 0 {
+		s.touch(key)
+	}
+	return added, updated
+}
+
+// ZIncrBy adds increment to the score of member, creating it with that score if missing.
+// Returns the new score, or false if flags prevented the update.
+func (s *MemoryZSetStore) ZIncrBy(key string, flags ZAddFlags, member string, increment float64) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	z := s.data[key]
+	var cur float64
+	var exists bool
+	if z != nil {
+		cur, exists = z.scores[member]
+	}
+
+	if (exists && flags.NX) || (!exists && flags.XX) {
+		return 0, false, nil
+	}
+
+	score := cur + increment
+	if math.IsNaN(score) {
+		return 0, false, ErrScoreNaN
+	}
+	if exists && !scoreAllowed(flags, cur, score) {
+		return 0, false, nil
+	}
+
+	if z == nil {
+		z = newZSet()
+		s.data[key] = z
+	}
+	z.add(member, score)
+	s.touch(key)
+	return score, true, nil
+}
+
+// scoreAllowed applies the GT and LT conditions to an update from cur to score.
+func scoreAllowed(flags ZAddFlags, cur, score float64) bool {
+	if flags.GT && score <= cur {
+		return false
+	}
+	if flags.LT && score >= cur {
+		return false
+	}
+	return true
+}
+
+// ZRem removes members from a sorted set. Returns the count of members removed.
+func (s *MemoryZSetStore) ZRem(key string, members ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	z, exists := s.data[key]
+	if !exists {
+		return 0
+	}
+
+	removed := 0
+	for _, member := range members {
+		if z.remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.deleteIfEmpty(key, z)
+		s.touch(key)
+	}
+	return removed
+}
+
+// ZScore returns the score of member.
+func (s *MemoryZSetStore) ZScore(key, member string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return 0, false
+	}
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// ZCard returns the number of members in a sorted set.
+func (s *MemoryZSetStore) ZCard(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return 0
+	}
+	return z.zsl.length
+}
+
+// ZCount returns the number of members with a score within [min, max].
+func (s *MemoryZSetStore) ZCount(key string, min, max ScoreBound) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return 0
+	}
+
+	first := z.zsl.firstInScoreRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := z.zsl.lastInScoreRange(min, max)
+	firstRank, _ := z.zsl.rank(first.score, first.member)
+	lastRank, _ := z.zsl.rank(last.score, last.member)
+	return lastRank - firstRank + 1
+}
+
+// ZRank returns the rank and score of member, counting from the highest score if reverse is set.
+func (s *MemoryZSetStore) ZRank(key, member string, reverse bool) (int, float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return 0, 0, false
+	}
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, 0, false
+	}
+
+	rank, _ := z.zsl.rank(score, member)
+	if reverse {
+		rank = z.zsl.length - 1 - rank
+	}
+	return rank, score, true
+}
+
+// ZRange returns the members with ranks within [start, stop].
+// With reverse set, ranks count from the highest score.
+func (s *MemoryZSetStore) ZRange(key string, start, stop int, reverse bool) []ZMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return []ZMember{}
+	}
+	return z.rangeByRank(start, stop, reverse)
+}
+
+// rangeByRank returns the members with ranks within [start, stop].
+func (z *zset) rangeByRank(start, stop int, reverse bool) []ZMember {
+	start, stop, ok := z.rankRange(start, stop)
+	if !ok {
+		return []ZMember{}
+	}
+
+	result := make([]ZMember, 0, stop-start+1)
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.byRank(z.zsl.length - 1 - start)
+	} else {
+		x = z.zsl.byRank(start)
+	}
+	for i := start; i <= stop && x != nil; i++ {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.levels[0].forward
+		}
+	}
+	return result
+}
+
+// ZRangeByScore returns the members with a score within [min, max], skipping
+// offset members and returning at most count. With reverse set, members are
+// returned from the highest score down.
+func (s *MemoryZSetStore) ZRangeByScore(key string, min, max ScoreBound, reverse bool, offset, count int) []ZMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return []ZMember{}
+	}
+	return z.rangeByScore(min, max, reverse, offset, count)
+}
+
+// rangeByScore returns the members with a score within [min, max].
+func (z *zset) rangeByScore(min, max ScoreBound, reverse bool, offset, count int) []ZMember {
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.lastInScoreRange(min, max)
+	} else {
+		x = z.zsl.firstInScoreRange(min, max)
+	}
+	return collectRange(x, reverse, offset, count, func(n *skiplistNode) bool {
+		if reverse {
+			return min.aboveMin(n.score)
+		}
+		return max.belowMax(n.score)
+	})
+}
+
+// ZRangeByLex returns the members within the lexicographic range [min, max],
+// skipping offset members and returning at most count. With reverse set,
+// members are returned in descending order.
+func (s *MemoryZSetStore) ZRangeByLex(key string, min, max LexBound, reverse bool, offset, count int) []ZMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, exists := s.lookup(key)
+	if !exists {
+		return []ZMember{}
+	}
+	return z.rangeByLex(min, max, reverse, offset, count)
+}
+
+// rangeByLex returns the members within the lexicographic range [min, max].
+func (z *zset) rangeByLex(min, max LexBound, reverse bool, offset, count int) []ZMember {
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.lastInLexRange(min, max)
+	} else {
+		x = z.zsl.firstInLexRange(min, max)
+	}
+	return collectRange(x, reverse, offset, count, func(n *skiplistNode) bool {
+		if reverse {
+			return min.aboveMin(n.member)
+		}
+		return max.belowMax(n.member)
+	})
+}
+
+// collectRange walks from x while inRange holds, skipping offset nodes and
+// collecting at most count (all if count is negative).
+func collectRange(x *skiplistNode, reverse bool, offset, count int, inRange func(*skiplistNode) bool) []ZMember {
+	result := []ZMember{}
+	if offset < 0 {
+		return result
+	}
+
+	next := func(n *skiplistNode) *skiplistNode {
+		if reverse {
+			return n.backward
+		}
+		return n.levels[0].forward
+	}
+
+	for ; x != nil && offset > 0 && inRange(x); offset-- {
+		x = next(x)
+	}
+	for ; x != nil && count != 0 && inRange(x); x = next(x) {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+		count--
+	}
+	return result
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores.
+func (s *MemoryZSetStore) ZPopMin(key string, count int) []ZMember {
+	return s.pop(key, count, false)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores.
+func (s *MemoryZSetStore) ZPopMax(key string, count int) []ZMember {
+	return s.pop(key, count, true)
+}
+
+// pop removes and returns up to count members from either end of a sorted set.
+func (s *MemoryZSetStore) pop(key string, count int, max bool) []ZMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	z, exists := s.data[key]
+	if !exists || count <= 0 {
+		return []ZMember{}
+	}
+
+	popped := z.rangeByRank(0, count-1, max)
+	for _, m := range popped {
+		z.remove(m.Member)
+	}
+	s.deleteIfEmpty(key, z)
+	s.touch(key)
+	return popped
+}
+
+// ZRemRangeByRank removes the members with ranks within [start, stop]. Returns the count removed.
+func (s *MemoryZSetStore) ZRemRangeByRank(key string, start, stop int) int {
+	return s.removeRange(key, func(z *zset) []ZMember {
+		return z.rangeByRank(start, stop, false)
+	})
+}
+
+// ZRemRangeByScore removes the members with a score within [min, max]. Returns the count removed.
+func (s *MemoryZSetStore) ZRemRangeByScore(key string, min, max ScoreBound) int {
+	return s.removeRange(key, func(z *zset) []ZMember {
+		return z.rangeByScore(min, max, false, 0, -1)
+	})
+}
+
+// ZRemRangeByLex removes the members within the lexicographic range [min, max]. Returns the count removed.
+func (s *MemoryZSetStore) ZRemRangeByLex(key string, min, max LexBound) int {
+	return s.removeRange(key, func(z *zset) []ZMember {
+		return z.rangeByLex(min, max, false, 0, -1)
+	})
+}
+
+// removeRange removes the members selected by members. Returns the count removed.
+func (s *MemoryZSetStore) removeRange(key string, members func(z *zset) []ZMember) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	z, exists := s.data[key]
+	if !exists {
+		return 0
+	}
+
+	removed := members(z)
+	for _, m := range removed {
+		z.remove(m.Member)
+	}
+	if len(removed) > 0 {
+		s.deleteIfEmpty(key, z)
+		s.touch(key)
+	}
+	return len(removed)
+}
+
+// ZReplace replaces a sorted set with the given members, clearing any expiration.
+// An empty list of members deletes the key.
+func (s *MemoryZSetStore) ZReplace(key string, members []ZMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	_, existed := s.data[key]
+	delete(s.data, key)
+	s.expires.remove(key)
+
+	if len(members) > 0 {
+		z := newZSet()
+		for _, m := range members {
+			z.add(m.Member, m.Score)
+		}
+		s.data[key] = z
+	}
+	if existed || len(members) > 0 {
+		s.touch(key)
+	}
+}
+
+// KeyType returns the type of the key ("zset" or "none").
+func (s *MemoryZSetStore) KeyType(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); exists {
+		return TypeZSet
+	}
+	return TypeNone
+}
+
+// Flush removes all sorted sets from the store.
+func (s *MemoryZSetStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserveAll()
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]*zset)
+	s.expires.clear()
+}
+
+// Delete removes a sorted set. Returns true if the key existed.
+func (s *MemoryZSetStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	_, exists := s.data[key]
+	if exists {
+		delete(s.data, key)
+		s.expires.remove(key)
+		s.touch(key)
+	}
+	return exists
+}
+
+// Keys returns the keys of all sorted sets in the store.
+func (s *MemoryZSetStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if !s.expires.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of keys in the store. Like Redis's DBSIZE, it counts
+// keys that have expired but haven't been deleted yet.
+func (s *MemoryZSetStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Expire sets the time at which a sorted set expires.
+// A time that is not in the future deletes the sorted set immediately.
+// Returns false if the key doesn't exist.
+func (s *MemoryZSetStore) Expire(key string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, exists := s.data[key]; !exists {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		delete(s.data, key)
+		s.expires.remove(key)
+	} else {
+		s.expires.set(key, at)
+		s.expires.start(&s.mu, s.expireKey)
+	}
+	s.touch(key)
+	return true
+}
+
+// Persist removes the expiration of a sorted set.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemoryZSetStore) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preserve(key)
+	s.removeIfExpired(key)
+	if _, ok := s.expires.get(key); !ok {
+		return false
+	}
+	s.expires.remove(key)
+	s.touch(key)
+	return true
+}
+
+// ExpiresAt returns the time at which a sorted set expires.
+// Returns false if the key doesn't exist or has no expiration.
+func (s *MemoryZSetStore) ExpiresAt(key string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.lookup(key); !exists {
+		return time.Time{}, false
+	}
+	return s.expires.get(key)
+}
+
+// Close stops the background cleanup goroutine.
+func (s *MemoryZSetStore) Close() {
+	s.expires.stop()
+}
+
+// lookup returns the sorted set stored at key, treating expired sets as missing.
+// Caller must hold s.mu.
+func (s *MemoryZSetStore) lookup(key string) (*zset, bool) {
+	z, exists := s.data[key]
+	if !exists || s.expires.isExpired(key, time.Now()) {
+		return nil, false
+	}
+	return z, true
+}
+
+// deleteIfEmpty removes a sorted set that has no members left (Redis behavior).
+// Caller must hold s.mu for writing.
+func (s *MemoryZSetStore) deleteIfEmpty(key string, z *zset) {
+	if z.zsl.length == 0 {
+		delete(s.data, key)
+		s.expires.remove(key)
+	}
+}
+
+// removeIfExpired lazily deletes key if it has expired.
+// Caller must hold s.mu for writing.
+func (s *MemoryZSetStore) removeIfExpired(key string) {
+	if s.expires.isExpired(key, time.Now()) {
+		s.expireKey(key)
+	}
+}
+
+// expireKey deletes a sorted set whose TTL has passed.
+// Caller must hold s.mu for writing.
+func (s *MemoryZSetStore) expireKey(key string) {
+	delete(s.data, key)
+	s.expires.remove(key)
+	s.expires.countExpired()
+	s.touch(key)
+}
+
+// SetExpiryConfig tunes active expiration.
+func (s *MemoryZSetStore) SetExpiryConfig(cfg ExpiryConfig) {
+	s.expires.setConfig(cfg)
+}
+
+// ExpiryStats returns expiration statistics.
+func (s *MemoryZSetStore) ExpiryStats() ExpiryStats {
+	return s.expires.stats()
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func newTestZSetStore(t *testing.T) *MemoryZSetStore {
+	t.Helper()
+	s := NewZSetStore()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// zmembers builds members from alternating member/score arguments.
+func zmembers(pairs ...interface{}) []ZMember {
+	members := make([]ZMember, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		members = append(members, ZMember{Member: pairs[i].(string), Score: float64(pairs[i+1].(int))})
+	}
+	return members
+}
+
+func TestZAdd(t *testing.T) {
+	tests := []struct {
+		name        string
+		flags       ZAddFlags
+		members     []ZMember
+		wantAdded   int
+		wantUpdated int
+		wantScores  map[string]float64
+	}{
+		{"add new", ZAddFlags{}, zmembers("c", 3), 1, 0, map[string]float64{"a": 1, "b": 2, "c": 3}},
+		{"update", ZAddFlags{}, zmembers("a", 5), 0, 1, map[string]float64{"a": 5, "b": 2}},
+		{"same score", ZAddFlags{}, zmembers("a", 1), 0, 0, map[string]float64{"a": 1, "b": 2}},
+		{"NX skips existing", ZAddFlags{NX: true}, zmembers("a", 5, "c", 3), 1, 0, map[string]float64{"a": 1, "b": 2, "c": 3}},
+		{"XX skips new", ZAddFlags{XX: true}, zmembers("a", 5, "c", 3), 0, 1, map[string]float64{"a": 5, "b": 2}},
+		{"GT", ZAddFlags{GT: true}, zmembers("a", 5, "b", 0, "c", 3), 1, 1, map[string]float64{"a": 5, "b": 2, "c": 3}},
+		{"LT", ZAddFlags{LT: true}, zmembers("a", 5, "b", 0), 0, 1, map[string]float64{"a": 1, "b": 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestZSetStore(t)
+			s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2)...)
+
+			added, updated := s.ZAdd("z", tt.flags, tt.members...)
+			if added != tt.wantAdded || updated != tt.wantUpdated {
+				t.Errorf("ZAdd() = %d, %d, want %d, %d", added, updated, tt.wantAdded, tt.wantUpdated)
+			}
+			if got := s.ZCard("z"); got != len(tt.wantScores) {
+				t.Errorf("ZCard() = %d, want %d", got, len(tt.wantScores))
+			}
+			for member, want := range tt.wantScores {
+				if got, ok := s.ZScore("z", member); !ok || got != want {
+					t.Errorf("ZScore(%q) = %v, %v, want %v", member, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestZIncrBy(t *testing.T) {
+	s := newTestZSetStore(t)
+
+	score, ok, err := s.ZIncrBy("z", ZAddFlags{}, "a", 2.5)
+	if err != nil || !ok || score != 2.5 {
+		t.Errorf("ZIncrBy(new) = %v, %v, %v, want 2.5, true, nil", score, ok, err)
+	}
+	score, _, _ = s.ZIncrBy("z", ZAddFlags{}, "a", -1)
+	if score != 1.5 {
+		t.Errorf("ZIncrBy(existing) = %v, want 1.5", score)
+	}
+
+	if _, ok, _ := s.ZIncrBy("z", ZAddFlags{NX: true}, "a", 1); ok {
+		t.Error("ZIncrBy with NX on existing member succeeded")
+	}
+	if _, ok, _ := s.ZIncrBy("z", ZAddFlags{XX: true}, "b", 1); ok {
+		t.Error("ZIncrBy with XX on missing member succeeded")
+	}
+	if _, ok, _ := s.ZIncrBy("z", ZAddFlags{GT: true}, "a", -1); ok {
+		t.Error("ZIncrBy with GT and a negative increment succeeded")
+	}
+
+	s.ZAdd("z", ZAddFlags{}, ZMember{Member: "inf", Score: math.Inf(1)})
+	if _, _, err := s.ZIncrBy("z", ZAddFlags{}, "inf", math.Inf(-1)); err != ErrScoreNaN {
+		t.Errorf("ZIncrBy(inf + -inf) error = %v, want ErrScoreNaN", err)
+	}
+}
+
+func TestZRemAutoDelete(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2)...)
+
+	if got := s.ZRem("z", "a", "missing"); got != 1 {
+		t.Errorf("ZRem() = %d, want 1", got)
+	}
+	if got := s.ZRem("z", "b"); got != 1 {
+		t.Errorf("ZRem() = %d, want 1", got)
+	}
+	if got := s.KeyType("z"); got != TypeNone {
+		t.Errorf("KeyType() after removing all members = %q, want %q", got, TypeNone)
+	}
+}
+
+func TestZRankAndCount(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2, "c", 3, "d", 4)...)
+
+	if rank, score, ok := s.ZRank("z", "c", false); !ok || rank != 2 || score != 3 {
+		t.Errorf("ZRank(c) = %d, %v, %v, want 2, 3, true", rank, score, ok)
+	}
+	if rank, _, ok := s.ZRank("z", "c", true); !ok || rank != 1 {
+		t.Errorf("ZRank(c, reverse) = %d, %v, want 1, true", rank, ok)
+	}
+	if _, _, ok := s.ZRank("z", "missing", false); ok {
+		t.Error("ZRank(missing) found a member")
+	}
+
+	tests := []struct {
+		min, max ScoreBound
+		want     int
+	}{
+		{ScoreBound{Value: 2}, ScoreBound{Value: 3}, 2},
+		{ScoreBound{Value: 1, Exclusive: true}, ScoreBound{Value: math.Inf(1)}, 3},
+		{ScoreBound{Value: math.Inf(-1)}, ScoreBound{Value: math.Inf(1)}, 4},
+		{ScoreBound{Value: 5}, ScoreBound{Value: 10}, 0},
+	}
+	for _, tt := range tests {
+		if got := s.ZCount("z", tt.min, tt.max); got != tt.want {
+			t.Errorf("ZCount(%v, %v) = %d, want %d", tt.min, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestZRange(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2, "c", 3, "d", 4)...)
+
+	tests := []struct {
+		name        string
+		start, stop int
+		reverse     bool
+		want        []ZMember
+	}{
+		{"all", 0, -1, false, zmembers("a", 1, "b", 2, "c", 3, "d", 4)},
+		{"middle", 1, 2, false, zmembers("b", 2, "c", 3)},
+		{"negative", -2, -1, false, zmembers("c", 3, "d", 4)},
+		{"reverse", 0, 1, true, zmembers("d", 4, "c", 3)},
+		{"stop past end", 2, 100, false, zmembers("c", 3, "d", 4)},
+		{"empty", 3, 1, false, []ZMember{}},
+		{"start past end", 10, 20, false, []ZMember{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.ZRange("z", tt.start, tt.stop, tt.reverse); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ZRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZRangeByScore(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2, "c", 3, "d", 4)...)
+
+	all := ScoreBound{Value: math.Inf(-1)}
+	top := ScoreBound{Value: math.Inf(1)}
+
+	tests := []struct {
+		name          string
+		min, max      ScoreBound
+		reverse       bool
+		offset, count int
+		want          []ZMember
+	}{
+		{"all", all, top, false, 0, -1, zmembers("a", 1, "b", 2, "c", 3, "d", 4)},
+		{"exclusive", ScoreBound{Value: 1, Exclusive: true}, ScoreBound{Value: 4, Exclusive: true}, false, 0, -1, zmembers("b", 2, "c", 3)},
+		{"limit", all, top, false, 1, 2, zmembers("b", 2, "c", 3)},
+		{"reverse limit", all, top, true, 1, 2, zmembers("c", 3, "b", 2)},
+		{"reverse range", ScoreBound{Value: 2}, ScoreBound{Value: 3}, true, 0, -1, zmembers("c", 3, "b", 2)},
+		{"negative offset", all, top, false, -1, 2, []ZMember{}},
+		{"offset past end", all, top, false, 10, -1, []ZMember{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.ZRangeByScore("z", tt.min, tt.max, tt.reverse, tt.offset, tt.count)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ZRangeByScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZRangeByLex(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 0, "b", 0, "c", 0, "d", 0)...)
+
+	got := s.ZRangeByLex("z", LexBound{Value: "b"}, LexBound{Inf: 1}, false, 0, -1)
+	if want := zmembers("b", 0, "c", 0, "d", 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZRangeByLex([b, +) = %v, want %v", got, want)
+	}
+
+	got = s.ZRangeByLex("z", LexBound{Inf: -1}, LexBound{Value: "c", Exclusive: true}, true, 0, 1)
+	if want := zmembers("b", 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZRangeByLex(-, (c) reverse limit 1 = %v, want %v", got, want)
+	}
+}
+
+func TestZPop(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2, "c", 3)...)
+
+	if got, want := s.ZPopMin("z", 1), zmembers("a", 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZPopMin() = %v, want %v", got, want)
+	}
+	if got, want := s.ZPopMax("z", 5), zmembers("c", 3, "b", 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZPopMax() = %v, want %v", got, want)
+	}
+	if got := s.KeyType("z"); got != TypeNone {
+		t.Errorf("KeyType() after popping everything = %q, want %q", got, TypeNone)
+	}
+	if got := s.ZPopMin("z", 1); len(got) != 0 {
+		t.Errorf("ZPopMin(missing) = %v, want empty", got)
+	}
+}
+
+func TestZRemRange(t *testing.T) {
+	newStore := func() *MemoryZSetStore {
+		s := newTestZSetStore(t)
+		s.ZAdd("z", ZAddFlags{}, zmembers("a", 1, "b", 2, "c", 3, "d", 4)...)
+		return s
+	}
+
+	s := newStore()
+	if got := s.ZRemRangeByRank("z", 0, 1); got != 2 {
+		t.Errorf("ZRemRangeByRank() = %d, want 2", got)
+	}
+	if got := s.ZRange("z", 0, -1, false); !reflect.DeepEqual(got, zmembers("c", 3, "d", 4)) {
+		t.Errorf("after ZRemRangeByRank: %v", got)
+	}
+
+	s = newStore()
+	if got := s.ZRemRangeByScore("z", ScoreBound{Value: 2}, ScoreBound{Value: 3}); got != 2 {
+		t.Errorf("ZRemRangeByScore() = %d, want 2", got)
+	}
+	if got := s.ZRange("z", 0, -1, false); !reflect.DeepEqual(got, zmembers("a", 1, "d", 4)) {
+		t.Errorf("after ZRemRangeByScore: %v", got)
+	}
+
+	s = newStore()
+	if got := s.ZRemRangeByLex("z", LexBound{Inf: -1}, LexBound{Inf: 1}); got != 4 {
+		t.Errorf("ZRemRangeByLex() = %d, want 4", got)
+	}
+	if got := s.KeyType("z"); got != TypeNone {
+		t.Errorf("KeyType() after removing everything = %q, want %q", got, TypeNone)
+	}
+}
+
+func TestZReplace(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z", ZAddFlags{}, zmembers("a", 1)...)
+
+	s.ZReplace("z", zmembers("x", 9, "y", 8))
+	if got, want := s.ZRange("z", 0, -1, false), zmembers("y", 8, "x", 9); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZRange() after ZReplace = %v, want %v", got, want)
+	}
+
+	s.ZReplace("z", nil)
+	if got := s.KeyType("z"); got != TypeNone {
+		t.Errorf("KeyType() after empty ZReplace = %q, want %q", got, TypeNone)
+	}
+}
+
+func TestZSetStoreDeleteAndKeys(t *testing.T) {
+	s := newTestZSetStore(t)
+	s.ZAdd("z1", ZAddFlags{}, zmembers("a", 1)...)
+	s.ZAdd("z2", ZAddFlags{}, zmembers("a", 1)...)
+
+	if len(s.Keys()) != 2 {
+		t.Errorf("Keys() returned %d keys, want 2", len(s.Keys()))
+	}
+	if !s.Delete("z1") {
+		t.Error("Delete(z1) = false, want true")
+	}
+	if s.Delete("z1") {
+		t.Error("Delete(z1) twice = true, want false")
+	}
+	if got := s.KeyType("z2"); got != TypeZSet {
+		t.Errorf("KeyType(z2) = %q, want %q", got, TypeZSet)
+	}
+}
+
+func TestConcurrentZSetAccess(t *testing.T) {
+	s := newTestZSetStore(t)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			s.ZIncrBy("z", ZAddFlags{}, "counter", 1)
+		}(i)
+		go func() {
+			defer wg.Done()
+			s.ZRange("z", 0, -1, false)
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := s.ZScore("z", "counter"); got != 100 {
+		t.Errorf("ZScore(counter) = %v, want 100", got)
+	}
+}
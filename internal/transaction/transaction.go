@@ -83,6 +83,8 @@ func (t *Transaction) QueueLength() int {
 }
 
 // Exec executes all queued commands atomically and returns the results.
+// Isolation from other clients is the caller's job: it must hold whatever lock
+// serializes command execution for the duration of the call.
 // Returns nil results if watched keys have changed.
 // After EXEC, the transaction is reset and watched keys are cleared.
 func (t *Transaction) Exec(executor CommandExecutor, getVersion VersionGetter) ([]resp.Value, error) {
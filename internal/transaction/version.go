@@ -17,6 +17,15 @@ type VersionTracker interface {
 	DeleteVersion(key string)
 }
 
+// WatchTracker is implemented by version trackers that only keep versions
+// of watched keys. Watch is called before the versions of keys are read for
+// WATCH, and Unwatch once the client stops watching them. Calls are counted,
+// so a key stays tracked while any client watches it.
+type WatchTracker interface {
+	Watch(keys ...string)
+	Unwatch(keys ...string)
+}
+
 // MemoryVersionTracker is a simple in-memory implementation of VersionTracker.
 // This is used for testing. The actual store can implement VersionTracker directly.
 type MemoryVersionTracker struct {